@@ -18,6 +18,7 @@ CREATE TABLE IF NOT EXISTS users (
 -- 分类表
 CREATE TABLE IF NOT EXISTS categories (
     id SERIAL PRIMARY KEY,
+    uuid VARCHAR(36) NOT NULL DEFAULT uuid_generate_v4()::text, -- 客户端生成的公开标识，离线创建时即可被引用
     user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     name VARCHAR(100) NOT NULL,
     color VARCHAR(7) DEFAULT '#2196F3', -- 默认蓝色
@@ -25,8 +26,9 @@ CREATE TABLE IF NOT EXISTS categories (
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     is_deleted BOOLEAN DEFAULT FALSE,
-    sync_version BIGINT DEFAULT EXTRACT(EPOCH FROM CURRENT_TIMESTAMP) * 1000, -- 毫秒时间戳
-    UNIQUE(user_id, name) -- 同一用户下分类名称唯一
+    sync_version BIGINT NOT NULL DEFAULT 0, -- 用户级同步版本号，由 sync_sequences 分配
+    UNIQUE(user_id, name), -- 同一用户下分类名称唯一
+    UNIQUE(user_id, uuid)
 );
 
 -- 用户设置表
@@ -36,14 +38,16 @@ CREATE TABLE IF NOT EXISTS user_settings (
     notification_time TIME DEFAULT '09:00:00',
     language VARCHAR(10) DEFAULT 'zh-CN',
     timezone VARCHAR(50) DEFAULT 'Asia/Shanghai',
+    daily_digest BOOLEAN NOT NULL DEFAULT TRUE, -- 是否在通知时间接收每日摘要
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    sync_version BIGINT DEFAULT EXTRACT(EPOCH FROM CURRENT_TIMESTAMP) * 1000 -- 毫秒时间戳
+    sync_version BIGINT NOT NULL DEFAULT 0 -- 用户级同步版本号，由 sync_sequences 分配
 );
 
 -- TODO任务表（扩展版）
 CREATE TABLE IF NOT EXISTS todos (
     id SERIAL PRIMARY KEY,
+    uuid VARCHAR(36) NOT NULL DEFAULT uuid_generate_v4()::text, -- 客户端生成的公开标识，离线创建时即可被引用
     user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     title VARCHAR(200) NOT NULL,
     description TEXT,
@@ -53,10 +57,233 @@ CREATE TABLE IF NOT EXISTS todos (
     tags JSONB DEFAULT '[]'::jsonb, -- 存储标签数组
     category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL,
     reminder TIMESTAMP WITH TIME ZONE,
+    recurrence VARCHAR(255),
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     is_deleted BOOLEAN DEFAULT FALSE,
-    sync_version BIGINT DEFAULT EXTRACT(EPOCH FROM CURRENT_TIMESTAMP) * 1000 -- 毫秒时间戳
+    sync_version BIGINT NOT NULL DEFAULT 0, -- 用户级同步版本号，由 sync_sequences 分配
+    search_vector TSVECTOR, -- 全文搜索向量，由应用分词后写入
+    UNIQUE(user_id, uuid)
+);
+
+-- TODO快照表（保存每个TODO最近若干版本的完整数据，用于同步冲突的字段级三方合并）
+CREATE TABLE IF NOT EXISTS todo_snapshots (
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    sync_version BIGINT NOT NULL, -- 快照对应的同步版本号
+    data JSONB NOT NULL, -- 该版本的TODO完整数据
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (todo_id, sync_version)
+);
+
+-- TODO检查项表（TODO下的有序子任务，与TODO共用同步版本号序列）
+CREATE TABLE IF NOT EXISTS todo_checklist_items (
+    id SERIAL PRIMARY KEY,
+    uuid VARCHAR(36) NOT NULL DEFAULT uuid_generate_v4()::text, -- 客户端生成的公开标识，离线创建时即可被引用
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title VARCHAR(200) NOT NULL,
+    completed BOOLEAN DEFAULT FALSE,
+    position INTEGER NOT NULL DEFAULT 0, -- 同一TODO内的排序位置，从1开始
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    is_deleted BOOLEAN DEFAULT FALSE,
+    sync_version BIGINT NOT NULL DEFAULT 0, -- 用户级同步版本号，由 sync_sequences 分配
+    UNIQUE(user_id, uuid)
+);
+
+-- 标签表（标签元数据，TODO中仍以名称保存标签，与TODO共用同步版本号序列）
+CREATE TABLE IF NOT EXISTS tags (
+    id SERIAL PRIMARY KEY,
+    uuid VARCHAR(36) NOT NULL DEFAULT uuid_generate_v4()::text, -- 客户端生成的公开标识，离线创建时即可被引用
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL, -- 与 todos.tags 中的名称对应，未删除的标签名称在用户内唯一
+    color VARCHAR(7) DEFAULT '#9E9E9E',
+    icon VARCHAR(50) DEFAULT 'label',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    is_deleted BOOLEAN DEFAULT FALSE,
+    sync_version BIGINT NOT NULL DEFAULT 0, -- 用户级同步版本号，由 sync_sequences 分配
+    UNIQUE(user_id, uuid)
+);
+
+-- 智能列表表（保存的筛选和排序条件，与TODO共用同步版本号序列）
+CREATE TABLE IF NOT EXISTS smart_lists (
+    id SERIAL PRIMARY KEY,
+    uuid VARCHAR(36) NOT NULL DEFAULT uuid_generate_v4()::text, -- 客户端生成的公开标识，离线创建时即可被引用
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    icon VARCHAR(50) DEFAULT 'list',
+    color VARCHAR(7) DEFAULT '#2196F3',
+    definition JSONB NOT NULL DEFAULT '{}', -- 筛选和排序条件，分类以UUID引用
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    is_deleted BOOLEAN DEFAULT FALSE,
+    sync_version BIGINT NOT NULL DEFAULT 0, -- 用户级同步版本号，由 sync_sequences 分配
+    UNIQUE(user_id, uuid)
+);
+
+-- 修改历史表（TODO和分类的字段级修改记录，不引用 todos，物理删除后历史仍然保留）
+CREATE TABLE IF NOT EXISTS todo_revisions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    entity_type VARCHAR(20) NOT NULL, -- todo 或 category
+    entity_id INTEGER NOT NULL,
+    entity_uuid VARCHAR(36) NOT NULL,
+    action VARCHAR(20) NOT NULL, -- create、update、delete 或 restore
+    changes JSONB NOT NULL DEFAULT '{}', -- 发生变化的字段：{"字段": {"old": 旧值, "new": 新值}}
+    device_id VARCHAR(36) NOT NULL DEFAULT '', -- 发起修改的设备，非设备会话为空
+    sync_version BIGINT NOT NULL DEFAULT 0, -- 修改产生的同步版本号，物理删除为 0
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 提醒投递记录表（到期的TODO提醒在每个通知渠道上的投递状态，同一提醒在每个渠道只投递一次）
+CREATE TABLE IF NOT EXISTS reminder_deliveries (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    reminder_at TIMESTAMP WITH TIME ZONE NOT NULL, -- 投递的提醒时间，TODO修改提醒时间后按新时间重新投递
+    channel VARCHAR(20) NOT NULL, -- webhook/email/push
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending/sending/sent/failed/skipped/cancelled
+    attempts INTEGER NOT NULL DEFAULT 0, -- 已尝试发送的次数
+    last_error TEXT NOT NULL DEFAULT '', -- 最近一次失败或取消的原因
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL, -- 下次尝试发送的时间
+    claimed_by VARCHAR(64) NOT NULL DEFAULT '', -- 认领该记录的服务实例
+    claimed_until TIMESTAMP WITH TIME ZONE, -- 认领租约到期时间，实例中途退出时到期后由其他实例重新认领
+    sent_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(todo_id, reminder_at, channel)
+);
+
+-- 每日摘要投递记录表（每个用户在通知时间按用户时区生成当天的摘要，同一天在每个渠道只投递一次）
+CREATE TABLE IF NOT EXISTS digest_deliveries (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    digest_date VARCHAR(10) NOT NULL, -- 摘要日期（用户时区），YYYY-MM-DD
+    channel VARCHAR(20) NOT NULL, -- webhook/email/push
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending/sending/sent/failed/skipped/cancelled
+    attempts INTEGER NOT NULL DEFAULT 0, -- 已尝试发送的次数
+    last_error TEXT NOT NULL DEFAULT '', -- 最近一次失败或取消的原因
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL, -- 下次尝试发送的时间
+    claimed_by VARCHAR(64) NOT NULL DEFAULT '', -- 认领该记录的服务实例
+    claimed_until TIMESTAMP WITH TIME ZONE, -- 认领租约到期时间
+    sent_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, digest_date, channel)
+);
+
+-- Webhook表（用户登记的事件接收地址，连续失败达到上限后自动停用）
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(100) NOT NULL, -- HMAC-SHA256签名密钥
+    events JSONB NOT NULL DEFAULT '[]'::jsonb, -- 订阅的事件类型，支持 todo.* 形式的通配，空数组表示全部事件
+    all_users BOOLEAN NOT NULL DEFAULT FALSE, -- 是否接收全部用户的事件（仅管理员）
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    consecutive_failures INTEGER NOT NULL DEFAULT 0, -- 连续发送失败的次数，发送成功后清零
+    disabled_at TIMESTAMP WITH TIME ZONE, -- 自动停用的时间
+    disabled_reason TEXT NOT NULL DEFAULT '', -- 自动停用前最后一次失败的原因
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Webhook事件表（与数据写入在同一事务中生成，只保存有Webhook订阅的事件）
+CREATE TABLE IF NOT EXISTS webhook_events (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_type VARCHAR(30) NOT NULL, -- todo.created/todo.updated/todo.completed/todo.deleted/category.*/settings.updated
+    entity_type VARCHAR(20) NOT NULL, -- todo/category/settings
+    entity_id INTEGER NOT NULL DEFAULT 0,
+    entity_uuid VARCHAR(36) NOT NULL DEFAULT '',
+    sync_version BIGINT NOT NULL DEFAULT 0, -- 写入产生的同步版本号
+    data JSONB NOT NULL, -- 写入后的数据，物理删除时为删除前的数据
+    changes JSONB NOT NULL DEFAULT '{}', -- 字段级变化 {"字段": {"old": 旧值, "new": 新值}}
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Webhook投递记录表（每个事件向每个订阅的Webhook投递一次，重放时生成新的记录）
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id SERIAL PRIMARY KEY,
+    endpoint_id INTEGER NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event_id INTEGER NOT NULL REFERENCES webhook_events(id) ON DELETE CASCADE,
+    event_type VARCHAR(30) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending/sending/sent/failed/cancelled
+    attempts INTEGER NOT NULL DEFAULT 0, -- 已尝试发送的次数
+    last_error TEXT NOT NULL DEFAULT '', -- 最近一次失败或取消的原因
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL, -- 下次尝试发送的时间
+    claimed_by VARCHAR(64) NOT NULL DEFAULT '', -- 认领该记录的服务实例
+    claimed_until TIMESTAMP WITH TIME ZONE, -- 认领租约到期时间
+    sent_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 日历订阅表（只保存订阅令牌哈希，可限定为一个分类，分类被彻底删除时一并删除）
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL DEFAULT '', -- 订阅名称，用作日历名称
+    category_id INTEGER REFERENCES categories(id) ON DELETE CASCADE, -- 限定的分类，为空表示全部TODO
+    token_hash VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 十六进制
+    last_accessed_at TIMESTAMP WITH TIME ZONE, -- 最近一次被日历客户端读取的时间
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 应用专用密码表（CalDAV客户端使用，只保存密码哈希，退出所有设备时全部删除）
+CREATE TABLE IF NOT EXISTS app_passwords (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL DEFAULT '', -- 名称，用于区分使用该密码的客户端
+    password_hash VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 十六进制
+    last_used_at TIMESTAMP WITH TIME ZONE, -- 客户端最后一次使用该密码的时间
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 刷新令牌表（只保存令牌哈希，同一登录会话内轮换的令牌共享 session_id）
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_id VARCHAR(36) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 十六进制
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    used_at TIMESTAMP WITH TIME ZONE, -- 轮换时间，非空表示已换取新令牌
+    revoked_at TIMESTAMP WITH TIME ZONE -- 撤销时间（退出登录/退出所有设备/检测到重复使用）
+);
+
+-- 同步版本号计数表（每个用户一行，写入数据时在同一事务中递增，保证版本号单调且按提交顺序分配）
+CREATE TABLE IF NOT EXISTS sync_sequences (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    version BIGINT NOT NULL DEFAULT 0 -- 最后一次分配的同步版本号
+);
+
+-- 设备表（每个设备绑定一个登录会话，记录该设备已确认的同步版本号）
+CREATE TABLE IF NOT EXISTS devices (
+    id VARCHAR(36) PRIMARY KEY, -- 服务器生成的UUID，客户端重新登录时回传
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    platform VARCHAR(20) NOT NULL DEFAULT '', -- ios/watchos/macos/android/web
+    session_id VARCHAR(36) NOT NULL DEFAULT '', -- 当前绑定的登录会话
+    push_token VARCHAR(255) NOT NULL DEFAULT '', -- 推送令牌（APNs设备令牌），为空时不推送提醒
+    last_sync_version BIGINT NOT NULL DEFAULT 0, -- 已确认的同步版本号
+    last_synced_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP WITH TIME ZONE -- 撤销时间，撤销后绑定的会话立即失效
+);
+
+-- 幂等键表（批量同步中创建数据时客户端携带的UUID，重试时返回首次创建的数据而不会重复创建）
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    idempotency_key VARCHAR(36) NOT NULL, -- 客户端生成的UUID
+    resource_type VARCHAR(20) NOT NULL, -- todo/category/checklist_item
+    resource_id INTEGER NOT NULL, -- 首次请求创建的数据ID
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, idempotency_key)
 );
 
 -- 创建索引优化查询性能
@@ -81,6 +308,49 @@ CREATE INDEX IF NOT EXISTS idx_todos_category_id ON todos(category_id) WHERE cat
 CREATE INDEX IF NOT EXISTS idx_todos_sync_version ON todos(sync_version);
 CREATE INDEX IF NOT EXISTS idx_todos_tags ON todos USING GIN(tags); -- GIN索引用于JSONB查询
 CREATE INDEX IF NOT EXISTS idx_todos_reminder ON todos(reminder) WHERE reminder IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_todos_deleted_updated_at ON todos(updated_at) WHERE is_deleted = TRUE; -- 回收站清理按删除时间查找墓碑
+CREATE INDEX IF NOT EXISTS idx_categories_deleted_updated_at ON categories(updated_at) WHERE is_deleted = TRUE;
+CREATE INDEX IF NOT EXISTS idx_todos_search_vector ON todos USING GIN(search_vector); -- GIN索引用于全文搜索
+
+-- 检查项表索引
+CREATE INDEX IF NOT EXISTS idx_checklist_items_todo_id_position ON todo_checklist_items(todo_id, position);
+CREATE INDEX IF NOT EXISTS idx_checklist_items_user_id_sync_version ON todo_checklist_items(user_id, sync_version);
+
+-- 标签表索引
+CREATE INDEX IF NOT EXISTS idx_tags_user_id_sync_version ON tags(user_id, sync_version);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_user_id_name ON tags(user_id, name) WHERE is_deleted = FALSE; -- 已删除的墓碑不占用名称
+
+-- 智能列表表索引
+CREATE INDEX IF NOT EXISTS idx_smart_lists_user_id_sync_version ON smart_lists(user_id, sync_version);
+
+-- 修改历史表索引
+CREATE INDEX IF NOT EXISTS idx_todo_revisions_entity ON todo_revisions(user_id, entity_type, entity_id);
+CREATE INDEX IF NOT EXISTS idx_todo_revisions_user_created_at ON todo_revisions(user_id, created_at);
+
+-- 提醒投递记录表索引
+CREATE INDEX IF NOT EXISTS idx_reminder_deliveries_status_next_attempt ON reminder_deliveries(status, next_attempt_at);
+
+-- 每日摘要投递记录表索引
+CREATE INDEX IF NOT EXISTS idx_digest_deliveries_status_next_attempt ON digest_deliveries(status, next_attempt_at);
+
+-- Webhook表索引
+CREATE INDEX IF NOT EXISTS idx_webhook_endpoints_user_id ON webhook_endpoints(user_id);
+
+-- Webhook投递记录表索引
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status_next_attempt ON webhook_deliveries(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint_id ON webhook_deliveries(endpoint_id);
+
+-- 日历订阅表索引
+CREATE INDEX IF NOT EXISTS idx_calendar_feeds_user_id ON calendar_feeds(user_id);
+
+-- 应用专用密码表索引
+CREATE INDEX IF NOT EXISTS idx_app_passwords_user_id ON app_passwords(user_id);
+
+-- 刷新令牌表索引
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_session ON refresh_tokens(user_id, session_id);
+
+-- 设备表索引
+CREATE INDEX IF NOT EXISTS idx_devices_user_session ON devices(user_id, session_id);
 
 -- 用户设置表索引
 CREATE INDEX IF NOT EXISTS idx_user_settings_user_id ON user_settings(user_id);
@@ -108,34 +378,28 @@ CREATE TRIGGER update_user_settings_updated_at BEFORE UPDATE ON user_settings
 CREATE TRIGGER update_todos_updated_at BEFORE UPDATE ON todos
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
--- 创建同步版本更新触发器
-CREATE OR REPLACE FUNCTION update_sync_version()
-RETURNS TRIGGER AS $$
-BEGIN
-    NEW.sync_version = EXTRACT(EPOCH FROM CURRENT_TIMESTAMP) * 1000;
-    RETURN NEW;
-END;
-$$ language 'plpgsql';
-
-CREATE TRIGGER update_todos_sync_version BEFORE UPDATE ON todos
-    FOR EACH ROW EXECUTE FUNCTION update_sync_version();
+CREATE TRIGGER update_todo_checklist_items_updated_at BEFORE UPDATE ON todo_checklist_items
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
-CREATE TRIGGER update_categories_sync_version BEFORE UPDATE ON categories
-    FOR EACH ROW EXECUTE FUNCTION update_sync_version();
+CREATE TRIGGER update_tags_updated_at BEFORE UPDATE ON tags
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
-CREATE TRIGGER update_user_settings_sync_version BEFORE UPDATE ON user_settings
-    FOR EACH ROW EXECUTE FUNCTION update_sync_version();
+CREATE TRIGGER update_smart_lists_updated_at BEFORE UPDATE ON smart_lists
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
 -- 插入默认分类数据
-INSERT INTO categories (user_id, name, color, icon) VALUES 
-(1, '工作', '#FF5722', 'work'),
-(1, '个人', '#4CAF50', 'person'),
-(1, '学习', '#2196F3', 'school'),
-(1, '购物', '#FF9800', 'shopping_cart')
+INSERT INTO categories (user_id, name, color, icon, sync_version) VALUES 
+(1, '工作', '#FF5722', 'work', 1),
+(1, '个人', '#4CAF50', 'person', 2),
+(1, '学习', '#2196F3', 'school', 3),
+(1, '购物', '#FF9800', 'shopping_cart', 4)
 ON CONFLICT (user_id, name) DO NOTHING;
 
 -- 插入默认用户设置
-INSERT INTO user_settings (user_id) VALUES (1)
+INSERT INTO user_settings (user_id, sync_version) VALUES (1, 5)
+ON CONFLICT (user_id) DO NOTHING;
+
+INSERT INTO sync_sequences (user_id, version) VALUES (1, 5)
 ON CONFLICT (user_id) DO NOTHING;
 
 -- 创建视图：活跃任务（未删除且未完成）
@@ -167,7 +431,27 @@ COMMENT ON TABLE users IS '用户表';
 COMMENT ON TABLE categories IS '任务分类表';
 COMMENT ON TABLE user_settings IS '用户个性化设置表';
 COMMENT ON TABLE todos IS 'TODO任务表（扩展版）';
+COMMENT ON TABLE refresh_tokens IS '刷新令牌表';
+COMMENT ON TABLE devices IS '用户设备表';
+COMMENT ON TABLE sync_sequences IS '用户同步版本号计数表';
+COMMENT ON TABLE todo_snapshots IS 'TODO历史快照表（同步冲突合并基线）';
+COMMENT ON TABLE todo_checklist_items IS 'TODO检查项表（有序子任务）';
+COMMENT ON TABLE tags IS '标签元数据表（颜色和图标）';
+COMMENT ON TABLE smart_lists IS '智能列表表（保存的筛选和排序条件）';
+COMMENT ON TABLE todo_revisions IS '修改历史表（TODO和分类的字段级审计记录）';
+COMMENT ON TABLE reminder_deliveries IS '提醒投递记录表';
+COMMENT ON TABLE digest_deliveries IS '每日摘要投递记录表';
+COMMENT ON TABLE webhook_endpoints IS 'Webhook表';
+COMMENT ON TABLE webhook_events IS 'Webhook事件表';
+COMMENT ON TABLE webhook_deliveries IS 'Webhook投递记录表';
+COMMENT ON TABLE calendar_feeds IS '日历订阅表（iCalendar订阅地址）';
+COMMENT ON TABLE app_passwords IS '应用专用密码表（CalDAV客户端认证）';
+COMMENT ON TABLE idempotency_keys IS '批量同步幂等键表';
 
 COMMENT ON COLUMN todos.priority IS '优先级：0-低，1-中，2-高，3-紧急';
 COMMENT ON COLUMN todos.tags IS '任务标签，JSON数组格式';
-COMMENT ON COLUMN todos.sync_version IS '同步版本号，用于增量同步';
\ No newline at end of file
+COMMENT ON COLUMN todos.uuid IS '客户端生成的UUID，作为对外的主要标识，整数ID保留用于兼容';
+COMMENT ON COLUMN todos.recurrence IS '重复规则，iCalendar RRULE子集；完成后由下一次实例继承';
+COMMENT ON COLUMN categories.uuid IS '客户端生成的UUID，作为对外的主要标识，整数ID保留用于兼容';
+COMMENT ON COLUMN todos.search_vector IS '全文搜索向量：标题(A)、描述(B)、标签(C)，中文按二元组切分';
+COMMENT ON COLUMN todos.sync_version IS '同步版本号（用户级单调递增），用于增量同步';
\ No newline at end of file
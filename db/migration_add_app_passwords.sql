@@ -0,0 +1,19 @@
+-- 数据库迁移脚本：添加应用专用密码表
+-- 执行时间：2026-10-17
+-- CalDAV客户端不再使用账户密码，而是使用用户为每个客户端单独生成的应用专用密码；
+-- 密码只保存SHA-256哈希，可以单独删除，退出所有设备时全部删除。
+
+-- 应用专用密码表（CalDAV客户端使用，只保存密码哈希，退出所有设备时全部删除）
+CREATE TABLE IF NOT EXISTS app_passwords (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL DEFAULT '', -- 名称，用于区分使用该密码的客户端
+    password_hash VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 十六进制
+    last_used_at TIMESTAMP WITH TIME ZONE, -- 客户端最后一次使用该密码的时间
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 应用专用密码表索引
+CREATE INDEX IF NOT EXISTS idx_app_passwords_user_id ON app_passwords(user_id);
+
+COMMENT ON TABLE app_passwords IS '应用专用密码表（CalDAV客户端认证）';
@@ -0,0 +1,21 @@
+-- 数据库迁移脚本：添加日历订阅表
+-- 执行时间：2026-10-17
+-- 用户可以生成带密钥令牌的iCalendar订阅地址（/api/calendar/<令牌>.ics），在日历客户端中订阅设置了截止时间的TODO；
+-- 令牌只保存SHA-256哈希，重新生成或删除后旧地址立即失效。
+
+-- 日历订阅表（只保存订阅令牌哈希，可限定为一个分类，分类被彻底删除时一并删除）
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL DEFAULT '', -- 订阅名称，用作日历名称
+    category_id INTEGER REFERENCES categories(id) ON DELETE CASCADE, -- 限定的分类，为空表示全部TODO
+    token_hash VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 十六进制
+    last_accessed_at TIMESTAMP WITH TIME ZONE, -- 最近一次被日历客户端读取的时间
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 日历订阅表索引
+CREATE INDEX IF NOT EXISTS idx_calendar_feeds_user_id ON calendar_feeds(user_id);
+
+COMMENT ON TABLE calendar_feeds IS '日历订阅表（iCalendar订阅地址）';
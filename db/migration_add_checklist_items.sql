@@ -0,0 +1,25 @@
+-- 数据库迁移脚本：添加TODO检查项表
+-- 执行时间：2026-10-16
+-- 检查项是TODO下按 position 排序的子任务，读取TODO时统计未删除检查项的总数和已完成数。
+-- 检查项与TODO、分类共用用户级同步版本号序列，随增量同步和批量同步一起传输。
+
+-- TODO检查项表（TODO下的有序子任务，与TODO共用同步版本号序列）
+CREATE TABLE IF NOT EXISTS todo_checklist_items (
+    id SERIAL PRIMARY KEY,
+    uuid VARCHAR(36) NOT NULL DEFAULT uuid_generate_v4()::text, -- 客户端生成的公开标识，离线创建时即可被引用
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title VARCHAR(200) NOT NULL,
+    completed BOOLEAN DEFAULT FALSE,
+    position INTEGER NOT NULL DEFAULT 0, -- 同一TODO内的排序位置，从1开始
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    is_deleted BOOLEAN DEFAULT FALSE,
+    sync_version BIGINT NOT NULL DEFAULT 0, -- 用户级同步版本号，由 sync_sequences 分配
+    UNIQUE(user_id, uuid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_checklist_items_todo_id_position ON todo_checklist_items(todo_id, position);
+CREATE INDEX IF NOT EXISTS idx_checklist_items_user_id_sync_version ON todo_checklist_items(user_id, sync_version);
+
+COMMENT ON TABLE todo_checklist_items IS 'TODO检查项表（有序子任务）';
@@ -0,0 +1,33 @@
+-- 数据库迁移脚本：添加每日摘要开关和每日摘要投递记录表
+-- 执行时间：2026-10-16
+-- 后台调度任务在每个用户设置的通知时间（按用户时区）汇总逾期、当天到期、紧急和前一天完成的TODO，
+-- 通过各通知渠道发送每日摘要。(user_id, digest_date, channel) 唯一，同一天在每个渠道只投递一次。
+
+-- 每日摘要开关，默认开启
+ALTER TABLE user_settings ADD COLUMN IF NOT EXISTS daily_digest BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- 每日摘要投递记录表（每个用户在通知时间按用户时区生成当天的摘要，同一天在每个渠道只投递一次）
+CREATE TABLE IF NOT EXISTS digest_deliveries (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    digest_date VARCHAR(10) NOT NULL, -- 摘要日期（用户时区），YYYY-MM-DD
+    channel VARCHAR(20) NOT NULL, -- webhook/email/push
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending/sending/sent/failed/skipped/cancelled
+    attempts INTEGER NOT NULL DEFAULT 0, -- 已尝试发送的次数
+    last_error TEXT NOT NULL DEFAULT '', -- 最近一次失败或取消的原因
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL, -- 下次尝试发送的时间
+    claimed_by VARCHAR(64) NOT NULL DEFAULT '', -- 认领该记录的服务实例
+    claimed_until TIMESTAMP WITH TIME ZONE, -- 认领租约到期时间
+    sent_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, digest_date, channel)
+);
+
+-- 每日摘要投递记录表索引
+CREATE INDEX IF NOT EXISTS idx_digest_deliveries_status_next_attempt ON digest_deliveries(status, next_attempt_at);
+
+-- 按时间查找前一天完成的TODO
+CREATE INDEX IF NOT EXISTS idx_todo_revisions_user_created_at ON todo_revisions(user_id, created_at);
+
+COMMENT ON TABLE digest_deliveries IS '每日摘要投递记录表';
@@ -0,0 +1,19 @@
+-- 数据库迁移脚本：添加设备表
+-- 执行时间：2026-10-16
+
+CREATE TABLE IF NOT EXISTS devices (
+    id VARCHAR(36) PRIMARY KEY, -- 服务器生成的UUID，客户端重新登录时回传
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    platform VARCHAR(20) NOT NULL DEFAULT '', -- ios/watchos/macos/android/web
+    session_id VARCHAR(36) NOT NULL DEFAULT '', -- 当前绑定的登录会话
+    last_sync_version BIGINT NOT NULL DEFAULT 0, -- 已确认的同步版本号
+    last_synced_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP WITH TIME ZONE -- 撤销时间，撤销后绑定的会话立即失效
+);
+
+CREATE INDEX IF NOT EXISTS idx_devices_user_session ON devices(user_id, session_id);
+
+COMMENT ON TABLE devices IS '用户设备表';
@@ -0,0 +1,15 @@
+-- 数据库迁移脚本：添加批量同步幂等键表
+-- 执行时间：2026-10-16
+-- 批量同步中创建的TODO和分类可携带客户端生成的UUID作为幂等键。客户端超时重试时，
+-- 服务器根据幂等键返回首次请求创建的数据，不再重复创建。
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    idempotency_key VARCHAR(36) NOT NULL, -- 客户端生成的UUID
+    resource_type VARCHAR(20) NOT NULL, -- todo/category
+    resource_id INTEGER NOT NULL, -- 首次请求创建的数据ID
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, idempotency_key)
+);
+
+COMMENT ON TABLE idempotency_keys IS '批量同步幂等键表';
@@ -0,0 +1,8 @@
+-- 数据库迁移脚本：为TODO添加重复规则
+-- 执行时间：2026-10-16
+-- recurrence 保存 iCalendar RRULE 子集（DAILY/WEEKLY/MONTHLY/YEARLY、COUNT/UNTIL）。
+-- 重复TODO被标记为完成时，服务器按用户时区生成下一次实例，重复规则随之转移到新实例。
+
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS recurrence VARCHAR(255);
+
+COMMENT ON COLUMN todos.recurrence IS '重复规则，iCalendar RRULE子集；完成后由下一次实例继承';
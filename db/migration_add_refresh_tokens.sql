@@ -0,0 +1,19 @@
+-- 数据库迁移脚本：添加刷新令牌表
+-- 执行时间：2026-10-16
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_id VARCHAR(36) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 十六进制
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    used_at TIMESTAMP WITH TIME ZONE, -- 轮换时间，非空表示已换取新令牌
+    revoked_at TIMESTAMP WITH TIME ZONE -- 撤销时间（退出登录/退出所有设备/检测到重复使用）
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_session ON refresh_tokens(user_id, session_id);
+
+COMMENT ON TABLE refresh_tokens IS '刷新令牌表';
+
+-- 注意：升级后旧的访问令牌（不含会话ID）将失效，客户端需要重新登录
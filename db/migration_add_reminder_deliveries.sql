@@ -0,0 +1,31 @@
+-- 数据库迁移脚本：添加提醒投递记录表和设备推送令牌
+-- 执行时间：2026-10-16
+-- 后台调度任务查找到期的TODO提醒，为每个通知渠道生成一条投递记录，(todo_id, reminder_at, channel) 唯一，
+-- 同一提醒在每个渠道只投递一次。多个服务实例通过带租约的条件更新认领投递记录，失败时按退避时间重试。
+
+-- 设备推送令牌（APNs设备令牌），为空时不向该设备推送提醒
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS push_token VARCHAR(255) NOT NULL DEFAULT '';
+
+-- 提醒投递记录表
+CREATE TABLE IF NOT EXISTS reminder_deliveries (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    reminder_at TIMESTAMP WITH TIME ZONE NOT NULL, -- 投递的提醒时间，TODO修改提醒时间后按新时间重新投递
+    channel VARCHAR(20) NOT NULL, -- webhook/email/push
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending/sending/sent/failed/skipped/cancelled
+    attempts INTEGER NOT NULL DEFAULT 0, -- 已尝试发送的次数
+    last_error TEXT NOT NULL DEFAULT '', -- 最近一次失败或取消的原因
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL, -- 下次尝试发送的时间
+    claimed_by VARCHAR(64) NOT NULL DEFAULT '', -- 认领该记录的服务实例
+    claimed_until TIMESTAMP WITH TIME ZONE, -- 认领租约到期时间，实例中途退出时到期后由其他实例重新认领
+    sent_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(todo_id, reminder_at, channel)
+);
+
+-- 提醒投递记录表索引
+CREATE INDEX IF NOT EXISTS idx_reminder_deliveries_status_next_attempt ON reminder_deliveries(status, next_attempt_at);
+
+COMMENT ON TABLE reminder_deliveries IS '提醒投递记录表';
@@ -0,0 +1,11 @@
+-- 数据库迁移脚本：添加TODO全文搜索索引
+-- 执行时间：2026-10-16
+-- 分词由应用完成：拉丁字母/数字按单词切分并转小写，中日韩文字按相邻二元组切分，
+-- 因此使用 'simple' 配置写入，不依赖数据库的中文分词扩展。
+-- 已有数据的 search_vector 为空，服务启动时会自动回填。
+
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS search_vector TSVECTOR;
+
+CREATE INDEX IF NOT EXISTS idx_todos_search_vector ON todos USING GIN(search_vector);
+
+COMMENT ON COLUMN todos.search_vector IS '全文搜索向量：标题(A)、描述(B)、标签(C)，中文按二元组切分';
@@ -0,0 +1,27 @@
+-- 数据库迁移脚本：添加智能列表表
+-- 执行时间：2026-10-16
+-- 智能列表保存一组TODO筛选和排序条件（definition，JSON格式），执行时按用户时区计算相对日期。
+-- 智能列表与TODO、分类共用用户级同步版本号序列，删除时保留为同步墓碑。
+
+-- 智能列表表（保存的筛选和排序条件，与TODO共用同步版本号序列）
+CREATE TABLE IF NOT EXISTS smart_lists (
+    id SERIAL PRIMARY KEY,
+    uuid VARCHAR(36) NOT NULL DEFAULT uuid_generate_v4()::text, -- 客户端生成的公开标识，离线创建时即可被引用
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    icon VARCHAR(50) DEFAULT 'list',
+    color VARCHAR(7) DEFAULT '#2196F3',
+    definition JSONB NOT NULL DEFAULT '{}', -- 筛选和排序条件，分类以UUID引用
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    is_deleted BOOLEAN DEFAULT FALSE,
+    sync_version BIGINT NOT NULL DEFAULT 0, -- 用户级同步版本号，由 sync_sequences 分配
+    UNIQUE(user_id, uuid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_smart_lists_user_id_sync_version ON smart_lists(user_id, sync_version);
+
+CREATE TRIGGER update_smart_lists_updated_at BEFORE UPDATE ON smart_lists
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE smart_lists IS '智能列表表（保存的筛选和排序条件）';
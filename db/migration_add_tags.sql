@@ -0,0 +1,27 @@
+-- 数据库迁移脚本：添加标签表
+-- 执行时间：2026-10-16
+-- 标签表只保存标签的颜色和图标等元数据，TODO仍在 todos.tags 中以名称保存标签，已有数据无需迁移。
+-- 标签与TODO、分类共用用户级同步版本号序列，删除时保留为同步墓碑；名称唯一性只约束未删除的标签。
+
+-- 标签表（标签元数据，TODO中仍以名称保存标签，与TODO共用同步版本号序列）
+CREATE TABLE IF NOT EXISTS tags (
+    id SERIAL PRIMARY KEY,
+    uuid VARCHAR(36) NOT NULL DEFAULT uuid_generate_v4()::text, -- 客户端生成的公开标识，离线创建时即可被引用
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL, -- 与 todos.tags 中的名称对应，未删除的标签名称在用户内唯一
+    color VARCHAR(7) DEFAULT '#9E9E9E',
+    icon VARCHAR(50) DEFAULT 'label',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    is_deleted BOOLEAN DEFAULT FALSE,
+    sync_version BIGINT NOT NULL DEFAULT 0, -- 用户级同步版本号，由 sync_sequences 分配
+    UNIQUE(user_id, uuid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tags_user_id_sync_version ON tags(user_id, sync_version);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_user_id_name ON tags(user_id, name) WHERE is_deleted = FALSE; -- 已删除的墓碑不占用名称
+
+CREATE TRIGGER update_tags_updated_at BEFORE UPDATE ON tags
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE tags IS '标签元数据表（颜色和图标）';
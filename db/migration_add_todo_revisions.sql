@@ -0,0 +1,23 @@
+-- 数据库迁移脚本：添加修改历史表
+-- 执行时间：2026-10-16
+-- TODO和分类的每次创建、修改和删除都在同一事务中记录发生变化的字段、发起修改的设备和同步版本号。
+-- 修改历史不引用 todos，TODO被物理删除后历史仍然保留；回滚TODO时作为一次新的修改写入。
+
+-- 修改历史表（TODO和分类的字段级修改记录，不引用 todos，物理删除后历史仍然保留）
+CREATE TABLE IF NOT EXISTS todo_revisions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    entity_type VARCHAR(20) NOT NULL, -- todo 或 category
+    entity_id INTEGER NOT NULL,
+    entity_uuid VARCHAR(36) NOT NULL,
+    action VARCHAR(20) NOT NULL, -- create、update、delete 或 restore
+    changes JSONB NOT NULL DEFAULT '{}', -- 发生变化的字段：{"字段": {"old": 旧值, "new": 新值}}
+    device_id VARCHAR(36) NOT NULL DEFAULT '', -- 发起修改的设备，非设备会话为空
+    sync_version BIGINT NOT NULL DEFAULT 0, -- 修改产生的同步版本号，物理删除为 0
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 修改历史表索引
+CREATE INDEX IF NOT EXISTS idx_todo_revisions_entity ON todo_revisions(user_id, entity_type, entity_id);
+
+COMMENT ON TABLE todo_revisions IS '修改历史表（TODO和分类的字段级审计记录）';
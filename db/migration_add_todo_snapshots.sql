@@ -0,0 +1,16 @@
+-- 数据库迁移脚本：添加TODO快照表
+-- 执行时间：2026-10-16
+-- 客户端提交修改时携带编辑时的 base_version，服务器用该版本的快照与当前数据做字段级三方合并。
+-- 迁移前的数据没有快照，这些TODO首次发生冲突时按两方对比处理。
+
+-- TODO快照表（保存每个TODO最近若干版本的完整数据，用于同步冲突的字段级三方合并）
+CREATE TABLE IF NOT EXISTS todo_snapshots (
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    sync_version BIGINT NOT NULL, -- 快照对应的同步版本号
+    data JSONB NOT NULL, -- 该版本的TODO完整数据
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (todo_id, sync_version)
+);
+
+COMMENT ON TABLE todo_snapshots IS 'TODO历史快照表（同步冲突合并基线）';
@@ -0,0 +1,6 @@
+-- 数据库迁移脚本：添加回收站清理索引
+-- 执行时间：2026-10-16
+-- 后台任务按删除时间（updated_at）查找超过保留期的墓碑，确认用户全部设备都已同步过删除后物理删除。
+
+CREATE INDEX IF NOT EXISTS idx_todos_deleted_updated_at ON todos(updated_at) WHERE is_deleted = TRUE; -- 回收站清理按删除时间查找墓碑
+CREATE INDEX IF NOT EXISTS idx_categories_deleted_updated_at ON categories(updated_at) WHERE is_deleted = TRUE;
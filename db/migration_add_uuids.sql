@@ -0,0 +1,22 @@
+-- 数据库迁移脚本：为TODO和分类添加客户端UUID
+-- 执行时间：2026-10-16
+-- 客户端离线创建数据时自行生成UUID，同一批次中的TODO可以通过 category_uuid 引用同样离线创建的分类，
+-- 无需等待服务器分配整数ID后再改写本地引用。整数ID保留用于兼容旧客户端。
+
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS uuid VARCHAR(36);
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS uuid VARCHAR(36);
+
+-- 为现有数据生成UUID
+UPDATE todos SET uuid = uuid_generate_v4()::text WHERE uuid IS NULL;
+UPDATE categories SET uuid = uuid_generate_v4()::text WHERE uuid IS NULL;
+
+ALTER TABLE todos ALTER COLUMN uuid SET DEFAULT uuid_generate_v4()::text, ALTER COLUMN uuid SET NOT NULL;
+ALTER TABLE categories ALTER COLUMN uuid SET DEFAULT uuid_generate_v4()::text, ALTER COLUMN uuid SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_todos_user_id_uuid ON todos(user_id, uuid);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_user_id_uuid ON categories(user_id, uuid);
+
+COMMENT ON COLUMN todos.uuid IS '客户端生成的UUID，作为对外的主要标识，整数ID保留用于兼容';
+COMMENT ON COLUMN categories.uuid IS '客户端生成的UUID，作为对外的主要标识，整数ID保留用于兼容';
@@ -0,0 +1,62 @@
+-- 数据库迁移脚本：添加Webhook、Webhook事件和Webhook投递记录表
+-- 执行时间：2026-10-17
+-- TODO、分类和用户设置的写入在同一事务中为订阅了对应事件的Webhook生成事件和投递记录，
+-- 后台任务以HMAC-SHA256签名的JSON POST发送，失败时按指数退避重试；Webhook连续失败达到上限后自动停用。
+
+-- Webhook表（用户登记的事件接收地址，连续失败达到上限后自动停用）
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(100) NOT NULL, -- HMAC-SHA256签名密钥
+    events JSONB NOT NULL DEFAULT '[]'::jsonb, -- 订阅的事件类型，支持 todo.* 形式的通配，空数组表示全部事件
+    all_users BOOLEAN NOT NULL DEFAULT FALSE, -- 是否接收全部用户的事件（仅管理员）
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    consecutive_failures INTEGER NOT NULL DEFAULT 0, -- 连续发送失败的次数，发送成功后清零
+    disabled_at TIMESTAMP WITH TIME ZONE, -- 自动停用的时间
+    disabled_reason TEXT NOT NULL DEFAULT '', -- 自动停用前最后一次失败的原因
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Webhook事件表（与数据写入在同一事务中生成，只保存有Webhook订阅的事件）
+CREATE TABLE IF NOT EXISTS webhook_events (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_type VARCHAR(30) NOT NULL, -- todo.created/todo.updated/todo.completed/todo.deleted/category.*/settings.updated
+    entity_type VARCHAR(20) NOT NULL, -- todo/category/settings
+    entity_id INTEGER NOT NULL DEFAULT 0,
+    entity_uuid VARCHAR(36) NOT NULL DEFAULT '',
+    sync_version BIGINT NOT NULL DEFAULT 0, -- 写入产生的同步版本号
+    data JSONB NOT NULL, -- 写入后的数据，物理删除时为删除前的数据
+    changes JSONB NOT NULL DEFAULT '{}', -- 字段级变化 {"字段": {"old": 旧值, "new": 新值}}
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Webhook投递记录表（每个事件向每个订阅的Webhook投递一次，重放时生成新的记录）
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id SERIAL PRIMARY KEY,
+    endpoint_id INTEGER NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event_id INTEGER NOT NULL REFERENCES webhook_events(id) ON DELETE CASCADE,
+    event_type VARCHAR(30) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending/sending/sent/failed/cancelled
+    attempts INTEGER NOT NULL DEFAULT 0, -- 已尝试发送的次数
+    last_error TEXT NOT NULL DEFAULT '', -- 最近一次失败或取消的原因
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL, -- 下次尝试发送的时间
+    claimed_by VARCHAR(64) NOT NULL DEFAULT '', -- 认领该记录的服务实例
+    claimed_until TIMESTAMP WITH TIME ZONE, -- 认领租约到期时间
+    sent_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Webhook表索引
+CREATE INDEX IF NOT EXISTS idx_webhook_endpoints_user_id ON webhook_endpoints(user_id);
+
+-- Webhook投递记录表索引
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status_next_attempt ON webhook_deliveries(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint_id ON webhook_deliveries(endpoint_id);
+
+COMMENT ON TABLE webhook_endpoints IS 'Webhook表';
+COMMENT ON TABLE webhook_events IS 'Webhook事件表';
+COMMENT ON TABLE webhook_deliveries IS 'Webhook投递记录表';
@@ -0,0 +1,37 @@
+-- 数据库迁移脚本：同步版本号改为用户级单调递增序列
+-- 执行时间：2026-10-16
+-- 原先的 sync_version 取自毫秒时间戳，同一毫秒内的两次写入或多台应用服务器的时钟偏差
+-- 都可能导致增量同步永久漏掉数据。改为每个用户一行计数器，写入时在同一事务中递增。
+
+CREATE TABLE IF NOT EXISTS sync_sequences (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    version BIGINT NOT NULL DEFAULT 0 -- 最后一次分配的同步版本号
+);
+
+COMMENT ON TABLE sync_sequences IS '用户同步版本号计数表';
+
+-- 以现有数据的最大版本号为起点，客户端持有的毫秒时间戳游标仍然有效
+INSERT INTO sync_sequences (user_id, version)
+SELECT u.id, GREATEST(
+    COALESCE((SELECT MAX(sync_version) FROM todos WHERE user_id = u.id), 0),
+    COALESCE((SELECT MAX(sync_version) FROM categories WHERE user_id = u.id), 0),
+    COALESCE((SELECT sync_version FROM user_settings WHERE user_id = u.id), 0)
+)
+FROM users u
+ON CONFLICT (user_id) DO NOTHING;
+
+-- 版本号由应用分配，移除基于时间戳的触发器和默认值
+DROP TRIGGER IF EXISTS update_todos_sync_version ON todos;
+DROP TRIGGER IF EXISTS update_categories_sync_version ON categories;
+DROP TRIGGER IF EXISTS update_user_settings_sync_version ON user_settings;
+DROP FUNCTION IF EXISTS update_sync_version();
+
+UPDATE todos SET sync_version = 0 WHERE sync_version IS NULL;
+UPDATE categories SET sync_version = 0 WHERE sync_version IS NULL;
+UPDATE user_settings SET sync_version = 0 WHERE sync_version IS NULL;
+
+ALTER TABLE todos ALTER COLUMN sync_version SET DEFAULT 0, ALTER COLUMN sync_version SET NOT NULL;
+ALTER TABLE categories ALTER COLUMN sync_version SET DEFAULT 0, ALTER COLUMN sync_version SET NOT NULL;
+ALTER TABLE user_settings ALTER COLUMN sync_version SET DEFAULT 0, ALTER COLUMN sync_version SET NOT NULL;
+
+COMMENT ON COLUMN todos.sync_version IS '同步版本号（用户级单调递增），用于增量同步';
@@ -1,11 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
-	"net/http"
+	"os"
 	"todo-service/docs"
-	"todo-service/global"
 	"todo-service/src/api"
+	"todo-service/src/notify"
 	"todo-service/src/repository"
 
 	"github.com/gin-gonic/gin"
@@ -14,64 +15,11 @@ import (
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
-func initRouter(r *gin.Engine) {
-	// CORS中间件
-	r.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-
-		c.Next()
-	})
-
-	// 添加日志中间件
-	r.Use(api.LoggerMiddleware())
+func initRouter(r *gin.Engine, server *api.Server) {
+	server.RegisterRoutes(r)
 
 	// Swagger文档路由
 	r.GET("/zane/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-
-	// 公开路由
-	r.POST("/api/test", func(c *gin.Context) {
-		c.JSON(http.StatusOK, api.SuccessResponse(gin.H{"message": "Test POST endpoint"}))
-	})
-	r.POST("/api/auth/register", api.Register)
-	r.POST("/api/auth/login", api.Login)
-
-	// v1 API - 扩展功能
-	v1 := r.Group("/api/v1")
-	v1.Use(api.AuthMiddleware())
-	{
-		// v1.POST("/todos/list", api.GetTodos)
-		// v1.POST("/todos/create", api.CreateTodo)
-		// v1.POST("/todos/update", api.UpdateTodo)
-		// v1.POST("/todos/delete", api.DeleteTodo)
-		v1.POST("/profile", api.GetProfile)
-		// 扩展TODO管理
-		v1.POST("/todos/list", api.GetTodosExtended)
-		v1.POST("/todos/create", api.CreateTodoExtended)
-		v1.POST("/todos/update", api.UpdateTodoExtended)
-		v1.POST("/todos/search", api.SearchTodos)
-
-		// 分类管理
-		v1.POST("/categories", api.GetCategories)
-		v1.POST("/categories/create", api.CreateCategory)
-		v1.POST("/categories/update", api.UpdateCategory)
-		v1.POST("/categories/delete", api.DeleteCategory)
-
-		// 用户设置
-		v1.POST("/settings", api.GetUserSettings)
-		v1.POST("/settings/update", api.UpdateUserSettings)
-
-		// 数据同步
-		v1.POST("/sync/version", api.GetSyncVersion)
-		v1.POST("/sync/todos", api.IncrementalSync)
-		v1.POST("/sync/batch", api.BatchSync)
-	}
 }
 
 // @title TODO API
@@ -96,23 +44,49 @@ func main() {
 	docs.SwaggerInfo.BasePath = ""
 	docs.SwaggerInfo.Schemes = []string{"http"}
 
-	// 初始化数据库
+	// 初始化数据存储（由 DB_DRIVER 选择 postgres/sqlite/memory）
 	config := repository.GetDatabaseConfig()
-	var err error
-
-	global.Db, err = repository.ConnectDatabase(config)
+	store, err := repository.OpenStore(config)
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		log.Fatal("Failed to open store:", err)
+	}
+	defer store.Close()
+
+	// 后台清理回收站中超过保留期、且全部设备都已同步过的墓碑
+	trashConfig := repository.GetTrashConfig()
+	if trashConfig.Retention > 0 {
+		go repository.NewTrashPurger(store, trashConfig).Run(context.Background())
+	}
+
+	// 后台发送到期的TODO提醒和每日摘要，未配置任何通知渠道时不启动
+	reminderConfig := notify.GetConfig()
+	if notifiers := reminderConfig.Notifiers(); len(notifiers) > 0 {
+		go notify.NewScheduler(store, notifiers, reminderConfig).Run(context.Background())
+		if reminderConfig.DailyDigest {
+			go notify.NewDigestScheduler(store, notifiers, reminderConfig).Run(context.Background())
+		}
+	}
+	// 后台把变更事件发送到用户登记的Webhook
+	go notify.NewEventDispatcher(store, reminderConfig).Run(context.Background())
+
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		jwtSecret = "your-secret-key-here" // 在生产环境中应该使用环境变量
+		log.Printf("Warning: JWT_SECRET is not set, using the built-in development secret")
 	}
-	defer global.Db.Close()
+	// 管理员（ADMIN_USERNAMES，多个用户名以逗号分隔）可以登记接收全部用户事件的Webhook
+	server := api.NewServer(store, []byte(jwtSecret),
+		api.WithAdmins(reminderConfig.Admins...), api.WithPrivateWebhooks(reminderConfig.WebhookAllowPrivate))
 
 	// // 创建表
-	// repository.CreateTables()
+	// repository.CreateTables(store.(*repository.SQLStore).DB())
 
 	// 设置路由
-	r := gin.Default()
-	initRouter(r)
+	// 不使用gin默认的Logger：它会记录未隐藏令牌的日历订阅地址，请求日志由 LoggerMiddleware 记录
+	r := gin.New()
+	r.Use(gin.Recovery())
+	initRouter(r, server)
 
-	log.Printf("Server starting on port 8080 with PostgreSQL database")
+	log.Printf("Server starting on port 8080 with %s store", config.Driver)
 	r.Run(":8080")
 }
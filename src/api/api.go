@@ -19,18 +19,26 @@ package api
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
-	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
-	"todo-service/global"
+	"todo-service/src/ical"
+	"todo-service/src/notify"
 	"todo-service/src/repository"
 
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -44,7 +52,7 @@ import (
 // @Success 200 {object} Response{data=map[string]string} "注册成功"
 // @Failure 200 {object} Response "注册失败"
 // @Router /api/auth/register [post]
-func Register(c *gin.Context) {
+func (s *Server) Register(c *gin.Context) {
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
@@ -59,10 +67,13 @@ func Register(c *gin.Context) {
 	}
 
 	// 插入用户
-	_, err = global.Db.Exec("INSERT INTO users (username, email, password) VALUES (?, ?, ?)",
-		req.Username, req.Email, string(hashedPassword))
+	err = s.store.CreateUser(&repository.User{
+		Username: req.Username,
+		Email:    req.Email,
+		Password: string(hashedPassword),
+	})
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		if errors.Is(err, repository.ErrDuplicate) {
 			c.JSON(http.StatusOK, ErrorResponse(CodeUserExists, "用户名或邮箱已存在"))
 		} else {
 			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "创建用户失败"))
@@ -80,10 +91,10 @@ func Register(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param credentials body LoginRequest true "登录凭据"
-// @Success 200 {object} Response{data=map[string]interface{}} "登录成功，返回token和用户信息"
+// @Success 200 {object} Response{data=TokenResponse} "登录成功，返回token、刷新令牌和用户信息"
 // @Failure 200 {object} Response "登录失败"
 // @Router /api/auth/login [post]
-func Login(c *gin.Context) {
+func (s *Server) Login(c *gin.Context) {
 	var req LoginRequest
 	defer func() {
 		if r := recover(); r != nil {
@@ -97,45 +108,179 @@ func Login(c *gin.Context) {
 	}
 
 	// 查找用户
-	var user repository.User
-	var hashedPassword string
-	err := global.Db.QueryRow("SELECT id, username, email, password FROM users WHERE username = ?", req.Username).
-		Scan(&user.ID, &user.Username, &user.Email, &hashedPassword)
+	user, err := s.store.GetUserByUsername(req.Username)
 	if err != nil {
 		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidCredentials, "账号密码错误"))
 		return
 	}
 
 	// 验证密码
-	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)); err != nil {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
 		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidCredentials, "账号密码错误"))
 		return
 	}
 
-	// 生成JWT token
-	claims := Claims{
-		UserID:   user.ID,
-		Username: user.Username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+	// 每次登录创建一个新的会话，提供设备信息时将会话注册为该设备
+	sessionID := uuid.NewString()
+	var device *repository.Device
+	if req.Device != nil {
+		device, err = s.registerDevice(user.ID, sessionID, req.Device)
+		if err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "注册设备失败"))
+			return
+		}
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(global.JwtSecret)
+	tokens, err := s.issueTokens(s.store, user, sessionID, device)
 	if err != nil {
 		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "生成token失败"))
 		return
 	}
+	tokens.User = user
 
-	c.JSON(http.StatusOK, SuccessResponse(gin.H{
-		"token": tokenString,
-		"user":  user,
-	}))
+	c.JSON(http.StatusOK, SuccessResponse(tokens))
+}
+
+// RefreshToken 刷新令牌
+// @Summary 刷新访问令牌
+// @Description 使用刷新令牌换取新的访问令牌和刷新令牌，旧的刷新令牌随即失效；重复使用已轮换的刷新令牌会撤销整个会话
+// @Tags 用户认证
+// @Accept json
+// @Produce json
+// @Param request body RefreshTokenRequest true "刷新令牌"
+// @Success 200 {object} Response{data=TokenResponse} "刷新成功"
+// @Failure 200 {object} Response "刷新失败"
+// @Router /api/auth/refresh [post]
+func (s *Server) RefreshToken(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	token, err := s.store.GetRefreshTokenByHash(hashRefreshToken(req.RefreshToken))
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeTokenError, "无效的刷新令牌"))
+		return
+	}
+
+	now := s.now()
+	if token.RevokedAt != nil || !token.ExpiresAt.After(now) {
+		c.JSON(http.StatusOK, ErrorResponse(CodeTokenRevoked, "刷新令牌已失效，请重新登录"))
+		return
+	}
+
+	user, err := s.store.GetUserByID(token.UserID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeTokenRevoked, "用户不存在"))
+		return
+	}
+
+	device, err := s.sessionDevice(user.ID, token.SessionID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取设备信息失败"))
+		return
+	}
+
+	// 标记旧令牌已使用和保存新令牌在同一事务中完成：保存失败时旧令牌仍然有效，
+	// 并发请求也不会看到会话暂时没有可用的刷新令牌
+	var tokens *TokenResponse
+	claimed := false
+	err = s.store.WithTx(func(tx repository.Store) error {
+		var err error
+		if claimed, err = tx.MarkRefreshTokenUsed(token.ID, now); err != nil || !claimed {
+			return err
+		}
+		tokens, err = s.issueTokens(tx, user, token.SessionID, device)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "刷新令牌失败"))
+		return
+	}
+	// 已轮换的令牌被再次使用，说明令牌可能被盗用，撤销整个会话
+	if !claimed {
+		if err := s.store.RevokeSession(token.UserID, token.SessionID, now); err != nil {
+			s.logger.Printf("Failed to revoke session %s: %v", token.SessionID, err)
+		}
+		c.JSON(http.StatusOK, ErrorResponse(CodeTokenRevoked, "刷新令牌已失效，请重新登录"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(tokens))
+}
+
+// Logout 退出登录
+// @Summary 退出当前设备
+// @Description 撤销当前登录会话，当前访问令牌和刷新令牌立即失效；会话绑定的设备一并撤销
+// @Tags 用户认证
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} Response{data=map[string]string} "退出成功"
+// @Failure 200 {object} Response "退出失败"
+// @Router /api/auth/logout [post]
+func (s *Server) Logout(c *gin.Context) {
+	userID := c.GetInt("userID")
+	sessionID := c.GetString("sessionID")
+
+	device, err := s.sessionDevice(userID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "退出登录失败"))
+		return
+	}
+	if device != nil {
+		err = s.revokeDevice(device)
+	} else {
+		err = s.store.RevokeSession(userID, sessionID, s.now())
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "退出登录失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "退出登录成功"}))
+}
+
+// LogoutAll 退出所有设备
+// @Summary 退出所有设备
+// @Description 撤销当前用户的全部登录会话和设备，并删除全部CalDAV应用专用密码，所有设备需要重新登录
+// @Tags 用户认证
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} Response{data=map[string]string} "退出成功"
+// @Failure 200 {object} Response "退出失败"
+// @Router /api/auth/logout-all [post]
+func (s *Server) LogoutAll(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	if err := s.store.RevokeAllSessions(userID, s.now()); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "退出登录失败"))
+		return
+	}
+	if err := s.store.DeleteAppPasswords(userID); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "退出登录失败"))
+		return
+	}
+
+	devices, err := s.store.GetDevicesByUserID(userID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "退出登录失败"))
+		return
+	}
+	for i := range devices {
+		if err := s.revokeDevice(&devices[i]); err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "退出登录失败"))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "已退出所有设备"}))
 }
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware JWT认证中间件
+func (s *Server) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -151,31 +296,74 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
-			return global.JwtSecret, nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := s.jwt.Parse(tokenString)
+		if err != nil || claims.SessionID == "" {
 			c.JSON(http.StatusOK, ErrorResponse(CodeTokenError, "无效的token"))
 			c.Abort()
 			return
 		}
 
+		// 检查会话是否已被撤销（退出登录/退出所有设备/刷新令牌被盗用）
+		active, err := s.store.IsSessionActive(claims.UserID, claims.SessionID, s.now())
+		if err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "校验token失败"))
+			c.Abort()
+			return
+		}
+		if !active {
+			c.JSON(http.StatusOK, ErrorResponse(CodeTokenRevoked, "token已失效，请重新登录"))
+			c.Abort()
+			return
+		}
+
 		c.Set("userID", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("sessionID", claims.SessionID)
+		c.Set("deviceID", claims.DeviceID)
 		c.Next()
 	}
 }
 
+// redactPath 隐藏日历订阅地址中的令牌，避免写入日志
+func redactPath(path string) string {
+	if strings.HasPrefix(path, calendarFeedPath) {
+		return calendarFeedPath + "***"
+	}
+	return path
+}
+
+// sensitiveFields 请求体中不写入日志的字段
+var sensitiveFields = map[string]bool{"password": true, "refresh_token": true, "push_token": true}
+
+// redactBody 把JSON请求体中的密码、令牌等字段替换为***，避免写入日志
+func redactBody(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if sensitiveFields[key] {
+				v[key] = "***"
+			} else {
+				v[key] = redactBody(value)
+			}
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactBody(value)
+		}
+	}
+	return v
+}
+
 // LoggerMiddleware 统一日志中间件
-func LoggerMiddleware() gin.HandlerFunc {
+func (s *Server) LoggerMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		start := time.Now()
+		start := s.now()
+		path := redactPath(c.Request.URL.Path)
 
-		// 读取请求体
+		// 读取请求体。CalDAV请求体由处理函数限制大小后读取，且包含TODO全文，不在此读取和记录
 		var requestBody []byte
-		if c.Request.Body != nil {
+		caldav := strings.HasPrefix(c.Request.URL.Path, caldavPath)
+		if c.Request.Body != nil && !caldav {
 			bodyBytes, err := io.ReadAll(c.Request.Body)
 			if err == nil {
 				requestBody = bodyBytes
@@ -186,23 +374,26 @@ func LoggerMiddleware() gin.HandlerFunc {
 
 		// 记录请求信息
 		var requestBodyStr string
-		if len(requestBody) > 0 && json.Valid(requestBody) {
+		if caldav {
+			requestBodyStr = "<CalDAV, not logged>"
+		} else if len(requestBody) > 0 && json.Valid(requestBody) {
 			// 如果是有效的JSON，格式化输出
 			var jsonData any
 			if err := json.Unmarshal(requestBody, &jsonData); err == nil {
-				if formattedJSON, err := json.Marshal(jsonData); err == nil {
+				if formattedJSON, err := json.Marshal(redactBody(jsonData)); err == nil {
 					requestBodyStr = string(formattedJSON)
 				}
 			}
 		} else if len(requestBody) > 0 {
-			requestBodyStr = string(requestBody)
+			// 无法解析的请求体不能按字段脱敏，只记录长度
+			requestBodyStr = fmt.Sprintf("<%d bytes, not JSON>", len(requestBody))
 		} else {
 			requestBodyStr = "empty"
 		}
 
-		log.Printf("[REQUEST] %s %s | Body: %s | IP: %s | UserAgent: %s",
+		s.logger.Printf("[REQUEST] %s %s | Body: %s | IP: %s | UserAgent: %s",
 			c.Request.Method,
-			c.Request.URL.Path,
+			path,
 			requestBodyStr,
 			c.ClientIP(),
 			c.Request.UserAgent(),
@@ -212,7 +403,7 @@ func LoggerMiddleware() gin.HandlerFunc {
 		c.Next()
 
 		// 记录响应信息
-		duration := time.Since(start)
+		duration := s.now().Sub(start)
 		statusCode := c.Writer.Status()
 
 		// 获取用户信息（如果有的话）
@@ -226,9 +417,9 @@ func LoggerMiddleware() gin.HandlerFunc {
 			userInfo = " | User: anonymous"
 		}
 
-		log.Printf("[RESPONSE] %s %s | Status: %d | Duration: %v%s",
+		s.logger.Printf("[RESPONSE] %s %s | Status: %d | Duration: %v%s",
 			c.Request.Method,
-			c.Request.URL.Path,
+			path,
 			statusCode,
 			duration,
 			userInfo,
@@ -246,29 +437,14 @@ func LoggerMiddleware() gin.HandlerFunc {
 // @Success 200 {object} Response{data=[]repository.Todo} "获取成功"
 // @Failure 200 {object} Response "获取失败"
 // @Router /api/v1/todos/list [post]
-func GetTodos(c *gin.Context) {
+func (s *Server) GetTodos(c *gin.Context) {
 	userID := c.GetInt("userID")
 
-	rows, err := global.Db.Query(`
-		SELECT id, title, description, completed, created_at, updated_at
-		FROM todos WHERE user_id = ? ORDER BY created_at DESC`, userID)
+	todos, err := s.store.GetTodosByUserIDExtended(userID, math.MaxInt32, 0)
 	if err != nil {
 		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取TODO列表失败"))
 		return
 	}
-	defer rows.Close()
-
-	var todos []repository.Todo
-	for rows.Next() {
-		var todo repository.Todo
-		todo.UserID = userID
-		err := rows.Scan(&todo.ID, &todo.Title, &todo.Description, &todo.Completed, &todo.CreatedAt, &todo.UpdatedAt)
-		if err != nil {
-			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "解析TODO数据失败"))
-			return
-		}
-		todos = append(todos, todo)
-	}
 
 	c.JSON(http.StatusOK, SuccessResponse(todos))
 }
@@ -284,7 +460,7 @@ func GetTodos(c *gin.Context) {
 // @Success 200 {object} Response{data=repository.Todo} "创建成功"
 // @Failure 200 {object} Response "创建失败"
 // @Router /api/v1/todos/create [post]
-func CreateTodo(c *gin.Context) {
+func (s *Server) CreateTodo(c *gin.Context) {
 	userID := c.GetInt("userID")
 	var req TodoRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -292,23 +468,19 @@ func CreateTodo(c *gin.Context) {
 		return
 	}
 
-	result, err := global.Db.Exec(`
-		INSERT INTO todos (user_id, title, description)
-		VALUES (?, ?, ?)`, userID, req.Title, req.Description)
-	if err != nil {
-		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "创建TODO失败"))
-		return
-	}
-
-	id, _ := result.LastInsertId()
-	todo := repository.Todo{
-		ID:          int(id),
+	todo := &repository.Todo{
 		UserID:      userID,
 		Title:       req.Title,
 		Description: req.Description,
-		Completed:   false,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		Tags:        repository.StringSlice{},
+	}
+	if err := s.deviceStore(c).CreateTodoExtended(todo); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "TODO UUID已存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "创建TODO失败"))
+		}
+		return
 	}
 
 	c.JSON(http.StatusOK, SuccessResponse(todo))
@@ -325,7 +497,7 @@ func CreateTodo(c *gin.Context) {
 // @Success 200 {object} Response{data=map[string]string} "更新成功"
 // @Failure 200 {object} Response "更新失败"
 // @Router /api/v1/todos/update [post]
-func UpdateTodo(c *gin.Context) {
+func (s *Server) UpdateTodo(c *gin.Context) {
 	userID := c.GetInt("userID")
 	var req UpdateTodoRequest
 
@@ -334,44 +506,32 @@ func UpdateTodo(c *gin.Context) {
 		return
 	}
 
-	// 构建动态更新查询
-	updates := []string{}
-	args := []any{}
+	if req.Title == nil && req.Description == nil && req.Completed == nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "没有要更新的字段"))
+		return
+	}
+
+	todo, err := s.store.GetTodoByID(req.ID, userID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "TODO不存在"))
+		return
+	}
 
 	if req.Title != nil {
-		updates = append(updates, "title = ?")
-		args = append(args, *req.Title)
+		todo.Title = *req.Title
 	}
 	if req.Description != nil {
-		updates = append(updates, "description = ?")
-		args = append(args, *req.Description)
+		todo.Description = *req.Description
 	}
 	if req.Completed != nil {
-		updates = append(updates, "completed = ?")
-		args = append(args, *req.Completed)
-	}
-
-	if len(updates) == 0 {
-		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "没有要更新的字段"))
-		return
+		todo.Completed = *req.Completed
 	}
 
-	updates = append(updates, "updated_at = CURRENT_TIMESTAMP")
-	args = append(args, userID, req.ID)
-
-	query := "UPDATE todos SET " + strings.Join(updates, ", ") + " WHERE user_id = ? AND id = ?"
-	result, err := global.Db.Exec(query, args...)
-	if err != nil {
+	if err := s.deviceStore(c).UpdateTodoExtended(todo); err != nil {
 		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "更新TODO失败"))
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "TODO不存在"))
-		return
-	}
-
 	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "TODO更新成功"}))
 }
 
@@ -386,7 +546,7 @@ func UpdateTodo(c *gin.Context) {
 // @Success 200 {object} Response{data=map[string]string} "删除成功"
 // @Failure 200 {object} Response "删除失败"
 // @Router /api/v1/todos/delete [post]
-func DeleteTodo(c *gin.Context) {
+func (s *Server) DeleteTodo(c *gin.Context) {
 	userID := c.GetInt("userID")
 	var req DeleteTodoRequest
 
@@ -395,15 +555,12 @@ func DeleteTodo(c *gin.Context) {
 		return
 	}
 
-	result, err := global.Db.Exec("DELETE FROM todos WHERE user_id = ? AND id = ?", userID, req.ID)
-	if err != nil {
-		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "删除TODO失败"))
-		return
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "TODO不存在"))
+	if err := s.deviceStore(c).DeleteTodo(req.ID, userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "TODO不存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "删除TODO失败"))
+		}
 		return
 	}
 
@@ -420,12 +577,10 @@ func DeleteTodo(c *gin.Context) {
 // @Success 200 {object} Response{data=repository.User} "获取成功"
 // @Failure 200 {object} Response "获取失败"
 // @Router /api/v1/profile [post]
-func GetProfile(c *gin.Context) {
+func (s *Server) GetProfile(c *gin.Context) {
 	userID := c.GetInt("userID")
 
-	var user repository.User
-	err := global.Db.QueryRow("SELECT id, username, email FROM users WHERE id = ?", userID).
-		Scan(&user.ID, &user.Username, &user.Email)
+	user, err := s.store.GetUserByID(userID)
 	if err != nil {
 		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "用户不存在"))
 		return
@@ -438,16 +593,16 @@ func GetProfile(c *gin.Context) {
 
 // GetTodosExtended 获取扩展TODO列表
 // @Summary 获取用户的扩展TODO列表
-// @Description 获取当前用户的所有TODO任务，支持分页和扩展字段
+// @Description 获取当前用户的TODO任务，支持按完成状态、优先级、分类、标签、截止/创建/更新时间等条件筛选，以及多字段排序。提供 cursor 时按游标分页，返回 TodoPageResponse（has_more 为 true 时以 next_cursor 继续拉取）；否则按 offset 分页直接返回列表
 // @Tags TODO管理
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param request body GetTodosRequest true "分页参数"
+// @Param request body GetTodosRequest true "筛选、排序和分页参数"
 // @Success 200 {object} Response{data=[]repository.Todo} "获取成功"
 // @Failure 200 {object} Response "获取失败"
 // @Router /api/v1/todos/list [post]
-func GetTodosExtended(c *gin.Context) {
+func (s *Server) GetTodosExtended(c *gin.Context) {
 	userID := c.GetInt("userID")
 	var req GetTodosRequest
 
@@ -464,14 +619,187 @@ func GetTodosExtended(c *gin.Context) {
 		req.Offset = 0
 	}
 
-	repo := repository.NewExtendedTodoRepository()
-	todos, err := repo.GetTodosByUserIDExtended(userID, req.Limit, req.Offset)
+	query, err := s.todoQuery(userID, &req)
 	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "分类不存在"))
+			return
+		}
 		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取TODO列表失败"))
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse(todos))
+	s.respondTodoPage(c, userID, query, req.Cursor, req.IncludeTotal, "获取TODO列表失败")
+}
+
+// respondTodoPage 分页查询TODO并返回结果。提供游标时按键集分页并返回 TodoPageResponse，
+// 否则按偏移量分页直接返回列表，兼容旧客户端
+func (s *Server) respondTodoPage(c *gin.Context, userID int, query repository.TodoQuery, cursor *string, includeTotal bool, failure string) {
+	if cursor == nil {
+		todos, err := s.store.ListTodos(userID, query)
+		if err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, failure))
+			return
+		}
+		highlightTodos(todos, query.Filter.Search)
+		c.JSON(http.StatusOK, SuccessResponse(todos))
+		return
+	}
+
+	signature := todoSortSignature(query.Sort)
+	if *cursor != "" {
+		var position todoCursor
+		if err := decodeCursor(*cursor, &position); err != nil || position.Sort != signature {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "无效的分页游标"))
+			return
+		}
+		query.After = &position.Key
+		query.Offset = 0
+	}
+
+	// 多取一条判断是否还有下一页
+	limit := query.Limit
+	query.Limit++
+	todos, err := s.store.ListTodos(userID, query)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, failure))
+		return
+	}
+
+	highlightTodos(todos, query.Filter.Search)
+	page := TodoPageResponse{Items: todos}
+	if len(todos) > limit {
+		page.Items = todos[:limit]
+		page.HasMore = true
+		page.NextCursor = encodeCursor(todoCursor{Sort: signature, Key: repository.KeyOf(&page.Items[limit-1])})
+	}
+	if page.Items == nil {
+		page.Items = []repository.Todo{}
+	}
+	if includeTotal {
+		total, err := s.store.CountTodos(userID, query.Filter)
+		if err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, failure))
+			return
+		}
+		page.Total = &total
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(page))
+}
+
+// highlightTodos 为搜索结果添加匹配部分的高亮片段
+func highlightTodos(todos []repository.Todo, search *repository.SearchQuery) {
+	if search == nil {
+		return
+	}
+	for i := range todos {
+		todos[i].Highlight = search.Highlight(&todos[i])
+	}
+}
+
+// userNow 返回用户时区的当前时间，用于计算相对日期
+func (s *Server) userNow(userID int) (time.Time, error) {
+	settings, err := s.store.GetUserSettings(userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return s.now().In(settings.Location()), nil
+}
+
+// parseSearch 按用户时区解析搜索查询
+func (s *Server) parseSearch(userID int, text string) (*repository.SearchQuery, error) {
+	now, err := s.userNow(userID)
+	if err != nil {
+		return nil, err
+	}
+	return repository.ParseSearchQuery(text, now)
+}
+
+// searchErrorResponse 返回搜索语法错误及出错位置
+func searchErrorResponse(err *repository.SearchSyntaxError) Response {
+	resp := ErrorResponse(CodeInvalidParams, "搜索语法错误: "+err.Error())
+	resp.Data = SearchErrorResponse{Offset: err.Offset, Length: err.Length}
+	return resp
+}
+
+// todoQuery 将列表请求转换为查询条件，分类UUID解析为分类ID
+func (s *Server) todoQuery(userID int, req *GetTodosRequest) (repository.TodoQuery, error) {
+	filter := repository.TodoFilter{
+		Completed:     req.Completed,
+		CategoryIDs:   req.CategoryIDs,
+		Uncategorized: req.Uncategorized,
+		Tags:          req.Tags,
+		TagMatch:      req.TagMatch,
+		DueAfter:      req.DueAfter,
+		DueBefore:     req.DueBefore,
+		Overdue:       req.Overdue,
+		Now:           s.now(),
+		HasReminder:   req.HasReminder,
+		CreatedAfter:  req.CreatedAfter,
+		CreatedBefore: req.CreatedBefore,
+		UpdatedAfter:  req.UpdatedAfter,
+		UpdatedBefore: req.UpdatedBefore,
+	}
+	for _, priority := range req.Priorities {
+		filter.Priorities = append(filter.Priorities, repository.Priority(priority))
+	}
+	for _, categoryUUID := range req.CategoryUUIDs {
+		category, err := s.findCategory(userID, 0, categoryUUID)
+		if err != nil {
+			return repository.TodoQuery{}, err
+		}
+		filter.CategoryIDs = append(filter.CategoryIDs, category.ID)
+	}
+
+	query := repository.TodoQuery{Filter: filter, Limit: req.Limit, Offset: req.Offset}
+	for _, sort := range req.Sort {
+		query.Sort = append(query.Sort, repository.TodoSort{Field: sort.Field, Desc: sort.Order == "desc"})
+	}
+	return query, nil
+}
+
+// deviceStore 返回以当前请求设备身份写入的存储，写入产生的修改历史记录该设备
+func (s *Server) deviceStore(c *gin.Context) repository.Store {
+	return s.store.WithDevice(c.GetString("deviceID"))
+}
+
+// findTodo 按整数ID或UUID查找未删除的TODO，两者都提供时以ID为准
+func (s *Server) findTodo(userID, id int, uuid string) (*repository.Todo, error) {
+	return lookupTodo(s.store, userID, id, uuid)
+}
+
+// lookupTodo 在指定的存储（可以是事务）中按整数ID或UUID查找TODO，规则同 findTodo
+func lookupTodo(r repository.Store, userID, id int, uuid string) (*repository.Todo, error) {
+	if id != 0 {
+		return r.GetTodoByID(id, userID)
+	}
+	todo, err := r.GetTodoByUUID(userID, uuid)
+	if err != nil {
+		return nil, err
+	}
+	if todo.IsDeleted {
+		return nil, repository.ErrNotFound
+	}
+	return todo, nil
+}
+
+// findCategory 按整数ID或UUID查找未删除的分类，两者都提供时以ID为准
+func (s *Server) findCategory(userID, id int, uuid string) (*repository.Category, error) {
+	var category *repository.Category
+	var err error
+	if id != 0 {
+		category, err = s.store.GetCategoryByID(id, userID)
+	} else {
+		category, err = s.store.GetCategoryByUUID(userID, uuid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if category.IsDeleted {
+		return nil, repository.ErrNotFound
+	}
+	return category, nil
 }
 
 // CreateTodoExtended 创建扩展TODO
@@ -485,7 +813,7 @@ func GetTodosExtended(c *gin.Context) {
 // @Success 200 {object} Response{data=repository.Todo} "创建成功"
 // @Failure 200 {object} Response "创建失败"
 // @Router /api/v1/todos/create [post]
-func CreateTodoExtended(c *gin.Context) {
+func (s *Server) CreateTodoExtended(c *gin.Context) {
 	userID := c.GetInt("userID")
 	var req ExtendedTodoRequest
 
@@ -500,6 +828,7 @@ func CreateTodoExtended(c *gin.Context) {
 	}
 
 	todo := &repository.Todo{
+		UUID:        req.UUID,
 		UserID:      userID,
 		Title:       req.Title,
 		Description: req.Description,
@@ -509,6 +838,15 @@ func CreateTodoExtended(c *gin.Context) {
 		Completed:   false,
 		IsDeleted:   false,
 	}
+	if req.CategoryUUID != "" {
+		category, err := s.findCategory(userID, 0, req.CategoryUUID)
+		if err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "分类不存在"))
+			return
+		}
+		todo.CategoryID = &category.ID
+		todo.CategoryUUID = &category.UUID
+	}
 
 	// 解析时间字段
 	if req.DueDate != nil {
@@ -522,9 +860,18 @@ func CreateTodoExtended(c *gin.Context) {
 		}
 	}
 
-	repo := repository.NewExtendedTodoRepository()
-	if err := repo.CreateTodoExtended(todo); err != nil {
-		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "创建TODO失败"))
+	todo.Recurrence = req.Recurrence
+	if err := repository.NormalizeTodoRecurrence(todo); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "重复规则无效: "+err.Error()))
+		return
+	}
+
+	if err := s.deviceStore(c).CreateTodoExtended(todo); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "TODO UUID已存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "创建TODO失败"))
+		}
 		return
 	}
 
@@ -533,16 +880,16 @@ func CreateTodoExtended(c *gin.Context) {
 
 // UpdateTodoExtended 更新扩展TODO
 // @Summary 更新扩展TODO任务
-// @Description 更新指定的TODO任务信息，支持扩展字段的部分更新
+// @Description 更新指定的TODO任务信息，支持扩展字段的部分更新。重复TODO被标记为完成时，按用户时区生成下一次实例并在 next 中返回，重复规则随之转移到新实例
 // @Tags TODO管理
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param todo body UpdateExtendedTodoRequest true "更新信息"
-// @Success 200 {object} Response{data=map[string]string} "更新成功"
+// @Success 200 {object} Response{data=UpdateTodoResponse} "更新成功"
 // @Failure 200 {object} Response "更新失败"
 // @Router /api/v1/todos/update [post]
-func UpdateTodoExtended(c *gin.Context) {
+func (s *Server) UpdateTodoExtended(c *gin.Context) {
 	userID := c.GetInt("userID")
 	var req UpdateExtendedTodoRequest
 
@@ -551,15 +898,58 @@ func UpdateTodoExtended(c *gin.Context) {
 		return
 	}
 
-	// 首先获取现有的TODO
-	repo := repository.NewExtendedTodoRepository()
-	todo, err := repo.GetTodoByID(req.ID, userID)
-	if err != nil {
+	var category *repository.Category
+	if req.CategoryUUID != "" {
+		var err error
+		if category, err = s.findCategory(userID, 0, req.CategoryUUID); err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "分类不存在"))
+			return
+		}
+	}
+
+	// 锁定后在事务中重新读取TODO再应用修改，并发的完成请求不会重复生成下一次实例，其他字段的并发修改也不会被覆盖
+	var next *repository.Todo
+	err := s.deviceStore(c).WithTx(func(tx repository.Store) error {
+		if err := tx.LockUserWrites(userID); err != nil {
+			return err
+		}
+		todo, err := lookupTodo(tx, userID, req.ID, req.UUID)
+		if err != nil {
+			return err
+		}
+		previous := *todo
+		applyTodoUpdate(todo, &req)
+		if category != nil {
+			todo.CategoryID = &category.ID
+		}
+		if err := repository.NormalizeTodoRecurrence(todo); err != nil {
+			return err
+		}
+
+		// 完成重复TODO时在同一事务中生成下一次实例
+		if next, err = repository.CompleteRecurringTodo(tx, &previous, todo); err != nil {
+			return err
+		}
+		return tx.UpdateTodoExtended(todo)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
 		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "TODO不存在"))
 		return
 	}
+	if errors.Is(err, repository.ErrInvalidRecurrence) {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "重复规则无效: "+err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "更新TODO失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(UpdateTodoResponse{Message: "TODO更新成功", Next: next}))
+}
 
-	// 更新字段
+// applyTodoUpdate 将更新请求中提供的字段应用到TODO上，分类UUID由调用方解析
+func applyTodoUpdate(todo *repository.Todo, req *UpdateExtendedTodoRequest) {
 	if req.Title != nil {
 		todo.Title = *req.Title
 	}
@@ -596,27 +986,58 @@ func UpdateTodoExtended(c *gin.Context) {
 			todo.Reminder = nil
 		}
 	}
+	if req.Recurrence != nil {
+		todo.Recurrence = req.Recurrence
+	}
+}
 
-	if err := repo.UpdateTodoExtended(todo); err != nil {
-		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "更新TODO失败"))
+// DeleteTodoExtended 删除扩展TODO
+// @Summary 删除扩展TODO
+// @Description 将TODO移入回收站（软删除），分配新的同步版本号并作为墓碑同步到其他设备；可在回收站中恢复或彻底删除
+// @Tags TODO管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param todo body DeleteExtendedTodoRequest true "删除信息"
+// @Success 200 {object} Response{data=map[string]string} "删除成功"
+// @Failure 200 {object} Response "删除失败"
+// @Router /api/v1/todos/delete [post]
+func (s *Server) DeleteTodoExtended(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req DeleteExtendedTodoRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "TODO更新成功"}))
+	todo, err := s.findTodo(userID, req.ID, req.UUID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "TODO不存在"))
+		return
+	}
+
+	todo.IsDeleted = true
+	if err := s.deviceStore(c).UpdateTodoExtended(todo); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "删除TODO失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "TODO已移入回收站"}))
 }
 
 // SearchTodos 搜索TODO
 // @Summary 搜索TODO任务
-// @Description 根据关键词搜索用户的TODO任务，支持标题和描述搜索
+// @Description 全文搜索用户TODO的标题、描述和标签，中文按字符二元组分词。支持短语（双引号）、前缀（*结尾）、排除（-开头）以及 tag:、category:、priority:、due:、created:、updated:、is:、has: 字段条件，日期按用户时区计算。语法错误返回 10001 及出错位置。默认按相关度排序，结果包含 search_rank 和 highlight 高亮片段。筛选、排序和分页参数与 /todos/list 相同
 // @Tags TODO管理
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param search body SearchTodosRequest true "搜索参数"
 // @Success 200 {object} Response{data=[]repository.Todo} "搜索成功"
-// @Failure 200 {object} Response "搜索失败"
+// @Failure 200 {object} Response{data=SearchErrorResponse} "搜索失败，语法错误时 data 包含出错位置"
 // @Router /api/v1/todos/search [post]
-func SearchTodos(c *gin.Context) {
+func (s *Server) SearchTodos(c *gin.Context) {
 	userID := c.GetInt("userID")
 	var req SearchTodosRequest
 
@@ -633,443 +1054,2548 @@ func SearchTodos(c *gin.Context) {
 		req.Offset = 0
 	}
 
-	repo := repository.NewExtendedTodoRepository()
-	todos, err := repo.SearchTodos(userID, req.Keyword, req.Limit, req.Offset)
+	query, err := s.todoQuery(userID, &req.GetTodosRequest)
 	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "分类不存在"))
+			return
+		}
 		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "搜索TODO失败"))
 		return
 	}
-
-	c.JSON(http.StatusOK, SuccessResponse(todos))
+	query.Filter.Search, err = s.parseSearch(userID, req.Keyword)
+	if err != nil {
+		var syntaxErr *repository.SearchSyntaxError
+		if errors.As(err, &syntaxErr) {
+			c.JSON(http.StatusOK, searchErrorResponse(syntaxErr))
+			return
+		}
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "搜索TODO失败"))
+		return
+	}
+	if len(query.Sort) == 0 {
+		query.Sort = []repository.TodoSort{{Field: repository.SortRelevance, Desc: true}, {Field: repository.SortCreatedAt, Desc: true}}
+	}
+
+	s.respondTodoPage(c, userID, query, req.Cursor, req.IncludeTotal, "搜索TODO失败")
+}
+
+// ===== 修改历史API =====
+
+// historyTodoID 按整数ID或UUID确定TODO ID，已删除的TODO同样可以查看历史和回滚
+func (s *Server) historyTodoID(userID, id int, uuid string) (int, error) {
+	if id != 0 {
+		return id, nil
+	}
+	todo, err := s.store.GetTodoByUUID(userID, uuid)
+	if err != nil {
+		return 0, err
+	}
+	return todo.ID, nil
+}
+
+// GetTodoHistory 获取TODO修改历史
+// @Summary 获取TODO修改历史
+// @Description 获取指定TODO的全部修改记录（包括已删除的TODO），按时间从新到旧排序。每条记录包含发生变化的字段及修改前后的取值、发起修改的设备和产生的同步版本号
+// @Tags TODO管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body TodoHistoryRequest true "TODO信息"
+// @Success 200 {object} Response{data=[]repository.Revision} "获取成功"
+// @Failure 200 {object} Response "获取失败"
+// @Router /api/v1/todos/history [post]
+func (s *Server) GetTodoHistory(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req TodoHistoryRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	todoID, err := s.historyTodoID(userID, req.ID, req.UUID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "TODO不存在"))
+		return
+	}
+
+	revisions, err := s.store.GetRevisions(userID, repository.SyncTypeTodo, todoID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取修改历史失败"))
+		return
+	}
+	if revisions == nil {
+		revisions = []repository.Revision{}
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(revisions))
+}
+
+// GetReminderDeliveries 获取TODO提醒投递记录
+// @Summary 获取TODO提醒投递记录
+// @Description 获取指定TODO的提醒在各通知渠道（webhook/email/push）上的投递记录，按时间从新到旧排序。状态为 pending（等待发送或重试）、sending、sent、failed（重试次数用尽）、skipped（该渠道没有接收方）或 cancelled（发送前TODO已完成、删除或修改了提醒时间）
+// @Tags TODO管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ReminderDeliveriesRequest true "TODO信息"
+// @Success 200 {object} Response{data=[]repository.ReminderDelivery} "获取成功"
+// @Failure 200 {object} Response "获取失败"
+// @Router /api/v1/todos/reminders [post]
+func (s *Server) GetReminderDeliveries(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req ReminderDeliveriesRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	todoID, err := s.historyTodoID(userID, req.ID, req.UUID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "TODO不存在"))
+		return
+	}
+
+	deliveries, err := s.store.GetReminderDeliveries(userID, todoID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取提醒投递记录失败"))
+		return
+	}
+	if deliveries == nil {
+		deliveries = []repository.ReminderDelivery{}
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(deliveries))
+}
+
+// RevertTodo 回滚TODO
+// @Summary 将TODO回滚到指定修改
+// @Description 将TODO恢复为指定修改记录之后的状态，已删除的TODO会被恢复。回滚作为一次新的修改保存，分配新的同步版本号并记录修改历史；原分类已被删除时TODO不再属于任何分类
+// @Tags TODO管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body RevertTodoRequest true "回滚信息"
+// @Success 200 {object} Response{data=repository.Todo} "回滚成功"
+// @Failure 200 {object} Response "回滚失败"
+// @Router /api/v1/todos/revert [post]
+func (s *Server) RevertTodo(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req RevertTodoRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	todoID, err := s.historyTodoID(userID, req.ID, req.UUID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "TODO不存在"))
+		return
+	}
+
+	todo, err := repository.RevertTodo(s.deviceStore(c), userID, todoID, req.RevisionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "修改记录不存在"))
+			return
+		}
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "回滚TODO失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(todo))
+}
+
+// ===== 回收站API =====
+
+// findDeletedTodo 按整数ID或UUID查找回收站中的TODO，两者都提供时以ID为准
+func (s *Server) findDeletedTodo(userID, id int, uuid string) (*repository.Todo, error) {
+	if id != 0 {
+		return s.store.GetDeletedTodo(id, userID)
+	}
+	todo, err := s.store.GetTodoByUUID(userID, uuid)
+	if err != nil {
+		return nil, err
+	}
+	if !todo.IsDeleted {
+		return nil, repository.ErrNotFound
+	}
+	return todo, nil
+}
+
+// findDeletedCategory 按整数ID或UUID查找回收站中的分类，两者都提供时以ID为准
+func (s *Server) findDeletedCategory(userID, id int, uuid string) (*repository.Category, error) {
+	var category *repository.Category
+	var err error
+	if id != 0 {
+		category, err = s.store.GetCategoryByID(id, userID)
+	} else {
+		category, err = s.store.GetCategoryByUUID(userID, uuid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !category.IsDeleted {
+		return nil, repository.ErrNotFound
+	}
+	return category, nil
+}
+
+// GetTrash 获取回收站
+// @Summary 获取回收站
+// @Description 获取已删除的TODO和分类，按删除时间从新到旧排序。超过保留期且全部设备都已同步过删除的数据会被自动彻底删除
+// @Tags 回收站
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body TrashRequest true "分页参数"
+// @Success 200 {object} Response{data=TrashResponse} "获取成功"
+// @Failure 200 {object} Response "获取失败"
+// @Router /api/v1/trash [post]
+func (s *Server) GetTrash(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req TrashRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 500 {
+		req.Limit = 100
+	}
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+
+	todos, err := s.store.ListTodos(userID, repository.TodoQuery{
+		Filter: repository.TodoFilter{Deleted: true},
+		Sort:   []repository.TodoSort{{Field: repository.SortUpdatedAt, Desc: true}},
+		Limit:  req.Limit,
+		Offset: req.Offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取回收站失败"))
+		return
+	}
+	categories, err := s.store.GetDeletedCategories(userID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取回收站失败"))
+		return
+	}
+
+	resp := TrashResponse{Todos: todos, Categories: categories}
+	if resp.Todos == nil {
+		resp.Todos = []repository.Todo{}
+	}
+	if resp.Categories == nil {
+		resp.Categories = []repository.Category{}
+	}
+	c.JSON(http.StatusOK, SuccessResponse(resp))
+}
+
+// RestoreTrashItem 恢复回收站中的数据
+// @Summary 恢复回收站中的TODO或分类
+// @Description 恢复已删除的TODO或分类，分配新的同步版本号。恢复TODO时原分类仍在回收站中，TODO不再属于任何分类
+// @Tags 回收站
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body TrashItemRequest true "恢复的数据"
+// @Success 200 {object} Response{data=RestoreTrashResponse} "恢复成功"
+// @Failure 200 {object} Response "恢复失败"
+// @Router /api/v1/trash/restore [post]
+func (s *Server) RestoreTrashItem(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req TrashItemRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	resp := RestoreTrashResponse{Message: "恢复成功"}
+	if req.Type == repository.SyncTypeTodo {
+		todo, err := s.findDeletedTodo(userID, req.ID, req.UUID)
+		if err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "回收站中不存在该TODO"))
+			return
+		}
+		if resp.Todo, err = repository.RestoreTodo(s.deviceStore(c), userID, todo.ID); err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "恢复TODO失败"))
+			return
+		}
+	} else {
+		category, err := s.findDeletedCategory(userID, req.ID, req.UUID)
+		if err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "回收站中不存在该分类"))
+			return
+		}
+		if err := s.deviceStore(c).RestoreCategory(category.ID, userID); err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "恢复分类失败"))
+			return
+		}
+		if resp.Category, err = s.store.GetCategoryByID(category.ID, userID); err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "恢复分类失败"))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(resp))
+}
+
+// DeleteTrashItem 彻底删除回收站中的数据
+// @Summary 彻底删除回收站中的TODO或分类
+// @Description 物理删除回收站中的TODO（检查项一并删除）或分类，修改历史保留。彻底删除分类时仍属于该分类的TODO移出分类。尚未同步过删除的设备需要全量同步才能移除本地数据
+// @Tags 回收站
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body TrashItemRequest true "删除的数据"
+// @Success 200 {object} Response{data=map[string]string} "删除成功"
+// @Failure 200 {object} Response "删除失败"
+// @Router /api/v1/trash/delete [post]
+func (s *Server) DeleteTrashItem(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req TrashItemRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	if req.Type == repository.SyncTypeTodo {
+		todo, err := s.findDeletedTodo(userID, req.ID, req.UUID)
+		if err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "回收站中不存在该TODO"))
+			return
+		}
+		if err := repository.DeleteTodoPermanently(s.deviceStore(c), userID, todo.ID); err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "彻底删除TODO失败"))
+			return
+		}
+	} else {
+		category, err := s.findDeletedCategory(userID, req.ID, req.UUID)
+		if err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "回收站中不存在该分类"))
+			return
+		}
+		if err := repository.DeleteCategoryPermanently(s.deviceStore(c), userID, category.ID); err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "彻底删除分类失败"))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "已彻底删除"}))
+}
+
+// EmptyTrash 清空回收站
+// @Summary 清空回收站
+// @Description 彻底删除回收站中的全部TODO和分类
+// @Tags 回收站
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} Response{data=EmptyTrashResponse} "清空成功"
+// @Failure 200 {object} Response "清空失败"
+// @Router /api/v1/trash/empty [post]
+func (s *Server) EmptyTrash(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	todos, categories, err := repository.EmptyTrash(s.deviceStore(c), userID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "清空回收站失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(EmptyTrashResponse{
+		Message:           "回收站已清空",
+		DeletedTodos:      todos,
+		DeletedCategories: categories,
+	}))
+}
+
+// ===== 检查项API =====
+
+// findChecklistItem 按整数ID或UUID查找未删除的检查项，两者都提供时以ID为准
+func (s *Server) findChecklistItem(userID, id int, uuid string) (*repository.ChecklistItem, error) {
+	if id != 0 {
+		return s.store.GetChecklistItemByID(id, userID)
+	}
+	item, err := s.store.GetChecklistItemByUUID(userID, uuid)
+	if err != nil {
+		return nil, err
+	}
+	if item.IsDeleted {
+		return nil, repository.ErrNotFound
+	}
+	return item, nil
+}
+
+// GetChecklist 获取TODO的检查项
+// @Summary 获取TODO的检查项
+// @Description 获取指定TODO未删除的检查项，按位置排序
+// @Tags 检查项
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ChecklistRequest true "TODO信息"
+// @Success 200 {object} Response{data=[]repository.ChecklistItem} "获取成功"
+// @Failure 200 {object} Response "获取失败"
+// @Router /api/v1/todos/checklist [post]
+func (s *Server) GetChecklist(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req ChecklistRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	todo, err := s.findTodo(userID, req.TodoID, req.TodoUUID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "TODO不存在"))
+		return
+	}
+
+	items, err := s.store.GetChecklistItemsByTodoID(todo.ID, userID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取检查项失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(items))
+}
+
+// CreateChecklistItem 创建检查项
+// @Summary 创建检查项
+// @Description 为指定TODO添加一个检查项，排在现有检查项之后
+// @Tags 检查项
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param item body CreateChecklistItemRequest true "检查项信息"
+// @Success 200 {object} Response{data=repository.ChecklistItem} "创建成功"
+// @Failure 200 {object} Response "创建失败"
+// @Router /api/v1/todos/checklist/create [post]
+func (s *Server) CreateChecklistItem(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req CreateChecklistItemRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	todo, err := s.findTodo(userID, req.TodoID, req.TodoUUID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "TODO不存在"))
+		return
+	}
+
+	item := &repository.ChecklistItem{
+		UUID:   req.UUID,
+		TodoID: todo.ID,
+		UserID: userID,
+		Title:  req.Title,
+	}
+
+	if err := s.store.CreateChecklistItem(item); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "检查项UUID已存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "创建检查项失败"))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(item))
+}
+
+// UpdateChecklistItem 更新检查项
+// @Summary 更新检查项
+// @Description 修改检查项的标题或完成状态，未提供的字段保持不变
+// @Tags 检查项
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param item body UpdateChecklistItemRequest true "更新信息"
+// @Success 200 {object} Response{data=repository.ChecklistItem} "更新成功"
+// @Failure 200 {object} Response "更新失败"
+// @Router /api/v1/todos/checklist/update [post]
+func (s *Server) UpdateChecklistItem(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req UpdateChecklistItemRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	item, err := s.findChecklistItem(userID, req.ID, req.UUID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "检查项不存在"))
+		return
+	}
+
+	if req.Title != nil {
+		item.Title = *req.Title
+	}
+	if req.Completed != nil {
+		item.Completed = *req.Completed
+	}
+
+	if err := s.store.UpdateChecklistItem(item); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "更新检查项失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(item))
+}
+
+// ToggleChecklistItem 切换检查项完成状态
+// @Summary 切换检查项完成状态
+// @Description 将检查项在完成与未完成之间切换，返回切换后的检查项
+// @Tags 检查项
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param item body ChecklistItemRequest true "检查项"
+// @Success 200 {object} Response{data=repository.ChecklistItem} "切换成功"
+// @Failure 200 {object} Response "切换失败"
+// @Router /api/v1/todos/checklist/toggle [post]
+func (s *Server) ToggleChecklistItem(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req ChecklistItemRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	item, err := s.findChecklistItem(userID, req.ID, req.UUID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "检查项不存在"))
+		return
+	}
+
+	item.Completed = !item.Completed
+	if err := s.store.UpdateChecklistItem(item); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "更新检查项失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(item))
+}
+
+// ReorderChecklist 重新排列检查项
+// @Summary 重新排列检查项
+// @Description 按给定顺序重新排列TODO的检查项，需列出该TODO的全部检查项，返回排序后的检查项
+// @Tags 检查项
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ReorderChecklistRequest true "排序信息"
+// @Success 200 {object} Response{data=[]repository.ChecklistItem} "排序成功"
+// @Failure 200 {object} Response "排序失败"
+// @Router /api/v1/todos/checklist/reorder [post]
+func (s *Server) ReorderChecklist(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req ReorderChecklistRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	todo, err := s.findTodo(userID, req.TodoID, req.TodoUUID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "TODO不存在"))
+		return
+	}
+
+	var items []repository.ChecklistItem
+	err = s.store.WithTx(func(tx repository.Store) error {
+		itemIDs := req.ItemIDs
+		if len(itemIDs) == 0 {
+			// 按UUID排序时先换算为ID，不属于该TODO的UUID按排序无效处理
+			current, err := tx.GetChecklistItemsByTodoID(todo.ID, userID)
+			if err != nil {
+				return err
+			}
+			idByUUID := make(map[string]int, len(current))
+			for _, item := range current {
+				idByUUID[item.UUID] = item.ID
+			}
+			for _, itemUUID := range req.ItemUUIDs {
+				itemIDs = append(itemIDs, idByUUID[itemUUID])
+			}
+		}
+
+		var err error
+		items, err = repository.ReorderChecklistItems(tx, todo.ID, userID, itemIDs)
+		return err
+	})
+	if errors.Is(err, repository.ErrInvalidChecklistOrder) {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "检查项顺序无效，需包含该TODO的全部检查项且不能重复"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "排序检查项失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(items))
+}
+
+// DeleteChecklistItem 删除检查项
+// @Summary 删除检查项
+// @Description 删除指定的检查项（软删除）
+// @Tags 检查项
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param item body ChecklistItemRequest true "检查项"
+// @Success 200 {object} Response{data=map[string]string} "删除成功"
+// @Failure 200 {object} Response "删除失败"
+// @Router /api/v1/todos/checklist/delete [post]
+func (s *Server) DeleteChecklistItem(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req ChecklistItemRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	item, err := s.findChecklistItem(userID, req.ID, req.UUID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "检查项不存在"))
+		return
+	}
+
+	if err := s.store.DeleteChecklistItem(item.ID, userID); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "删除检查项失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "检查项删除成功"}))
+}
+
+// ===== 分类管理API =====
+
+// GetCategories 获取分类列表
+// @Summary 获取用户的分类列表
+// @Description 获取当前用户的所有分类
+// @Tags 分类管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} Response{data=[]repository.Category} "获取成功"
+// @Failure 200 {object} Response "获取失败"
+// @Router /api/v1/categories [post]
+func (s *Server) GetCategories(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	categories, err := s.store.GetCategoriesByUserID(userID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取分类列表失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(categories))
+}
+
+// CreateCategory 创建分类
+// @Summary 创建新分类
+// @Description 为当前用户创建一个新的分类
+// @Tags 分类管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param category body CategoryRequest true "分类信息"
+// @Success 200 {object} Response{data=repository.Category} "创建成功"
+// @Failure 200 {object} Response "创建失败"
+// @Router /api/v1/categories/create [post]
+func (s *Server) CreateCategory(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req CategoryRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	// 设置默认值
+	if req.Color == "" {
+		req.Color = "#2196F3"
+	}
+	if req.Icon == "" {
+		req.Icon = "folder"
+	}
+
+	category := &repository.Category{
+		UUID:   req.UUID,
+		UserID: userID,
+		Name:   req.Name,
+		Color:  req.Color,
+		Icon:   req.Icon,
+	}
+
+	if err := s.deviceStore(c).CreateCategory(category); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "分类名称或UUID已存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "创建分类失败"))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(category))
+}
+
+// UpdateCategory 更新分类
+// @Summary 更新分类
+// @Description 更新指定的分类信息
+// @Tags 分类管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param category body UpdateCategoryRequest true "更新信息"
+// @Success 200 {object} Response{data=map[string]string} "更新成功"
+// @Failure 200 {object} Response "更新失败"
+// @Router /api/v1/categories/update [post]
+func (s *Server) UpdateCategory(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req UpdateCategoryRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	existing, err := s.findCategory(userID, req.ID, req.UUID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "分类不存在"))
+		return
+	}
+
+	category := &repository.Category{
+		ID:     existing.ID,
+		UUID:   existing.UUID,
+		UserID: userID,
+		Name:   req.Name,
+		Color:  req.Color,
+		Icon:   req.Icon,
+	}
+
+	if err := s.deviceStore(c).UpdateCategory(category); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "分类名称已存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "更新分类失败"))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "分类更新成功"}))
+}
+
+// DeleteCategory 删除分类
+// @Summary 删除分类
+// @Description 删除指定的分类（软删除）
+// @Tags 分类管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param category body DeleteCategoryRequest true "删除信息"
+// @Success 200 {object} Response{data=map[string]string} "删除成功"
+// @Failure 200 {object} Response "删除失败"
+// @Router /api/v1/categories/delete [post]
+func (s *Server) DeleteCategory(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req DeleteCategoryRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	category, err := s.findCategory(userID, req.ID, req.UUID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "分类不存在"))
+		return
+	}
+
+	if err := s.deviceStore(c).DeleteCategory(category.ID, userID); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "删除分类失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "分类删除成功"}))
+}
+
+// ===== 标签API =====
+
+// tagRewriteErrorResponse 返回标签重命名、合并和删除失败的响应
+func tagRewriteErrorResponse(err error, action string) Response {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return ErrorResponse(CodeNotFound, "标签不存在")
+	case errors.Is(err, repository.ErrDuplicate):
+		return ErrorResponse(CodeInvalidParams, "目标标签已存在，请使用合并")
+	default:
+		return ErrorResponse(CodeInternalError, action+"失败")
+	}
+}
+
+// GetTags 获取标签列表
+// @Summary 获取用户的标签列表
+// @Description 获取当前用户的全部标签及使用次数，包括TODO中使用但尚未设置颜色和图标的标签（id 为 0）。按使用次数从多到少排序
+// @Tags 标签管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} Response{data=[]repository.Tag} "获取成功"
+// @Failure 200 {object} Response "获取失败"
+// @Router /api/v1/tags [post]
+func (s *Server) GetTags(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	tags, err := repository.ListTags(s.store, userID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取标签列表失败"))
+		return
+	}
+	if tags == nil {
+		tags = []repository.Tag{}
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(tags))
+}
+
+// CreateTag 创建标签
+// @Summary 创建标签
+// @Description 为标签名称保存颜色和图标，标签名称可以已在TODO中使用
+// @Tags 标签管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param tag body TagRequest true "标签信息"
+// @Success 200 {object} Response{data=repository.Tag} "创建成功"
+// @Failure 200 {object} Response "创建失败"
+// @Router /api/v1/tags/create [post]
+func (s *Server) CreateTag(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req TagRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	// 设置默认值
+	if req.Color == "" {
+		req.Color = "#9E9E9E"
+	}
+	if req.Icon == "" {
+		req.Icon = "label"
+	}
+
+	tag := &repository.Tag{
+		UUID:   req.UUID,
+		UserID: userID,
+		Name:   req.Name,
+		Color:  req.Color,
+		Icon:   req.Icon,
+	}
+
+	if err := s.store.CreateTag(tag); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "标签名称或UUID已存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "创建标签失败"))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(tag))
+}
+
+// UpdateTag 更新标签
+// @Summary 更新标签的颜色和图标
+// @Description 按名称更新标签的颜色和图标，标签还没有元数据时自动创建。修改名称请使用 /tags/rename
+// @Tags 标签管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param tag body UpdateTagRequest true "更新信息"
+// @Success 200 {object} Response{data=repository.Tag} "更新成功"
+// @Failure 200 {object} Response "更新失败"
+// @Router /api/v1/tags/update [post]
+func (s *Server) UpdateTag(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req UpdateTagRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	tag, err := s.store.GetTagByName(userID, req.Name)
+	if errors.Is(err, repository.ErrNotFound) {
+		tag = &repository.Tag{UserID: userID, Name: req.Name, Color: "#9E9E9E", Icon: "label"}
+	} else if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "更新标签失败"))
+		return
+	}
+
+	if req.Color != "" {
+		tag.Color = req.Color
+	}
+	if req.Icon != "" {
+		tag.Icon = req.Icon
+	}
+
+	if tag.ID == 0 {
+		err = s.store.CreateTag(tag)
+	} else {
+		err = s.store.UpdateTag(tag)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "更新标签失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(tag))
+}
+
+// RenameTag 重命名标签
+// @Summary 重命名标签
+// @Description 在同一事务中把全部TODO上的标签 from 改为 to，并更新标签元数据。to 已存在时返回错误，应使用 /tags/merge
+// @Tags 标签管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param tag body RenameTagRequest true "重命名信息"
+// @Success 200 {object} Response{data=TagRewriteResponse} "重命名成功"
+// @Failure 200 {object} Response "重命名失败"
+// @Router /api/v1/tags/rename [post]
+func (s *Server) RenameTag(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req RenameTagRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	rewritten, err := repository.RenameTag(s.deviceStore(c), userID, req.From, req.To)
+	if err != nil {
+		c.JSON(http.StatusOK, tagRewriteErrorResponse(err, "重命名标签"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(TagRewriteResponse{Message: "标签重命名成功", RewrittenTodos: rewritten}))
+}
+
+// MergeTags 合并标签
+// @Summary 合并标签
+// @Description 在同一事务中把全部TODO上的来源标签替换为目标标签（同一TODO不重复），并删除来源标签的元数据
+// @Tags 标签管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param tag body MergeTagsRequest true "合并信息"
+// @Success 200 {object} Response{data=TagRewriteResponse} "合并成功"
+// @Failure 200 {object} Response "合并失败"
+// @Router /api/v1/tags/merge [post]
+func (s *Server) MergeTags(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req MergeTagsRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	rewritten, err := repository.MergeTags(s.deviceStore(c), userID, req.Sources, req.Target)
+	if err != nil {
+		c.JSON(http.StatusOK, tagRewriteErrorResponse(err, "合并标签"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(TagRewriteResponse{Message: "标签合并成功", RewrittenTodos: rewritten}))
+}
+
+// DeleteTag 删除标签
+// @Summary 删除标签
+// @Description 在同一事务中从全部TODO上移除该标签，并删除标签元数据（软删除，作为墓碑参与增量同步）
+// @Tags 标签管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param tag body TagNameRequest true "删除信息"
+// @Success 200 {object} Response{data=TagRewriteResponse} "删除成功"
+// @Failure 200 {object} Response "删除失败"
+// @Router /api/v1/tags/delete [post]
+func (s *Server) DeleteTag(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req TagNameRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	rewritten, err := repository.RemoveTag(s.deviceStore(c), userID, req.Name)
+	if err != nil {
+		c.JSON(http.StatusOK, tagRewriteErrorResponse(err, "删除标签"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(TagRewriteResponse{Message: "标签删除成功", RewrittenTodos: rewritten}))
+}
+
+// ===== 智能列表API =====
+
+// findSmartList 按整数ID或UUID查找未删除的智能列表，两者都提供时以ID为准
+func (s *Server) findSmartList(userID, id int, uuid string) (*repository.SmartList, error) {
+	if id != 0 {
+		return s.store.GetSmartListByID(id, userID)
+	}
+	list, err := s.store.GetSmartListByUUID(userID, uuid)
+	if err != nil {
+		return nil, err
+	}
+	if list.IsDeleted {
+		return nil, repository.ErrNotFound
+	}
+	return list, nil
+}
+
+// smartListErrorResponse 返回智能列表定义的校验错误，搜索语法错误包含出错位置
+func smartListErrorResponse(err error) Response {
+	var syntaxErr *repository.SearchSyntaxError
+	if errors.As(err, &syntaxErr) {
+		return searchErrorResponse(syntaxErr)
+	}
+	return ErrorResponse(CodeInvalidParams, "智能列表定义无效: "+err.Error())
+}
+
+// GetSmartLists 获取智能列表
+// @Summary 获取用户的智能列表
+// @Description 获取当前用户的所有智能列表，按创建时间排序
+// @Tags 智能列表
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} Response{data=[]repository.SmartList} "获取成功"
+// @Failure 200 {object} Response "获取失败"
+// @Router /api/v1/smart-lists [post]
+func (s *Server) GetSmartLists(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	lists, err := s.store.GetSmartListsByUserID(userID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取智能列表失败"))
+		return
+	}
+	if lists == nil {
+		lists = []repository.SmartList{}
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(lists))
+}
+
+// CreateSmartList 创建智能列表
+// @Summary 创建智能列表
+// @Description 保存一组TODO筛选和排序条件。definition 中的 query 语法同 /todos/search 的 keyword，分类以UUID引用，截止日期范围以相对执行当天的天数表示，执行时按用户时区计算
+// @Tags 智能列表
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param list body SmartListRequest true "智能列表信息"
+// @Success 200 {object} Response{data=repository.SmartList} "创建成功"
+// @Failure 200 {object} Response{data=SearchErrorResponse} "创建失败，query 语法错误时 data 包含出错位置"
+// @Router /api/v1/smart-lists/create [post]
+func (s *Server) CreateSmartList(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req SmartListRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+	if err := req.Definition.Validate(); err != nil {
+		c.JSON(http.StatusOK, smartListErrorResponse(err))
+		return
+	}
+
+	// 设置默认值
+	if req.Color == "" {
+		req.Color = "#2196F3"
+	}
+	if req.Icon == "" {
+		req.Icon = "list"
+	}
+
+	list := &repository.SmartList{
+		UUID:       req.UUID,
+		UserID:     userID,
+		Name:       req.Name,
+		Icon:       req.Icon,
+		Color:      req.Color,
+		Definition: req.Definition,
+	}
+
+	if err := s.store.CreateSmartList(list); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "智能列表UUID已存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "创建智能列表失败"))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(list))
+}
+
+// UpdateSmartList 更新智能列表
+// @Summary 更新智能列表
+// @Description 更新智能列表的名称、图标、颜色和定义，定义整体替换
+// @Tags 智能列表
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param list body UpdateSmartListRequest true "更新信息"
+// @Success 200 {object} Response{data=repository.SmartList} "更新成功"
+// @Failure 200 {object} Response{data=SearchErrorResponse} "更新失败，query 语法错误时 data 包含出错位置"
+// @Router /api/v1/smart-lists/update [post]
+func (s *Server) UpdateSmartList(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req UpdateSmartListRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+	if err := req.Definition.Validate(); err != nil {
+		c.JSON(http.StatusOK, smartListErrorResponse(err))
+		return
+	}
+
+	list, err := s.findSmartList(userID, req.ID, req.UUID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "智能列表不存在"))
+		return
+	}
+
+	list.Name = req.Name
+	if req.Color != "" {
+		list.Color = req.Color
+	}
+	if req.Icon != "" {
+		list.Icon = req.Icon
+	}
+	list.Definition = req.Definition
+
+	if err := s.store.UpdateSmartList(list); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "更新智能列表失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(list))
+}
+
+// DeleteSmartList 删除智能列表
+// @Summary 删除智能列表
+// @Description 删除指定的智能列表（软删除，作为墓碑参与增量同步），不影响其中的TODO
+// @Tags 智能列表
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param list body SmartListIDRequest true "删除信息"
+// @Success 200 {object} Response{data=map[string]string} "删除成功"
+// @Failure 200 {object} Response "删除失败"
+// @Router /api/v1/smart-lists/delete [post]
+func (s *Server) DeleteSmartList(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req SmartListIDRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	list, err := s.findSmartList(userID, req.ID, req.UUID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "智能列表不存在"))
+		return
+	}
+
+	if err := s.store.DeleteSmartList(list.ID, userID); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "删除智能列表失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "智能列表删除成功"}))
+}
+
+// GetSmartListTodos 执行智能列表
+// @Summary 获取智能列表中的TODO
+// @Description 按智能列表保存的条件筛选和排序当前用户的TODO，相对日期按用户时区的当天计算。未保存排序时按创建时间倒序，定义中包含搜索词时按相关度排序。分页方式与 /todos/list 相同
+// @Tags 智能列表
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body SmartListTodosRequest true "智能列表和分页参数"
+// @Success 200 {object} Response{data=[]repository.Todo} "获取成功"
+// @Failure 200 {object} Response "获取失败"
+// @Router /api/v1/smart-lists/todos [post]
+func (s *Server) GetSmartListTodos(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req SmartListTodosRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	// 设置默认值
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 20
+	}
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+
+	list, err := s.findSmartList(userID, req.ID, req.UUID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "智能列表不存在"))
+		return
+	}
+	now, err := s.userNow(userID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取智能列表TODO失败"))
+		return
+	}
+	query, err := repository.SmartListQuery(s.store, list, now)
+	if err != nil {
+		var syntaxErr *repository.SearchSyntaxError
+		switch {
+		case errors.As(err, &syntaxErr):
+			c.JSON(http.StatusOK, searchErrorResponse(syntaxErr))
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "分类不存在"))
+		default:
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取智能列表TODO失败"))
+		}
+		return
+	}
+	if len(query.Sort) == 0 && query.Filter.Search.HasTerms() {
+		query.Sort = []repository.TodoSort{{Field: repository.SortRelevance, Desc: true}, {Field: repository.SortCreatedAt, Desc: true}}
+	}
+	query.Limit = req.Limit
+	query.Offset = req.Offset
+
+	s.respondTodoPage(c, userID, query, req.Cursor, req.IncludeTotal, "获取智能列表TODO失败")
+}
+
+// ===== 用户设置API =====
+
+// GetUserSettings 获取用户设置
+// @Summary 获取用户设置
+// @Description 获取当前用户的个性化设置
+// @Tags 用户设置
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} Response{data=repository.UserSettings} "获取成功"
+// @Failure 200 {object} Response "获取失败"
+// @Router /api/v1/settings [post]
+func (s *Server) GetUserSettings(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	settings, err := s.store.GetUserSettings(userID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取用户设置失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(settings))
+}
+
+// UpdateUserSettings 更新用户设置
+// @Summary 更新用户设置
+// @Description 更新当前用户的个性化设置
+// @Tags 用户设置
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param settings body UserSettingsRequest true "设置信息"
+// @Success 200 {object} Response{data=map[string]string} "更新成功"
+// @Failure 200 {object} Response "更新失败"
+// @Router /api/v1/settings/update [post]
+func (s *Server) UpdateUserSettings(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req UserSettingsRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	// 验证主题设置
+	if req.Theme != "" && req.Theme != "light" && req.Theme != "dark" && req.Theme != "auto" {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "无效的主题设置"))
+		return
+	}
+
+	current, err := s.store.GetUserSettings(userID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取用户设置失败"))
+		return
+	}
+	settings := &repository.UserSettings{
+		UserID:           userID,
+		Theme:            req.Theme,
+		NotificationTime: req.NotificationTime,
+		Language:         req.Language,
+		TimeZone:         req.TimeZone,
+		DailyDigest:      current.DailyDigest,
+	}
+	if req.DailyDigest != nil {
+		settings.DailyDigest = *req.DailyDigest
+	}
+
+	if err := s.store.UpdateUserSettings(settings); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "更新用户设置失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "用户设置更新成功"}))
+}
+
+// ===== 数据同步API =====
+
+// GetSyncVersion 获取同步版本
+// @Summary 获取当前同步版本号
+// @Description 获取服务器当前的同步版本号，用于增量同步
+// @Tags 数据同步
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} Response{data=SyncVersionResponse} "获取成功"
+// @Failure 200 {object} Response "获取失败"
+// @Router /api/v1/sync/version [post]
+func (s *Server) GetSyncVersion(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	version, err := s.store.GetCurrentSyncVersion(userID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取同步版本失败"))
+		return
+	}
+
+	response := SyncVersionResponse{
+		Version: version,
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(response))
+}
+
+// IncrementalSync 增量同步
+// @Summary 增量同步数据
+// @Description 按同步版本号顺序分页获取大于 since 的增量数据。has_more 为 true 时以 next_cursor 继续拉取（中断后可用同一游标重试），全部拉取完成后以 server_version 作为下次的 since；已注册设备的请求同时确认之前的版本均已同步
+// @Tags 数据同步
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body IncrementalSyncRequest true "同步参数"
+// @Success 200 {object} Response{data=SyncResponse} "同步成功"
+// @Failure 200 {object} Response "同步失败"
+// @Router /api/v1/sync/todos [post]
+func (s *Server) IncrementalSync(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req IncrementalSyncRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	// 默认分页大小
+	if req.Limit <= 0 || req.Limit > 1000 {
+		req.Limit = 500
+	}
+
+	// 游标记录上一页的位置和本轮同步的版本上限；首页以当前服务器版本作为上限，
+	// 先读取版本再读取数据，期间提交的写入版本号更大，会在下一轮同步中返回
+	serverVersion, err := s.store.GetCurrentSyncVersion(userID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取服务器版本失败"))
+		return
+	}
+	var cursor syncCursor
+	if req.Cursor != "" {
+		if err := decodeCursor(req.Cursor, &cursor); err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "无效的同步游标"))
+			return
+		}
+	} else {
+		cursor = syncCursor{After: req.Since, Until: serverVersion}
+	}
+
+	// 客户端从该位置拉取增量，说明之前的版本均已应用到本地；since 和游标由客户端提供，确认时不超过服务器当前版本，
+	// 否则设备被视为已同步了没有收到的墓碑，回收站清理后这些删除不会再下发
+	if deviceID := c.GetString("deviceID"); deviceID != "" {
+		if err := s.store.AckDeviceSyncVersion(deviceID, userID, min(cursor.After, serverVersion), s.now()); err != nil {
+			s.logger.Printf("Failed to ack sync version for device %s: %v", deviceID, err)
+		}
+	}
+
+	changes, err := repository.GetChangesSince(s.store, userID, cursor.After, cursor.Until, req.Limit)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取增量数据失败"))
+		return
+	}
+	// 转换为同步格式
+	var todoSyncItems []repository.TodoSyncItem
+	for i := range changes.Todos {
+		todoSyncItems = append(todoSyncItems, repository.NewTodoSyncItem(&changes.Todos[i]))
+	}
+
+	var categorySyncItems []repository.CategorySyncItem
+	for i := range changes.Categories {
+		categorySyncItems = append(categorySyncItems, repository.NewCategorySyncItem(&changes.Categories[i]))
+	}
+
+	var checklistSyncItems []repository.ChecklistItemSyncItem
+	for i := range changes.ChecklistItems {
+		checklistSyncItems = append(checklistSyncItems, repository.NewChecklistItemSyncItem(&changes.ChecklistItems[i]))
+	}
+
+	var tagSyncItems []repository.TagSyncItem
+	for i := range changes.Tags {
+		tagSyncItems = append(tagSyncItems, repository.NewTagSyncItem(&changes.Tags[i]))
+	}
+
+	var smartListSyncItems []repository.SmartListSyncItem
+	for i := range changes.SmartLists {
+		smartListSyncItems = append(smartListSyncItems, repository.NewSmartListSyncItem(&changes.SmartLists[i]))
+	}
+
+	var settingsSyncItem *repository.UserSettingsSyncItem
+	if settings := changes.Settings; settings != nil {
+		settingsSyncItem = &repository.UserSettingsSyncItem{
+			Theme:            settings.Theme,
+			NotificationTime: settings.NotificationTime,
+			Language:         settings.Language,
+			TimeZone:         settings.TimeZone,
+			DailyDigest:      &settings.DailyDigest,
+			SyncVersion:      settings.SyncVersion,
+			UpdatedAt:        settings.UpdatedAt.Format(time.RFC3339),
+		}
+	}
+
+	response := SyncResponse{
+		Todos:          todoSyncItems,
+		Categories:     categorySyncItems,
+		ChecklistItems: checklistSyncItems,
+		Tags:           tagSyncItems,
+		SmartLists:     smartListSyncItems,
+		Settings:       settingsSyncItem,
+		ServerVersion:  cursor.Until,
+	}
+	if changes.HasMore {
+		// 不认识游标的旧客户端以 server_version 作为下次的 since 同样可以续传
+		response.ServerVersion = changes.LastVersion
+		response.NextCursor = encodeCursor(syncCursor{After: changes.LastVersion, Until: cursor.Until})
+		response.HasMore = true
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(response))
+}
+
+// SyncStream 推送数据变更
+// @Summary 订阅数据变更推送
+// @Description 以Server-Sent Events推送当前用户的数据变更。连接建立后先发送 version 事件（当前同步版本号），之后每次写入提交时发送 change 事件，事件ID为同步版本号，数据中列出变更的TODO、分类或设置；客户端收到后以 /api/v1/sync/todos 增量拉取。空闲时定期发送注释行保持连接
+// @Tags 数据同步
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Success 200 {object} repository.ChangeEvent "change 事件数据"
+// @Failure 200 {object} Response "订阅失败"
+// @Router /api/v1/sync/stream [get]
+func (s *Server) SyncStream(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	// 先订阅再读取版本号，避免遗漏两者之间提交的写入
+	events, cancel := s.store.SubscribeChanges(userID)
+	defer cancel()
+
+	version, err := s.store.GetCurrentSyncVersion(userID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取同步版本失败"))
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 禁止反向代理缓冲事件
+	c.Render(-1, sse.Event{
+		Id:    strconv.FormatInt(version, 10),
+		Event: "version",
+		Data:  SyncVersionResponse{Version: version},
+	})
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(s.streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event := <-events:
+			c.Render(-1, sse.Event{
+				Id:    strconv.FormatInt(event.SyncVersion, 10),
+				Event: "change",
+				Data:  event,
+			})
+		case <-heartbeat.C:
+			io.WriteString(c.Writer, ": ping\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
+
+// AckSync 确认同步版本
+// @Summary 确认同步版本
+// @Description 客户端应用完增量数据后确认已同步到的版本号，服务器据此记录每台设备的同步进度
+// @Tags 数据同步
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body SyncAckRequest true "确认的版本号"
+// @Success 200 {object} Response{data=map[string]string} "确认成功"
+// @Failure 200 {object} Response "确认失败"
+// @Router /api/v1/sync/ack [post]
+func (s *Server) AckSync(c *gin.Context) {
+	userID := c.GetInt("userID")
+	deviceID := c.GetString("deviceID")
+	var req SyncAckRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+	if deviceID == "" {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "当前会话未注册设备"))
+		return
+	}
+
+	serverVersion, err := s.store.GetCurrentSyncVersion(userID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取服务器版本失败"))
+		return
+	}
+	if req.Version > serverVersion {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "确认的版本号超过服务器当前版本"))
+		return
+	}
+
+	if err := s.store.AckDeviceSyncVersion(deviceID, userID, req.Version, s.now()); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "设备不存在或已撤销"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "确认同步版本失败"))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "同步版本确认成功"}))
 }
 
-// ===== 分类管理API =====
+// errBatchRolledBack atomic 模式下存在未能应用的项，回滚整个批次
+var errBatchRolledBack = errors.New("batch rolled back")
 
-// GetCategories 获取分类列表
-// @Summary 获取用户的分类列表
-// @Description 获取当前用户的所有分类
-// @Tags 分类管理
+// BatchSync 批量同步
+// @Summary 批量同步数据
+// @Description 批量上传客户端数据并处理冲突。TODO修改需携带编辑时的 base_version，服务器数据在此之后被修改过时按 strategy 处理：server_wins（默认）返回冲突、服务器数据和字段级合并建议；client_wins 以客户端数据为准；merge 在没有字段冲突时自动应用三方合并结果。整个批次在同一事务中处理，atomic 为 true 时任一项冲突或失败都会回滚整个批次；新建的TODO、分类和智能列表可携带 idempotency_key，重试时返回首次创建的数据。TODO和分类可使用客户端生成的 uuid 标识，分类先于TODO处理，TODO可通过 category_uuid 引用同一批次中新建的分类
+// @Tags 数据同步
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Success 200 {object} Response{data=[]repository.Category} "获取成功"
+// @Param request body BatchSyncRequest true "批量同步数据"
+// @Success 200 {object} Response{data=BatchSyncResponse} "同步成功"
+// @Failure 200 {object} Response "同步失败"
+// @Router /api/v1/sync/batch [post]
+func (s *Server) BatchSync(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req BatchSyncRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	var allResults []repository.SyncResult
+	var successResults []repository.SyncResult
+	var conflictResults []repository.SyncResult
+	var errorResults []repository.SyncResult
+
+	// 整个批次在同一事务中处理，每项使用独立的保存点；atomic 模式下任一项未能应用时回滚整个批次
+	var failMessage string
+	rolledBack := false
+	err := s.deviceStore(c).WithTx(func(tx repository.Store) error {
+		allResults = nil
+
+		// 处理分类同步，先于TODO处理，TODO可以通过 category_uuid 引用本批次新建的分类
+		if len(req.Categories) > 0 {
+			categoryResults, err := repository.BatchCreateOrUpdateCategories(tx, userID, req.Categories)
+			if err != nil {
+				failMessage = "批量同步分类失败"
+				return err
+			}
+			allResults = append(allResults, categoryResults...)
+		}
+
+		// 处理标签元数据同步
+		if len(req.Tags) > 0 {
+			tagResults, err := repository.BatchCreateOrUpdateTags(tx, userID, req.Tags)
+			if err != nil {
+				failMessage = "批量同步标签失败"
+				return err
+			}
+			allResults = append(allResults, tagResults...)
+		}
+
+		// 处理智能列表同步
+		if len(req.SmartLists) > 0 {
+			smartListResults, err := repository.BatchCreateOrUpdateSmartLists(tx, userID, req.SmartLists)
+			if err != nil {
+				failMessage = "批量同步智能列表失败"
+				return err
+			}
+			allResults = append(allResults, smartListResults...)
+		}
+
+		// 处理TODO同步
+		if len(req.Todos) > 0 {
+			policy := repository.ConflictPolicy{Default: req.Strategy, PerTodo: make(map[int]string)}
+			for _, resolution := range req.Resolutions {
+				policy.PerTodo[resolution.TodoID] = resolution.Strategy
+			}
+			todoResults, err := repository.BatchCreateOrUpdateTodos(tx, userID, req.Todos, policy)
+			if err != nil {
+				failMessage = "批量同步TODO失败"
+				return err
+			}
+			allResults = append(allResults, todoResults...)
+		}
+
+		// 处理检查项同步，在TODO之后处理，检查项可以通过 todo_uuid 引用本批次新建的TODO
+		if len(req.ChecklistItems) > 0 {
+			checklistResults, err := repository.BatchCreateOrUpdateChecklistItems(tx, userID, req.ChecklistItems)
+			if err != nil {
+				failMessage = "批量同步检查项失败"
+				return err
+			}
+			allResults = append(allResults, checklistResults...)
+		}
+
+		// 处理用户设置同步
+		if req.Settings != nil {
+			settingsResult, err := repository.BatchUpdateUserSettings(tx, userID, req.Settings)
+			if err != nil {
+				failMessage = "批量同步用户设置失败"
+				return err
+			}
+			allResults = append(allResults, *settingsResult)
+		}
+
+		if req.Atomic {
+			for _, result := range allResults {
+				if result.Action == "conflict" || result.Action == "error" {
+					return errBatchRolledBack
+				}
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errBatchRolledBack) {
+		rolledBack = true
+	} else if err != nil {
+		if failMessage == "" {
+			failMessage = "批量同步失败"
+		}
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, failMessage))
+		return
+	}
+
+	// 分类结果，批次回滚时没有任何写入生效
+	for _, result := range allResults {
+		switch result.Action {
+		case "created", "updated", "deleted", "merged":
+			if !rolledBack {
+				successResults = append(successResults, result)
+			}
+		case "conflict":
+			conflictResults = append(conflictResults, result)
+		case "error":
+			errorResults = append(errorResults, result)
+		}
+	}
+
+	response := BatchSyncResponse{
+		Success:    successResults,
+		Conflicts:  conflictResults,
+		Errors:     errorResults,
+		RolledBack: rolledBack,
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(response))
+}
+
+// ===== 设备管理API =====
+
+// RegisterDevice 注册设备
+// @Summary 注册当前设备
+// @Description 将当前登录会话注册为设备（已注册时更新名称和平台），返回携带设备ID的新访问令牌
+// @Tags 设备管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param device body DeviceRequest true "设备信息"
+// @Success 200 {object} Response{data=DeviceRegisterResponse} "注册成功"
+// @Failure 200 {object} Response "注册失败"
+// @Router /api/v1/devices/register [post]
+func (s *Server) RegisterDevice(c *gin.Context) {
+	userID := c.GetInt("userID")
+	sessionID := c.GetString("sessionID")
+	var req DeviceRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	device, err := s.registerDevice(userID, sessionID, &req)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "注册设备失败"))
+		return
+	}
+
+	user := &repository.User{ID: userID, Username: c.GetString("username")}
+	token, err := s.jwt.Sign(user, sessionID, device.ID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "生成token失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(DeviceRegisterResponse{
+		Device:    device,
+		Token:     token,
+		ExpiresIn: int64(s.jwt.ttl / time.Second),
+	}))
+}
+
+// GetDevices 获取设备列表
+// @Summary 获取设备列表
+// @Description 获取当前用户的全部设备（包含已撤销的设备）及每台设备的最后同步时间
+// @Tags 设备管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} Response{data=DeviceListResponse} "获取成功"
 // @Failure 200 {object} Response "获取失败"
-// @Router /api/v1/categories [post]
-func GetCategories(c *gin.Context) {
+// @Router /api/v1/devices [post]
+func (s *Server) GetDevices(c *gin.Context) {
 	userID := c.GetInt("userID")
 
-	repo := repository.NewCategoryRepository()
-	categories, err := repo.GetCategoriesByUserID(userID)
+	devices, err := s.store.GetDevicesByUserID(userID)
 	if err != nil {
-		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取分类列表失败"))
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取设备列表失败"))
 		return
 	}
+	if devices == nil {
+		devices = []repository.Device{}
+	}
 
-	c.JSON(http.StatusOK, SuccessResponse(categories))
+	c.JSON(http.StatusOK, SuccessResponse(DeviceListResponse{
+		Devices:         devices,
+		CurrentDeviceID: c.GetString("deviceID"),
+	}))
 }
 
-// CreateCategory 创建分类
-// @Summary 创建新分类
-// @Description 为当前用户创建一个新的分类
-// @Tags 分类管理
+// RenameDevice 重命名设备
+// @Summary 重命名设备
+// @Description 修改指定设备的显示名称
+// @Tags 设备管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param device body RenameDeviceRequest true "设备信息"
+// @Success 200 {object} Response{data=repository.Device} "重命名成功"
+// @Failure 200 {object} Response "重命名失败"
+// @Router /api/v1/devices/rename [post]
+func (s *Server) RenameDevice(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req RenameDeviceRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	device, err := s.store.GetDeviceByID(req.ID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "设备不存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取设备失败"))
+		}
+		return
+	}
+
+	device.Name = req.Name
+	if err := s.store.UpdateDevice(device); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "重命名设备失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(device))
+}
+
+// RevokeDevice 撤销设备
+// @Summary 撤销设备
+// @Description 撤销指定设备（如丢失的手表），该设备的访问令牌和刷新令牌立即失效，且不再参与同步进度统计
+// @Tags 设备管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param device body RevokeDeviceRequest true "设备ID"
+// @Success 200 {object} Response{data=map[string]string} "撤销成功"
+// @Failure 200 {object} Response "撤销失败"
+// @Router /api/v1/devices/revoke [post]
+func (s *Server) RevokeDevice(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req RevokeDeviceRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+
+	device, err := s.store.GetDeviceByID(req.ID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "设备不存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取设备失败"))
+		}
+		return
+	}
+
+	if err := s.revokeDevice(device); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "撤销设备失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "设备已撤销"}))
+}
+
+// ===== Webhook API =====
+
+// newWebhookSecret 生成随机的Webhook签名密钥
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// validateWebhook 检查Webhook地址和订阅的事件类型，返回错误说明；除非允许内网地址，地址不能指向本机或内网IP
+func validateWebhook(rawURL string, events []string, allowPrivate bool) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "Webhook地址必须是http或https地址"
+	}
+	if !allowPrivate && notify.PrivateHost(u.Hostname()) {
+		return "Webhook地址不能指向本机或内网地址"
+	}
+	for _, event := range events {
+		if !validWebhookEvent(event) {
+			return "不支持的事件类型: " + event
+		}
+	}
+	return ""
+}
+
+// validWebhookEvent 事件类型是否为已知类型、*，或已知类型前缀加 .* 的通配
+func validWebhookEvent(event string) bool {
+	if event == "*" {
+		return true
+	}
+	prefix, wildcard := strings.CutSuffix(event, ".*")
+	for _, known := range repository.WebhookEventTypes {
+		if known == event || (wildcard && strings.HasPrefix(known, prefix+".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// findWebhook 获取当前用户登记的Webhook
+func (s *Server) findWebhook(userID, id int) (*repository.WebhookEndpoint, error) {
+	endpoint, err := s.store.GetWebhookEndpoint(id)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.UserID != userID {
+		return nil, repository.ErrNotFound
+	}
+	return endpoint, nil
+}
+
+// GetWebhooks 获取Webhook列表
+// @Summary 获取Webhook列表
+// @Description 获取当前用户登记的全部Webhook及其启用状态和连续失败次数，不返回签名密钥
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} Response{data=[]repository.WebhookEndpoint} "获取成功"
+// @Failure 200 {object} Response "获取失败"
+// @Router /api/v1/webhooks [post]
+func (s *Server) GetWebhooks(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	endpoints, err := s.store.GetWebhookEndpoints(userID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取Webhook列表失败"))
+		return
+	}
+	if endpoints == nil {
+		endpoints = []repository.WebhookEndpoint{}
+	}
+	for i := range endpoints {
+		endpoints[i].Secret = ""
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(endpoints))
+}
+
+// CreateWebhook 登记Webhook
+// @Summary 登记Webhook
+// @Description 登记接收TODO、分类和用户设置变更事件的Webhook。事件以JSON POST发送，请求头 X-Webhook-Signature 为 t=<时间戳>,v1=<签名>，签名是以密钥对 "<时间戳>.<请求体>" 计算的HMAC-SHA256（十六进制）。签名密钥只在本次响应中返回
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param webhook body CreateWebhookRequest true "Webhook信息"
+// @Success 200 {object} Response{data=repository.WebhookEndpoint} "登记成功"
+// @Failure 200 {object} Response "登记失败"
+// @Router /api/v1/webhooks/create [post]
+func (s *Server) CreateWebhook(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req CreateWebhookRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+	if msg := validateWebhook(req.URL, req.Events, s.privateWebhooks); msg != "" {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, msg))
+		return
+	}
+	if req.AllUsers && !s.admins[c.GetString("username")] {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "只有管理员可以接收全部用户的事件"))
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "生成签名密钥失败"))
+		return
+	}
+	endpoint := &repository.WebhookEndpoint{
+		UserID:   userID,
+		URL:      req.URL,
+		Secret:   secret,
+		Events:   req.Events,
+		AllUsers: req.AllUsers,
+		Enabled:  true,
+	}
+	if err := s.store.CreateWebhookEndpoint(endpoint); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "登记Webhook失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(endpoint))
+}
+
+// UpdateWebhook 修改Webhook
+// @Summary 修改Webhook
+// @Description 修改Webhook的地址、订阅的事件和启用状态，可同时重新生成签名密钥（新密钥只在本次响应中返回）。重新启用被自动停用的Webhook时连续失败次数清零，停用期间的投递记录不会补发，可通过重放接口重新发送
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param webhook body UpdateWebhookRequest true "Webhook信息"
+// @Success 200 {object} Response{data=repository.WebhookEndpoint} "修改成功"
+// @Failure 200 {object} Response "修改失败"
+// @Router /api/v1/webhooks/update [post]
+func (s *Server) UpdateWebhook(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req UpdateWebhookRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
+	}
+	if msg := validateWebhook(req.URL, req.Events, s.privateWebhooks); msg != "" {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, msg))
+		return
+	}
+	if req.AllUsers && !s.admins[c.GetString("username")] {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "只有管理员可以接收全部用户的事件"))
+		return
+	}
+
+	endpoint, err := s.findWebhook(userID, req.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "Webhook不存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取Webhook失败"))
+		}
+		return
+	}
+
+	endpoint.URL = req.URL
+	endpoint.Events = req.Events
+	endpoint.AllUsers = req.AllUsers
+	if req.Enabled != nil {
+		endpoint.Enabled = *req.Enabled
+	}
+	if req.RotateSecret {
+		if endpoint.Secret, err = newWebhookSecret(); err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "生成签名密钥失败"))
+			return
+		}
+	}
+	if err := s.store.UpdateWebhookEndpoint(endpoint); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "Webhook不存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "修改Webhook失败"))
+		}
+		return
+	}
+	if !req.RotateSecret {
+		endpoint.Secret = ""
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(endpoint))
+}
+
+// DeleteWebhook 删除Webhook
+// @Summary 删除Webhook
+// @Description 删除Webhook及其投递记录，尚未发送的事件不再发送
+// @Tags Webhook
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param category body CategoryRequest true "分类信息"
-// @Success 200 {object} Response{data=repository.Category} "创建成功"
-// @Failure 200 {object} Response "创建失败"
-// @Router /api/v1/categories/create [post]
-func CreateCategory(c *gin.Context) {
+// @Param webhook body DeleteWebhookRequest true "Webhook ID"
+// @Success 200 {object} Response{data=map[string]string} "删除成功"
+// @Failure 200 {object} Response "删除失败"
+// @Router /api/v1/webhooks/delete [post]
+func (s *Server) DeleteWebhook(c *gin.Context) {
 	userID := c.GetInt("userID")
-	var req CategoryRequest
+	var req DeleteWebhookRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
 		return
 	}
 
-	// 设置默认值
-	if req.Color == "" {
-		req.Color = "#2196F3"
-	}
-	if req.Icon == "" {
-		req.Icon = "folder"
-	}
-
-	category := &repository.Category{
-		UserID: userID,
-		Name:   req.Name,
-		Color:  req.Color,
-		Icon:   req.Icon,
-	}
-
-	repo := repository.NewCategoryRepository()
-	if err := repo.CreateCategory(category); err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint") || strings.Contains(err.Error(), "duplicate key") {
-			c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "分类名称已存在"))
+	if err := s.store.DeleteWebhookEndpoint(req.ID, userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "Webhook不存在"))
 		} else {
-			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "创建分类失败"))
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "删除Webhook失败"))
 		}
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse(category))
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "Webhook已删除"}))
 }
 
-// UpdateCategory 更新分类
-// @Summary 更新分类
-// @Description 更新指定的分类信息
-// @Tags 分类管理
+// GetWebhookDeliveries 获取Webhook投递记录
+// @Summary 获取Webhook投递记录
+// @Description 获取Webhook的投递记录，按时间从新到旧排序。状态为 pending（等待发送或重试）、sending、sent、failed（重试次数用尽）或 cancelled（发送前Webhook已停用或不再订阅该事件）
+// @Tags Webhook
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param category body UpdateCategoryRequest true "更新信息"
-// @Success 200 {object} Response{data=map[string]string} "更新成功"
-// @Failure 200 {object} Response "更新失败"
-// @Router /api/v1/categories/update [post]
-func UpdateCategory(c *gin.Context) {
+// @Param request body WebhookDeliveriesRequest true "Webhook ID"
+// @Success 200 {object} Response{data=[]repository.WebhookDelivery} "获取成功"
+// @Failure 200 {object} Response "获取失败"
+// @Router /api/v1/webhooks/deliveries [post]
+func (s *Server) GetWebhookDeliveries(c *gin.Context) {
 	userID := c.GetInt("userID")
-	var req UpdateCategoryRequest
+	var req WebhookDeliveriesRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
 		return
 	}
-
-	category := &repository.Category{
-		ID:     req.ID,
-		UserID: userID,
-		Name:   req.Name,
-		Color:  req.Color,
-		Icon:   req.Icon,
+	if req.Limit <= 0 || req.Limit > 500 {
+		req.Limit = 50
 	}
 
-	repo := repository.NewCategoryRepository()
-	if err := repo.UpdateCategory(category); err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint") || strings.Contains(err.Error(), "duplicate key") {
-			c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "分类名称已存在"))
+	if _, err := s.findWebhook(userID, req.ID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "Webhook不存在"))
 		} else {
-			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "更新分类失败"))
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取Webhook失败"))
 		}
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "分类更新成功"}))
+	deliveries, err := s.store.GetWebhookDeliveries(req.ID, req.Limit)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取投递记录失败"))
+		return
+	}
+	if deliveries == nil {
+		deliveries = []repository.WebhookDelivery{}
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(deliveries))
 }
 
-// DeleteCategory 删除分类
-// @Summary 删除分类
-// @Description 删除指定的分类（软删除）
-// @Tags 分类管理
+// ReplayWebhookDelivery 重放Webhook投递记录
+// @Summary 重放Webhook投递记录
+// @Description 为投递记录对应的事件生成新的投递记录并尽快发送，事件内容与原投递相同，X-Webhook-Delivery 为新的投递记录ID。Webhook已停用时不能重放
+// @Tags Webhook
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param category body DeleteCategoryRequest true "删除信息"
-// @Success 200 {object} Response{data=map[string]string} "删除成功"
-// @Failure 200 {object} Response "删除失败"
-// @Router /api/v1/categories/delete [post]
-func DeleteCategory(c *gin.Context) {
+// @Param request body ReplayWebhookRequest true "投递记录信息"
+// @Success 200 {object} Response{data=repository.WebhookDelivery} "重放成功"
+// @Failure 200 {object} Response "重放失败"
+// @Router /api/v1/webhooks/replay [post]
+func (s *Server) ReplayWebhookDelivery(c *gin.Context) {
 	userID := c.GetInt("userID")
-	var req DeleteCategoryRequest
+	var req ReplayWebhookRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
 		return
 	}
 
-	repo := repository.NewCategoryRepository()
-	if err := repo.DeleteCategory(req.ID, userID); err != nil {
-		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "删除分类失败"))
+	endpoint, err := s.findWebhook(userID, req.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "Webhook不存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取Webhook失败"))
+		}
+		return
+	}
+	if !endpoint.Enabled {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "Webhook已停用，请先重新启用"))
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "分类删除成功"}))
+	delivery, err := s.store.ReplayWebhookDelivery(req.ID, req.DeliveryID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "投递记录不存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "重放投递记录失败"))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(delivery))
 }
 
-// ===== 用户设置API =====
+// ===== 日历订阅API =====
 
-// GetUserSettings 获取用户设置
-// @Summary 获取用户设置
-// @Description 获取当前用户的个性化设置
-// @Tags 用户设置
+// calendarFeedPath 公开的iCalendar订阅地址前缀，后接订阅令牌和 .ics 后缀
+const calendarFeedPath = "/api/calendar/"
+
+// calendarFeedLimit 订阅中最多包含的TODO数量，按截止时间从晚到早选取
+const calendarFeedLimit = 1000
+
+// calendarFeedRefresh 建议日历客户端刷新订阅的间隔
+const calendarFeedRefresh = 15 * time.Minute
+
+// calendarFeedURL 根据当前请求的地址生成订阅地址
+func calendarFeedURL(c *gin.Context, token string) string {
+	return requestOrigin(c) + calendarFeedPath + token + ".ics"
+}
+
+// requestOrigin 当前请求的协议和主机，经反向代理时使用 X-Forwarded-Proto 和 X-Forwarded-Host
+func requestOrigin(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	host := c.Request.Host
+	if forwarded := c.GetHeader("X-Forwarded-Host"); forwarded != "" {
+		host = forwarded
+	}
+	return scheme + "://" + host
+}
+
+// findCalendarFeed 获取当前用户的日历订阅，返回错误时已写入响应
+func (s *Server) findCalendarFeed(c *gin.Context, userID, id int) (*repository.CalendarFeed, bool) {
+	feed, err := s.store.GetCalendarFeedByID(id, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "日历订阅不存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取日历订阅失败"))
+		}
+		return nil, false
+	}
+	return feed, true
+}
+
+// GetCalendarFeeds 获取日历订阅列表
+// @Summary 获取日历订阅列表
+// @Description 获取当前用户的全部日历订阅及最近一次被日历客户端读取的时间，不返回订阅令牌
+// @Tags 日历订阅
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Success 200 {object} Response{data=repository.UserSettings} "获取成功"
+// @Success 200 {object} Response{data=[]repository.CalendarFeed} "获取成功"
 // @Failure 200 {object} Response "获取失败"
-// @Router /api/v1/settings [post]
-func GetUserSettings(c *gin.Context) {
+// @Router /api/v1/calendar/feeds [post]
+func (s *Server) GetCalendarFeeds(c *gin.Context) {
 	userID := c.GetInt("userID")
 
-	repo := repository.NewUserSettingsRepository()
-	settings, err := repo.GetUserSettings(userID)
+	feeds, err := s.store.GetCalendarFeeds(userID)
 	if err != nil {
-		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取用户设置失败"))
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取日历订阅列表失败"))
 		return
 	}
+	if feeds == nil {
+		feeds = []repository.CalendarFeed{}
+	}
 
-	c.JSON(http.StatusOK, SuccessResponse(settings))
+	c.JSON(http.StatusOK, SuccessResponse(feeds))
 }
 
-// UpdateUserSettings 更新用户设置
-// @Summary 更新用户设置
-// @Description 更新当前用户的个性化设置
-// @Tags 用户设置
+// CreateCalendarFeed 创建日历订阅
+// @Summary 创建日历订阅
+// @Description 生成带密钥令牌的iCalendar订阅地址，可限定为一个分类。订阅包含设置了截止时间的TODO，Apple日历、Thunderbird等客户端显示为待办（VTODO）；在地址后加 ?type=event 时输出为截止时间的事件（VEVENT），供不显示订阅待办的Outlook、Google日历使用。令牌和订阅地址只在本次响应中返回
+// @Tags 日历订阅
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param settings body UserSettingsRequest true "设置信息"
-// @Success 200 {object} Response{data=map[string]string} "更新成功"
-// @Failure 200 {object} Response "更新失败"
-// @Router /api/v1/settings/update [post]
-func UpdateUserSettings(c *gin.Context) {
+// @Param feed body CreateCalendarFeedRequest true "日历订阅信息"
+// @Success 200 {object} Response{data=CalendarFeedResponse} "创建成功"
+// @Failure 200 {object} Response "创建失败"
+// @Router /api/v1/calendar/feeds/create [post]
+func (s *Server) CreateCalendarFeed(c *gin.Context) {
 	userID := c.GetInt("userID")
-	var req UserSettingsRequest
+	var req CreateCalendarFeedRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
 		return
 	}
 
-	// 验证主题设置
-	if req.Theme != "" && req.Theme != "light" && req.Theme != "dark" && req.Theme != "auto" {
-		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "无效的主题设置"))
-		return
+	feed := &repository.CalendarFeed{UserID: userID, Name: req.Name}
+	if req.CategoryUUID != "" || req.CategoryID != nil {
+		var id int
+		if req.CategoryUUID == "" {
+			id = *req.CategoryID
+		}
+		category, err := s.findCategory(userID, id, req.CategoryUUID)
+		if err != nil {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "分类不存在"))
+			return
+		}
+		feed.CategoryID = &category.ID
+		feed.CategoryUUID = &category.UUID
+		if feed.Name == "" {
+			feed.Name = category.Name
+		}
 	}
 
-	settings := &repository.UserSettings{
-		UserID:           userID,
-		Theme:            req.Theme,
-		NotificationTime: req.NotificationTime,
-		Language:         req.Language,
-		TimeZone:         req.TimeZone,
+	// 订阅令牌与刷新令牌的生成方式相同，只保存哈希
+	token, hash, err := newRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "生成订阅令牌失败"))
+		return
 	}
-
-	repo := repository.NewUserSettingsRepository()
-	if err := repo.UpdateUserSettings(settings); err != nil {
-		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "更新用户设置失败"))
+	feed.TokenHash = hash
+	if err := s.store.CreateCalendarFeed(feed); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "创建日历订阅失败"))
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "用户设置更新成功"}))
+	c.JSON(http.StatusOK, SuccessResponse(CalendarFeedResponse{Feed: feed, Token: token, URL: calendarFeedURL(c, token)}))
 }
 
-// ===== 数据同步API =====
-
-// GetSyncVersion 获取同步版本
-// @Summary 获取当前同步版本号
-// @Description 获取服务器当前的同步版本号，用于增量同步
-// @Tags 数据同步
+// RotateCalendarFeed 重新生成日历订阅令牌
+// @Summary 重新生成日历订阅令牌
+// @Description 为日历订阅生成新的令牌，旧的订阅地址立即失效，已订阅的日历客户端需要改用新地址。新令牌和订阅地址只在本次响应中返回
+// @Tags 日历订阅
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Success 200 {object} Response{data=SyncVersionResponse} "获取成功"
-// @Failure 200 {object} Response "获取失败"
-// @Router /api/v1/sync/version [post]
-func GetSyncVersion(c *gin.Context) {
+// @Param feed body RotateCalendarFeedRequest true "日历订阅ID"
+// @Success 200 {object} Response{data=CalendarFeedResponse} "重新生成成功"
+// @Failure 200 {object} Response "重新生成失败"
+// @Router /api/v1/calendar/feeds/rotate [post]
+func (s *Server) RotateCalendarFeed(c *gin.Context) {
 	userID := c.GetInt("userID")
+	var req RotateCalendarFeedRequest
 
-	version, err := repository.GetCurrentSyncVersion(global.Db, userID)
-	if err != nil {
-		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取同步版本失败"))
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
 		return
 	}
 
-	response := SyncVersionResponse{
-		Version: version,
+	feed, ok := s.findCalendarFeed(c, userID, req.ID)
+	if !ok {
+		return
+	}
+	token, hash, err := newRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "生成订阅令牌失败"))
+		return
+	}
+	feed.TokenHash = hash
+	if err := s.store.UpdateCalendarFeed(feed); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "日历订阅不存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "重新生成订阅令牌失败"))
+		}
+		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse(response))
+	c.JSON(http.StatusOK, SuccessResponse(CalendarFeedResponse{Feed: feed, Token: token, URL: calendarFeedURL(c, token)}))
 }
 
-// IncrementalSync 增量同步
-// @Summary 增量同步数据
-// @Description 基于时间戳获取增量更新的数据
-// @Tags 数据同步
+// DeleteCalendarFeed 删除日历订阅
+// @Summary 删除日历订阅
+// @Description 删除日历订阅，订阅地址立即失效
+// @Tags 日历订阅
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param request body IncrementalSyncRequest true "同步参数"
-// @Success 200 {object} Response{data=SyncResponse} "同步成功"
-// @Failure 200 {object} Response "同步失败"
-// @Router /api/v1/sync/todos [post]
-func IncrementalSync(c *gin.Context) {
+// @Param feed body DeleteCalendarFeedRequest true "日历订阅ID"
+// @Success 200 {object} Response{data=map[string]string} "删除成功"
+// @Failure 200 {object} Response "删除失败"
+// @Router /api/v1/calendar/feeds/delete [post]
+func (s *Server) DeleteCalendarFeed(c *gin.Context) {
 	userID := c.GetInt("userID")
-	var req IncrementalSyncRequest
+	var req DeleteCalendarFeedRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
 		return
 	}
 
-	// 获取增量TODO数据
-	todoRepo := repository.NewExtendedTodoRepository()
-	todos, err := todoRepo.GetTodosSince(userID, req.Since)
-	if err != nil {
-		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取TODO增量数据失败"))
+	if err := s.store.DeleteCalendarFeed(req.ID, userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "日历订阅不存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "删除日历订阅失败"))
+		}
 		return
 	}
 
-	// 获取增量分类数据
-	categoryRepo := repository.NewCategoryRepository()
-	categories, err := categoryRepo.GetCategoriesSince(userID, req.Since)
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "日历订阅已删除"}))
+}
+
+// CalendarFeed 输出iCalendar订阅
+// @Summary 读取iCalendar订阅
+// @Description 供日历客户端订阅的公开地址，以地址中的令牌认证。返回RFC 5545格式的日历：设置了截止时间的TODO为 VTODO（DUE为截止时间，提醒为 VALARM，包含优先级、分类与标签、完成状态和重复规则），type=event 时为在截止时间发生的 VEVENT。响应带 ETag，内容未变化时对 If-None-Match 返回304。令牌无效或已被重新生成、删除时返回404
+// @Tags 日历订阅
+// @Produce text/calendar
+// @Param token path string true "订阅令牌，可带 .ics 后缀"
+// @Param type query string false "输出类型：todo（默认）或 event"
+// @Success 200 {string} string "iCalendar数据"
+// @Failure 404 {string} string "订阅不存在"
+// @Router /api/calendar/{token} [get]
+func (s *Server) CalendarFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+	feed, err := s.store.GetCalendarFeedByTokenHash(hashRefreshToken(token))
 	if err != nil {
-		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取分类增量数据失败"))
+		if errors.Is(err, repository.ErrNotFound) {
+			c.String(http.StatusNotFound, "calendar feed not found")
+		} else {
+			c.String(http.StatusInternalServerError, "failed to load calendar feed")
+		}
 		return
 	}
 
-	// 获取增量用户设置数据
-	settingsRepo := repository.NewUserSettingsRepository()
-	settings, err := settingsRepo.GetUserSettingsSince(userID, req.Since)
+	hasDueDate := true
+	query := repository.TodoQuery{
+		Filter: repository.TodoFilter{HasDueDate: &hasDueDate},
+		Sort:   []repository.TodoSort{{Field: repository.SortDueDate, Desc: true}},
+		Limit:  calendarFeedLimit,
+	}
+	if feed.CategoryID != nil {
+		query.Filter.CategoryIDs = []int{*feed.CategoryID}
+	}
+	todos, err := s.store.ListTodos(feed.UserID, query)
 	if err != nil {
-		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取用户设置增量数据失败"))
+		c.String(http.StatusInternalServerError, "failed to load todos")
 		return
 	}
-
-	// 获取当前服务器版本
-	serverVersion, err := repository.GetCurrentSyncVersion(global.Db, userID)
+	categories, err := s.store.GetCategoriesByUserID(feed.UserID)
 	if err != nil {
-		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取服务器版本失败"))
+		c.String(http.StatusInternalServerError, "failed to load categories")
 		return
 	}
+	names := make(map[int]string, len(categories))
+	for _, category := range categories {
+		names[category.ID] = category.Name
+	}
 
-	// 转换为同步格式
-	var todoSyncItems []repository.TodoSyncItem
-	for _, todo := range todos {
-		item := repository.TodoSyncItem{
-			ID:          todo.ID,
-			Title:       todo.Title,
-			Description: todo.Description,
-			Completed:   todo.Completed,
-			Priority:    int(todo.Priority),
-			Tags:        []string(todo.Tags),
-			CategoryID:  todo.CategoryID,
-			IsDeleted:   todo.IsDeleted,
-			SyncVersion: todo.SyncVersion,
-			UpdatedAt:   todo.UpdatedAt.Format(time.RFC3339),
-		}
-		if todo.DueDate != nil {
-			dueDateStr := todo.DueDate.Format(time.RFC3339)
-			item.DueDate = &dueDateStr
-		}
-		if todo.Reminder != nil {
-			reminderStr := todo.Reminder.Format(time.RFC3339)
-			item.Reminder = &reminderStr
-		}
-		todoSyncItems = append(todoSyncItems, item)
+	cal := &ical.Calendar{
+		Name:            feed.Name,
+		Method:          "PUBLISH",
+		RefreshInterval: calendarFeedRefresh,
+		Todos:           todos,
+		Categories:      names,
 	}
+	if cal.Name == "" {
+		cal.Name = "TODO"
+	}
+	if c.Query("type") == "event" {
+		cal.Component = ical.ComponentEvent
+	}
+	body := ical.Encode(cal)
 
-	var categorySyncItems []repository.CategorySyncItem
-	for _, category := range categories {
-		item := repository.CategorySyncItem{
-			ID:          category.ID,
-			Name:        category.Name,
-			Color:       category.Color,
-			Icon:        category.Icon,
-			IsDeleted:   category.IsDeleted,
-			SyncVersion: category.SyncVersion,
-			UpdatedAt:   category.UpdatedAt.Format(time.RFC3339),
-		}
-		categorySyncItems = append(categorySyncItems, item)
+	if err := s.store.TouchCalendarFeed(feed.ID, s.now()); err != nil {
+		s.logger.Printf("Failed to record access to calendar feed %d: %v", feed.ID, err)
 	}
 
-	var settingsSyncItem *repository.UserSettingsSyncItem
-	if settings != nil {
-		settingsSyncItem = &repository.UserSettingsSyncItem{
-			Theme:            settings.Theme,
-			NotificationTime: settings.NotificationTime,
-			Language:         settings.Language,
-			TimeZone:         settings.TimeZone,
-			SyncVersion:      settings.SyncVersion,
-			UpdatedAt:        settings.UpdatedAt.Format(time.RFC3339),
-		}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, max-age=300")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
 	}
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", body)
+}
 
-	response := SyncResponse{
-		Todos:         todoSyncItems,
-		Categories:    categorySyncItems,
-		Settings:      settingsSyncItem,
-		ServerVersion: serverVersion,
+// ===== CalDAV应用专用密码API =====
+
+// GetAppPasswords 获取应用专用密码列表
+// @Summary 获取应用专用密码列表
+// @Description 获取当前用户的全部CalDAV应用专用密码及最近一次使用的时间，不返回密码
+// @Tags CalDAV
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} Response{data=[]repository.AppPassword} "获取成功"
+// @Failure 200 {object} Response "获取失败"
+// @Router /api/v1/caldav/passwords [post]
+func (s *Server) GetAppPasswords(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	passwords, err := s.store.GetAppPasswords(userID)
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "获取应用专用密码列表失败"))
+		return
+	}
+	if passwords == nil {
+		passwords = []repository.AppPassword{}
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse(response))
+	c.JSON(http.StatusOK, SuccessResponse(passwords))
 }
 
-// BatchSync 批量同步
-// @Summary 批量同步数据
-// @Description 批量上传客户端数据并处理冲突
-// @Tags 数据同步
+// CreateAppPassword 创建应用专用密码
+// @Summary 创建应用专用密码
+// @Description 为一个CalDAV客户端生成应用专用密码，客户端以用户名和该密码通过HTTP基本认证访问CalDAV，账户密码不能用于CalDAV。密码只在本次响应中返回
+// @Tags CalDAV
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param request body BatchSyncRequest true "批量同步数据"
-// @Success 200 {object} Response{data=BatchSyncResponse} "同步成功"
-// @Failure 200 {object} Response "同步失败"
-// @Router /api/v1/sync/batch [post]
-func BatchSync(c *gin.Context) {
+// @Param password body CreateAppPasswordRequest true "应用专用密码信息"
+// @Success 200 {object} Response{data=AppPasswordResponse} "创建成功"
+// @Failure 200 {object} Response "创建失败"
+// @Router /api/v1/caldav/passwords/create [post]
+func (s *Server) CreateAppPassword(c *gin.Context) {
 	userID := c.GetInt("userID")
-	var req BatchSyncRequest
+	var req CreateAppPasswordRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
 		return
 	}
 
-	var allResults []repository.SyncResult
-	var successResults []repository.SyncResult
-	var conflictResults []repository.SyncResult
-	var errorResults []repository.SyncResult
-
-	// 处理TODO同步
-	if len(req.Todos) > 0 {
-		todoRepo := repository.NewExtendedTodoRepository()
-		todoResults, err := todoRepo.BatchCreateOrUpdateTodos(userID, req.Todos)
-		if err != nil {
-			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "批量同步TODO失败"))
-			return
-		}
-		allResults = append(allResults, todoResults...)
+	// 密码与刷新令牌的生成方式相同，熵足够高，只保存哈希
+	password, hash, err := newRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "生成应用专用密码失败"))
+		return
 	}
-
-	// 处理分类同步
-	if len(req.Categories) > 0 {
-		categoryRepo := repository.NewCategoryRepository()
-		categoryResults, err := categoryRepo.BatchCreateOrUpdateCategories(userID, req.Categories)
-		if err != nil {
-			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "批量同步分类失败"))
-			return
-		}
-		allResults = append(allResults, categoryResults...)
+	appPassword := &repository.AppPassword{UserID: userID, Name: req.Name, PasswordHash: hash}
+	if err := s.store.CreateAppPassword(appPassword); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "创建应用专用密码失败"))
+		return
 	}
 
-	// 处理用户设置同步
-	if req.Settings != nil {
-		settingsRepo := repository.NewUserSettingsRepository()
-		settingsResult, err := settingsRepo.BatchUpdateUserSettings(userID, req.Settings)
-		if err != nil {
-			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "批量同步用户设置失败"))
-			return
-		}
-		allResults = append(allResults, *settingsResult)
-	}
+	c.JSON(http.StatusOK, SuccessResponse(AppPasswordResponse{
+		AppPassword: appPassword,
+		Password:    password,
+		Username:    c.GetString("username"),
+		URL:         requestOrigin(c) + caldavPath,
+	}))
+}
 
-	// 分类结果
-	for _, result := range allResults {
-		switch result.Action {
-		case "created", "updated", "deleted":
-			successResults = append(successResults, result)
-		case "conflict":
-			conflictResults = append(conflictResults, result)
-		case "error":
-			errorResults = append(errorResults, result)
-		}
+// DeleteAppPassword 删除应用专用密码
+// @Summary 删除应用专用密码
+// @Description 删除应用专用密码，使用该密码的CalDAV客户端立即无法访问
+// @Tags CalDAV
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param password body DeleteAppPasswordRequest true "应用专用密码ID"
+// @Success 200 {object} Response{data=map[string]string} "删除成功"
+// @Failure 200 {object} Response "删除失败"
+// @Router /api/v1/caldav/passwords/delete [post]
+func (s *Server) DeleteAppPassword(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req DeleteAppPasswordRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, ErrorResponse(CodeInvalidParams, "参数错误: "+err.Error()))
+		return
 	}
 
-	response := BatchSyncResponse{
-		Success:   successResults,
-		Conflicts: conflictResults,
-		Errors:    errorResults,
+	if err := s.store.DeleteAppPassword(req.ID, userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusOK, ErrorResponse(CodeNotFound, "应用专用密码不存在"))
+		} else {
+			c.JSON(http.StatusOK, ErrorResponse(CodeInternalError, "删除应用专用密码失败"))
+		}
+		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse(response))
+	c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "应用专用密码已删除"}))
 }
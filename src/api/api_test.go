@@ -0,0 +1,1820 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"todo-service/src/notify"
+	"todo-service/src/repository"
+
+	"github.com/google/uuid"
+)
+
+// testClient 基于内存存储的测试客户端
+type testClient struct {
+	t       *testing.T
+	server  *Server
+	handler http.Handler
+
+	token        string
+	refreshToken string
+}
+
+func newTestClient(t *testing.T, opts ...Option) *testClient {
+	t.Helper()
+	return newTestClientWithStore(t, repository.NewMemoryStore(), opts...)
+}
+
+func newTestClientWithStore(t *testing.T, store repository.Store, opts ...Option) *testClient {
+	t.Helper()
+	opts = append([]Option{WithLogger(log.New(io.Discard, "", 0))}, opts...)
+	server := NewServer(store, []byte("test-secret"), opts...)
+	return &testClient{t: t, server: server, handler: server.Handler()}
+}
+
+// post 发送POST请求并解析统一响应，data 非空时将响应数据解析到其中
+func (tc *testClient) post(path string, body any, data any) Response {
+	tc.t.Helper()
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		tc.t.Fatalf("marshal request: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if tc.token != "" {
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+	}
+
+	rec := httptest.NewRecorder()
+	tc.handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		tc.t.Fatalf("POST %s status = %d", path, rec.Code)
+	}
+
+	var resp struct {
+		Response
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		tc.t.Fatalf("unmarshal response: %v", err)
+	}
+	if data != nil && len(resp.Data) > 0 {
+		if err := json.Unmarshal(resp.Data, data); err != nil {
+			tc.t.Fatalf("unmarshal response data: %v", err)
+		}
+	}
+	return resp.Response
+}
+
+// ptr 返回值的指针，便于构造可选字段
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// login 注册并登录测试用户
+func (tc *testClient) login(username string) {
+	tc.t.Helper()
+
+	register := RegisterRequest{Username: username, Email: username + "@example.com", Password: "password123"}
+	if resp := tc.post("/api/auth/register", register, nil); resp.Code != CodeSuccess {
+		tc.t.Fatalf("register: %+v", resp)
+	}
+
+	var data TokenResponse
+	if resp := tc.post("/api/auth/login", LoginRequest{Username: username, Password: "password123"}, &data); resp.Code != CodeSuccess {
+		tc.t.Fatalf("login: %+v", resp)
+	}
+	tc.token = data.Token
+	tc.refreshToken = data.RefreshToken
+}
+
+func TestAuthFlow(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+
+	if resp := tc.post("/api/v1/profile", nil, nil); resp.Code != CodeUnauthorized {
+		t.Errorf("profile without token code = %d, want %d", resp.Code, CodeUnauthorized)
+	}
+
+	tc.login("alice")
+
+	register := RegisterRequest{Username: "alice", Email: "other@example.com", Password: "password123"}
+	if resp := tc.post("/api/auth/register", register, nil); resp.Code != CodeUserExists {
+		t.Errorf("duplicate register code = %d, want %d", resp.Code, CodeUserExists)
+	}
+
+	if resp := tc.post("/api/auth/login", LoginRequest{Username: "alice", Password: "wrong"}, nil); resp.Code != CodeInvalidCredentials {
+		t.Errorf("wrong password code = %d, want %d", resp.Code, CodeInvalidCredentials)
+	}
+
+	var user repository.User
+	if resp := tc.post("/api/v1/profile", nil, &user); resp.Code != CodeSuccess || user.Username != "alice" {
+		t.Errorf("profile = %+v, %+v", resp, user)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("dave")
+	firstRefresh := tc.refreshToken
+
+	var rotated TokenResponse
+	if resp := tc.post("/api/auth/refresh", RefreshTokenRequest{RefreshToken: firstRefresh}, &rotated); resp.Code != CodeSuccess {
+		t.Fatalf("refresh = %+v", resp)
+	}
+	if rotated.RefreshToken == firstRefresh || rotated.Token == "" {
+		t.Fatalf("refresh did not rotate tokens: %+v", rotated)
+	}
+	tc.token = rotated.Token
+
+	// 重复使用已轮换的刷新令牌会撤销整个会话
+	if resp := tc.post("/api/auth/refresh", RefreshTokenRequest{RefreshToken: firstRefresh}, nil); resp.Code != CodeTokenRevoked {
+		t.Errorf("reused refresh code = %d, want %d", resp.Code, CodeTokenRevoked)
+	}
+	if resp := tc.post("/api/v1/profile", nil, nil); resp.Code != CodeTokenRevoked {
+		t.Errorf("profile after reuse code = %d, want %d", resp.Code, CodeTokenRevoked)
+	}
+}
+
+// failingTokenStore 在 fail 为 true 时保存刷新令牌失败，事务中同样生效
+type failingTokenStore struct {
+	*repository.MemoryStore
+	fail *bool
+}
+
+func (s failingTokenStore) WithTx(fn func(tx repository.Store) error) error {
+	return s.MemoryStore.WithTx(func(tx repository.Store) error {
+		return fn(failingTokenStore{tx.(*repository.MemoryStore), s.fail})
+	})
+}
+
+func (s failingTokenStore) CreateRefreshToken(token *repository.RefreshToken) error {
+	if *s.fail {
+		return errors.New("disk full")
+	}
+	return s.MemoryStore.CreateRefreshToken(token)
+}
+
+func TestRefreshTokenRollback(t *testing.T) {
+	t.Parallel()
+	fail := false
+	tc := newTestClientWithStore(t, failingTokenStore{repository.NewMemoryStore(), &fail})
+	tc.login("dana")
+
+	// 新令牌保存失败时旧令牌不被消耗，会话仍然有效
+	fail = true
+	if resp := tc.post("/api/auth/refresh", RefreshTokenRequest{RefreshToken: tc.refreshToken}, nil); resp.Code != CodeInternalError {
+		t.Fatalf("refresh with failing store code = %d, want %d", resp.Code, CodeInternalError)
+	}
+	fail = false
+	if resp := tc.post("/api/v1/profile", nil, nil); resp.Code != CodeSuccess {
+		t.Errorf("profile after failed refresh = %+v", resp)
+	}
+	var rotated TokenResponse
+	if resp := tc.post("/api/auth/refresh", RefreshTokenRequest{RefreshToken: tc.refreshToken}, &rotated); resp.Code != CodeSuccess || rotated.RefreshToken == "" {
+		t.Errorf("retry refresh = %+v, %+v", resp, rotated)
+	}
+}
+
+func TestLoggerRedactsSecrets(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	tc := newTestClient(t, WithLogger(log.New(&buf, "", 0)))
+	tc.login("erin")
+	tc.post("/api/auth/refresh", RefreshTokenRequest{RefreshToken: tc.refreshToken}, nil)
+
+	// 无法解析的请求体只记录长度
+	malformed := `{"username":"erin","password":"password123"`
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(malformed))
+	req.Header.Set("Content-Type", "application/json")
+	tc.handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	logs := buf.String()
+	if strings.Contains(logs, "password123") || strings.Contains(logs, tc.refreshToken) {
+		t.Errorf("logs contain secrets:\n%s", logs)
+	}
+	if !strings.Contains(logs, `"username":"erin"`) || !strings.Contains(logs, `"password":"***"`) ||
+		!strings.Contains(logs, fmt.Sprintf("<%d bytes, not JSON>", len(malformed))) {
+		t.Errorf("logs =\n%s", logs)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("erin")
+	phone := *tc
+
+	var laptop TokenResponse
+	if resp := tc.post("/api/auth/login", LoginRequest{Username: "erin", Password: "password123"}, &laptop); resp.Code != CodeSuccess {
+		t.Fatalf("second login = %+v", resp)
+	}
+
+	if resp := phone.post("/api/auth/logout", nil, nil); resp.Code != CodeSuccess {
+		t.Fatalf("logout = %+v", resp)
+	}
+	if resp := phone.post("/api/v1/profile", nil, nil); resp.Code != CodeTokenRevoked {
+		t.Errorf("profile after logout code = %d, want %d", resp.Code, CodeTokenRevoked)
+	}
+
+	tc.token = laptop.Token
+	if resp := tc.post("/api/v1/profile", nil, nil); resp.Code != CodeSuccess {
+		t.Fatalf("other session after logout = %+v", resp)
+	}
+	if resp := tc.post("/api/auth/logout-all", nil, nil); resp.Code != CodeSuccess {
+		t.Fatalf("logout-all = %+v", resp)
+	}
+	if resp := tc.post("/api/v1/profile", nil, nil); resp.Code != CodeTokenRevoked {
+		t.Errorf("profile after logout-all code = %d, want %d", resp.Code, CodeTokenRevoked)
+	}
+	if resp := tc.post("/api/auth/refresh", RefreshTokenRequest{RefreshToken: laptop.RefreshToken}, nil); resp.Code != CodeTokenRevoked {
+		t.Errorf("refresh after logout-all code = %d, want %d", resp.Code, CodeTokenRevoked)
+	}
+}
+
+func TestTodoHandlers(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("bob")
+
+	var created repository.Todo
+	req := ExtendedTodoRequest{Title: "学习Go语言", Priority: 2, Tags: []string{"工作"}}
+	if resp := tc.post("/api/v1/todos/create", req, &created); resp.Code != CodeSuccess || created.ID == 0 {
+		t.Fatalf("create todo = %+v, %+v", resp, created)
+	}
+
+	completed := true
+	update := UpdateExtendedTodoRequest{ID: created.ID, Completed: &completed}
+	if resp := tc.post("/api/v1/todos/update", update, nil); resp.Code != CodeSuccess {
+		t.Fatalf("update todo = %+v", resp)
+	}
+
+	var todos []repository.Todo
+	if resp := tc.post("/api/v1/todos/list", GetTodosRequest{}, &todos); resp.Code != CodeSuccess {
+		t.Fatalf("list todos = %+v", resp)
+	}
+	if len(todos) != 1 || !todos[0].Completed {
+		t.Errorf("list todos = %+v", todos)
+	}
+
+	if resp := tc.post("/api/v1/todos/update", UpdateExtendedTodoRequest{ID: 999}, nil); resp.Code != CodeNotFound {
+		t.Errorf("update missing todo code = %d, want %d", resp.Code, CodeNotFound)
+	}
+}
+
+func TestListTodosFilters(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tc := newTestClient(t, WithClock(func() time.Time { return now }))
+	tc.login("kate")
+
+	var category repository.Category
+	if resp := tc.post("/api/v1/categories/create", CategoryRequest{Name: "工作"}, &category); resp.Code != CodeSuccess {
+		t.Fatalf("create category = %+v", resp)
+	}
+	todos := []ExtendedTodoRequest{
+		{Title: "周报", Priority: 2, CategoryUUID: category.UUID, Tags: []string{"工作"}, DueDate: ptr("2026-10-15T18:00:00Z")},
+		{Title: "买菜", Priority: 1, Tags: []string{"生活"}, DueDate: ptr("2026-10-17T18:00:00Z")},
+		{Title: "复盘", Priority: 3, CategoryUUID: category.UUID, Tags: []string{"工作", "重要"}},
+	}
+	for _, req := range todos {
+		if resp := tc.post("/api/v1/todos/create", req, nil); resp.Code != CodeSuccess {
+			t.Fatalf("create todo = %+v", resp)
+		}
+	}
+
+	titles := func(req GetTodosRequest) string {
+		t.Helper()
+		var list []repository.Todo
+		if resp := tc.post("/api/v1/todos/list", req, &list); resp.Code != CodeSuccess {
+			t.Fatalf("list todos = %+v", resp)
+		}
+		var got []string
+		for _, todo := range list {
+			got = append(got, todo.Title)
+		}
+		return strings.Join(got, ",")
+	}
+
+	tests := []struct {
+		name string
+		req  GetTodosRequest
+		want string
+	}{
+		{"category uuid", GetTodosRequest{CategoryUUIDs: []string{category.UUID}, Sort: []TodoSortRequest{{Field: "priority", Order: "desc"}}}, "复盘,周报"},
+		{"all tags", GetTodosRequest{Tags: []string{"工作", "重要"}, TagMatch: "all"}, "复盘"},
+		{"overdue by server clock", GetTodosRequest{Overdue: true}, "周报"},
+		{"due date ascending", GetTodosRequest{Sort: []TodoSortRequest{{Field: "due_date"}}}, "周报,买菜,复盘"},
+		{"uncategorized", GetTodosRequest{Uncategorized: true}, "买菜"},
+	}
+	for _, tt := range tests {
+		if got := titles(tt.req); got != tt.want {
+			t.Errorf("%s: list todos = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	invalid := []GetTodosRequest{
+		{Sort: []TodoSortRequest{{Field: "description"}}},
+		{Priorities: []int{4}},
+		{TagMatch: "none"},
+	}
+	for _, req := range invalid {
+		if resp := tc.post("/api/v1/todos/list", req, nil); resp.Code != CodeInvalidParams {
+			t.Errorf("list todos %+v code = %d, want %d", req, resp.Code, CodeInvalidParams)
+		}
+	}
+	missing := GetTodosRequest{CategoryUUIDs: []string{"3b241101-e2bb-4255-8caf-4136c566a962"}}
+	if resp := tc.post("/api/v1/todos/list", missing, nil); resp.Code != CodeNotFound {
+		t.Errorf("list todos with missing category code = %d, want %d", resp.Code, CodeNotFound)
+	}
+}
+
+func TestListTodosCursor(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("leo")
+
+	create := func(title string) {
+		t.Helper()
+		if resp := tc.post("/api/v1/todos/create", ExtendedTodoRequest{Title: title}, nil); resp.Code != CodeSuccess {
+			t.Fatalf("create todo = %+v", resp)
+		}
+	}
+	for _, title := range []string{"a", "b", "c", "d", "e"} {
+		create(title)
+	}
+
+	req := GetTodosRequest{Limit: 2, Cursor: ptr(""), IncludeTotal: true, Sort: []TodoSortRequest{{Field: "title"}}}
+	var seen []string
+	for {
+		var page TodoPageResponse
+		if resp := tc.post("/api/v1/todos/list", req, &page); resp.Code != CodeSuccess {
+			t.Fatalf("list todos page = %+v", resp)
+		}
+		if page.Total == nil || *page.Total < 5 {
+			t.Errorf("page total = %v", page.Total)
+		}
+		for _, todo := range page.Items {
+			seen = append(seen, todo.Title)
+		}
+		if !page.HasMore {
+			break
+		}
+		// 翻页期间新建的TODO不会导致已返回的TODO重复或被跳过
+		if len(seen) == 2 {
+			create("0")
+			create("z")
+		}
+		req.Cursor = &page.NextCursor
+	}
+	if got := strings.Join(seen, ","); got != "a,b,c,d,e,z" {
+		t.Errorf("paged titles = %q", got)
+	}
+
+	if resp := tc.post("/api/v1/todos/list", GetTodosRequest{Cursor: ptr("not-a-cursor")}, nil); resp.Code != CodeInvalidParams {
+		t.Errorf("invalid cursor code = %d, want %d", resp.Code, CodeInvalidParams)
+	}
+	var first TodoPageResponse
+	tc.post("/api/v1/todos/list", GetTodosRequest{Limit: 1, Cursor: ptr("")}, &first)
+	if resp := tc.post("/api/v1/todos/list", GetTodosRequest{Cursor: &first.NextCursor, Sort: req.Sort}, nil); resp.Code != CodeInvalidParams {
+		t.Errorf("cursor with different sort code = %d, want %d", resp.Code, CodeInvalidParams)
+	}
+
+	// 未提供游标时按偏移量分页，直接返回列表
+	var todos []repository.Todo
+	if resp := tc.post("/api/v1/todos/search", SearchTodosRequest{Keyword: "z"}, &todos); resp.Code != CodeSuccess || len(todos) != 1 {
+		t.Errorf("search todos = %+v, %+v", resp, todos)
+	}
+	var page TodoPageResponse
+	if resp := tc.post("/api/v1/todos/search", SearchTodosRequest{Keyword: "z", GetTodosRequest: GetTodosRequest{Cursor: ptr("")}}, &page); resp.Code != CodeSuccess ||
+		len(page.Items) != 1 || page.HasMore {
+		t.Errorf("search todos page = %+v, %+v", resp, page)
+	}
+}
+
+func TestSearchTodos(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("mia")
+
+	for _, req := range []ExtendedTodoRequest{
+		{Title: "整理周报", Description: "汇总<本周>进展", Priority: 1},
+		{Title: "买菜", Description: "周末准备周报需要的数据", Priority: 3},
+		{Title: "周报模板", Priority: 0},
+	} {
+		if resp := tc.post("/api/v1/todos/create", req, nil); resp.Code != CodeSuccess {
+			t.Fatalf("create todo = %+v", resp)
+		}
+	}
+
+	var todos []repository.Todo
+	if resp := tc.post("/api/v1/todos/search", SearchTodosRequest{Keyword: "周报"}, &todos); resp.Code != CodeSuccess || len(todos) != 3 {
+		t.Fatalf("search todos = %+v, %+v", resp, todos)
+	}
+	// 默认按相关度排序，标题匹配在前
+	if todos[2].Title != "买菜" || todos[0].SearchRank <= todos[2].SearchRank {
+		t.Errorf("search order = %s, %s, %s", todos[0].Title, todos[1].Title, todos[2].Title)
+	}
+	if h := todos[2].Highlight; h == nil || h.Title != "" || h.Description != "周末准备<mark>周报</mark>需要的数据" {
+		t.Errorf("highlight = %+v", h)
+	}
+
+	// 支持与列表相同的筛选条件和排序
+	req := SearchTodosRequest{Keyword: "周", GetTodosRequest: GetTodosRequest{
+		Priorities: []int{1, 3},
+		Sort:       []TodoSortRequest{{Field: "priority", Order: "desc"}},
+	}}
+	if resp := tc.post("/api/v1/todos/search", req, &todos); resp.Code != CodeSuccess || len(todos) != 2 || todos[0].Title != "买菜" {
+		t.Errorf("filtered search = %+v, %+v", resp, todos)
+	}
+	if todos[1].Highlight == nil || todos[1].Highlight.Description != "汇总&lt;本<mark>周</mark>&gt;进展" {
+		t.Errorf("escaped highlight = %+v", todos[1].Highlight)
+	}
+
+	// 字段条件与排除
+	if resp := tc.post("/api/v1/todos/search", SearchTodosRequest{Keyword: "周报 priority:<=medium -模板"}, &todos); resp.Code != CodeSuccess || len(todos) != 1 || todos[0].Title != "整理周报" {
+		t.Errorf("field search = %+v, %+v", resp, todos)
+	}
+	var urgent []repository.Todo
+	if resp := tc.post("/api/v1/todos/search", SearchTodosRequest{Keyword: "priority:urgent"}, &urgent); resp.Code != CodeSuccess || len(urgent) != 1 || urgent[0].Highlight != nil {
+		t.Errorf("field only search = %+v, %+v", resp, urgent)
+	}
+
+	// 语法错误返回出错位置
+	var syntaxErr SearchErrorResponse
+	resp := tc.post("/api/v1/todos/search", SearchTodosRequest{Keyword: "周报 due:<2026-13-01"}, &syntaxErr)
+	if resp.Code != CodeInvalidParams || syntaxErr.Offset != 7 || syntaxErr.Length != 11 {
+		t.Errorf("syntax error = %+v, %+v", resp, syntaxErr)
+	}
+}
+
+func TestCategoryHandlers(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("carol")
+
+	if resp := tc.post("/api/v1/categories/create", CategoryRequest{Name: "工作"}, nil); resp.Code != CodeSuccess {
+		t.Fatalf("create category = %+v", resp)
+	}
+	if resp := tc.post("/api/v1/categories/create", CategoryRequest{Name: "工作"}, nil); resp.Code != CodeInvalidParams {
+		t.Errorf("duplicate category code = %d, want %d", resp.Code, CodeInvalidParams)
+	}
+
+	var categories []repository.Category
+	if resp := tc.post("/api/v1/categories", nil, &categories); resp.Code != CodeSuccess || len(categories) != 1 {
+		t.Errorf("list categories = %+v, %+v", resp, categories)
+	}
+	if categories[0].Color != "#2196F3" {
+		t.Errorf("default color = %q", categories[0].Color)
+	}
+}
+
+func TestDeviceHandlers(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("frank")
+
+	// 已登录会话注册为设备，换取携带 device_id 的访问令牌
+	var registered DeviceRegisterResponse
+	if resp := tc.post("/api/v1/devices/register", DeviceRequest{Name: "iPhone", Platform: "ios"}, &registered); resp.Code != CodeSuccess {
+		t.Fatalf("register device = %+v", resp)
+	}
+	tc.token = registered.Token
+	phoneID := registered.Device.ID
+
+	// 登录时直接注册第二台设备
+	var watch TokenResponse
+	login := LoginRequest{Username: "frank", Password: "password123", Device: &DeviceRequest{Name: "Watch", Platform: "watchos"}}
+	if resp := tc.post("/api/auth/login", login, &watch); resp.Code != CodeSuccess || watch.Device == nil {
+		t.Fatalf("login with device = %+v, %+v", resp, watch)
+	}
+
+	var created repository.Todo
+	if resp := tc.post("/api/v1/todos/create", ExtendedTodoRequest{Title: "买牛奶"}, &created); resp.Code != CodeSuccess {
+		t.Fatalf("create todo = %+v", resp)
+	}
+	if resp := tc.post("/api/v1/sync/ack", SyncAckRequest{Version: created.SyncVersion}, nil); resp.Code != CodeSuccess {
+		t.Fatalf("ack = %+v", resp)
+	}
+	if resp := tc.post("/api/v1/sync/ack", SyncAckRequest{Version: created.SyncVersion + 1000}, nil); resp.Code != CodeInvalidParams {
+		t.Errorf("ack ahead of server code = %d, want %d", resp.Code, CodeInvalidParams)
+	}
+	// 增量同步时超过服务器版本的 since 和游标不会确认为已同步
+	if resp := tc.post("/api/v1/sync/todos", IncrementalSyncRequest{Since: created.SyncVersion + 1000}, nil); resp.Code != CodeSuccess {
+		t.Fatalf("sync ahead of server = %+v", resp)
+	}
+	forged := encodeCursor(syncCursor{After: created.SyncVersion + 1000, Until: created.SyncVersion + 2000})
+	if resp := tc.post("/api/v1/sync/todos", IncrementalSyncRequest{Cursor: forged}, nil); resp.Code != CodeSuccess {
+		t.Fatalf("sync with forged cursor = %+v", resp)
+	}
+
+	if resp := tc.post("/api/v1/devices/rename", RenameDeviceRequest{ID: watch.Device.ID, Name: "旧手表"}, nil); resp.Code != CodeSuccess {
+		t.Fatalf("rename device = %+v", resp)
+	}
+	if resp := tc.post("/api/v1/devices/revoke", RevokeDeviceRequest{ID: watch.Device.ID}, nil); resp.Code != CodeSuccess {
+		t.Fatalf("revoke device = %+v", resp)
+	}
+
+	var list DeviceListResponse
+	if resp := tc.post("/api/v1/devices", nil, &list); resp.Code != CodeSuccess || len(list.Devices) != 2 {
+		t.Fatalf("list devices = %+v, %+v", resp, list)
+	}
+	if list.CurrentDeviceID != phoneID {
+		t.Errorf("current device = %q, want %q", list.CurrentDeviceID, phoneID)
+	}
+	for _, device := range list.Devices {
+		switch device.ID {
+		case phoneID:
+			if device.LastSyncVersion != created.SyncVersion || device.LastSyncedAt == nil {
+				t.Errorf("phone sync cursor = %+v", device)
+			}
+		case watch.Device.ID:
+			if device.Name != "旧手表" || device.RevokedAt == nil {
+				t.Errorf("revoked watch = %+v", device)
+			}
+		}
+	}
+
+	// 被撤销设备的令牌立即失效
+	watchClient := *tc
+	watchClient.token = watch.Token
+	if resp := watchClient.post("/api/v1/profile", nil, nil); resp.Code != CodeTokenRevoked {
+		t.Errorf("revoked device profile code = %d, want %d", resp.Code, CodeTokenRevoked)
+	}
+	if resp := tc.post("/api/auth/refresh", RefreshTokenRequest{RefreshToken: watch.RefreshToken}, nil); resp.Code != CodeTokenRevoked {
+		t.Errorf("revoked device refresh code = %d, want %d", resp.Code, CodeTokenRevoked)
+	}
+}
+
+func TestIncrementalSyncPaging(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("grace")
+
+	for _, title := range []string{"一", "二", "三", "四", "五"} {
+		if resp := tc.post("/api/v1/todos/create", ExtendedTodoRequest{Title: title}, nil); resp.Code != CodeSuccess {
+			t.Fatalf("create todo = %+v", resp)
+		}
+	}
+
+	var titles []string
+	req := IncrementalSyncRequest{Limit: 2}
+	var last SyncResponse
+	for page := 0; ; page++ {
+		var data SyncResponse
+		if resp := tc.post("/api/v1/sync/todos", req, &data); resp.Code != CodeSuccess {
+			t.Fatalf("sync page %d = %+v", page, resp)
+		}
+		for _, todo := range data.Todos {
+			titles = append(titles, todo.Title)
+		}
+		last = data
+		if !data.HasMore {
+			break
+		}
+		if data.NextCursor == "" || page > 5 {
+			t.Fatalf("page %d: has_more without usable cursor: %+v", page, data)
+		}
+		req = IncrementalSyncRequest{Cursor: data.NextCursor, Limit: 2}
+	}
+
+	if got := strings.Join(titles, ""); got != "一二三四五" {
+		t.Errorf("synced titles = %q, want in change order", got)
+	}
+
+	// 同步完成后以 server_version 作为 since，不应再收到任何数据
+	var empty SyncResponse
+	if resp := tc.post("/api/v1/sync/todos", IncrementalSyncRequest{Since: last.ServerVersion}, &empty); resp.Code != CodeSuccess || len(empty.Todos) != 0 || empty.HasMore {
+		t.Errorf("sync after completion = %+v, %+v", resp, empty)
+	}
+
+	if resp := tc.post("/api/v1/sync/todos", IncrementalSyncRequest{Cursor: "not-a-cursor"}, nil); resp.Code != CodeInvalidParams {
+		t.Errorf("invalid cursor code = %d, want %d", resp.Code, CodeInvalidParams)
+	}
+}
+
+func TestBatchSyncAtomicAndIdempotency(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("heidi")
+
+	// 超时重试的创建请求携带相同的幂等键，不会重复创建
+	create := BatchSyncRequest{Todos: []repository.TodoSyncItem{
+		{Title: "买牛奶", Tags: []string{}, IdempotencyKey: "0b8f5c1e-3f0a-4c1d-9a5e-6d2b7c8e9f10"},
+	}}
+	var first, retry BatchSyncResponse
+	if resp := tc.post("/api/v1/sync/batch", create, &first); resp.Code != CodeSuccess || len(first.Success) != 1 {
+		t.Fatalf("batch create = %+v, %+v", resp, first)
+	}
+	if resp := tc.post("/api/v1/sync/batch", create, &retry); resp.Code != CodeSuccess || len(retry.Success) != 1 {
+		t.Fatalf("batch retry = %+v, %+v", resp, retry)
+	}
+	if retry.Success[0].ServerID != first.Success[0].ServerID {
+		t.Errorf("retry server_id = %d, want %d", retry.Success[0].ServerID, first.Success[0].ServerID)
+	}
+
+	// atomic 模式下任一项失败，整个批次都不生效
+	atomic := BatchSyncRequest{
+		Atomic: true,
+		Todos: []repository.TodoSyncItem{
+			{Title: "写周报", Tags: []string{}},
+			{ID: 9999, Title: "不存在", Tags: []string{}},
+		},
+	}
+	var rolledBack BatchSyncResponse
+	if resp := tc.post("/api/v1/sync/batch", atomic, &rolledBack); resp.Code != CodeSuccess {
+		t.Fatalf("atomic batch = %+v", resp)
+	}
+	if !rolledBack.RolledBack || len(rolledBack.Success) != 0 || len(rolledBack.Errors) != 1 {
+		t.Errorf("atomic batch response = %+v", rolledBack)
+	}
+
+	// 非 atomic 模式下失败项不影响其他项
+	atomic.Atomic = false
+	var partial BatchSyncResponse
+	if resp := tc.post("/api/v1/sync/batch", atomic, &partial); resp.Code != CodeSuccess {
+		t.Fatalf("partial batch = %+v", resp)
+	}
+	if partial.RolledBack || len(partial.Success) != 1 || len(partial.Errors) != 1 {
+		t.Errorf("partial batch response = %+v", partial)
+	}
+
+	var todos []repository.Todo
+	if resp := tc.post("/api/v1/todos/list", GetTodosRequest{Limit: 20}, &todos); resp.Code != CodeSuccess || len(todos) != 2 {
+		t.Errorf("todos after batches = %d, want 2", len(todos))
+	}
+}
+
+func TestBatchSyncClientUUIDs(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("ivan")
+
+	// TODO引用同一批次中离线新建的分类
+	categoryUUID := "3b241101-e2bb-4255-8caf-4136c566a962"
+	todoUUID := "9f0c2a4e-5d1b-4c3a-8e7f-6a5b4c3d2e1f"
+	batch := BatchSyncRequest{
+		Todos: []repository.TodoSyncItem{
+			{UUID: todoUUID, Title: "准备出差", Tags: []string{}, CategoryUUID: &categoryUUID},
+		},
+		Categories: []repository.CategorySyncItem{
+			{UUID: categoryUUID, Name: "出差"},
+		},
+	}
+	var data BatchSyncResponse
+	if resp := tc.post("/api/v1/sync/batch", batch, &data); resp.Code != CodeSuccess || len(data.Success) != 2 {
+		t.Fatalf("batch sync = %+v, %+v", resp, data)
+	}
+
+	var changes SyncResponse
+	if resp := tc.post("/api/v1/sync/todos", IncrementalSyncRequest{}, &changes); resp.Code != CodeSuccess {
+		t.Fatalf("incremental sync = %+v", resp)
+	}
+	if len(changes.Todos) != 1 || len(changes.Categories) != 1 {
+		t.Fatalf("incremental sync = %+v", changes)
+	}
+	todo := changes.Todos[0]
+	if todo.UUID != todoUUID || todo.CategoryUUID == nil || *todo.CategoryUUID != categoryUUID ||
+		todo.CategoryID == nil || *todo.CategoryID != changes.Categories[0].ID {
+		t.Errorf("synced todo = %+v", todo)
+	}
+
+	// 按UUID更新已存在的TODO
+	todo.ID = 0
+	todo.Title = "准备出差材料"
+	batch = BatchSyncRequest{Todos: []repository.TodoSyncItem{todo}}
+	if resp := tc.post("/api/v1/sync/batch", batch, &data); resp.Code != CodeSuccess ||
+		len(data.Success) != 1 || data.Success[0].Action != "updated" || data.Success[0].UUID != todoUUID {
+		t.Errorf("update by uuid = %+v, %+v", resp, data)
+	}
+
+	if resp := tc.post("/api/v1/todos/update", UpdateExtendedTodoRequest{UUID: todoUUID, Completed: new(bool)}, nil); resp.Code != CodeSuccess {
+		t.Errorf("update todo by uuid = %+v", resp)
+	}
+	if resp := tc.post("/api/v1/categories/delete", DeleteCategoryRequest{UUID: categoryUUID}, nil); resp.Code != CodeSuccess {
+		t.Errorf("delete category by uuid = %+v", resp)
+	}
+}
+
+// readEvent 读取一条Server-Sent Event，跳过心跳注释
+func readEvent(t *testing.T, reader *bufio.Reader) (event, data string) {
+	t.Helper()
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		case line == "" && event != "":
+			return event, data
+		}
+	}
+}
+
+func TestSyncStream(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t, WithStreamHeartbeat(10*time.Millisecond))
+	tc.login("grace")
+
+	httpServer := httptest.NewServer(tc.handler)
+	defer httpServer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, httpServer.URL+"/api/v1/sync/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+tc.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/v1/sync/stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/event-stream") {
+		t.Fatalf("Content-Type = %q", contentType)
+	}
+	reader := bufio.NewReader(resp.Body)
+
+	var initial SyncVersionResponse
+	if event, data := readEvent(t, reader); event != "version" || json.Unmarshal([]byte(data), &initial) != nil {
+		t.Fatalf("first event = %s %s", event, data)
+	}
+
+	var created repository.Todo
+	if resp := tc.post("/api/v1/todos/create", ExtendedTodoRequest{Title: "实时推送"}, &created); resp.Code != CodeSuccess {
+		t.Fatalf("create todo = %+v", resp)
+	}
+
+	var change repository.ChangeEvent
+	event, data := readEvent(t, reader)
+	if event != "change" || json.Unmarshal([]byte(data), &change) != nil {
+		t.Fatalf("change event = %s %s", event, data)
+	}
+	if change.SyncVersion != created.SyncVersion || change.SyncVersion <= initial.Version ||
+		len(change.Entities) != 1 || change.Entities[0].ID != created.ID || change.Entities[0].UUID != created.UUID {
+		t.Errorf("change event = %+v, created = %+v", change, created)
+	}
+}
+
+func TestRecurringTodo(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("henry")
+
+	invalid := ExtendedTodoRequest{Title: "无截止时间", Recurrence: ptr("FREQ=DAILY")}
+	if resp := tc.post("/api/v1/todos/create", invalid, nil); resp.Code != CodeInvalidParams {
+		t.Errorf("recurring todo without due date code = %d, want %d", resp.Code, CodeInvalidParams)
+	}
+
+	var created repository.Todo
+	req := ExtendedTodoRequest{Title: "月末对账", DueDate: ptr("2026-10-30T10:00:00Z"), Recurrence: ptr("rrule:freq=monthly;byday=-1fr")}
+	if resp := tc.post("/api/v1/todos/create", req, &created); resp.Code != CodeSuccess {
+		t.Fatalf("create recurring todo = %+v", resp)
+	}
+	if created.Recurrence == nil || *created.Recurrence != "FREQ=MONTHLY;BYDAY=-1FR" {
+		t.Errorf("normalized recurrence = %v", created.Recurrence)
+	}
+
+	var updated UpdateTodoResponse
+	if resp := tc.post("/api/v1/todos/update", UpdateExtendedTodoRequest{ID: created.ID, Completed: ptr(true)}, &updated); resp.Code != CodeSuccess {
+		t.Fatalf("complete recurring todo = %+v", resp)
+	}
+	wantDue := time.Date(2026, 11, 27, 10, 0, 0, 0, time.UTC)
+	if updated.Next == nil || updated.Next.DueDate == nil || !updated.Next.DueDate.Equal(wantDue) || updated.Next.Completed {
+		t.Fatalf("next occurrence = %+v", updated.Next)
+	}
+
+	// 重新完成已完成的实例不会再次生成
+	if resp := tc.post("/api/v1/todos/update", UpdateExtendedTodoRequest{ID: created.ID, Completed: ptr(false)}, nil); resp.Code != CodeSuccess {
+		t.Fatalf("reopen todo = %+v", resp)
+	}
+	updated = UpdateTodoResponse{}
+	if resp := tc.post("/api/v1/todos/update", UpdateExtendedTodoRequest{ID: created.ID, Completed: ptr(true)}, &updated); resp.Code != CodeSuccess || updated.Next != nil {
+		t.Errorf("complete again = %+v, next = %+v", resp, updated.Next)
+	}
+
+}
+
+// slowReadStore 在事务外读取TODO后等待一段时间，使并发请求的读取都发生在写入之前
+type slowReadStore struct {
+	*repository.MemoryStore
+}
+
+func (s slowReadStore) GetTodoByID(todoID, userID int) (*repository.Todo, error) {
+	todo, err := s.MemoryStore.GetTodoByID(todoID, userID)
+	time.Sleep(20 * time.Millisecond)
+	return todo, err
+}
+
+func TestConcurrentTodoUpdates(t *testing.T) {
+	t.Parallel()
+	tc := newTestClientWithStore(t, slowReadStore{repository.NewMemoryStore()})
+	tc.login("hazel")
+
+	var weekly repository.Todo
+	req := ExtendedTodoRequest{Title: "周会", DueDate: ptr("2026-10-19T09:00:00Z"), Recurrence: ptr("FREQ=WEEKLY")}
+	if resp := tc.post("/api/v1/todos/create", req, &weekly); resp.Code != CodeSuccess {
+		t.Fatalf("create recurring todo = %+v", resp)
+	}
+
+	// 两台设备同时修改不同字段、同时完成同一实例：修改都保留，且只生成一次下一次实例
+	updates := []UpdateExtendedTodoRequest{
+		{ID: weekly.ID, Completed: ptr(true)},
+		{ID: weekly.ID, Completed: ptr(true)},
+		{ID: weekly.ID, Title: ptr("周例会")},
+		{ID: weekly.ID, Priority: ptr(int(repository.PriorityHigh))},
+	}
+	nexts := make([]*repository.Todo, len(updates))
+	var wg sync.WaitGroup
+	for i, update := range updates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var updated UpdateTodoResponse
+			if resp := tc.post("/api/v1/todos/update", update, &updated); resp.Code != CodeSuccess {
+				t.Errorf("update todo = %+v", resp)
+			}
+			nexts[i] = updated.Next
+		}()
+	}
+	wg.Wait()
+
+	generated := 0
+	for _, next := range nexts {
+		if next != nil {
+			generated++
+		}
+	}
+	var todos []repository.Todo
+	if resp := tc.post("/api/v1/todos/list", GetTodosRequest{}, &todos); resp.Code != CodeSuccess {
+		t.Fatalf("list todos = %+v", resp)
+	}
+	if generated != 1 || len(todos) != 2 {
+		t.Fatalf("concurrent completion generated %d next occurrences, %d todos", generated, len(todos))
+	}
+	stored, err := tc.server.store.GetTodoByID(weekly.ID, weekly.UserID)
+	if err != nil {
+		t.Fatalf("GetTodoByID() error = %v", err)
+	}
+	if !stored.Completed || stored.Title != "周例会" || stored.Priority != repository.PriorityHigh {
+		t.Errorf("todo after concurrent updates = %+v", stored)
+	}
+}
+
+func TestChecklistHandlers(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("judy")
+
+	var todo repository.Todo
+	if resp := tc.post("/api/v1/todos/create", ExtendedTodoRequest{Title: "搬家"}, &todo); resp.Code != CodeSuccess {
+		t.Fatalf("create todo = %+v", resp)
+	}
+
+	var items []repository.ChecklistItem
+	for _, title := range []string{"打包", "联系搬家公司", "退押金"} {
+		var item repository.ChecklistItem
+		if resp := tc.post("/api/v1/todos/checklist/create", CreateChecklistItemRequest{TodoUUID: todo.UUID, Title: title}, &item); resp.Code != CodeSuccess {
+			t.Fatalf("create checklist item = %+v", resp)
+		}
+		items = append(items, item)
+	}
+
+	var toggled repository.ChecklistItem
+	if resp := tc.post("/api/v1/todos/checklist/toggle", ChecklistItemRequest{UUID: items[1].UUID}, &toggled); resp.Code != CodeSuccess || !toggled.Completed {
+		t.Errorf("toggle checklist item = %+v, %+v", resp, toggled)
+	}
+	if resp := tc.post("/api/v1/todos/checklist/delete", ChecklistItemRequest{ID: items[2].ID}, nil); resp.Code != CodeSuccess {
+		t.Errorf("delete checklist item = %+v", resp)
+	}
+
+	reorder := ReorderChecklistRequest{TodoID: todo.ID, ItemIDs: []int{items[0].ID}}
+	if resp := tc.post("/api/v1/todos/checklist/reorder", reorder, nil); resp.Code != CodeInvalidParams {
+		t.Errorf("reorder with missing item code = %d, want %d", resp.Code, CodeInvalidParams)
+	}
+	reorder = ReorderChecklistRequest{TodoID: todo.ID, ItemUUIDs: []string{items[1].UUID, items[0].UUID}}
+	var ordered []repository.ChecklistItem
+	if resp := tc.post("/api/v1/todos/checklist/reorder", reorder, &ordered); resp.Code != CodeSuccess ||
+		len(ordered) != 2 || ordered[0].ID != items[1].ID || ordered[0].Position != 1 {
+		t.Errorf("reorder checklist = %+v, %+v", resp, ordered)
+	}
+
+	var todos []repository.Todo
+	if resp := tc.post("/api/v1/todos/list", GetTodosRequest{}, &todos); resp.Code != CodeSuccess || len(todos) != 1 {
+		t.Fatalf("list todos = %+v", resp)
+	}
+	if todos[0].ChecklistTotal != 2 || todos[0].ChecklistCompleted != 1 {
+		t.Errorf("checklist progress = %d/%d, want 1/2", todos[0].ChecklistCompleted, todos[0].ChecklistTotal)
+	}
+
+	// 检查项引用同一批次中离线新建的TODO
+	todoUUID := "7d9e4c2b-1a3f-4b5d-8e6f-0a1b2c3d4e5f"
+	batch := BatchSyncRequest{
+		Todos: []repository.TodoSyncItem{{UUID: todoUUID, Title: "体检", Tags: []string{}}},
+		ChecklistItems: []repository.ChecklistItemSyncItem{
+			{UUID: "0b6c8d2e-4f1a-4c3b-9d5e-7f8a9b0c1d2e", TodoUUID: todoUUID, Title: "预约"},
+		},
+	}
+	var data BatchSyncResponse
+	if resp := tc.post("/api/v1/sync/batch", batch, &data); resp.Code != CodeSuccess || len(data.Success) != 2 {
+		t.Fatalf("batch sync = %+v, %+v", resp, data)
+	}
+
+	var changes SyncResponse
+	if resp := tc.post("/api/v1/sync/todos", IncrementalSyncRequest{}, &changes); resp.Code != CodeSuccess {
+		t.Fatalf("incremental sync = %+v", resp)
+	}
+	if len(changes.ChecklistItems) != 4 {
+		t.Fatalf("synced checklist items = %+v", changes.ChecklistItems)
+	}
+	last := changes.ChecklistItems[len(changes.ChecklistItems)-1]
+	if last.TodoUUID != todoUUID || last.Title != "预约" || last.Position != 1 {
+		t.Errorf("synced checklist item = %+v", last)
+	}
+}
+
+func TestSmartListHandlers(t *testing.T) {
+	t.Parallel()
+	// 用户默认时区为 Asia/Shanghai，此时为当地 10 月 16 日上午
+	now := time.Date(2026, 10, 16, 2, 0, 0, 0, time.UTC)
+	tc := newTestClient(t, WithClock(func() time.Time { return now }))
+	tc.login("kate")
+
+	for _, req := range []ExtendedTodoRequest{
+		{Title: "周报", Priority: 2, DueDate: ptr("2026-10-16T15:00:00Z")},   // 当地今天 23:00
+		{Title: "季度总结", Priority: 3, DueDate: ptr("2026-10-16T17:00:00Z")}, // 当地明天 01:00
+		{Title: "旧任务", Priority: 3, DueDate: ptr("2026-10-15T15:00:00Z")},  // 当地昨天
+	} {
+		if resp := tc.post("/api/v1/todos/create", req, nil); resp.Code != CodeSuccess {
+			t.Fatalf("create todo = %+v", resp)
+		}
+	}
+
+	// 定义中的搜索语法错误返回出错位置
+	var syntaxErr SearchErrorResponse
+	bad := SmartListRequest{Name: "错误", Definition: repository.SmartListDefinition{Query: "周报 tag:"}}
+	if resp := tc.post("/api/v1/smart-lists/create", bad, &syntaxErr); resp.Code != CodeInvalidParams || syntaxErr.Offset != 3 {
+		t.Errorf("create with syntax error = %+v, %+v", resp, syntaxErr)
+	}
+	bad = SmartListRequest{Name: "错误", Definition: repository.SmartListDefinition{Sort: []repository.SmartListSort{{Field: "color"}}}}
+	if resp := tc.post("/api/v1/smart-lists/create", bad, nil); resp.Code != CodeInvalidParams {
+		t.Errorf("create with invalid sort code = %d, want %d", resp.Code, CodeInvalidParams)
+	}
+
+	var list repository.SmartList
+	create := SmartListRequest{Name: "今天", Definition: repository.SmartListDefinition{
+		Due: &repository.SmartListDateRange{FromDays: ptr(0), ToDays: ptr(0)},
+	}}
+	if resp := tc.post("/api/v1/smart-lists/create", create, &list); resp.Code != CodeSuccess || list.UUID == "" || list.Icon != "list" {
+		t.Fatalf("create smart list = %+v, %+v", resp, list)
+	}
+
+	var todos []repository.Todo
+	if resp := tc.post("/api/v1/smart-lists/todos", SmartListTodosRequest{SmartListIDRequest: SmartListIDRequest{UUID: list.UUID}}, &todos); resp.Code != CodeSuccess ||
+		len(todos) != 1 || todos[0].Title != "周报" {
+		t.Errorf("today todos = %+v, %+v", resp, todos)
+	}
+
+	update := UpdateSmartListRequest{ID: list.ID, Name: "今明两天", Definition: repository.SmartListDefinition{
+		Due:  &repository.SmartListDateRange{FromDays: ptr(0), ToDays: ptr(1)},
+		Sort: []repository.SmartListSort{{Field: "priority", Order: "desc"}},
+	}}
+	var updated repository.SmartList
+	if resp := tc.post("/api/v1/smart-lists/update", update, &updated); resp.Code != CodeSuccess || updated.Name != "今明两天" || updated.Icon != "list" {
+		t.Fatalf("update smart list = %+v, %+v", resp, updated)
+	}
+
+	// 游标分页
+	var page TodoPageResponse
+	req := SmartListTodosRequest{SmartListIDRequest: SmartListIDRequest{ID: list.ID}, Limit: 1, Cursor: ptr(""), IncludeTotal: true}
+	if resp := tc.post("/api/v1/smart-lists/todos", req, &page); resp.Code != CodeSuccess || len(page.Items) != 1 ||
+		page.Items[0].Title != "季度总结" || !page.HasMore || page.Total == nil || *page.Total != 2 {
+		t.Fatalf("first page = %+v, %+v", resp, page)
+	}
+	req.Cursor = &page.NextCursor
+	var next TodoPageResponse
+	if resp := tc.post("/api/v1/smart-lists/todos", req, &next); resp.Code != CodeSuccess || len(next.Items) != 1 || next.Items[0].Title != "周报" || next.HasMore {
+		t.Errorf("second page = %+v, %+v", resp, next)
+	}
+
+	// 离线创建的智能列表通过批量同步上传，删除后以墓碑同步到其他设备
+	listUUID := "2f4a6c8e-0b1d-4e3f-a5b7-c9d1e3f5a7b9"
+	batch := BatchSyncRequest{SmartLists: []repository.SmartListSyncItem{
+		{UUID: listUUID, Name: "紧急", Definition: repository.SmartListDefinition{Query: "priority:urgent"}},
+	}}
+	var data BatchSyncResponse
+	if resp := tc.post("/api/v1/sync/batch", batch, &data); resp.Code != CodeSuccess || len(data.Success) != 1 || data.Success[0].Type != "smart_list" {
+		t.Fatalf("batch sync = %+v, %+v", resp, data)
+	}
+	var urgent []repository.Todo
+	if resp := tc.post("/api/v1/smart-lists/todos", SmartListTodosRequest{SmartListIDRequest: SmartListIDRequest{UUID: listUUID}}, &urgent); resp.Code != CodeSuccess || len(urgent) != 2 {
+		t.Errorf("synced smart list todos = %+v, %+v", resp, urgent)
+	}
+
+	if resp := tc.post("/api/v1/smart-lists/delete", SmartListIDRequest{UUID: list.UUID}, nil); resp.Code != CodeSuccess {
+		t.Errorf("delete smart list = %+v", resp)
+	}
+	if resp := tc.post("/api/v1/smart-lists/todos", SmartListTodosRequest{SmartListIDRequest: SmartListIDRequest{ID: list.ID}}, nil); resp.Code != CodeNotFound {
+		t.Errorf("deleted smart list todos code = %d, want %d", resp.Code, CodeNotFound)
+	}
+	var lists []repository.SmartList
+	if resp := tc.post("/api/v1/smart-lists", nil, &lists); resp.Code != CodeSuccess || len(lists) != 1 || lists[0].UUID != listUUID {
+		t.Errorf("smart lists = %+v, %+v", resp, lists)
+	}
+
+	var changes SyncResponse
+	if resp := tc.post("/api/v1/sync/todos", IncrementalSyncRequest{Since: updated.SyncVersion}, &changes); resp.Code != CodeSuccess || len(changes.SmartLists) != 2 {
+		t.Fatalf("incremental sync = %+v, %+v", resp, changes.SmartLists)
+	}
+	if tombstone := changes.SmartLists[1]; tombstone.UUID != list.UUID || !tombstone.IsDeleted {
+		t.Errorf("synced tombstone = %+v", tombstone)
+	}
+}
+
+func TestTagHandlers(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("leo")
+
+	for _, req := range []ExtendedTodoRequest{
+		{Title: "周报", Tags: []string{"工做", "重要"}},
+		{Title: "计划", Tags: []string{"work"}},
+		{Title: "复盘", Tags: []string{"工作"}},
+	} {
+		if resp := tc.post("/api/v1/todos/create", req, nil); resp.Code != CodeSuccess {
+			t.Fatalf("create todo = %+v", resp)
+		}
+	}
+
+	var tag repository.Tag
+	if resp := tc.post("/api/v1/tags/create", TagRequest{Name: "工作", Color: "#FF5722"}, &tag); resp.Code != CodeSuccess || tag.Icon != "label" {
+		t.Fatalf("create tag = %+v, %+v", resp, tag)
+	}
+	if resp := tc.post("/api/v1/tags/create", TagRequest{Name: "工作"}, nil); resp.Code != CodeInvalidParams {
+		t.Errorf("create duplicate tag code = %d, want %d", resp.Code, CodeInvalidParams)
+	}
+
+	// 没有元数据的标签更新时自动创建
+	var important repository.Tag
+	if resp := tc.post("/api/v1/tags/update", UpdateTagRequest{Name: "重要", Icon: "flag"}, &important); resp.Code != CodeSuccess ||
+		important.ID == 0 || important.Color != "#9E9E9E" || important.Icon != "flag" {
+		t.Errorf("update implicit tag = %+v, %+v", resp, important)
+	}
+
+	var tags []repository.Tag
+	if resp := tc.post("/api/v1/tags", nil, &tags); resp.Code != CodeSuccess || len(tags) != 4 {
+		t.Fatalf("tags = %+v, %+v", resp, tags)
+	}
+
+	if resp := tc.post("/api/v1/tags/rename", RenameTagRequest{From: "工做", To: "工作"}, nil); resp.Code != CodeInvalidParams {
+		t.Errorf("rename to existing tag code = %d, want %d", resp.Code, CodeInvalidParams)
+	}
+	if resp := tc.post("/api/v1/tags/rename", RenameTagRequest{From: "不存在", To: "新"}, nil); resp.Code != CodeNotFound {
+		t.Errorf("rename missing tag code = %d, want %d", resp.Code, CodeNotFound)
+	}
+
+	var merged TagRewriteResponse
+	if resp := tc.post("/api/v1/tags/merge", MergeTagsRequest{Sources: []string{"工做", "work"}, Target: "工作"}, &merged); resp.Code != CodeSuccess || merged.RewrittenTodos != 2 {
+		t.Fatalf("merge tags = %+v, %+v", resp, merged)
+	}
+	var afterMerge []repository.Tag
+	if resp := tc.post("/api/v1/tags", nil, &afterMerge); resp.Code != CodeSuccess || len(afterMerge) != 2 ||
+		afterMerge[0].Name != "工作" || afterMerge[0].UsageCount != 3 || afterMerge[0].Color != "#FF5722" {
+		t.Errorf("tags after merge = %+v, %+v", resp, afterMerge)
+	}
+
+	var renamed TagRewriteResponse
+	if resp := tc.post("/api/v1/tags/rename", RenameTagRequest{From: "工作", To: "工作事项"}, &renamed); resp.Code != CodeSuccess || renamed.RewrittenTodos != 3 {
+		t.Fatalf("rename tag = %+v, %+v", resp, renamed)
+	}
+	var todos []repository.Todo
+	if resp := tc.post("/api/v1/todos/list", GetTodosRequest{Tags: []string{"工作事项"}}, &todos); resp.Code != CodeSuccess || len(todos) != 3 {
+		t.Errorf("todos with renamed tag = %+v, %d", resp, len(todos))
+	}
+
+	var removed TagRewriteResponse
+	if resp := tc.post("/api/v1/tags/delete", TagNameRequest{Name: "重要"}, &removed); resp.Code != CodeSuccess || removed.RewrittenTodos != 1 {
+		t.Errorf("delete tag = %+v, %+v", resp, removed)
+	}
+
+	// 标签元数据参与增量同步，删除后以墓碑同步
+	var changes SyncResponse
+	if resp := tc.post("/api/v1/sync/todos", IncrementalSyncRequest{Since: important.SyncVersion}, &changes); resp.Code != CodeSuccess {
+		t.Fatalf("incremental sync = %+v", resp)
+	}
+	synced := map[string]bool{}
+	for _, item := range changes.Tags {
+		synced[item.Name] = item.IsDeleted
+	}
+	if deleted, ok := synced["重要"]; !ok || !deleted {
+		t.Errorf("synced tags = %+v", changes.Tags)
+	}
+	if deleted, ok := synced["工作事项"]; !ok || deleted {
+		t.Errorf("synced tags = %+v", changes.Tags)
+	}
+
+	batch := BatchSyncRequest{Tags: []repository.TagSyncItem{{UUID: "6a8c0e2f-4b6d-4f8a-9c1e-3a5c7e9f1b3d", Name: "离线", Color: "#4CAF50"}}}
+	var data BatchSyncResponse
+	if resp := tc.post("/api/v1/sync/batch", batch, &data); resp.Code != CodeSuccess || len(data.Success) != 1 || data.Success[0].Type != "tag" {
+		t.Errorf("batch sync = %+v, %+v", resp, data)
+	}
+}
+
+func TestTodoHistoryHandlers(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("nina")
+
+	var registered DeviceRegisterResponse
+	if resp := tc.post("/api/v1/devices/register", DeviceRequest{Name: "iPad", Platform: "ios"}, &registered); resp.Code != CodeSuccess {
+		t.Fatalf("register device = %+v", resp)
+	}
+	tc.token = registered.Token
+
+	var created repository.Todo
+	if resp := tc.post("/api/v1/todos/create", ExtendedTodoRequest{Title: "写周报", Priority: 1}, &created); resp.Code != CodeSuccess {
+		t.Fatalf("create todo = %+v", resp)
+	}
+	update := UpdateExtendedTodoRequest{UUID: created.UUID, Title: ptr("写月报"), Completed: ptr(true)}
+	if resp := tc.post("/api/v1/todos/update", update, nil); resp.Code != CodeSuccess {
+		t.Fatalf("update todo = %+v", resp)
+	}
+
+	var history []repository.Revision
+	if resp := tc.post("/api/v1/todos/history", TodoHistoryRequest{UUID: created.UUID}, &history); resp.Code != CodeSuccess || len(history) != 2 {
+		t.Fatalf("history = %+v, %+v", resp, history)
+	}
+	latest, first := history[0], history[1]
+	if latest.Action != repository.RevisionUpdate || latest.DeviceID != registered.Device.ID || latest.SyncVersion <= created.SyncVersion ||
+		string(latest.Changes["title"].Old) != `"写周报"` || string(latest.Changes["title"].New) != `"写月报"` {
+		t.Errorf("update revision = %+v", latest)
+	}
+	if first.Action != repository.RevisionCreate {
+		t.Errorf("create revision = %+v", first)
+	}
+
+	var reverted repository.Todo
+	if resp := tc.post("/api/v1/todos/revert", RevertTodoRequest{ID: created.ID, RevisionID: first.ID}, &reverted); resp.Code != CodeSuccess {
+		t.Fatalf("revert = %+v", resp)
+	}
+	if reverted.Title != "写周报" || reverted.Completed || reverted.SyncVersion <= latest.SyncVersion {
+		t.Errorf("reverted todo = %+v", reverted)
+	}
+	var afterRevert []repository.Revision
+	if resp := tc.post("/api/v1/todos/history", TodoHistoryRequest{ID: created.ID}, &afterRevert); resp.Code != CodeSuccess ||
+		len(afterRevert) != 3 || afterRevert[0].SyncVersion != reverted.SyncVersion {
+		t.Errorf("history after revert = %+v, %+v", resp, afterRevert)
+	}
+
+	if resp := tc.post("/api/v1/todos/revert", RevertTodoRequest{ID: created.ID, RevisionID: first.ID + 100}, nil); resp.Code != CodeNotFound {
+		t.Errorf("revert missing revision code = %d, want %d", resp.Code, CodeNotFound)
+	}
+	if resp := tc.post("/api/v1/todos/history", TodoHistoryRequest{UUID: "00000000-0000-4000-8000-000000000000"}, nil); resp.Code != CodeNotFound {
+		t.Errorf("history of missing todo code = %d, want %d", resp.Code, CodeNotFound)
+	}
+
+	// 其他用户不能查看或回滚
+	tc.login("oscar")
+	var foreign []repository.Revision
+	if resp := tc.post("/api/v1/todos/history", TodoHistoryRequest{ID: created.ID}, &foreign); resp.Code != CodeSuccess || len(foreign) != 0 {
+		t.Errorf("foreign history = %+v, %+v", resp, foreign)
+	}
+	if resp := tc.post("/api/v1/todos/revert", RevertTodoRequest{ID: created.ID, RevisionID: first.ID}, nil); resp.Code != CodeNotFound {
+		t.Errorf("foreign revert code = %d, want %d", resp.Code, CodeNotFound)
+	}
+}
+
+func TestTrashHandlers(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("paul")
+
+	var category repository.Category
+	if resp := tc.post("/api/v1/categories/create", CategoryRequest{Name: "工作"}, &category); resp.Code != CodeSuccess {
+		t.Fatalf("create category = %+v", resp)
+	}
+	var report, milk repository.Todo
+	if resp := tc.post("/api/v1/todos/create", ExtendedTodoRequest{Title: "周报", CategoryID: &category.ID}, &report); resp.Code != CodeSuccess {
+		t.Fatalf("create todo = %+v", resp)
+	}
+	if resp := tc.post("/api/v1/todos/create", ExtendedTodoRequest{Title: "买牛奶"}, &milk); resp.Code != CodeSuccess {
+		t.Fatalf("create todo = %+v", resp)
+	}
+
+	for _, req := range []DeleteExtendedTodoRequest{{UUID: report.UUID}, {ID: milk.ID}} {
+		if resp := tc.post("/api/v1/todos/delete", req, nil); resp.Code != CodeSuccess {
+			t.Fatalf("delete todo = %+v", resp)
+		}
+	}
+	if resp := tc.post("/api/v1/todos/delete", DeleteExtendedTodoRequest{ID: milk.ID}, nil); resp.Code != CodeNotFound {
+		t.Errorf("delete deleted todo code = %d, want %d", resp.Code, CodeNotFound)
+	}
+	if resp := tc.post("/api/v1/categories/delete", DeleteCategoryRequest{ID: category.ID}, nil); resp.Code != CodeSuccess {
+		t.Fatalf("delete category = %+v", resp)
+	}
+
+	var trash TrashResponse
+	if resp := tc.post("/api/v1/trash", TrashRequest{}, &trash); resp.Code != CodeSuccess ||
+		len(trash.Todos) != 2 || len(trash.Categories) != 1 || !trash.Todos[0].IsDeleted {
+		t.Fatalf("trash = %+v, %+v", resp, trash)
+	}
+	var todos []repository.Todo
+	if resp := tc.post("/api/v1/todos/list", GetTodosRequest{}, &todos); resp.Code != CodeSuccess || len(todos) != 0 {
+		t.Errorf("todos after delete = %+v, %+v", resp, todos)
+	}
+
+	// 先恢复分类，再恢复TODO时保留分类
+	var restoredCategory RestoreTrashResponse
+	if resp := tc.post("/api/v1/trash/restore", TrashItemRequest{Type: "category", UUID: category.UUID}, &restoredCategory); resp.Code != CodeSuccess ||
+		restoredCategory.Category == nil || restoredCategory.Category.IsDeleted {
+		t.Fatalf("restore category = %+v, %+v", resp, restoredCategory)
+	}
+	var restored RestoreTrashResponse
+	if resp := tc.post("/api/v1/trash/restore", TrashItemRequest{Type: "todo", ID: report.ID}, &restored); resp.Code != CodeSuccess ||
+		restored.Todo == nil || restored.Todo.IsDeleted || restored.Todo.CategoryID == nil || *restored.Todo.CategoryID != category.ID {
+		t.Fatalf("restore todo = %+v, %+v", resp, restored)
+	}
+	if resp := tc.post("/api/v1/trash/restore", TrashItemRequest{Type: "todo", ID: report.ID}, nil); resp.Code != CodeNotFound {
+		t.Errorf("restore live todo code = %d, want %d", resp.Code, CodeNotFound)
+	}
+	if resp := tc.post("/api/v1/trash/restore", TrashItemRequest{Type: "note", ID: report.ID}, nil); resp.Code != CodeInvalidParams {
+		t.Errorf("restore unknown type code = %d, want %d", resp.Code, CodeInvalidParams)
+	}
+
+	if resp := tc.post("/api/v1/trash/delete", TrashItemRequest{Type: "todo", UUID: milk.UUID}, nil); resp.Code != CodeSuccess {
+		t.Fatalf("delete trash todo = %+v", resp)
+	}
+	if resp := tc.post("/api/v1/trash/delete", TrashItemRequest{Type: "todo", UUID: milk.UUID}, nil); resp.Code != CodeNotFound {
+		t.Errorf("delete purged todo code = %d, want %d", resp.Code, CodeNotFound)
+	}
+
+	if resp := tc.post("/api/v1/todos/delete", DeleteExtendedTodoRequest{ID: report.ID}, nil); resp.Code != CodeSuccess {
+		t.Fatalf("delete todo = %+v", resp)
+	}
+	var emptied EmptyTrashResponse
+	if resp := tc.post("/api/v1/trash/empty", nil, &emptied); resp.Code != CodeSuccess || emptied.DeletedTodos != 1 || emptied.DeletedCategories != 0 {
+		t.Errorf("empty trash = %+v, %+v", resp, emptied)
+	}
+	var empty TrashResponse
+	if resp := tc.post("/api/v1/trash", TrashRequest{}, &empty); resp.Code != CodeSuccess || len(empty.Todos) != 0 || len(empty.Categories) != 0 {
+		t.Errorf("trash after empty = %+v, %+v", resp, empty)
+	}
+}
+
+func TestReminderDeliveryHandlers(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("paula")
+
+	var registered DeviceRegisterResponse
+	device := DeviceRequest{Name: "iPhone", Platform: "ios", PushToken: "phone-token"}
+	if resp := tc.post("/api/v1/devices/register", device, &registered); resp.Code != CodeSuccess {
+		t.Fatalf("register device = %+v", resp)
+	}
+	stored, err := tc.server.store.GetDeviceByID(registered.Device.ID, registered.Device.UserID)
+	if err != nil || stored.PushToken != "phone-token" {
+		t.Fatalf("stored device = %+v, %v", stored, err)
+	}
+
+	reminder := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	var created repository.Todo
+	if resp := tc.post("/api/v1/todos/create", ExtendedTodoRequest{Title: "交水费", Reminder: &reminder}, &created); resp.Code != CodeSuccess {
+		t.Fatalf("create todo = %+v", resp)
+	}
+
+	var pushed []string
+	apns := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushed = append(pushed, strings.TrimPrefix(r.URL.Path, "/3/device/"))
+	}))
+	defer apns.Close()
+	scheduler := notify.NewScheduler(tc.server.store, []notify.Notifier{notify.NewPushNotifier(apns.URL, "com.example.todo", "")}, &notify.Config{})
+	if _, err := scheduler.Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch() error = %v", err)
+	}
+	if len(pushed) != 1 || pushed[0] != "phone-token" {
+		t.Errorf("pushed = %v", pushed)
+	}
+
+	var deliveries []repository.ReminderDelivery
+	if resp := tc.post("/api/v1/todos/reminders", ReminderDeliveriesRequest{UUID: created.UUID}, &deliveries); resp.Code != CodeSuccess ||
+		len(deliveries) != 1 || deliveries[0].Channel != notify.ChannelPush || deliveries[0].Status != repository.DeliverySent || deliveries[0].Attempts != 1 {
+		t.Errorf("deliveries = %+v, %+v", resp, deliveries)
+	}
+	if resp := tc.post("/api/v1/todos/reminders", ReminderDeliveriesRequest{UUID: "00000000-0000-4000-8000-000000000000"}, nil); resp.Code != CodeNotFound {
+		t.Errorf("deliveries of missing todo code = %d, want %d", resp.Code, CodeNotFound)
+	}
+
+	tc.login("quinn")
+	var foreign []repository.ReminderDelivery
+	if resp := tc.post("/api/v1/todos/reminders", ReminderDeliveriesRequest{ID: created.ID}, &foreign); resp.Code != CodeSuccess || len(foreign) != 0 {
+		t.Errorf("foreign deliveries = %+v, %+v", resp, foreign)
+	}
+}
+
+func TestDailyDigestSettings(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("rosa")
+
+	var settings repository.UserSettings
+	if resp := tc.post("/api/v1/settings", nil, &settings); resp.Code != CodeSuccess || !settings.DailyDigest {
+		t.Fatalf("default settings = %+v, %+v", resp, settings)
+	}
+
+	update := UserSettingsRequest{Theme: "dark", NotificationTime: "00:00", Language: "en-US", TimeZone: "UTC", DailyDigest: ptr(false)}
+	if resp := tc.post("/api/v1/settings/update", update, nil); resp.Code != CodeSuccess {
+		t.Fatalf("update settings = %+v", resp)
+	}
+	// 不传 daily_digest 时保持不变
+	update.DailyDigest = nil
+	if resp := tc.post("/api/v1/settings/update", update, nil); resp.Code != CodeSuccess {
+		t.Fatalf("update settings = %+v", resp)
+	}
+	if resp := tc.post("/api/v1/settings", nil, &settings); resp.Code != CodeSuccess || settings.DailyDigest || settings.Theme != "dark" {
+		t.Fatalf("settings after opt-out = %+v, %+v", resp, settings)
+	}
+
+	due := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	if resp := tc.post("/api/v1/todos/create", ExtendedTodoRequest{Title: "Pay rent", DueDate: &due}, nil); resp.Code != CodeSuccess {
+		t.Fatalf("create todo = %+v", resp)
+	}
+
+	var received []notify.WebhookPayload
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload notify.WebhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		received = append(received, payload)
+	}))
+	defer webhook.Close()
+	scheduler := notify.NewDigestScheduler(tc.server.store, []notify.Notifier{notify.NewWebhookNotifier(webhook.URL, "")}, &notify.Config{})
+	if _, err := scheduler.Dispatch(context.Background()); err != nil || len(received) != 0 {
+		t.Fatalf("Dispatch(opted out) = %v, received %+v", err, received)
+	}
+
+	update.DailyDigest = ptr(true)
+	if resp := tc.post("/api/v1/settings/update", update, nil); resp.Code != CodeSuccess {
+		t.Fatalf("update settings = %+v", resp)
+	}
+	if _, err := scheduler.Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch() error = %v", err)
+	}
+	if len(received) != 1 || received[0].Event != notify.WebhookDigestEvent || received[0].Digest == nil ||
+		len(received[0].Digest.Overdue) != 1 || !strings.HasPrefix(received[0].Title, "Daily digest") {
+		t.Errorf("received = %+v", received)
+	}
+}
+
+func TestWebhookHandlers(t *testing.T) {
+	t.Parallel()
+	// 默认不能登记本机和内网地址
+	strict := newTestClient(t)
+	strict.login("sara")
+	for _, target := range []string{"http://localhost:8080/hook", "http://127.0.0.1/hook", "http://169.254.169.254/latest/meta-data", "http://[::1]/hook", "https://10.0.0.8/hook"} {
+		if resp := strict.post("/api/v1/webhooks/create", CreateWebhookRequest{URL: target}, nil); resp.Code != CodeInvalidParams {
+			t.Errorf("create webhook %s code = %d, want %d", target, resp.Code, CodeInvalidParams)
+		}
+	}
+
+	// 测试中的接收服务在本机
+	tc := newTestClient(t, WithAdmins("admin"), WithPrivateWebhooks(true))
+	tc.login("sara")
+
+	invalid := []CreateWebhookRequest{
+		{URL: "ftp://example.com/hook"},
+		{URL: "https://example.com/hook", Events: []string{"todo.archived"}},
+		{URL: "https://example.com/hook", Events: []string{"todos.*"}},
+		{URL: "https://example.com/hook", AllUsers: true},
+	}
+	for _, req := range invalid {
+		if resp := tc.post("/api/v1/webhooks/create", req, nil); resp.Code != CodeInvalidParams {
+			t.Errorf("create %+v code = %d, want %d", req, resp.Code, CodeInvalidParams)
+		}
+	}
+
+	var received []repository.WebhookEvent
+	var signatures []string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event repository.WebhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		received = append(received, event)
+		signatures = append(signatures, r.Header.Get(notify.SignatureHeader))
+	}))
+	defer receiver.Close()
+
+	var endpoint repository.WebhookEndpoint
+	create := CreateWebhookRequest{URL: receiver.URL, Events: []string{"todo.completed", "category.*"}}
+	if resp := tc.post("/api/v1/webhooks/create", create, &endpoint); resp.Code != CodeSuccess ||
+		!strings.HasPrefix(endpoint.Secret, "whsec_") || !endpoint.Enabled {
+		t.Fatalf("create webhook = %+v, %+v", resp, endpoint)
+	}
+	var endpoints []repository.WebhookEndpoint
+	if resp := tc.post("/api/v1/webhooks", nil, &endpoints); resp.Code != CodeSuccess || len(endpoints) != 1 || endpoints[0].Secret != "" {
+		t.Fatalf("list webhooks = %+v, %+v", resp, endpoints)
+	}
+
+	var todo repository.Todo
+	if resp := tc.post("/api/v1/todos/create", ExtendedTodoRequest{Title: "发布版本"}, &todo); resp.Code != CodeSuccess {
+		t.Fatalf("create todo = %+v", resp)
+	}
+	update := UpdateExtendedTodoRequest{ID: todo.ID, Completed: ptr(true)}
+	if resp := tc.post("/api/v1/todos/update", update, nil); resp.Code != CodeSuccess {
+		t.Fatalf("complete todo = %+v", resp)
+	}
+	dispatcher := notify.NewEventDispatcher(tc.server.store, &notify.Config{WebhookAllowPrivate: true})
+	if _, err := dispatcher.Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch() error = %v", err)
+	}
+	if len(received) != 1 || received[0].Type != repository.WebhookTodoCompleted || received[0].EntityUUID != todo.UUID {
+		t.Fatalf("received = %+v", received)
+	}
+	var timestamp int64
+	var signature string
+	fmt.Sscanf(signatures[0], "t=%d,v1=%s", &timestamp, &signature)
+	body, _ := json.Marshal(received[0])
+	if signature != notify.Sign(endpoint.Secret, timestamp, body) {
+		t.Errorf("signature %q does not match secret", signatures[0])
+	}
+
+	var deliveries []repository.WebhookDelivery
+	if resp := tc.post("/api/v1/webhooks/deliveries", WebhookDeliveriesRequest{ID: endpoint.ID}, &deliveries); resp.Code != CodeSuccess ||
+		len(deliveries) != 1 || deliveries[0].Status != repository.DeliverySent {
+		t.Fatalf("deliveries = %+v, %+v", resp, deliveries)
+	}
+	var replay repository.WebhookDelivery
+	if resp := tc.post("/api/v1/webhooks/replay", ReplayWebhookRequest{ID: endpoint.ID, DeliveryID: deliveries[0].ID}, &replay); resp.Code != CodeSuccess ||
+		replay.EventID != deliveries[0].EventID || replay.Status != repository.DeliveryPending {
+		t.Fatalf("replay = %+v, %+v", resp, replay)
+	}
+	if _, err := dispatcher.Dispatch(context.Background()); err != nil || len(received) != 2 || received[1].ID != received[0].ID {
+		t.Errorf("Dispatch(replay) = %v, received %+v", err, received)
+	}
+
+	// 停用后不能重放；重新生成密钥时返回新密钥
+	var updated repository.WebhookEndpoint
+	disable := UpdateWebhookRequest{ID: endpoint.ID, URL: receiver.URL, Events: create.Events, Enabled: ptr(false), RotateSecret: true}
+	if resp := tc.post("/api/v1/webhooks/update", disable, &updated); resp.Code != CodeSuccess ||
+		updated.Enabled || updated.Secret == "" || updated.Secret == endpoint.Secret {
+		t.Fatalf("update webhook = %+v, %+v", resp, updated)
+	}
+	if resp := tc.post("/api/v1/webhooks/replay", ReplayWebhookRequest{ID: endpoint.ID, DeliveryID: deliveries[0].ID}, nil); resp.Code != CodeInvalidParams {
+		t.Errorf("replay disabled webhook code = %d, want %d", resp.Code, CodeInvalidParams)
+	}
+
+	// 其他用户看不到该Webhook，管理员可以接收全部用户的事件
+	tc.login("admin")
+	if resp := tc.post("/api/v1/webhooks/deliveries", WebhookDeliveriesRequest{ID: endpoint.ID}, nil); resp.Code != CodeNotFound {
+		t.Errorf("other user's deliveries code = %d, want %d", resp.Code, CodeNotFound)
+	}
+	if resp := tc.post("/api/v1/webhooks/delete", DeleteWebhookRequest{ID: endpoint.ID}, nil); resp.Code != CodeNotFound {
+		t.Errorf("delete other user's webhook code = %d, want %d", resp.Code, CodeNotFound)
+	}
+	if resp := tc.post("/api/v1/webhooks/create", CreateWebhookRequest{URL: receiver.URL, AllUsers: true}, nil); resp.Code != CodeSuccess {
+		t.Errorf("admin create all_users webhook = %+v", resp)
+	}
+}
+
+func TestCalendarFeedHandlers(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("tina")
+
+	var category repository.Category
+	if resp := tc.post("/api/v1/categories/create", CategoryRequest{Name: "工作"}, &category); resp.Code != CodeSuccess {
+		t.Fatalf("create category = %+v", resp)
+	}
+	for _, req := range []ExtendedTodoRequest{
+		{Title: "周报", Priority: 3, DueDate: ptr("2026-10-23T10:00:00Z"), Reminder: ptr("2026-10-23T09:00:00Z"), CategoryID: &category.ID, Tags: []string{"每周"}},
+		{Title: "买牛奶", DueDate: ptr("2026-10-20T10:00:00Z")},
+		{Title: "读书"},
+	} {
+		if resp := tc.post("/api/v1/todos/create", req, nil); resp.Code != CodeSuccess {
+			t.Fatalf("create todo = %+v", resp)
+		}
+	}
+
+	if resp := tc.post("/api/v1/calendar/feeds/create", CreateCalendarFeedRequest{CategoryID: ptr(999)}, nil); resp.Code != CodeNotFound {
+		t.Errorf("create feed with unknown category code = %d, want %d", resp.Code, CodeNotFound)
+	}
+	var all, work CalendarFeedResponse
+	if resp := tc.post("/api/v1/calendar/feeds/create", CreateCalendarFeedRequest{Name: "全部"}, &all); resp.Code != CodeSuccess ||
+		all.Token == "" || all.URL != "http://example.com/api/calendar/"+all.Token+".ics" {
+		t.Fatalf("create feed = %+v, %+v", resp, all)
+	}
+	if resp := tc.post("/api/v1/calendar/feeds/create", CreateCalendarFeedRequest{CategoryUUID: category.UUID}, &work); resp.Code != CodeSuccess ||
+		work.Feed.Name != "工作" || work.Feed.CategoryID == nil || *work.Feed.CategoryID != category.ID {
+		t.Fatalf("create category feed = %+v, %+v", resp, work)
+	}
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		rec := httptest.NewRecorder()
+		tc.handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/calendar/"+all.Token+".ics", nil)
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/calendar; charset=utf-8" ||
+		strings.Count(body, "BEGIN:VTODO") != 2 || strings.Contains(body, "读书") ||
+		!strings.Contains(body, "X-WR-CALNAME:全部\r\n") || !strings.Contains(body, "PRIORITY:1\r\n") ||
+		!strings.Contains(body, "CATEGORIES:工作,每周\r\n") || !strings.Contains(body, "TRIGGER;VALUE=DATE-TIME:20261023T090000Z\r\n") {
+		t.Fatalf("GET feed = %d %q\n%s", rec.Code, rec.Header().Get("Content-Type"), body)
+	}
+	if rec := get("/api/calendar/"+all.Token+".ics", http.Header{"If-None-Match": {rec.Header().Get("ETag")}}); rec.Code != http.StatusNotModified {
+		t.Errorf("GET feed with If-None-Match status = %d, want 304", rec.Code)
+	}
+	if body := get("/api/calendar/"+work.Token+"?type=event", nil).Body.String(); strings.Count(body, "BEGIN:VEVENT") != 1 ||
+		!strings.Contains(body, "SUMMARY:周报\r\n") || strings.Contains(body, "VTODO") {
+		t.Errorf("GET category feed as events =\n%s", body)
+	}
+
+	var feeds []repository.CalendarFeed
+	if resp := tc.post("/api/v1/calendar/feeds", nil, &feeds); resp.Code != CodeSuccess || len(feeds) != 2 || feeds[0].LastAccessedAt == nil {
+		t.Fatalf("list feeds = %+v, %+v", resp, feeds)
+	}
+
+	// 重新生成令牌后旧地址失效，删除后新地址也失效
+	var rotated CalendarFeedResponse
+	if resp := tc.post("/api/v1/calendar/feeds/rotate", RotateCalendarFeedRequest{ID: all.Feed.ID}, &rotated); resp.Code != CodeSuccess || rotated.Token == all.Token {
+		t.Fatalf("rotate feed = %+v, %+v", resp, rotated)
+	}
+	if rec := get("/api/calendar/"+all.Token+".ics", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET rotated feed status = %d, want 404", rec.Code)
+	}
+	if rec := get("/api/calendar/"+rotated.Token+".ics", nil); rec.Code != http.StatusOK {
+		t.Errorf("GET new feed status = %d, want 200", rec.Code)
+	}
+	if resp := tc.post("/api/v1/calendar/feeds/delete", DeleteCalendarFeedRequest{ID: all.Feed.ID}, nil); resp.Code != CodeSuccess {
+		t.Fatalf("delete feed = %+v", resp)
+	}
+	if rec := get("/api/calendar/"+rotated.Token+".ics", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET deleted feed status = %d, want 404", rec.Code)
+	}
+
+	// 其他用户不能管理该订阅
+	tc.login("uma")
+	if resp := tc.post("/api/v1/calendar/feeds/rotate", RotateCalendarFeedRequest{ID: work.Feed.ID}, nil); resp.Code != CodeNotFound {
+		t.Errorf("rotate other user's feed code = %d, want %d", resp.Code, CodeNotFound)
+	}
+}
+
+func TestCalDAV(t *testing.T) {
+	t.Parallel()
+	var logs bytes.Buffer
+	tc := newTestClient(t, WithLogger(log.New(&logs, "", 0)))
+	tc.login("vera")
+
+	var category repository.Category
+	if resp := tc.post("/api/v1/categories/create", CategoryRequest{Name: "工作", Color: "#FF5722"}, &category); resp.Code != CodeSuccess {
+		t.Fatalf("create category = %+v", resp)
+	}
+	var report repository.Todo
+	create := ExtendedTodoRequest{Title: "周报", Priority: 2, DueDate: ptr("2026-10-23T10:00:00Z"), CategoryID: &category.ID, Tags: []string{"每周"}}
+	if resp := tc.post("/api/v1/todos/create", create, &report); resp.Code != CodeSuccess {
+		t.Fatalf("create todo = %+v", resp)
+	}
+
+	var app AppPasswordResponse
+	if resp := tc.post("/api/v1/caldav/passwords/create", CreateAppPasswordRequest{Name: "Mac"}, &app); resp.Code != CodeSuccess {
+		t.Fatalf("create app password = %+v", resp)
+	}
+
+	dav := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.SetBasicAuth("vera", app.Password)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		tc.handler.ServeHTTP(rec, req)
+		return rec
+	}
+	propfind := func(props string) string {
+		return `<?xml version="1.0"?><d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/"><d:prop>` +
+			props + `</d:prop></d:propfind>`
+	}
+	home := "/caldav/calendars/vera/"
+	work := home + category.UUID + "/"
+
+	// 发现服务：OPTIONS不需要认证，其他请求需要基本认证
+	if rec := dav(http.MethodOptions, "/caldav/", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("DAV"), "calendar-access") ||
+		!strings.Contains(rec.Header().Get("Access-Control-Allow-Methods"), "PROPFIND") ||
+		!strings.Contains(rec.Header().Get("Access-Control-Allow-Headers"), "If-Match") {
+		t.Fatalf("OPTIONS = %d %v", rec.Code, rec.Header())
+	}
+	req := httptest.NewRequest("PROPFIND", "/caldav/", nil)
+	rec := httptest.NewRecorder()
+	tc.handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("PROPFIND without credentials = %d", rec.Code)
+	}
+	rec = dav("PROPFIND", "/caldav/", propfind("<d:current-user-principal/><c:calendar-home-set/>"), "Depth", "0")
+	if body := rec.Body.String(); rec.Code != http.StatusMultiStatus ||
+		!strings.Contains(body, "<d:current-user-principal><d:href>/caldav/principals/vera/</d:href></d:current-user-principal>") ||
+		!strings.Contains(body, "<c:calendar-home-set><d:href>"+home+"</d:href></c:calendar-home-set>") {
+		t.Fatalf("PROPFIND root = %d\n%s", rec.Code, body)
+	}
+
+	// 每个分类是一个任务日历，另有收件箱日历
+	rec = dav("PROPFIND", home, propfind("<d:displayname/><d:resourcetype/><cs:getctag/><d:sync-token/><x:unknown xmlns:x=\"urn:x\"/>"), "Depth", "1")
+	body := rec.Body.String()
+	if rec.Code != http.StatusMultiStatus || !strings.Contains(body, "<d:href>"+home+"inbox/</d:href>") ||
+		!strings.Contains(body, "<d:href>"+work+"</d:href><d:propstat><d:prop><d:displayname>工作</d:displayname><d:resourcetype><d:collection/><c:calendar/></d:resourcetype>") ||
+		!strings.Contains(body, `<x:unknown xmlns:x="urn:x"/></d:prop><d:status>HTTP/1.1 404 Not Found</d:status>`) {
+		t.Fatalf("PROPFIND home = %d\n%s", rec.Code, body)
+	}
+	syncToken := body[strings.Index(body, "<d:sync-token>")+len("<d:sync-token>") : strings.Index(body, "</d:sync-token>")]
+
+	etag := fmt.Sprintf(`"%d"`, report.SyncVersion)
+	rec = dav("PROPFIND", work, propfind("<d:getetag/>"), "Depth", "1")
+	if body := rec.Body.String(); !strings.Contains(body, "<d:href>"+work+report.UUID+".ics</d:href><d:propstat><d:prop><d:getetag>"+xmlText(etag)+"</d:getetag>") {
+		t.Fatalf("PROPFIND calendar = %d\n%s", rec.Code, body)
+	}
+	rec = dav(http.MethodGet, work+report.UUID+".ics", "")
+	if body := rec.Body.String(); rec.Code != http.StatusOK || rec.Header().Get("ETag") != etag ||
+		!strings.Contains(body, "UID:"+report.UUID+"\r\n") || !strings.Contains(body, "CATEGORIES:工作,每周\r\n") {
+		t.Fatalf("GET = %d %q\n%s", rec.Code, rec.Header().Get("ETag"), body)
+	}
+
+	// 在收件箱中创建TODO
+	milk := uuid.NewString()
+	vtodo := func(uid, extra string) string {
+		return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Test//EN\r\nBEGIN:VTODO\r\nUID:" + uid + "\r\nSUMMARY:买牛奶\r\n" +
+			"DUE:20261021T090000Z\r\nPRIORITY:5\r\nCATEGORIES:购物\r\n" + extra +
+			"BEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER;RELATED=END:-PT30M\r\nEND:VALARM\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+	}
+	if rec := dav(http.MethodPut, home+"inbox/"+milk+".ics", vtodo(uuid.NewString(), "")); rec.Code != http.StatusBadRequest {
+		t.Errorf("PUT with mismatched UID = %d, want 400", rec.Code)
+	}
+	oversized := vtodo(milk, "DESCRIPTION:"+strings.Repeat("x", caldavMaxBody)+"\r\n")
+	if rec := dav(http.MethodPut, home+"inbox/"+milk+".ics", oversized); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("PUT oversized = %d, want 413", rec.Code)
+	}
+	if rec := dav(http.MethodPut, home+"inbox/"+milk+".ics", vtodo(milk, ""), "If-None-Match", "*"); rec.Code != http.StatusCreated {
+		t.Fatalf("PUT new = %d %s", rec.Code, rec.Body.String())
+	}
+	// CalDAV请求体不写入日志
+	if strings.Contains(logs.String(), "SUMMARY:") || !strings.Contains(logs.String(), "<CalDAV, not logged>") {
+		t.Errorf("logs =\n%s", logs.String())
+	}
+	if rec := dav(http.MethodPut, home+"inbox/"+milk+".ics", vtodo(milk, ""), "If-None-Match", "*"); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT existing with If-None-Match = %d, want 412", rec.Code)
+	}
+	user, _ := tc.server.store.GetUserByUsername("vera")
+	created, err := tc.server.store.GetTodoByUUID(user.ID, milk)
+	if err != nil || created.Title != "买牛奶" || created.CategoryID != nil || created.Priority != repository.PriorityMedium ||
+		len(created.Tags) != 1 || created.Tags[0] != "购物" || created.DueDate == nil ||
+		created.Reminder == nil || !created.Reminder.Equal(created.DueDate.Add(-30*time.Minute)) {
+		t.Fatalf("created todo = %+v, %v", created, err)
+	}
+
+	// 修改时校验 ETag，移到其他日历即修改分类
+	milkETag := fmt.Sprintf(`"%d"`, created.SyncVersion)
+	if rec := dav(http.MethodPut, work+milk+".ics", vtodo(milk, "STATUS:COMPLETED\r\n"), "If-Match", `"1"`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with stale If-Match = %d, want 412", rec.Code)
+	}
+	if rec := dav(http.MethodPut, work+milk+".ics", vtodo(milk, "STATUS:COMPLETED\r\n"), "If-Match", milkETag); rec.Code != http.StatusNoContent {
+		t.Fatalf("PUT update = %d %s", rec.Code, rec.Body.String())
+	}
+	// CalDAV的修改对JSON API可见
+	var todos []repository.Todo
+	if resp := tc.post("/api/v1/todos/list", GetTodosRequest{Completed: ptr(true)}, &todos); resp.Code != CodeSuccess {
+		t.Fatalf("list todos = %+v", resp)
+	}
+	if len(todos) != 1 || todos[0].UUID != milk || todos[0].CategoryID == nil || *todos[0].CategoryID != category.ID ||
+		todos[0].SyncVersion <= created.SyncVersion {
+		t.Fatalf("list todos = %+v", todos)
+	}
+	todo := todos[0]
+	if rec := dav(http.MethodGet, home+"inbox/"+milk+".ics", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET moved todo from old calendar = %d, want 404", rec.Code)
+	}
+
+	// 查询未完成的TODO和按地址批量获取
+	query := `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><d:getetag/></d:prop>` +
+		`<c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VTODO"><c:prop-filter name="COMPLETED"><c:is-not-defined/></c:prop-filter>` +
+		`</c:comp-filter></c:comp-filter></c:filter></c:calendar-query>`
+	if body := dav("REPORT", work, query, "Depth", "1").Body.String(); !strings.Contains(body, report.UUID) || strings.Contains(body, milk) {
+		t.Errorf("calendar-query =\n%s", body)
+	}
+	multiget := `<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><d:getetag/><c:calendar-data/></d:prop>` +
+		`<d:href>` + work + milk + `.ics</d:href><d:href>` + work + uuid.NewString() + `.ics</d:href></c:calendar-multiget>`
+	if body := dav("REPORT", work, multiget).Body.String(); !strings.Contains(body, "STATUS:COMPLETED") ||
+		!strings.Contains(body, "<d:status>HTTP/1.1 404 Not Found</d:status>") {
+		t.Errorf("calendar-multiget =\n%s", body)
+	}
+
+	// 删除后移入回收站，增量同步中返回404
+	if rec := dav(http.MethodDelete, work+milk+".ics", "", "If-Match", fmt.Sprintf(`"%d"`, todo.SyncVersion)); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d", rec.Code)
+	}
+	if deleted, err := tc.server.store.GetTodoByUUID(user.ID, milk); err != nil || !deleted.IsDeleted {
+		t.Fatalf("deleted todo = %+v, %v", deleted, err)
+	}
+	sync := `<d:sync-collection xmlns:d="DAV:"><d:sync-token>` + syncToken + `</d:sync-token><d:sync-level>1</d:sync-level><d:prop><d:getetag/></d:prop></d:sync-collection>`
+	body = dav("REPORT", work, sync).Body.String()
+	if !strings.Contains(body, "<d:href>"+work+milk+".ics</d:href><d:status>HTTP/1.1 404 Not Found</d:status>") ||
+		strings.Contains(body, report.UUID) || !strings.Contains(body, "<d:sync-token>") {
+		t.Errorf("sync-collection =\n%s", body)
+	}
+	if rec := dav("REPORT", work, strings.Replace(sync, syncToken, "bogus", 1)); rec.Code != http.StatusForbidden {
+		t.Errorf("sync-collection with invalid token = %d, want 403", rec.Code)
+	}
+
+	// 被删除的TODO可以重新上传
+	if rec := dav(http.MethodPut, home+"inbox/"+milk+".ics", vtodo(milk, "")); rec.Code != http.StatusNoContent {
+		t.Errorf("PUT deleted todo = %d, want 204", rec.Code)
+	}
+	if rec := dav(http.MethodGet, home+"inbox/"+milk+".ics", ""); rec.Code != http.StatusOK {
+		t.Errorf("GET restored todo = %d, want 200", rec.Code)
+	}
+
+	// 不能访问其他用户的地址
+	if rec := dav("PROPFIND", "/caldav/calendars/someone/", "", "Depth", "1"); rec.Code != http.StatusNotFound {
+		t.Errorf("PROPFIND other user's home = %d, want 404", rec.Code)
+	}
+}
+
+func TestCalDAVAuth(t *testing.T) {
+	t.Parallel()
+	tc := newTestClient(t)
+	tc.login("walt")
+
+	var app AppPasswordResponse
+	if resp := tc.post("/api/v1/caldav/passwords/create", CreateAppPasswordRequest{Name: "iPhone"}, &app); resp.Code != CodeSuccess ||
+		app.Password == "" || app.Username != "walt" || app.URL != "http://example.com/caldav/" {
+		t.Fatalf("create app password = %+v, %+v", resp, app)
+	}
+	var passwords []repository.AppPassword
+	if resp := tc.post("/api/v1/caldav/passwords", nil, &passwords); resp.Code != CodeSuccess || len(passwords) != 1 || passwords[0].Name != "iPhone" {
+		t.Fatalf("list app passwords = %+v, %+v", resp, passwords)
+	}
+
+	propfind := func(ip, username, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PROPFIND", "/caldav/", nil)
+		req.RemoteAddr = ip + ":1234"
+		req.SetBasicAuth(username, password)
+		req.Header.Set("Depth", "0")
+		rec := httptest.NewRecorder()
+		tc.handler.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := propfind("192.0.2.1", "walt", app.Password); rec.Code != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND with app password = %d", rec.Code)
+	}
+	// 账户密码和其他用户名都不能使用
+	if rec := propfind("192.0.2.1", "walt", "password123"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("PROPFIND with account password = %d, want 401", rec.Code)
+	}
+	if rec := propfind("192.0.2.1", "other", app.Password); rec.Code != http.StatusUnauthorized {
+		t.Errorf("PROPFIND with other username = %d, want 401", rec.Code)
+	}
+
+	// 同一IP失败次数过多后暂时拒绝认证，其他IP不受影响
+	for i := 2; i < caldavAuthFailureLimit; i++ {
+		propfind("192.0.2.1", "walt", "guess")
+	}
+	if rec := propfind("192.0.2.1", "walt", app.Password); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("PROPFIND after failures = %d, want 429", rec.Code)
+	}
+	if rec := propfind("192.0.2.2", "walt", app.Password); rec.Code != http.StatusMultiStatus {
+		t.Errorf("PROPFIND from other IP = %d", rec.Code)
+	}
+
+	// 删除密码或退出所有设备后客户端立即无法访问
+	if resp := tc.post("/api/v1/caldav/passwords/delete", DeleteAppPasswordRequest{ID: app.AppPassword.ID}, nil); resp.Code != CodeSuccess {
+		t.Fatalf("delete app password = %+v", resp)
+	}
+	if rec := propfind("192.0.2.3", "walt", app.Password); rec.Code != http.StatusUnauthorized {
+		t.Errorf("PROPFIND with deleted password = %d, want 401", rec.Code)
+	}
+	if resp := tc.post("/api/v1/caldav/passwords/create", CreateAppPasswordRequest{Name: "Mac"}, &app); resp.Code != CodeSuccess {
+		t.Fatalf("create app password = %+v", resp)
+	}
+	if resp := tc.post("/api/auth/logout-all", nil, nil); resp.Code != CodeSuccess {
+		t.Fatalf("logout all = %+v", resp)
+	}
+	if rec := propfind("192.0.2.4", "walt", app.Password); rec.Code != http.StatusUnauthorized {
+		t.Errorf("PROPFIND after logout-all = %d, want 401", rec.Code)
+	}
+}
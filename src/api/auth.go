@@ -0,0 +1,245 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+	"todo-service/src/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// 令牌默认有效期
+const (
+	DefaultAccessTokenTTL  = time.Hour           // 访问令牌有效期
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour // 刷新令牌有效期，客户端可在此期间保持登录
+)
+
+// JWTSigner JWT签发与校验
+type JWTSigner struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewJWTSigner 创建JWT签发器
+func NewJWTSigner(secret []byte, ttl time.Duration, now func() time.Time) *JWTSigner {
+	return &JWTSigner{secret: secret, ttl: ttl, now: now}
+}
+
+// Sign 为用户的某个登录会话签发访问令牌，会话未注册设备时 deviceID 为空
+func (j *JWTSigner) Sign(user *repository.User, sessionID, deviceID string) (string, error) {
+	now := j.now()
+	claims := Claims{
+		UserID:    user.ID,
+		Username:  user.Username,
+		SessionID: sessionID,
+		DeviceID:  deviceID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(j.ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(j.secret)
+}
+
+// Parse 校验token并返回其中的Claims
+func (j *JWTSigner) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
+		return j.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithTimeFunc(j.now))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// newRefreshToken 生成随机刷新令牌，返回明文（发给客户端）和哈希（存入数据库）
+func newRefreshToken() (plain, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	plain = base64.RawURLEncoding.EncodeToString(buf)
+	return plain, hashRefreshToken(plain), nil
+}
+
+// hashRefreshToken 计算刷新令牌的SHA-256哈希
+func hashRefreshToken(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens 为登录会话签发一对新的访问令牌和刷新令牌，刷新令牌保存到 r（可以是事务），device 为会话绑定的设备（可为空）
+func (s *Server) issueTokens(r repository.Store, user *repository.User, sessionID string, device *repository.Device) (*TokenResponse, error) {
+	plain, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	refreshToken := &repository.RefreshToken{
+		UserID:    user.ID,
+		SessionID: sessionID,
+		TokenHash: hash,
+		ExpiresAt: now.Add(s.refreshTTL),
+		CreatedAt: now,
+	}
+	if err := r.CreateRefreshToken(refreshToken); err != nil {
+		return nil, err
+	}
+
+	var deviceID string
+	if device != nil {
+		deviceID = device.ID
+	}
+	accessToken, err := s.jwt.Sign(user, sessionID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		Token:        accessToken,
+		RefreshToken: plain,
+		ExpiresIn:    int64(s.jwt.ttl / time.Second),
+		Device:       device,
+	}, nil
+}
+
+// registerDevice 将登录会话注册为设备
+// 会话已绑定设备时更新该设备；回传的设备ID有效时把设备转移到新会话并撤销其旧会话；否则创建新设备
+func (s *Server) registerDevice(userID int, sessionID string, req *DeviceRequest) (*repository.Device, error) {
+	device, err := s.store.GetDeviceBySessionID(userID, sessionID)
+	if errors.Is(err, repository.ErrNotFound) && req.ID != "" {
+		device, err = s.store.GetDeviceByID(req.ID, userID)
+		if err == nil && device.RevokedAt != nil {
+			// 已撤销的设备不能复用，作为新设备重新注册
+			device, err = nil, repository.ErrNotFound
+		}
+	}
+
+	switch {
+	case err == nil:
+		if device.SessionID != sessionID && device.SessionID != "" {
+			if err := s.store.RevokeSession(userID, device.SessionID, s.now()); err != nil {
+				return nil, err
+			}
+		}
+		device.Name = req.Name
+		device.Platform = req.Platform
+		device.PushToken = req.PushToken
+		device.SessionID = sessionID
+		if err := s.store.UpdateDevice(device); err != nil {
+			return nil, err
+		}
+		return device, nil
+	case errors.Is(err, repository.ErrNotFound):
+		now := s.now()
+		device = &repository.Device{
+			ID:        uuid.NewString(),
+			UserID:    userID,
+			Name:      req.Name,
+			Platform:  req.Platform,
+			PushToken: req.PushToken,
+			SessionID: sessionID,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := s.store.CreateDevice(device); err != nil {
+			return nil, err
+		}
+		return device, nil
+	default:
+		return nil, err
+	}
+}
+
+// sessionDevice 获取登录会话绑定的设备，未绑定时返回 nil
+func (s *Server) sessionDevice(userID int, sessionID string) (*repository.Device, error) {
+	device, err := s.store.GetDeviceBySessionID(userID, sessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	return device, err
+}
+
+// revokeDevice 撤销设备及其绑定的登录会话
+func (s *Server) revokeDevice(device *repository.Device) error {
+	now := s.now()
+	if device.SessionID != "" {
+		if err := s.store.RevokeSession(device.UserID, device.SessionID, now); err != nil {
+			return err
+		}
+	}
+	if device.RevokedAt == nil {
+		device.RevokedAt = &now
+		return s.store.UpdateDevice(device)
+	}
+	return nil
+}
+
+// authThrottleMaxKeys 认证失败记录达到此数量时清理已过期的记录，避免大量来源地址占用内存
+const authThrottleMaxKeys = 10000
+
+// authThrottle 按来源限制认证失败次数：窗口内失败达到上限后，到窗口结束前拒绝该来源的认证请求
+type authThrottle struct {
+	limit  int
+	window time.Duration
+
+	mu       sync.Mutex
+	failures map[string]*authFailures
+}
+
+// authFailures 一个来源在当前窗口内的认证失败次数
+type authFailures struct {
+	count int
+	reset time.Time // 窗口结束时间
+}
+
+func newAuthThrottle(limit int, window time.Duration) *authThrottle {
+	return &authThrottle{limit: limit, window: window, failures: make(map[string]*authFailures)}
+}
+
+// blocked 返回来源被拒绝认证的剩余时间，为0表示可以认证
+func (t *authThrottle) blocked(key string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f := t.failures[key]
+	if f == nil || f.count < t.limit || !now.Before(f.reset) {
+		return 0
+	}
+	return f.reset.Sub(now)
+}
+
+// fail 记录来源的一次认证失败
+func (t *authThrottle) fail(key string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.failures) >= authThrottleMaxKeys {
+		for k, f := range t.failures {
+			if !now.Before(f.reset) {
+				delete(t.failures, k)
+			}
+		}
+	}
+	f := t.failures[key]
+	if f == nil || !now.Before(f.reset) {
+		f = &authFailures{reset: now.Add(t.window)}
+		t.failures[key] = f
+	}
+	f.count++
+}
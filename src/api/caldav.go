@@ -0,0 +1,887 @@
+package api
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"todo-service/src/ical"
+	"todo-service/src/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CalDAV 把每个分类作为一个任务日历，未分类的TODO放在收件箱日历中，日历中的资源为以TODO UUID命名的VTODO：
+//
+//	/caldav/principals/<用户名>/                     用户主体
+//	/caldav/calendars/<用户名>/                      日历主目录
+//	/caldav/calendars/<用户名>/<分类UUID或inbox>/     任务日历
+//	/caldav/calendars/<用户名>/<日历>/<TODO UUID>.ics TODO
+//
+// 客户端以用户名和应用专用密码（/api/v1/caldav/passwords/create 生成）认证，不接受账户密码。
+// 资源的 ETag 为TODO的同步版本号，sync-token 为用户的同步版本号；写入与JSON接口使用同一套存储方法，
+// 同步接口和推送可以看到CalDAV客户端的修改。
+
+// caldavPath CalDAV的地址前缀
+const caldavPath = "/caldav/"
+
+// CalDAV认证失败限制：同一IP在窗口内失败达到次数后，到窗口结束前拒绝认证
+const (
+	caldavAuthFailureLimit  = 10
+	caldavAuthFailureWindow = 15 * time.Minute
+)
+
+// appPasswordTouchInterval 记录应用专用密码使用时间的最小间隔
+const appPasswordTouchInterval = time.Minute
+
+// caldavInbox 收件箱日历的路径名，包含未分类的TODO
+const caldavInbox = "inbox"
+
+// caldavTodoLimit 一个日历中最多列出的TODO数量
+const caldavTodoLimit = 10000
+
+// caldavMaxBody PROPFIND、REPORT和PUT请求体的最大字节数
+const caldavMaxBody = 1 << 20
+
+// caldavMethods CalDAV路由支持的方法
+var caldavMethods = []string{"OPTIONS", "PROPFIND", "REPORT", "GET", "HEAD", "PUT", "DELETE"}
+
+// CalDAV和相关扩展的XML命名空间
+const (
+	nsDAV            = "DAV:"
+	nsCalDAV         = "urn:ietf:params:xml:ns:caldav"
+	nsCalendarServer = "http://calendarserver.org/ns/"
+	nsAppleICal      = "http://apple.com/ns/ical/"
+)
+
+// davPrefixes 输出XML时各命名空间使用的前缀
+var davPrefixes = map[string]string{nsDAV: "d", nsCalDAV: "c", nsCalendarServer: "cs", nsAppleICal: "ic"}
+
+// davSyncTokenPrefix sync-token 的URI前缀，后接同步版本号
+const davSyncTokenPrefix = "http://todo-service/ns/sync/"
+
+// errPreconditionFailed If-Match 或 If-None-Match 条件不满足
+var errPreconditionFailed = errors.New("precondition failed")
+
+// 常用的属性名
+var (
+	davResourceType         = xml.Name{Space: nsDAV, Local: "resourcetype"}
+	davDisplayName          = xml.Name{Space: nsDAV, Local: "displayname"}
+	davGetETag              = xml.Name{Space: nsDAV, Local: "getetag"}
+	davCalendarData         = xml.Name{Space: nsCalDAV, Local: "calendar-data"}
+	davCurrentUserPrincipal = xml.Name{Space: nsDAV, Local: "current-user-principal"}
+	davCalendarHomeSet      = xml.Name{Space: nsCalDAV, Local: "calendar-home-set"}
+	davCalendarUserAddrSet  = xml.Name{Space: nsCalDAV, Local: "calendar-user-address-set"}
+)
+
+// davCalendar 任务日历，Category 为空时为收件箱
+type davCalendar struct {
+	Category *repository.Category
+}
+
+// id 日历在地址中的名称
+func (cal davCalendar) id() string {
+	if cal.Category == nil {
+		return caldavInbox
+	}
+	return cal.Category.UUID
+}
+
+// name 日历名称
+func (cal davCalendar) name() string {
+	if cal.Category == nil {
+		return "收件箱"
+	}
+	return cal.Category.Name
+}
+
+// contains TODO是否属于该日历
+func (cal davCalendar) contains(todo *repository.Todo) bool {
+	if todo.IsDeleted {
+		return false
+	}
+	if cal.Category == nil {
+		return todo.CategoryID == nil
+	}
+	return todo.CategoryID != nil && *todo.CategoryID == cal.Category.ID
+}
+
+// categories 编码VTODO时使用的分类名称
+func (cal davCalendar) categories() map[int]string {
+	if cal.Category == nil {
+		return nil
+	}
+	return map[int]string{cal.Category.ID: cal.Category.Name}
+}
+
+// davTarget 请求地址对应的资源
+type davTarget struct {
+	kind     string // root/principal/home/calendar/object
+	calendar davCalendar
+	todoUUID string // kind 为 object 时的TODO UUID
+}
+
+// davProp 属性及其已编码的XML内容
+type davProp struct {
+	name  xml.Name
+	inner string
+}
+
+// davResponse multistatus 中的一个资源；status 非0时表示整个资源的状态（如已删除），不输出属性
+type davResponse struct {
+	href    string
+	status  int
+	found   []davProp
+	missing []xml.Name
+}
+
+// davRequest PROPFIND和REPORT请求体中用到的元素
+type davRequest struct {
+	XMLName   xml.Name
+	AllProp   *struct{}    `xml:"DAV: allprop"`
+	Prop      davPropNames `xml:"DAV: prop"`
+	Hrefs     []string     `xml:"DAV: href"`
+	SyncToken string       `xml:"DAV: sync-token"`
+	Filter    *struct {
+		Comp davCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+// davPropNames prop 元素中请求的属性名
+type davPropNames []xml.Name
+
+func (p *davPropNames) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			*p = append(*p, tok.Name)
+			if err := d.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// davCompFilter calendar-query 的组件过滤条件
+type davCompFilter struct {
+	Name  string          `xml:"name,attr"`
+	Comps []davCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	Props []struct {
+		Name         string    `xml:"name,attr"`
+		IsNotDefined *struct{} `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	} `xml:"urn:ietf:params:xml:ns:caldav prop-filter"`
+}
+
+// matches 判断TODO是否满足过滤条件。只支持 VCALENDAR/VTODO 组件和 COMPLETED 属性是否存在，
+// 其余条件（如 time-range）不做过滤，返回的结果可能多于客户端请求的范围
+func (f *davCompFilter) matches(todo *repository.Todo) bool {
+	if f.Name != "VCALENDAR" {
+		return false
+	}
+	for _, comp := range f.Comps {
+		if comp.Name != ical.ComponentTodo {
+			return false
+		}
+		for _, prop := range comp.Props {
+			if strings.EqualFold(prop.Name, "COMPLETED") && todo.Completed == (prop.IsNotDefined != nil) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// caldavUser 以HTTP基本认证校验用户名和应用专用密码，失败时返回401；
+// 同一IP认证失败次数过多时在窗口结束前返回429
+func (s *Server) caldavUser(c *gin.Context) (*repository.User, bool) {
+	ip := c.ClientIP()
+	now := s.now()
+	if wait := s.caldavThrottle.blocked(ip, now); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Round(time.Second)/time.Second)))
+		c.String(http.StatusTooManyRequests, "too many failed authentication attempts")
+		return nil, false
+	}
+
+	username, password, ok := c.Request.BasicAuth()
+	if ok {
+		user, err := s.caldavAuthenticate(username, password, now)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "failed to authenticate")
+			return nil, false
+		}
+		if user != nil {
+			c.Set("userID", user.ID)
+			c.Set("username", user.Username)
+			return user, true
+		}
+		// 客户端通常先不带凭据请求以获得认证质询，只有提供了错误凭据才计入失败
+		s.caldavThrottle.fail(ip, now)
+	}
+	c.Header("WWW-Authenticate", `Basic realm="todo-service CalDAV", charset="UTF-8"`)
+	c.String(http.StatusUnauthorized, "authentication required")
+	return nil, false
+}
+
+// caldavAuthenticate 校验应用专用密码，密码不存在或不属于该用户名时返回 nil
+func (s *Server) caldavAuthenticate(username, password string, now time.Time) (*repository.User, error) {
+	appPassword, err := s.store.GetAppPasswordByHash(hashRefreshToken(password))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.store.GetUserByID(appPassword.UserID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && user.Username != username) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 客户端频繁请求，使用时间只需大致准确
+	if appPassword.LastUsedAt == nil || now.Sub(*appPassword.LastUsedAt) >= appPasswordTouchInterval {
+		if err := s.store.TouchAppPassword(appPassword.ID, now); err != nil {
+			s.logger.Printf("Failed to record use of app password %d: %v", appPassword.ID, err)
+		}
+	}
+	return user, nil
+}
+
+// caldavHome 用户的日历主目录地址
+func caldavHome(user *repository.User) string {
+	return caldavPath + "calendars/" + url.PathEscape(user.Username) + "/"
+}
+
+// caldavPrincipal 用户主体地址
+func caldavPrincipal(user *repository.User) string {
+	return caldavPath + "principals/" + url.PathEscape(user.Username) + "/"
+}
+
+// caldavCalendarHref 日历地址
+func caldavCalendarHref(user *repository.User, cal davCalendar) string {
+	return caldavHome(user) + cal.id() + "/"
+}
+
+// caldavObjectHref TODO资源地址
+func caldavObjectHref(user *repository.User, cal davCalendar, todoUUID string) string {
+	return caldavCalendarHref(user, cal) + todoUUID + ".ics"
+}
+
+// caldavETag TODO资源的 ETag，即同步版本号
+func caldavETag(todo *repository.Todo) string {
+	return `"` + strconv.FormatInt(todo.SyncVersion, 10) + `"`
+}
+
+// etagMatches 判断 If-Match/If-None-Match 的值是否包含 etag，* 匹配任意已存在的资源
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveCalDAV 解析请求地址，地址不属于当前用户或日历、资源不存在时返回 ErrNotFound
+func (s *Server) resolveCalDAV(user *repository.User, rawPath string) (*davTarget, error) {
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(rawPath, "/"), "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 0 {
+		return &davTarget{kind: "root"}, nil
+	}
+	if len(segments) < 2 || segments[1] != user.Username {
+		return nil, repository.ErrNotFound
+	}
+	switch {
+	case segments[0] == "principals" && len(segments) == 2:
+		return &davTarget{kind: "principal"}, nil
+	case segments[0] != "calendars" || len(segments) > 4:
+		return nil, repository.ErrNotFound
+	case len(segments) == 2:
+		return &davTarget{kind: "home"}, nil
+	}
+
+	target := &davTarget{kind: "calendar"}
+	if segments[2] != caldavInbox {
+		category, err := s.findCategory(user.ID, 0, segments[2])
+		if err != nil {
+			return nil, err
+		}
+		target.calendar.Category = category
+	}
+	if len(segments) == 4 {
+		name, ok := strings.CutSuffix(segments[3], ".ics")
+		if _, err := uuid.Parse(name); !ok || err != nil {
+			return nil, repository.ErrNotFound
+		}
+		target.kind = "object"
+		target.todoUUID = name
+	}
+	return target, nil
+}
+
+// caldavCalendars 用户的全部任务日历：收件箱和每个未删除的分类
+func (s *Server) caldavCalendars(userID int) ([]davCalendar, error) {
+	categories, err := s.store.GetCategoriesByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	calendars := []davCalendar{{}}
+	for i := range categories {
+		calendars = append(calendars, davCalendar{Category: &categories[i]})
+	}
+	return calendars, nil
+}
+
+// caldavTodos 日历中的全部未删除TODO
+func (s *Server) caldavTodos(userID int, cal davCalendar) ([]repository.Todo, error) {
+	query := repository.TodoQuery{
+		Sort:  []repository.TodoSort{{Field: repository.SortCreatedAt}},
+		Limit: caldavTodoLimit,
+	}
+	if cal.Category == nil {
+		query.Filter.Uncategorized = true
+	} else {
+		query.Filter.CategoryIDs = []int{cal.Category.ID}
+	}
+	return s.store.ListTodos(userID, query)
+}
+
+// CalDAV 处理 /caldav/ 下的全部请求，以HTTP基本认证（用户名和应用专用密码）认证
+func (s *Server) CalDAV(c *gin.Context) {
+	c.Header("DAV", "1, 3, calendar-access")
+	if c.Request.Method == http.MethodOptions {
+		c.Header("Allow", strings.Join(caldavMethods, ", "))
+		c.Status(http.StatusOK)
+		return
+	}
+	user, ok := s.caldavUser(c)
+	if !ok {
+		return
+	}
+	target, err := s.resolveCalDAV(user, c.Param("path"))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.String(http.StatusNotFound, "not found")
+		} else {
+			c.String(http.StatusInternalServerError, "failed to resolve path")
+		}
+		return
+	}
+
+	switch {
+	case c.Request.Method == "PROPFIND":
+		s.caldavPropfind(c, user, target)
+	case c.Request.Method == "REPORT" && target.kind == "calendar":
+		s.caldavReport(c, user, target.calendar)
+	case target.kind != "object":
+		c.String(http.StatusMethodNotAllowed, "method not allowed on collection")
+	case c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead:
+		s.caldavGet(c, user, target)
+	case c.Request.Method == http.MethodPut:
+		s.caldavPut(c, user, target)
+	case c.Request.Method == http.MethodDelete:
+		s.caldavDelete(c, user, target)
+	default:
+		c.String(http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// readCalDAVBody 读取请求体，超过 caldavMaxBody 时返回 *http.MaxBytesError
+func readCalDAVBody(c *gin.Context) ([]byte, error) {
+	return io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, caldavMaxBody))
+}
+
+// caldavBodyError 请求体无法读取或解析时返回400，超过大小限制时返回413
+func caldavBodyError(c *gin.Context, err error, message string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.String(http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+	c.String(http.StatusBadRequest, message)
+}
+
+// readDAVRequest 解析PROPFIND或REPORT请求体，请求体为空时返回空请求（PROPFIND视为 allprop）
+func readDAVRequest(c *gin.Context) (*davRequest, error) {
+	body, err := readCalDAVBody(c)
+	if err != nil {
+		return nil, err
+	}
+	var req davRequest
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return &req, nil
+	}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// caldavPropfind 返回资源的属性，Depth 不为0时同时返回下一级资源
+func (s *Server) caldavPropfind(c *gin.Context, user *repository.User, target *davTarget) {
+	req, err := readDAVRequest(c)
+	if err != nil {
+		caldavBodyError(c, err, "invalid PROPFIND body")
+		return
+	}
+	version, err := s.store.GetCurrentSyncVersion(user.ID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to get sync version")
+		return
+	}
+	depth := c.GetHeader("Depth") != "0"
+
+	var responses []davResponse
+	switch target.kind {
+	case "root", "principal":
+		responses = append(responses, req.response(s.principalProps(user, target.kind)))
+	case "home":
+		responses = append(responses, req.response(s.homeProps(user)))
+		if depth {
+			calendars, err := s.caldavCalendars(user.ID)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "failed to list calendars")
+				return
+			}
+			for _, cal := range calendars {
+				responses = append(responses, req.response(s.calendarProps(user, cal, version)))
+			}
+		}
+	case "calendar":
+		responses = append(responses, req.response(s.calendarProps(user, target.calendar, version)))
+		if depth {
+			todos, err := s.caldavTodos(user.ID, target.calendar)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "failed to list todos")
+				return
+			}
+			for i := range todos {
+				responses = append(responses, req.response(objectProps(user, target.calendar, &todos[i])))
+			}
+		}
+	case "object":
+		todo, err := s.store.GetTodoByUUID(user.ID, target.todoUUID)
+		if err != nil || !target.calendar.contains(todo) {
+			c.String(http.StatusNotFound, "not found")
+			return
+		}
+		responses = append(responses, req.response(objectProps(user, target.calendar, todo)))
+	}
+	writeMultistatus(c, responses, "")
+}
+
+// caldavReport 处理日历上的 calendar-query、calendar-multiget 和 sync-collection 报告
+func (s *Server) caldavReport(c *gin.Context, user *repository.User, cal davCalendar) {
+	req, err := readDAVRequest(c)
+	if err != nil {
+		caldavBodyError(c, err, "invalid REPORT body")
+		return
+	}
+
+	var responses []davResponse
+	switch req.XMLName {
+	case xml.Name{Space: nsCalDAV, Local: "calendar-query"}:
+		todos, err := s.caldavTodos(user.ID, cal)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "failed to list todos")
+			return
+		}
+		for i := range todos {
+			if req.Filter == nil || req.Filter.Comp.matches(&todos[i]) {
+				responses = append(responses, req.response(objectProps(user, cal, &todos[i])))
+			}
+		}
+		writeMultistatus(c, responses, "")
+
+	case xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}:
+		for _, href := range req.Hrefs {
+			name := strings.TrimSuffix(path.Base(href), ".ics")
+			todo, err := s.store.GetTodoByUUID(user.ID, name)
+			if err != nil || !cal.contains(todo) {
+				responses = append(responses, davResponse{href: href, status: http.StatusNotFound})
+				continue
+			}
+			responses = append(responses, req.response(objectProps(user, cal, todo)))
+		}
+		writeMultistatus(c, responses, "")
+
+	case xml.Name{Space: nsDAV, Local: "sync-collection"}:
+		s.caldavSyncCollection(c, user, cal, req)
+
+	default:
+		c.Data(http.StatusForbidden, "application/xml; charset=utf-8",
+			[]byte(xml.Header+`<d:error xmlns:d="DAV:"><d:supported-report/></d:error>`))
+	}
+}
+
+// caldavSyncCollection 返回 sync-token 之后变更的资源：仍在日历中的TODO返回属性，
+// 已删除或移到其他日历的TODO返回404。sync-token 为空时返回日历中的全部TODO
+func (s *Server) caldavSyncCollection(c *gin.Context, user *repository.User, cal davCalendar, req *davRequest) {
+	version, err := s.store.GetCurrentSyncVersion(user.ID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to get sync version")
+		return
+	}
+	var todos []repository.Todo
+	if req.SyncToken == "" {
+		todos, err = s.caldavTodos(user.ID, cal)
+	} else {
+		since, parseErr := strconv.ParseInt(strings.TrimPrefix(req.SyncToken, davSyncTokenPrefix), 10, 64)
+		if !strings.HasPrefix(req.SyncToken, davSyncTokenPrefix) || parseErr != nil || since > version {
+			c.Data(http.StatusForbidden, "application/xml; charset=utf-8",
+				[]byte(xml.Header+`<d:error xmlns:d="DAV:"><d:valid-sync-token/></d:error>`))
+			return
+		}
+		todos, err = s.store.GetTodosSince(user.ID, since, version, -1)
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to list changes")
+		return
+	}
+
+	var responses []davResponse
+	for i := range todos {
+		if cal.contains(&todos[i]) {
+			responses = append(responses, req.response(objectProps(user, cal, &todos[i])))
+		} else {
+			responses = append(responses, davResponse{href: caldavObjectHref(user, cal, todos[i].UUID), status: http.StatusNotFound})
+		}
+	}
+	writeMultistatus(c, responses, davSyncTokenPrefix+strconv.FormatInt(version, 10))
+}
+
+// caldavGet 返回TODO的VTODO
+func (s *Server) caldavGet(c *gin.Context, user *repository.User, target *davTarget) {
+	todo, err := s.store.GetTodoByUUID(user.ID, target.todoUUID)
+	if err != nil || !target.calendar.contains(todo) {
+		c.String(http.StatusNotFound, "not found")
+		return
+	}
+	etag := caldavETag(todo)
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", todo.UpdatedAt.UTC().Format(http.TimeFormat))
+	if match := c.GetHeader("If-None-Match"); match != "" && etagMatches(match, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", caldavObject(target.calendar, todo))
+}
+
+// caldavPut 创建或整体替换TODO：资源名必须与VTODO的 UID 一致，TODO归入请求地址所在的日历（可用于在日历间移动），
+// CATEGORIES 中除日历名称外的值作为标签。回收站中的同一TODO被恢复；检查项等VTODO不包含的数据保持不变。
+// 修改后的数据可能与请求体不同（如重复TODO完成时生成下一次实例），因此不返回 ETag
+func (s *Server) caldavPut(c *gin.Context, user *repository.User, target *davTarget) {
+	body, err := readCalDAVBody(c)
+	if err != nil {
+		caldavBodyError(c, err, "failed to read body")
+		return
+	}
+	vtodo, err := ical.ParseTodo(body)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !strings.EqualFold(vtodo.UID, target.todoUUID) {
+		c.String(http.StatusBadRequest, "UID does not match resource name")
+		return
+	}
+	if strings.TrimSpace(vtodo.Summary) == "" {
+		c.String(http.StatusBadRequest, "SUMMARY is required")
+		return
+	}
+
+	created := false
+	err = s.deviceStore(c).WithTx(func(tx repository.Store) error {
+		// 先锁定再读取，并发写入时 If-Match 比较的是最新的 ETag
+		if err := tx.LockUserWrites(user.ID); err != nil {
+			return err
+		}
+		todo, err := tx.GetTodoByUUID(user.ID, target.todoUUID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		exists := err == nil && !todo.IsDeleted
+		if match := c.GetHeader("If-Match"); match != "" && (!exists || !etagMatches(match, caldavETag(todo))) {
+			return errPreconditionFailed
+		}
+		if match := c.GetHeader("If-None-Match"); match != "" && exists && etagMatches(match, caldavETag(todo)) {
+			return errPreconditionFailed
+		}
+
+		if todo == nil {
+			created = true
+			todo = &repository.Todo{UUID: target.todoUUID, UserID: user.ID}
+		}
+		previous := *todo
+		applyVTodo(todo, vtodo, target.calendar)
+		if err := repository.NormalizeTodoRecurrence(todo); err != nil {
+			return fmt.Errorf("%w: %v", ical.ErrInvalid, err)
+		}
+		if created {
+			return tx.CreateTodoExtended(todo)
+		}
+		if previous.IsDeleted {
+			previous.Completed = false // 恢复的TODO按未完成处理，完成时照常生成下一次实例
+		}
+		if _, err := repository.CompleteRecurringTodo(tx, &previous, todo); err != nil {
+			return err
+		}
+		return tx.UpdateTodoExtended(todo)
+	})
+	switch {
+	case errors.Is(err, errPreconditionFailed):
+		c.String(http.StatusPreconditionFailed, "precondition failed")
+	case errors.Is(err, ical.ErrInvalid):
+		c.String(http.StatusBadRequest, err.Error())
+	case errors.Is(err, repository.ErrDuplicate):
+		c.String(http.StatusConflict, "UID is already in use")
+	case err != nil:
+		c.String(http.StatusInternalServerError, "failed to save todo")
+	case created:
+		c.Status(http.StatusCreated)
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// applyVTodo 用VTODO的内容替换TODO中对应的字段
+func applyVTodo(todo *repository.Todo, vtodo *ical.Todo, cal davCalendar) {
+	todo.Title = vtodo.Summary
+	todo.Description = vtodo.Description
+	todo.DueDate = vtodo.Due
+	todo.Reminder = vtodo.Alarm
+	todo.Priority = ical.TodoPriority(vtodo.Priority)
+	todo.Completed = vtodo.Completed
+	todo.IsDeleted = false
+	todo.Recurrence = nil
+	if vtodo.RRule != "" {
+		todo.Recurrence = &vtodo.RRule
+	}
+	todo.CategoryID, todo.CategoryUUID = nil, nil
+	if cal.Category != nil {
+		todo.CategoryID = &cal.Category.ID
+		todo.CategoryUUID = &cal.Category.UUID
+	}
+	tags := repository.StringSlice{}
+	for _, category := range vtodo.Categories {
+		if cal.Category == nil || category != cal.Category.Name {
+			tags = append(tags, category)
+		}
+	}
+	todo.Tags = tags
+}
+
+// caldavDelete 把TODO移入回收站
+func (s *Server) caldavDelete(c *gin.Context, user *repository.User, target *davTarget) {
+	err := s.deviceStore(c).WithTx(func(tx repository.Store) error {
+		if err := tx.LockUserWrites(user.ID); err != nil {
+			return err
+		}
+		todo, err := tx.GetTodoByUUID(user.ID, target.todoUUID)
+		if err != nil {
+			return err
+		}
+		if !target.calendar.contains(todo) {
+			return repository.ErrNotFound
+		}
+		if match := c.GetHeader("If-Match"); match != "" && !etagMatches(match, caldavETag(todo)) {
+			return errPreconditionFailed
+		}
+		todo.IsDeleted = true
+		return tx.UpdateTodoExtended(todo)
+	})
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.String(http.StatusNotFound, "not found")
+	case errors.Is(err, errPreconditionFailed):
+		c.String(http.StatusPreconditionFailed, "precondition failed")
+	case err != nil:
+		c.String(http.StatusInternalServerError, "failed to delete todo")
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// caldavObject 把TODO编码为只包含一个VTODO的CalDAV资源
+func caldavObject(cal davCalendar, todo *repository.Todo) []byte {
+	return ical.Encode(&ical.Calendar{Todos: []repository.Todo{*todo}, Categories: cal.categories()})
+}
+
+// davHref 只包含一个 href 的属性内容
+func davHref(href string) string {
+	return "<d:href>" + xmlText(href) + "</d:href>"
+}
+
+// principalProps 服务根地址和用户主体的属性，根地址用于客户端发现用户主体
+func (s *Server) principalProps(user *repository.User, kind string) (string, []davProp) {
+	href := caldavPath
+	resourceType := "<d:collection/>"
+	if kind == "principal" {
+		href = caldavPrincipal(user)
+		resourceType += "<d:principal/>"
+	}
+	return href, []davProp{
+		{davResourceType, resourceType},
+		{davDisplayName, xmlText(user.Username)},
+		{davCurrentUserPrincipal, davHref(caldavPrincipal(user))},
+		{xml.Name{Space: nsDAV, Local: "principal-URL"}, davHref(caldavPrincipal(user))},
+		{davCalendarHomeSet, davHref(caldavHome(user))},
+		{davCalendarUserAddrSet, davHref("mailto:" + user.Email)},
+	}
+}
+
+// homeProps 日历主目录的属性
+func (s *Server) homeProps(user *repository.User) (string, []davProp) {
+	return caldavHome(user), []davProp{
+		{davResourceType, "<d:collection/>"},
+		{davDisplayName, xmlText(user.Username)},
+		{davCurrentUserPrincipal, davHref(caldavPrincipal(user))},
+		{xml.Name{Space: nsDAV, Local: "owner"}, davHref(caldavPrincipal(user))},
+	}
+}
+
+// calendarProps 任务日历的属性，getctag 和 sync-token 为用户的同步版本号
+func (s *Server) calendarProps(user *repository.User, cal davCalendar, version int64) (string, []davProp) {
+	props := []davProp{
+		{davResourceType, "<d:collection/><c:calendar/>"},
+		{davDisplayName, xmlText(cal.name())},
+		{davCurrentUserPrincipal, davHref(caldavPrincipal(user))},
+		{xml.Name{Space: nsDAV, Local: "owner"}, davHref(caldavPrincipal(user))},
+		{xml.Name{Space: nsCalDAV, Local: "supported-calendar-component-set"}, `<c:comp name="VTODO"/>`},
+		{xml.Name{Space: nsDAV, Local: "supported-report-set"},
+			"<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report>" +
+				"<d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>" +
+				"<d:supported-report><d:report><d:sync-collection/></d:report></d:supported-report>"},
+		{xml.Name{Space: nsDAV, Local: "current-user-privilege-set"},
+			"<d:privilege><d:read/></d:privilege><d:privilege><d:write/></d:privilege>" +
+				"<d:privilege><d:write-content/></d:privilege><d:privilege><d:bind/></d:privilege><d:privilege><d:unbind/></d:privilege>"},
+		{xml.Name{Space: nsCalendarServer, Local: "getctag"}, strconv.FormatInt(version, 10)},
+		{xml.Name{Space: nsDAV, Local: "sync-token"}, davSyncTokenPrefix + strconv.FormatInt(version, 10)},
+	}
+	if cal.Category != nil && cal.Category.Color != "" {
+		props = append(props, davProp{xml.Name{Space: nsAppleICal, Local: "calendar-color"}, xmlText(cal.Category.Color)})
+	}
+	return caldavCalendarHref(user, cal), props
+}
+
+// objectProps TODO资源的属性
+func objectProps(user *repository.User, cal davCalendar, todo *repository.Todo) (string, []davProp) {
+	return caldavObjectHref(user, cal, todo.UUID), []davProp{
+		{davResourceType, ""},
+		{davGetETag, xmlText(caldavETag(todo))},
+		{xml.Name{Space: nsDAV, Local: "getcontenttype"}, "text/calendar; charset=utf-8; component=VTODO"},
+		{xml.Name{Space: nsDAV, Local: "getlastmodified"}, todo.UpdatedAt.UTC().Format(http.TimeFormat)},
+		{davCalendarData, xmlText(string(caldavObject(cal, todo)))},
+	}
+}
+
+// response 按请求的属性筛选资源的属性：未指定属性（allprop或空请求）时返回除 calendar-data 外的全部属性，
+// 请求了不支持的属性时在404中列出
+func (req *davRequest) response(href string, props []davProp) davResponse {
+	resp := davResponse{href: href}
+	if len(req.Prop) == 0 {
+		for _, prop := range props {
+			if prop.name != davCalendarData {
+				resp.found = append(resp.found, prop)
+			}
+		}
+		return resp
+	}
+	for _, name := range req.Prop {
+		found := false
+		for _, prop := range props {
+			if prop.name == name {
+				resp.found = append(resp.found, prop)
+				found = true
+				break
+			}
+		}
+		if !found {
+			resp.missing = append(resp.missing, name)
+		}
+	}
+	return resp
+}
+
+// writeMultistatus 输出207 multistatus 响应，syncToken 非空时附带新的 sync-token
+func writeMultistatus(c *gin.Context, responses []davResponse, syncToken string) {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<d:multistatus`)
+	for _, ns := range []string{nsDAV, nsCalDAV, nsCalendarServer, nsAppleICal} {
+		fmt.Fprintf(&b, ` xmlns:%s="%s"`, davPrefixes[ns], ns)
+	}
+	b.WriteString(">")
+	for _, resp := range responses {
+		b.WriteString("<d:response>" + davHref(resp.href))
+		if resp.status != 0 {
+			b.WriteString(davStatus(resp.status))
+		}
+		if len(resp.found) > 0 {
+			b.WriteString("<d:propstat><d:prop>")
+			for _, prop := range resp.found {
+				writeDAVElement(&b, prop.name, prop.inner)
+			}
+			b.WriteString("</d:prop>" + davStatus(http.StatusOK) + "</d:propstat>")
+		}
+		if len(resp.missing) > 0 {
+			b.WriteString("<d:propstat><d:prop>")
+			for _, name := range resp.missing {
+				writeDAVElement(&b, name, "")
+			}
+			b.WriteString("</d:prop>" + davStatus(http.StatusNotFound) + "</d:propstat>")
+		}
+		b.WriteString("</d:response>")
+	}
+	if syncToken != "" {
+		b.WriteString("<d:sync-token>" + xmlText(syncToken) + "</d:sync-token>")
+	}
+	b.WriteString("</d:multistatus>")
+	c.Data(http.StatusMultiStatus, "application/xml; charset=utf-8", []byte(b.String()))
+}
+
+// writeDAVElement 输出属性元素，未知命名空间的属性在元素上声明命名空间
+func writeDAVElement(b *strings.Builder, name xml.Name, inner string) {
+	tag, attr := name.Local, ""
+	if prefix, ok := davPrefixes[name.Space]; ok {
+		tag = prefix + ":" + name.Local
+	} else if name.Space != "" {
+		tag, attr = "x:"+name.Local, ` xmlns:x="`+xmlText(name.Space)+`"`
+	}
+	if inner == "" {
+		b.WriteString("<" + tag + attr + "/>")
+		return
+	}
+	b.WriteString("<" + tag + attr + ">" + inner + "</" + tag + ">")
+}
+
+// davStatus multistatus 中的状态行
+func davStatus(code int) string {
+	return fmt.Sprintf("<d:status>HTTP/1.1 %d %s</d:status>", code, http.StatusText(code))
+}
+
+// xmlText 转义XML文本
+func xmlText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
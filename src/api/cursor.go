@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"todo-service/src/repository"
+)
+
+// errInvalidCursor 游标格式错误或已被篡改
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor 将游标状态编码为不透明字符串
+func encodeCursor(v any) string {
+	data, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor 解析 encodeCursor 生成的游标
+func decodeCursor(cursor string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return errInvalidCursor
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errInvalidCursor
+	}
+	return nil
+}
+
+// syncCursor 增量同步分页游标
+type syncCursor struct {
+	After int64 `json:"a"` // 已返回的最后一条变更的版本号
+	Until int64 `json:"u"` // 本轮同步开始时的服务器版本号，分页期间保持不变
+}
+
+// todoCursor TODO列表/搜索分页游标
+type todoCursor struct {
+	Sort string             `json:"s,omitempty"` // 生成游标时的排序方式，排序变化后游标失效
+	Key  repository.TodoKey `json:"k"`           // 上一页最后一个TODO的位置
+}
+
+// todoSortSignature 排序方式的字符串表示，用于校验游标与当前请求的排序一致
+func todoSortSignature(sorts []repository.TodoSort) string {
+	keys := make([]string, len(sorts))
+	for i, sort := range sorts {
+		keys[i] = sort.Field
+		if sort.Desc {
+			keys[i] += ":desc"
+		}
+	}
+	return strings.Join(keys, ",")
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"time"
+
 	"todo-service/src/repository"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -8,8 +10,9 @@ import (
 
 // LoginRequest 登录请求
 type LoginRequest struct {
-	Username string `json:"username" binding:"required" example:"admin" swaggertype:"string" description:"用户名"`      // 用户名
-	Password string `json:"password" binding:"required" example:"password123" swaggertype:"string" description:"密码"` // 密码
+	Username string         `json:"username" binding:"required" example:"admin" swaggertype:"string" description:"用户名"`      // 用户名
+	Password string         `json:"password" binding:"required" example:"password123" swaggertype:"string" description:"密码"` // 密码
+	Device   *DeviceRequest `json:"device,omitempty" description:"登录设备信息（可选），提供后将当前会话注册为该设备"`                                // 登录设备信息（可选）
 }
 
 // RegisterRequest 注册请求
@@ -38,32 +41,64 @@ type DeleteTodoRequest struct {
 	ID int `json:"id" binding:"required" example:"1" swaggertype:"integer" description:"TODO ID"` // TODO ID
 }
 
+// DeleteExtendedTodoRequest 扩展TODO删除请求
+type DeleteExtendedTodoRequest struct {
+	ID   int    `json:"id" binding:"required_without=UUID" example:"1" swaggertype:"integer" description:"TODO ID，与uuid二选一"`
+	UUID string `json:"uuid,omitempty" binding:"omitempty,uuid" example:"9f0c2a4e-5d1b-4c3a-8e7f-6a5b4c3d2e1f" swaggertype:"string" description:"TODO UUID，与id二选一"`
+}
+
+// TodoHistoryRequest TODO修改历史查询请求
+type TodoHistoryRequest struct {
+	ID   int    `json:"id" binding:"required_without=UUID" example:"1" swaggertype:"integer" description:"TODO ID，与uuid二选一"`
+	UUID string `json:"uuid,omitempty" binding:"omitempty,uuid" example:"9f0c2a4e-5d1b-4c3a-8e7f-6a5b4c3d2e1f" swaggertype:"string" description:"TODO UUID，与id二选一"`
+}
+
+// RevertTodoRequest TODO回滚请求
+type RevertTodoRequest struct {
+	ID         int    `json:"id" binding:"required_without=UUID" example:"1" swaggertype:"integer" description:"TODO ID，与uuid二选一"`
+	UUID       string `json:"uuid,omitempty" binding:"omitempty,uuid" example:"9f0c2a4e-5d1b-4c3a-8e7f-6a5b4c3d2e1f" swaggertype:"string" description:"TODO UUID，与id二选一"`
+	RevisionID int    `json:"revision_id" binding:"required" example:"12" swaggertype:"integer" description:"要恢复到的修改记录ID，TODO将恢复为该次修改之后的状态"`
+}
+
+// ReminderDeliveriesRequest TODO提醒投递记录查询请求
+type ReminderDeliveriesRequest struct {
+	ID   int    `json:"id" binding:"required_without=UUID" example:"1" swaggertype:"integer" description:"TODO ID，与uuid二选一"`
+	UUID string `json:"uuid,omitempty" binding:"omitempty,uuid" example:"9f0c2a4e-5d1b-4c3a-8e7f-6a5b4c3d2e1f" swaggertype:"string" description:"TODO UUID，与id二选一"`
+}
+
 // ExtendedTodoRequest 扩展TODO创建请求
 type ExtendedTodoRequest struct {
-	Title       string   `json:"title" binding:"required" example:"学习Go语言" swaggertype:"string" description:"任务标题"`
-	Description string   `json:"description" example:"学习Go语言基础语法和框架" swaggertype:"string" description:"任务描述"`
-	Priority    int      `json:"priority" example:"1" swaggertype:"integer" description:"优先级(0-3)"`
-	DueDate     *string  `json:"due_date,omitempty" example:"2023-12-31T23:59:59Z" swaggertype:"string" description:"截止日期"`
-	Tags        []string `json:"tags" example:"[\"工作\",\"重要\"]" swaggertype:"array,string" description:"标签"`
-	CategoryID  *int     `json:"category_id,omitempty" example:"1" swaggertype:"integer" description:"分类ID"`
-	Reminder    *string  `json:"reminder,omitempty" example:"2023-12-30T09:00:00Z" swaggertype:"string" description:"提醒时间"`
+	UUID         string   `json:"uuid,omitempty" binding:"omitempty,uuid" example:"9f0c2a4e-5d1b-4c3a-8e7f-6a5b4c3d2e1f" swaggertype:"string" description:"客户端生成的UUID（可选），未提供时由服务器生成"`
+	Title        string   `json:"title" binding:"required" example:"学习Go语言" swaggertype:"string" description:"任务标题"`
+	Description  string   `json:"description" example:"学习Go语言基础语法和框架" swaggertype:"string" description:"任务描述"`
+	Priority     int      `json:"priority" example:"1" swaggertype:"integer" description:"优先级(0-3)"`
+	DueDate      *string  `json:"due_date,omitempty" example:"2023-12-31T23:59:59Z" swaggertype:"string" description:"截止日期"`
+	Tags         []string `json:"tags" example:"[\"工作\",\"重要\"]" swaggertype:"array,string" description:"标签"`
+	CategoryID   *int     `json:"category_id,omitempty" example:"1" swaggertype:"integer" description:"分类ID"`
+	CategoryUUID string   `json:"category_uuid,omitempty" binding:"omitempty,uuid" example:"3b241101-e2bb-4255-8caf-4136c566a962" swaggertype:"string" description:"分类UUID，提供时优先于分类ID"`
+	Reminder     *string  `json:"reminder,omitempty" example:"2023-12-30T09:00:00Z" swaggertype:"string" description:"提醒时间"`
+	Recurrence   *string  `json:"recurrence,omitempty" example:"FREQ=WEEKLY;BYDAY=MO,WE" swaggertype:"string" description:"重复规则(RRULE)，需同时设置截止时间或提醒时间"`
 }
 
 // UpdateExtendedTodoRequest 扩展TODO更新请求
 type UpdateExtendedTodoRequest struct {
-	ID          int      `json:"id" binding:"required" example:"1" swaggertype:"integer" description:"TODO ID"`
-	Title       *string  `json:"title,omitempty" example:"更新后的标题" swaggertype:"string" description:"任务标题（可选）"`
-	Description *string  `json:"description,omitempty" example:"更新后的描述" swaggertype:"string" description:"任务描述（可选）"`
-	Completed   *bool    `json:"completed,omitempty" example:"true" swaggertype:"boolean" description:"是否完成（可选）"`
-	Priority    *int     `json:"priority,omitempty" example:"2" swaggertype:"integer" description:"优先级（可选）"`
-	DueDate     *string  `json:"due_date,omitempty" example:"2023-12-31T23:59:59Z" swaggertype:"string" description:"截止日期（可选）"`
-	Tags        []string `json:"tags,omitempty" example:"[\"工作\",\"重要\"]" swaggertype:"array,string" description:"标签（可选）"`
-	CategoryID  *int     `json:"category_id,omitempty" example:"1" swaggertype:"integer" description:"分类ID（可选）"`
-	Reminder    *string  `json:"reminder,omitempty" example:"2023-12-30T09:00:00Z" swaggertype:"string" description:"提醒时间（可选）"`
+	ID           int      `json:"id" binding:"required_without=UUID" example:"1" swaggertype:"integer" description:"TODO ID，与uuid二选一"`
+	UUID         string   `json:"uuid,omitempty" binding:"omitempty,uuid" example:"9f0c2a4e-5d1b-4c3a-8e7f-6a5b4c3d2e1f" swaggertype:"string" description:"TODO UUID，与id二选一"`
+	Title        *string  `json:"title,omitempty" example:"更新后的标题" swaggertype:"string" description:"任务标题（可选）"`
+	Description  *string  `json:"description,omitempty" example:"更新后的描述" swaggertype:"string" description:"任务描述（可选）"`
+	Completed    *bool    `json:"completed,omitempty" example:"true" swaggertype:"boolean" description:"是否完成（可选）"`
+	Priority     *int     `json:"priority,omitempty" example:"2" swaggertype:"integer" description:"优先级（可选）"`
+	DueDate      *string  `json:"due_date,omitempty" example:"2023-12-31T23:59:59Z" swaggertype:"string" description:"截止日期（可选）"`
+	Tags         []string `json:"tags,omitempty" example:"[\"工作\",\"重要\"]" swaggertype:"array,string" description:"标签（可选）"`
+	CategoryID   *int     `json:"category_id,omitempty" example:"1" swaggertype:"integer" description:"分类ID（可选）"`
+	CategoryUUID string   `json:"category_uuid,omitempty" binding:"omitempty,uuid" example:"3b241101-e2bb-4255-8caf-4136c566a962" swaggertype:"string" description:"分类UUID（可选），提供时优先于分类ID"`
+	Reminder     *string  `json:"reminder,omitempty" example:"2023-12-30T09:00:00Z" swaggertype:"string" description:"提醒时间（可选）"`
+	Recurrence   *string  `json:"recurrence,omitempty" example:"FREQ=MONTHLY;BYDAY=-1FR" swaggertype:"string" description:"重复规则(RRULE)（可选），空字符串表示取消重复"`
 }
 
 // CategoryRequest 分类创建/更新请求
 type CategoryRequest struct {
+	UUID  string `json:"uuid,omitempty" binding:"omitempty,uuid" example:"3b241101-e2bb-4255-8caf-4136c566a962" swaggertype:"string" description:"客户端生成的UUID（可选），未提供时由服务器生成"`
 	Name  string `json:"name" binding:"required" example:"工作" swaggertype:"string" description:"分类名称"`
 	Color string `json:"color" example:"#FF5722" swaggertype:"string" description:"分类颜色"`
 	Icon  string `json:"icon" example:"work" swaggertype:"string" description:"分类图标"`
@@ -71,7 +106,8 @@ type CategoryRequest struct {
 
 // UpdateCategoryRequest 分类更新请求
 type UpdateCategoryRequest struct {
-	ID    int    `json:"id" binding:"required" example:"1" swaggertype:"integer" description:"分类ID"`
+	ID    int    `json:"id" binding:"required_without=UUID" example:"1" swaggertype:"integer" description:"分类ID，与uuid二选一"`
+	UUID  string `json:"uuid,omitempty" binding:"omitempty,uuid" example:"3b241101-e2bb-4255-8caf-4136c566a962" swaggertype:"string" description:"分类UUID，与id二选一"`
 	Name  string `json:"name" binding:"required" example:"工作" swaggertype:"string" description:"分类名称"`
 	Color string `json:"color" example:"#FF5722" swaggertype:"string" description:"分类颜色"`
 	Icon  string `json:"icon" example:"work" swaggertype:"string" description:"分类图标"`
@@ -79,7 +115,131 @@ type UpdateCategoryRequest struct {
 
 // DeleteCategoryRequest 分类删除请求
 type DeleteCategoryRequest struct {
-	ID int `json:"id" binding:"required" example:"1" swaggertype:"integer" description:"分类ID"`
+	ID   int    `json:"id" binding:"required_without=UUID" example:"1" swaggertype:"integer" description:"分类ID，与uuid二选一"`
+	UUID string `json:"uuid,omitempty" binding:"omitempty,uuid" example:"3b241101-e2bb-4255-8caf-4136c566a962" swaggertype:"string" description:"分类UUID，与id二选一"`
+}
+
+// ===== 检查项相关请求 =====
+
+// ChecklistRequest 获取TODO检查项请求
+type ChecklistRequest struct {
+	TodoID   int    `json:"todo_id" binding:"required_without=TodoUUID" example:"1" swaggertype:"integer" description:"TODO ID，与todo_uuid二选一"`
+	TodoUUID string `json:"todo_uuid,omitempty" binding:"omitempty,uuid" example:"9f0c2a4e-5d1b-4c3a-8e7f-6a5b4c3d2e1f" swaggertype:"string" description:"TODO UUID，与todo_id二选一"`
+}
+
+// CreateChecklistItemRequest 检查项创建请求
+type CreateChecklistItemRequest struct {
+	TodoID   int    `json:"todo_id" binding:"required_without=TodoUUID" example:"1" swaggertype:"integer" description:"所属TODO ID，与todo_uuid二选一"`
+	TodoUUID string `json:"todo_uuid,omitempty" binding:"omitempty,uuid" example:"9f0c2a4e-5d1b-4c3a-8e7f-6a5b4c3d2e1f" swaggertype:"string" description:"所属TODO UUID，与todo_id二选一"`
+	UUID     string `json:"uuid,omitempty" binding:"omitempty,uuid" example:"5c8e2f1a-7b3d-4e6f-9a1c-2d4e6f8a0b1c" swaggertype:"string" description:"客户端生成的UUID（可选），未提供时由服务器生成"`
+	Title    string `json:"title" binding:"required,max=200" example:"准备会议材料" swaggertype:"string" description:"检查项标题"`
+}
+
+// UpdateChecklistItemRequest 检查项更新请求
+type UpdateChecklistItemRequest struct {
+	ID        int     `json:"id" binding:"required_without=UUID" example:"1" swaggertype:"integer" description:"检查项ID，与uuid二选一"`
+	UUID      string  `json:"uuid,omitempty" binding:"omitempty,uuid" example:"5c8e2f1a-7b3d-4e6f-9a1c-2d4e6f8a0b1c" swaggertype:"string" description:"检查项UUID，与id二选一"`
+	Title     *string `json:"title,omitempty" binding:"omitempty,min=1,max=200" example:"准备会议材料和投影" swaggertype:"string" description:"检查项标题（可选）"`
+	Completed *bool   `json:"completed,omitempty" example:"true" swaggertype:"boolean" description:"是否完成（可选）"`
+}
+
+// ChecklistItemRequest 检查项切换完成状态/删除请求
+type ChecklistItemRequest struct {
+	ID   int    `json:"id" binding:"required_without=UUID" example:"1" swaggertype:"integer" description:"检查项ID，与uuid二选一"`
+	UUID string `json:"uuid,omitempty" binding:"omitempty,uuid" example:"5c8e2f1a-7b3d-4e6f-9a1c-2d4e6f8a0b1c" swaggertype:"string" description:"检查项UUID，与id二选一"`
+}
+
+// ReorderChecklistRequest 检查项排序请求
+type ReorderChecklistRequest struct {
+	TodoID    int      `json:"todo_id" binding:"required_without=TodoUUID" example:"1" swaggertype:"integer" description:"TODO ID，与todo_uuid二选一"`
+	TodoUUID  string   `json:"todo_uuid,omitempty" binding:"omitempty,uuid" example:"9f0c2a4e-5d1b-4c3a-8e7f-6a5b4c3d2e1f" swaggertype:"string" description:"TODO UUID，与todo_id二选一"`
+	ItemIDs   []int    `json:"item_ids,omitempty" binding:"required_without=ItemUUIDs" example:"3,1,2" swaggertype:"array,integer" description:"按新顺序排列的检查项ID，需包含该TODO的全部检查项，与item_uuids二选一"`
+	ItemUUIDs []string `json:"item_uuids,omitempty" binding:"omitempty,dive,uuid" swaggertype:"array,string" description:"按新顺序排列的检查项UUID，与item_ids二选一"`
+}
+
+// ===== 回收站相关请求 =====
+
+// TrashRequest 回收站查询请求
+type TrashRequest struct {
+	Limit  int `json:"limit,omitempty" example:"100" swaggertype:"integer" description:"最多返回的TODO数量（默认100，最大500）"`
+	Offset int `json:"offset,omitempty" example:"0" swaggertype:"integer" description:"TODO偏移量"`
+}
+
+// TrashItemRequest 回收站中单个数据的恢复或彻底删除请求
+type TrashItemRequest struct {
+	Type string `json:"type" binding:"required,oneof=todo category" example:"todo" swaggertype:"string" description:"数据类型：todo/category"`
+	ID   int    `json:"id" binding:"required_without=UUID" example:"1" swaggertype:"integer" description:"数据ID，与uuid二选一"`
+	UUID string `json:"uuid,omitempty" binding:"omitempty,uuid" example:"9f0c2a4e-5d1b-4c3a-8e7f-6a5b4c3d2e1f" swaggertype:"string" description:"数据UUID，与id二选一"`
+}
+
+// ===== 标签相关请求 =====
+
+// TagRequest 标签创建请求，为TODO中已使用或新的标签名称保存颜色和图标
+type TagRequest struct {
+	UUID  string `json:"uuid,omitempty" binding:"omitempty,uuid" example:"2e4f6a8b-1c3d-4e5f-8a9b-0c1d2e3f4a5b" swaggertype:"string" description:"客户端生成的UUID（可选），未提供时由服务器生成"`
+	Name  string `json:"name" binding:"required,max=50" example:"重要" swaggertype:"string" description:"标签名称"`
+	Color string `json:"color" example:"#F44336" swaggertype:"string" description:"标签颜色"`
+	Icon  string `json:"icon" example:"label" swaggertype:"string" description:"标签图标"`
+}
+
+// UpdateTagRequest 标签更新请求，只修改颜色和图标，修改名称请使用重命名接口
+type UpdateTagRequest struct {
+	Name  string `json:"name" binding:"required,max=50" example:"重要" swaggertype:"string" description:"标签名称，标签还没有元数据时自动创建"`
+	Color string `json:"color" example:"#F44336" swaggertype:"string" description:"标签颜色，为空时保持不变"`
+	Icon  string `json:"icon" example:"flag" swaggertype:"string" description:"标签图标，为空时保持不变"`
+}
+
+// RenameTagRequest 标签重命名请求
+type RenameTagRequest struct {
+	From string `json:"from" binding:"required,max=50" example:"工做" swaggertype:"string" description:"原标签名称"`
+	To   string `json:"to" binding:"required,max=50" example:"工作" swaggertype:"string" description:"新标签名称，已存在时请使用合并接口"`
+}
+
+// MergeTagsRequest 标签合并请求
+type MergeTagsRequest struct {
+	Sources []string `json:"sources" binding:"required,min=1,dive,required,max=50" example:"[\"work\",\"工做\"]" swaggertype:"array,string" description:"被合并的标签名称"`
+	Target  string   `json:"target" binding:"required,max=50" example:"工作" swaggertype:"string" description:"合并到的标签名称，可以是新标签"`
+}
+
+// TagNameRequest 标签删除请求
+type TagNameRequest struct {
+	Name string `json:"name" binding:"required,max=50" example:"重要" swaggertype:"string" description:"标签名称"`
+}
+
+// ===== 智能列表相关请求 =====
+
+// SmartListRequest 智能列表创建请求
+type SmartListRequest struct {
+	UUID       string                         `json:"uuid,omitempty" binding:"omitempty,uuid" example:"7d1e3f5a-2b4c-4d6e-8f0a-1b3c5d7e9f2a" swaggertype:"string" description:"客户端生成的UUID（可选），未提供时由服务器生成"`
+	Name       string                         `json:"name" binding:"required,max=100" example:"本周重要" swaggertype:"string" description:"智能列表名称"`
+	Color      string                         `json:"color" example:"#2196F3" swaggertype:"string" description:"智能列表颜色"`
+	Icon       string                         `json:"icon" example:"star" swaggertype:"string" description:"智能列表图标"`
+	Definition repository.SmartListDefinition `json:"definition" description:"筛选和排序条件"`
+}
+
+// UpdateSmartListRequest 智能列表更新请求，定义整体替换
+type UpdateSmartListRequest struct {
+	ID         int                            `json:"id" binding:"required_without=UUID" example:"1" swaggertype:"integer" description:"智能列表ID，与uuid二选一"`
+	UUID       string                         `json:"uuid,omitempty" binding:"omitempty,uuid" example:"7d1e3f5a-2b4c-4d6e-8f0a-1b3c5d7e9f2a" swaggertype:"string" description:"智能列表UUID，与id二选一"`
+	Name       string                         `json:"name" binding:"required,max=100" example:"本周重要" swaggertype:"string" description:"智能列表名称"`
+	Color      string                         `json:"color" example:"#2196F3" swaggertype:"string" description:"智能列表颜色，为空时保持不变"`
+	Icon       string                         `json:"icon" example:"star" swaggertype:"string" description:"智能列表图标，为空时保持不变"`
+	Definition repository.SmartListDefinition `json:"definition" description:"筛选和排序条件"`
+}
+
+// SmartListIDRequest 智能列表删除请求
+type SmartListIDRequest struct {
+	ID   int    `json:"id" binding:"required_without=UUID" example:"1" swaggertype:"integer" description:"智能列表ID，与uuid二选一"`
+	UUID string `json:"uuid,omitempty" binding:"omitempty,uuid" example:"7d1e3f5a-2b4c-4d6e-8f0a-1b3c5d7e9f2a" swaggertype:"string" description:"智能列表UUID，与id二选一"`
+}
+
+// SmartListTodosRequest 执行智能列表请求，分页参数与获取TODO列表相同
+type SmartListTodosRequest struct {
+	SmartListIDRequest
+	Limit        int     `json:"limit" example:"20" swaggertype:"integer" description:"返回数量限制"`
+	Offset       int     `json:"offset" example:"0" swaggertype:"integer" description:"偏移量"`
+	Cursor       *string `json:"cursor,omitempty" example:"" swaggertype:"string" description:"分页游标：首页传空字符串，之后传上一页返回的 next_cursor。提供时响应为分页结构且忽略 offset"`
+	IncludeTotal bool    `json:"include_total,omitempty" example:"false" swaggertype:"boolean" description:"游标分页时是否返回满足条件的总数"`
 }
 
 // UserSettingsRequest 用户设置更新请求
@@ -88,25 +248,56 @@ type UserSettingsRequest struct {
 	NotificationTime string `json:"notification_time" example:"09:00" swaggertype:"string" description:"通知时间"`
 	Language         string `json:"language" example:"zh-CN" swaggertype:"string" description:"语言设置"`
 	TimeZone         string `json:"timezone" example:"Asia/Shanghai" swaggertype:"string" description:"时区设置"`
+	DailyDigest      *bool  `json:"daily_digest,omitempty" example:"true" swaggertype:"boolean" description:"是否在通知时间接收每日摘要，不传时保持不变"`
 }
 
-// SearchTodosRequest 搜索TODO请求
+// SearchTodosRequest 搜索TODO请求，支持与获取TODO列表相同的筛选、排序和分页参数
 type SearchTodosRequest struct {
-	Keyword string `json:"keyword" binding:"required" example:"学习" swaggertype:"string" description:"搜索关键词"`
-	Limit   int    `json:"limit" example:"20" swaggertype:"integer" description:"返回数量限制"`
-	Offset  int    `json:"offset" example:"0" swaggertype:"integer" description:"偏移量"`
+	Keyword string `json:"keyword" binding:"required,max=200" example:"周报 tag:work priority:>=high due:<2026-11-01 -草稿" swaggertype:"string" description:"搜索查询：空格分隔的多个条件需同时满足，双引号包裹短语，以*结尾按前缀匹配，-开头表示排除；支持 tag: category: priority: due: created: updated: is: has: 字段条件"`
+	GetTodosRequest
 }
 
-// GetTodosRequest 获取TODO列表请求
+// GetTodosRequest 获取TODO列表请求，所有筛选条件均为可选，多个条件同时满足；时间范围为左闭右开
 type GetTodosRequest struct {
-	Limit  int `json:"limit" example:"20" swaggertype:"integer" description:"返回数量限制"`
-	Offset int `json:"offset" example:"0" swaggertype:"integer" description:"偏移量"`
+	Limit         int               `json:"limit" example:"20" swaggertype:"integer" description:"返回数量限制"`
+	Offset        int               `json:"offset" example:"0" swaggertype:"integer" description:"偏移量"`
+	Cursor        *string           `json:"cursor,omitempty" example:"" swaggertype:"string" description:"分页游标：首页传空字符串，之后传上一页返回的 next_cursor。提供时响应为分页结构且忽略 offset；未提供时按 offset 分页并直接返回列表（兼容旧客户端）"`
+	IncludeTotal  bool              `json:"include_total,omitempty" example:"false" swaggertype:"boolean" description:"游标分页时是否返回满足条件的总数"`
+	Completed     *bool             `json:"completed,omitempty" example:"false" swaggertype:"boolean" description:"按完成状态筛选"`
+	Priorities    []int             `json:"priorities,omitempty" binding:"omitempty,dive,min=0,max=3" example:"2,3" swaggertype:"array,integer" description:"按优先级筛选(0-3)，满足任一即可"`
+	CategoryIDs   []int             `json:"category_ids,omitempty" example:"1,2" swaggertype:"array,integer" description:"按分类ID筛选，满足任一即可"`
+	CategoryUUIDs []string          `json:"category_uuids,omitempty" binding:"omitempty,dive,uuid" swaggertype:"array,string" description:"按分类UUID筛选，与category_ids合并"`
+	Uncategorized bool              `json:"uncategorized,omitempty" example:"true" swaggertype:"boolean" description:"包含未分类的TODO，与分类条件为或关系"`
+	Tags          []string          `json:"tags,omitempty" example:"[\"工作\",\"重要\"]" swaggertype:"array,string" description:"按标签筛选"`
+	TagMatch      string            `json:"tag_match,omitempty" binding:"omitempty,oneof=any all" example:"all" swaggertype:"string" description:"标签匹配方式：any 包含任一标签（默认），all 包含全部标签"`
+	DueAfter      *time.Time        `json:"due_after,omitempty" example:"2026-10-01T00:00:00Z" swaggertype:"string" description:"截止时间不早于该时间"`
+	DueBefore     *time.Time        `json:"due_before,omitempty" example:"2026-11-01T00:00:00Z" swaggertype:"string" description:"截止时间早于该时间"`
+	Overdue       bool              `json:"overdue,omitempty" example:"true" swaggertype:"boolean" description:"只返回已逾期且未完成的TODO"`
+	HasReminder   *bool             `json:"has_reminder,omitempty" example:"true" swaggertype:"boolean" description:"按是否设置提醒筛选"`
+	CreatedAfter  *time.Time        `json:"created_after,omitempty" example:"2026-10-01T00:00:00Z" swaggertype:"string" description:"创建时间不早于该时间"`
+	CreatedBefore *time.Time        `json:"created_before,omitempty" example:"2026-11-01T00:00:00Z" swaggertype:"string" description:"创建时间早于该时间"`
+	UpdatedAfter  *time.Time        `json:"updated_after,omitempty" example:"2026-10-01T00:00:00Z" swaggertype:"string" description:"更新时间不早于该时间"`
+	UpdatedBefore *time.Time        `json:"updated_before,omitempty" example:"2026-11-01T00:00:00Z" swaggertype:"string" description:"更新时间早于该时间"`
+	Sort          []TodoSortRequest `json:"sort,omitempty" binding:"omitempty,max=5,dive" description:"排序键，按顺序依次比较，默认按创建时间倒序"`
+}
+
+// TodoSortRequest TODO列表排序键
+type TodoSortRequest struct {
+	Field string `json:"field" binding:"required,oneof=priority due_date created_at updated_at title relevance" example:"priority" swaggertype:"string" description:"排序字段：priority/due_date/created_at/updated_at/title/relevance（搜索相关度，仅搜索时有效）"`
+	Order string `json:"order,omitempty" binding:"omitempty,oneof=asc desc" example:"desc" swaggertype:"string" description:"排序方向：asc（默认）/desc，截止时间为空的TODO总是排在最后"`
+}
+
+// RefreshTokenRequest 刷新令牌请求
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required" example:"hW3k...Q" swaggertype:"string" description:"刷新令牌"` // 刷新令牌
 }
 
 // Claims JWT Claims
 type Claims struct {
-	UserID   int    `json:"user_id"`  // 用户ID
-	Username string `json:"username"` // 用户名
+	UserID    int    `json:"user_id"`             // 用户ID
+	Username  string `json:"username"`            // 用户名
+	SessionID string `json:"sid"`                 // 登录会话ID，用于撤销
+	DeviceID  string `json:"device_id,omitempty"` // 设备ID，会话未注册设备时为空
 	jwt.RegisteredClaims
 }
 
@@ -114,12 +305,113 @@ type Claims struct {
 
 // IncrementalSyncRequest 增量同步请求
 type IncrementalSyncRequest struct {
-	Since int64 `json:"since" example:"1640995200000" swaggertype:"integer" description:"同步起始时间戳（毫秒）"`
+	Since  int64  `json:"since" example:"42" swaggertype:"integer" description:"上次同步返回的 server_version，首次同步传0"`
+	Cursor string `json:"cursor,omitempty" example:"eyJhIjo0MiwidSI6MTAwfQ" swaggertype:"string" description:"上一页返回的 next_cursor，提供时忽略 since"`
+	Limit  int    `json:"limit,omitempty" example:"500" swaggertype:"integer" description:"每页最多返回的变更数（默认500，最大1000）"`
 }
 
 // BatchSyncRequest 批量同步请求
 type BatchSyncRequest struct {
-	Todos      []repository.TodoSyncItem        `json:"todos,omitempty" description:"待同步的TODO列表"`
-	Categories []repository.CategorySyncItem    `json:"categories,omitempty" description:"待同步的分类列表"`
-	Settings   *repository.UserSettingsSyncItem `json:"settings,omitempty" description:"待同步的用户设置"`
+	Todos          []repository.TodoSyncItem          `json:"todos,omitempty" description:"待同步的TODO列表"`
+	Categories     []repository.CategorySyncItem      `json:"categories,omitempty" description:"待同步的分类列表"`
+	ChecklistItems []repository.ChecklistItemSyncItem `json:"checklist_items,omitempty" description:"待同步的检查项列表，在TODO之后处理"`
+	Tags           []repository.TagSyncItem           `json:"tags,omitempty" description:"待同步的标签元数据，只修改颜色、图标和名称，不改写TODO中的标签"`
+	SmartLists     []repository.SmartListSyncItem     `json:"smart_lists,omitempty" description:"待同步的智能列表，在分类之后处理"`
+	Settings       *repository.UserSettingsSyncItem   `json:"settings,omitempty" description:"待同步的用户设置"`
+	Strategy       string                             `json:"strategy,omitempty" binding:"omitempty,oneof=server_wins client_wins merge" example:"merge" swaggertype:"string" description:"TODO冲突解决策略（server_wins/client_wins/merge），默认server_wins"`
+	Resolutions    []ConflictResolution               `json:"resolutions,omitempty" binding:"omitempty,dive" description:"按TODO单独指定的冲突解决策略，优先于strategy"`
+	Atomic         bool                               `json:"atomic,omitempty" example:"false" swaggertype:"boolean" description:"是否全部成功或全部回滚，为 true 时任一项冲突或失败都会撤销整个批次"`
+}
+
+// ===== 设备管理相关请求 =====
+
+// DeviceRequest 设备注册请求
+type DeviceRequest struct {
+	ID        string `json:"id,omitempty" example:"6f1c3a52-6a0e-4f5e-9a53-0f3f4c1b7e21" swaggertype:"string" description:"设备ID（可选），重新登录已注册过的设备时回传"`       // 设备ID（可选）
+	Name      string `json:"name" binding:"required,max=100" example:"我的iPhone" swaggertype:"string" description:"设备名称"`                                   // 设备名称
+	Platform  string `json:"platform" binding:"omitempty,oneof=ios watchos macos android web" example:"ios" swaggertype:"string" description:"设备平台"`       // 设备平台
+	PushToken string `json:"push_token,omitempty" binding:"max=255" example:"740f4707bebcf74f" swaggertype:"string" description:"APNs推送令牌（可选），用于推送TODO提醒"` // 推送令牌
+}
+
+// RenameDeviceRequest 设备重命名请求
+type RenameDeviceRequest struct {
+	ID   string `json:"id" binding:"required" example:"6f1c3a52-6a0e-4f5e-9a53-0f3f4c1b7e21" swaggertype:"string" description:"设备ID"` // 设备ID
+	Name string `json:"name" binding:"required,max=100" example:"我的Apple Watch" swaggertype:"string" description:"设备名称"`              // 设备名称
+}
+
+// RevokeDeviceRequest 设备撤销请求
+type RevokeDeviceRequest struct {
+	ID string `json:"id" binding:"required" example:"6f1c3a52-6a0e-4f5e-9a53-0f3f4c1b7e21" swaggertype:"string" description:"设备ID"` // 设备ID
+}
+
+// ===== Webhook相关请求 =====
+
+// CreateWebhookRequest Webhook登记请求
+type CreateWebhookRequest struct {
+	URL      string   `json:"url" binding:"required,max=2048" example:"https://chat.example.com/hooks/todo" swaggertype:"string" description:"接收事件的http或https地址"`         // 接收事件的URL
+	Events   []string `json:"events,omitempty" example:"todo.completed,category.*" swaggertype:"array,string" description:"订阅的事件类型，支持 todo.*、category.* 和 * 通配，为空表示全部事件"` // 订阅的事件类型
+	AllUsers bool     `json:"all_users,omitempty" example:"false" swaggertype:"boolean" description:"是否接收全部用户的事件，仅管理员可以设置"`                                               // 是否接收全部用户的事件
+}
+
+// UpdateWebhookRequest Webhook修改请求
+type UpdateWebhookRequest struct {
+	ID           int      `json:"id" binding:"required" example:"1" swaggertype:"integer" description:"Webhook ID"`                                                   // Webhook ID
+	URL          string   `json:"url" binding:"required,max=2048" example:"https://chat.example.com/hooks/todo" swaggertype:"string" description:"接收事件的http或https地址"` // 接收事件的URL
+	Events       []string `json:"events,omitempty" example:"todo.*" swaggertype:"array,string" description:"订阅的事件类型，为空表示全部事件"`                                        // 订阅的事件类型
+	Enabled      *bool    `json:"enabled,omitempty" example:"true" swaggertype:"boolean" description:"是否启用，为空时保持不变；重新启用被自动停用的Webhook时连续失败次数清零"`                       // 是否启用
+	AllUsers     bool     `json:"all_users,omitempty" example:"false" swaggertype:"boolean" description:"是否接收全部用户的事件，仅管理员可以设置"`                                       // 是否接收全部用户的事件
+	RotateSecret bool     `json:"rotate_secret,omitempty" example:"false" swaggertype:"boolean" description:"是否重新生成签名密钥，新密钥只在本次响应中返回"`                                // 是否重新生成签名密钥
+}
+
+// DeleteWebhookRequest Webhook删除请求
+type DeleteWebhookRequest struct {
+	ID int `json:"id" binding:"required" example:"1" swaggertype:"integer" description:"Webhook ID"` // Webhook ID
+}
+
+// WebhookDeliveriesRequest Webhook投递记录查询请求
+type WebhookDeliveriesRequest struct {
+	ID    int `json:"id" binding:"required" example:"1" swaggertype:"integer" description:"Webhook ID"`        // Webhook ID
+	Limit int `json:"limit,omitempty" example:"50" swaggertype:"integer" description:"最多返回的投递记录数（默认50，最大500）"` // 最多返回的投递记录数
+}
+
+// ReplayWebhookRequest Webhook投递记录重放请求
+type ReplayWebhookRequest struct {
+	ID         int `json:"id" binding:"required" example:"1" swaggertype:"integer" description:"Webhook ID"`           // Webhook ID
+	DeliveryID int `json:"delivery_id" binding:"required" example:"42" swaggertype:"integer" description:"要重放的投递记录ID"` // 要重放的投递记录ID
+}
+
+// ===== 日历订阅相关请求 =====
+
+// CreateCalendarFeedRequest 日历订阅创建请求
+type CreateCalendarFeedRequest struct {
+	Name         string `json:"name" binding:"max=100" example:"工作截止日期" swaggertype:"string" description:"订阅名称，用作日历名称"`                                                                  // 订阅名称
+	CategoryID   *int   `json:"category_id,omitempty" example:"1" swaggertype:"integer" description:"只包含该分类的TODO，为空表示全部TODO"`                                                            // 限定的分类ID
+	CategoryUUID string `json:"category_uuid,omitempty" binding:"omitempty,uuid" example:"3b241101-e2bb-4255-8caf-4136c566a962" swaggertype:"string" description:"按UUID限定分类，提供时优先于分类ID"` // 限定的分类UUID
+}
+
+// RotateCalendarFeedRequest 日历订阅令牌重新生成请求
+type RotateCalendarFeedRequest struct {
+	ID int `json:"id" binding:"required" example:"1" swaggertype:"integer" description:"日历订阅ID"` // 日历订阅ID
+}
+
+// DeleteCalendarFeedRequest 日历订阅删除请求
+type DeleteCalendarFeedRequest struct {
+	ID int `json:"id" binding:"required" example:"1" swaggertype:"integer" description:"日历订阅ID"` // 日历订阅ID
+}
+
+// ===== CalDAV应用专用密码相关请求 =====
+
+// CreateAppPasswordRequest 应用专用密码创建请求
+type CreateAppPasswordRequest struct {
+	Name string `json:"name" binding:"required,max=100" example:"我的Mac" swaggertype:"string" description:"名称，用于区分使用该密码的客户端"` // 名称
+}
+
+// DeleteAppPasswordRequest 应用专用密码删除请求
+type DeleteAppPasswordRequest struct {
+	ID int `json:"id" binding:"required" example:"1" swaggertype:"integer" description:"应用专用密码ID"` // 应用专用密码ID
+}
+
+// SyncAckRequest 同步确认请求
+type SyncAckRequest struct {
+	Version int64 `json:"version" binding:"required" example:"42" swaggertype:"integer" description:"客户端已应用的同步版本号"` // 客户端已应用的同步版本号
 }
@@ -21,6 +21,7 @@ const (
 	CodeNotFound           = 10005 // 资源不存在
 	CodeInternalError      = 10006 // 内部错误
 	CodeUnauthorized       = 10007 // 未授权
+	CodeTokenRevoked       = 10008 // Token已被撤销，需要重新登录
 )
 
 // SuccessResponse 成功响应
@@ -40,30 +41,123 @@ func ErrorResponse(code int, message string) Response {
 	}
 }
 
+// TokenResponse 登录/刷新令牌响应
+type TokenResponse struct {
+	Token        string             `json:"token" example:"eyJhbGciOiJIUzI1NiIs..." swaggertype:"string" description:"访问令牌"` // 访问令牌
+	RefreshToken string             `json:"refresh_token" example:"hW3k...Q" swaggertype:"string" description:"刷新令牌"`        // 刷新令牌
+	ExpiresIn    int64              `json:"expires_in" example:"3600" swaggertype:"integer" description:"访问令牌有效期（秒）"`        // 访问令牌有效期（秒）
+	User         *repository.User   `json:"user,omitempty" description:"用户信息（仅登录时返回）"`                                       // 用户信息（仅登录时返回）
+	Device       *repository.Device `json:"device,omitempty" description:"当前会话绑定的设备"`                                        // 当前会话绑定的设备
+}
+
+// UpdateTodoResponse TODO更新响应
+type UpdateTodoResponse struct {
+	Message string           `json:"message" example:"TODO更新成功" swaggertype:"string" description:"结果消息"` // 结果消息
+	Next    *repository.Todo `json:"next,omitempty" description:"完成重复TODO时生成的下一次实例"`                     // 完成重复TODO时生成的下一次实例
+}
+
+// TodoPageResponse TODO游标分页响应
+type TodoPageResponse struct {
+	Items      []repository.Todo `json:"items" description:"本页TODO"`
+	NextCursor string            `json:"next_cursor,omitempty" example:"eyJrIjp7ImlkIjo0Mn19" swaggertype:"string" description:"下一页游标，仅 has_more 为 true 时返回"`
+	HasMore    bool              `json:"has_more" example:"true" swaggertype:"boolean" description:"是否还有下一页"`
+	Total      *int              `json:"total,omitempty" example:"57" swaggertype:"integer" description:"满足条件的总数，仅请求 include_total 时返回"`
+}
+
+// SearchErrorResponse 搜索语法错误的位置，以字符计
+type SearchErrorResponse struct {
+	Offset int `json:"offset" example:"12" swaggertype:"integer" description:"出错片段的起始位置（从0开始）"` // 出错片段的起始位置（从0开始）
+	Length int `json:"length" example:"3" swaggertype:"integer" description:"出错片段的长度"`          // 出错片段的长度
+}
+
+// TagRewriteResponse 标签重命名、合并和删除的响应
+type TagRewriteResponse struct {
+	Message        string `json:"message" example:"标签重命名成功" swaggertype:"string" description:"结果消息"`             // 结果消息
+	RewrittenTodos int    `json:"rewritten_todos" example:"12" swaggertype:"integer" description:"标签被改写的TODO数量"` // 标签被改写的TODO数量
+}
+
+// ===== 回收站相关响应 =====
+
+// TrashResponse 回收站内容
+type TrashResponse struct {
+	Todos      []repository.Todo     `json:"todos" description:"已删除的TODO，按删除时间从新到旧排序"`
+	Categories []repository.Category `json:"categories" description:"已删除的分类，按删除时间从新到旧排序"`
+}
+
+// RestoreTrashResponse 回收站恢复响应
+type RestoreTrashResponse struct {
+	Message  string               `json:"message" example:"恢复成功" swaggertype:"string" description:"结果消息"` // 结果消息
+	Todo     *repository.Todo     `json:"todo,omitempty" description:"恢复的TODO"`                           // 恢复的TODO
+	Category *repository.Category `json:"category,omitempty" description:"恢复的分类"`                         // 恢复的分类
+}
+
+// EmptyTrashResponse 清空回收站响应
+type EmptyTrashResponse struct {
+	Message           string `json:"message" example:"回收站已清空" swaggertype:"string" description:"结果消息"`             // 结果消息
+	DeletedTodos      int    `json:"deleted_todos" example:"12" swaggertype:"integer" description:"彻底删除的TODO数量"`   // 彻底删除的TODO数量
+	DeletedCategories int    `json:"deleted_categories" example:"1" swaggertype:"integer" description:"彻底删除的分类数量"` // 彻底删除的分类数量
+}
+
+// ===== 设备管理相关响应 =====
+
+// DeviceRegisterResponse 设备注册响应
+type DeviceRegisterResponse struct {
+	Device    *repository.Device `json:"device" description:"注册的设备"`                                                              // 注册的设备
+	Token     string             `json:"token" example:"eyJhbGciOiJIUzI1NiIs..." swaggertype:"string" description:"携带设备ID的新访问令牌"` // 携带设备ID的新访问令牌
+	ExpiresIn int64              `json:"expires_in" example:"3600" swaggertype:"integer" description:"访问令牌有效期（秒）"`                // 访问令牌有效期（秒）
+}
+
+// DeviceListResponse 设备列表响应
+type DeviceListResponse struct {
+	Devices         []repository.Device `json:"devices" description:"设备列表（包含已撤销的设备）"`                                                                                 // 设备列表
+	CurrentDeviceID string              `json:"current_device_id,omitempty" example:"6f1c3a52-6a0e-4f5e-9a53-0f3f4c1b7e21" swaggertype:"string" description:"当前设备ID"` // 当前设备ID
+}
+
 // ===== 数据同步相关响应 =====
 
 // SyncResponse 同步响应
 type SyncResponse struct {
-	Todos         []repository.TodoSyncItem        `json:"todos" description:"TODO同步数据"`
-	Categories    []repository.CategorySyncItem    `json:"categories" description:"分类同步数据"`
-	Settings      *repository.UserSettingsSyncItem `json:"settings,omitempty" description:"用户设置同步数据"`
-	ServerVersion int64                            `json:"server_version" example:"1640995200000" swaggertype:"integer" description:"服务器当前版本号"`
+	Todos          []repository.TodoSyncItem          `json:"todos" description:"TODO同步数据"`
+	Categories     []repository.CategorySyncItem      `json:"categories" description:"分类同步数据"`
+	ChecklistItems []repository.ChecklistItemSyncItem `json:"checklist_items" description:"检查项同步数据"`
+	Tags           []repository.TagSyncItem           `json:"tags" description:"标签元数据同步数据"`
+	SmartLists     []repository.SmartListSyncItem     `json:"smart_lists" description:"智能列表同步数据"`
+	Settings       *repository.UserSettingsSyncItem   `json:"settings,omitempty" description:"用户设置同步数据"`
+	ServerVersion  int64                              `json:"server_version" example:"42" swaggertype:"integer" description:"下次同步使用的 since；还有下一页时为本页最后一条变更的版本号"`
+	NextCursor     string                             `json:"next_cursor,omitempty" example:"eyJhIjo0MiwidSI6MTAwfQ" swaggertype:"string" description:"下一页游标，仅 has_more 为 true 时返回"`
+	HasMore        bool                               `json:"has_more" example:"false" swaggertype:"boolean" description:"是否还有下一页"`
 }
 
 // BatchSyncResponse 批量同步响应
 type BatchSyncResponse struct {
-	Success   []repository.SyncResult `json:"success" description:"成功同步的项目"`
-	Conflicts []repository.SyncResult `json:"conflicts" description:"存在冲突的项目"`
-	Errors    []repository.SyncResult `json:"errors" description:"同步失败的项目"`
+	Success    []repository.SyncResult `json:"success" description:"成功同步的项目"`
+	Conflicts  []repository.SyncResult `json:"conflicts" description:"存在冲突的项目"`
+	Errors     []repository.SyncResult `json:"errors" description:"同步失败的项目"`
+	RolledBack bool                    `json:"rolled_back" example:"false" swaggertype:"boolean" description:"atomic 模式下是否因存在冲突或失败而回滚了整个批次"`
 }
 
 // ConflictResolution 冲突解决策略
 type ConflictResolution struct {
-	Strategy string `json:"strategy" example:"server_wins" swaggertype:"string" description:"解决策略（server_wins/client_wins/merge）"`
-	TodoID   int    `json:"todo_id,omitempty" example:"1" swaggertype:"integer" description:"TODO ID"`
+	Strategy string `json:"strategy" binding:"oneof=server_wins client_wins merge" example:"server_wins" swaggertype:"string" description:"解决策略（server_wins/client_wins/merge）"`
+	TodoID   int    `json:"todo_id" binding:"required" example:"1" swaggertype:"integer" description:"TODO ID"`
 }
 
 // SyncVersionResponse 同步版本响应
 type SyncVersionResponse struct {
-	Version int64 `json:"version" example:"1640995200000" swaggertype:"integer" description:"当前服务器版本号"`
+	Version int64 `json:"version" example:"42" swaggertype:"integer" description:"当前服务器版本号"`
+}
+
+// AppPasswordResponse 创建应用专用密码的响应，密码只在本次响应中返回
+type AppPasswordResponse struct {
+	AppPassword *repository.AppPassword `json:"app_password" description:"应用专用密码"`                                                            // 应用专用密码
+	Password    string                  `json:"password" example:"hW3k...Q" swaggertype:"string" description:"密码，在CalDAV客户端中与用户名一起填写"`        // 密码
+	Username    string                  `json:"username" example:"alice" swaggertype:"string" description:"CalDAV用户名"`                        // 用户名
+	URL         string                  `json:"url" example:"https://todo.example.com/caldav/" swaggertype:"string" description:"CalDAV服务地址"` // CalDAV服务地址
+}
+
+// CalendarFeedResponse 创建日历订阅或重新生成令牌的响应，令牌和订阅地址只在本次响应中返回
+type CalendarFeedResponse struct {
+	Feed  *repository.CalendarFeed `json:"feed" description:"日历订阅"`                                                                                                                            // 日历订阅
+	Token string                   `json:"token" example:"hW3k...Q" swaggertype:"string" description:"订阅令牌"`                                                                                   // 订阅令牌
+	URL   string                   `json:"url" example:"https://todo.example.com/api/calendar/hW3k...Q.ics" swaggertype:"string" description:"iCalendar订阅地址，可在Apple日历、Thunderbird和Outlook中添加"` // iCalendar订阅地址
 }
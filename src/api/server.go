@@ -0,0 +1,245 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"todo-service/src/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Server 持有处理器依赖的全部组件，处理器均为其方法
+type Server struct {
+	store      repository.Store
+	jwt        *JWTSigner
+	now        func() time.Time
+	logger     *log.Logger
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+
+	streamHeartbeat time.Duration
+	admins          map[string]bool // 管理员用户名
+	privateWebhooks bool            // 是否允许Webhook地址为本机和内网地址
+	caldavThrottle  *authThrottle   // CalDAV认证失败限制
+}
+
+// Option Server 可选配置
+type Option func(*Server)
+
+// WithClock 设置时钟，测试中可用于固定当前时间
+func WithClock(now func() time.Time) Option {
+	return func(s *Server) {
+		s.now = now
+	}
+}
+
+// WithLogger 设置日志记录器
+func WithLogger(logger *log.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithTokenTTL 设置访问令牌和刷新令牌的有效期
+func WithTokenTTL(access, refresh time.Duration) Option {
+	return func(s *Server) {
+		s.accessTTL = access
+		s.refreshTTL = refresh
+	}
+}
+
+// DefaultStreamHeartbeat 变更推送连接空闲时发送心跳的间隔，需小于常见代理的空闲超时
+const DefaultStreamHeartbeat = 25 * time.Second
+
+// WithStreamHeartbeat 设置变更推送连接的心跳间隔
+func WithStreamHeartbeat(interval time.Duration) Option {
+	return func(s *Server) {
+		s.streamHeartbeat = interval
+	}
+}
+
+// WithAdmins 设置管理员用户名，管理员可以登记接收全部用户事件的Webhook
+func WithAdmins(usernames ...string) Option {
+	return func(s *Server) {
+		for _, username := range usernames {
+			if username = strings.TrimSpace(username); username != "" {
+				s.admins[username] = true
+			}
+		}
+	}
+}
+
+// WithPrivateWebhooks 设置是否允许登记本机和内网地址的Webhook，应与事件Webhook发送任务的配置一致
+func WithPrivateWebhooks(allow bool) Option {
+	return func(s *Server) {
+		s.privateWebhooks = allow
+	}
+}
+
+// NewServer 创建API服务实例
+func NewServer(store repository.Store, jwtSecret []byte, opts ...Option) *Server {
+	s := &Server{
+		store:      store,
+		now:        time.Now,
+		logger:     log.New(os.Stderr, "", log.LstdFlags),
+		accessTTL:  DefaultAccessTokenTTL,
+		refreshTTL: DefaultRefreshTokenTTL,
+
+		streamHeartbeat: DefaultStreamHeartbeat,
+		admins:          make(map[string]bool),
+		caldavThrottle:  newAuthThrottle(caldavAuthFailureLimit, caldavAuthFailureWindow),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.jwt = NewJWTSigner(jwtSecret, s.accessTTL, s.now)
+	return s
+}
+
+// RegisterRoutes 注册全部API路由
+func (s *Server) RegisterRoutes(r *gin.Engine) {
+	// CORS中间件
+	r.Use(func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", "*")
+		if strings.HasPrefix(c.Request.URL.Path, caldavPath) {
+			// 网页CalDAV客户端需要WebDAV方法和条件请求头，并读取 ETag
+			c.Header("Access-Control-Allow-Methods", strings.Join(caldavMethods, ", "))
+			c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, Depth, If-Match, If-None-Match")
+			c.Header("Access-Control-Expose-Headers", "DAV, ETag")
+		} else {
+			c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization")
+		}
+
+		// CalDAV客户端通过OPTIONS查询支持的功能，由CalDAV处理
+		if c.Request.Method == "OPTIONS" && !strings.HasPrefix(c.Request.URL.Path, caldavPath) {
+			c.AbortWithStatus(204)
+			return
+		}
+
+		c.Next()
+	})
+
+	// 添加日志中间件
+	r.Use(s.LoggerMiddleware())
+
+	// 公开路由
+	r.POST("/api/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, SuccessResponse(gin.H{"message": "Test POST endpoint"}))
+	})
+	r.POST("/api/auth/register", s.Register)
+	r.POST("/api/auth/login", s.Login)
+	r.POST("/api/auth/refresh", s.RefreshToken)
+	r.POST("/api/auth/logout", s.AuthMiddleware(), s.Logout)
+	r.POST("/api/auth/logout-all", s.AuthMiddleware(), s.LogoutAll)
+	// 日历订阅以地址中的令牌认证
+	r.GET(calendarFeedPath+":token", s.CalendarFeed)
+	r.HEAD(calendarFeedPath+":token", s.CalendarFeed)
+	// CalDAV以HTTP基本认证认证，/.well-known/caldav 供客户端自动发现服务地址
+	for _, method := range caldavMethods {
+		r.Handle(method, caldavPath+"*path", s.CalDAV)
+		r.Handle(method, "/.well-known/caldav", func(c *gin.Context) {
+			c.Redirect(http.StatusMovedPermanently, caldavPath)
+		})
+	}
+
+	// v1 API - 扩展功能
+	v1 := r.Group("/api/v1")
+	v1.Use(s.AuthMiddleware())
+	{
+		// v1.POST("/todos/list", s.GetTodos)
+		// v1.POST("/todos/create", s.CreateTodo)
+		// v1.POST("/todos/update", s.UpdateTodo)
+		// v1.POST("/todos/delete", s.DeleteTodo)
+		v1.POST("/profile", s.GetProfile)
+		// 扩展TODO管理
+		v1.POST("/todos/list", s.GetTodosExtended)
+		v1.POST("/todos/create", s.CreateTodoExtended)
+		v1.POST("/todos/update", s.UpdateTodoExtended)
+		v1.POST("/todos/delete", s.DeleteTodoExtended)
+		v1.POST("/todos/search", s.SearchTodos)
+		v1.POST("/todos/history", s.GetTodoHistory)
+		v1.POST("/todos/revert", s.RevertTodo)
+		v1.POST("/todos/reminders", s.GetReminderDeliveries)
+
+		// TODO检查项
+		v1.POST("/todos/checklist", s.GetChecklist)
+		v1.POST("/todos/checklist/create", s.CreateChecklistItem)
+		v1.POST("/todos/checklist/update", s.UpdateChecklistItem)
+		v1.POST("/todos/checklist/toggle", s.ToggleChecklistItem)
+		v1.POST("/todos/checklist/reorder", s.ReorderChecklist)
+		v1.POST("/todos/checklist/delete", s.DeleteChecklistItem)
+
+		// 回收站
+		v1.POST("/trash", s.GetTrash)
+		v1.POST("/trash/restore", s.RestoreTrashItem)
+		v1.POST("/trash/delete", s.DeleteTrashItem)
+		v1.POST("/trash/empty", s.EmptyTrash)
+
+		// 分类管理
+		v1.POST("/categories", s.GetCategories)
+		v1.POST("/categories/create", s.CreateCategory)
+		v1.POST("/categories/update", s.UpdateCategory)
+		v1.POST("/categories/delete", s.DeleteCategory)
+
+		// 标签管理
+		v1.POST("/tags", s.GetTags)
+		v1.POST("/tags/create", s.CreateTag)
+		v1.POST("/tags/update", s.UpdateTag)
+		v1.POST("/tags/rename", s.RenameTag)
+		v1.POST("/tags/merge", s.MergeTags)
+		v1.POST("/tags/delete", s.DeleteTag)
+
+		// 智能列表
+		v1.POST("/smart-lists", s.GetSmartLists)
+		v1.POST("/smart-lists/create", s.CreateSmartList)
+		v1.POST("/smart-lists/update", s.UpdateSmartList)
+		v1.POST("/smart-lists/delete", s.DeleteSmartList)
+		v1.POST("/smart-lists/todos", s.GetSmartListTodos)
+
+		// 用户设置
+		v1.POST("/settings", s.GetUserSettings)
+		v1.POST("/settings/update", s.UpdateUserSettings)
+
+		// 数据同步
+		v1.POST("/sync/version", s.GetSyncVersion)
+		v1.POST("/sync/todos", s.IncrementalSync)
+		v1.POST("/sync/batch", s.BatchSync)
+		v1.POST("/sync/ack", s.AckSync)
+		v1.GET("/sync/stream", s.SyncStream)
+
+		// 设备管理
+		v1.POST("/devices", s.GetDevices)
+		v1.POST("/devices/register", s.RegisterDevice)
+		v1.POST("/devices/rename", s.RenameDevice)
+		v1.POST("/devices/revoke", s.RevokeDevice)
+
+		// Webhook
+		v1.POST("/webhooks", s.GetWebhooks)
+		v1.POST("/webhooks/create", s.CreateWebhook)
+		v1.POST("/webhooks/update", s.UpdateWebhook)
+		v1.POST("/webhooks/delete", s.DeleteWebhook)
+		v1.POST("/webhooks/deliveries", s.GetWebhookDeliveries)
+		v1.POST("/webhooks/replay", s.ReplayWebhookDelivery)
+
+		// 日历订阅
+		v1.POST("/calendar/feeds", s.GetCalendarFeeds)
+		v1.POST("/calendar/feeds/create", s.CreateCalendarFeed)
+		v1.POST("/calendar/feeds/rotate", s.RotateCalendarFeed)
+		v1.POST("/calendar/feeds/delete", s.DeleteCalendarFeed)
+		v1.POST("/caldav/passwords", s.GetAppPasswords)
+		v1.POST("/caldav/passwords/create", s.CreateAppPassword)
+		v1.POST("/caldav/passwords/delete", s.DeleteAppPassword)
+	}
+}
+
+// Handler 返回注册好全部路由的 http.Handler，便于配合 httptest 使用
+func (s *Server) Handler() http.Handler {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	s.RegisterRoutes(r)
+	return r
+}
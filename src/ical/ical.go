@@ -0,0 +1,251 @@
+// Package ical 按RFC 5545在TODO和iCalendar（VTODO/VEVENT）之间转换，供日历订阅和CalDAV使用
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"todo-service/src/repository"
+)
+
+// ProdID 生成iCalendar数据的产品标识
+const ProdID = "-//todo-service//TODO Calendar//EN"
+
+// maxLineOctets 内容行折行前的最大字节数，不含CRLF
+const maxLineOctets = 75
+
+// dateTimeFormat UTC时间的DATE-TIME格式
+const dateTimeFormat = "20060102T150405Z"
+
+// 日历中TODO的组件类型
+const (
+	ComponentTodo  = "VTODO"  // 待办，Apple日历（提醒事项）和Thunderbird支持
+	ComponentEvent = "VEVENT" // 在截止时间发生的事件，供不显示订阅日历中待办的客户端（如Outlook）使用
+)
+
+// Calendar 一个iCalendar对象
+type Calendar struct {
+	Name            string            // 日历名称（X-WR-CALNAME），为空时不输出
+	Method          string            // METHOD，订阅使用 PUBLISH，为空时不输出
+	RefreshInterval time.Duration     // 建议客户端刷新的间隔，为0时不输出
+	Component       string            // ComponentTodo 或 ComponentEvent，为空时为 ComponentTodo
+	Todos           []repository.Todo // 已删除的TODO不输出，VEVENT只输出设置了截止时间的TODO
+	Categories      map[int]string    // 分类ID到名称，用于 CATEGORIES
+}
+
+// Encode 把日历编码为iCalendar文本，所有时间均以UTC表示
+func Encode(cal *Calendar) []byte {
+	var buf bytes.Buffer
+	cal.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+// WriteTo 把日历写入 w，实现 io.WriterTo
+func (cal *Calendar) WriteTo(w io.Writer) (int64, error) {
+	lw := &lineWriter{w: w}
+	lw.line("BEGIN", "VCALENDAR")
+	lw.line("VERSION", "2.0")
+	lw.line("PRODID", ProdID)
+	lw.line("CALSCALE", "GREGORIAN")
+	if cal.Method != "" {
+		lw.line("METHOD", cal.Method)
+	}
+	if cal.Name != "" {
+		lw.line("X-WR-CALNAME", escapeText(cal.Name))
+	}
+	if cal.RefreshInterval > 0 {
+		lw.line("REFRESH-INTERVAL;VALUE=DURATION", formatDuration(cal.RefreshInterval))
+		lw.line("X-PUBLISHED-TTL", formatDuration(cal.RefreshInterval))
+	}
+	for i := range cal.Todos {
+		todo := &cal.Todos[i]
+		if todo.IsDeleted {
+			continue
+		}
+		if cal.Component == ComponentEvent {
+			if todo.DueDate != nil {
+				cal.writeEvent(lw, todo)
+			}
+		} else {
+			cal.writeTodo(lw, todo)
+		}
+	}
+	lw.line("END", "VCALENDAR")
+	return lw.n, lw.err
+}
+
+// writeTodo 输出VTODO：截止时间为 DUE，完成状态为 STATUS/COMPLETED，提醒为 VALARM
+func (cal *Calendar) writeTodo(lw *lineWriter, todo *repository.Todo) {
+	lw.line("BEGIN", ComponentTodo)
+	cal.writeCommon(lw, todo)
+	if todo.DueDate != nil {
+		lw.line("DUE", formatTime(*todo.DueDate))
+	}
+	if todo.Completed {
+		lw.line("STATUS", "COMPLETED")
+		lw.line("COMPLETED", formatTime(todo.UpdatedAt))
+		lw.line("PERCENT-COMPLETE", "100")
+	} else {
+		lw.line("STATUS", "NEEDS-ACTION")
+		if todo.ChecklistTotal > 0 {
+			lw.line("PERCENT-COMPLETE", fmt.Sprint(todo.ChecklistCompleted*100/todo.ChecklistTotal))
+		}
+	}
+	writeAlarm(lw, todo)
+	lw.line("END", ComponentTodo)
+}
+
+// writeEvent 输出在截止时间发生、不占用忙闲时间的VEVENT，VEVENT没有完成状态，已完成的TODO在标题前加“✓”
+func (cal *Calendar) writeEvent(lw *lineWriter, todo *repository.Todo) {
+	lw.line("BEGIN", ComponentEvent)
+	cal.writeCommon(lw, todo)
+	lw.line("DTSTART", formatTime(*todo.DueDate))
+	lw.line("DTEND", formatTime(*todo.DueDate))
+	lw.line("TRANSP", "TRANSPARENT")
+	writeAlarm(lw, todo)
+	lw.line("END", ComponentEvent)
+}
+
+// writeCommon 输出VTODO和VEVENT共有的属性
+func (cal *Calendar) writeCommon(lw *lineWriter, todo *repository.Todo) {
+	lw.line("UID", escapeText(todo.UUID))
+	lw.line("DTSTAMP", formatTime(todo.UpdatedAt))
+	lw.line("CREATED", formatTime(todo.CreatedAt))
+	lw.line("LAST-MODIFIED", formatTime(todo.UpdatedAt))
+	summary := todo.Title
+	if cal.Component == ComponentEvent && todo.Completed {
+		summary = "✓ " + summary
+	}
+	lw.line("SUMMARY", escapeText(summary))
+	if todo.Description != "" {
+		lw.line("DESCRIPTION", escapeText(todo.Description))
+	}
+	lw.line("PRIORITY", fmt.Sprint(Priority(todo.Priority)))
+	if categories := cal.categories(todo); len(categories) > 0 {
+		lw.line("CATEGORIES", strings.Join(categories, ","))
+	}
+	// 重复TODO完成后由下一次实例继续，已完成的实例不再输出重复规则，避免日历中出现重复的后续日程
+	if todo.Recurrence != nil && *todo.Recurrence != "" && !todo.Completed {
+		lw.line("RRULE", *todo.Recurrence)
+	}
+}
+
+// categories 分类名称和标签，已转义
+func (cal *Calendar) categories(todo *repository.Todo) []string {
+	var categories []string
+	if todo.CategoryID != nil {
+		if name, ok := cal.Categories[*todo.CategoryID]; ok && name != "" {
+			categories = append(categories, escapeText(name))
+		}
+	}
+	for _, tag := range todo.Tags {
+		if tag != "" {
+			categories = append(categories, escapeText(tag))
+		}
+	}
+	return categories
+}
+
+// writeAlarm 提醒时间输出为绝对时间触发的 VALARM
+func writeAlarm(lw *lineWriter, todo *repository.Todo) {
+	if todo.Reminder == nil || todo.Completed {
+		return
+	}
+	lw.line("BEGIN", "VALARM")
+	lw.line("ACTION", "DISPLAY")
+	lw.line("DESCRIPTION", escapeText(todo.Title))
+	lw.line("TRIGGER;VALUE=DATE-TIME", formatTime(*todo.Reminder))
+	lw.line("END", "VALARM")
+}
+
+// Priority 把TODO优先级映射为iCalendar的 PRIORITY（1最高，9最低）：紧急1、高3、中5、低9
+func Priority(p repository.Priority) int {
+	switch p {
+	case repository.PriorityUrgent:
+		return 1
+	case repository.PriorityHigh:
+		return 3
+	case repository.PriorityMedium:
+		return 5
+	default:
+		return 9
+	}
+}
+
+// formatTime 把时间格式化为UTC的DATE-TIME
+func formatTime(t time.Time) string {
+	return t.UTC().Format(dateTimeFormat)
+}
+
+// formatDuration 把时间间隔格式化为 DURATION（精确到分钟，至少1分钟）
+func formatDuration(d time.Duration) string {
+	minutes := max(int(d/time.Minute), 1)
+	if minutes%60 == 0 {
+		return fmt.Sprintf("PT%dH", minutes/60)
+	}
+	return fmt.Sprintf("PT%dM", minutes)
+}
+
+// escapeText 按TEXT值类型转义反斜杠、分号、逗号和换行
+func escapeText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\', ';', ',':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// lineWriter 输出以CRLF结尾的内容行，超过75字节时在字符边界折行，记录第一个写入错误
+type lineWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (lw *lineWriter) line(name, value string) {
+	lw.write(fold(name + ":" + value))
+}
+
+func (lw *lineWriter) write(s string) {
+	if lw.err != nil {
+		return
+	}
+	n, err := io.WriteString(lw.w, s)
+	lw.n += int64(n)
+	lw.err = err
+}
+
+// fold 把内容行折成不超过75字节的多行，续行以一个空格开头
+func fold(line string) string {
+	if len(line) <= maxLineOctets {
+		return line + "\r\n"
+	}
+	var b strings.Builder
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = maxLineOctets - 1 // 续行开头的空格占一个字节
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
@@ -0,0 +1,173 @@
+package ical
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"todo-service/src/repository"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func TestEncodeTodo(t *testing.T) {
+	created := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	updated := time.Date(2026, 10, 2, 9, 30, 0, 0, time.UTC)
+	due := time.Date(2026, 10, 20, 18, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	cal := &Calendar{
+		Name:            "工作",
+		Method:          "PUBLISH",
+		RefreshInterval: 15 * time.Minute,
+		Categories:      map[int]string{1: "工作"},
+		Todos: []repository.Todo{
+			{
+				UUID: "todo-1", Title: "周报, 第42周", Description: "第一行\n第二行; 完",
+				Priority: repository.PriorityUrgent, DueDate: &due, Reminder: ptr(due.Add(-time.Hour)),
+				CategoryID: ptr(1), Tags: repository.StringSlice{"周期"}, Recurrence: ptr("FREQ=WEEKLY"),
+				ChecklistTotal: 4, ChecklistCompleted: 1, CreatedAt: created, UpdatedAt: updated,
+			},
+			{UUID: "todo-2", Title: "已完成", Completed: true, DueDate: &due, Reminder: &due,
+				Recurrence: ptr("FREQ=DAILY"), CreatedAt: created, UpdatedAt: updated},
+			{UUID: "todo-3", Title: "没有截止时间", CreatedAt: created, UpdatedAt: updated},
+		},
+	}
+	got := string(Encode(cal))
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:" + ProdID + "\r\nCALSCALE:GREGORIAN\r\nMETHOD:PUBLISH\r\n",
+		"X-WR-CALNAME:工作\r\nREFRESH-INTERVAL;VALUE=DURATION:PT15M\r\nX-PUBLISHED-TTL:PT15M\r\n",
+		"BEGIN:VTODO\r\nUID:todo-1\r\nDTSTAMP:20261002T093000Z\r\nCREATED:20261001T080000Z\r\n",
+		"SUMMARY:周报\\, 第42周\r\nDESCRIPTION:第一行\\n第二行\\; 完\r\nPRIORITY:1\r\nCATEGORIES:工作,周期\r\nRRULE:FREQ=WEEKLY\r\n",
+		"DUE:20261020T100000Z\r\nSTATUS:NEEDS-ACTION\r\nPERCENT-COMPLETE:25\r\n",
+		"BEGIN:VALARM\r\nACTION:DISPLAY\r\nDESCRIPTION:周报\\, 第42周\r\nTRIGGER;VALUE=DATE-TIME:20261020T090000Z\r\nEND:VALARM\r\nEND:VTODO\r\n",
+		"UID:todo-2\r\n",
+		"PRIORITY:9\r\nDUE:20261020T100000Z\r\nSTATUS:COMPLETED\r\nCOMPLETED:20261002T093000Z\r\nPERCENT-COMPLETE:100\r\nEND:VTODO\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Encode() missing %q in\n%s", want, got)
+		}
+	}
+	// 已完成的TODO不输出重复规则和提醒，没有截止时间的TODO不输出 DUE
+	if strings.Count(got, "RRULE") != 1 || strings.Count(got, "BEGIN:VALARM") != 1 || strings.Count(got, "DUE:") != 2 ||
+		!strings.Contains(got, "SUMMARY:没有截止时间\r\nPRIORITY:9\r\nSTATUS:NEEDS-ACTION\r\nEND:VTODO") {
+		t.Errorf("Encode() =\n%s", got)
+	}
+	if !strings.HasSuffix(got, "END:VCALENDAR\r\n") {
+		t.Errorf("Encode() does not end with END:VCALENDAR")
+	}
+}
+
+func TestEncodeEvent(t *testing.T) {
+	due := time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC)
+	cal := &Calendar{
+		Component: ComponentEvent,
+		Todos: []repository.Todo{
+			{UUID: "todo-1", Title: "周报", Priority: repository.PriorityHigh, DueDate: &due, Completed: true},
+		},
+	}
+	got := string(Encode(cal))
+	for _, want := range []string{
+		"BEGIN:VEVENT\r\nUID:todo-1\r\n",
+		"SUMMARY:✓ 周报\r\nPRIORITY:3\r\nDTSTART:20261020T100000Z\r\nDTEND:20261020T100000Z\r\nTRANSP:TRANSPARENT\r\nEND:VEVENT\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Encode() missing %q in\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "VTODO") || strings.Contains(got, "METHOD") || strings.Contains(got, "X-WR-CALNAME") {
+		t.Errorf("Encode() =\n%s", got)
+	}
+}
+
+func TestFold(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("待办事项", 10)
+	got := fold(line)
+	parts := strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n")
+	if len(parts) < 2 {
+		t.Fatalf("fold() = %q, want several lines", got)
+	}
+	var joined strings.Builder
+	for i, part := range parts {
+		if len(part) > maxLineOctets {
+			t.Errorf("line %d has %d octets", i, len(part))
+		}
+		if i > 0 {
+			if !strings.HasPrefix(part, " ") {
+				t.Errorf("continuation line %d = %q", i, part)
+			}
+			part = part[1:]
+		}
+		joined.WriteString(part)
+	}
+	if joined.String() != line {
+		t.Errorf("unfolded = %q, want %q", joined.String(), line)
+	}
+	if got := fold("UID:1"); got != "UID:1\r\n" {
+		t.Errorf("fold(short) = %q", got)
+	}
+}
+
+func TestParseTodo(t *testing.T) {
+	// 客户端生成的数据：LF换行、折行、带引号的参数、TZID、相对提醒和重复实例覆盖
+	data := "BEGIN:VCALENDAR\nVERSION:2.0\nPRODID:-//Apple Inc.//iOS 17.0//EN\n" +
+		"BEGIN:VTIMEZONE\nTZID:Asia/Shanghai\nEND:VTIMEZONE\n" +
+		"BEGIN:VTODO\nUID:2F9C6E2A-1B1D-4C55-9E3B-7A0E4C1D2B3A\nSUMMARY:周报\\, 第42周\n" +
+		"DESCRIPTION:第一行\\n第二\n 行\nDUE;TZID=\"Asia/Shanghai\":20261020T180000\n" +
+		"DTSTART;TZID=Asia/Shanghai:20261020T090000\nPRIORITY:1\nSTATUS:NEEDS-ACTION\n" +
+		"CATEGORIES:工作,a\\,b\nCATEGORIES:周期\nRRULE:FREQ=WEEKLY;BYDAY=MO\n" +
+		"BEGIN:VALARM\nACTION:DISPLAY\nTRIGGER;RELATED=END:-PT1H30M\nEND:VALARM\nEND:VTODO\n" +
+		"BEGIN:VTODO\nUID:2F9C6E2A-1B1D-4C55-9E3B-7A0E4C1D2B3A\nRECURRENCE-ID:20261027T100000Z\nSUMMARY:覆盖\nEND:VTODO\n" +
+		"END:VCALENDAR\n"
+	todo, err := ParseTodo([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseTodo() error = %v", err)
+	}
+	due := time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC)
+	if todo.UID != "2F9C6E2A-1B1D-4C55-9E3B-7A0E4C1D2B3A" || todo.Summary != "周报, 第42周" || todo.Description != "第一行\n第二行" ||
+		todo.Due == nil || !todo.Due.Equal(due) || todo.Priority != 1 || todo.Completed || todo.RRule != "FREQ=WEEKLY;BYDAY=MO" ||
+		strings.Join(todo.Categories, "|") != "工作|a,b|周期" || todo.Alarm == nil || !todo.Alarm.Equal(due.Add(-90*time.Minute)) {
+		t.Errorf("ParseTodo() = %+v", todo)
+	}
+
+	// 相对提醒默认以 DTSTART 为基准，COMPLETED 表示已完成
+	data = "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nUID:1\r\nDTSTART:20261020T090000Z\r\nDUE;VALUE=DATE:20261021\r\n" +
+		"COMPLETED:20261020T120000Z\r\nBEGIN:VALARM\r\nTRIGGER:-P1D\r\nEND:VALARM\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+	if todo, err = ParseTodo([]byte(data)); err != nil {
+		t.Fatalf("ParseTodo() error = %v", err)
+	}
+	if !todo.Completed || !todo.Due.Equal(time.Date(2026, 10, 21, 0, 0, 0, 0, time.UTC)) ||
+		!todo.Alarm.Equal(time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("ParseTodo() = %+v", todo)
+	}
+
+	for _, invalid := range []string{
+		"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:1\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+		"BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY:没有UID\r\nEND:VTODO\r\nEND:VCALENDAR\r\n",
+		"BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nUID:1\r\nEND:VCALENDAR\r\n",
+		"BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nUID:1\r\nPRIORITY:high\r\nEND:VTODO\r\nEND:VCALENDAR\r\n",
+		"BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nUID:1\r\nBEGIN:VALARM\r\nTRIGGER:-15M\r\nEND:VALARM\r\nEND:VTODO\r\nEND:VCALENDAR\r\n",
+		"not icalendar",
+	} {
+		if _, err := ParseTodo([]byte(invalid)); !errors.Is(err, ErrInvalid) {
+			t.Errorf("ParseTodo(%q) error = %v, want ErrInvalid", invalid, err)
+		}
+	}
+}
+
+func TestParseTodoRoundTrip(t *testing.T) {
+	due := time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC)
+	for _, priority := range []repository.Priority{repository.PriorityLow, repository.PriorityMedium, repository.PriorityHigh, repository.PriorityUrgent} {
+		source := repository.Todo{UUID: "todo-1", Title: "a;b,c\\d", Priority: priority, DueDate: &due, Reminder: ptr(due.Add(-time.Hour)),
+			Tags: repository.StringSlice{"x,y"}, Recurrence: ptr("FREQ=DAILY")}
+		todo, err := ParseTodo(Encode(&Calendar{Todos: []repository.Todo{source}}))
+		if err != nil {
+			t.Fatalf("ParseTodo() error = %v", err)
+		}
+		if todo.UID != source.UUID || todo.Summary != source.Title || TodoPriority(todo.Priority) != priority ||
+			!todo.Due.Equal(due) || !todo.Alarm.Equal(*source.Reminder) || len(todo.Categories) != 1 || todo.Categories[0] != "x,y" ||
+			todo.RRule != "FREQ=DAILY" {
+			t.Errorf("round trip of %+v = %+v", source, todo)
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"todo-service/src/repository"
+)
+
+// ErrInvalid iCalendar数据格式错误或不包含可用的VTODO
+var ErrInvalid = errors.New("invalid iCalendar data")
+
+// Property 一个内容行，属性名和参数名均为大写，参数值已去掉引号，属性值未反转义
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Component iCalendar组件，如 VCALENDAR、VTODO、VALARM
+type Component struct {
+	Name       string
+	Properties []Property
+	Components []*Component
+}
+
+// Prop 返回第一个名为 name 的属性，不存在时返回nil
+func (c *Component) Prop(name string) *Property {
+	for i := range c.Properties {
+		if c.Properties[i].Name == name {
+			return &c.Properties[i]
+		}
+	}
+	return nil
+}
+
+// Parse 解析iCalendar文本，返回最外层组件；兼容只以LF换行的数据
+func Parse(data []byte) (*Component, error) {
+	var root *Component
+	var stack []*Component
+	for _, line := range unfold(string(data)) {
+		prop, err := parseLine(line)
+		if err != nil {
+			return nil, err
+		}
+		switch prop.Name {
+		case "BEGIN":
+			comp := &Component{Name: strings.ToUpper(prop.Value)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, comp)
+			} else if root != nil {
+				return nil, fmt.Errorf("%w: more than one top-level component", ErrInvalid)
+			} else {
+				root = comp
+			}
+			stack = append(stack, comp)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+				return nil, fmt.Errorf("%w: unexpected END:%s", ErrInvalid, prop.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("%w: property %s outside of a component", ErrInvalid, prop.Name)
+			}
+			comp := stack[len(stack)-1]
+			comp.Properties = append(comp.Properties, prop)
+		}
+	}
+	if root == nil || len(stack) > 0 {
+		return nil, fmt.Errorf("%w: missing BEGIN or END", ErrInvalid)
+	}
+	return root, nil
+}
+
+// unfold 把折行的内容行合并，去掉空行
+func unfold(data string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// parseLine 解析 name *(";" param "=" value) ":" value 形式的内容行，参数值可以用双引号包含分号和冒号
+func parseLine(line string) (Property, error) {
+	prop := Property{Params: map[string]string{}}
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return prop, fmt.Errorf("%w: invalid content line %q", ErrInvalid, line)
+	}
+	prop.Name = strings.ToUpper(line[:i])
+	rest := line[i:]
+	for rest[0] == ';' {
+		rest = rest[1:]
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return prop, fmt.Errorf("%w: invalid parameter in %q", ErrInvalid, line)
+		}
+		name := strings.ToUpper(rest[:eq])
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return prop, fmt.Errorf("%w: unterminated quoted parameter in %q", ErrInvalid, line)
+			}
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			end := strings.IndexAny(rest, ";:")
+			if end < 0 {
+				return prop, fmt.Errorf("%w: missing value in %q", ErrInvalid, line)
+			}
+			value, rest = rest[:end], rest[end:]
+		}
+		prop.Params[name] = value
+		if rest == "" {
+			return prop, fmt.Errorf("%w: missing value in %q", ErrInvalid, line)
+		}
+	}
+	prop.Value = rest[1:]
+	return prop, nil
+}
+
+// unescapeText 还原TEXT值中转义的反斜杠、分号、逗号和换行
+func unescapeText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// splitText 按未转义的逗号拆分多值的TEXT属性（如 CATEGORIES），并反转义每个值
+func splitText(s string) []string {
+	var values []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			values = append(values, unescapeText(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(values, unescapeText(s[start:]))
+}
+
+// parseTime 解析DATE-TIME或DATE值：以Z结尾为UTC，带 TZID 参数时按该时区，浮动时间、DATE和无法识别的时区按UTC
+func parseTime(prop *Property) (time.Time, error) {
+	loc := time.UTC
+	if tzid := prop.Params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+			loc = l
+		}
+	}
+	var t time.Time
+	var err error
+	switch v := prop.Value; {
+	case strings.HasSuffix(v, "Z"):
+		t, err = time.Parse(dateTimeFormat, v)
+	case len(v) == len("20060102"):
+		t, err = time.ParseInLocation("20060102", v, time.UTC)
+	default:
+		t, err = time.ParseInLocation("20060102T150405", v, loc)
+	}
+	if err != nil {
+		return t, fmt.Errorf("%w: invalid %s %q", ErrInvalid, prop.Name, prop.Value)
+	}
+	return t.UTC(), nil
+}
+
+// parseDuration 解析 DURATION 值，如 -PT15M、P1D、P1W
+func parseDuration(s string) (time.Duration, error) {
+	invalid := fmt.Errorf("%w: invalid duration %q", ErrInvalid, s)
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign, s = -1, s[1:]
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+	if !strings.HasPrefix(s, "P") || len(s) == 1 {
+		return 0, invalid
+	}
+
+	var d time.Duration
+	num, digits, inTime := 0, false, false
+	for _, r := range s[1:] {
+		if r >= '0' && r <= '9' {
+			num, digits = num*10+int(r-'0'), true
+			continue
+		}
+		if r == 'T' && !inTime && !digits {
+			inTime = true
+			continue
+		}
+		var unit time.Duration
+		switch {
+		case r == 'W' && !inTime:
+			unit = 7 * 24 * time.Hour
+		case r == 'D' && !inTime:
+			unit = 24 * time.Hour
+		case r == 'H' && inTime:
+			unit = time.Hour
+		case r == 'M' && inTime:
+			unit = time.Minute
+		case r == 'S' && inTime:
+			unit = time.Second
+		default:
+			return 0, invalid
+		}
+		if !digits {
+			return 0, invalid
+		}
+		d += time.Duration(num) * unit
+		num, digits = 0, false
+	}
+	if digits {
+		return 0, invalid
+	}
+	return sign * d, nil
+}
+
+// Todo 从VTODO解析出的字段，时间均为UTC
+type Todo struct {
+	UID         string
+	Summary     string
+	Description string
+	Due         *time.Time
+	Priority    int        // iCalendar的 PRIORITY，0表示未定义
+	Completed   bool       // STATUS 为 COMPLETED 或设置了 COMPLETED
+	Categories  []string   // 全部 CATEGORIES 属性中的值
+	RRule       string     // 重复规则，未重复时为空
+	Alarm       *time.Time // 第一个 VALARM 的触发时间
+}
+
+// ParseTodo 解析CalDAV资源中的VTODO。资源中的重复实例覆盖（带 RECURRENCE-ID 的VTODO）被忽略；
+// 不包含VTODO、包含多个VTODO或缺少 UID 时返回 ErrInvalid
+func ParseTodo(data []byte) (*Todo, error) {
+	cal, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if cal.Name != "VCALENDAR" {
+		return nil, fmt.Errorf("%w: top-level component is %s", ErrInvalid, cal.Name)
+	}
+	var vtodo *Component
+	for _, comp := range cal.Components {
+		if comp.Name != ComponentTodo || comp.Prop("RECURRENCE-ID") != nil {
+			continue
+		}
+		if vtodo != nil {
+			return nil, fmt.Errorf("%w: more than one VTODO", ErrInvalid)
+		}
+		vtodo = comp
+	}
+	if vtodo == nil {
+		return nil, fmt.Errorf("%w: no VTODO", ErrInvalid)
+	}
+
+	todo := &Todo{}
+	if p := vtodo.Prop("UID"); p != nil {
+		todo.UID = unescapeText(p.Value)
+	}
+	if todo.UID == "" {
+		return nil, fmt.Errorf("%w: VTODO has no UID", ErrInvalid)
+	}
+	if p := vtodo.Prop("SUMMARY"); p != nil {
+		todo.Summary = unescapeText(p.Value)
+	}
+	if p := vtodo.Prop("DESCRIPTION"); p != nil {
+		todo.Description = unescapeText(p.Value)
+	}
+	if p := vtodo.Prop("DUE"); p != nil {
+		due, err := parseTime(p)
+		if err != nil {
+			return nil, err
+		}
+		todo.Due = &due
+	}
+	if p := vtodo.Prop("PRIORITY"); p != nil {
+		if todo.Priority, err = strconv.Atoi(p.Value); err != nil || todo.Priority < 0 || todo.Priority > 9 {
+			return nil, fmt.Errorf("%w: invalid PRIORITY %q", ErrInvalid, p.Value)
+		}
+	}
+	if p := vtodo.Prop("STATUS"); p != nil && strings.EqualFold(p.Value, "COMPLETED") {
+		todo.Completed = true
+	}
+	if vtodo.Prop("COMPLETED") != nil {
+		todo.Completed = true
+	}
+	for _, p := range vtodo.Properties {
+		if p.Name == "CATEGORIES" {
+			for _, category := range splitText(p.Value) {
+				if category = strings.TrimSpace(category); category != "" {
+					todo.Categories = append(todo.Categories, category)
+				}
+			}
+		}
+	}
+	if p := vtodo.Prop("RRULE"); p != nil {
+		todo.RRule = p.Value
+	}
+	if todo.Alarm, err = parseAlarm(vtodo, todo.Due); err != nil {
+		return nil, err
+	}
+	return todo, nil
+}
+
+// parseAlarm 返回第一个设置了 TRIGGER 的 VALARM 的触发时间。相对触发时间在 RELATED=END 时以 DUE 为基准，
+// 否则以 DTSTART 为基准，未设置 DTSTART 时以 DUE 为基准；没有基准时间时忽略该提醒
+func parseAlarm(vtodo *Component, due *time.Time) (*time.Time, error) {
+	for _, alarm := range vtodo.Components {
+		trigger := alarm.Prop("TRIGGER")
+		if alarm.Name != "VALARM" || trigger == nil {
+			continue
+		}
+		if strings.EqualFold(trigger.Params["VALUE"], "DATE-TIME") {
+			at, err := parseTime(trigger)
+			if err != nil {
+				return nil, err
+			}
+			return &at, nil
+		}
+		offset, err := parseDuration(trigger.Value)
+		if err != nil {
+			return nil, err
+		}
+		base := due
+		if p := vtodo.Prop("DTSTART"); p != nil && !strings.EqualFold(trigger.Params["RELATED"], "END") {
+			start, err := parseTime(p)
+			if err != nil {
+				return nil, err
+			}
+			base = &start
+		}
+		if base == nil {
+			return nil, nil
+		}
+		at := base.Add(offset)
+		return &at, nil
+	}
+	return nil, nil
+}
+
+// TodoPriority 把iCalendar的 PRIORITY 映射为TODO优先级，与 Priority 互逆：1紧急、2-4高、5中、未定义和6-9低
+func TodoPriority(p int) repository.Priority {
+	switch {
+	case p == 1:
+		return repository.PriorityUrgent
+	case p >= 2 && p <= 4:
+		return repository.PriorityHigh
+	case p == 5:
+		return repository.PriorityMedium
+	default:
+		return repository.PriorityLow
+	}
+}
@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config 提醒调度、每日摘要调度、事件Webhook发送和通知渠道配置
+type Config struct {
+	Interval    time.Duration // 扫描到期提醒的间隔
+	Lookback    time.Duration // 只发送提醒时间在此范围内的提醒，服务停机更久时错过的提醒不再补发
+	Lease       time.Duration // 认领租约，实例在租约内没有保存结果时其他实例可以重新认领
+	MaxAttempts int           // 每条投递记录最多尝试的次数
+	RetryDelay  time.Duration // 首次重试的等待时间，之后每次加倍
+	DailyDigest bool          // 是否启动每日摘要调度，用户还可以在设置中单独关闭
+
+	WebhookURL   string // 提醒Webhook地址，为空时不启用
+	WebhookToken string // Webhook Bearer 令牌
+
+	WebhookInterval     time.Duration // 扫描待发送事件Webhook投递记录的间隔
+	WebhookMaxAttempts  int           // 每条事件投递记录最多尝试的次数
+	WebhookFailureLimit int           // 事件Webhook连续失败达到此次数后自动停用
+	WebhookAllowPrivate bool          // 允许事件Webhook发送到本机和内网地址，只用于开发或全部用户可信的内网部署
+	Admins              []string      // 管理员用户名，只有管理员的Webhook可以接收全部用户的事件
+
+	SMTPAddr     string // SMTP服务器地址（host:port），为空时不启用邮件提醒
+	SMTPFrom     string // 发件人地址
+	SMTPUsername string // SMTP用户名，为空时不认证
+	SMTPPassword string // SMTP密码
+
+	APNsURL   string // APNs服务地址
+	APNsTopic string // apns-topic，为空时不启用推送提醒
+	APNsToken string // APNs提供者认证令牌
+}
+
+// GetConfig 从环境变量获取提醒、每日摘要和事件Webhook配置
+func GetConfig() *Config {
+	return &Config{
+		Interval:    time.Duration(getEnvInt("REMINDER_INTERVAL_SECONDS", 30)) * time.Second,
+		Lookback:    time.Duration(getEnvInt("REMINDER_LOOKBACK_MINUTES", 24*60)) * time.Minute,
+		Lease:       time.Duration(getEnvInt("REMINDER_LEASE_SECONDS", 120)) * time.Second,
+		MaxAttempts: getEnvInt("REMINDER_MAX_ATTEMPTS", 5),
+		RetryDelay:  time.Duration(getEnvInt("REMINDER_RETRY_DELAY_SECONDS", 60)) * time.Second,
+		DailyDigest: getEnv("DAILY_DIGEST_ENABLED", "true") == "true",
+
+		WebhookURL:   os.Getenv("REMINDER_WEBHOOK_URL"),
+		WebhookToken: os.Getenv("REMINDER_WEBHOOK_TOKEN"),
+
+		WebhookInterval:     time.Duration(getEnvInt("WEBHOOK_INTERVAL_SECONDS", 5)) * time.Second,
+		WebhookMaxAttempts:  getEnvInt("WEBHOOK_MAX_ATTEMPTS", DefaultWebhookMaxAttempts),
+		WebhookFailureLimit: getEnvInt("WEBHOOK_FAILURE_LIMIT", DefaultWebhookFailureLimit),
+		WebhookAllowPrivate: getEnv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "false") == "true",
+		Admins:              strings.Split(os.Getenv("ADMIN_USERNAMES"), ","),
+
+		SMTPAddr:     os.Getenv("SMTP_ADDR"),
+		SMTPFrom:     getEnv("SMTP_FROM", "todo@localhost"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+
+		APNsURL:   getEnv("APNS_URL", DefaultAPNsURL),
+		APNsTopic: os.Getenv("APNS_TOPIC"),
+		APNsToken: os.Getenv("APNS_AUTH_TOKEN"),
+	}
+}
+
+// Notifiers 返回已配置的通知渠道
+func (c *Config) Notifiers() []Notifier {
+	var notifiers []Notifier
+	if c.WebhookURL != "" {
+		notifiers = append(notifiers, NewWebhookNotifier(c.WebhookURL, c.WebhookToken))
+	}
+	if c.SMTPAddr != "" {
+		notifiers = append(notifiers, NewEmailNotifier(c.SMTPAddr, c.SMTPFrom, c.SMTPUsername, c.SMTPPassword))
+	}
+	if c.APNsTopic != "" {
+		notifiers = append(notifiers, NewPushNotifier(c.APNsURL, c.APNsTopic, c.APNsToken))
+	}
+	return notifiers
+}
+
+// getEnv 获取环境变量，如果不存在则返回默认值
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvInt 获取整型环境变量，如果不存在则返回默认值
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		var intValue int
+		if _, err := fmt.Sscanf(value, "%d", &intValue); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
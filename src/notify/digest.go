@@ -0,0 +1,137 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"todo-service/src/repository"
+)
+
+// maxDigestItems 每日摘要每一部分最多列出的TODO数量，其余只显示数量
+const maxDigestItems = 10
+
+// Digest 一份每日摘要
+type Digest struct {
+	Date     string `json:"date"`     // 摘要日期（用户时区），YYYY-MM-DD
+	Language string `json:"language"` // 用户设置的语言，决定标题和正文使用的语言
+	*repository.DailyDigest
+}
+
+// digestText 每日摘要使用的文字，%d 为数量，%s 为标题、日期或时间
+type digestText struct {
+	title     string // 摘要标题
+	overdue   string // 逾期部分的标题
+	dueToday  string // 今天到期部分的标题
+	urgent    string // 紧急部分的标题
+	completed string // 昨天完成部分的标题
+	item      string // 带时间的条目
+	due       string // 逾期TODO的截止时间
+	more      string // 超出 maxDigestItems 的数量
+}
+
+// digestTexts 按语言保存的每日摘要文字，不支持的语言使用中文
+var digestTexts = map[string]digestText{
+	"zh": {
+		title:     "每日摘要 %s",
+		overdue:   "逾期（%d）",
+		dueToday:  "今天到期（%d）",
+		urgent:    "紧急（%d）",
+		completed: "昨天完成（%d）",
+		item:      "- %s（%s）",
+		due:       "截止 %s",
+		more:      "……另有 %d 项",
+	},
+	"en": {
+		title:     "Daily digest for %s",
+		overdue:   "Overdue (%d)",
+		dueToday:  "Due today (%d)",
+		urgent:    "Urgent (%d)",
+		completed: "Completed yesterday (%d)",
+		item:      "- %s (%s)",
+		due:       "due %s",
+		more:      "…and %d more",
+	},
+}
+
+// text 返回摘要语言对应的文字，en、en-US 等英文设置使用英文，其他语言使用中文
+func (d *Digest) text() digestText {
+	if strings.HasPrefix(strings.ToLower(d.Language), "en") {
+		return digestTexts["en"]
+	}
+	return digestTexts["zh"]
+}
+
+// Message 返回每日摘要的标题和正文，时间按 loc 显示
+func (d *Digest) Message(loc *time.Location) (title, body string) {
+	text := d.text()
+	var sections []string
+	section := func(heading string, todos []repository.Todo, detail func(todo *repository.Todo) string) {
+		if len(todos) == 0 {
+			return
+		}
+		lines := []string{fmt.Sprintf(heading, len(todos))}
+		for i := range todos {
+			if i == maxDigestItems {
+				lines = append(lines, fmt.Sprintf(text.more, len(todos)-maxDigestItems))
+				break
+			}
+			if info := detail(&todos[i]); info != "" {
+				lines = append(lines, fmt.Sprintf(text.item, todos[i].Title, info))
+			} else {
+				lines = append(lines, "- "+todos[i].Title)
+			}
+		}
+		sections = append(sections, strings.Join(lines, "\n"))
+	}
+
+	section(text.overdue, d.Overdue, func(todo *repository.Todo) string {
+		return fmt.Sprintf(text.due, todo.DueDate.In(loc).Format("01-02 15:04"))
+	})
+	section(text.dueToday, d.DueToday, func(todo *repository.Todo) string {
+		return todo.DueDate.In(loc).Format("15:04")
+	})
+	section(text.urgent, d.Urgent, func(*repository.Todo) string { return "" })
+	section(text.completed, d.CompletedYesterday, func(*repository.Todo) string { return "" })
+
+	return fmt.Sprintf(text.title, d.Date), strings.Join(sections, "\n\n")
+}
+
+// localTime 返回 loc 时区中 day 当天 hour:minute 对应的时刻（day 只使用年月日）。
+// 夏令时开始时不存在的时刻顺延跳过的时长（如跳过 02:00-03:00 时 02:30 为 03:30），
+// 夏令时结束时重复出现的时刻取第一次出现的时刻
+func localTime(day time.Time, hour, minute int, loc *time.Location) time.Time {
+	year, month, date := day.Date()
+	wall := time.Date(year, month, date, hour, minute, 0, 0, time.UTC)
+	approx := time.Date(year, month, date, hour, minute, 0, 0, loc)
+	_, before := approx.Add(-12 * time.Hour).Zone()
+	_, after := approx.Add(12 * time.Hour).Zone()
+
+	// 分别按切换前后的UTC偏移解释墙上时间，两者都有效时是重复的时刻
+	first := wall.Add(-time.Duration(max(before, after)) * time.Second)
+	second := wall.Add(-time.Duration(min(before, after)) * time.Second)
+	matches := func(t time.Time) bool {
+		local := t.In(loc)
+		y, m, d := local.Date()
+		return y == year && m == month && d == date && local.Hour() == hour && local.Minute() == minute
+	}
+	switch {
+	case matches(first):
+		return first
+	case matches(second):
+		return second
+	default:
+		// 不存在的时刻：按切换前的偏移解释，得到顺延后的时刻
+		return wall.Add(-time.Duration(before) * time.Second)
+	}
+}
+
+// parseClock 解析 HH:MM 或 HH:MM:SS 格式的通知时间
+func parseClock(value string) (hour, minute int, ok bool) {
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Hour(), t.Minute(), true
+		}
+	}
+	return 0, 0, false
+}
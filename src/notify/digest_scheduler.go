@@ -0,0 +1,169 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"todo-service/src/repository"
+)
+
+// 每日摘要调度流程：
+//  1. 对每个开启每日摘要的用户，按用户时区计算当天的日期和通知时间；通知时间已到、
+//     当天尚未生成投递记录时为每个通知渠道生成一条待发送记录，按 (用户, 日期, 渠道) 唯一。
+//     服务停机错过通知时间时，当天恢复后仍会发送，之前的日期不再补发。
+//  2. 认领、重试和保存结果的规则与提醒调度相同。
+//  3. 发送前重新读取用户设置和摘要内容，用户已关闭每日摘要或摘要为空时取消投递。
+
+// DigestScheduler 在每个用户设置的通知时间（按用户时区）发送当天的每日摘要，多个服务实例可以同时运行
+type DigestScheduler struct {
+	dispatcher
+	store    repository.Store
+	interval time.Duration
+}
+
+// NewDigestScheduler 创建每日摘要调度任务，与提醒调度使用相同的通知渠道和重试设置
+func NewDigestScheduler(store repository.Store, notifiers []Notifier, config *Config) *DigestScheduler {
+	s := &DigestScheduler{
+		dispatcher: newDispatcher(notifiers, config),
+		store:      store,
+		interval:   config.Interval,
+	}
+	if s.interval <= 0 {
+		s.interval = DefaultInterval
+	}
+	return s
+}
+
+// Dispatch 执行一次调度：为通知时间已到的用户生成当天的投递记录，并发送所有可以认领的投递记录，返回处理的投递记录数量
+func (s *DigestScheduler) Dispatch(ctx context.Context) (int, error) {
+	now := s.now()
+	if err := s.enqueue(now); err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for ctx.Err() == nil {
+		deliveries, err := s.store.ClaimDigestDeliveries(s.owner, now, s.now().Add(s.lease), 1)
+		if err != nil {
+			return processed, err
+		}
+		if len(deliveries) == 0 {
+			return processed, nil
+		}
+		s.deliver(ctx, &deliveries[0])
+		processed++
+	}
+	return processed, ctx.Err()
+}
+
+// enqueue 为当天通知时间已到、尚未生成投递记录的用户在每个渠道生成投递记录，已存在的记录被忽略
+func (s *DigestScheduler) enqueue(now time.Time) error {
+	if len(s.channels) == 0 {
+		return nil
+	}
+	subscribers, err := s.store.GetDigestSubscribers()
+	if err != nil {
+		return err
+	}
+	for _, subscriber := range subscribers {
+		loc := subscriber.Location()
+		date := now.In(loc).Format(time.DateOnly)
+		if subscriber.LastDigestDate >= date || now.Before(digestTime(now.In(loc), subscriber.NotificationTime, loc)) {
+			continue
+		}
+		for _, channel := range s.channels {
+			delivery := &repository.DigestDelivery{
+				UserID:        subscriber.UserID,
+				DigestDate:    date,
+				Channel:       channel,
+				NextAttemptAt: now,
+			}
+			err := s.store.CreateDigestDelivery(delivery)
+			if err != nil && !errors.Is(err, repository.ErrDuplicate) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// digestTime 返回 day 当天用户通知时间对应的时刻，通知时间无法识别时使用 09:00
+func digestTime(day time.Time, notificationTime string, loc *time.Location) time.Time {
+	hour, minute, ok := parseClock(notificationTime)
+	if !ok {
+		hour, minute = 9, 0
+	}
+	return localTime(day, hour, minute, loc)
+}
+
+// deliver 发送已认领的投递记录并保存结果
+func (s *DigestScheduler) deliver(ctx context.Context, delivery *repository.DigestDelivery) {
+	err := s.send(ctx, delivery)
+	now := s.now()
+	delivery.LastError = ""
+	if err != nil {
+		delivery.LastError = err.Error()
+	}
+
+	var retryAt time.Time
+	delivery.Status, retryAt = s.outcome(err, delivery.Attempts, now)
+	switch delivery.Status {
+	case repository.DeliverySent:
+		delivery.SentAt = &now
+	case repository.DeliveryPending:
+		delivery.NextAttemptAt = retryAt
+	}
+
+	if err := s.store.FinishDigestDelivery(delivery); err != nil {
+		log.Printf("digest scheduler: failed to save delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// send 重新读取用户设置和摘要内容，然后通过对应渠道发送
+func (s *DigestScheduler) send(ctx context.Context, delivery *repository.DigestDelivery) error {
+	notifier, ok := s.notifiers[delivery.Channel]
+	if !ok {
+		return fmt.Errorf("digest %w: channel %s is not configured", errCancelled, delivery.Channel)
+	}
+
+	settings, err := s.store.GetUserSettings(delivery.UserID)
+	if err != nil {
+		return err
+	}
+	if !settings.DailyDigest {
+		return fmt.Errorf("digest %w: daily digest was disabled", errCancelled)
+	}
+	day, err := time.Parse(time.DateOnly, delivery.DigestDate)
+	if err != nil {
+		return fmt.Errorf("digest %w: invalid digest date %q", errCancelled, delivery.DigestDate)
+	}
+
+	// 当天和前一天的范围按用户时区计算，夏令时切换的日期不是24小时
+	loc := settings.Location()
+	dayStart := localTime(day, 0, 0, loc)
+	dayEnd := localTime(day.AddDate(0, 0, 1), 0, 0, loc)
+	yesterdayStart := localTime(day.AddDate(0, 0, -1), 0, 0, loc)
+	digest, err := s.store.GetDailyDigest(delivery.UserID, s.now(), dayStart, dayEnd, yesterdayStart)
+	if err != nil {
+		return err
+	}
+	if digest.IsEmpty() {
+		return fmt.Errorf("digest %w: nothing to report", errCancelled)
+	}
+
+	n, err := s.recipient(s.store, delivery.UserID)
+	if err != nil {
+		return err
+	}
+	n.DeliveryID = delivery.ID
+	n.Digest = &Digest{Date: delivery.DigestDate, Language: settings.Language, DailyDigest: digest}
+	return notifier.Notify(ctx, n)
+}
+
+// Run 立即调度一次，之后按间隔定期调度，直到 ctx 取消
+func (s *DigestScheduler) Run(ctx context.Context) {
+	run(ctx, "digest scheduler", s.interval, s.Dispatch)
+}
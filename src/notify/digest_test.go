@@ -0,0 +1,188 @@
+package notify
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"todo-service/src/repository"
+)
+
+func TestLocalTime(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("LoadLocation() error = %v", err)
+	}
+	tests := []struct {
+		name         string
+		day          time.Time
+		hour, minute int
+		want         time.Time
+	}{
+		{"standard time", time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC), 8, 0, time.Date(2026, 1, 15, 13, 0, 0, 0, time.UTC)},
+		{"daylight time", time.Date(2026, 7, 15, 0, 0, 0, 0, time.UTC), 8, 0, time.Date(2026, 7, 15, 12, 0, 0, 0, time.UTC)},
+		// 2026-03-08 02:00 跳到 03:00，02:30 不存在，顺延为 03:30 EDT
+		{"skipped by spring forward", time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC), 2, 30, time.Date(2026, 3, 8, 7, 30, 0, 0, time.UTC)},
+		{"after spring forward", time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC), 8, 0, time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)},
+		// 2026-11-01 02:00 回拨到 01:00，01:30 出现两次，取第一次（EDT）
+		{"repeated by fall back", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), 1, 30, time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC)},
+		{"after fall back", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), 8, 0, time.Date(2026, 11, 1, 13, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := localTime(tt.day, tt.hour, tt.minute, newYork); !got.Equal(tt.want) {
+			t.Errorf("%s: localTime() = %v, want %v", tt.name, got.UTC(), tt.want)
+		}
+	}
+
+	// 夏令时切换的日期不是24小时
+	day := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+	if length := localTime(day.AddDate(0, 0, 1), 0, 0, newYork).Sub(localTime(day, 0, 0, newYork)); length != 23*time.Hour {
+		t.Errorf("length of 2026-03-08 = %v, want 23h", length)
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	for value, want := range map[string][2]int{"09:00": {9, 0}, "07:30:00": {7, 30}, "23:59": {23, 59}} {
+		if hour, minute, ok := parseClock(value); !ok || hour != want[0] || minute != want[1] {
+			t.Errorf("parseClock(%q) = %d, %d, %v", value, hour, minute, ok)
+		}
+	}
+	if _, _, ok := parseClock("9am"); ok {
+		t.Error("parseClock(9am) ok = true")
+	}
+}
+
+func TestDigestMessage(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	lastWeek := time.Date(2026, 10, 9, 10, 0, 0, 0, time.UTC)
+	evening := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	digest := &Digest{
+		Date:     "2026-10-16",
+		Language: "zh-CN",
+		DailyDigest: &repository.DailyDigest{
+			Overdue:            []repository.Todo{{Title: "周报", DueDate: &lastWeek}},
+			DueToday:           []repository.Todo{{Title: "交水费", DueDate: &evening}},
+			CompletedYesterday: []repository.Todo{{Title: "买牛奶"}},
+		},
+	}
+
+	title, body := digest.Message(shanghai)
+	want := "逾期（1）\n- 周报（截止 10-09 18:00）\n\n今天到期（1）\n- 交水费（18:00）\n\n昨天完成（1）\n- 买牛奶"
+	if title != "每日摘要 2026-10-16" || body != want {
+		t.Errorf("Message(zh) = %q, %q", title, body)
+	}
+
+	digest.Language = "en-US"
+	for i := 0; i < maxDigestItems+2; i++ {
+		digest.Urgent = append(digest.Urgent, repository.Todo{Title: "Task"})
+	}
+	title, body = digest.Message(shanghai)
+	if title != "Daily digest for 2026-10-16" || !strings.HasPrefix(body, "Overdue (1)\n- 周报 (due 10-09 18:00)") ||
+		!strings.Contains(body, "Urgent (12)") || !strings.HasSuffix(body, "…and 2 more\n\nCompleted yesterday (1)\n- 买牛奶") {
+		t.Errorf("Message(en) = %q, %q", title, body)
+	}
+}
+
+func TestDigestSchedulerDispatch(t *testing.T) {
+	store := repository.NewMemoryStore()
+	userID := newSchedulerStore(t, store)
+	settings, err := store.GetUserSettings(userID)
+	if err != nil {
+		t.Fatalf("GetUserSettings() error = %v", err)
+	}
+	settings.NotificationTime = "02:30"
+	settings.TimeZone = "America/New_York"
+	settings.Language = "en"
+	if err := store.UpdateUserSettings(settings); err != nil {
+		t.Fatalf("UpdateUserSettings() error = %v", err)
+	}
+	urgent := &repository.Todo{UserID: userID, Title: "File taxes", Priority: repository.PriorityUrgent}
+	if err := store.CreateTodoExtended(urgent); err != nil {
+		t.Fatalf("CreateTodoExtended() error = %v", err)
+	}
+
+	email := &fakeNotifier{channel: ChannelEmail}
+	scheduler := NewDigestScheduler(store, []Notifier{email}, &Config{})
+	dispatch := func(clock time.Time) int {
+		t.Helper()
+		scheduler.now = func() time.Time { return clock }
+		processed, err := scheduler.Dispatch(context.Background())
+		if err != nil {
+			t.Fatalf("Dispatch(%v) error = %v", clock, err)
+		}
+		return processed
+	}
+
+	// 夏令时开始当天 02:30 不存在，03:30 EDT（07:30 UTC）发送
+	if processed := dispatch(time.Date(2026, 3, 8, 7, 29, 0, 0, time.UTC)); processed != 0 {
+		t.Errorf("Dispatch(before notification time) = %d, want 0", processed)
+	}
+	if processed := dispatch(time.Date(2026, 3, 8, 7, 30, 0, 0, time.UTC)); processed != 1 {
+		t.Fatalf("Dispatch(at notification time) = %d, want 1", processed)
+	}
+	if len(email.digests) != 1 || email.digests[0].Date != "2026-03-08" || len(email.digests[0].Urgent) != 1 {
+		t.Fatalf("digests = %+v", email.digests)
+	}
+	if processed := dispatch(time.Date(2026, 3, 8, 23, 0, 0, 0, time.UTC)); processed != 0 {
+		t.Errorf("Dispatch(later the same day) = %d, want 0", processed)
+	}
+
+	// 夏令时结束当天 01:30 出现两次，只在第一次发送
+	settings.NotificationTime = "01:30"
+	if err := store.UpdateUserSettings(settings); err != nil {
+		t.Fatalf("UpdateUserSettings() error = %v", err)
+	}
+	if processed := dispatch(time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC)); processed != 1 {
+		t.Fatalf("Dispatch(first 01:30) = %d, want 1", processed)
+	}
+	if processed := dispatch(time.Date(2026, 11, 1, 6, 30, 0, 0, time.UTC)); processed != 0 {
+		t.Errorf("Dispatch(second 01:30) = %d, want 0", processed)
+	}
+	if len(email.digests) != 2 || email.digests[1].Date != "2026-11-01" {
+		t.Errorf("digests = %+v", email.digests)
+	}
+
+	// 关闭每日摘要后不再发送；已生成的投递记录在发送前取消
+	settings.DailyDigest = false
+	if err := store.UpdateUserSettings(settings); err != nil {
+		t.Fatalf("UpdateUserSettings() error = %v", err)
+	}
+	if processed := dispatch(time.Date(2026, 11, 2, 12, 0, 0, 0, time.UTC)); processed != 0 {
+		t.Errorf("Dispatch(opted out) = %d, want 0", processed)
+	}
+	pending := &repository.DigestDelivery{UserID: userID, DigestDate: "2026-11-03", Channel: ChannelEmail, NextAttemptAt: time.Date(2026, 11, 3, 12, 0, 0, 0, time.UTC)}
+	if err := store.CreateDigestDelivery(pending); err != nil {
+		t.Fatalf("CreateDigestDelivery() error = %v", err)
+	}
+	dispatch(time.Date(2026, 11, 3, 12, 0, 0, 0, time.UTC))
+	deliveries, err := store.GetDigestDeliveries(userID)
+	if err != nil || len(deliveries) != 3 || deliveries[0].Status != repository.DeliveryCancelled ||
+		deliveries[0].LastError != "digest cancelled: daily digest was disabled" {
+		t.Errorf("deliveries = %+v, %v", deliveries, err)
+	}
+	if len(email.digests) != 2 {
+		t.Errorf("digest sent after opt-out: %+v", email.digests)
+	}
+}
+
+func TestDigestSchedulerEmptyDigest(t *testing.T) {
+	store := repository.NewMemoryStore()
+	userID := newSchedulerStore(t, store)
+
+	email := &fakeNotifier{channel: ChannelEmail}
+	scheduler := NewDigestScheduler(store, []Notifier{email}, &Config{})
+	// 默认设置：Asia/Shanghai 09:00
+	scheduler.now = func() time.Time { return time.Date(2026, 10, 16, 1, 0, 0, 0, time.UTC) }
+	if processed, err := scheduler.Dispatch(context.Background()); err != nil || processed != 1 {
+		t.Fatalf("Dispatch() = %d, %v; want 1", processed, err)
+	}
+	deliveries, err := store.GetDigestDeliveries(userID)
+	if err != nil || len(deliveries) != 1 || deliveries[0].DigestDate != "2026-10-16" ||
+		deliveries[0].Status != repository.DeliveryCancelled || deliveries[0].LastError != "digest cancelled: nothing to report" {
+		t.Errorf("deliveries = %+v, %v", deliveries, err)
+	}
+	if len(email.digests) != 0 {
+		t.Errorf("empty digest sent: %+v", email.digests)
+	}
+}
@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// EmailNotifier 通过SMTP把提醒和每日摘要发送到用户注册时填写的邮箱
+type EmailNotifier struct {
+	Addr string    // SMTP服务器地址（host:port）
+	From string    // 发件人地址
+	Auth smtp.Auth // 为 nil 时不认证
+}
+
+// NewEmailNotifier 创建邮件通知渠道，username 为空时不认证
+func NewEmailNotifier(addr, from, username, password string) *EmailNotifier {
+	notifier := &EmailNotifier{Addr: addr, From: from}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		notifier.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return notifier
+}
+
+// Channel 实现 Notifier 接口
+func (e *EmailNotifier) Channel() string {
+	return ChannelEmail
+}
+
+// Notify 实现 Notifier 接口。net/smtp 不支持 context，ctx 只在发送前检查
+func (e *EmailNotifier) Notify(ctx context.Context, n *Notification) error {
+	if n.User.Email == "" {
+		return ErrNoRecipient
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(e.Addr, e.Auth, e.From, []string{n.User.Email}, e.message(n))
+}
+
+// message 生成邮件内容，标题按RFC 2047编码，正文使用base64编码的UTF-8纯文本；
+// Message-ID 由投递记录ID生成，重试时保持不变
+func (e *EmailNotifier) message(n *Notification) []byte {
+	title, body := n.Message()
+	subject := title
+	if n.Digest == nil {
+		subject = "提醒：" + title
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", n.User.Email)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@todo-service>\r\n", n.ref())
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		msg.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	msg.WriteString(encoded + "\r\n")
+	return msg.Bytes()
+}
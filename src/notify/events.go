@@ -0,0 +1,252 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"todo-service/src/repository"
+)
+
+// 事件Webhook发送流程：
+//  1. 写入TODO、分类和用户设置时，存储层在同一事务中为订阅了该事件的Webhook生成投递记录。
+//  2. 认领和重试规则与提醒调度相同；发送前重新读取Webhook，已删除、已停用或不再订阅该事件时取消投递；
+//     接收全部用户事件的Webhook的所有者不再是管理员时，其他用户的事件也取消投递。
+//  3. 每次发送失败时Webhook的连续失败次数加一，达到上限后自动停用，之后的投递记录被取消；发送成功时清零。
+//  4. 默认只连接公网地址，登记时拒绝localhost和内网IP，发送时检查域名解析出的地址，避免用户借Webhook访问内网服务。
+
+// 事件Webhook的请求头
+const (
+	EventHeader     = "X-Webhook-Event"     // 事件类型
+	DeliveryHeader  = "X-Webhook-Delivery"  // 投递记录ID，重试时不变，重放时为新的ID
+	SignatureHeader = "X-Webhook-Signature" // t=<Unix时间戳>,v1=<HMAC-SHA256签名>
+)
+
+// 事件Webhook未配置时的默认值
+const (
+	DefaultWebhookInterval     = 5 * time.Second
+	DefaultWebhookMaxAttempts  = 8
+	DefaultWebhookFailureLimit = 20
+)
+
+// Sign 计算事件Webhook的签名：以Webhook密钥对 "<timestamp>.<请求体>" 做HMAC-SHA256，结果为十六进制
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ErrPrivateAddress 事件Webhook地址指向本机、内网或链路本地地址
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+// sharedAddressSpace 运营商级NAT地址（RFC 6598），同样不能从公网访问
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// PublicAddr 是否为可以发送事件Webhook的公网地址，排除回环、内网、链路本地（包括云服务元数据地址169.254.169.254）、组播和未指定地址
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// PrivateHost 主机名是否为localhost或非公网IP地址；其他域名在发送时按解析出的地址检查
+func PrivateHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return !PublicAddr(addr)
+	}
+	return false
+}
+
+// publicTransport 只连接公网地址的Transport：在DNS解析之后检查实际连接的地址，DNS重绑定无法绕过；
+// 不使用环境变量中的代理，否则检查的是代理的地址
+func publicTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !PublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, address)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// EventDispatcher 把TODO、分类和用户设置的变更事件发送到用户登记的Webhook，多个服务实例可以同时运行
+type EventDispatcher struct {
+	dispatcher
+	store        repository.Store
+	client       *http.Client
+	interval     time.Duration
+	failureLimit int
+	admins       map[string]bool // 管理员用户名
+}
+
+// NewEventDispatcher 创建事件Webhook发送任务，认领租约和首次重试等待时间与提醒调度相同
+func NewEventDispatcher(store repository.Store, config *Config) *EventDispatcher {
+	d := &EventDispatcher{
+		dispatcher: newDispatcher(nil, config),
+		store:      store,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			// 重定向视为失败，避免把签名后的请求转发到其他地址
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		interval:     config.WebhookInterval,
+		failureLimit: config.WebhookFailureLimit,
+		admins:       make(map[string]bool),
+	}
+	for _, username := range config.Admins {
+		if username = strings.TrimSpace(username); username != "" {
+			d.admins[username] = true
+		}
+	}
+	if !config.WebhookAllowPrivate {
+		d.client.Transport = publicTransport()
+	}
+	d.maxAttempts = config.WebhookMaxAttempts
+	if d.maxAttempts <= 0 {
+		d.maxAttempts = DefaultWebhookMaxAttempts
+	}
+	if d.interval <= 0 {
+		d.interval = DefaultWebhookInterval
+	}
+	if d.failureLimit <= 0 {
+		d.failureLimit = DefaultWebhookFailureLimit
+	}
+	return d
+}
+
+// Dispatch 发送所有可以认领的投递记录，返回处理的投递记录数量
+func (d *EventDispatcher) Dispatch(ctx context.Context) (int, error) {
+	now := d.now()
+	processed := 0
+	for ctx.Err() == nil {
+		deliveries, err := d.store.ClaimWebhookDeliveries(d.owner, now, d.now().Add(d.lease), 1)
+		if err != nil {
+			return processed, err
+		}
+		if len(deliveries) == 0 {
+			return processed, nil
+		}
+		d.deliver(ctx, &deliveries[0])
+		processed++
+	}
+	return processed, ctx.Err()
+}
+
+// deliver 发送已认领的投递记录，保存结果并更新Webhook的连续失败次数
+func (d *EventDispatcher) deliver(ctx context.Context, delivery *repository.WebhookDelivery) {
+	err := d.send(ctx, delivery)
+	now := d.now()
+	delivery.LastError = ""
+	if err != nil {
+		delivery.LastError = err.Error()
+	}
+
+	var retryAt time.Time
+	delivery.Status, retryAt = d.outcome(err, delivery.Attempts, now)
+	switch delivery.Status {
+	case repository.DeliverySent:
+		delivery.SentAt = &now
+	case repository.DeliveryPending:
+		delivery.NextAttemptAt = retryAt
+	}
+
+	if err := d.store.FinishWebhookDelivery(delivery); err != nil {
+		log.Printf("webhook dispatcher: failed to save delivery %d: %v", delivery.ID, err)
+	}
+	if errors.Is(err, errCancelled) {
+		return
+	}
+	disabled, recordErr := d.store.RecordWebhookResult(delivery.EndpointID, delivery.LastError, d.failureLimit)
+	if recordErr != nil {
+		log.Printf("webhook dispatcher: failed to record result of webhook %d: %v", delivery.EndpointID, recordErr)
+	} else if disabled {
+		log.Printf("webhook dispatcher: disabled webhook %d after %d consecutive failures", delivery.EndpointID, d.failureLimit)
+	}
+}
+
+// send 重新读取Webhook确认仍需发送，然后以签名的JSON POST请求发送事件，2xx响应视为成功
+func (d *EventDispatcher) send(ctx context.Context, delivery *repository.WebhookDelivery) error {
+	endpoint, err := d.store.GetWebhookEndpoint(delivery.EndpointID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("webhook %w: endpoint was deleted", errCancelled)
+	}
+	if err != nil {
+		return err
+	}
+	if !endpoint.Enabled {
+		return fmt.Errorf("webhook %w: endpoint was disabled", errCancelled)
+	}
+	if !endpoint.Subscribes(delivery.EventType) {
+		return fmt.Errorf("webhook %w: endpoint no longer subscribes to %s", errCancelled, delivery.EventType)
+	}
+
+	event, err := d.store.GetWebhookEvent(delivery.EventID)
+	if err != nil {
+		return err
+	}
+	if endpoint.AllUsers && event.UserID != endpoint.UserID {
+		owner, err := d.store.GetUserByID(endpoint.UserID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		if owner == nil || !d.admins[owner.Username] {
+			return fmt.Errorf("webhook %w: endpoint owner is no longer an admin", errCancelled)
+		}
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event.Type)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.ID))
+	req.Header.Set(SignatureHeader, fmt.Sprintf("t=%d,v1=%s", timestamp, Sign(endpoint.Secret, timestamp, body)))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Run 立即发送一次，之后按间隔定期发送，直到 ctx 取消
+func (d *EventDispatcher) Run(ctx context.Context) {
+	run(ctx, "webhook dispatcher", d.interval, d.Dispatch)
+}
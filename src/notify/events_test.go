@@ -0,0 +1,339 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"todo-service/src/repository"
+)
+
+// webhookReceiver 记录收到的事件并校验签名，status 决定响应状态码
+type webhookReceiver struct {
+	t      *testing.T
+	secret string
+
+	mu       sync.Mutex
+	status   int
+	events   []repository.WebhookEvent
+	requests int
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	var timestamp int64
+	var signature string
+	if _, err := fmt.Sscanf(req.Header.Get(SignatureHeader), "t=%d,v1=%s", &timestamp, &signature); err != nil ||
+		signature != Sign(r.secret, timestamp, body) {
+		r.t.Errorf("invalid signature %q", req.Header.Get(SignatureHeader))
+	}
+	var event repository.WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		r.t.Errorf("invalid body %s: %v", body, err)
+	}
+	if req.Header.Get(EventHeader) != event.Type || req.Header.Get(DeliveryHeader) == "" {
+		r.t.Errorf("headers = %v, event = %q", req.Header, event.Type)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+	if r.status != 0 {
+		w.WriteHeader(r.status)
+		return
+	}
+	r.events = append(r.events, event)
+}
+
+func (r *webhookReceiver) setStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func createWebhook(t *testing.T, store repository.Store, userID int, url string, events ...string) *repository.WebhookEndpoint {
+	t.Helper()
+	endpoint := &repository.WebhookEndpoint{UserID: userID, URL: url, Secret: "whsec_test", Events: events, Enabled: true}
+	if err := store.CreateWebhookEndpoint(endpoint); err != nil {
+		t.Fatalf("CreateWebhookEndpoint() error = %v", err)
+	}
+	return endpoint
+}
+
+func TestEventDispatcherDispatch(t *testing.T) {
+	store := repository.NewMemoryStore()
+	userID := newSchedulerStore(t, store)
+	receiver := &webhookReceiver{t: t, secret: "whsec_test"}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	endpoint := createWebhook(t, store, userID, server.URL, "todo.*")
+
+	todo := &repository.Todo{UserID: userID, Title: "周报"}
+	if err := store.CreateTodoExtended(todo); err != nil {
+		t.Fatalf("CreateTodoExtended() error = %v", err)
+	}
+	todo.Completed = true
+	if err := store.UpdateTodoExtended(todo); err != nil {
+		t.Fatalf("UpdateTodoExtended() error = %v", err)
+	}
+
+	dispatcher := NewEventDispatcher(store, &Config{WebhookAllowPrivate: true})
+	now := time.Now().Add(time.Second)
+	dispatcher.now = func() time.Time { return now }
+	if processed, err := dispatcher.Dispatch(context.Background()); err != nil || processed != 2 {
+		t.Fatalf("Dispatch() = %d, %v; want 2", processed, err)
+	}
+	if len(receiver.events) != 2 || receiver.events[0].Type != repository.WebhookTodoCreated ||
+		receiver.events[1].Type != repository.WebhookTodoCompleted || receiver.events[1].EntityUUID != todo.UUID {
+		t.Fatalf("received = %+v", receiver.events)
+	}
+
+	deliveries, err := store.GetWebhookDeliveries(endpoint.ID, -1)
+	if err != nil || len(deliveries) != 2 {
+		t.Fatalf("GetWebhookDeliveries() = %+v, %v", deliveries, err)
+	}
+	for _, delivery := range deliveries {
+		if delivery.Status != repository.DeliverySent || delivery.SentAt == nil || delivery.Attempts != 1 {
+			t.Errorf("delivery = %+v", delivery)
+		}
+	}
+
+	// 重放的投递记录再次发送同一事件
+	replay, err := store.ReplayWebhookDelivery(endpoint.ID, deliveries[0].ID)
+	if err != nil {
+		t.Fatalf("ReplayWebhookDelivery() error = %v", err)
+	}
+	now = now.Add(time.Second)
+	if processed, err := dispatcher.Dispatch(context.Background()); err != nil || processed != 1 {
+		t.Fatalf("Dispatch(replay) = %d, %v; want 1", processed, err)
+	}
+	if len(receiver.events) != 3 || receiver.events[2].ID != receiver.events[1].ID {
+		t.Errorf("replayed = %+v", receiver.events)
+	}
+	if deliveries, _ := store.GetWebhookDeliveries(endpoint.ID, 1); deliveries[0].ID != replay.ID || deliveries[0].Status != repository.DeliverySent {
+		t.Errorf("replay delivery = %+v", deliveries[0])
+	}
+}
+
+func TestEventDispatcherRetryAndDisable(t *testing.T) {
+	store := repository.NewMemoryStore()
+	userID := newSchedulerStore(t, store)
+	receiver := &webhookReceiver{t: t, secret: "whsec_test", status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	endpoint := createWebhook(t, store, userID, server.URL)
+
+	for _, title := range []string{"周报", "计划"} {
+		if err := store.CreateTodoExtended(&repository.Todo{UserID: userID, Title: title}); err != nil {
+			t.Fatalf("CreateTodoExtended() error = %v", err)
+		}
+	}
+
+	dispatcher := NewEventDispatcher(store, &Config{RetryDelay: time.Minute, WebhookMaxAttempts: 2, WebhookFailureLimit: 3, WebhookAllowPrivate: true})
+	start := time.Now().Add(time.Second)
+	clock := start
+	dispatcher.now = func() time.Time { return clock }
+
+	if processed, err := dispatcher.Dispatch(context.Background()); err != nil || processed != 2 {
+		t.Fatalf("Dispatch() = %d, %v; want 2", processed, err)
+	}
+	deliveries, _ := store.GetWebhookDeliveries(endpoint.ID, -1)
+	for _, delivery := range deliveries {
+		if delivery.Status != repository.DeliveryPending || delivery.LastError != "webhook returned status 503" ||
+			!delivery.NextAttemptAt.Equal(start.Add(time.Minute)) {
+			t.Fatalf("delivery after failure = %+v", delivery)
+		}
+	}
+
+	// 未到重试时间不发送
+	clock = start.Add(30 * time.Second)
+	if processed, err := dispatcher.Dispatch(context.Background()); err != nil || processed != 0 {
+		t.Errorf("Dispatch(before retry) = %d, %v; want 0", processed, err)
+	}
+
+	// 第三次失败时停用Webhook：新事件按发送时间先发送并失败，随后到期重试的两条投递记录被取消
+	if err := store.CreateTodoExtended(&repository.Todo{UserID: userID, Title: "买牛奶"}); err != nil {
+		t.Fatalf("CreateTodoExtended() error = %v", err)
+	}
+	clock = start.Add(time.Minute)
+	if processed, err := dispatcher.Dispatch(context.Background()); err != nil || processed != 3 {
+		t.Fatalf("Dispatch(retry) = %d, %v; want 3", processed, err)
+	}
+	if receiver.requests != 3 {
+		t.Errorf("requests = %d, want 3", receiver.requests)
+	}
+	stopped, err := store.GetWebhookEndpoint(endpoint.ID)
+	if err != nil || stopped.Enabled || stopped.ConsecutiveFailures != 3 || stopped.DisabledReason != "webhook returned status 503" {
+		t.Fatalf("endpoint = %+v, %v", stopped, err)
+	}
+	deliveries, _ = store.GetWebhookDeliveries(endpoint.ID, -1)
+	statuses := make(map[string]int)
+	for _, delivery := range deliveries {
+		statuses[delivery.Status]++
+	}
+	if statuses[repository.DeliveryPending] != 1 || statuses[repository.DeliveryCancelled] != 2 {
+		t.Fatalf("statuses = %v, want 1 pending and 2 cancelled", statuses)
+	}
+
+	// 重新启用后清零连续失败次数，等待重试的记录在重试时间发送，被取消的记录可以重放
+	receiver.setStatus(0)
+	stopped.Enabled = true
+	if err := store.UpdateWebhookEndpoint(stopped); err != nil {
+		t.Fatalf("UpdateWebhookEndpoint() error = %v", err)
+	}
+	if _, err := store.ReplayWebhookDelivery(endpoint.ID, deliveries[len(deliveries)-1].ID); err != nil {
+		t.Fatalf("ReplayWebhookDelivery() error = %v", err)
+	}
+	clock = start.Add(2 * time.Minute)
+	if processed, err := dispatcher.Dispatch(context.Background()); err != nil || processed != 2 || len(receiver.events) != 2 {
+		t.Errorf("Dispatch(enabled) = %d, %v; received %d", processed, err, len(receiver.events))
+	}
+	if enabled, _ := store.GetWebhookEndpoint(endpoint.ID); !enabled.Enabled || enabled.ConsecutiveFailures != 0 {
+		t.Errorf("endpoint after success = %+v", enabled)
+	}
+
+	// 重试次数用尽后标记为失败
+	receiver.setStatus(http.StatusInternalServerError)
+	if err := store.CreateTodoExtended(&repository.Todo{UserID: userID, Title: "健身"}); err != nil {
+		t.Fatalf("CreateTodoExtended() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		clock = clock.Add(time.Hour)
+		if _, err := dispatcher.Dispatch(context.Background()); err != nil {
+			t.Fatalf("Dispatch(%d) error = %v", i, err)
+		}
+	}
+	if deliveries, _ := store.GetWebhookDeliveries(endpoint.ID, 1); deliveries[0].Status != repository.DeliveryFailed || deliveries[0].Attempts != 2 {
+		t.Errorf("delivery after max attempts = %+v", deliveries[0])
+	}
+}
+
+func TestEventDispatcherCancelled(t *testing.T) {
+	store := repository.NewMemoryStore()
+	userID := newSchedulerStore(t, store)
+	receiver := &webhookReceiver{t: t, secret: "whsec_test"}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	endpoint := createWebhook(t, store, userID, server.URL)
+
+	if err := store.CreateTodoExtended(&repository.Todo{UserID: userID, Title: "周报"}); err != nil {
+		t.Fatalf("CreateTodoExtended() error = %v", err)
+	}
+	// 事件生成后取消订阅，投递记录不再发送，也不计入连续失败
+	endpoint.Events = repository.StringSlice{repository.WebhookSettingsUpdated}
+	if err := store.UpdateWebhookEndpoint(endpoint); err != nil {
+		t.Fatalf("UpdateWebhookEndpoint() error = %v", err)
+	}
+
+	dispatcher := NewEventDispatcher(store, &Config{WebhookAllowPrivate: true})
+	now := time.Now().Add(time.Second)
+	dispatcher.now = func() time.Time { return now }
+	if processed, err := dispatcher.Dispatch(context.Background()); err != nil || processed != 1 {
+		t.Fatalf("Dispatch() = %d, %v; want 1", processed, err)
+	}
+	if receiver.requests != 0 {
+		t.Errorf("requests = %d, want 0", receiver.requests)
+	}
+	deliveries, _ := store.GetWebhookDeliveries(endpoint.ID, -1)
+	if len(deliveries) != 1 || deliveries[0].Status != repository.DeliveryCancelled ||
+		deliveries[0].LastError != "webhook cancelled: endpoint no longer subscribes to todo.created" {
+		t.Errorf("deliveries = %+v", deliveries)
+	}
+	if endpoint, _ := store.GetWebhookEndpoint(endpoint.ID); endpoint.ConsecutiveFailures != 0 {
+		t.Errorf("consecutive failures = %d, want 0", endpoint.ConsecutiveFailures)
+	}
+}
+
+func TestEventDispatcherAllUsersRequiresAdmin(t *testing.T) {
+	store := repository.NewMemoryStore()
+	userID := newSchedulerStore(t, store)
+	admin := &repository.User{Username: "root", Email: "root@example.com", Password: "hashed"}
+	if err := store.CreateUser(admin); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	receiver := &webhookReceiver{t: t, secret: "whsec_test"}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	endpoint := &repository.WebhookEndpoint{UserID: admin.ID, URL: server.URL, Secret: "whsec_test", AllUsers: true, Enabled: true}
+	if err := store.CreateWebhookEndpoint(endpoint); err != nil {
+		t.Fatalf("CreateWebhookEndpoint() error = %v", err)
+	}
+
+	now := time.Now().Add(time.Second)
+	for i, admins := range [][]string{{"root"}, nil} {
+		if err := store.CreateTodoExtended(&repository.Todo{UserID: userID, Title: "周报"}); err != nil {
+			t.Fatalf("CreateTodoExtended() error = %v", err)
+		}
+		dispatcher := NewEventDispatcher(store, &Config{WebhookAllowPrivate: true, Admins: admins})
+		dispatcher.now = func() time.Time { return now }
+		if processed, err := dispatcher.Dispatch(context.Background()); err != nil || processed != 1 {
+			t.Fatalf("Dispatch() = %d, %v; want 1", processed, err)
+		}
+		now = now.Add(time.Second)
+		if i == 0 && receiver.requests != 1 {
+			t.Fatalf("requests = %d, want 1", receiver.requests)
+		}
+	}
+
+	// 所有者从管理员中移除后，其他用户的事件不再发送
+	deliveries, _ := store.GetWebhookDeliveries(endpoint.ID, 1)
+	if receiver.requests != 1 || len(deliveries) != 1 || deliveries[0].Status != repository.DeliveryCancelled ||
+		deliveries[0].LastError != "webhook cancelled: endpoint owner is no longer an admin" {
+		t.Errorf("requests = %d, deliveries = %+v", receiver.requests, deliveries)
+	}
+}
+
+func TestEventDispatcherRejectsPrivateAddress(t *testing.T) {
+	store := repository.NewMemoryStore()
+	userID := newSchedulerStore(t, store)
+	receiver := &webhookReceiver{t: t, secret: "whsec_test"}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	// 域名解析到回环地址时同样拒绝连接
+	endpoint := createWebhook(t, store, userID, strings.Replace(server.URL, "127.0.0.1", "localhost", 1))
+	if err := store.CreateTodoExtended(&repository.Todo{UserID: userID, Title: "周报"}); err != nil {
+		t.Fatalf("CreateTodoExtended() error = %v", err)
+	}
+
+	dispatcher := NewEventDispatcher(store, &Config{})
+	now := time.Now().Add(time.Second)
+	dispatcher.now = func() time.Time { return now }
+	if processed, err := dispatcher.Dispatch(context.Background()); err != nil || processed != 1 {
+		t.Fatalf("Dispatch() = %d, %v; want 1", processed, err)
+	}
+	if receiver.requests != 0 {
+		t.Errorf("requests = %d, want 0", receiver.requests)
+	}
+	deliveries, _ := store.GetWebhookDeliveries(endpoint.ID, -1)
+	if len(deliveries) != 1 || deliveries[0].Status != repository.DeliveryPending ||
+		!strings.Contains(deliveries[0].LastError, ErrPrivateAddress.Error()) {
+		t.Errorf("deliveries = %+v", deliveries)
+	}
+}
+
+func TestPrivateHost(t *testing.T) {
+	for host, want := range map[string]bool{
+		"localhost": true, "api.localhost.": true, "127.0.0.1": true, "10.1.2.3": true, "192.168.0.1": true,
+		"169.254.169.254": true, "100.64.0.1": true, "0.0.0.0": true, "::1": true, "fd00::1": true, "fe80::1%eth0": true,
+		"::ffff:127.0.0.1": true, "example.com": false, "93.184.216.34": false, "2606:2800:220:1::": false,
+	} {
+		if got := PrivateHost(host); got != want {
+			t.Errorf("PrivateHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{"id":1}' | openssl dgst -sha256 -hmac whsec_test
+	want := "2f441ba4b3b2d50d28a9ab9d9fd8880376ecd1eb5d0435401553f5d8d0a5dcf8"
+	if got := Sign("whsec_test", 1700000000, []byte(`{"id":1}`)); got != want {
+		t.Errorf("Sign() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,74 @@
+// Package notify 通过可插拔的通知渠道（Webhook、邮件、推送）发送到期的TODO提醒和每日摘要，并把变更事件发送到用户登记的Webhook
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"todo-service/src/repository"
+)
+
+// 通知渠道，作为投递记录的 channel
+const (
+	ChannelWebhook = "webhook" // HTTP Webhook
+	ChannelEmail   = "email"   // SMTP邮件
+	ChannelPush    = "push"    // APNs推送
+)
+
+// ErrNoRecipient 用户在该渠道没有接收方（未填写邮箱、没有登记推送令牌的设备等），投递记录标记为跳过而不重试
+var ErrNoRecipient = errors.New("no recipient for channel")
+
+// Notification 一次待发送的TODO提醒或每日摘要，Todo 和 Digest 只有一个非空
+type Notification struct {
+	DeliveryID int                 // 投递记录ID，接收方可以据此去重
+	User       *repository.User    // TODO所属用户
+	Todo       *repository.Todo    // 到期提醒的TODO
+	Digest     *Digest             // 每日摘要
+	Devices    []repository.Device // 用户未撤销、已登记推送令牌的设备
+	Location   *time.Location      // 用户设置的时区，用于格式化时间
+}
+
+// Message 返回通知的标题和正文
+func (n *Notification) Message() (title, body string) {
+	if n.Digest != nil {
+		return n.Digest.Message(n.location())
+	}
+
+	body = n.Todo.Description
+	if n.Todo.DueDate != nil {
+		due := "截止时间：" + n.Todo.DueDate.In(n.location()).Format("2006-01-02 15:04")
+		if body == "" {
+			body = due
+		} else {
+			body += "\n" + due
+		}
+	}
+	if body == "" {
+		body = "提醒时间已到"
+	}
+	return n.Todo.Title, body
+}
+
+// ref 通知的标识，由通知类型和投递记录ID组成，用作邮件 Message-ID 和推送的 apns-collapse-id
+func (n *Notification) ref() string {
+	if n.Digest != nil {
+		return fmt.Sprintf("digest-%d", n.DeliveryID)
+	}
+	return fmt.Sprintf("reminder-%d", n.DeliveryID)
+}
+
+func (n *Notification) location() *time.Location {
+	if n.Location == nil {
+		return time.UTC
+	}
+	return n.Location
+}
+
+// Notifier 通知渠道。Notify 返回 nil 表示已成功交给接收方；返回 ErrNoRecipient 时不再重试，
+// 其他错误按退避时间重试。同一投递记录重试时 DeliveryID 不变
+type Notifier interface {
+	Channel() string
+	Notify(ctx context.Context, n *Notification) error
+}
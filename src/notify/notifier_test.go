@@ -0,0 +1,251 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"todo-service/src/repository"
+)
+
+func testNotification() *Notification {
+	due := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	return &Notification{
+		DeliveryID: 7,
+		User:       &repository.User{ID: 1, Username: "alice", Email: "alice@example.com"},
+		Todo:       &repository.Todo{ID: 3, UUID: "9f0c2a4e-5d1b-4c3a-8e7f-6a5b4c3d2e1f", Title: "周报", Description: "整理本周进展", DueDate: &due},
+		Location:   shanghai,
+	}
+}
+
+func TestNotificationMessage(t *testing.T) {
+	n := testNotification()
+	title, body := n.Message()
+	if title != "周报" || body != "整理本周进展\n截止时间：2026-10-16 18:00" {
+		t.Errorf("Message() = %q, %q", title, body)
+	}
+
+	n.Todo = &repository.Todo{Title: "喝水"}
+	if _, body := n.Message(); body != "提醒时间已到" {
+		t.Errorf("Message(no details) body = %q", body)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received WebhookPayload
+	var header http.Header
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(server.URL, "secret")
+	if err := notifier.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if received.Event != WebhookEvent || received.DeliveryID != 7 || received.UserID != 1 ||
+		received.Title != "周报" || received.Todo == nil || received.Todo.UUID != "9f0c2a4e-5d1b-4c3a-8e7f-6a5b4c3d2e1f" {
+		t.Errorf("payload = %+v", received)
+	}
+	if header.Get("Authorization") != "Bearer secret" || header.Get("X-Delivery-ID") != "7" {
+		t.Errorf("headers = %v", header)
+	}
+
+	status = http.StatusInternalServerError
+	if err := notifier.Notify(context.Background(), testNotification()); err == nil {
+		t.Error("Notify(500) error = nil")
+	}
+}
+
+// smtpStub 只支持明文会话的本地SMTP服务器，记录收到的邮件
+type smtpStub struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []smtpMessage
+}
+
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	stub := &smtpStub{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+	return stub
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP stub")
+
+	var msg smtpMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			text.PrintfLine("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			msg = smtpMessage{from: strings.Trim(line[len("MAIL FROM:"):], "<>")}
+			text.PrintfLine("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			msg.to = append(msg.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			text.PrintfLine("250 OK")
+		case command == "DATA":
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case command == "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	stub := newSMTPStub(t)
+	notifier := NewEmailNotifier(stub.listener.Addr().String(), "todo@example.com", "", "")
+
+	if err := notifier.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	stub.mu.Lock()
+	messages := stub.messages
+	stub.mu.Unlock()
+	if len(messages) != 1 || messages[0].from != "todo@example.com" || len(messages[0].to) != 1 || messages[0].to[0] != "alice@example.com" {
+		t.Fatalf("messages = %+v", messages)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(messages[0].data))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != "提醒：周报" || msg.Header.Get("Message-ID") != "<reminder-7@todo-service>" {
+		t.Errorf("headers = %v (subject %q)", msg.Header, subject)
+	}
+	encoded, _ := io.ReadAll(msg.Body)
+	body, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	if err != nil || !strings.Contains(string(body), "整理本周进展") {
+		t.Errorf("body = %q, %v", body, err)
+	}
+
+	// 每日摘要直接以摘要标题作为邮件标题
+	digest := testNotification()
+	digest.Todo = nil
+	digest.Digest = &Digest{Date: "2026-10-16", DailyDigest: &repository.DailyDigest{Urgent: []repository.Todo{{Title: "报税"}}}}
+	if err := notifier.Notify(context.Background(), digest); err != nil {
+		t.Fatalf("Notify(digest) error = %v", err)
+	}
+	stub.mu.Lock()
+	messages = stub.messages
+	stub.mu.Unlock()
+	msg, err = mail.ReadMessage(strings.NewReader(messages[len(messages)-1].data))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	subject, _ = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != "每日摘要 2026-10-16" || msg.Header.Get("Message-ID") != "<digest-7@todo-service>" {
+		t.Errorf("digest headers = %v (subject %q)", msg.Header, subject)
+	}
+
+	n := testNotification()
+	n.User.Email = ""
+	if err := notifier.Notify(context.Background(), n); !errors.Is(err, ErrNoRecipient) {
+		t.Errorf("Notify(no email) error = %v, want ErrNoRecipient", err)
+	}
+}
+
+func TestPushNotifier(t *testing.T) {
+	var mu sync.Mutex
+	pushed := map[string]http.Header{}
+	var payload apnsPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.URL.Path, "/3/device/")
+		mu.Lock()
+		defer mu.Unlock()
+		if token == "expired" {
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"reason":"Unregistered"}`))
+			return
+		}
+		pushed[token] = r.Header
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer server.Close()
+
+	notifier := NewPushNotifier(server.URL, "com.example.todo", "provider-token")
+	n := testNotification()
+	n.Devices = []repository.Device{
+		{ID: "phone", Platform: "ios", PushToken: "phone-token"},
+		{ID: "old-phone", Platform: "ios", PushToken: "expired"},
+		{ID: "android", Platform: "android", PushToken: "android-token"},
+	}
+	if err := notifier.Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	header, ok := pushed["phone-token"]
+	if len(pushed) != 1 || !ok {
+		t.Fatalf("pushed = %v, want only phone-token", pushed)
+	}
+	if header.Get("apns-topic") != "com.example.todo" || header.Get("Authorization") != "Bearer provider-token" ||
+		header.Get("apns-collapse-id") != "reminder-7" || header.Get("apns-push-type") != "alert" {
+		t.Errorf("headers = %v", header)
+	}
+	if payload.APS.Alert.Title != "周报" || payload.TodoUUID != n.Todo.UUID {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	n.Devices = n.Devices[1:]
+	if err := notifier.Notify(context.Background(), n); err == nil || !strings.Contains(err.Error(), "Unregistered") {
+		t.Errorf("Notify(all failed) error = %v", err)
+	}
+	n.Devices = n.Devices[1:]
+	if err := notifier.Notify(context.Background(), n); !errors.Is(err, ErrNoRecipient) {
+		t.Errorf("Notify(no apple devices) error = %v, want ErrNoRecipient", err)
+	}
+}
@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultAPNsURL APNs生产环境地址
+const DefaultAPNsURL = "https://api.push.apple.com"
+
+// apnsPlatforms 通过APNs推送的设备平台
+var apnsPlatforms = map[string]bool{"ios": true, "watchos": true, "macos": true}
+
+// apnsPayload APNs推送内容
+type apnsPayload struct {
+	APS struct {
+		Alert struct {
+			Title string `json:"title"`
+			Body  string `json:"body"`
+		} `json:"alert"`
+		Sound string `json:"sound"`
+	} `json:"aps"`
+	TodoUUID string `json:"todo_uuid,omitempty"` // 客户端据此打开对应的TODO，每日摘要没有该字段
+}
+
+// PushNotifier 按APNs HTTP接口把提醒和每日摘要推送到用户已登记推送令牌的Apple设备。
+// 任意一台设备推送成功即视为成功，避免重试时重复推送到已成功的设备
+type PushNotifier struct {
+	URL       string       // APNs服务地址，如 https://api.push.apple.com
+	Topic     string       // apns-topic，通常为App的Bundle ID
+	AuthToken string       // 提供者认证令牌（JWT），作为 Bearer 令牌发送
+	Client    *http.Client // 为 nil 时使用带超时的默认客户端；APNs要求HTTP/2，HTTPS地址会自动协商
+}
+
+// NewPushNotifier 创建推送通知渠道，url 为空时使用APNs生产环境地址
+func NewPushNotifier(url, topic, authToken string) *PushNotifier {
+	if url == "" {
+		url = DefaultAPNsURL
+	}
+	return &PushNotifier{URL: url, Topic: topic, AuthToken: authToken, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Channel 实现 Notifier 接口
+func (p *PushNotifier) Channel() string {
+	return ChannelPush
+}
+
+// Notify 实现 Notifier 接口
+func (p *PushNotifier) Notify(ctx context.Context, n *Notification) error {
+	var payload apnsPayload
+	payload.APS.Alert.Title, payload.APS.Alert.Body = n.Message()
+	payload.APS.Sound = "default"
+	if n.Todo != nil {
+		payload.TodoUUID = n.Todo.UUID
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	sent := 0
+	for _, device := range n.Devices {
+		if device.PushToken == "" || !apnsPlatforms[device.Platform] {
+			continue
+		}
+		if err := p.push(ctx, device.PushToken, n.ref(), data); err != nil {
+			errs = append(errs, fmt.Errorf("device %s: %w", device.ID, err))
+			continue
+		}
+		sent++
+	}
+
+	switch {
+	case sent > 0:
+		for _, err := range errs {
+			log.Printf("push notifier: delivery %d: %v", n.DeliveryID, err)
+		}
+		return nil
+	case len(errs) > 0:
+		return errors.Join(errs...)
+	default:
+		return ErrNoRecipient
+	}
+}
+
+// push 向单个设备发送推送，apns-collapse-id 由通知类型和投递记录ID生成，设备上重复收到时只显示一条
+func (p *PushNotifier) push(ctx context.Context, token, collapseID string, data []byte) error {
+	url := strings.TrimSuffix(p.URL, "/") + "/3/device/" + token
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-collapse-id", collapseID)
+	if p.Topic != "" {
+		req.Header.Set("apns-topic", p.Topic)
+	}
+	if p.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+p.AuthToken)
+	}
+
+	resp, err := httpClient(p.Client).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// 失败时APNs返回 {"reason": "..."}
+		var result struct {
+			Reason string `json:"reason"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&result)
+		if result.Reason != "" {
+			return fmt.Errorf("push service returned status %d: %s", resp.StatusCode, result.Reason)
+		}
+		return fmt.Errorf("push service returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"todo-service/src/repository"
+
+	"github.com/google/uuid"
+)
+
+// 调度流程：
+//  1. 查找提醒时间已到、尚未生成投递记录的TODO，为每个通知渠道生成一条待发送记录；
+//     投递记录按 (TODO, 提醒时间, 渠道) 唯一，多个实例同时生成时只有一条成功。
+//  2. 认领到达发送时间的投递记录（带租约的条件更新），只有认领成功的实例负责发送。
+//  3. 发送前重新读取TODO，已完成、已删除或修改了提醒时间时取消投递；发送失败时按指数退避重试，
+//     超过最大次数后标记为失败。结果只能由仍持有认领的实例保存。
+
+// reminderBatch 每批查找到期提醒的数量
+const reminderBatch = 100
+
+// 未配置时的默认值
+const (
+	DefaultInterval    = 30 * time.Second
+	DefaultLookback    = 24 * time.Hour
+	DefaultLease       = 2 * time.Minute
+	DefaultMaxAttempts = 5
+	DefaultRetryDelay  = time.Minute
+	maxRetryDelay      = time.Hour
+)
+
+// errCancelled 发送前发现提醒或每日摘要已不需要发送
+var errCancelled = errors.New("cancelled")
+
+// dispatcher 提醒调度和每日摘要调度共用的通知渠道、认领和重试设置
+type dispatcher struct {
+	notifiers   map[string]Notifier
+	channels    []string // 按配置顺序排列的渠道
+	owner       string   // 本实例的标识，用于认领投递记录
+	lease       time.Duration
+	maxAttempts int
+	retryDelay  time.Duration
+	now         func() time.Time
+}
+
+// newDispatcher 按配置创建调度设置，未配置的项使用默认值
+func newDispatcher(notifiers []Notifier, config *Config) dispatcher {
+	d := dispatcher{
+		notifiers:   make(map[string]Notifier),
+		owner:       instanceID(),
+		lease:       config.Lease,
+		maxAttempts: config.MaxAttempts,
+		retryDelay:  config.RetryDelay,
+		now:         time.Now,
+	}
+	for _, notifier := range notifiers {
+		if _, exists := d.notifiers[notifier.Channel()]; !exists {
+			d.channels = append(d.channels, notifier.Channel())
+		}
+		d.notifiers[notifier.Channel()] = notifier
+	}
+	if d.lease <= 0 {
+		d.lease = DefaultLease
+	}
+	if d.maxAttempts <= 0 {
+		d.maxAttempts = DefaultMaxAttempts
+	}
+	if d.retryDelay <= 0 {
+		d.retryDelay = DefaultRetryDelay
+	}
+	return d
+}
+
+// instanceID 生成本实例的标识，包含主机名便于排查
+func instanceID() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%.27s-%s", host, uuid.NewString())
+}
+
+// outcome 根据第 attempts 次发送的结果返回投递状态，需要重试时同时返回下次尝试时间
+func (d *dispatcher) outcome(err error, attempts int, now time.Time) (status string, retryAt time.Time) {
+	switch {
+	case err == nil:
+		return repository.DeliverySent, retryAt
+	case errors.Is(err, errCancelled):
+		return repository.DeliveryCancelled, retryAt
+	case errors.Is(err, ErrNoRecipient):
+		return repository.DeliverySkipped, retryAt
+	case attempts >= d.maxAttempts:
+		return repository.DeliveryFailed, retryAt
+	default:
+		return repository.DeliveryPending, now.Add(d.backoff(attempts))
+	}
+}
+
+// backoff 第 attempts 次尝试失败后的等待时间，从 retryDelay 开始每次加倍，最长1小时
+func (d *dispatcher) backoff(attempts int) time.Duration {
+	delay := d.retryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// recipient 读取通知的接收方：用户、未撤销且已登记推送令牌的设备，以及用户设置的时区
+func (d *dispatcher) recipient(store repository.Store, userID int) (*Notification, error) {
+	user, err := store.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := store.GetDevicesByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	n := &Notification{User: user, Location: time.UTC}
+	for _, device := range devices {
+		if device.RevokedAt == nil && device.PushToken != "" {
+			n.Devices = append(n.Devices, device)
+		}
+	}
+	if settings, err := store.GetUserSettings(userID); err == nil {
+		n.Location = settings.Location()
+	}
+	return n, nil
+}
+
+// Scheduler 定期查找到期的TODO提醒并通过各通知渠道发送，多个服务实例可以同时运行
+type Scheduler struct {
+	dispatcher
+	store    repository.Store
+	interval time.Duration
+	lookback time.Duration
+}
+
+// NewScheduler 创建提醒调度任务
+func NewScheduler(store repository.Store, notifiers []Notifier, config *Config) *Scheduler {
+	s := &Scheduler{
+		dispatcher: newDispatcher(notifiers, config),
+		store:      store,
+		interval:   config.Interval,
+		lookback:   config.Lookback,
+	}
+	if s.interval <= 0 {
+		s.interval = DefaultInterval
+	}
+	if s.lookback <= 0 {
+		s.lookback = DefaultLookback
+	}
+	return s
+}
+
+// Dispatch 执行一次调度：为到期的提醒生成投递记录，并发送所有可以认领的投递记录，返回处理的投递记录数量
+func (s *Scheduler) Dispatch(ctx context.Context) (int, error) {
+	now := s.now()
+	if err := s.enqueue(now); err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for ctx.Err() == nil {
+		// 每次只认领一条，租约只需覆盖单次发送的时间；处理中途退出时未认领的记录留给其他实例
+		deliveries, err := s.store.ClaimReminderDeliveries(s.owner, now, s.now().Add(s.lease), 1)
+		if err != nil {
+			return processed, err
+		}
+		if len(deliveries) == 0 {
+			return processed, nil
+		}
+		s.deliver(ctx, &deliveries[0])
+		processed++
+	}
+	return processed, ctx.Err()
+}
+
+// enqueue 为提醒时间在 (now-lookback, now] 内的TODO在每个渠道生成投递记录，已存在的记录被忽略
+func (s *Scheduler) enqueue(now time.Time) error {
+	if len(s.channels) == 0 {
+		return nil
+	}
+	for {
+		todos, err := s.store.GetDueReminders(now.Add(-s.lookback), now, reminderBatch)
+		if err != nil {
+			return err
+		}
+		for _, todo := range todos {
+			for _, channel := range s.channels {
+				delivery := &repository.ReminderDelivery{
+					UserID:        todo.UserID,
+					TodoID:        todo.ID,
+					ReminderAt:    *todo.Reminder,
+					Channel:       channel,
+					NextAttemptAt: now,
+				}
+				err := s.store.CreateReminderDelivery(delivery)
+				if err != nil && !errors.Is(err, repository.ErrDuplicate) {
+					return err
+				}
+			}
+		}
+		if len(todos) < reminderBatch {
+			return nil
+		}
+	}
+}
+
+// deliver 发送已认领的投递记录并保存结果
+func (s *Scheduler) deliver(ctx context.Context, delivery *repository.ReminderDelivery) {
+	err := s.send(ctx, delivery)
+	now := s.now()
+	delivery.LastError = ""
+	if err != nil {
+		delivery.LastError = err.Error()
+	}
+
+	var retryAt time.Time
+	delivery.Status, retryAt = s.outcome(err, delivery.Attempts, now)
+	switch delivery.Status {
+	case repository.DeliverySent:
+		delivery.SentAt = &now
+	case repository.DeliveryPending:
+		delivery.NextAttemptAt = retryAt
+	}
+
+	if err := s.store.FinishReminderDelivery(delivery); err != nil {
+		log.Printf("reminder scheduler: failed to save delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// send 重新读取TODO确认提醒仍然有效，然后通过对应渠道发送
+func (s *Scheduler) send(ctx context.Context, delivery *repository.ReminderDelivery) error {
+	notifier, ok := s.notifiers[delivery.Channel]
+	if !ok {
+		return fmt.Errorf("reminder %w: channel %s is not configured", errCancelled, delivery.Channel)
+	}
+
+	todo, err := s.store.GetTodoByID(delivery.TodoID, delivery.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("reminder %w: todo was deleted", errCancelled)
+	}
+	if err != nil {
+		return err
+	}
+	if todo.Completed {
+		return fmt.Errorf("reminder %w: todo was completed", errCancelled)
+	}
+	if todo.Reminder == nil || !todo.Reminder.Equal(delivery.ReminderAt) {
+		return fmt.Errorf("reminder %w: reminder was changed", errCancelled)
+	}
+
+	n, err := s.recipient(s.store, delivery.UserID)
+	if err != nil {
+		return err
+	}
+	n.DeliveryID = delivery.ID
+	n.Todo = todo
+	return notifier.Notify(ctx, n)
+}
+
+// Run 立即调度一次，之后按间隔定期调度，直到 ctx 取消
+func (s *Scheduler) Run(ctx context.Context) {
+	run(ctx, "reminder scheduler", s.interval, s.Dispatch)
+}
+
+// run 立即执行一次 dispatch，之后按间隔定期执行，直到 ctx 取消
+func run(ctx context.Context, name string, interval time.Duration, dispatch func(ctx context.Context) (int, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if processed, err := dispatch(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("%s: %v", name, err)
+		} else if processed > 0 {
+			log.Printf("%s: processed %d deliveries", name, processed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
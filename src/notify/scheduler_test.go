@@ -0,0 +1,221 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"todo-service/src/repository"
+)
+
+// fakeNotifier 记录发送的TODO和每日摘要，fail 非空时由其决定发送结果
+type fakeNotifier struct {
+	channel string
+	fail    func(n *Notification) error
+
+	mu      sync.Mutex
+	sent    []int
+	digests []*Digest
+}
+
+func (f *fakeNotifier) Channel() string {
+	return f.channel
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, n *Notification) error {
+	if f.fail != nil {
+		if err := f.fail(n); err != nil {
+			return err
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if n.Digest != nil {
+		f.digests = append(f.digests, n.Digest)
+		return nil
+	}
+	f.sent = append(f.sent, n.Todo.ID)
+	return nil
+}
+
+func (f *fakeNotifier) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.sent)
+}
+
+func newSchedulerStore(t *testing.T, store repository.Store) (userID int) {
+	t.Helper()
+	user := &repository.User{Username: "alice", Email: "alice@example.com", Password: "hashed"}
+	if err := store.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	return user.ID
+}
+
+func createReminder(t *testing.T, store repository.Store, userID int, title string, reminder time.Time) *repository.Todo {
+	t.Helper()
+	todo := &repository.Todo{UserID: userID, Title: title, Reminder: &reminder}
+	if err := store.CreateTodoExtended(todo); err != nil {
+		t.Fatalf("CreateTodoExtended() error = %v", err)
+	}
+	return todo
+}
+
+func deliveryStatuses(t *testing.T, store repository.Store, userID, todoID int) map[string]repository.ReminderDelivery {
+	t.Helper()
+	deliveries, err := store.GetReminderDeliveries(userID, todoID)
+	if err != nil {
+		t.Fatalf("GetReminderDeliveries() error = %v", err)
+	}
+	statuses := make(map[string]repository.ReminderDelivery)
+	for _, delivery := range deliveries {
+		statuses[delivery.Channel] = delivery
+	}
+	return statuses
+}
+
+func TestSchedulerDispatch(t *testing.T) {
+	store := repository.NewMemoryStore()
+	userID := newSchedulerStore(t, store)
+	now := time.Now()
+
+	report := createReminder(t, store, userID, "周报", now.Add(-time.Minute))
+	createReminder(t, store, userID, "明天", now.Add(time.Hour))
+	createReminder(t, store, userID, "上周", now.Add(-48*time.Hour))
+
+	email := &fakeNotifier{channel: ChannelEmail}
+	push := &fakeNotifier{channel: ChannelPush, fail: func(*Notification) error { return ErrNoRecipient }}
+	scheduler := NewScheduler(store, []Notifier{email, push}, &Config{})
+	scheduler.now = func() time.Time { return now }
+
+	processed, err := scheduler.Dispatch(context.Background())
+	if err != nil || processed != 2 {
+		t.Fatalf("Dispatch() = %d, %v; want 2", processed, err)
+	}
+	if email.count() != 1 || email.sent[0] != report.ID {
+		t.Errorf("email sent = %v, want [%d]", email.sent, report.ID)
+	}
+	statuses := deliveryStatuses(t, store, userID, report.ID)
+	if statuses[ChannelEmail].Status != repository.DeliverySent || statuses[ChannelEmail].SentAt == nil ||
+		statuses[ChannelPush].Status != repository.DeliverySkipped {
+		t.Errorf("deliveries = %+v", statuses)
+	}
+
+	// 同一提醒不会重复发送
+	if processed, err := scheduler.Dispatch(context.Background()); err != nil || processed != 0 {
+		t.Errorf("Dispatch() again = %d, %v; want 0", processed, err)
+	}
+	if email.count() != 1 {
+		t.Errorf("email sent again: %v", email.sent)
+	}
+
+	// 修改提醒时间后按新时间再提醒一次
+	moved := now.Add(-10 * time.Second)
+	report.Reminder = &moved
+	if err := store.UpdateTodoExtended(report); err != nil {
+		t.Fatalf("UpdateTodoExtended() error = %v", err)
+	}
+	if _, err := scheduler.Dispatch(context.Background()); err != nil || email.count() != 2 {
+		t.Errorf("Dispatch() after moving reminder: sent %v, %v", email.sent, err)
+	}
+}
+
+func TestSchedulerRetry(t *testing.T) {
+	store := repository.NewMemoryStore()
+	userID := newSchedulerStore(t, store)
+	now := time.Now()
+	clock := now
+
+	report := createReminder(t, store, userID, "周报", now.Add(-time.Minute))
+	plan := createReminder(t, store, userID, "计划", now.Add(-time.Minute))
+
+	webhook := &fakeNotifier{channel: ChannelWebhook, fail: func(*Notification) error { return errors.New("webhook returned status 503") }}
+	scheduler := NewScheduler(store, []Notifier{webhook}, &Config{MaxAttempts: 2, RetryDelay: time.Minute})
+	scheduler.now = func() time.Time { return clock }
+
+	if _, err := scheduler.Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch() error = %v", err)
+	}
+	delivery := deliveryStatuses(t, store, userID, report.ID)[ChannelWebhook]
+	if delivery.Status != repository.DeliveryPending || delivery.Attempts != 1 ||
+		delivery.LastError != "webhook returned status 503" || !delivery.NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("delivery after failure = %+v", delivery)
+	}
+
+	// 未到重试时间不发送
+	clock = now.Add(30 * time.Second)
+	if processed, err := scheduler.Dispatch(context.Background()); err != nil || processed != 0 {
+		t.Errorf("Dispatch(before retry) = %d, %v; want 0", processed, err)
+	}
+
+	// 等待重试期间完成的TODO不再提醒
+	plan.Completed = true
+	if err := store.UpdateTodoExtended(plan); err != nil {
+		t.Fatalf("UpdateTodoExtended() error = %v", err)
+	}
+	clock = now.Add(time.Minute)
+	if processed, err := scheduler.Dispatch(context.Background()); err != nil || processed != 2 {
+		t.Fatalf("Dispatch(retry) = %d, %v; want 2", processed, err)
+	}
+	if delivery := deliveryStatuses(t, store, userID, report.ID)[ChannelWebhook]; delivery.Status != repository.DeliveryFailed || delivery.Attempts != 2 {
+		t.Errorf("delivery after max attempts = %+v", delivery)
+	}
+	if delivery := deliveryStatuses(t, store, userID, plan.ID)[ChannelWebhook]; delivery.Status != repository.DeliveryCancelled ||
+		delivery.LastError != "reminder cancelled: todo was completed" {
+		t.Errorf("delivery of completed todo = %+v", delivery)
+	}
+
+	clock = now.Add(time.Hour)
+	if processed, err := scheduler.Dispatch(context.Background()); err != nil || processed != 0 {
+		t.Errorf("Dispatch(after failure) = %d, %v; want 0", processed, err)
+	}
+}
+
+func TestSchedulerMultipleInstances(t *testing.T) {
+	sqlite, err := repository.OpenSQLiteStore(filepath.Join(t.TempDir(), "todo.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer sqlite.Close()
+
+	stores := map[string]repository.Store{"memory": repository.NewMemoryStore(), "sqlite": sqlite}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			userID := newSchedulerStore(t, store)
+			now := time.Now()
+			for _, title := range []string{"周报", "计划", "买牛奶", "健身", "读书"} {
+				createReminder(t, store, userID, title, now.Add(-time.Minute))
+			}
+
+			// 多个实例同时调度，每个提醒只发送一次
+			email := &fakeNotifier{channel: ChannelEmail}
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				scheduler := NewScheduler(store, []Notifier{email}, &Config{})
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := scheduler.Dispatch(context.Background()); err != nil {
+						t.Errorf("Dispatch() error = %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if email.count() != 5 {
+				t.Fatalf("sent = %v, want 5 reminders", email.sent)
+			}
+			seen := make(map[int]bool)
+			for _, todoID := range email.sent {
+				if seen[todoID] {
+					t.Errorf("todo %d sent twice", todoID)
+				}
+				seen[todoID] = true
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"todo-service/src/repository"
+)
+
+// Webhook的事件类型
+const (
+	WebhookEvent       = "todo.reminder" // TODO提醒
+	WebhookDigestEvent = "todo.digest"   // 每日摘要
+)
+
+// WebhookPayload 提醒和每日摘要Webhook的请求体
+type WebhookPayload struct {
+	Event      string           `json:"event"`            // 事件类型，todo.reminder 或 todo.digest
+	DeliveryID int              `json:"delivery_id"`      // 投递记录ID，重试时不变；两种事件的ID各自独立
+	UserID     int              `json:"user_id"`          // 用户ID
+	Title      string           `json:"title"`            // 通知标题
+	Body       string           `json:"body"`             // 通知正文
+	Todo       *repository.Todo `json:"todo,omitempty"`   // 到期提醒的TODO
+	Digest     *Digest          `json:"digest,omitempty"` // 每日摘要
+}
+
+// WebhookNotifier 以JSON POST请求把提醒发送到配置的URL，2xx响应视为成功
+type WebhookNotifier struct {
+	URL    string       // 接收提醒的URL
+	Token  string       // 非空时作为 Bearer 令牌放在 Authorization 请求头中
+	Client *http.Client // 为 nil 时使用带超时的默认客户端
+}
+
+// NewWebhookNotifier 创建Webhook通知渠道
+func NewWebhookNotifier(url, token string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Token: token, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Channel 实现 Notifier 接口
+func (w *WebhookNotifier) Channel() string {
+	return ChannelWebhook
+}
+
+// Notify 实现 Notifier 接口
+func (w *WebhookNotifier) Notify(ctx context.Context, n *Notification) error {
+	title, body := n.Message()
+	event := WebhookEvent
+	if n.Digest != nil {
+		event = WebhookDigestEvent
+	}
+	data, err := json.Marshal(WebhookPayload{
+		Event:      event,
+		DeliveryID: n.DeliveryID,
+		UserID:     n.User.ID,
+		Title:      title,
+		Body:       body,
+		Todo:       n.Todo,
+		Digest:     n.Digest,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Delivery-ID", strconv.Itoa(n.DeliveryID))
+	if w.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.Token)
+	}
+
+	resp, err := httpClient(w.Client).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// httpClient client 为 nil 时返回带超时的默认客户端
+func httpClient(client *http.Client) *http.Client {
+	if client == nil {
+		return &http.Client{Timeout: 10 * time.Second}
+	}
+	return client
+}
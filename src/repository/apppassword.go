@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+)
+
+// AppPasswordRepository 应用专用密码数据访问层
+type AppPasswordRepository struct {
+	db *sqlDB
+}
+
+// appPasswordColumns 查询应用专用密码时选择的列，与 scanAppPassword 的扫描顺序一致
+const appPasswordColumns = `id, user_id, name, password_hash, last_used_at, created_at`
+
+// scanAppPassword 扫描单行应用专用密码
+func scanAppPassword(scanner interface{ Scan(dest ...any) error }) (*AppPassword, error) {
+	var password AppPassword
+	err := scanner.Scan(&password.ID, &password.UserID, &password.Name, &password.PasswordHash,
+		&password.LastUsedAt, &password.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &password, nil
+}
+
+// CreateAppPassword 创建应用专用密码
+func (r *AppPasswordRepository) CreateAppPassword(password *AppPassword) error {
+	query := `
+		INSERT INTO app_passwords (user_id, name, password_hash, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`
+
+	password.CreatedAt = time.Now()
+	return translateError(r.db.QueryRow(query, password.UserID, password.Name, password.PasswordHash,
+		password.CreatedAt).Scan(&password.ID))
+}
+
+// GetAppPasswords 获取用户的全部应用专用密码，按创建顺序排序
+func (r *AppPasswordRepository) GetAppPasswords(userID int) ([]AppPassword, error) {
+	query := `SELECT ` + appPasswordColumns + ` FROM app_passwords WHERE user_id = $1 ORDER BY id ASC`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var passwords []AppPassword
+	for rows.Next() {
+		password, err := scanAppPassword(rows)
+		if err != nil {
+			return nil, err
+		}
+		passwords = append(passwords, *password)
+	}
+	return passwords, rows.Err()
+}
+
+// GetAppPasswordByHash 根据密码哈希获取应用专用密码
+func (r *AppPasswordRepository) GetAppPasswordByHash(passwordHash string) (*AppPassword, error) {
+	query := `SELECT ` + appPasswordColumns + ` FROM app_passwords WHERE password_hash = $1`
+
+	password, err := scanAppPassword(r.db.QueryRow(query, passwordHash))
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return password, nil
+}
+
+// DeleteAppPassword 删除应用专用密码，使用该密码的客户端立即无法访问
+func (r *AppPasswordRepository) DeleteAppPassword(passwordID, userID int) error {
+	result, err := r.db.Exec(`DELETE FROM app_passwords WHERE id = $1 AND user_id = $2`, passwordID, userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("app password not found or not owned by user: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// DeleteAppPasswords 删除用户的全部应用专用密码
+func (r *AppPasswordRepository) DeleteAppPasswords(userID int) error {
+	_, err := r.db.Exec(`DELETE FROM app_passwords WHERE user_id = $1`, userID)
+	return err
+}
+
+// TouchAppPassword 记录客户端使用密码的时间
+func (r *AppPasswordRepository) TouchAppPassword(passwordID int, usedAt time.Time) error {
+	_, err := r.db.Exec(`UPDATE app_passwords SET last_used_at = $1 WHERE id = $2`, usedAt, passwordID)
+	return err
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStoreAppPasswords(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		mac := &AppPassword{UserID: userID, Name: "Mac", PasswordHash: "hash-mac"}
+		phone := &AppPassword{UserID: userID, Name: "手机", PasswordHash: "hash-phone"}
+		for _, password := range []*AppPassword{mac, phone} {
+			if err := store.CreateAppPassword(password); err != nil {
+				t.Fatalf("CreateAppPassword() error = %v", err)
+			}
+		}
+		if err := store.CreateAppPassword(&AppPassword{UserID: userID, PasswordHash: "hash-mac"}); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("CreateAppPassword(duplicate) error = %v, want ErrDuplicate", err)
+		}
+
+		password, err := store.GetAppPasswordByHash("hash-phone")
+		if err != nil || password.ID != phone.ID || password.UserID != userID || password.LastUsedAt != nil {
+			t.Fatalf("GetAppPasswordByHash() = %+v, %v", password, err)
+		}
+		used := time.Now().Truncate(time.Second)
+		if err := store.TouchAppPassword(password.ID, used); err != nil {
+			t.Fatalf("TouchAppPassword() error = %v", err)
+		}
+		passwords, err := store.GetAppPasswords(userID)
+		if err != nil || len(passwords) != 2 || passwords[0].ID != mac.ID || passwords[1].LastUsedAt == nil ||
+			!passwords[1].LastUsedAt.Equal(used) {
+			t.Fatalf("GetAppPasswords() = %+v, %v", passwords, err)
+		}
+
+		if err := store.DeleteAppPassword(mac.ID, userID+100); !errors.Is(err, ErrNotFound) {
+			t.Errorf("DeleteAppPassword(other user) error = %v, want ErrNotFound", err)
+		}
+		if err := store.DeleteAppPassword(mac.ID, userID); err != nil {
+			t.Fatalf("DeleteAppPassword() error = %v", err)
+		}
+		if _, err := store.GetAppPasswordByHash("hash-mac"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetAppPasswordByHash(deleted) error = %v, want ErrNotFound", err)
+		}
+		if err := store.DeleteAppPasswords(userID); err != nil {
+			t.Fatalf("DeleteAppPasswords() error = %v", err)
+		}
+		if passwords, err := store.GetAppPasswords(userID); err != nil || len(passwords) != 0 {
+			t.Errorf("GetAppPasswords() after delete all = %+v, %v", passwords, err)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+)
+
+// CalendarFeedRepository 日历订阅数据访问层
+type CalendarFeedRepository struct {
+	db *sqlDB
+}
+
+// calendarFeedColumns 查询日历订阅时选择的列，与 scanCalendarFeed 的扫描顺序一致；category_uuid 取自关联的分类
+const calendarFeedColumns = `id, user_id, name, category_id,
+			(SELECT c.uuid FROM categories c WHERE c.id = calendar_feeds.category_id),
+			token_hash, last_accessed_at, created_at, updated_at`
+
+// scanCalendarFeed 扫描单行日历订阅
+func scanCalendarFeed(scanner interface{ Scan(dest ...any) error }) (*CalendarFeed, error) {
+	var feed CalendarFeed
+	err := scanner.Scan(&feed.ID, &feed.UserID, &feed.Name, &feed.CategoryID, &feed.CategoryUUID,
+		&feed.TokenHash, &feed.LastAccessedAt, &feed.CreatedAt, &feed.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+// CreateCalendarFeed 创建日历订阅
+func (r *CalendarFeedRepository) CreateCalendarFeed(feed *CalendarFeed) error {
+	query := `
+		INSERT INTO calendar_feeds (user_id, name, category_id, token_hash, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`
+
+	now := time.Now()
+	feed.CreatedAt = now
+	feed.UpdatedAt = now
+	return translateError(r.db.QueryRow(query, feed.UserID, feed.Name, feed.CategoryID, feed.TokenHash,
+		feed.CreatedAt, feed.UpdatedAt).Scan(&feed.ID))
+}
+
+// GetCalendarFeeds 获取用户的全部日历订阅，按创建顺序排序
+func (r *CalendarFeedRepository) GetCalendarFeeds(userID int) ([]CalendarFeed, error) {
+	query := `SELECT ` + calendarFeedColumns + ` FROM calendar_feeds WHERE user_id = $1 ORDER BY id ASC`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feeds []CalendarFeed
+	for rows.Next() {
+		feed, err := scanCalendarFeed(rows)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, *feed)
+	}
+	return feeds, rows.Err()
+}
+
+// GetCalendarFeedByID 根据ID获取用户的日历订阅
+func (r *CalendarFeedRepository) GetCalendarFeedByID(feedID, userID int) (*CalendarFeed, error) {
+	query := `SELECT ` + calendarFeedColumns + ` FROM calendar_feeds WHERE id = $1 AND user_id = $2`
+
+	feed, err := scanCalendarFeed(r.db.QueryRow(query, feedID, userID))
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return feed, nil
+}
+
+// GetCalendarFeedByTokenHash 根据令牌哈希获取日历订阅
+func (r *CalendarFeedRepository) GetCalendarFeedByTokenHash(tokenHash string) (*CalendarFeed, error) {
+	query := `SELECT ` + calendarFeedColumns + ` FROM calendar_feeds WHERE token_hash = $1`
+
+	feed, err := scanCalendarFeed(r.db.QueryRow(query, tokenHash))
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return feed, nil
+}
+
+// UpdateCalendarFeed 修改日历订阅的名称、限定的分类和令牌哈希
+func (r *CalendarFeedRepository) UpdateCalendarFeed(feed *CalendarFeed) error {
+	query := `
+		UPDATE calendar_feeds
+		SET name = $1, category_id = $2, token_hash = $3, updated_at = $4
+		WHERE id = $5 AND user_id = $6`
+
+	feed.UpdatedAt = time.Now()
+	result, err := r.db.Exec(query, feed.Name, feed.CategoryID, feed.TokenHash, feed.UpdatedAt, feed.ID, feed.UserID)
+	if err != nil {
+		return translateError(err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("calendar feed not found or not owned by user: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// DeleteCalendarFeed 删除日历订阅，订阅地址立即失效
+func (r *CalendarFeedRepository) DeleteCalendarFeed(feedID, userID int) error {
+	result, err := r.db.Exec(`DELETE FROM calendar_feeds WHERE id = $1 AND user_id = $2`, feedID, userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("calendar feed not found or not owned by user: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// TouchCalendarFeed 记录日历客户端读取订阅的时间
+func (r *CalendarFeedRepository) TouchCalendarFeed(feedID int, accessedAt time.Time) error {
+	_, err := r.db.Exec(`UPDATE calendar_feeds SET last_accessed_at = $1 WHERE id = $2`, accessedAt, feedID)
+	return err
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStoreCalendarFeeds(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		category := &Category{UserID: userID, Name: "工作"}
+		if err := store.CreateCategory(category); err != nil {
+			t.Fatalf("CreateCategory() error = %v", err)
+		}
+
+		all := &CalendarFeed{UserID: userID, Name: "全部", TokenHash: "hash-all"}
+		work := &CalendarFeed{UserID: userID, Name: "工作", CategoryID: &category.ID, TokenHash: "hash-work"}
+		for _, feed := range []*CalendarFeed{all, work} {
+			if err := store.CreateCalendarFeed(feed); err != nil {
+				t.Fatalf("CreateCalendarFeed() error = %v", err)
+			}
+		}
+		duplicate := &CalendarFeed{UserID: userID, TokenHash: "hash-all"}
+		if err := store.CreateCalendarFeed(duplicate); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("CreateCalendarFeed(duplicate) error = %v, want ErrDuplicate", err)
+		}
+
+		feeds, err := store.GetCalendarFeeds(userID)
+		if err != nil || len(feeds) != 2 || feeds[0].ID != all.ID || feeds[1].CategoryUUID == nil || *feeds[1].CategoryUUID != category.UUID {
+			t.Fatalf("GetCalendarFeeds() = %+v, %v", feeds, err)
+		}
+
+		feed, err := store.GetCalendarFeedByTokenHash("hash-work")
+		if err != nil || feed.ID != work.ID || feed.LastAccessedAt != nil {
+			t.Fatalf("GetCalendarFeedByTokenHash() = %+v, %v", feed, err)
+		}
+		accessed := time.Now().Truncate(time.Second)
+		if err := store.TouchCalendarFeed(feed.ID, accessed); err != nil {
+			t.Fatalf("TouchCalendarFeed() error = %v", err)
+		}
+
+		// 重新生成令牌后旧令牌失效
+		feed.TokenHash = "hash-rotated"
+		feed.Name = "工作截止日期"
+		if err := store.UpdateCalendarFeed(feed); err != nil {
+			t.Fatalf("UpdateCalendarFeed() error = %v", err)
+		}
+		if _, err := store.GetCalendarFeedByTokenHash("hash-work"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetCalendarFeedByTokenHash(old token) error = %v, want ErrNotFound", err)
+		}
+		rotated, err := store.GetCalendarFeedByID(work.ID, userID)
+		if err != nil || rotated.TokenHash != "hash-rotated" || rotated.Name != "工作截止日期" ||
+			rotated.LastAccessedAt == nil || !rotated.LastAccessedAt.Equal(accessed) {
+			t.Errorf("GetCalendarFeedByID() = %+v, %v", rotated, err)
+		}
+		if _, err := store.GetCalendarFeedByID(work.ID, userID+100); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetCalendarFeedByID(other user) error = %v, want ErrNotFound", err)
+		}
+
+		// 限定的分类被彻底删除后订阅一并删除
+		if err := store.DeleteCategory(category.ID, userID); err != nil {
+			t.Fatalf("DeleteCategory() error = %v", err)
+		}
+		if err := DeleteCategoryPermanently(store, userID, category.ID); err != nil {
+			t.Fatalf("DeleteCategoryPermanently() error = %v", err)
+		}
+		if _, err := store.GetCalendarFeedByID(work.ID, userID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetCalendarFeedByID(purged category) error = %v, want ErrNotFound", err)
+		}
+
+		if err := store.DeleteCalendarFeed(all.ID, userID+100); !errors.Is(err, ErrNotFound) {
+			t.Errorf("DeleteCalendarFeed(other user) error = %v, want ErrNotFound", err)
+		}
+		if err := store.DeleteCalendarFeed(all.ID, userID); err != nil {
+			t.Fatalf("DeleteCalendarFeed() error = %v", err)
+		}
+		if feeds, err := store.GetCalendarFeeds(userID); err != nil || len(feeds) != 0 {
+			t.Errorf("GetCalendarFeeds() after delete = %+v, %v", feeds, err)
+		}
+	})
+}
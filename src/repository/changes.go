@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ChangedEntity 一次写入涉及的数据，settings 没有ID
+type ChangedEntity struct {
+	Type string `json:"type"` // todo/category/checklist_item/tag/smart_list/settings
+	ID   int    `json:"id,omitempty"`
+	UUID string `json:"uuid,omitempty"`
+}
+
+// ChangeEvent 用户数据变更通知，在写入所在的事务提交后发布，同一事务内的写入合并为一条
+type ChangeEvent struct {
+	UserID      int             `json:"user_id"`
+	SyncVersion int64           `json:"sync_version"` // 事务内分配的最大同步版本号
+	Entities    []ChangedEntity `json:"entities"`
+	Truncated   bool            `json:"truncated,omitempty"` // 变更过多未全部列出，客户端需增量同步
+}
+
+// ChangeFeed 数据变更订阅接口
+type ChangeFeed interface {
+	// SubscribeChanges 订阅用户的数据变更通知，返回的函数用于取消订阅
+	SubscribeChanges(userID int) (<-chan ChangeEvent, func())
+}
+
+// changeSubscriberBuffer 每个订阅者缓冲的通知数量，缓冲区满时丢弃最旧的通知
+const changeSubscriberBuffer = 16
+
+// ChangeHub 进程内的变更通知分发
+type ChangeHub struct {
+	mu          sync.Mutex
+	subscribers map[int]map[chan ChangeEvent]struct{}
+}
+
+// NewChangeHub 创建变更通知分发器
+func NewChangeHub() *ChangeHub {
+	return &ChangeHub{subscribers: make(map[int]map[chan ChangeEvent]struct{})}
+}
+
+// Subscribe 订阅用户的数据变更通知
+func (h *ChangeHub) Subscribe(userID int) (<-chan ChangeEvent, func()) {
+	ch := make(chan ChangeEvent, changeSubscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan ChangeEvent]struct{})
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.subscribers[userID], ch)
+			if len(h.subscribers[userID]) == 0 {
+				delete(h.subscribers, userID)
+			}
+		})
+	}
+}
+
+// Publish 将通知发送给该用户的全部订阅者，不会阻塞
+func (h *ChangeHub) Publish(event ChangeEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[event.UserID] {
+		select {
+		case ch <- event:
+			continue
+		default:
+		}
+		// 订阅者处理不过来时丢弃最旧的通知，最新的同步版本号总能送达
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// changeRecord 事务中的一次写入
+type changeRecord struct {
+	userID      int
+	syncVersion int64
+	entity      ChangedEntity
+}
+
+// changeLog 事务中累积的写入，提交后按用户合并为通知；保存点回滚时截断到保存点之前的长度
+type changeLog []changeRecord
+
+// events 按用户合并写入记录，同一数据只列出一次
+func (l changeLog) events() []ChangeEvent {
+	var events []ChangeEvent
+	index := make(map[int]int)
+	type entityKey struct {
+		userID int
+		typ    string
+		id     int
+	}
+	seen := make(map[entityKey]bool)
+	for _, record := range l {
+		i, ok := index[record.userID]
+		if !ok {
+			i = len(events)
+			index[record.userID] = i
+			events = append(events, ChangeEvent{UserID: record.userID, Entities: []ChangedEntity{}})
+		}
+		event := &events[i]
+		event.SyncVersion = max(event.SyncVersion, record.syncVersion)
+
+		key := entityKey{record.userID, record.entity.Type, record.entity.ID}
+		if !seen[key] {
+			seen[key] = true
+			event.Entities = append(event.Entities, record.entity)
+		}
+	}
+	return events
+}
+
+// ===== PostgreSQL LISTEN/NOTIFY =====
+
+const (
+	// changeChannel 发布变更通知的PostgreSQL频道
+	changeChannel = "sync_changes"
+	// maxNotifyPayload NOTIFY负载上限为8000字节，超出时不列出变更的数据
+	maxNotifyPayload = 7900
+)
+
+// notifyPayload 将通知编码为NOTIFY负载
+func notifyPayload(event ChangeEvent) (string, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxNotifyPayload {
+		event.Entities = []ChangedEntity{}
+		event.Truncated = true
+		if data, err = json.Marshal(event); err != nil {
+			return "", err
+		}
+	}
+	return string(data), nil
+}
+
+// ListenChanges 监听PostgreSQL变更频道，之后的写入通过 NOTIFY 在提交时广播，
+// 所有服务实例（包括本实例）收到后再分发给各自的订阅者
+func (s *SQLStore) ListenChanges(dsn string) error {
+	if s.db.dialect.name != DriverPostgres {
+		return fmt.Errorf("%w: LISTEN requires postgres", ErrNoStore)
+	}
+
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("change listener: %v", err)
+		}
+	})
+	if err := listener.Listen(changeChannel); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to listen on %s: %v", changeChannel, err)
+	}
+
+	go func() {
+		for notification := range listener.Notify {
+			// 重新连接后会收到nil，断线期间的通知已丢失，客户端重连后依靠增量同步补齐
+			if notification == nil {
+				continue
+			}
+			var event ChangeEvent
+			if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+				log.Printf("change listener: invalid payload: %v", err)
+				continue
+			}
+			s.db.hub.Publish(event)
+		}
+	}()
+
+	s.listener = listener
+	s.db.notifyChannel = changeChannel
+	return nil
+}
@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidChecklistOrder 重新排序时提交的检查项与TODO当前的检查项不一致
+var ErrInvalidChecklistOrder = errors.New("checklist order must list every item of the todo exactly once")
+
+// ReorderChecklistItems 按 itemIDs 的顺序重新排列TODO的检查项，itemIDs 必须恰好包含该TODO全部未删除的检查项。
+// 只有位置发生变化的检查项会被写入，调用方应在事务中调用
+func ReorderChecklistItems(r ChecklistStore, todoID, userID int, itemIDs []int) ([]ChecklistItem, error) {
+	items, err := r.GetChecklistItemsByTodoID(todoID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(itemIDs) != len(items) {
+		return nil, ErrInvalidChecklistOrder
+	}
+
+	byID := make(map[int]*ChecklistItem, len(items))
+	for i := range items {
+		byID[items[i].ID] = &items[i]
+	}
+	ordered := make([]ChecklistItem, 0, len(items))
+	for i, id := range itemIDs {
+		item, ok := byID[id]
+		if !ok {
+			return nil, ErrInvalidChecklistOrder
+		}
+		delete(byID, id)
+
+		if item.Position != i+1 {
+			item.Position = i + 1
+			if err := r.UpdateChecklistItem(item); err != nil {
+				return nil, err
+			}
+		}
+		ordered = append(ordered, *item)
+	}
+	return ordered, nil
+}
+
+// copyChecklistItems 将TODO未删除的检查项复制到另一个TODO，复制出的检查项均为未完成
+func copyChecklistItems(r ChecklistStore, from, to *Todo) error {
+	items, err := r.GetChecklistItemsByTodoID(from.ID, from.UserID)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		cp := &ChecklistItem{TodoID: to.ID, UserID: to.UserID, Title: item.Title, Position: item.Position}
+		if err := r.CreateChecklistItem(cp); err != nil {
+			return err
+		}
+	}
+	to.ChecklistTotal = len(items)
+	to.ChecklistCompleted = 0
+	return nil
+}
+
+// ChecklistRepository 检查项数据访问层
+type ChecklistRepository struct {
+	db *sqlDB
+}
+
+// checklistColumns 查询检查项时选择的列，与 scanChecklistItem 的扫描顺序一致；todo_uuid 取自所属的TODO
+const checklistColumns = `id, uuid, todo_id, (SELECT t.uuid FROM todos t WHERE t.id = todo_checklist_items.todo_id),
+			user_id, title, completed, position, created_at, updated_at, is_deleted, sync_version`
+
+// scanChecklistItem 扫描单行检查项数据
+func scanChecklistItem(scanner interface{ Scan(dest ...any) error }) (*ChecklistItem, error) {
+	var item ChecklistItem
+	err := scanner.Scan(&item.ID, &item.UUID, &item.TodoID, &item.TodoUUID, &item.UserID, &item.Title,
+		&item.Completed, &item.Position, &item.CreatedAt, &item.UpdatedAt, &item.IsDeleted, &item.SyncVersion)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &item, nil
+}
+
+// queryChecklistItems 执行查询并扫描多行检查项
+func (r *ChecklistRepository) queryChecklistItems(query string, args ...any) ([]ChecklistItem, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []ChecklistItem
+	for rows.Next() {
+		item, err := scanChecklistItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+
+	return items, rows.Err()
+}
+
+// CreateChecklistItem 创建检查项，Position 为0时排在该TODO现有检查项之后
+func (r *ChecklistRepository) CreateChecklistItem(item *ChecklistItem) error {
+	query := `
+		INSERT INTO todo_checklist_items (uuid, todo_id, user_id, title, completed, position,
+			created_at, updated_at, is_deleted, sync_version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`
+
+	if item.UUID == "" {
+		item.UUID = uuid.NewString()
+	}
+	now := time.Now()
+	return translateError(r.db.withTx(func(tx *sqlDB) error {
+		err := tx.QueryRow("SELECT uuid FROM todos WHERE id = $1 AND user_id = $2", item.TodoID, item.UserID).Scan(&item.TodoUUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("todo not found or not owned by user: %w", ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		if item.Position == 0 {
+			if err := tx.QueryRow(`
+				SELECT COALESCE(MAX(position), 0) + 1 FROM todo_checklist_items
+				WHERE todo_id = $1 AND is_deleted = FALSE`, item.TodoID).Scan(&item.Position); err != nil {
+				return err
+			}
+		}
+
+		syncVersion, err := tx.nextSyncVersion(item.UserID)
+		if err != nil {
+			return err
+		}
+		if err := tx.QueryRow(query, item.UUID, item.TodoID, item.UserID, item.Title, item.Completed, item.Position,
+			now, now, item.IsDeleted, syncVersion).Scan(&item.ID); err != nil {
+			return err
+		}
+		item.CreatedAt = now
+		item.UpdatedAt = now
+		item.SyncVersion = syncVersion
+		tx.recordChange(item.UserID, syncVersion, ChangedEntity{Type: SyncTypeChecklistItem, ID: item.ID, UUID: item.UUID})
+		return nil
+	}))
+}
+
+// GetChecklistItemsByTodoID 获取TODO未删除的检查项，按位置排序
+func (r *ChecklistRepository) GetChecklistItemsByTodoID(todoID, userID int) ([]ChecklistItem, error) {
+	query := `
+		SELECT ` + checklistColumns + `
+		FROM todo_checklist_items
+		WHERE todo_id = $1 AND user_id = $2 AND is_deleted = FALSE
+		ORDER BY position ASC, id ASC`
+
+	return r.queryChecklistItems(query, todoID, userID)
+}
+
+// GetChecklistItemByID 根据ID获取单个未删除的检查项
+func (r *ChecklistRepository) GetChecklistItemByID(itemID, userID int) (*ChecklistItem, error) {
+	query := `
+		SELECT ` + checklistColumns + `
+		FROM todo_checklist_items
+		WHERE id = $1 AND user_id = $2 AND is_deleted = FALSE`
+
+	return scanChecklistItem(r.db.QueryRow(query, itemID, userID))
+}
+
+// GetChecklistItemByUUID 根据客户端UUID获取单个检查项（包含已删除的检查项）
+func (r *ChecklistRepository) GetChecklistItemByUUID(userID int, uuid string) (*ChecklistItem, error) {
+	query := `
+		SELECT ` + checklistColumns + `
+		FROM todo_checklist_items
+		WHERE user_id = $1 AND uuid = $2`
+
+	return scanChecklistItem(r.db.QueryRow(query, userID, uuid))
+}
+
+// UpdateChecklistItem 更新检查项的标题、完成状态和位置，检查项不能移动到其他TODO
+func (r *ChecklistRepository) UpdateChecklistItem(item *ChecklistItem) error {
+	query := `
+		UPDATE todo_checklist_items
+		SET title = $1, completed = $2, position = $3, updated_at = $4, sync_version = $5
+		WHERE id = $6 AND user_id = $7 AND is_deleted = FALSE
+		RETURNING uuid, todo_id`
+
+	now := time.Now()
+	return translateError(r.db.withTx(func(tx *sqlDB) error {
+		syncVersion, err := tx.nextSyncVersion(item.UserID)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRow(query, item.Title, item.Completed, item.Position, now, syncVersion,
+			item.ID, item.UserID).Scan(&item.UUID, &item.TodoID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("checklist item not found or not owned by user: %w", ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		item.UpdatedAt = now
+		item.SyncVersion = syncVersion
+		tx.recordChange(item.UserID, syncVersion, ChangedEntity{Type: SyncTypeChecklistItem, ID: item.ID, UUID: item.UUID})
+		return nil
+	}))
+}
+
+// DeleteChecklistItem 删除检查项（软删除）
+func (r *ChecklistRepository) DeleteChecklistItem(itemID, userID int) error {
+	query := `
+		UPDATE todo_checklist_items
+		SET is_deleted = TRUE, updated_at = $1, sync_version = $2
+		WHERE id = $3 AND user_id = $4 AND is_deleted = FALSE
+		RETURNING uuid`
+
+	now := time.Now()
+	return r.db.withTx(func(tx *sqlDB) error {
+		syncVersion, err := tx.nextSyncVersion(userID)
+		if err != nil {
+			return err
+		}
+		var itemUUID string
+		err = tx.QueryRow(query, now, syncVersion, itemID, userID).Scan(&itemUUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("checklist item not found or not owned by user: %w", ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		tx.recordChange(userID, syncVersion, ChangedEntity{Type: SyncTypeChecklistItem, ID: itemID, UUID: itemUUID})
+		return nil
+	})
+}
+
+// GetChecklistItemsSince 按版本号顺序获取同步版本号在 (since, until] 区间内的检查项（用于增量同步），limit < 0 表示不限制数量
+func (r *ChecklistRepository) GetChecklistItemsSince(userID int, since, until int64, limit int) ([]ChecklistItem, error) {
+	query := `
+		SELECT ` + checklistColumns + `
+		FROM todo_checklist_items
+		WHERE user_id = $1 AND sync_version > $2 AND sync_version <= $3
+		ORDER BY sync_version ASC` + limitClause(limit)
+
+	return r.queryChecklistItems(query, userID, since, until)
+}
@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	_ "github.com/lib/pq"
 )
 
-// DatabaseConfig PostgreSQL数据库配置
+// DatabaseConfig 数据库配置
 type DatabaseConfig struct {
+	Driver   string // 存储驱动：postgres/sqlite/memory
+	Path     string // SQLite数据库文件路径
 	Host     string
 	Port     int
 	User     string
@@ -19,9 +22,11 @@ type DatabaseConfig struct {
 	SSLMode  string
 }
 
-// GetDatabaseConfig 从环境变量获取PostgreSQL数据库配置
+// GetDatabaseConfig 从环境变量获取数据库配置
 func GetDatabaseConfig() *DatabaseConfig {
 	config := &DatabaseConfig{
+		Driver:   getEnv("DB_DRIVER", DriverPostgres),
+		Path:     getEnv("DB_PATH", "db/todo.db"),
 		Host:     getEnv("DB_HOST", "localhost"),
 		Port:     getEnvInt("DB_PORT", 5432),
 		User:     getEnv("DB_USER", "postgres"),
@@ -33,12 +38,29 @@ func GetDatabaseConfig() *DatabaseConfig {
 	return config
 }
 
+// TrashConfig 回收站清理配置
+type TrashConfig struct {
+	Retention     time.Duration // 已删除数据至少保留的时间，不大于0时不自动清理
+	PurgeInterval time.Duration // 清理间隔
+}
+
+// GetTrashConfig 从环境变量获取回收站清理配置
+func GetTrashConfig() *TrashConfig {
+	return &TrashConfig{
+		Retention:     time.Duration(getEnvInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour,
+		PurgeInterval: time.Duration(getEnvInt("TRASH_PURGE_INTERVAL_MINUTES", 60)) * time.Minute,
+	}
+}
+
+// DSN 返回PostgreSQL连接字符串
+func (c *DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		c.Host, c.Port, c.User, c.Password, c.DBName, c.SSLMode)
+}
+
 // ConnectDatabase 连接PostgreSQL数据库
 func ConnectDatabase(config *DatabaseConfig) (*sql.DB, error) {
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		config.Host, config.Port, config.User, config.Password, config.DBName, config.SSLMode)
-
-	db, err := sql.Open("postgres", dsn)
+	db, err := sql.Open("postgres", config.DSN())
 	if err != nil {
 		return nil, fmt.Errorf("failed to open PostgreSQL database: %v", err)
 	}
@@ -3,46 +3,127 @@ package repository
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
-	"todo-service/global"
+
+	"github.com/google/uuid"
 )
 
+// UserRepository 用户数据访问层
+type UserRepository struct {
+	db *sqlDB
+}
+
+// CreateUser 创建用户，user.Password 应为已加密的密码
+func (r *UserRepository) CreateUser(user *User) error {
+	query := `
+		INSERT INTO users (username, email, password, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`
+
+	now := time.Now()
+	err := r.db.QueryRow(query, user.Username, user.Email, user.Password, now, now).Scan(&user.ID)
+	if err != nil {
+		return translateError(err)
+	}
+
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	return nil
+}
+
+// GetUserByUsername 根据用户名获取用户（包含加密后的密码）
+func (r *UserRepository) GetUserByUsername(username string) (*User, error) {
+	query := `
+		SELECT id, username, email, password, created_at, updated_at
+		FROM users
+		WHERE username = $1`
+
+	var user User
+	err := r.db.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.Email,
+		&user.Password, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &user, nil
+}
+
+// GetUserByID 根据ID获取用户
+func (r *UserRepository) GetUserByID(userID int) (*User, error) {
+	query := `
+		SELECT id, username, email, password, created_at, updated_at
+		FROM users
+		WHERE id = $1`
+
+	var user User
+	err := r.db.QueryRow(query, userID).Scan(&user.ID, &user.Username, &user.Email,
+		&user.Password, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &user, nil
+}
+
 // CategoryRepository 分类数据访问层
 type CategoryRepository struct {
-	db *sql.DB
+	db *sqlDB
 }
 
-// NewCategoryRepository 创建分类仓库实例
-func NewCategoryRepository() *CategoryRepository {
-	return &CategoryRepository{db: global.Db}
+// categoryColumns 查询分类时选择的列，与 scanCategory 的扫描顺序一致
+const categoryColumns = `id, uuid, user_id, name, color, icon, created_at, updated_at, is_deleted, sync_version`
+
+// scanCategory 扫描单行分类数据
+func scanCategory(scanner interface{ Scan(dest ...any) error }) (*Category, error) {
+	var category Category
+	err := scanner.Scan(&category.ID, &category.UUID, &category.UserID, &category.Name, &category.Color,
+		&category.Icon, &category.CreatedAt, &category.UpdatedAt, &category.IsDeleted, &category.SyncVersion)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &category, nil
 }
 
 // CreateCategory 创建分类
 func (r *CategoryRepository) CreateCategory(category *Category) error {
 	query := `
-		INSERT INTO categories (user_id, name, color, icon, created_at, updated_at, sync_version)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO categories (uuid, user_id, name, color, icon, created_at, updated_at, sync_version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id`
 
+	if category.UUID == "" {
+		category.UUID = uuid.NewString()
+	}
 	now := time.Now()
-	syncVersion := now.UnixMilli()
-	err := r.db.QueryRow(query, category.UserID, category.Name, category.Color,
-		category.Icon, now, now, syncVersion).Scan(&category.ID)
+	err := r.db.withTx(func(tx *sqlDB) error {
+		syncVersion, err := tx.nextSyncVersion(category.UserID)
+		if err != nil {
+			return err
+		}
+		if err := tx.QueryRow(query, category.UUID, category.UserID, category.Name, category.Color,
+			category.Icon, now, now, syncVersion).Scan(&category.ID); err != nil {
+			return err
+		}
+		category.SyncVersion = syncVersion
+		tx.recordChange(category.UserID, syncVersion, ChangedEntity{Type: SyncTypeCategory, ID: category.ID, UUID: category.UUID})
+		return saveCategoryRevision(tx, nil, category)
+	})
 
 	if err == nil {
 		category.CreatedAt = now
 		category.UpdatedAt = now
-		category.SyncVersion = syncVersion
 	}
 
-	return err
+	return translateError(err)
 }
 
 // GetCategoriesByUserID 根据用户ID获取分类列表
 func (r *CategoryRepository) GetCategoriesByUserID(userID int) ([]Category, error) {
 	query := `
-		SELECT id, user_id, name, color, icon, created_at, updated_at, is_deleted, sync_version
+		SELECT ` + categoryColumns + `
 		FROM categories 
 		WHERE user_id = $1 AND is_deleted = FALSE
 		ORDER BY created_at ASC`
@@ -55,13 +136,11 @@ func (r *CategoryRepository) GetCategoriesByUserID(userID int) ([]Category, erro
 
 	var categories []Category
 	for rows.Next() {
-		var category Category
-		err := rows.Scan(&category.ID, &category.UserID, &category.Name, &category.Color,
-			&category.Icon, &category.CreatedAt, &category.UpdatedAt, &category.IsDeleted, &category.SyncVersion)
+		category, err := scanCategory(rows)
 		if err != nil {
 			return nil, err
 		}
-		categories = append(categories, category)
+		categories = append(categories, *category)
 	}
 
 	return categories, rows.Err()
@@ -72,23 +151,50 @@ func (r *CategoryRepository) UpdateCategory(category *Category) error {
 	query := `
 		UPDATE categories 
 		SET name = $1, color = $2, icon = $3, updated_at = $4, sync_version = $5
-		WHERE id = $6 AND user_id = $7`
+		WHERE id = $6 AND user_id = $7
+		RETURNING uuid`
 
 	now := time.Now()
-	syncVersion := now.UnixMilli()
-	result, err := r.db.Exec(query, category.Name, category.Color, category.Icon,
-		now, syncVersion, category.ID, category.UserID)
-
-	if err == nil {
-		rowsAffected, _ := result.RowsAffected()
-		if rowsAffected == 0 {
-			return fmt.Errorf("category not found or not owned by user")
+	return translateError(r.db.withTx(func(tx *sqlDB) error {
+		previous, err := lockCategory(tx, category.ID, category.UserID)
+		if err != nil {
+			return err
+		}
+		syncVersion, err := tx.nextSyncVersion(category.UserID)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRow(query, category.Name, category.Color, category.Icon,
+			now, syncVersion, category.ID, category.UserID).Scan(&category.UUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("category not found or not owned by user: %w", ErrNotFound)
+		}
+		if err != nil {
+			return err
 		}
 		category.UpdatedAt = now
 		category.SyncVersion = syncVersion
-	}
+		tx.recordChange(category.UserID, syncVersion, ChangedEntity{Type: SyncTypeCategory, ID: category.ID, UUID: category.UUID})
+
+		current := *previous
+		current.Name = category.Name
+		current.Color = category.Color
+		current.Icon = category.Icon
+		current.SyncVersion = syncVersion
+		return saveCategoryRevision(tx, previous, &current)
+	}))
+}
 
-	return err
+// lockCategory 在事务中读取写入前的分类，用于记录修改历史
+func lockCategory(tx *sqlDB, id, userID int) (*Category, error) {
+	category, err := scanCategory(tx.QueryRow(`
+		SELECT `+categoryColumns+`
+		FROM categories
+		WHERE id = $1 AND user_id = $2`, id, userID))
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("category not found or not owned by user: %w", ErrNotFound)
+	}
+	return category, err
 }
 
 // DeleteCategory 删除分类（软删除）
@@ -96,41 +202,64 @@ func (r *CategoryRepository) DeleteCategory(id, userID int) error {
 	query := `
 		UPDATE categories 
 		SET is_deleted = TRUE, updated_at = $1, sync_version = $2
-		WHERE id = $3 AND user_id = $4`
+		WHERE id = $3 AND user_id = $4
+		RETURNING uuid`
 
 	now := time.Now()
-	syncVersion := now.UnixMilli()
-	result, err := r.db.Exec(query, now, syncVersion, id, userID)
-	if err == nil {
-		rowsAffected, _ := result.RowsAffected()
-		if rowsAffected == 0 {
-			return fmt.Errorf("category not found or not owned by user")
+	return r.db.withTx(func(tx *sqlDB) error {
+		previous, err := lockCategory(tx, id, userID)
+		if err != nil {
+			return err
 		}
-	}
-	return err
+		syncVersion, err := tx.nextSyncVersion(userID)
+		if err != nil {
+			return err
+		}
+		var categoryUUID string
+		err = tx.QueryRow(query, now, syncVersion, id, userID).Scan(&categoryUUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("category not found or not owned by user: %w", ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		tx.recordChange(userID, syncVersion, ChangedEntity{Type: SyncTypeCategory, ID: id, UUID: categoryUUID})
+
+		current := *previous
+		current.IsDeleted = true
+		current.SyncVersion = syncVersion
+		return saveCategoryRevision(tx, previous, &current)
+	})
 }
 
 // UserSettingsRepository 用户设置数据访问层
 type UserSettingsRepository struct {
-	db *sql.DB
+	db *sqlDB
 }
 
-// NewUserSettingsRepository 创建用户设置仓库实例
-func NewUserSettingsRepository() *UserSettingsRepository {
-	return &UserSettingsRepository{db: global.Db}
+// defaultUserSettings 用户没有保存过设置时使用的默认设置
+func defaultUserSettings(userID int) *UserSettings {
+	return &UserSettings{
+		UserID:           userID,
+		Theme:            "light",
+		NotificationTime: "09:00:00",
+		Language:         "zh-CN",
+		TimeZone:         "Asia/Shanghai",
+		DailyDigest:      true,
+	}
 }
 
 // GetUserSettings 获取用户设置
 func (r *UserSettingsRepository) GetUserSettings(userID int) (*UserSettings, error) {
 	query := `
-		SELECT user_id, theme, notification_time, language, timezone, created_at, updated_at, sync_version
+		SELECT user_id, theme, notification_time, language, timezone, daily_digest, created_at, updated_at, sync_version
 		FROM user_settings 
 		WHERE user_id = $1`
 
 	var settings UserSettings
 	err := r.db.QueryRow(query, userID).Scan(
 		&settings.UserID, &settings.Theme, &settings.NotificationTime,
-		&settings.Language, &settings.TimeZone, &settings.CreatedAt, &settings.UpdatedAt, &settings.SyncVersion)
+		&settings.Language, &settings.TimeZone, &settings.DailyDigest, &settings.CreatedAt, &settings.UpdatedAt, &settings.SyncVersion)
 
 	if err == sql.ErrNoRows {
 		// 如果没有设置，创建默认设置
@@ -143,24 +272,27 @@ func (r *UserSettingsRepository) GetUserSettings(userID int) (*UserSettings, err
 // CreateDefaultUserSettings 创建默认用户设置
 func (r *UserSettingsRepository) CreateDefaultUserSettings(userID int) (*UserSettings, error) {
 	now := time.Now()
-	syncVersion := now.UnixMilli()
-	settings := &UserSettings{
-		UserID:           userID,
-		Theme:            "light",
-		NotificationTime: "09:00:00",
-		Language:         "zh-CN",
-		TimeZone:         "Asia/Shanghai",
-		CreatedAt:        now,
-		UpdatedAt:        now,
-		SyncVersion:      syncVersion,
-	}
+	settings := defaultUserSettings(userID)
+	settings.CreatedAt = now
+	settings.UpdatedAt = now
 
 	query := `
-		INSERT INTO user_settings (user_id, theme, notification_time, language, timezone, created_at, updated_at, sync_version)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+		INSERT INTO user_settings (user_id, theme, notification_time, language, timezone, daily_digest, created_at, updated_at, sync_version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
 
-	_, err := r.db.Exec(query, settings.UserID, settings.Theme, settings.NotificationTime,
-		settings.Language, settings.TimeZone, settings.CreatedAt, settings.UpdatedAt, settings.SyncVersion)
+	err := r.db.withTx(func(tx *sqlDB) error {
+		syncVersion, err := tx.nextSyncVersion(userID)
+		if err != nil {
+			return err
+		}
+		settings.SyncVersion = syncVersion
+		if _, err := tx.Exec(query, settings.UserID, settings.Theme, settings.NotificationTime,
+			settings.Language, settings.TimeZone, settings.DailyDigest, settings.CreatedAt, settings.UpdatedAt, settings.SyncVersion); err != nil {
+			return err
+		}
+		tx.recordChange(userID, syncVersion, ChangedEntity{Type: SyncTypeSettings})
+		return nil
+	})
 
 	return settings, err
 }
@@ -169,26 +301,73 @@ func (r *UserSettingsRepository) CreateDefaultUserSettings(userID int) (*UserSet
 func (r *UserSettingsRepository) UpdateUserSettings(settings *UserSettings) error {
 	query := `
 		UPDATE user_settings 
-		SET theme = $1, notification_time = $2, language = $3, timezone = $4, updated_at = $5, sync_version = $6
-		WHERE user_id = $7`
+		SET theme = $1, notification_time = $2, language = $3, timezone = $4, daily_digest = $5, updated_at = $6, sync_version = $7
+		WHERE user_id = $8`
 
 	now := time.Now()
-	syncVersion := now.UnixMilli()
-	settings.UpdatedAt = now
-	settings.SyncVersion = syncVersion
-	_, err := r.db.Exec(query, settings.Theme, settings.NotificationTime, settings.Language,
-		settings.TimeZone, settings.UpdatedAt, settings.SyncVersion, settings.UserID)
-	return err
+	return r.db.withTx(func(tx *sqlDB) error {
+		syncVersion, err := tx.nextSyncVersion(settings.UserID)
+		if err != nil {
+			return err
+		}
+		settings.UpdatedAt = now
+		settings.SyncVersion = syncVersion
+		result, err := tx.Exec(query, settings.Theme, settings.NotificationTime, settings.Language,
+			settings.TimeZone, settings.DailyDigest, settings.UpdatedAt, settings.SyncVersion, settings.UserID)
+		if err != nil {
+			return err
+		}
+		tx.recordChange(settings.UserID, syncVersion, ChangedEntity{Type: SyncTypeSettings})
+		// 设置不存在时没有写入任何数据，不发出事件
+		if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+			return err
+		}
+		return emitWebhookEvent(tx, settingsEvent(settings), func() (any, error) { return settings, nil })
+	})
 }
 
 // ExtendedTodoRepository 扩展的TODO数据访问层
 type ExtendedTodoRepository struct {
-	db *sql.DB
+	db *sqlDB
+}
+
+// todoColumns 查询TODO时选择的列，与 scanTodo 的扫描顺序一致；category_uuid 取自关联的分类，
+// 检查项数量由未删除的检查项统计得到
+const todoColumns = `id, uuid, user_id, title, description, completed, priority, due_date, tags,
+			category_id, (SELECT c.uuid FROM categories c WHERE c.id = todos.category_id), reminder, recurrence,
+			created_at, updated_at, is_deleted, sync_version,
+			(SELECT COUNT(*) FROM todo_checklist_items i WHERE i.todo_id = todos.id AND i.is_deleted = FALSE),
+			(SELECT COUNT(*) FROM todo_checklist_items i WHERE i.todo_id = todos.id AND i.is_deleted = FALSE AND i.completed = TRUE)`
+
+// scanWith 在扫描时追加额外的目标，用于读取 todoColumns 之外的查询列
+type scanWith struct {
+	scanner interface{ Scan(dest ...any) error }
+	extra   []any
 }
 
-// NewExtendedTodoRepository 创建扩展TODO仓库实例
-func NewExtendedTodoRepository() *ExtendedTodoRepository {
-	return &ExtendedTodoRepository{db: global.Db}
+func (s scanWith) Scan(dest ...any) error {
+	return s.scanner.Scan(append(dest, s.extra...)...)
+}
+
+// scanTodo 扫描单行TODO数据
+func scanTodo(scanner interface{ Scan(dest ...any) error }) (*Todo, error) {
+	var todo Todo
+	var tagsJSON []byte
+	err := scanner.Scan(&todo.ID, &todo.UUID, &todo.UserID, &todo.Title, &todo.Description, &todo.Completed,
+		&todo.Priority, &todo.DueDate, &tagsJSON, &todo.CategoryID, &todo.CategoryUUID, &todo.Reminder, &todo.Recurrence,
+		&todo.CreatedAt, &todo.UpdatedAt, &todo.IsDeleted, &todo.SyncVersion, &todo.ChecklistTotal, &todo.ChecklistCompleted)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	// 反序列化标签，解析失败时设置为空切片
+	todo.Tags = StringSlice{}
+	if len(tagsJSON) > 0 {
+		if err := json.Unmarshal(tagsJSON, &todo.Tags); err != nil {
+			todo.Tags = StringSlice{}
+		}
+	}
+	return &todo, nil
 }
 
 // CreateTodoExtended 创建扩展TODO
@@ -200,23 +379,37 @@ func (r *ExtendedTodoRepository) CreateTodoExtended(todo *Todo) error {
 	}
 
 	query := `
-		INSERT INTO todos (user_id, title, description, completed, priority, due_date, tags, 
-			category_id, reminder, created_at, updated_at, is_deleted, sync_version)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		INSERT INTO todos (uuid, user_id, title, description, completed, priority, due_date, tags, 
+			category_id, reminder, recurrence, created_at, updated_at, is_deleted, sync_version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 		RETURNING id`
 
+	if todo.UUID == "" {
+		todo.UUID = uuid.NewString()
+	}
 	now := time.Now()
-	syncVersion := now.UnixMilli()
-
-	err = r.db.QueryRow(query, todo.UserID, todo.Title, todo.Description, todo.Completed,
-		todo.Priority, todo.DueDate, tagsJSON, todo.CategoryID, todo.Reminder,
-		now, now, todo.IsDeleted, syncVersion).Scan(&todo.ID)
-
-	if err == nil {
+	err = r.db.withTx(func(tx *sqlDB) error {
+		syncVersion, err := tx.nextSyncVersion(todo.UserID)
+		if err != nil {
+			return err
+		}
+		if err := tx.QueryRow(query, todo.UUID, todo.UserID, todo.Title, todo.Description, todo.Completed,
+			todo.Priority, todo.DueDate, string(tagsJSON), todo.CategoryID, todo.Reminder, todo.Recurrence,
+			now, now, todo.IsDeleted, syncVersion).Scan(&todo.ID); err != nil {
+			return translateError(err)
+		}
 		todo.CreatedAt = now
 		todo.UpdatedAt = now
 		todo.SyncVersion = syncVersion
-	}
+		tx.recordChange(todo.UserID, syncVersion, ChangedEntity{Type: SyncTypeTodo, ID: todo.ID, UUID: todo.UUID})
+		if err := indexTodoSearch(tx, todo); err != nil {
+			return err
+		}
+		if err := saveTodoRevision(tx, nil, todo); err != nil {
+			return err
+		}
+		return saveTodoSnapshot(tx, todo)
+	})
 
 	return err
 }
@@ -224,8 +417,7 @@ func (r *ExtendedTodoRepository) CreateTodoExtended(todo *Todo) error {
 // GetTodosByUserIDExtended 根据用户ID获取扩展TODO列表
 func (r *ExtendedTodoRepository) GetTodosByUserIDExtended(userID int, limit, offset int) ([]Todo, error) {
 	query := `
-		SELECT id, user_id, title, description, completed, priority, due_date, tags,
-			category_id, reminder, created_at, updated_at, is_deleted, sync_version
+		SELECT ` + todoColumns + `
 		FROM todos 
 		WHERE user_id = $1 AND is_deleted = FALSE
 		ORDER BY created_at DESC
@@ -239,31 +431,76 @@ func (r *ExtendedTodoRepository) GetTodosByUserIDExtended(userID int, limit, off
 
 	var todos []Todo
 	for rows.Next() {
-		var todo Todo
-		var tagsJSON []byte
-
-		err := rows.Scan(&todo.ID, &todo.UserID, &todo.Title, &todo.Description, &todo.Completed,
-			&todo.Priority, &todo.DueDate, &tagsJSON, &todo.CategoryID, &todo.Reminder,
-			&todo.CreatedAt, &todo.UpdatedAt, &todo.IsDeleted, &todo.SyncVersion)
+		todo, err := scanTodo(rows)
 		if err != nil {
 			return nil, err
 		}
+		todos = append(todos, *todo)
+	}
 
-		// 反序列化标签
-		if len(tagsJSON) > 0 {
-			if err := json.Unmarshal(tagsJSON, &todo.Tags); err != nil {
-				todo.Tags = StringSlice{} // 如果解析失败，设置为空切片
-			}
-		} else {
-			todo.Tags = StringSlice{}
-		}
+	return todos, rows.Err()
+}
+
+// deletedCondition 按 Deleted 选择未删除或已删除的TODO
+func deletedCondition(f *TodoFilter) string {
+	if f.Deleted {
+		return "is_deleted = TRUE"
+	}
+	return "is_deleted = FALSE"
+}
+
+// ListTodos 按筛选条件和排序获取TODO列表
+func (r *ExtendedTodoRepository) ListTodos(userID int, query TodoQuery) ([]Todo, error) {
+	sorts, err := query.sorts()
+	if err != nil {
+		return nil, err
+	}
+
+	args := sqlArgs{userID}
+	conditions := append([]string{"user_id = $1", deletedCondition(&query.Filter)},
+		todoFilterConditions(r.db.dialect, &query.Filter, &args)...)
+	rank := todoSearchRank(r.db.dialect, &query.Filter, &args)
+	if query.After != nil {
+		conditions = append(conditions, todoKeysetCondition(sorts, query.After, rank, &args))
+	}
+	statement := `
+		SELECT ` + todoColumns + `, ` + rank + `
+		FROM todos
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY ` + todoOrderBy(sorts, rank) + `
+		LIMIT ` + args.add(query.Limit) + ` OFFSET ` + args.add(query.Offset)
+
+	rows, err := r.db.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-		todos = append(todos, todo)
+	var todos []Todo
+	for rows.Next() {
+		var searchRank float64
+		todo, err := scanTodo(scanWith{rows, []any{&searchRank}})
+		if err != nil {
+			return nil, err
+		}
+		todo.SearchRank = searchRank
+		todos = append(todos, *todo)
 	}
 
 	return todos, rows.Err()
 }
 
+// CountTodos 统计满足筛选条件的TODO数量
+func (r *ExtendedTodoRepository) CountTodos(userID int, filter TodoFilter) (int, error) {
+	args := sqlArgs{userID}
+	conditions := append([]string{"user_id = $1", deletedCondition(&filter)},
+		todoFilterConditions(r.db.dialect, &filter, &args)...)
+
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM todos WHERE "+strings.Join(conditions, " AND "), args...).Scan(&count)
+	return count, err
+}
+
 // UpdateTodoExtended 更新扩展TODO
 func (r *ExtendedTodoRepository) UpdateTodoExtended(todo *Todo) error {
 	// 序列化标签
@@ -275,83 +512,124 @@ func (r *ExtendedTodoRepository) UpdateTodoExtended(todo *Todo) error {
 	query := `
 		UPDATE todos 
 		SET title = $1, description = $2, completed = $3, priority = $4, due_date = $5, tags = $6,
-			category_id = $7, reminder = $8, updated_at = $9, sync_version = $10
-		WHERE id = $11 AND user_id = $12`
+			category_id = $7, reminder = $8, recurrence = $9, is_deleted = $10, updated_at = $11, sync_version = $12
+		WHERE id = $13 AND user_id = $14
+		RETURNING uuid`
 
 	now := time.Now()
-	syncVersion := now.UnixMilli()
-
-	result, err := r.db.Exec(query, todo.Title, todo.Description, todo.Completed, todo.Priority,
-		todo.DueDate, tagsJSON, todo.CategoryID, todo.Reminder,
-		now, syncVersion, todo.ID, todo.UserID)
-
-	if err == nil {
-		rowsAffected, _ := result.RowsAffected()
-		if rowsAffected == 0 {
-			return fmt.Errorf("todo not found or not owned by user")
+	return r.db.withTx(func(tx *sqlDB) error {
+		previous, err := lockTodo(tx, todo.ID, todo.UserID)
+		if err != nil {
+			return err
+		}
+		syncVersion, err := tx.nextSyncVersion(todo.UserID)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRow(query, todo.Title, todo.Description, todo.Completed, todo.Priority,
+			todo.DueDate, string(tagsJSON), todo.CategoryID, todo.Reminder, todo.Recurrence, todo.IsDeleted,
+			now, syncVersion, todo.ID, todo.UserID).Scan(&todo.UUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("todo not found or not owned by user: %w", ErrNotFound)
+		}
+		if err != nil {
+			return err
 		}
 		todo.UpdatedAt = now
 		todo.SyncVersion = syncVersion
+		tx.recordChange(todo.UserID, syncVersion, ChangedEntity{Type: SyncTypeTodo, ID: todo.ID, UUID: todo.UUID})
+		if err := indexTodoSearch(tx, todo); err != nil {
+			return err
+		}
+		if err := saveTodoRevision(tx, previous, todo); err != nil {
+			return err
+		}
+		return saveTodoSnapshot(tx, todo)
+	})
+}
+
+// lockTodo 在事务中锁定用户的写入后读取写入前的TODO（包含已删除的TODO），用于记录修改历史。
+// 先于 nextSyncVersion 取得同一把锁，并发写入时读到的一定是上一次已提交的版本，修改历史中的字段差异不会错乱
+func lockTodo(tx *sqlDB, todoID, userID int) (*Todo, error) {
+	if err := tx.lockUserWrites(userID); err != nil {
+		return nil, err
+	}
+	todo, err := scanTodo(tx.QueryRow(`
+		SELECT `+todoColumns+`
+		FROM todos
+		WHERE id = $1 AND user_id = $2`, todoID, userID))
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("todo not found or not owned by user: %w", ErrNotFound)
+	}
+	return todo, err
+}
+
+// saveTodoSnapshot 在写入TODO的同一事务中保存该版本的快照，并清理超出保留数量的旧快照
+func saveTodoSnapshot(tx *sqlDB, todo *Todo) error {
+	data, err := json.Marshal(todo)
+	if err != nil {
+		return fmt.Errorf("failed to marshal todo snapshot: %v", err)
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO todo_snapshots (todo_id, user_id, sync_version, data, created_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		todo.ID, todo.UserID, todo.SyncVersion, string(data), todo.UpdatedAt); err != nil {
+		return err
 	}
 
+	_, err = tx.Exec(`
+		DELETE FROM todo_snapshots
+		WHERE todo_id = $1 AND sync_version NOT IN (
+			SELECT sync_version FROM todo_snapshots
+			WHERE todo_id = $1
+			ORDER BY sync_version DESC
+			LIMIT $2
+		)`, todo.ID, TodoSnapshotRetention)
 	return err
 }
 
-// SearchTodos 搜索TODO
-func (r *ExtendedTodoRepository) SearchTodos(userID int, keyword string, limit, offset int) ([]Todo, error) {
+// GetTodoSnapshot 获取TODO在指定同步版本时的快照
+func (r *ExtendedTodoRepository) GetTodoSnapshot(todoID, userID int, syncVersion int64) (*Todo, error) {
 	query := `
-		SELECT id, user_id, title, description, completed, priority, due_date, tags,
-			category_id, reminder, created_at, updated_at, is_deleted, sync_version
-		FROM todos 
-		WHERE user_id = $1 AND is_deleted = FALSE 
-			AND (title ILIKE $2 OR description ILIKE $3 OR tags::text ILIKE $4)
-		ORDER BY created_at DESC
-		LIMIT $5 OFFSET $6`
+		SELECT data FROM todo_snapshots
+		WHERE todo_id = $1 AND user_id = $2 AND sync_version = $3`
 
-	searchPattern := "%" + keyword + "%"
-	rows, err := r.db.Query(query, userID, searchPattern, searchPattern, searchPattern, limit, offset)
-	if err != nil {
-		return nil, err
+	var data []byte
+	if err := r.db.QueryRow(query, todoID, userID, syncVersion).Scan(&data); err != nil {
+		return nil, translateError(err)
 	}
-	defer rows.Close()
 
-	var todos []Todo
-	for rows.Next() {
-		var todo Todo
-		var tagsJSON []byte
+	var todo Todo
+	if err := json.Unmarshal(data, &todo); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal todo snapshot: %v", err)
+	}
+	return &todo, nil
+}
 
-		err := rows.Scan(&todo.ID, &todo.UserID, &todo.Title, &todo.Description, &todo.Completed,
-			&todo.Priority, &todo.DueDate, &tagsJSON, &todo.CategoryID, &todo.Reminder,
-			&todo.CreatedAt, &todo.UpdatedAt, &todo.IsDeleted, &todo.SyncVersion)
+// DeleteTodo 删除TODO（物理删除），修改历史中保留删除前的全部字段
+func (r *ExtendedTodoRepository) DeleteTodo(todoID, userID int) error {
+	return r.db.withTx(func(tx *sqlDB) error {
+		previous, err := lockTodo(tx, todoID, userID)
 		if err != nil {
-			return nil, err
+			return err
 		}
-
-		// 反序列化标签
-		if len(tagsJSON) > 0 {
-			if err := json.Unmarshal(tagsJSON, &todo.Tags); err != nil {
-				todo.Tags = StringSlice{}
-			}
-		} else {
-			todo.Tags = StringSlice{}
+		if _, err := tx.Exec("DELETE FROM todos WHERE id = $1 AND user_id = $2", todoID, userID); err != nil {
+			return err
 		}
-
-		todos = append(todos, todo)
-	}
-
-	return todos, rows.Err()
+		return saveTodoRevision(tx, previous, nil)
+	})
 }
 
-// GetTodosSince 获取指定时间戳之后的TODO（用于增量同步）
-func (r *ExtendedTodoRepository) GetTodosSince(userID int, since int64) ([]Todo, error) {
+// GetTodosSince 按版本号顺序获取同步版本号在 (since, until] 区间内的TODO（用于增量同步），limit < 0 表示不限制数量
+func (r *ExtendedTodoRepository) GetTodosSince(userID int, since, until int64, limit int) ([]Todo, error) {
 	query := `
-		SELECT id, user_id, title, description, completed, priority, due_date, tags,
-			category_id, reminder, created_at, updated_at, is_deleted, sync_version
+		SELECT ` + todoColumns + `
 		FROM todos 
-		WHERE user_id = $1 AND sync_version > $2
-		ORDER BY sync_version ASC`
+		WHERE user_id = $1 AND sync_version > $2 AND sync_version <= $3
+		ORDER BY sync_version ASC` + limitClause(limit)
 
-	rows, err := r.db.Query(query, userID, since)
+	rows, err := r.db.Query(query, userID, since, until)
 	if err != nil {
 		return nil, err
 	}
@@ -359,26 +637,11 @@ func (r *ExtendedTodoRepository) GetTodosSince(userID int, since int64) ([]Todo,
 
 	var todos []Todo
 	for rows.Next() {
-		var todo Todo
-		var tagsJSON []byte
-
-		err := rows.Scan(&todo.ID, &todo.UserID, &todo.Title, &todo.Description, &todo.Completed,
-			&todo.Priority, &todo.DueDate, &tagsJSON, &todo.CategoryID, &todo.Reminder,
-			&todo.CreatedAt, &todo.UpdatedAt, &todo.IsDeleted, &todo.SyncVersion)
+		todo, err := scanTodo(rows)
 		if err != nil {
 			return nil, err
 		}
-
-		// 反序列化标签
-		if len(tagsJSON) > 0 {
-			if err := json.Unmarshal(tagsJSON, &todo.Tags); err != nil {
-				todo.Tags = StringSlice{}
-			}
-		} else {
-			todo.Tags = StringSlice{}
-		}
-
-		todos = append(todos, todo)
+		todos = append(todos, *todo)
 	}
 
 	return todos, rows.Err()
@@ -387,46 +650,120 @@ func (r *ExtendedTodoRepository) GetTodosSince(userID int, since int64) ([]Todo,
 // GetTodoByID 根据ID获取单个TODO
 func (r *ExtendedTodoRepository) GetTodoByID(todoID, userID int) (*Todo, error) {
 	query := `
-		SELECT id, user_id, title, description, completed, priority, due_date, tags,
-			category_id, reminder, created_at, updated_at, is_deleted, sync_version
+		SELECT ` + todoColumns + `
 		FROM todos 
 		WHERE id = $1 AND user_id = $2 AND is_deleted = FALSE`
 
-	var todo Todo
-	var tagsJSON []byte
+	return scanTodo(r.db.QueryRow(query, todoID, userID))
+}
+
+// GetDeletedTodo 根据ID获取回收站中的TODO
+func (r *ExtendedTodoRepository) GetDeletedTodo(todoID, userID int) (*Todo, error) {
+	query := `
+		SELECT ` + todoColumns + `
+		FROM todos
+		WHERE id = $1 AND user_id = $2 AND is_deleted = TRUE`
+
+	return scanTodo(r.db.QueryRow(query, todoID, userID))
+}
+
+// GetTodoByUUID 根据客户端UUID获取单个TODO（包含已删除的TODO）
+func (r *ExtendedTodoRepository) GetTodoByUUID(userID int, uuid string) (*Todo, error) {
+	query := `
+		SELECT ` + todoColumns + `
+		FROM todos 
+		WHERE user_id = $1 AND uuid = $2`
+
+	return scanTodo(r.db.QueryRow(query, userID, uuid))
+}
 
-	err := r.db.QueryRow(query, todoID, userID).Scan(
-		&todo.ID, &todo.UserID, &todo.Title, &todo.Description, &todo.Completed,
-		&todo.Priority, &todo.DueDate, &tagsJSON, &todo.CategoryID, &todo.Reminder,
-		&todo.CreatedAt, &todo.UpdatedAt, &todo.IsDeleted, &todo.SyncVersion)
+// ===== 数据同步相关方法 =====
+
+// GetDeletedCategories 获取回收站中的分类，按删除时间从新到旧排序
+func (r *CategoryRepository) GetDeletedCategories(userID int) ([]Category, error) {
+	query := `
+		SELECT ` + categoryColumns + `
+		FROM categories
+		WHERE user_id = $1 AND is_deleted = TRUE
+		ORDER BY updated_at DESC, id DESC`
 
+	rows, err := r.db.Query(query, userID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	// 反序列化标签
-	if len(tagsJSON) > 0 {
-		if err := json.Unmarshal(tagsJSON, &todo.Tags); err != nil {
-			todo.Tags = StringSlice{}
+	var categories []Category
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		todo.Tags = StringSlice{}
+		categories = append(categories, *category)
 	}
 
-	return &todo, nil
+	return categories, rows.Err()
 }
 
-// ===== 数据同步相关方法 =====
+// RestoreCategory 恢复已删除的分类，分配新的同步版本号；分类未删除时返回 ErrNotFound
+func (r *CategoryRepository) RestoreCategory(id, userID int) error {
+	query := `
+		UPDATE categories
+		SET is_deleted = FALSE, updated_at = $1, sync_version = $2
+		WHERE id = $3 AND user_id = $4`
+
+	now := time.Now()
+	return r.db.withTx(func(tx *sqlDB) error {
+		previous, err := lockCategory(tx, id, userID)
+		if err != nil {
+			return err
+		}
+		if !previous.IsDeleted {
+			return fmt.Errorf("category is not deleted: %w", ErrNotFound)
+		}
+		syncVersion, err := tx.nextSyncVersion(userID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(query, now, syncVersion, id, userID); err != nil {
+			return err
+		}
+		tx.recordChange(userID, syncVersion, ChangedEntity{Type: SyncTypeCategory, ID: id, UUID: previous.UUID})
+
+		current := *previous
+		current.IsDeleted = false
+		current.SyncVersion = syncVersion
+		return saveCategoryRevision(tx, previous, &current)
+	})
+}
 
-// GetCategoriesSince 获取指定时间戳之后的分类（用于增量同步）
-func (r *CategoryRepository) GetCategoriesSince(userID int, since int64) ([]Category, error) {
+// PurgeCategory 物理删除已删除的分类，仍引用该分类的TODO的 category_id 被置空；
+// 未删除的TODO应先由调用方移出该分类以分配新的同步版本号。分类未删除时返回 ErrNotFound
+func (r *CategoryRepository) PurgeCategory(id, userID int) error {
+	return r.db.withTx(func(tx *sqlDB) error {
+		previous, err := lockCategory(tx, id, userID)
+		if err != nil {
+			return err
+		}
+		if !previous.IsDeleted {
+			return fmt.Errorf("category is not deleted: %w", ErrNotFound)
+		}
+		if _, err := tx.Exec("DELETE FROM categories WHERE id = $1 AND user_id = $2", id, userID); err != nil {
+			return err
+		}
+		return saveCategoryRevision(tx, previous, nil)
+	})
+}
+
+// GetCategoriesSince 按版本号顺序获取同步版本号在 (since, until] 区间内的分类（用于增量同步），limit < 0 表示不限制数量
+func (r *CategoryRepository) GetCategoriesSince(userID int, since, until int64, limit int) ([]Category, error) {
 	query := `
-		SELECT id, user_id, name, color, icon, created_at, updated_at, is_deleted, sync_version
+		SELECT ` + categoryColumns + `
 		FROM categories 
-		WHERE user_id = $1 AND sync_version > $2
-		ORDER BY sync_version ASC`
+		WHERE user_id = $1 AND sync_version > $2 AND sync_version <= $3
+		ORDER BY sync_version ASC` + limitClause(limit)
 
-	rows, err := r.db.Query(query, userID, since)
+	rows, err := r.db.Query(query, userID, since, until)
 	if err != nil {
 		return nil, err
 	}
@@ -434,29 +771,27 @@ func (r *CategoryRepository) GetCategoriesSince(userID int, since int64) ([]Cate
 
 	var categories []Category
 	for rows.Next() {
-		var category Category
-		err := rows.Scan(&category.ID, &category.UserID, &category.Name, &category.Color,
-			&category.Icon, &category.CreatedAt, &category.UpdatedAt, &category.IsDeleted, &category.SyncVersion)
+		category, err := scanCategory(rows)
 		if err != nil {
 			return nil, err
 		}
-		categories = append(categories, category)
+		categories = append(categories, *category)
 	}
 
 	return categories, rows.Err()
 }
 
-// GetUserSettingsSince 获取指定时间戳之后的用户设置（用于增量同步）
-func (r *UserSettingsRepository) GetUserSettingsSince(userID int, since int64) (*UserSettings, error) {
+// GetUserSettingsSince 获取同步版本号在 (since, until] 区间内的用户设置（用于增量同步）
+func (r *UserSettingsRepository) GetUserSettingsSince(userID int, since, until int64) (*UserSettings, error) {
 	query := `
-		SELECT user_id, theme, notification_time, language, timezone, created_at, updated_at, sync_version
+		SELECT user_id, theme, notification_time, language, timezone, daily_digest, created_at, updated_at, sync_version
 		FROM user_settings 
-		WHERE user_id = $1 AND sync_version > $2`
+		WHERE user_id = $1 AND sync_version > $2 AND sync_version <= $3`
 
 	var settings UserSettings
-	err := r.db.QueryRow(query, userID, since).Scan(
+	err := r.db.QueryRow(query, userID, since, until).Scan(
 		&settings.UserID, &settings.Theme, &settings.NotificationTime,
-		&settings.Language, &settings.TimeZone, &settings.CreatedAt, &settings.UpdatedAt, &settings.SyncVersion)
+		&settings.Language, &settings.TimeZone, &settings.DailyDigest, &settings.CreatedAt, &settings.UpdatedAt, &settings.SyncVersion)
 
 	if err == sql.ErrNoRows {
 		return nil, nil // 没有更新的设置
@@ -465,248 +800,22 @@ func (r *UserSettingsRepository) GetUserSettingsSince(userID int, since int64) (
 	return &settings, err
 }
 
-// BatchCreateOrUpdateTodos 批量创建或更新TODO
-func (r *ExtendedTodoRepository) BatchCreateOrUpdateTodos(userID int, todos []TodoSyncItem) ([]SyncResult, error) {
-	var results []SyncResult
-
-	for _, todoItem := range todos {
-		result := SyncResult{
-			Type:    "todo",
-			LocalID: todoItem.ID,
-		}
-
-		// 解析时间字段
-		var dueDate, reminder *time.Time
-		if todoItem.DueDate != nil {
-			if parsed, err := time.Parse(time.RFC3339, *todoItem.DueDate); err == nil {
-				dueDate = &parsed
-			}
-		}
-		if todoItem.Reminder != nil {
-			if parsed, err := time.Parse(time.RFC3339, *todoItem.Reminder); err == nil {
-				reminder = &parsed
-			}
-		}
-
-		if todoItem.ID == 0 {
-			// 创建新TODO
-			todo := &Todo{
-				UserID:      userID,
-				Title:       todoItem.Title,
-				Description: todoItem.Description,
-				Completed:   todoItem.Completed,
-				Priority:    Priority(todoItem.Priority),
-				DueDate:     dueDate,
-				Tags:        StringSlice(todoItem.Tags),
-				CategoryID:  todoItem.CategoryID,
-				Reminder:    reminder,
-				IsDeleted:   todoItem.IsDeleted,
-			}
-
-			if err := r.CreateTodoExtended(todo); err != nil {
-				result.Action = "error"
-				result.Message = err.Error()
-			} else {
-				result.Action = "created"
-				result.ServerID = todo.ID
-				result.SyncVersion = todo.SyncVersion
-				result.Message = "创建成功"
-			}
-		} else {
-			// 更新现有TODO
-			existingTodo, err := r.GetTodoByID(todoItem.ID, userID)
-			if err != nil {
-				result.Action = "error"
-				result.Message = "TODO不存在"
-			} else {
-				// 检查冲突
-				clientUpdatedAt, _ := time.Parse(time.RFC3339, todoItem.UpdatedAt)
-				if existingTodo.UpdatedAt.After(clientUpdatedAt) && existingTodo.SyncVersion > todoItem.SyncVersion {
-					result.Action = "conflict"
-					result.Message = "存在冲突，服务器版本更新"
-				} else {
-					// 更新TODO
-					existingTodo.Title = todoItem.Title
-					existingTodo.Description = todoItem.Description
-					existingTodo.Completed = todoItem.Completed
-					existingTodo.Priority = Priority(todoItem.Priority)
-					existingTodo.DueDate = dueDate
-					existingTodo.Tags = StringSlice(todoItem.Tags)
-					existingTodo.CategoryID = todoItem.CategoryID
-					existingTodo.Reminder = reminder
-					existingTodo.IsDeleted = todoItem.IsDeleted
-
-					if err := r.UpdateTodoExtended(existingTodo); err != nil {
-						result.Action = "error"
-						result.Message = err.Error()
-					} else {
-						result.Action = "updated"
-						result.ServerID = existingTodo.ID
-						result.SyncVersion = existingTodo.SyncVersion
-						result.Message = "更新成功"
-					}
-				}
-			}
-		}
-
-		results = append(results, result)
-	}
-
-	return results, nil
-}
-
-// BatchCreateOrUpdateCategories 批量创建或更新分类
-func (r *CategoryRepository) BatchCreateOrUpdateCategories(userID int, categories []CategorySyncItem) ([]SyncResult, error) {
-	var results []SyncResult
-
-	for _, categoryItem := range categories {
-		result := SyncResult{
-			Type:    "category",
-			LocalID: categoryItem.ID,
-		}
-
-		if categoryItem.ID == 0 {
-			// 创建新分类
-			category := &Category{
-				UserID:    userID,
-				Name:      categoryItem.Name,
-				Color:     categoryItem.Color,
-				Icon:      categoryItem.Icon,
-				IsDeleted: categoryItem.IsDeleted,
-			}
-
-			if err := r.CreateCategory(category); err != nil {
-				result.Action = "error"
-				result.Message = err.Error()
-			} else {
-				result.Action = "created"
-				result.ServerID = category.ID
-				result.SyncVersion = category.SyncVersion
-				result.Message = "创建成功"
-			}
-		} else {
-			// 更新现有分类
-			existingCategory, err := r.GetCategoryByID(categoryItem.ID, userID)
-			if err != nil {
-				result.Action = "error"
-				result.Message = "分类不存在"
-			} else {
-				// 检查冲突
-				clientUpdatedAt, _ := time.Parse(time.RFC3339, categoryItem.UpdatedAt)
-				if existingCategory.UpdatedAt.After(clientUpdatedAt) && existingCategory.SyncVersion > categoryItem.SyncVersion {
-					result.Action = "conflict"
-					result.Message = "存在冲突，服务器版本更新"
-				} else {
-					// 更新分类
-					existingCategory.Name = categoryItem.Name
-					existingCategory.Color = categoryItem.Color
-					existingCategory.Icon = categoryItem.Icon
-					existingCategory.IsDeleted = categoryItem.IsDeleted
-
-					if categoryItem.IsDeleted {
-						if err := r.DeleteCategory(categoryItem.ID, userID); err != nil {
-							result.Action = "error"
-							result.Message = err.Error()
-						} else {
-							result.Action = "deleted"
-							result.ServerID = existingCategory.ID
-							result.Message = "删除成功"
-						}
-					} else {
-						if err := r.UpdateCategory(existingCategory); err != nil {
-							result.Action = "error"
-							result.Message = err.Error()
-						} else {
-							result.Action = "updated"
-							result.ServerID = existingCategory.ID
-							result.SyncVersion = existingCategory.SyncVersion
-							result.Message = "更新成功"
-						}
-					}
-				}
-			}
-		}
-
-		results = append(results, result)
-	}
-
-	return results, nil
-}
-
 // GetCategoryByID 根据ID获取单个分类
 func (r *CategoryRepository) GetCategoryByID(categoryID, userID int) (*Category, error) {
 	query := `
-		SELECT id, user_id, name, color, icon, created_at, updated_at, is_deleted, sync_version
+		SELECT ` + categoryColumns + `
 		FROM categories 
 		WHERE id = $1 AND user_id = $2`
 
-	var category Category
-	err := r.db.QueryRow(query, categoryID, userID).Scan(
-		&category.ID, &category.UserID, &category.Name, &category.Color,
-		&category.Icon, &category.CreatedAt, &category.UpdatedAt, &category.IsDeleted, &category.SyncVersion)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &category, nil
+	return scanCategory(r.db.QueryRow(query, categoryID, userID))
 }
 
-// BatchUpdateUserSettings 批量更新用户设置
-func (r *UserSettingsRepository) BatchUpdateUserSettings(userID int, settingsItem *UserSettingsSyncItem) (*SyncResult, error) {
-	result := &SyncResult{
-		Type: "settings",
-	}
-
-	if settingsItem == nil {
-		result.Action = "error"
-		result.Message = "设置数据为空"
-		return result, nil
-	}
-
-	existingSettings, err := r.GetUserSettings(userID)
-	if err != nil {
-		result.Action = "error"
-		result.Message = "获取用户设置失败"
-		return result, err
-	}
-
-	// 检查冲突
-	clientUpdatedAt, _ := time.Parse(time.RFC3339, settingsItem.UpdatedAt)
-	if existingSettings.UpdatedAt.After(clientUpdatedAt) && existingSettings.SyncVersion > settingsItem.SyncVersion {
-		result.Action = "conflict"
-		result.Message = "存在冲突，服务器版本更新"
-		return result, nil
-	}
-
-	// 更新设置
-	existingSettings.Theme = settingsItem.Theme
-	existingSettings.NotificationTime = settingsItem.NotificationTime
-	existingSettings.Language = settingsItem.Language
-	existingSettings.TimeZone = settingsItem.TimeZone
-
-	if err := r.UpdateUserSettings(existingSettings); err != nil {
-		result.Action = "error"
-		result.Message = err.Error()
-		return result, err
-	}
-
-	result.Action = "updated"
-	result.SyncVersion = existingSettings.SyncVersion
-	result.Message = "更新成功"
-	return result, nil
-}
-
-// GetCurrentSyncVersion 获取当前最大同步版本号
-func GetCurrentSyncVersion(db *sql.DB, userID int) (int64, error) {
+// GetCategoryByUUID 根据客户端UUID获取单个分类（包含已删除的分类）
+func (r *CategoryRepository) GetCategoryByUUID(userID int, uuid string) (*Category, error) {
 	query := `
-		SELECT GREATEST(
-			COALESCE((SELECT MAX(sync_version) FROM todos WHERE user_id = $1), 0),
-			COALESCE((SELECT MAX(sync_version) FROM categories WHERE user_id = $1), 0),
-			COALESCE((SELECT sync_version FROM user_settings WHERE user_id = $1), 0)
-		) as max_version`
-
-	var maxVersion int64
-	err := db.QueryRow(query, userID).Scan(&maxVersion)
-	return maxVersion, err
+		SELECT ` + categoryColumns + `
+		FROM categories 
+		WHERE user_id = $1 AND uuid = $2`
+
+	return scanCategory(r.db.QueryRow(query, userID, uuid))
 }
@@ -1,17 +1,20 @@
 package repository
 
 import (
+	"database/sql"
+	"fmt"
 	"log"
-	"todo-service/global"
+
+	"github.com/google/uuid"
 )
 
 // CreateTables 创建PostgreSQL数据库表
-func CreateTables() {
-	createPostgreSQLTables()
+func CreateTables(db *sql.DB) {
+	createPostgreSQLTables(db)
 }
 
 // createPostgreSQLTables 创建PostgreSQL表
-func createPostgreSQLTables() {
+func createPostgreSQLTables(db *sql.DB) {
 	log.Println("Creating PostgreSQL tables...")
 
 	// 用户表
@@ -29,6 +32,7 @@ func createPostgreSQLTables() {
 	categoryTable := `
 	CREATE TABLE IF NOT EXISTS categories (
 		id SERIAL PRIMARY KEY,
+		uuid VARCHAR(36) NOT NULL,
 		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
 		name VARCHAR(100) NOT NULL,
 		color VARCHAR(7) DEFAULT '#2196F3',
@@ -36,7 +40,9 @@ func createPostgreSQLTables() {
 		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
 		is_deleted BOOLEAN DEFAULT FALSE,
-		UNIQUE(user_id, name)
+		sync_version BIGINT NOT NULL DEFAULT 0,
+		UNIQUE(user_id, name),
+		UNIQUE(user_id, uuid)
 	);`
 
 	// 用户设置表
@@ -47,14 +53,17 @@ func createPostgreSQLTables() {
 		notification_time TIME DEFAULT '09:00:00',
 		language VARCHAR(10) DEFAULT 'zh-CN',
 		timezone VARCHAR(50) DEFAULT 'Asia/Shanghai',
+		daily_digest BOOLEAN NOT NULL DEFAULT TRUE,
 		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		sync_version BIGINT NOT NULL DEFAULT 0
 	);`
 
 	// TODO表（扩展版）
 	todoTable := `
 	CREATE TABLE IF NOT EXISTS todos (
 		id SERIAL PRIMARY KEY,
+		uuid VARCHAR(36) NOT NULL,
 		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
 		title VARCHAR(200) NOT NULL,
 		description TEXT,
@@ -64,28 +73,271 @@ func createPostgreSQLTables() {
 		tags JSONB DEFAULT '[]'::jsonb,
 		category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL,
 		reminder TIMESTAMP WITH TIME ZONE,
+		recurrence VARCHAR(255),
 		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
 		is_deleted BOOLEAN DEFAULT FALSE,
-		sync_version BIGINT DEFAULT EXTRACT(EPOCH FROM CURRENT_TIMESTAMP) * 1000
+		sync_version BIGINT NOT NULL DEFAULT 0,
+		search_vector TSVECTOR,
+		UNIQUE(user_id, uuid)
 	);`
 
-	tables := []string{userTable, categoryTable, userSettingsTable, todoTable}
+	// TODO快照表，保存最近若干版本用于同步冲突的三方合并
+	todoSnapshotTable := `
+	CREATE TABLE IF NOT EXISTS todo_snapshots (
+		todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		sync_version BIGINT NOT NULL,
+		data JSONB NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (todo_id, sync_version)
+	);`
+
+	// TODO检查项表
+	checklistItemTable := `
+	CREATE TABLE IF NOT EXISTS todo_checklist_items (
+		id SERIAL PRIMARY KEY,
+		uuid VARCHAR(36) NOT NULL,
+		todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		title VARCHAR(200) NOT NULL,
+		completed BOOLEAN DEFAULT FALSE,
+		position INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		is_deleted BOOLEAN DEFAULT FALSE,
+		sync_version BIGINT NOT NULL DEFAULT 0,
+		UNIQUE(user_id, uuid)
+	);`
+
+	// 标签表（标签元数据，TODO中仍以名称保存标签）
+	tagTable := `
+	CREATE TABLE IF NOT EXISTS tags (
+		id SERIAL PRIMARY KEY,
+		uuid VARCHAR(36) NOT NULL,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(50) NOT NULL,
+		color VARCHAR(7) DEFAULT '#9E9E9E',
+		icon VARCHAR(50) DEFAULT 'label',
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		is_deleted BOOLEAN DEFAULT FALSE,
+		sync_version BIGINT NOT NULL DEFAULT 0,
+		UNIQUE(user_id, uuid)
+	);`
+
+	// 智能列表表
+	smartListTable := `
+	CREATE TABLE IF NOT EXISTS smart_lists (
+		id SERIAL PRIMARY KEY,
+		uuid VARCHAR(36) NOT NULL,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(100) NOT NULL,
+		icon VARCHAR(50) DEFAULT 'list',
+		color VARCHAR(7) DEFAULT '#2196F3',
+		definition JSONB NOT NULL DEFAULT '{}',
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		is_deleted BOOLEAN DEFAULT FALSE,
+		sync_version BIGINT NOT NULL DEFAULT 0,
+		UNIQUE(user_id, uuid)
+	);`
+
+	// 修改历史表（不引用 todos，物理删除后历史仍然保留）
+	revisionTable := `
+	CREATE TABLE IF NOT EXISTS todo_revisions (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		entity_type VARCHAR(20) NOT NULL,
+		entity_id INTEGER NOT NULL,
+		entity_uuid VARCHAR(36) NOT NULL,
+		action VARCHAR(20) NOT NULL,
+		changes JSONB NOT NULL DEFAULT '{}',
+		device_id VARCHAR(36) NOT NULL DEFAULT '',
+		sync_version BIGINT NOT NULL DEFAULT 0,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// 提醒投递记录表，同一TODO的同一提醒时间在每个通知渠道只投递一次
+	reminderDeliveryTable := `
+	CREATE TABLE IF NOT EXISTS reminder_deliveries (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+		reminder_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		channel VARCHAR(20) NOT NULL,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		claimed_by VARCHAR(64) NOT NULL DEFAULT '',
+		claimed_until TIMESTAMP WITH TIME ZONE,
+		sent_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(todo_id, reminder_at, channel)
+	);`
+
+	// 每日摘要投递记录表，同一用户同一天在每个通知渠道只投递一次
+	digestDeliveryTable := `
+	CREATE TABLE IF NOT EXISTS digest_deliveries (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		digest_date VARCHAR(10) NOT NULL,
+		channel VARCHAR(20) NOT NULL,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		claimed_by VARCHAR(64) NOT NULL DEFAULT '',
+		claimed_until TIMESTAMP WITH TIME ZONE,
+		sent_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(user_id, digest_date, channel)
+	);`
+
+	// Webhook表，all_users 为 TRUE 时接收全部用户的事件（仅管理员）
+	webhookEndpointTable := `
+	CREATE TABLE IF NOT EXISTS webhook_endpoints (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		url VARCHAR(2048) NOT NULL,
+		secret VARCHAR(100) NOT NULL,
+		events JSONB NOT NULL DEFAULT '[]'::jsonb,
+		all_users BOOLEAN NOT NULL DEFAULT FALSE,
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		consecutive_failures INTEGER NOT NULL DEFAULT 0,
+		disabled_at TIMESTAMP WITH TIME ZONE,
+		disabled_reason TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Webhook事件表，只保存有Webhook订阅的事件
+	webhookEventTable := `
+	CREATE TABLE IF NOT EXISTS webhook_events (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		event_type VARCHAR(30) NOT NULL,
+		entity_type VARCHAR(20) NOT NULL,
+		entity_id INTEGER NOT NULL DEFAULT 0,
+		entity_uuid VARCHAR(36) NOT NULL DEFAULT '',
+		sync_version BIGINT NOT NULL DEFAULT 0,
+		data JSONB NOT NULL,
+		changes JSONB NOT NULL DEFAULT '{}',
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Webhook投递记录表，每个事件向每个订阅的Webhook投递一次，重放时生成新的记录
+	webhookDeliveryTable := `
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id SERIAL PRIMARY KEY,
+		endpoint_id INTEGER NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+		event_id INTEGER NOT NULL REFERENCES webhook_events(id) ON DELETE CASCADE,
+		event_type VARCHAR(30) NOT NULL,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		claimed_by VARCHAR(64) NOT NULL DEFAULT '',
+		claimed_until TIMESTAMP WITH TIME ZONE,
+		sent_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// 日历订阅表，令牌只保存哈希；限定分类时分类被彻底删除后订阅一并删除
+	calendarFeedTable := `
+	CREATE TABLE IF NOT EXISTS calendar_feeds (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(100) NOT NULL DEFAULT '',
+		category_id INTEGER REFERENCES categories(id) ON DELETE CASCADE,
+		token_hash VARCHAR(64) UNIQUE NOT NULL,
+		last_accessed_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// 应用专用密码表，只保存密码哈希
+	appPasswordTable := `
+	CREATE TABLE IF NOT EXISTS app_passwords (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(100) NOT NULL DEFAULT '',
+		password_hash VARCHAR(64) UNIQUE NOT NULL,
+		last_used_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// 刷新令牌表
+	refreshTokenTable := `
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		session_id VARCHAR(36) NOT NULL,
+		token_hash VARCHAR(64) UNIQUE NOT NULL,
+		expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		used_at TIMESTAMP WITH TIME ZONE,
+		revoked_at TIMESTAMP WITH TIME ZONE
+	);`
+
+	// 同步版本号计数表
+	syncSequenceTable := `
+	CREATE TABLE IF NOT EXISTS sync_sequences (
+		user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		version BIGINT NOT NULL DEFAULT 0
+	);`
+
+	// 设备表
+	deviceTable := `
+	CREATE TABLE IF NOT EXISTS devices (
+		id VARCHAR(36) PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(100) NOT NULL,
+		platform VARCHAR(20) NOT NULL DEFAULT '',
+		session_id VARCHAR(36) NOT NULL DEFAULT '',
+		push_token VARCHAR(255) NOT NULL DEFAULT '',
+		last_sync_version BIGINT NOT NULL DEFAULT 0,
+		last_synced_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		revoked_at TIMESTAMP WITH TIME ZONE
+	);`
+
+	// 幂等键表
+	idempotencyKeyTable := `
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		idempotency_key VARCHAR(36) NOT NULL,
+		resource_type VARCHAR(20) NOT NULL,
+		resource_id INTEGER NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, idempotency_key)
+	);`
+
+	tables := []string{userTable, categoryTable, userSettingsTable, todoTable, todoSnapshotTable, checklistItemTable, tagTable, smartListTable, revisionTable, reminderDeliveryTable, digestDeliveryTable, webhookEndpointTable, webhookEventTable, webhookDeliveryTable, calendarFeedTable, appPasswordTable, refreshTokenTable, syncSequenceTable, deviceTable, idempotencyKeyTable}
 
 	for _, table := range tables {
-		if _, err := global.Db.Exec(table); err != nil {
+		if _, err := db.Exec(table); err != nil {
 			log.Fatal("Failed to create PostgreSQL table:", err)
 		}
 	}
 
 	// 创建索引
-	createPostgreSQLIndexes()
+	createPostgreSQLIndexes(db)
+
+	if err := backfillSearchIndex(&sqlDB{conn: db, dialect: postgresDialect}, "search_vector IS NULL"); err != nil {
+		log.Printf("Warning: Failed to build search index: %v", err)
+	}
 
 	log.Println("PostgreSQL tables created successfully")
 }
 
 // createPostgreSQLIndexes 创建PostgreSQL索引
-func createPostgreSQLIndexes() {
+func createPostgreSQLIndexes(db *sql.DB) {
 	indexes := []string{
 		"CREATE INDEX IF NOT EXISTS idx_users_username ON users(username)",
 		"CREATE INDEX IF NOT EXISTS idx_users_email ON users(email)",
@@ -100,12 +352,386 @@ func createPostgreSQLIndexes() {
 		"CREATE INDEX IF NOT EXISTS idx_todos_category_id ON todos(category_id) WHERE category_id IS NOT NULL",
 		"CREATE INDEX IF NOT EXISTS idx_todos_sync_version ON todos(sync_version)",
 		"CREATE INDEX IF NOT EXISTS idx_todos_tags ON todos USING GIN(tags)",
+		"CREATE INDEX IF NOT EXISTS idx_todos_search_vector ON todos USING GIN(search_vector)",
 		"CREATE INDEX IF NOT EXISTS idx_todos_reminder ON todos(reminder) WHERE reminder IS NOT NULL",
+		"CREATE INDEX IF NOT EXISTS idx_todos_deleted_updated_at ON todos(updated_at) WHERE is_deleted = TRUE",
+		"CREATE INDEX IF NOT EXISTS idx_categories_deleted_updated_at ON categories(updated_at) WHERE is_deleted = TRUE",
+		"CREATE INDEX IF NOT EXISTS idx_checklist_items_todo_id_position ON todo_checklist_items(todo_id, position)",
+		"CREATE INDEX IF NOT EXISTS idx_checklist_items_user_id_sync_version ON todo_checklist_items(user_id, sync_version)",
+		"CREATE INDEX IF NOT EXISTS idx_tags_user_id_sync_version ON tags(user_id, sync_version)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_user_id_name ON tags(user_id, name) WHERE is_deleted = FALSE",
+		"CREATE INDEX IF NOT EXISTS idx_smart_lists_user_id_sync_version ON smart_lists(user_id, sync_version)",
+		"CREATE INDEX IF NOT EXISTS idx_todo_revisions_entity ON todo_revisions(user_id, entity_type, entity_id)",
+		"CREATE INDEX IF NOT EXISTS idx_todo_revisions_user_created_at ON todo_revisions(user_id, created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_reminder_deliveries_status_next_attempt ON reminder_deliveries(status, next_attempt_at)",
+		"CREATE INDEX IF NOT EXISTS idx_digest_deliveries_status_next_attempt ON digest_deliveries(status, next_attempt_at)",
+		"CREATE INDEX IF NOT EXISTS idx_webhook_endpoints_user_id ON webhook_endpoints(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status_next_attempt ON webhook_deliveries(status, next_attempt_at)",
+		"CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint_id ON webhook_deliveries(endpoint_id)",
+		"CREATE INDEX IF NOT EXISTS idx_calendar_feeds_user_id ON calendar_feeds(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_app_passwords_user_id ON app_passwords(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_session ON refresh_tokens(user_id, session_id)",
+		"CREATE INDEX IF NOT EXISTS idx_devices_user_session ON devices(user_id, session_id)",
 	}
 
 	for _, index := range indexes {
-		if _, err := global.Db.Exec(index); err != nil {
+		if _, err := db.Exec(index); err != nil {
 			log.Printf("Warning: Failed to create index: %v", err)
 		}
 	}
 }
+
+// createSQLiteTables 创建SQLite表，结构与PostgreSQL保持一致
+func createSQLiteTables(db *sql.DB) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username VARCHAR(50) UNIQUE NOT NULL,
+			email VARCHAR(100) UNIQUE NOT NULL,
+			password VARCHAR(255) NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS categories (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			uuid VARCHAR(36) NOT NULL DEFAULT '',
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL,
+			color VARCHAR(7) DEFAULT '#2196F3',
+			icon VARCHAR(50) DEFAULT 'folder',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			is_deleted BOOLEAN DEFAULT FALSE,
+			sync_version BIGINT DEFAULT 0,
+			UNIQUE(user_id, name)
+		)`,
+		`CREATE TABLE IF NOT EXISTS user_settings (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			theme VARCHAR(10) DEFAULT 'light' CHECK (theme IN ('light', 'dark', 'auto')),
+			notification_time VARCHAR(8) DEFAULT '09:00:00',
+			language VARCHAR(10) DEFAULT 'zh-CN',
+			timezone VARCHAR(50) DEFAULT 'Asia/Shanghai',
+			daily_digest BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			sync_version BIGINT DEFAULT 0
+		)`,
+		`CREATE TABLE IF NOT EXISTS todos (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			uuid VARCHAR(36) NOT NULL DEFAULT '',
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			title VARCHAR(200) NOT NULL,
+			description TEXT,
+			completed BOOLEAN DEFAULT FALSE,
+			priority INTEGER DEFAULT 0 CHECK (priority >= 0 AND priority <= 3),
+			due_date DATETIME,
+			tags TEXT DEFAULT '[]',
+			category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL,
+			reminder DATETIME,
+			recurrence VARCHAR(255),
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			is_deleted BOOLEAN DEFAULT FALSE,
+			sync_version BIGINT DEFAULT 0
+		)`,
+		// TODO全文索引，内容为应用分词后以空格连接的词元，rowid 与 todos.id 一致
+		`CREATE VIRTUAL TABLE IF NOT EXISTS todos_fts USING fts5(
+			title, description, tags,
+			tokenize = 'unicode61 remove_diacritics 0'
+		)`,
+		`CREATE TRIGGER IF NOT EXISTS todos_fts_delete AFTER DELETE ON todos BEGIN
+			DELETE FROM todos_fts WHERE rowid = old.id;
+		END`,
+		`CREATE TABLE IF NOT EXISTS todo_snapshots (
+			todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			sync_version BIGINT NOT NULL,
+			data TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (todo_id, sync_version)
+		)`,
+		`CREATE TABLE IF NOT EXISTS todo_checklist_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			uuid VARCHAR(36) NOT NULL,
+			todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			title VARCHAR(200) NOT NULL,
+			completed BOOLEAN DEFAULT FALSE,
+			position INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			is_deleted BOOLEAN DEFAULT FALSE,
+			sync_version BIGINT DEFAULT 0,
+			UNIQUE(user_id, uuid)
+		)`,
+		`CREATE TABLE IF NOT EXISTS tags (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			uuid VARCHAR(36) NOT NULL,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(50) NOT NULL,
+			color VARCHAR(7) DEFAULT '#9E9E9E',
+			icon VARCHAR(50) DEFAULT 'label',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			is_deleted BOOLEAN DEFAULT FALSE,
+			sync_version BIGINT DEFAULT 0,
+			UNIQUE(user_id, uuid)
+		)`,
+		`CREATE TABLE IF NOT EXISTS smart_lists (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			uuid VARCHAR(36) NOT NULL,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL,
+			icon VARCHAR(50) DEFAULT 'list',
+			color VARCHAR(7) DEFAULT '#2196F3',
+			definition TEXT NOT NULL DEFAULT '{}',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			is_deleted BOOLEAN DEFAULT FALSE,
+			sync_version BIGINT DEFAULT 0,
+			UNIQUE(user_id, uuid)
+		)`,
+		`CREATE TABLE IF NOT EXISTS todo_revisions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			entity_type VARCHAR(20) NOT NULL,
+			entity_id INTEGER NOT NULL,
+			entity_uuid VARCHAR(36) NOT NULL,
+			action VARCHAR(20) NOT NULL,
+			changes TEXT NOT NULL DEFAULT '{}',
+			device_id VARCHAR(36) NOT NULL DEFAULT '',
+			sync_version BIGINT NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS reminder_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+			reminder_at DATETIME NOT NULL,
+			channel VARCHAR(20) NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at DATETIME NOT NULL,
+			claimed_by VARCHAR(64) NOT NULL DEFAULT '',
+			claimed_until DATETIME,
+			sent_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(todo_id, reminder_at, channel)
+		)`,
+		`CREATE TABLE IF NOT EXISTS digest_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			digest_date VARCHAR(10) NOT NULL,
+			channel VARCHAR(20) NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at DATETIME NOT NULL,
+			claimed_by VARCHAR(64) NOT NULL DEFAULT '',
+			claimed_until DATETIME,
+			sent_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, digest_date, channel)
+		)`,
+		`CREATE TABLE IF NOT EXISTS webhook_endpoints (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			url VARCHAR(2048) NOT NULL,
+			secret VARCHAR(100) NOT NULL,
+			events TEXT NOT NULL DEFAULT '[]',
+			all_users BOOLEAN NOT NULL DEFAULT FALSE,
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			consecutive_failures INTEGER NOT NULL DEFAULT 0,
+			disabled_at DATETIME,
+			disabled_reason TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS webhook_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			event_type VARCHAR(30) NOT NULL,
+			entity_type VARCHAR(20) NOT NULL,
+			entity_id INTEGER NOT NULL DEFAULT 0,
+			entity_uuid VARCHAR(36) NOT NULL DEFAULT '',
+			sync_version BIGINT NOT NULL DEFAULT 0,
+			data TEXT NOT NULL,
+			changes TEXT NOT NULL DEFAULT '{}',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			endpoint_id INTEGER NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+			event_id INTEGER NOT NULL REFERENCES webhook_events(id) ON DELETE CASCADE,
+			event_type VARCHAR(30) NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at DATETIME NOT NULL,
+			claimed_by VARCHAR(64) NOT NULL DEFAULT '',
+			claimed_until DATETIME,
+			sent_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS calendar_feeds (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL DEFAULT '',
+			category_id INTEGER REFERENCES categories(id) ON DELETE CASCADE,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			last_accessed_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS app_passwords (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL DEFAULT '',
+			password_hash VARCHAR(64) UNIQUE NOT NULL,
+			last_used_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			session_id VARCHAR(36) NOT NULL,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			expires_at DATETIME NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			used_at DATETIME,
+			revoked_at DATETIME
+		)`,
+		`CREATE TABLE IF NOT EXISTS sync_sequences (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			version BIGINT NOT NULL DEFAULT 0
+		)`,
+		`CREATE TABLE IF NOT EXISTS devices (
+			id VARCHAR(36) PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL,
+			platform VARCHAR(20) NOT NULL DEFAULT '',
+			session_id VARCHAR(36) NOT NULL DEFAULT '',
+			push_token VARCHAR(255) NOT NULL DEFAULT '',
+			last_sync_version BIGINT NOT NULL DEFAULT 0,
+			last_synced_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			revoked_at DATETIME
+		)`,
+		`CREATE TABLE IF NOT EXISTS idempotency_keys (
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			idempotency_key VARCHAR(36) NOT NULL,
+			resource_type VARCHAR(20) NOT NULL,
+			resource_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, idempotency_key)
+		)`,
+		"CREATE INDEX IF NOT EXISTS idx_categories_user_id ON categories(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_todos_user_id_created_at ON todos(user_id, created_at DESC)",
+		"CREATE INDEX IF NOT EXISTS idx_todos_user_id_sync_version ON todos(user_id, sync_version)",
+		"CREATE INDEX IF NOT EXISTS idx_todos_reminder ON todos(reminder) WHERE reminder IS NOT NULL",
+		"CREATE INDEX IF NOT EXISTS idx_todos_deleted_updated_at ON todos(updated_at) WHERE is_deleted = TRUE",
+		"CREATE INDEX IF NOT EXISTS idx_categories_deleted_updated_at ON categories(updated_at) WHERE is_deleted = TRUE",
+		"CREATE INDEX IF NOT EXISTS idx_checklist_items_todo_id_position ON todo_checklist_items(todo_id, position)",
+		"CREATE INDEX IF NOT EXISTS idx_checklist_items_user_id_sync_version ON todo_checklist_items(user_id, sync_version)",
+		"CREATE INDEX IF NOT EXISTS idx_tags_user_id_sync_version ON tags(user_id, sync_version)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_user_id_name ON tags(user_id, name) WHERE is_deleted = FALSE",
+		"CREATE INDEX IF NOT EXISTS idx_smart_lists_user_id_sync_version ON smart_lists(user_id, sync_version)",
+		"CREATE INDEX IF NOT EXISTS idx_todo_revisions_entity ON todo_revisions(user_id, entity_type, entity_id)",
+		"CREATE INDEX IF NOT EXISTS idx_todo_revisions_user_created_at ON todo_revisions(user_id, created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_reminder_deliveries_status_next_attempt ON reminder_deliveries(status, next_attempt_at)",
+		"CREATE INDEX IF NOT EXISTS idx_digest_deliveries_status_next_attempt ON digest_deliveries(status, next_attempt_at)",
+		"CREATE INDEX IF NOT EXISTS idx_webhook_endpoints_user_id ON webhook_endpoints(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status_next_attempt ON webhook_deliveries(status, next_attempt_at)",
+		"CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint_id ON webhook_deliveries(endpoint_id)",
+		"CREATE INDEX IF NOT EXISTS idx_calendar_feeds_user_id ON calendar_feeds(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_app_passwords_user_id ON app_passwords(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_session ON refresh_tokens(user_id, session_id)",
+		"CREATE INDEX IF NOT EXISTS idx_devices_user_session ON devices(user_id, session_id)",
+	}
+
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			return fmt.Errorf("failed to create SQLite table: %v", err)
+		}
+	}
+	return upgradeSQLiteTables(db)
+}
+
+// upgradeSQLiteTables 为旧版本创建的SQLite数据库补充新增的列
+func upgradeSQLiteTables(db *sql.DB) error {
+	for _, table := range []string{"todos", "categories"} {
+		if err := addSQLiteColumn(db, table, "uuid", "VARCHAR(36) NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+		if err := backfillUUIDs(db, table); err != nil {
+			return err
+		}
+	}
+	if err := addSQLiteColumn(db, "todos", "recurrence", "VARCHAR(255)"); err != nil {
+		return err
+	}
+	if err := addSQLiteColumn(db, "devices", "push_token", "VARCHAR(255) NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addSQLiteColumn(db, "user_settings", "daily_digest", "BOOLEAN NOT NULL DEFAULT TRUE"); err != nil {
+		return err
+	}
+	if err := backfillSearchIndex(&sqlDB{conn: db, dialect: sqliteDialect}, "id NOT IN (SELECT rowid FROM todos_fts)"); err != nil {
+		return fmt.Errorf("failed to build search index: %v", err)
+	}
+
+	indexes := []string{
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_todos_user_id_uuid ON todos(user_id, uuid)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_user_id_uuid ON categories(user_id, uuid)",
+	}
+	for _, index := range indexes {
+		if _, err := db.Exec(index); err != nil {
+			return fmt.Errorf("failed to create SQLite index: %v", err)
+		}
+	}
+	return nil
+}
+
+// addSQLiteColumn 列不存在时添加该列
+func addSQLiteColumn(db *sql.DB, table, column, definition string) error {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %v", table, column, err)
+	}
+	return nil
+}
+
+// backfillUUIDs 为升级前创建的数据生成UUID
+func backfillUUIDs(db *sql.DB, table string) error {
+	rows, err := db.Query(fmt.Sprintf("SELECT id FROM %s WHERE uuid = ''", table))
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if _, err := db.Exec(fmt.Sprintf("UPDATE %s SET uuid = ? WHERE id = ?", table), uuid.NewString(), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+)
+
+// DeviceRepository 设备数据访问层
+type DeviceRepository struct {
+	db *sqlDB
+}
+
+// CreateDevice 注册设备
+func (r *DeviceRepository) CreateDevice(device *Device) error {
+	query := `
+		INSERT INTO devices (id, user_id, name, platform, session_id, push_token, last_sync_version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	_, err := r.db.Exec(query, device.ID, device.UserID, device.Name, device.Platform, device.SessionID,
+		device.PushToken, device.LastSyncVersion, device.CreatedAt, device.UpdatedAt)
+	return translateError(err)
+}
+
+// scanDevice 扫描单行设备数据
+func scanDevice(scanner interface{ Scan(dest ...any) error }) (*Device, error) {
+	var device Device
+	err := scanner.Scan(&device.ID, &device.UserID, &device.Name, &device.Platform, &device.SessionID,
+		&device.PushToken, &device.LastSyncVersion, &device.LastSyncedAt, &device.CreatedAt, &device.UpdatedAt, &device.RevokedAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &device, nil
+}
+
+// GetDeviceByID 根据ID获取设备
+func (r *DeviceRepository) GetDeviceByID(deviceID string, userID int) (*Device, error) {
+	query := `
+		SELECT id, user_id, name, platform, session_id, push_token, last_sync_version, last_synced_at,
+			created_at, updated_at, revoked_at
+		FROM devices
+		WHERE id = $1 AND user_id = $2`
+
+	return scanDevice(r.db.QueryRow(query, deviceID, userID))
+}
+
+// GetDeviceBySessionID 获取绑定到某个登录会话的设备
+func (r *DeviceRepository) GetDeviceBySessionID(userID int, sessionID string) (*Device, error) {
+	query := `
+		SELECT id, user_id, name, platform, session_id, push_token, last_sync_version, last_synced_at,
+			created_at, updated_at, revoked_at
+		FROM devices
+		WHERE user_id = $1 AND session_id = $2`
+
+	return scanDevice(r.db.QueryRow(query, userID, sessionID))
+}
+
+// GetDevicesByUserID 获取用户的设备列表（包含已撤销的设备）
+func (r *DeviceRepository) GetDevicesByUserID(userID int) ([]Device, error) {
+	query := `
+		SELECT id, user_id, name, platform, session_id, push_token, last_sync_version, last_synced_at,
+			created_at, updated_at, revoked_at
+		FROM devices
+		WHERE user_id = $1
+		ORDER BY created_at ASC`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []Device
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, *device)
+	}
+
+	return devices, rows.Err()
+}
+
+// UpdateDevice 更新设备名称、平台、绑定会话、推送令牌和撤销状态
+func (r *DeviceRepository) UpdateDevice(device *Device) error {
+	query := `
+		UPDATE devices
+		SET name = $1, platform = $2, session_id = $3, push_token = $4, revoked_at = $5, updated_at = $6
+		WHERE id = $7 AND user_id = $8`
+
+	now := time.Now()
+	result, err := r.db.Exec(query, device.Name, device.Platform, device.SessionID, device.PushToken, device.RevokedAt,
+		now, device.ID, device.UserID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("device not found or not owned by user: %w", ErrNotFound)
+	}
+	device.UpdatedAt = now
+	return nil
+}
+
+// AckDeviceSyncVersion 记录设备已确认的同步版本号，只会前进不会回退
+func (r *DeviceRepository) AckDeviceSyncVersion(deviceID string, userID int, version int64, syncedAt time.Time) error {
+	query := fmt.Sprintf(`
+		UPDATE devices
+		SET last_sync_version = %s(last_sync_version, $1), last_synced_at = $2
+		WHERE id = $3 AND user_id = $4 AND revoked_at IS NULL`, r.db.dialect.greatest)
+
+	result, err := r.db.Exec(query, version, syncedAt, deviceID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("device not found or revoked: %w", ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 每日摘要在用户设置的通知时间（按用户时区）生成，投递记录按 (user_id, digest_date, channel) 唯一，
+// 同一天在每个渠道只投递一次。认领、重试规则与提醒投递记录相同。
+// TODO没有单独记录完成时间，前一天完成的TODO从修改历史中查找 completed 改为 true 的记录。
+
+// DigestRepository 每日摘要数据访问层
+type DigestRepository struct {
+	db *sqlDB
+}
+
+// GetDigestSubscribers 获取所有开启每日摘要的用户设置，以及每个用户最近一次生成投递记录的摘要日期，按用户ID排序
+func (r *DigestRepository) GetDigestSubscribers() ([]DigestSubscriber, error) {
+	query := `
+		SELECT u.id, s.notification_time, s.language, s.timezone,
+			(SELECT MAX(d.digest_date) FROM digest_deliveries d WHERE d.user_id = u.id)
+		FROM users u
+		LEFT JOIN user_settings s ON s.user_id = u.id
+		WHERE s.user_id IS NULL OR s.daily_digest = TRUE
+		ORDER BY u.id ASC`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscribers []DigestSubscriber
+	for rows.Next() {
+		var userID int
+		var notificationTime, language, timeZone, lastDigestDate sql.NullString
+		if err := rows.Scan(&userID, &notificationTime, &language, &timeZone, &lastDigestDate); err != nil {
+			return nil, err
+		}
+		// 没有保存过设置的用户使用默认设置
+		subscriber := DigestSubscriber{UserSettings: *defaultUserSettings(userID), LastDigestDate: lastDigestDate.String}
+		if notificationTime.Valid {
+			subscriber.NotificationTime = notificationTime.String
+		}
+		if language.Valid {
+			subscriber.Language = language.String
+		}
+		if timeZone.Valid {
+			subscriber.TimeZone = timeZone.String
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+
+	return subscribers, rows.Err()
+}
+
+// GetDailyDigest 获取用户的每日摘要内容：截止时间早于 now 的逾期TODO、截止时间在 [now, dayEnd) 内的TODO、
+// 紧急TODO，以及在 [yesterdayStart, dayStart) 内完成的TODO
+func (r *DigestRepository) GetDailyDigest(userID int, now, dayStart, dayEnd, yesterdayStart time.Time) (*DailyDigest, error) {
+	var digest DailyDigest
+	var err error
+
+	pending := `user_id = $1 AND completed = FALSE AND is_deleted = FALSE`
+	digest.Overdue, err = r.queryTodos(pending+` AND due_date IS NOT NULL AND due_date < $2
+		ORDER BY due_date ASC, id ASC`, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	digest.DueToday, err = r.queryTodos(pending+` AND due_date >= $2 AND due_date < $3
+		ORDER BY due_date ASC, id ASC`, userID, now, dayEnd)
+	if err != nil {
+		return nil, err
+	}
+	digest.Urgent, err = r.queryTodos(pending+` AND priority = $2
+		ORDER BY id ASC`, userID, PriorityUrgent)
+	if err != nil {
+		return nil, err
+	}
+
+	completedIDs, err := r.completedTodoIDs(userID, yesterdayStart, dayStart)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT ` + todoColumns + `
+		FROM todos
+		WHERE id = $1 AND user_id = $2 AND completed = TRUE AND is_deleted = FALSE`
+	digest.CompletedYesterday = []Todo{}
+	for _, todoID := range completedIDs {
+		todo, err := scanTodo(r.db.QueryRow(query, todoID, userID))
+		if errors.Is(err, ErrNotFound) {
+			// 之后又被取消完成或删除
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		digest.CompletedYesterday = append(digest.CompletedYesterday, *todo)
+	}
+
+	return &digest, nil
+}
+
+// queryTodos 按条件查询TODO
+func (r *DigestRepository) queryTodos(condition string, args ...any) ([]Todo, error) {
+	rows, err := r.db.Query(`SELECT `+todoColumns+` FROM todos WHERE `+condition, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	todos := []Todo{}
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, *todo)
+	}
+	return todos, rows.Err()
+}
+
+// completedTodoIDs 从修改历史中查找在 [from, to) 内被标记为完成的TODO，按首次完成的时间排序
+func (r *DigestRepository) completedTodoIDs(userID int, from, to time.Time) ([]int, error) {
+	query := `
+		SELECT entity_id, changes
+		FROM todo_revisions
+		WHERE user_id = $1 AND entity_type = $2 AND created_at >= $3 AND created_at < $4
+		ORDER BY id ASC`
+
+	rows, err := r.db.Query(query, userID, SyncTypeTodo, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	seen := make(map[int]bool)
+	for rows.Next() {
+		var todoID int
+		var changes RevisionChanges
+		if err := rows.Scan(&todoID, &changes); err != nil {
+			return nil, err
+		}
+		if !seen[todoID] && isCompletion(changes) {
+			seen[todoID] = true
+			ids = append(ids, todoID)
+		}
+	}
+	return ids, rows.Err()
+}
+
+// isCompletion 修改记录是否把TODO标记为完成
+func isCompletion(changes RevisionChanges) bool {
+	change, ok := changes["completed"]
+	return ok && string(change.New) == "true"
+}
+
+// digestDeliveryColumns 查询每日摘要投递记录时选择的列，与 scanDigestDelivery 的扫描顺序一致
+const digestDeliveryColumns = `id, user_id, digest_date, channel, status, attempts, last_error,
+			next_attempt_at, claimed_by, claimed_until, sent_at, created_at, updated_at`
+
+// scanDigestDelivery 扫描单行每日摘要投递记录
+func scanDigestDelivery(scanner interface{ Scan(dest ...any) error }) (*DigestDelivery, error) {
+	var delivery DigestDelivery
+	err := scanner.Scan(&delivery.ID, &delivery.UserID, &delivery.DigestDate, &delivery.Channel,
+		&delivery.Status, &delivery.Attempts, &delivery.LastError, &delivery.NextAttemptAt, &delivery.ClaimedBy,
+		&delivery.ClaimedUntil, &delivery.SentAt, &delivery.CreatedAt, &delivery.UpdatedAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &delivery, nil
+}
+
+// CreateDigestDelivery 生成待发送的每日摘要投递记录，同一用户、日期和渠道的记录已存在时返回 ErrDuplicate
+func (r *DigestRepository) CreateDigestDelivery(delivery *DigestDelivery) error {
+	query := `
+		INSERT INTO digest_deliveries (user_id, digest_date, channel, status, next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id, digest_date, channel) DO NOTHING
+		RETURNING id`
+
+	now := time.Now()
+	delivery.Status = DeliveryPending
+	if delivery.NextAttemptAt.IsZero() {
+		delivery.NextAttemptAt = now
+	}
+	err := r.db.QueryRow(query, delivery.UserID, delivery.DigestDate, delivery.Channel,
+		delivery.Status, delivery.NextAttemptAt, now, now).Scan(&delivery.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: digest delivery already exists", ErrDuplicate)
+	}
+	if err != nil {
+		return translateError(err)
+	}
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+	return nil
+}
+
+// ClaimDigestDeliveries 以 owner 身份认领最多 limit 条可以发送的每日摘要投递记录，规则与 ClaimReminderDeliveries 相同
+func (r *DigestRepository) ClaimDigestDeliveries(owner string, now, leaseUntil time.Time, limit int) ([]DigestDelivery, error) {
+	return claimDeliveries(r.db, "digest_deliveries", digestDeliveryColumns, scanDigestDelivery, owner, now, leaseUntil, limit)
+}
+
+// FinishDigestDelivery 保存认领后的发送结果并释放认领，记录已不再由 delivery.ClaimedBy 认领时返回 ErrNotFound
+func (r *DigestRepository) FinishDigestDelivery(delivery *DigestDelivery) error {
+	now, err := finishDelivery(r.db, "digest_deliveries", delivery.ID, delivery.ClaimedBy,
+		delivery.Status, delivery.LastError, delivery.NextAttemptAt, delivery.SentAt)
+	if err != nil {
+		return err
+	}
+	delivery.ClaimedBy = ""
+	delivery.ClaimedUntil = nil
+	delivery.UpdatedAt = now
+	return nil
+}
+
+// GetDigestDeliveries 获取用户的每日摘要投递记录，按创建时间从新到旧排序
+func (r *DigestRepository) GetDigestDeliveries(userID int) ([]DigestDelivery, error) {
+	query := `
+		SELECT ` + digestDeliveryColumns + `
+		FROM digest_deliveries
+		WHERE user_id = $1
+		ORDER BY id DESC`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []DigestDelivery
+	for rows.Next() {
+		delivery, err := scanDigestDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+
+	return deliveries, rows.Err()
+}
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStoreDigestSubscribers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		bob := &User{Username: "bob", Email: "bob@example.com", Password: "hashed"}
+		carol := &User{Username: "carol", Email: "carol@example.com", Password: "hashed"}
+		for _, user := range []*User{bob, carol} {
+			if err := store.CreateUser(user); err != nil {
+				t.Fatalf("CreateUser() error = %v", err)
+			}
+		}
+
+		// bob 修改了通知时间，carol 关闭了每日摘要，tester 没有保存过设置
+		settings, err := store.GetUserSettings(bob.ID)
+		if err != nil || !settings.DailyDigest {
+			t.Fatalf("GetUserSettings() = %+v, %v; want daily digest enabled by default", settings, err)
+		}
+		settings.NotificationTime = "07:30"
+		settings.TimeZone = "Europe/Berlin"
+		if err := store.UpdateUserSettings(settings); err != nil {
+			t.Fatalf("UpdateUserSettings() error = %v", err)
+		}
+		settings, _ = store.GetUserSettings(carol.ID)
+		settings.DailyDigest = false
+		if err := store.UpdateUserSettings(settings); err != nil {
+			t.Fatalf("UpdateUserSettings() error = %v", err)
+		}
+
+		delivery := &DigestDelivery{UserID: bob.ID, DigestDate: "2026-10-16", Channel: "email"}
+		if err := store.CreateDigestDelivery(delivery); err != nil {
+			t.Fatalf("CreateDigestDelivery() error = %v", err)
+		}
+
+		subscribers, err := store.GetDigestSubscribers()
+		if err != nil || len(subscribers) != 2 {
+			t.Fatalf("GetDigestSubscribers() = %+v, %v; want tester and bob", subscribers, err)
+		}
+		if subscribers[0].UserID != userID || subscribers[0].NotificationTime != "09:00:00" ||
+			subscribers[0].TimeZone != "Asia/Shanghai" || subscribers[0].LastDigestDate != "" {
+			t.Errorf("subscriber without settings = %+v", subscribers[0])
+		}
+		if subscribers[1].UserID != bob.ID || subscribers[1].TimeZone != "Europe/Berlin" || subscribers[1].LastDigestDate != "2026-10-16" {
+			t.Errorf("subscriber with settings = %+v", subscribers[1])
+		}
+	})
+}
+
+func TestStoreDailyDigest(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		now := time.Now().Truncate(time.Second)
+		dayStart := now.Add(-time.Hour)
+		dayEnd := now.Add(3 * time.Hour)
+		yesterday := now.Add(-2 * time.Hour)
+		lastWeek := now.Add(-7 * 24 * time.Hour)
+		evening := now.Add(2 * time.Hour)
+		tomorrow := now.Add(5 * time.Hour)
+
+		overdue := &Todo{UserID: userID, Title: "逾期", DueDate: &lastWeek}
+		dueToday := &Todo{UserID: userID, Title: "今晚", DueDate: &evening, Priority: PriorityUrgent}
+		later := &Todo{UserID: userID, Title: "明天", DueDate: &tomorrow}
+		done := &Todo{UserID: userID, Title: "买牛奶"}
+		reopened := &Todo{UserID: userID, Title: "重新打开"}
+		for _, todo := range []*Todo{overdue, dueToday, later, done, reopened} {
+			if err := store.CreateTodoExtended(todo); err != nil {
+				t.Fatalf("CreateTodoExtended() error = %v", err)
+			}
+		}
+		for _, todo := range []*Todo{done, reopened} {
+			todo.Completed = true
+			if err := store.UpdateTodoExtended(todo); err != nil {
+				t.Fatalf("UpdateTodoExtended() error = %v", err)
+			}
+		}
+		reopened.Completed = false
+		if err := store.UpdateTodoExtended(reopened); err != nil {
+			t.Fatalf("UpdateTodoExtended() error = %v", err)
+		}
+
+		// 修改历史的时间为当前时间，把“昨天”设为包含当前时间的区间
+		digest, err := store.GetDailyDigest(userID, now, now.Add(time.Minute), dayEnd, yesterday)
+		if err != nil {
+			t.Fatalf("GetDailyDigest() error = %v", err)
+		}
+		if len(digest.Overdue) != 1 || digest.Overdue[0].ID != overdue.ID {
+			t.Errorf("Overdue = %+v", digest.Overdue)
+		}
+		if len(digest.DueToday) != 1 || digest.DueToday[0].ID != dueToday.ID {
+			t.Errorf("DueToday = %+v", digest.DueToday)
+		}
+		if len(digest.Urgent) != 1 || digest.Urgent[0].ID != dueToday.ID {
+			t.Errorf("Urgent = %+v", digest.Urgent)
+		}
+		if len(digest.CompletedYesterday) != 1 || digest.CompletedYesterday[0].ID != done.ID {
+			t.Errorf("CompletedYesterday = %+v", digest.CompletedYesterday)
+		}
+
+		// 当天完成的TODO不属于前一天
+		digest, err = store.GetDailyDigest(userID, now, dayStart, dayEnd, dayStart.Add(-24*time.Hour))
+		if err != nil || len(digest.CompletedYesterday) != 0 || digest.IsEmpty() {
+			t.Errorf("GetDailyDigest(today) = %+v, %v", digest, err)
+		}
+	})
+}
+
+func TestStoreDigestDeliveries(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		now := time.Now().Truncate(time.Second)
+		for _, channel := range []string{"email", "push"} {
+			delivery := &DigestDelivery{UserID: userID, DigestDate: "2026-10-16", Channel: channel, NextAttemptAt: now}
+			if err := store.CreateDigestDelivery(delivery); err != nil {
+				t.Fatalf("CreateDigestDelivery(%s) error = %v", channel, err)
+			}
+		}
+		duplicate := &DigestDelivery{UserID: userID, DigestDate: "2026-10-16", Channel: "email"}
+		if err := store.CreateDigestDelivery(duplicate); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("CreateDigestDelivery(duplicate) error = %v, want ErrDuplicate", err)
+		}
+
+		claimed, err := store.ClaimDigestDeliveries("instance-a", now, now.Add(time.Minute), 1)
+		if err != nil || len(claimed) != 1 || claimed[0].Status != DeliverySending || claimed[0].Attempts != 1 {
+			t.Fatalf("ClaimDigestDeliveries(a) = %+v, %v", claimed, err)
+		}
+		other, err := store.ClaimDigestDeliveries("instance-b", now, now.Add(time.Minute), 10)
+		if err != nil || len(other) != 1 || other[0].ID == claimed[0].ID {
+			t.Fatalf("ClaimDigestDeliveries(b) = %+v, %v", other, err)
+		}
+
+		sent := claimed[0]
+		sent.Status = DeliverySent
+		sent.SentAt = &now
+		if err := store.FinishDigestDelivery(&sent); err != nil {
+			t.Fatalf("FinishDigestDelivery() error = %v", err)
+		}
+		stale := other[0]
+		stale.ClaimedBy = "instance-c"
+		stale.Status = DeliverySent
+		if err := store.FinishDigestDelivery(&stale); !errors.Is(err, ErrNotFound) {
+			t.Errorf("FinishDigestDelivery(not owner) error = %v, want ErrNotFound", err)
+		}
+
+		deliveries, err := store.GetDigestDeliveries(userID)
+		if err != nil || len(deliveries) != 2 {
+			t.Fatalf("GetDigestDeliveries() = %+v, %v", deliveries, err)
+		}
+		statuses := map[string]string{}
+		for _, delivery := range deliveries {
+			statuses[delivery.Channel] = delivery.Status
+		}
+		if statuses["email"] != DeliverySent || statuses["push"] != DeliverySending {
+			t.Errorf("statuses = %v", statuses)
+		}
+	})
+}
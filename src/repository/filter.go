@@ -0,0 +1,435 @@
+package repository
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSort 不支持的排序字段
+var ErrInvalidSort = errors.New("invalid sort field")
+
+// TODO列表支持的排序字段
+const (
+	SortPriority  = "priority"
+	SortDueDate   = "due_date"
+	SortCreatedAt = "created_at"
+	SortUpdatedAt = "updated_at"
+	SortTitle     = "title"
+	SortRelevance = "relevance" // 搜索相关度，仅在按关键词搜索时有意义
+)
+
+// 标签筛选方式
+const (
+	TagMatchAny = "any" // 包含任一标签
+	TagMatchAll = "all" // 包含全部标签
+)
+
+// TodoFilter TODO列表筛选条件，零值字段表示不按该条件筛选，各条件之间为"与"关系。
+// 时间范围均为左闭右开 [After, Before)
+type TodoFilter struct {
+	Search        *SearchQuery // 搜索查询，语法见 ParseSearchQuery
+	Completed     *bool
+	Priorities    []Priority
+	CategoryIDs   []int
+	Uncategorized bool     // 包含未分类的TODO，与 CategoryIDs 为"或"关系
+	CategoryNames []string // 按分类名称筛选，匹配任一名称
+	Tags          []string // 按 TagMatch 匹配，默认 any
+	TagMatch      string
+	DueAfter      *time.Time
+	DueBefore     *time.Time
+	Overdue       bool      // 只返回截止时间早于 Now 且未完成的TODO
+	Now           time.Time // 判断逾期的当前时间
+	HasDueDate    *bool
+	HasReminder   *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	Deleted       bool // 只返回已删除的TODO（回收站），默认只返回未删除的TODO
+}
+
+// TodoSort 排序键，截止时间为空的TODO无论升降序都排在最后
+type TodoSort struct {
+	Field string
+	Desc  bool
+}
+
+// DefaultTodoSort 未指定排序时按创建时间倒序
+var DefaultTodoSort = []TodoSort{{Field: SortCreatedAt, Desc: true}}
+
+// TodoKey TODO在列表中的位置，由排序键和ID组成，用于键集分页
+type TodoKey struct {
+	ID        int        `json:"id"`
+	Priority  Priority   `json:"p,omitempty"`
+	DueDate   *time.Time `json:"d,omitempty"`
+	CreatedAt time.Time  `json:"c"`
+	UpdatedAt time.Time  `json:"u"`
+	Title     string     `json:"t,omitempty"`
+	Rank      float64    `json:"r,omitempty"`
+}
+
+// KeyOf 返回TODO的列表位置
+func KeyOf(todo *Todo) TodoKey {
+	return TodoKey{ID: todo.ID, Priority: todo.Priority, DueDate: todo.DueDate,
+		CreatedAt: todo.CreatedAt, UpdatedAt: todo.UpdatedAt, Title: todo.Title, Rank: todo.SearchRank}
+}
+
+// todo 将位置转换为只包含排序键的TODO，便于复用 compareTodos
+func (k *TodoKey) todo() *Todo {
+	return &Todo{ID: k.ID, Priority: k.Priority, DueDate: k.DueDate,
+		CreatedAt: k.CreatedAt, UpdatedAt: k.UpdatedAt, Title: k.Title, SearchRank: k.Rank}
+}
+
+// TodoQuery TODO列表查询条件
+type TodoQuery struct {
+	Filter TodoFilter
+	Sort   []TodoSort // 为空时使用 DefaultTodoSort，最后总是按ID排序保证顺序稳定
+	After  *TodoKey   // 非空时只返回排在该位置之后的TODO（键集分页），需与生成位置时的排序一致
+	Limit  int
+	Offset int
+}
+
+// sorts 返回实际使用的排序键，并检查字段是否受支持
+func (q *TodoQuery) sorts() ([]TodoSort, error) {
+	if len(q.Sort) == 0 {
+		return DefaultTodoSort, nil
+	}
+	for _, sort := range q.Sort {
+		switch sort.Field {
+		case SortPriority, SortDueDate, SortCreatedAt, SortUpdatedAt, SortTitle, SortRelevance:
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSort, sort.Field)
+		}
+	}
+	return q.Sort, nil
+}
+
+// Match 判断TODO是否满足筛选条件，供内存存储使用，语义与SQL实现一致；categories 用于按名称匹配分类
+func (f *TodoFilter) Match(todo *Todo, categories map[int]*Category) bool {
+	if f.Search != nil && !f.Search.match(todo, categories) {
+		return false
+	}
+	if f.Completed != nil && todo.Completed != *f.Completed {
+		return false
+	}
+	if len(f.Priorities) > 0 && !containsValue(f.Priorities, todo.Priority) {
+		return false
+	}
+	if len(f.CategoryIDs) > 0 || f.Uncategorized {
+		if todo.CategoryID == nil {
+			if !f.Uncategorized {
+				return false
+			}
+		} else if !containsValue(f.CategoryIDs, *todo.CategoryID) {
+			return false
+		}
+	}
+	if len(f.CategoryNames) > 0 {
+		if todo.CategoryID == nil {
+			return false
+		}
+		category, ok := categories[*todo.CategoryID]
+		if !ok || category.IsDeleted || !containsValue(f.CategoryNames, category.Name) {
+			return false
+		}
+	}
+	if len(f.Tags) > 0 {
+		matched := 0
+		for _, tag := range f.Tags {
+			if containsValue(todo.Tags, tag) {
+				matched++
+			}
+		}
+		if matched == 0 || (f.TagMatch == TagMatchAll && matched < len(f.Tags)) {
+			return false
+		}
+	}
+	if !timeInRange(todo.DueDate, f.DueAfter, f.DueBefore) {
+		return false
+	}
+	if f.Overdue && (todo.DueDate == nil || !todo.DueDate.Before(f.Now) || todo.Completed) {
+		return false
+	}
+	if f.HasDueDate != nil && (todo.DueDate != nil) != *f.HasDueDate {
+		return false
+	}
+	if f.HasReminder != nil && (todo.Reminder != nil) != *f.HasReminder {
+		return false
+	}
+	return timeInRange(&todo.CreatedAt, f.CreatedAfter, f.CreatedBefore) &&
+		timeInRange(&todo.UpdatedAt, f.UpdatedAfter, f.UpdatedBefore)
+}
+
+func containsValue[T comparable](values []T, v T) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// timeInRange 判断时间是否在 [after, before) 内，未限定范围时总是满足，限定范围时空值不满足
+func timeInRange(t, after, before *time.Time) bool {
+	if after == nil && before == nil {
+		return true
+	}
+	if t == nil {
+		return false
+	}
+	return (after == nil || !t.Before(*after)) && (before == nil || t.Before(*before))
+}
+
+// compareTodos 按排序键比较两个TODO，返回负数表示 a 排在前面
+func compareTodos(a, b *Todo, sorts []TodoSort) int {
+	for _, sort := range sorts {
+		var c int
+		switch sort.Field {
+		case SortPriority:
+			c = int(a.Priority) - int(b.Priority)
+		case SortDueDate:
+			// 截止时间为空的排在最后，不受排序方向影响
+			if a.DueDate == nil || b.DueDate == nil {
+				if a.DueDate != nil {
+					return -1
+				}
+				if b.DueDate != nil {
+					return 1
+				}
+				continue
+			}
+			c = a.DueDate.Compare(*b.DueDate)
+		case SortCreatedAt:
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		case SortUpdatedAt:
+			c = a.UpdatedAt.Compare(b.UpdatedAt)
+		case SortTitle:
+			c = strings.Compare(a.Title, b.Title)
+		case SortRelevance:
+			c = cmp.Compare(a.SearchRank, b.SearchRank)
+		}
+		if sort.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	// ID排序方向与最后一个排序键一致
+	c := a.ID - b.ID
+	if sorts[len(sorts)-1].Desc {
+		c = -c
+	}
+	return c
+}
+
+// ===== SQL条件 =====
+
+// sqlArgs 按顺序收集查询参数
+type sqlArgs []any
+
+// add 添加参数并返回其占位符
+func (a *sqlArgs) add(v any) string {
+	*a = append(*a, v)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// todoFilterConditions 将筛选条件转换为WHERE子句中的条件列表
+func todoFilterConditions(d dialect, f *TodoFilter, args *sqlArgs) []string {
+	var conditions []string
+	if f.Search != nil {
+		conditions = append(conditions, searchConditions(d, f.Search, args)...)
+	}
+	if f.Completed != nil {
+		conditions = append(conditions, "completed = "+args.add(*f.Completed))
+	}
+	if len(f.Priorities) > 0 {
+		placeholders := make([]string, len(f.Priorities))
+		for i, priority := range f.Priorities {
+			placeholders[i] = args.add(priority)
+		}
+		conditions = append(conditions, "priority IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if len(f.CategoryIDs) > 0 || f.Uncategorized {
+		var alternatives []string
+		if len(f.CategoryIDs) > 0 {
+			placeholders := make([]string, len(f.CategoryIDs))
+			for i, categoryID := range f.CategoryIDs {
+				placeholders[i] = args.add(categoryID)
+			}
+			alternatives = append(alternatives, "category_id IN ("+strings.Join(placeholders, ", ")+")")
+		}
+		if f.Uncategorized {
+			alternatives = append(alternatives, "category_id IS NULL")
+		}
+		conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	if len(f.CategoryNames) > 0 {
+		placeholders := make([]string, len(f.CategoryNames))
+		for i, name := range f.CategoryNames {
+			placeholders[i] = args.add(name)
+		}
+		conditions = append(conditions, `category_id IN (SELECT categories.id FROM categories
+			WHERE categories.user_id = todos.user_id AND categories.is_deleted = FALSE
+			AND categories.name IN (`+strings.Join(placeholders, ", ")+"))")
+	}
+	if len(f.Tags) > 0 {
+		tagConditions := make([]string, len(f.Tags))
+		for i, tag := range f.Tags {
+			tagConditions[i] = fmt.Sprintf(d.hasTag, args.add(tag))
+		}
+		operator := " OR "
+		if f.TagMatch == TagMatchAll {
+			operator = " AND "
+		}
+		conditions = append(conditions, "("+strings.Join(tagConditions, operator)+")")
+	}
+	conditions = appendTimeRange(conditions, args, "due_date", f.DueAfter, f.DueBefore)
+	if f.Overdue {
+		conditions = append(conditions, "due_date < "+args.add(f.Now), "completed = FALSE")
+	}
+	if f.HasDueDate != nil {
+		if *f.HasDueDate {
+			conditions = append(conditions, "due_date IS NOT NULL")
+		} else {
+			conditions = append(conditions, "due_date IS NULL")
+		}
+	}
+	if f.HasReminder != nil {
+		if *f.HasReminder {
+			conditions = append(conditions, "reminder IS NOT NULL")
+		} else {
+			conditions = append(conditions, "reminder IS NULL")
+		}
+	}
+	conditions = appendTimeRange(conditions, args, "created_at", f.CreatedAfter, f.CreatedBefore)
+	conditions = appendTimeRange(conditions, args, "updated_at", f.UpdatedAfter, f.UpdatedBefore)
+	return conditions
+}
+
+// searchConditions 将搜索查询转换为条件列表。排除条件的值为NULL时视为不满足被排除的条件，与内存实现一致
+func searchConditions(d dialect, q *SearchQuery, args *sqlArgs) []string {
+	if q.IsEmpty() {
+		return []string{"FALSE"}
+	}
+	not := func(condition string) string {
+		return "NOT COALESCE(" + condition + ", FALSE)"
+	}
+
+	var conditions []string
+	if len(q.clauses) > 0 {
+		conditions = append(conditions, fmt.Sprintf(d.searchMatch, args.add(d.searchQuery(q.clauses, false))))
+	}
+	if len(q.excluded) > 0 {
+		conditions = append(conditions, not(fmt.Sprintf(d.searchMatch, args.add(d.searchQuery(q.excluded, true)))))
+	}
+	for i := range q.filters {
+		condition := "(" + strings.Join(todoFilterConditions(d, &q.filters[i].filter, args), " AND ") + ")"
+		if q.filters[i].negate {
+			condition = not(condition)
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions
+}
+
+// appendTimeRange 添加 [after, before) 时间范围条件
+func appendTimeRange(conditions []string, args *sqlArgs, column string, after, before *time.Time) []string {
+	if after != nil {
+		conditions = append(conditions, column+" >= "+args.add(*after))
+	}
+	if before != nil {
+		conditions = append(conditions, column+" < "+args.add(*before))
+	}
+	return conditions
+}
+
+// todoSearchRank 返回搜索相关度的SQL表达式，没有搜索词时为常量0
+func todoSearchRank(d dialect, f *TodoFilter, args *sqlArgs) string {
+	if f.Search == nil || len(f.Search.clauses) == 0 {
+		return "0.0"
+	}
+	return fmt.Sprintf(d.searchRank, args.add(d.searchQuery(f.Search.clauses, false)))
+}
+
+// sortColumn 返回排序字段对应的SQL表达式
+func sortColumn(field, rank string) string {
+	if field == SortRelevance {
+		return rank
+	}
+	return field
+}
+
+// todoKeysetCondition 生成键集分页条件，匹配排在 key 之后的TODO，与 compareTodos(todo, key) > 0 一致。
+// 按排序键展开为 (k1 后于 v1) OR (k1 = v1 AND k2 后于 v2) OR ... OR (各键相等 AND id 后于 key.ID)；rank 为搜索相关度表达式
+func todoKeysetCondition(sorts []TodoSort, key *TodoKey, rank string, args *sqlArgs) string {
+	after := func(desc bool) string {
+		if desc {
+			return " < "
+		}
+		return " > "
+	}
+
+	var alternatives, equal []string
+	for _, sort := range sorts {
+		var later, same string
+		switch sort.Field {
+		case SortDueDate:
+			// 截止时间为空的排在最后：非空值之后是更晚（或更早）的截止时间和所有空值，空值之后没有更后的截止时间
+			if key.DueDate == nil {
+				same = "due_date IS NULL"
+			} else {
+				later = "(due_date" + after(sort.Desc) + args.add(*key.DueDate) + " OR due_date IS NULL)"
+				same = "due_date = " + args.add(*key.DueDate)
+			}
+		default:
+			var value any
+			switch sort.Field {
+			case SortPriority:
+				value = key.Priority
+			case SortCreatedAt:
+				value = key.CreatedAt
+			case SortUpdatedAt:
+				value = key.UpdatedAt
+			case SortTitle:
+				value = key.Title
+			case SortRelevance:
+				value = key.Rank
+			}
+			column := sortColumn(sort.Field, rank)
+			later = column + after(sort.Desc) + args.add(value)
+			same = column + " = " + args.add(value)
+		}
+		if later != "" {
+			alternatives = append(alternatives, "("+strings.Join(append(equal[:len(equal):len(equal)], later), " AND ")+")")
+		}
+		equal = append(equal, same)
+	}
+	idAfter := "id" + after(sorts[len(sorts)-1].Desc) + args.add(key.ID)
+	alternatives = append(alternatives, "("+strings.Join(append(equal, idAfter), " AND ")+")")
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
+
+// todoOrderBy 生成ORDER BY子句，与 compareTodos 的顺序一致；rank 为搜索相关度表达式
+func todoOrderBy(sorts []TodoSort, rank string) string {
+	direction := func(desc bool) string {
+		if desc {
+			return "DESC"
+		}
+		return "ASC"
+	}
+
+	var keys []string
+	for _, sort := range sorts {
+		if sort.Field == SortDueDate {
+			keys = append(keys, "(due_date IS NULL) ASC")
+		}
+		keys = append(keys, sortColumn(sort.Field, rank)+" "+direction(sort.Desc))
+	}
+	keys = append(keys, "id "+direction(sorts[len(sorts)-1].Desc))
+	return strings.Join(keys, ", ")
+}
@@ -0,0 +1,32 @@
+package repository
+
+// IdempotencyKeyRepository 幂等键数据访问层
+type IdempotencyKeyRepository struct {
+	db *sqlDB
+}
+
+// CreateIdempotencyKey 记录幂等键对应的数据，应与创建数据在同一事务中调用
+func (r *IdempotencyKeyRepository) CreateIdempotencyKey(key *IdempotencyKey) error {
+	query := `
+		INSERT INTO idempotency_keys (user_id, idempotency_key, resource_type, resource_id, created_at)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := r.db.Exec(query, key.UserID, key.Key, key.ResourceType, key.ResourceID, key.CreatedAt)
+	return translateError(err)
+}
+
+// GetIdempotencyKey 获取幂等键记录
+func (r *IdempotencyKeyRepository) GetIdempotencyKey(userID int, key string) (*IdempotencyKey, error) {
+	query := `
+		SELECT user_id, idempotency_key, resource_type, resource_id, created_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND idempotency_key = $2`
+
+	var result IdempotencyKey
+	err := r.db.QueryRow(query, userID, key).Scan(&result.UserID, &result.Key, &result.ResourceType,
+		&result.ResourceID, &result.CreatedAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &result, nil
+}
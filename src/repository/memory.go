@@ -0,0 +1,2535 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore 纯内存存储实现，主要用于单元测试，进程退出后数据丢失
+type MemoryStore struct {
+	*memoryData
+	mu   *sync.RWMutex
+	inTx bool // 事务视图，外层 WithTx 已持有写锁
+
+	hub      *ChangeHub
+	changes  *changeLog // 当前事务中的写入，提交后发布
+	deviceID string     // 写入修改历史的设备ID，见 WithDevice
+}
+
+// memoryData 内存存储的全部数据，新增字段时需同步修改 clone
+type memoryData struct {
+	users      map[int]*User
+	todos      map[int]*Todo
+	categories map[int]*Category
+	checklist  map[int]*ChecklistItem
+	tags       map[int]*Tag
+	smartLists map[int]*SmartList
+	settings   map[int]*UserSettings
+	tokens     map[int]*RefreshToken
+	devices    map[string]*Device
+	snapshots  map[int][]Todo // 按TODO ID保存的历史快照，按版本号升序
+	revisions  map[int]*Revision
+	deliveries map[int]*ReminderDelivery
+	digests    map[int]*DigestDelivery
+
+	webhookEndpoints  map[int]*WebhookEndpoint
+	webhookEvents     map[int]*WebhookEvent
+	webhookDeliveries map[int]*WebhookDelivery
+
+	calendarFeeds map[int]*CalendarFeed
+	appPasswords  map[int]*AppPassword
+
+	idempotencyKeys map[idempotencyKeyID]*IdempotencyKey
+
+	syncVersions map[int]int64 // 每个用户的同步版本号计数器
+
+	nextUserID     int
+	nextTodoID     int
+	nextCategoryID int
+	nextItemID     int
+	nextTagID      int
+	nextListID     int
+	nextTokenID    int
+	nextRevisionID int
+	nextDeliveryID int
+	nextDigestID   int
+
+	nextEndpointID        int
+	nextWebhookEventID    int
+	nextWebhookDeliveryID int
+	nextFeedID            int
+	nextAppPasswordID     int
+}
+
+// NewMemoryStore 创建内存存储实例
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		memoryData: &memoryData{
+			users:      make(map[int]*User),
+			todos:      make(map[int]*Todo),
+			categories: make(map[int]*Category),
+			checklist:  make(map[int]*ChecklistItem),
+			tags:       make(map[int]*Tag),
+			smartLists: make(map[int]*SmartList),
+			settings:   make(map[int]*UserSettings),
+			tokens:     make(map[int]*RefreshToken),
+			devices:    make(map[string]*Device),
+			snapshots:  make(map[int][]Todo),
+			revisions:  make(map[int]*Revision),
+			deliveries: make(map[int]*ReminderDelivery),
+			digests:    make(map[int]*DigestDelivery),
+
+			webhookEndpoints:  make(map[int]*WebhookEndpoint),
+			webhookEvents:     make(map[int]*WebhookEvent),
+			webhookDeliveries: make(map[int]*WebhookDelivery),
+
+			calendarFeeds: make(map[int]*CalendarFeed),
+			appPasswords:  make(map[int]*AppPassword),
+
+			idempotencyKeys: make(map[idempotencyKeyID]*IdempotencyKey),
+
+			syncVersions: make(map[int]int64),
+		},
+		mu:  &sync.RWMutex{},
+		hub: NewChangeHub(),
+	}
+}
+
+// clone 深拷贝全部数据，用于事务回滚
+func (d *memoryData) clone() *memoryData {
+	cp := *d
+	cp.users = cloneMap(d.users, func(v User) User { return v })
+	cp.todos = cloneMap(d.todos, func(v Todo) Todo { return copyTodo(&v) })
+	cp.categories = cloneMap(d.categories, func(v Category) Category { return v })
+	cp.checklist = cloneMap(d.checklist, func(v ChecklistItem) ChecklistItem { return v })
+	cp.tags = cloneMap(d.tags, func(v Tag) Tag { return v })
+	cp.smartLists = cloneMap(d.smartLists, func(v SmartList) SmartList { return copySmartList(&v) })
+	cp.settings = cloneMap(d.settings, func(v UserSettings) UserSettings { return v })
+	cp.tokens = cloneMap(d.tokens, func(v RefreshToken) RefreshToken { return v })
+	cp.devices = cloneMap(d.devices, func(v Device) Device { return v })
+	cp.idempotencyKeys = cloneMap(d.idempotencyKeys, func(v IdempotencyKey) IdempotencyKey { return v })
+	cp.revisions = cloneMap(d.revisions, func(v Revision) Revision { return v })
+	cp.deliveries = cloneMap(d.deliveries, func(v ReminderDelivery) ReminderDelivery { return v })
+	cp.digests = cloneMap(d.digests, func(v DigestDelivery) DigestDelivery { return v })
+	cp.webhookEndpoints = cloneMap(d.webhookEndpoints, func(v WebhookEndpoint) WebhookEndpoint { return copyWebhookEndpoint(&v) })
+	cp.webhookEvents = cloneMap(d.webhookEvents, func(v WebhookEvent) WebhookEvent { return v })
+	cp.webhookDeliveries = cloneMap(d.webhookDeliveries, func(v WebhookDelivery) WebhookDelivery { return v })
+	cp.calendarFeeds = cloneMap(d.calendarFeeds, func(v CalendarFeed) CalendarFeed { return v })
+	cp.appPasswords = cloneMap(d.appPasswords, func(v AppPassword) AppPassword { return v })
+	cp.snapshots = make(map[int][]Todo, len(d.snapshots))
+	for id, snapshots := range d.snapshots {
+		cp.snapshots[id] = append([]Todo(nil), snapshots...)
+	}
+	cp.syncVersions = make(map[int]int64, len(d.syncVersions))
+	for userID, version := range d.syncVersions {
+		cp.syncVersions[userID] = version
+	}
+	return &cp
+}
+
+// cloneMap 复制指针值的map，copyValue 负责值内部引用字段的深拷贝
+func cloneMap[K comparable, V any](m map[K]*V, copyValue func(V) V) map[K]*V {
+	cp := make(map[K]*V, len(m))
+	for k, v := range m {
+		value := copyValue(*v)
+		cp[k] = &value
+	}
+	return cp
+}
+
+func (s *MemoryStore) lock() {
+	if !s.inTx {
+		s.mu.Lock()
+	}
+}
+
+func (s *MemoryStore) unlock() {
+	if !s.inTx {
+		s.mu.Unlock()
+	}
+}
+
+func (s *MemoryStore) rlock() {
+	if !s.inTx {
+		s.mu.RLock()
+	}
+}
+
+func (s *MemoryStore) runlock() {
+	if !s.inTx {
+		s.mu.RUnlock()
+	}
+}
+
+// WithTx 在事务中执行fn，fn返回错误时恢复执行前的全部数据。
+// 事务期间持有写锁，其他读写会等待事务结束；嵌套调用相当于保存点
+func (s *MemoryStore) WithTx(fn func(tx Store) error) error {
+	s.lock()
+	defer s.unlock()
+
+	changes := s.changes
+	if changes == nil {
+		changes = &changeLog{}
+	}
+	recorded := len(*changes)
+
+	backup := s.memoryData.clone()
+	tx := &MemoryStore{memoryData: s.memoryData, mu: s.mu, inTx: true, hub: s.hub, changes: changes, deviceID: s.deviceID}
+	if err := fn(tx); err != nil {
+		*s.memoryData = *backup
+		*changes = (*changes)[:recorded]
+		return err
+	}
+	if s.changes == nil {
+		for _, event := range changes.events() {
+			s.hub.Publish(event)
+		}
+	}
+	return nil
+}
+
+// WithDevice 返回以指定设备身份写入的存储视图，与原存储共享数据，写入的修改历史记录该设备
+func (s *MemoryStore) WithDevice(deviceID string) Store {
+	cp := *s
+	cp.deviceID = deviceID
+	return &cp
+}
+
+// SubscribeChanges 订阅用户的数据变更通知
+func (s *MemoryStore) SubscribeChanges(userID int) (<-chan ChangeEvent, func()) {
+	return s.hub.Subscribe(userID)
+}
+
+// recordChange 记录一次写入，事务中提交后发布，否则立即发布。调用方需持有写锁
+func (s *MemoryStore) recordChange(userID int, syncVersion int64, entity ChangedEntity) {
+	record := changeRecord{userID: userID, syncVersion: syncVersion, entity: entity}
+	if s.changes != nil {
+		*s.changes = append(*s.changes, record)
+		return
+	}
+	for _, event := range (changeLog{record}).events() {
+		s.hub.Publish(event)
+	}
+}
+
+// Close 内存存储无需释放资源
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// copyTodo 复制TODO，避免调用方修改内部状态
+func copyTodo(todo *Todo) Todo {
+	cp := *todo
+	cp.Tags = append(StringSlice{}, todo.Tags...)
+	if todo.DueDate != nil {
+		dueDate := *todo.DueDate
+		cp.DueDate = &dueDate
+	}
+	if todo.Reminder != nil {
+		reminder := *todo.Reminder
+		cp.Reminder = &reminder
+	}
+	if todo.CategoryID != nil {
+		categoryID := *todo.CategoryID
+		cp.CategoryID = &categoryID
+	}
+	if todo.CategoryUUID != nil {
+		categoryUUID := *todo.CategoryUUID
+		cp.CategoryUUID = &categoryUUID
+	}
+	if todo.Recurrence != nil {
+		recurrence := *todo.Recurrence
+		cp.Recurrence = &recurrence
+	}
+	return cp
+}
+
+// readTodo 复制TODO并填充关联分类的UUID和检查项数量，调用方需持有读锁
+func (s *MemoryStore) readTodo(todo *Todo) Todo {
+	cp := copyTodo(todo)
+	cp.CategoryUUID = nil
+	if todo.CategoryID != nil {
+		if category, ok := s.categories[*todo.CategoryID]; ok {
+			categoryUUID := category.UUID
+			cp.CategoryUUID = &categoryUUID
+		}
+	}
+	cp.ChecklistTotal, cp.ChecklistCompleted = 0, 0
+	for _, item := range s.checklist {
+		if item.TodoID == todo.ID && !item.IsDeleted {
+			cp.ChecklistTotal++
+			if item.Completed {
+				cp.ChecklistCompleted++
+			}
+		}
+	}
+	return cp
+}
+
+// ===== 用户 =====
+
+// CreateUser 创建用户
+func (s *MemoryStore) CreateUser(user *User) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, existing := range s.users {
+		if existing.Username == user.Username || existing.Email == user.Email {
+			return fmt.Errorf("%w: username or email already exists", ErrDuplicate)
+		}
+	}
+
+	now := time.Now()
+	s.nextUserID++
+	user.ID = s.nextUserID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	stored := *user
+	s.users[user.ID] = &stored
+	return nil
+}
+
+// GetUserByUsername 根据用户名获取用户
+func (s *MemoryStore) GetUserByUsername(username string) (*User, error) {
+	s.rlock()
+	defer s.runlock()
+
+	for _, user := range s.users {
+		if user.Username == username {
+			cp := *user
+			return &cp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetUserByID 根据ID获取用户
+func (s *MemoryStore) GetUserByID(userID int) (*User, error) {
+	s.rlock()
+	defer s.runlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *user
+	return &cp, nil
+}
+
+// ===== TODO =====
+
+// CreateTodoExtended 创建扩展TODO
+func (s *MemoryStore) CreateTodoExtended(todo *Todo) error {
+	s.lock()
+	defer s.unlock()
+
+	if todo.UUID == "" {
+		todo.UUID = uuid.NewString()
+	}
+	for _, existing := range s.todos {
+		if existing.UserID == todo.UserID && existing.UUID == todo.UUID {
+			return fmt.Errorf("%w: todo uuid already exists", ErrDuplicate)
+		}
+	}
+
+	now := time.Now()
+	s.nextTodoID++
+	todo.ID = s.nextTodoID
+	todo.CreatedAt = now
+	todo.UpdatedAt = now
+	todo.SyncVersion = s.nextSyncVersion(todo.UserID)
+
+	stored := copyTodo(todo)
+	s.todos[todo.ID] = &stored
+	s.saveTodoSnapshot(&stored)
+	s.saveTodoRevision(nil, &stored)
+	s.recordChange(todo.UserID, todo.SyncVersion, ChangedEntity{Type: SyncTypeTodo, ID: todo.ID, UUID: todo.UUID})
+	return nil
+}
+
+// sortedTodos 按条件筛选TODO并排序
+func (s *MemoryStore) sortedTodos(match func(*Todo) bool, less func(a, b *Todo) bool) []Todo {
+	var matched []*Todo
+	for _, todo := range s.todos {
+		if match(todo) {
+			matched = append(matched, todo)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return less(matched[i], matched[j]) })
+
+	todos := make([]Todo, 0, len(matched))
+	for _, todo := range matched {
+		todos = append(todos, s.readTodo(todo))
+	}
+	return todos
+}
+
+// createdDesc 按创建时间倒序，时间相同时按ID倒序
+func createdDesc(a, b *Todo) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID > b.ID
+}
+
+// paginate 对结果进行分页
+func paginate(todos []Todo, limit, offset int) []Todo {
+	if offset >= len(todos) {
+		return nil
+	}
+	todos = todos[offset:]
+	if limit >= 0 && limit < len(todos) {
+		todos = todos[:limit]
+	}
+	return todos
+}
+
+// GetTodosByUserIDExtended 根据用户ID获取扩展TODO列表
+func (s *MemoryStore) GetTodosByUserIDExtended(userID int, limit, offset int) ([]Todo, error) {
+	s.rlock()
+	defer s.runlock()
+
+	todos := s.sortedTodos(func(t *Todo) bool {
+		return t.UserID == userID && !t.IsDeleted
+	}, createdDesc)
+	return paginate(todos, limit, offset), nil
+}
+
+// ListTodos 按筛选条件和排序获取TODO列表
+func (s *MemoryStore) ListTodos(userID int, query TodoQuery) ([]Todo, error) {
+	sorts, err := query.sorts()
+	if err != nil {
+		return nil, err
+	}
+
+	s.rlock()
+	defer s.runlock()
+
+	var todos []Todo
+	for _, t := range s.todos {
+		if t.UserID != userID || t.IsDeleted != query.Filter.Deleted || !query.Filter.Match(t, s.categories) {
+			continue
+		}
+		todo := s.readTodo(t)
+		if query.Filter.Search != nil {
+			todo.SearchRank = query.Filter.Search.Rank(&todo)
+		}
+		if query.After == nil || compareTodos(&todo, query.After.todo(), sorts) > 0 {
+			todos = append(todos, todo)
+		}
+	}
+	sort.Slice(todos, func(i, j int) bool { return compareTodos(&todos[i], &todos[j], sorts) < 0 })
+	return paginate(todos, query.Limit, query.Offset), nil
+}
+
+// CountTodos 统计满足筛选条件的TODO数量
+func (s *MemoryStore) CountTodos(userID int, filter TodoFilter) (int, error) {
+	s.rlock()
+	defer s.runlock()
+
+	count := 0
+	for _, todo := range s.todos {
+		if todo.UserID == userID && todo.IsDeleted == filter.Deleted && filter.Match(todo, s.categories) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// UpdateTodoExtended 更新扩展TODO
+func (s *MemoryStore) UpdateTodoExtended(todo *Todo) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.todos[todo.ID]
+	if !ok || existing.UserID != todo.UserID {
+		return fmt.Errorf("todo not found or not owned by user: %w", ErrNotFound)
+	}
+
+	now := time.Now()
+	todo.UUID = existing.UUID
+	todo.CreatedAt = existing.CreatedAt
+	todo.UpdatedAt = now
+	todo.SyncVersion = s.nextSyncVersion(todo.UserID)
+
+	stored := copyTodo(todo)
+	s.todos[todo.ID] = &stored
+	s.saveTodoSnapshot(&stored)
+	s.saveTodoRevision(existing, &stored)
+	s.recordChange(todo.UserID, todo.SyncVersion, ChangedEntity{Type: SyncTypeTodo, ID: todo.ID, UUID: todo.UUID})
+	return nil
+}
+
+// DeleteTodo 删除TODO（物理删除）
+func (s *MemoryStore) DeleteTodo(todoID, userID int) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.todos[todoID]
+	if !ok || existing.UserID != userID {
+		return fmt.Errorf("todo not found or not owned by user: %w", ErrNotFound)
+	}
+	s.saveTodoRevision(existing, nil)
+	delete(s.todos, todoID)
+	delete(s.snapshots, todoID)
+	for id, item := range s.checklist {
+		if item.TodoID == todoID {
+			delete(s.checklist, id)
+		}
+	}
+	for id, delivery := range s.deliveries {
+		if delivery.TodoID == todoID {
+			delete(s.deliveries, id)
+		}
+	}
+	return nil
+}
+
+// GetTodosSince 按版本号顺序获取同步版本号在 (since, until] 区间内的TODO（用于增量同步），limit < 0 表示不限制数量
+func (s *MemoryStore) GetTodosSince(userID int, since, until int64, limit int) ([]Todo, error) {
+	s.rlock()
+	defer s.runlock()
+
+	todos := s.sortedTodos(func(t *Todo) bool {
+		return t.UserID == userID && t.SyncVersion > since && t.SyncVersion <= until
+	}, func(a, b *Todo) bool {
+		if a.SyncVersion != b.SyncVersion {
+			return a.SyncVersion < b.SyncVersion
+		}
+		return a.ID < b.ID
+	})
+	return paginate(todos, limit, 0), nil
+}
+
+// GetTodoByID 根据ID获取单个TODO
+func (s *MemoryStore) GetTodoByID(todoID, userID int) (*Todo, error) {
+	s.rlock()
+	defer s.runlock()
+
+	todo, ok := s.todos[todoID]
+	if !ok || todo.UserID != userID || todo.IsDeleted {
+		return nil, ErrNotFound
+	}
+	cp := s.readTodo(todo)
+	return &cp, nil
+}
+
+// GetDeletedTodo 根据ID获取回收站中的TODO
+func (s *MemoryStore) GetDeletedTodo(todoID, userID int) (*Todo, error) {
+	s.rlock()
+	defer s.runlock()
+
+	todo, ok := s.todos[todoID]
+	if !ok || todo.UserID != userID || !todo.IsDeleted {
+		return nil, ErrNotFound
+	}
+	cp := s.readTodo(todo)
+	return &cp, nil
+}
+
+// GetTodoByUUID 根据客户端UUID获取单个TODO（包含已删除的TODO）
+func (s *MemoryStore) GetTodoByUUID(userID int, uuid string) (*Todo, error) {
+	s.rlock()
+	defer s.runlock()
+
+	for _, todo := range s.todos {
+		if todo.UserID == userID && todo.UUID == uuid {
+			cp := s.readTodo(todo)
+			return &cp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// saveTodoSnapshot 保存TODO当前版本的快照，并清理超出保留数量的旧快照，调用方需持有写锁
+func (s *MemoryStore) saveTodoSnapshot(todo *Todo) {
+	snapshots := append(s.snapshots[todo.ID], copyTodo(todo))
+	if len(snapshots) > TodoSnapshotRetention {
+		snapshots = snapshots[len(snapshots)-TodoSnapshotRetention:]
+	}
+	s.snapshots[todo.ID] = snapshots
+}
+
+// GetTodoSnapshot 获取TODO在指定同步版本时的快照
+func (s *MemoryStore) GetTodoSnapshot(todoID, userID int, syncVersion int64) (*Todo, error) {
+	s.rlock()
+	defer s.runlock()
+
+	for _, snapshot := range s.snapshots[todoID] {
+		if snapshot.UserID == userID && snapshot.SyncVersion == syncVersion {
+			cp := copyTodo(&snapshot)
+			return &cp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ===== 分类 =====
+
+// categoryNameTaken 检查同一用户下分类名称是否已被占用
+func (s *MemoryStore) categoryNameTaken(userID int, name string, excludeID int) bool {
+	for _, category := range s.categories {
+		if category.UserID == userID && category.Name == name && category.ID != excludeID {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateCategory 创建分类
+func (s *MemoryStore) CreateCategory(category *Category) error {
+	s.lock()
+	defer s.unlock()
+
+	if s.categoryNameTaken(category.UserID, category.Name, 0) {
+		return fmt.Errorf("%w: category name already exists", ErrDuplicate)
+	}
+	if category.UUID == "" {
+		category.UUID = uuid.NewString()
+	}
+	for _, existing := range s.categories {
+		if existing.UserID == category.UserID && existing.UUID == category.UUID {
+			return fmt.Errorf("%w: category uuid already exists", ErrDuplicate)
+		}
+	}
+
+	now := time.Now()
+	s.nextCategoryID++
+	category.ID = s.nextCategoryID
+	category.CreatedAt = now
+	category.UpdatedAt = now
+	category.SyncVersion = s.nextSyncVersion(category.UserID)
+
+	stored := *category
+	s.categories[category.ID] = &stored
+	s.saveCategoryRevision(nil, &stored)
+	s.recordChange(category.UserID, category.SyncVersion, ChangedEntity{Type: SyncTypeCategory, ID: category.ID, UUID: category.UUID})
+	return nil
+}
+
+// sortedCategories 按条件筛选分类并排序
+func (s *MemoryStore) sortedCategories(match func(*Category) bool, less func(a, b *Category) bool) []Category {
+	var matched []*Category
+	for _, category := range s.categories {
+		if match(category) {
+			matched = append(matched, category)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return less(matched[i], matched[j]) })
+
+	categories := make([]Category, 0, len(matched))
+	for _, category := range matched {
+		categories = append(categories, *category)
+	}
+	return categories
+}
+
+// GetCategoriesByUserID 根据用户ID获取分类列表
+func (s *MemoryStore) GetCategoriesByUserID(userID int) ([]Category, error) {
+	s.rlock()
+	defer s.runlock()
+
+	return s.sortedCategories(func(c *Category) bool {
+		return c.UserID == userID && !c.IsDeleted
+	}, func(a, b *Category) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	}), nil
+}
+
+// UpdateCategory 更新分类
+func (s *MemoryStore) UpdateCategory(category *Category) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.categories[category.ID]
+	if !ok || existing.UserID != category.UserID {
+		return fmt.Errorf("category not found or not owned by user: %w", ErrNotFound)
+	}
+	if s.categoryNameTaken(category.UserID, category.Name, category.ID) {
+		return fmt.Errorf("%w: category name already exists", ErrDuplicate)
+	}
+
+	previous := *existing
+	now := time.Now()
+	existing.Name = category.Name
+	existing.Color = category.Color
+	existing.Icon = category.Icon
+	existing.UpdatedAt = now
+	existing.SyncVersion = s.nextSyncVersion(existing.UserID)
+	s.saveCategoryRevision(&previous, existing)
+
+	category.UUID = existing.UUID
+	category.UpdatedAt = existing.UpdatedAt
+	category.SyncVersion = existing.SyncVersion
+	s.recordChange(existing.UserID, existing.SyncVersion, ChangedEntity{Type: SyncTypeCategory, ID: existing.ID, UUID: existing.UUID})
+	return nil
+}
+
+// DeleteCategory 删除分类（软删除）
+func (s *MemoryStore) DeleteCategory(id, userID int) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.categories[id]
+	if !ok || existing.UserID != userID {
+		return fmt.Errorf("category not found or not owned by user: %w", ErrNotFound)
+	}
+
+	previous := *existing
+	now := time.Now()
+	existing.IsDeleted = true
+	existing.UpdatedAt = now
+	existing.SyncVersion = s.nextSyncVersion(userID)
+	s.saveCategoryRevision(&previous, existing)
+	s.recordChange(userID, existing.SyncVersion, ChangedEntity{Type: SyncTypeCategory, ID: existing.ID, UUID: existing.UUID})
+	return nil
+}
+
+// GetDeletedCategories 获取回收站中的分类，按删除时间从新到旧排序
+func (s *MemoryStore) GetDeletedCategories(userID int) ([]Category, error) {
+	s.rlock()
+	defer s.runlock()
+
+	return s.sortedCategories(func(c *Category) bool {
+		return c.UserID == userID && c.IsDeleted
+	}, func(a, b *Category) bool {
+		if !a.UpdatedAt.Equal(b.UpdatedAt) {
+			return a.UpdatedAt.After(b.UpdatedAt)
+		}
+		return a.ID > b.ID
+	}), nil
+}
+
+// RestoreCategory 恢复已删除的分类
+func (s *MemoryStore) RestoreCategory(id, userID int) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.categories[id]
+	if !ok || existing.UserID != userID {
+		return fmt.Errorf("category not found or not owned by user: %w", ErrNotFound)
+	}
+	if !existing.IsDeleted {
+		return fmt.Errorf("category is not deleted: %w", ErrNotFound)
+	}
+
+	previous := *existing
+	existing.IsDeleted = false
+	existing.UpdatedAt = time.Now()
+	existing.SyncVersion = s.nextSyncVersion(userID)
+	s.saveCategoryRevision(&previous, existing)
+	s.recordChange(userID, existing.SyncVersion, ChangedEntity{Type: SyncTypeCategory, ID: existing.ID, UUID: existing.UUID})
+	return nil
+}
+
+// PurgeCategory 物理删除已删除的分类，与数据库的 ON DELETE SET NULL 一致，引用该分类的TODO不再属于任何分类
+func (s *MemoryStore) PurgeCategory(id, userID int) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.categories[id]
+	if !ok || existing.UserID != userID {
+		return fmt.Errorf("category not found or not owned by user: %w", ErrNotFound)
+	}
+	if !existing.IsDeleted {
+		return fmt.Errorf("category is not deleted: %w", ErrNotFound)
+	}
+
+	s.saveCategoryRevision(existing, nil)
+	delete(s.categories, id)
+	for feedID, feed := range s.calendarFeeds {
+		if feed.CategoryID != nil && *feed.CategoryID == id {
+			delete(s.calendarFeeds, feedID)
+		}
+	}
+	for _, todo := range s.todos {
+		if todo.CategoryID != nil && *todo.CategoryID == id {
+			todo.CategoryID = nil
+		}
+	}
+	return nil
+}
+
+// GetCategoriesSince 按版本号顺序获取同步版本号在 (since, until] 区间内的分类（用于增量同步），limit < 0 表示不限制数量
+func (s *MemoryStore) GetCategoriesSince(userID int, since, until int64, limit int) ([]Category, error) {
+	s.rlock()
+	defer s.runlock()
+
+	categories := s.sortedCategories(func(c *Category) bool {
+		return c.UserID == userID && c.SyncVersion > since && c.SyncVersion <= until
+	}, func(a, b *Category) bool {
+		if a.SyncVersion != b.SyncVersion {
+			return a.SyncVersion < b.SyncVersion
+		}
+		return a.ID < b.ID
+	})
+	if limit >= 0 && limit < len(categories) {
+		categories = categories[:limit]
+	}
+	return categories, nil
+}
+
+// GetCategoryByID 根据ID获取单个分类
+func (s *MemoryStore) GetCategoryByID(categoryID, userID int) (*Category, error) {
+	s.rlock()
+	defer s.runlock()
+
+	category, ok := s.categories[categoryID]
+	if !ok || category.UserID != userID {
+		return nil, ErrNotFound
+	}
+	cp := *category
+	return &cp, nil
+}
+
+// GetCategoryByUUID 根据客户端UUID获取单个分类（包含已删除的分类）
+func (s *MemoryStore) GetCategoryByUUID(userID int, uuid string) (*Category, error) {
+	s.rlock()
+	defer s.runlock()
+
+	for _, category := range s.categories {
+		if category.UserID == userID && category.UUID == uuid {
+			cp := *category
+			return &cp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ===== 检查项 =====
+
+// readChecklistItem 复制检查项并填充所属TODO的UUID，调用方需持有读锁
+func (s *MemoryStore) readChecklistItem(item *ChecklistItem) ChecklistItem {
+	cp := *item
+	if todo, ok := s.todos[item.TodoID]; ok {
+		cp.TodoUUID = todo.UUID
+	}
+	return cp
+}
+
+// sortedChecklistItems 按条件筛选检查项并排序
+func (s *MemoryStore) sortedChecklistItems(match func(*ChecklistItem) bool, less func(a, b *ChecklistItem) bool) []ChecklistItem {
+	var matched []*ChecklistItem
+	for _, item := range s.checklist {
+		if match(item) {
+			matched = append(matched, item)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return less(matched[i], matched[j]) })
+
+	items := make([]ChecklistItem, 0, len(matched))
+	for _, item := range matched {
+		items = append(items, s.readChecklistItem(item))
+	}
+	return items
+}
+
+// CreateChecklistItem 创建检查项，Position 为0时排在该TODO现有检查项之后
+func (s *MemoryStore) CreateChecklistItem(item *ChecklistItem) error {
+	s.lock()
+	defer s.unlock()
+
+	todo, ok := s.todos[item.TodoID]
+	if !ok || todo.UserID != item.UserID {
+		return fmt.Errorf("todo not found or not owned by user: %w", ErrNotFound)
+	}
+	if item.UUID == "" {
+		item.UUID = uuid.NewString()
+	}
+	for _, existing := range s.checklist {
+		if existing.UserID == item.UserID && existing.UUID == item.UUID {
+			return fmt.Errorf("%w: checklist item uuid already exists", ErrDuplicate)
+		}
+	}
+	if item.Position == 0 {
+		for _, existing := range s.checklist {
+			if existing.TodoID == item.TodoID && !existing.IsDeleted {
+				item.Position = max(item.Position, existing.Position)
+			}
+		}
+		item.Position++
+	}
+
+	now := time.Now()
+	s.nextItemID++
+	item.ID = s.nextItemID
+	item.TodoUUID = todo.UUID
+	item.CreatedAt = now
+	item.UpdatedAt = now
+	item.SyncVersion = s.nextSyncVersion(item.UserID)
+
+	stored := *item
+	s.checklist[item.ID] = &stored
+	s.recordChange(item.UserID, item.SyncVersion, ChangedEntity{Type: SyncTypeChecklistItem, ID: item.ID, UUID: item.UUID})
+	return nil
+}
+
+// GetChecklistItemsByTodoID 获取TODO未删除的检查项，按位置排序
+func (s *MemoryStore) GetChecklistItemsByTodoID(todoID, userID int) ([]ChecklistItem, error) {
+	s.rlock()
+	defer s.runlock()
+
+	return s.sortedChecklistItems(func(item *ChecklistItem) bool {
+		return item.TodoID == todoID && item.UserID == userID && !item.IsDeleted
+	}, func(a, b *ChecklistItem) bool {
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+		return a.ID < b.ID
+	}), nil
+}
+
+// GetChecklistItemByID 根据ID获取单个未删除的检查项
+func (s *MemoryStore) GetChecklistItemByID(itemID, userID int) (*ChecklistItem, error) {
+	s.rlock()
+	defer s.runlock()
+
+	item, ok := s.checklist[itemID]
+	if !ok || item.UserID != userID || item.IsDeleted {
+		return nil, ErrNotFound
+	}
+	cp := s.readChecklistItem(item)
+	return &cp, nil
+}
+
+// GetChecklistItemByUUID 根据客户端UUID获取单个检查项（包含已删除的检查项）
+func (s *MemoryStore) GetChecklistItemByUUID(userID int, uuid string) (*ChecklistItem, error) {
+	s.rlock()
+	defer s.runlock()
+
+	for _, item := range s.checklist {
+		if item.UserID == userID && item.UUID == uuid {
+			cp := s.readChecklistItem(item)
+			return &cp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// UpdateChecklistItem 更新检查项的标题、完成状态和位置，检查项不能移动到其他TODO
+func (s *MemoryStore) UpdateChecklistItem(item *ChecklistItem) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.checklist[item.ID]
+	if !ok || existing.UserID != item.UserID || existing.IsDeleted {
+		return fmt.Errorf("checklist item not found or not owned by user: %w", ErrNotFound)
+	}
+
+	existing.Title = item.Title
+	existing.Completed = item.Completed
+	existing.Position = item.Position
+	existing.UpdatedAt = time.Now()
+	existing.SyncVersion = s.nextSyncVersion(existing.UserID)
+
+	item.UUID = existing.UUID
+	item.TodoID = existing.TodoID
+	item.UpdatedAt = existing.UpdatedAt
+	item.SyncVersion = existing.SyncVersion
+	s.recordChange(existing.UserID, existing.SyncVersion, ChangedEntity{Type: SyncTypeChecklistItem, ID: existing.ID, UUID: existing.UUID})
+	return nil
+}
+
+// DeleteChecklistItem 删除检查项（软删除）
+func (s *MemoryStore) DeleteChecklistItem(itemID, userID int) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.checklist[itemID]
+	if !ok || existing.UserID != userID || existing.IsDeleted {
+		return fmt.Errorf("checklist item not found or not owned by user: %w", ErrNotFound)
+	}
+
+	existing.IsDeleted = true
+	existing.UpdatedAt = time.Now()
+	existing.SyncVersion = s.nextSyncVersion(userID)
+	s.recordChange(userID, existing.SyncVersion, ChangedEntity{Type: SyncTypeChecklistItem, ID: existing.ID, UUID: existing.UUID})
+	return nil
+}
+
+// GetChecklistItemsSince 按版本号顺序获取同步版本号在 (since, until] 区间内的检查项（用于增量同步），limit < 0 表示不限制数量
+func (s *MemoryStore) GetChecklistItemsSince(userID int, since, until int64, limit int) ([]ChecklistItem, error) {
+	s.rlock()
+	defer s.runlock()
+
+	items := s.sortedChecklistItems(func(item *ChecklistItem) bool {
+		return item.UserID == userID && item.SyncVersion > since && item.SyncVersion <= until
+	}, func(a, b *ChecklistItem) bool {
+		if a.SyncVersion != b.SyncVersion {
+			return a.SyncVersion < b.SyncVersion
+		}
+		return a.ID < b.ID
+	})
+	if limit >= 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+// ===== 标签 =====
+
+// tagNameTaken 检查同一用户下未删除的标签名称是否已被占用
+func (s *MemoryStore) tagNameTaken(userID int, name string, excludeID int) bool {
+	for _, tag := range s.tags {
+		if tag.UserID == userID && tag.Name == name && !tag.IsDeleted && tag.ID != excludeID {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedTags 按条件筛选标签并排序
+func (s *MemoryStore) sortedTags(match func(*Tag) bool, less func(a, b *Tag) bool) []Tag {
+	var matched []*Tag
+	for _, tag := range s.tags {
+		if match(tag) {
+			matched = append(matched, tag)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return less(matched[i], matched[j]) })
+
+	tags := make([]Tag, 0, len(matched))
+	for _, tag := range matched {
+		tags = append(tags, *tag)
+	}
+	return tags
+}
+
+// CreateTag 创建标签元数据
+func (s *MemoryStore) CreateTag(tag *Tag) error {
+	s.lock()
+	defer s.unlock()
+
+	if s.tagNameTaken(tag.UserID, tag.Name, 0) {
+		return fmt.Errorf("%w: tag name already exists", ErrDuplicate)
+	}
+	if tag.UUID == "" {
+		tag.UUID = uuid.NewString()
+	}
+	for _, existing := range s.tags {
+		if existing.UserID == tag.UserID && existing.UUID == tag.UUID {
+			return fmt.Errorf("%w: tag uuid already exists", ErrDuplicate)
+		}
+	}
+
+	now := time.Now()
+	s.nextTagID++
+	tag.ID = s.nextTagID
+	tag.CreatedAt = now
+	tag.UpdatedAt = now
+	tag.SyncVersion = s.nextSyncVersion(tag.UserID)
+
+	stored := *tag
+	stored.UsageCount = 0
+	s.tags[tag.ID] = &stored
+	s.recordChange(tag.UserID, tag.SyncVersion, ChangedEntity{Type: SyncTypeTag, ID: tag.ID, UUID: tag.UUID})
+	return nil
+}
+
+// GetTagsByUserID 获取用户未删除的标签元数据，按名称排序
+func (s *MemoryStore) GetTagsByUserID(userID int) ([]Tag, error) {
+	s.rlock()
+	defer s.runlock()
+
+	return s.sortedTags(func(tag *Tag) bool {
+		return tag.UserID == userID && !tag.IsDeleted
+	}, func(a, b *Tag) bool {
+		return a.Name < b.Name
+	}), nil
+}
+
+// GetTagByID 根据ID获取单个未删除的标签
+func (s *MemoryStore) GetTagByID(tagID, userID int) (*Tag, error) {
+	s.rlock()
+	defer s.runlock()
+
+	tag, ok := s.tags[tagID]
+	if !ok || tag.UserID != userID || tag.IsDeleted {
+		return nil, ErrNotFound
+	}
+	cp := *tag
+	return &cp, nil
+}
+
+// GetTagByUUID 根据客户端UUID获取单个标签（包含已删除的标签）
+func (s *MemoryStore) GetTagByUUID(userID int, uuid string) (*Tag, error) {
+	s.rlock()
+	defer s.runlock()
+
+	for _, tag := range s.tags {
+		if tag.UserID == userID && tag.UUID == uuid {
+			cp := *tag
+			return &cp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetTagByName 根据名称获取单个未删除的标签
+func (s *MemoryStore) GetTagByName(userID int, name string) (*Tag, error) {
+	s.rlock()
+	defer s.runlock()
+
+	for _, tag := range s.tags {
+		if tag.UserID == userID && tag.Name == name && !tag.IsDeleted {
+			cp := *tag
+			return &cp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// UpdateTag 更新标签的名称、颜色和图标
+func (s *MemoryStore) UpdateTag(tag *Tag) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.tags[tag.ID]
+	if !ok || existing.UserID != tag.UserID || existing.IsDeleted {
+		return fmt.Errorf("tag not found or not owned by user: %w", ErrNotFound)
+	}
+	if s.tagNameTaken(tag.UserID, tag.Name, tag.ID) {
+		return fmt.Errorf("%w: tag name already exists", ErrDuplicate)
+	}
+
+	existing.Name = tag.Name
+	existing.Color = tag.Color
+	existing.Icon = tag.Icon
+	existing.UpdatedAt = time.Now()
+	existing.SyncVersion = s.nextSyncVersion(existing.UserID)
+
+	tag.UUID = existing.UUID
+	tag.UpdatedAt = existing.UpdatedAt
+	tag.SyncVersion = existing.SyncVersion
+	s.recordChange(existing.UserID, existing.SyncVersion, ChangedEntity{Type: SyncTypeTag, ID: existing.ID, UUID: existing.UUID})
+	return nil
+}
+
+// DeleteTag 删除标签元数据（软删除）
+func (s *MemoryStore) DeleteTag(tagID, userID int) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.tags[tagID]
+	if !ok || existing.UserID != userID || existing.IsDeleted {
+		return fmt.Errorf("tag not found or not owned by user: %w", ErrNotFound)
+	}
+
+	existing.IsDeleted = true
+	existing.UpdatedAt = time.Now()
+	existing.SyncVersion = s.nextSyncVersion(userID)
+	s.recordChange(userID, existing.SyncVersion, ChangedEntity{Type: SyncTypeTag, ID: existing.ID, UUID: existing.UUID})
+	return nil
+}
+
+// GetTagsSince 按版本号顺序获取同步版本号在 (since, until] 区间内的标签（用于增量同步），limit < 0 表示不限制数量
+func (s *MemoryStore) GetTagsSince(userID int, since, until int64, limit int) ([]Tag, error) {
+	s.rlock()
+	defer s.runlock()
+
+	tags := s.sortedTags(func(tag *Tag) bool {
+		return tag.UserID == userID && tag.SyncVersion > since && tag.SyncVersion <= until
+	}, func(a, b *Tag) bool {
+		if a.SyncVersion != b.SyncVersion {
+			return a.SyncVersion < b.SyncVersion
+		}
+		return a.ID < b.ID
+	})
+	if limit >= 0 && limit < len(tags) {
+		tags = tags[:limit]
+	}
+	return tags, nil
+}
+
+// CountTagUsage 统计用户未删除的TODO中每个标签的使用次数
+func (s *MemoryStore) CountTagUsage(userID int) (map[string]int, error) {
+	s.rlock()
+	defer s.runlock()
+
+	usage := make(map[string]int)
+	for _, todo := range s.todos {
+		if todo.UserID != userID || todo.IsDeleted {
+			continue
+		}
+		for _, name := range todo.Tags {
+			usage[name]++
+		}
+	}
+	return usage, nil
+}
+
+// ===== 智能列表 =====
+
+// copySmartList 复制智能列表，定义中的切片不与存储共享
+func copySmartList(list *SmartList) SmartList {
+	cp := *list
+	cp.Definition = list.Definition.clone()
+	return cp
+}
+
+// sortedSmartLists 按条件筛选智能列表并排序
+func (s *MemoryStore) sortedSmartLists(match func(*SmartList) bool, less func(a, b *SmartList) bool) []SmartList {
+	var matched []*SmartList
+	for _, list := range s.smartLists {
+		if match(list) {
+			matched = append(matched, list)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return less(matched[i], matched[j]) })
+
+	lists := make([]SmartList, 0, len(matched))
+	for _, list := range matched {
+		lists = append(lists, copySmartList(list))
+	}
+	return lists
+}
+
+// CreateSmartList 创建智能列表
+func (s *MemoryStore) CreateSmartList(list *SmartList) error {
+	s.lock()
+	defer s.unlock()
+
+	if list.UUID == "" {
+		list.UUID = uuid.NewString()
+	}
+	for _, existing := range s.smartLists {
+		if existing.UserID == list.UserID && existing.UUID == list.UUID {
+			return fmt.Errorf("%w: smart list uuid already exists", ErrDuplicate)
+		}
+	}
+
+	now := time.Now()
+	s.nextListID++
+	list.ID = s.nextListID
+	list.CreatedAt = now
+	list.UpdatedAt = now
+	list.SyncVersion = s.nextSyncVersion(list.UserID)
+
+	stored := copySmartList(list)
+	s.smartLists[list.ID] = &stored
+	s.recordChange(list.UserID, list.SyncVersion, ChangedEntity{Type: SyncTypeSmartList, ID: list.ID, UUID: list.UUID})
+	return nil
+}
+
+// GetSmartListsByUserID 获取用户未删除的智能列表，按创建时间排序
+func (s *MemoryStore) GetSmartListsByUserID(userID int) ([]SmartList, error) {
+	s.rlock()
+	defer s.runlock()
+
+	return s.sortedSmartLists(func(list *SmartList) bool {
+		return list.UserID == userID && !list.IsDeleted
+	}, func(a, b *SmartList) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	}), nil
+}
+
+// GetSmartListByID 根据ID获取单个未删除的智能列表
+func (s *MemoryStore) GetSmartListByID(listID, userID int) (*SmartList, error) {
+	s.rlock()
+	defer s.runlock()
+
+	list, ok := s.smartLists[listID]
+	if !ok || list.UserID != userID || list.IsDeleted {
+		return nil, ErrNotFound
+	}
+	cp := copySmartList(list)
+	return &cp, nil
+}
+
+// GetSmartListByUUID 根据客户端UUID获取单个智能列表（包含已删除的智能列表）
+func (s *MemoryStore) GetSmartListByUUID(userID int, uuid string) (*SmartList, error) {
+	s.rlock()
+	defer s.runlock()
+
+	for _, list := range s.smartLists {
+		if list.UserID == userID && list.UUID == uuid {
+			cp := copySmartList(list)
+			return &cp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// UpdateSmartList 更新智能列表的名称、图标、颜色和定义
+func (s *MemoryStore) UpdateSmartList(list *SmartList) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.smartLists[list.ID]
+	if !ok || existing.UserID != list.UserID || existing.IsDeleted {
+		return fmt.Errorf("smart list not found or not owned by user: %w", ErrNotFound)
+	}
+
+	existing.Name = list.Name
+	existing.Icon = list.Icon
+	existing.Color = list.Color
+	existing.Definition = list.Definition.clone()
+	existing.UpdatedAt = time.Now()
+	existing.SyncVersion = s.nextSyncVersion(existing.UserID)
+
+	list.UUID = existing.UUID
+	list.UpdatedAt = existing.UpdatedAt
+	list.SyncVersion = existing.SyncVersion
+	s.recordChange(existing.UserID, existing.SyncVersion, ChangedEntity{Type: SyncTypeSmartList, ID: existing.ID, UUID: existing.UUID})
+	return nil
+}
+
+// DeleteSmartList 删除智能列表（软删除）
+func (s *MemoryStore) DeleteSmartList(listID, userID int) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.smartLists[listID]
+	if !ok || existing.UserID != userID || existing.IsDeleted {
+		return fmt.Errorf("smart list not found or not owned by user: %w", ErrNotFound)
+	}
+
+	existing.IsDeleted = true
+	existing.UpdatedAt = time.Now()
+	existing.SyncVersion = s.nextSyncVersion(userID)
+	s.recordChange(userID, existing.SyncVersion, ChangedEntity{Type: SyncTypeSmartList, ID: existing.ID, UUID: existing.UUID})
+	return nil
+}
+
+// GetSmartListsSince 按版本号顺序获取同步版本号在 (since, until] 区间内的智能列表（用于增量同步），limit < 0 表示不限制数量
+func (s *MemoryStore) GetSmartListsSince(userID int, since, until int64, limit int) ([]SmartList, error) {
+	s.rlock()
+	defer s.runlock()
+
+	lists := s.sortedSmartLists(func(list *SmartList) bool {
+		return list.UserID == userID && list.SyncVersion > since && list.SyncVersion <= until
+	}, func(a, b *SmartList) bool {
+		if a.SyncVersion != b.SyncVersion {
+			return a.SyncVersion < b.SyncVersion
+		}
+		return a.ID < b.ID
+	})
+	if limit >= 0 && limit < len(lists) {
+		lists = lists[:limit]
+	}
+	return lists, nil
+}
+
+// ===== 用户设置 =====
+
+// GetUserSettings 获取用户设置，不存在时创建默认设置
+func (s *MemoryStore) GetUserSettings(userID int) (*UserSettings, error) {
+	s.rlock()
+	settings, ok := s.settings[userID]
+	s.runlock()
+
+	if !ok {
+		return s.CreateDefaultUserSettings(userID)
+	}
+	cp := *settings
+	return &cp, nil
+}
+
+// CreateDefaultUserSettings 创建默认用户设置
+func (s *MemoryStore) CreateDefaultUserSettings(userID int) (*UserSettings, error) {
+	s.lock()
+	defer s.unlock()
+
+	if _, ok := s.settings[userID]; ok {
+		return nil, fmt.Errorf("%w: user settings already exist", ErrDuplicate)
+	}
+
+	now := time.Now()
+	settings := defaultUserSettings(userID)
+	settings.CreatedAt = now
+	settings.UpdatedAt = now
+	settings.SyncVersion = s.nextSyncVersion(userID)
+
+	stored := *settings
+	s.settings[userID] = &stored
+	s.recordChange(userID, settings.SyncVersion, ChangedEntity{Type: SyncTypeSettings})
+	return settings, nil
+}
+
+// UpdateUserSettings 更新用户设置
+func (s *MemoryStore) UpdateUserSettings(settings *UserSettings) error {
+	s.lock()
+	defer s.unlock()
+
+	now := time.Now()
+	settings.UpdatedAt = now
+
+	// 与SQL实现保持一致：设置不存在时不做任何修改
+	existing, ok := s.settings[settings.UserID]
+	if !ok {
+		return nil
+	}
+	settings.SyncVersion = s.nextSyncVersion(settings.UserID)
+	existing.Theme = settings.Theme
+	existing.NotificationTime = settings.NotificationTime
+	existing.Language = settings.Language
+	existing.TimeZone = settings.TimeZone
+	existing.DailyDigest = settings.DailyDigest
+	existing.UpdatedAt = settings.UpdatedAt
+	existing.SyncVersion = settings.SyncVersion
+	s.recordChange(settings.UserID, settings.SyncVersion, ChangedEntity{Type: SyncTypeSettings})
+	s.emitWebhookEvent(settingsEvent(existing), *existing)
+	return nil
+}
+
+// GetUserSettingsSince 获取同步版本号在 (since, until] 区间内的用户设置（用于增量同步）
+func (s *MemoryStore) GetUserSettingsSince(userID int, since, until int64) (*UserSettings, error) {
+	s.rlock()
+	defer s.runlock()
+
+	settings, ok := s.settings[userID]
+	if !ok || settings.SyncVersion <= since || settings.SyncVersion > until {
+		return nil, nil
+	}
+	cp := *settings
+	return &cp, nil
+}
+
+// nextSyncVersion 为用户分配下一个同步版本号，调用方需持有写锁
+func (s *MemoryStore) nextSyncVersion(userID int) int64 {
+	s.syncVersions[userID]++
+	return s.syncVersions[userID]
+}
+
+// GetCurrentSyncVersion 获取用户当前同步版本号，即最后一次写入的版本号
+func (s *MemoryStore) GetCurrentSyncVersion(userID int) (int64, error) {
+	s.rlock()
+	defer s.runlock()
+
+	return s.syncVersions[userID], nil
+}
+
+// LockUserWrites 事务期间已持有写锁，无需额外加锁
+func (s *MemoryStore) LockUserWrites(userID int) error {
+	return nil
+}
+
+// ===== 刷新令牌 =====
+
+// CreateRefreshToken 保存刷新令牌
+func (s *MemoryStore) CreateRefreshToken(token *RefreshToken) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, existing := range s.tokens {
+		if existing.TokenHash == token.TokenHash {
+			return fmt.Errorf("%w: refresh token already exists", ErrDuplicate)
+		}
+	}
+
+	s.nextTokenID++
+	token.ID = s.nextTokenID
+	stored := *token
+	s.tokens[token.ID] = &stored
+	return nil
+}
+
+// GetRefreshTokenByHash 根据令牌哈希获取刷新令牌
+func (s *MemoryStore) GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error) {
+	s.rlock()
+	defer s.runlock()
+
+	for _, token := range s.tokens {
+		if token.TokenHash == tokenHash {
+			cp := *token
+			return &cp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// MarkRefreshTokenUsed 将令牌标记为已轮换，仅当令牌仍可用时成功
+func (s *MemoryStore) MarkRefreshTokenUsed(id int, usedAt time.Time) (bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	token, ok := s.tokens[id]
+	if !ok || token.UsedAt != nil || token.RevokedAt != nil {
+		return false, nil
+	}
+	token.UsedAt = &usedAt
+	return true, nil
+}
+
+// RevokeSession 撤销某个登录会话的全部刷新令牌
+func (s *MemoryStore) RevokeSession(userID int, sessionID string, revokedAt time.Time) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, token := range s.tokens {
+		if token.UserID == userID && token.SessionID == sessionID && token.RevokedAt == nil {
+			token.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+// RevokeAllSessions 撤销用户全部登录会话
+func (s *MemoryStore) RevokeAllSessions(userID int, revokedAt time.Time) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, token := range s.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+// IsSessionActive 判断登录会话是否仍有效
+func (s *MemoryStore) IsSessionActive(userID int, sessionID string, now time.Time) (bool, error) {
+	s.rlock()
+	defer s.runlock()
+
+	for _, token := range s.tokens {
+		if token.UserID == userID && token.SessionID == sessionID &&
+			token.UsedAt == nil && token.RevokedAt == nil && token.ExpiresAt.After(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ===== 设备 =====
+
+// CreateDevice 注册设备
+func (s *MemoryStore) CreateDevice(device *Device) error {
+	s.lock()
+	defer s.unlock()
+
+	if _, exists := s.devices[device.ID]; exists {
+		return ErrDuplicate
+	}
+	stored := *device
+	s.devices[device.ID] = &stored
+	return nil
+}
+
+// GetDeviceByID 根据ID获取设备
+func (s *MemoryStore) GetDeviceByID(deviceID string, userID int) (*Device, error) {
+	s.rlock()
+	defer s.runlock()
+
+	device, ok := s.devices[deviceID]
+	if !ok || device.UserID != userID {
+		return nil, ErrNotFound
+	}
+	result := *device
+	return &result, nil
+}
+
+// GetDeviceBySessionID 获取绑定到某个登录会话的设备
+func (s *MemoryStore) GetDeviceBySessionID(userID int, sessionID string) (*Device, error) {
+	s.rlock()
+	defer s.runlock()
+
+	for _, device := range s.devices {
+		if device.UserID == userID && device.SessionID == sessionID {
+			result := *device
+			return &result, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetDevicesByUserID 获取用户的设备列表（包含已撤销的设备）
+func (s *MemoryStore) GetDevicesByUserID(userID int) ([]Device, error) {
+	s.rlock()
+	defer s.runlock()
+
+	var devices []Device
+	for _, device := range s.devices {
+		if device.UserID == userID {
+			devices = append(devices, *device)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if !devices[i].CreatedAt.Equal(devices[j].CreatedAt) {
+			return devices[i].CreatedAt.Before(devices[j].CreatedAt)
+		}
+		return devices[i].ID < devices[j].ID
+	})
+	return devices, nil
+}
+
+// UpdateDevice 更新设备名称、平台、绑定会话、推送令牌和撤销状态
+func (s *MemoryStore) UpdateDevice(device *Device) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.devices[device.ID]
+	if !ok || existing.UserID != device.UserID {
+		return fmt.Errorf("device not found or not owned by user: %w", ErrNotFound)
+	}
+
+	existing.Name = device.Name
+	existing.Platform = device.Platform
+	existing.SessionID = device.SessionID
+	existing.PushToken = device.PushToken
+	existing.RevokedAt = device.RevokedAt
+	existing.UpdatedAt = time.Now()
+	device.UpdatedAt = existing.UpdatedAt
+	return nil
+}
+
+// AckDeviceSyncVersion 记录设备已确认的同步版本号，只会前进不会回退
+func (s *MemoryStore) AckDeviceSyncVersion(deviceID string, userID int, version int64, syncedAt time.Time) error {
+	s.lock()
+	defer s.unlock()
+
+	device, ok := s.devices[deviceID]
+	if !ok || device.UserID != userID || device.RevokedAt != nil {
+		return fmt.Errorf("device not found or revoked: %w", ErrNotFound)
+	}
+
+	if version > device.LastSyncVersion {
+		device.LastSyncVersion = version
+	}
+	device.LastSyncedAt = &syncedAt
+	return nil
+}
+
+// ===== 幂等键 =====
+
+// idempotencyKeyID 幂等键在用户范围内唯一
+type idempotencyKeyID struct {
+	userID int
+	key    string
+}
+
+// CreateIdempotencyKey 记录幂等键对应的数据
+func (s *MemoryStore) CreateIdempotencyKey(key *IdempotencyKey) error {
+	s.lock()
+	defer s.unlock()
+
+	id := idempotencyKeyID{userID: key.UserID, key: key.Key}
+	if _, exists := s.idempotencyKeys[id]; exists {
+		return fmt.Errorf("%w: idempotency key already exists", ErrDuplicate)
+	}
+	stored := *key
+	s.idempotencyKeys[id] = &stored
+	return nil
+}
+
+// GetIdempotencyKey 获取幂等键记录
+func (s *MemoryStore) GetIdempotencyKey(userID int, key string) (*IdempotencyKey, error) {
+	s.rlock()
+	defer s.runlock()
+
+	stored, ok := s.idempotencyKeys[idempotencyKeyID{userID: userID, key: key}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := *stored
+	return &result, nil
+}
+
+// ===== 修改历史 =====
+
+// saveRevision 保存修改记录，revision 为 nil 时不做任何操作。调用方需持有写锁
+func (s *MemoryStore) saveRevision(revision *Revision) {
+	if revision == nil {
+		return
+	}
+	s.nextRevisionID++
+	revision.ID = s.nextRevisionID
+	revision.DeviceID = s.deviceID
+	revision.CreatedAt = time.Now()
+	stored := *revision
+	s.revisions[revision.ID] = &stored
+}
+
+// GetRevisions 获取数据的修改历史，按时间从新到旧排序
+func (s *MemoryStore) GetRevisions(userID int, entityType string, entityID int) ([]Revision, error) {
+	s.rlock()
+	defer s.runlock()
+
+	var revisions []Revision
+	for _, revision := range s.revisions {
+		if revision.UserID == userID && revision.EntityType == entityType && revision.EntityID == entityID {
+			revisions = append(revisions, *revision)
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].ID > revisions[j].ID })
+	return revisions, nil
+}
+
+// GetRevisionByID 根据ID获取单条修改记录
+func (s *MemoryStore) GetRevisionByID(revisionID, userID int) (*Revision, error) {
+	s.rlock()
+	defer s.runlock()
+
+	revision, ok := s.revisions[revisionID]
+	if !ok || revision.UserID != userID {
+		return nil, ErrNotFound
+	}
+	cp := *revision
+	return &cp, nil
+}
+
+// ===== 回收站 =====
+
+// GetPurgeableTombstones 获取删除时间早于 before、且用户全部未撤销设备都已同步过的已删除TODO和分类
+func (s *MemoryStore) GetPurgeableTombstones(before time.Time, limit int) ([]Tombstone, error) {
+	s.rlock()
+	defer s.runlock()
+
+	// 每个用户未撤销设备中最小的已同步版本号，没有设备的用户不受限制
+	watermarks := make(map[int]int64)
+	for _, device := range s.devices {
+		if device.RevokedAt != nil {
+			continue
+		}
+		if version, ok := watermarks[device.UserID]; !ok || device.LastSyncVersion < version {
+			watermarks[device.UserID] = device.LastSyncVersion
+		}
+	}
+	purgeable := func(userID int, syncVersion int64, deletedAt time.Time) bool {
+		watermark, ok := watermarks[userID]
+		return deletedAt.Before(before) && (!ok || syncVersion <= watermark)
+	}
+
+	var tombstones []Tombstone
+	for _, todo := range s.todos {
+		if todo.IsDeleted && purgeable(todo.UserID, todo.SyncVersion, todo.UpdatedAt) {
+			tombstones = append(tombstones, Tombstone{Type: SyncTypeTodo, ID: todo.ID, UserID: todo.UserID, SyncVersion: todo.SyncVersion})
+		}
+	}
+	for _, category := range s.categories {
+		if category.IsDeleted && purgeable(category.UserID, category.SyncVersion, category.UpdatedAt) {
+			tombstones = append(tombstones, Tombstone{Type: SyncTypeCategory, ID: category.ID, UserID: category.UserID, SyncVersion: category.SyncVersion})
+		}
+	}
+	sort.Slice(tombstones, func(i, j int) bool {
+		a, b := tombstones[i], tombstones[j]
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		return a.SyncVersion < b.SyncVersion
+	})
+	if limit >= 0 && limit < len(tombstones) {
+		tombstones = tombstones[:limit]
+	}
+	return tombstones, nil
+}
+
+// ===== 提醒 =====
+
+// GetDueReminders 获取所有用户中提醒时间在 (from, to] 区间内、尚未生成投递记录的未完成TODO，按提醒时间排序
+func (s *MemoryStore) GetDueReminders(from, to time.Time, limit int) ([]Todo, error) {
+	s.rlock()
+	defer s.runlock()
+
+	delivered := make(map[int][]time.Time)
+	for _, delivery := range s.deliveries {
+		delivered[delivery.TodoID] = append(delivered[delivery.TodoID], delivery.ReminderAt)
+	}
+	todos := s.sortedTodos(func(t *Todo) bool {
+		if t.Reminder == nil || !t.Reminder.After(from) || t.Reminder.After(to) || t.Completed || t.IsDeleted {
+			return false
+		}
+		for _, reminderAt := range delivered[t.ID] {
+			if reminderAt.Equal(*t.Reminder) {
+				return false
+			}
+		}
+		return true
+	}, func(a, b *Todo) bool {
+		if !a.Reminder.Equal(*b.Reminder) {
+			return a.Reminder.Before(*b.Reminder)
+		}
+		return a.ID < b.ID
+	})
+	return paginate(todos, limit, 0), nil
+}
+
+// CreateReminderDelivery 生成待发送的投递记录，同一TODO、提醒时间和渠道的记录已存在时返回 ErrDuplicate
+func (s *MemoryStore) CreateReminderDelivery(delivery *ReminderDelivery) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, existing := range s.deliveries {
+		if existing.TodoID == delivery.TodoID && existing.ReminderAt.Equal(delivery.ReminderAt) && existing.Channel == delivery.Channel {
+			return fmt.Errorf("%w: reminder delivery already exists", ErrDuplicate)
+		}
+	}
+	now := time.Now()
+	s.nextDeliveryID++
+	delivery.ID = s.nextDeliveryID
+	delivery.Status = DeliveryPending
+	if delivery.NextAttemptAt.IsZero() {
+		delivery.NextAttemptAt = now
+	}
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+	stored := *delivery
+	s.deliveries[delivery.ID] = &stored
+	return nil
+}
+
+// ClaimReminderDeliveries 以 owner 身份认领最多 limit 条可以发送的投递记录，租约到 leaseUntil 为止，每条记录的尝试次数加一
+func (s *MemoryStore) ClaimReminderDeliveries(owner string, now, leaseUntil time.Time, limit int) ([]ReminderDelivery, error) {
+	s.lock()
+	defer s.unlock()
+
+	var claimable []*ReminderDelivery
+	for _, delivery := range s.deliveries {
+		if (delivery.Status == DeliveryPending && !delivery.NextAttemptAt.After(now)) ||
+			(delivery.Status == DeliverySending && delivery.ClaimedUntil != nil && delivery.ClaimedUntil.Before(now)) {
+			claimable = append(claimable, delivery)
+		}
+	}
+	sort.Slice(claimable, func(i, j int) bool {
+		if !claimable[i].NextAttemptAt.Equal(claimable[j].NextAttemptAt) {
+			return claimable[i].NextAttemptAt.Before(claimable[j].NextAttemptAt)
+		}
+		return claimable[i].ID < claimable[j].ID
+	})
+	if limit >= 0 && limit < len(claimable) {
+		claimable = claimable[:limit]
+	}
+
+	deliveries := make([]ReminderDelivery, 0, len(claimable))
+	for _, delivery := range claimable {
+		until := leaseUntil
+		delivery.Status = DeliverySending
+		delivery.ClaimedBy = owner
+		delivery.ClaimedUntil = &until
+		delivery.Attempts++
+		delivery.UpdatedAt = now
+		deliveries = append(deliveries, *delivery)
+	}
+	return deliveries, nil
+}
+
+// FinishReminderDelivery 保存认领后的发送结果并释放认领，记录已不再由 delivery.ClaimedBy 认领时返回 ErrNotFound
+func (s *MemoryStore) FinishReminderDelivery(delivery *ReminderDelivery) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.deliveries[delivery.ID]
+	if !ok || existing.Status != DeliverySending || existing.ClaimedBy != delivery.ClaimedBy {
+		return fmt.Errorf("delivery not claimed by %s: %w", delivery.ClaimedBy, ErrNotFound)
+	}
+
+	existing.Status = delivery.Status
+	existing.LastError = delivery.LastError
+	existing.NextAttemptAt = delivery.NextAttemptAt
+	existing.SentAt = delivery.SentAt
+	existing.ClaimedBy = ""
+	existing.ClaimedUntil = nil
+	existing.UpdatedAt = time.Now()
+	delivery.ClaimedBy = ""
+	delivery.ClaimedUntil = nil
+	delivery.UpdatedAt = existing.UpdatedAt
+	return nil
+}
+
+// GetReminderDeliveries 获取TODO的提醒投递记录，按创建时间从新到旧排序
+func (s *MemoryStore) GetReminderDeliveries(userID, todoID int) ([]ReminderDelivery, error) {
+	s.rlock()
+	defer s.runlock()
+
+	var deliveries []ReminderDelivery
+	for _, delivery := range s.deliveries {
+		if delivery.UserID == userID && delivery.TodoID == todoID {
+			deliveries = append(deliveries, *delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	return deliveries, nil
+}
+
+// ===== 每日摘要 =====
+
+// GetDigestSubscribers 获取所有开启每日摘要的用户设置，以及每个用户最近一次生成投递记录的摘要日期，按用户ID排序
+func (s *MemoryStore) GetDigestSubscribers() ([]DigestSubscriber, error) {
+	s.rlock()
+	defer s.runlock()
+
+	lastDates := make(map[int]string)
+	for _, delivery := range s.digests {
+		if delivery.DigestDate > lastDates[delivery.UserID] {
+			lastDates[delivery.UserID] = delivery.DigestDate
+		}
+	}
+
+	var subscribers []DigestSubscriber
+	for userID := range s.users {
+		settings := defaultUserSettings(userID)
+		if stored, ok := s.settings[userID]; ok {
+			settings = stored
+		}
+		if settings.DailyDigest {
+			subscribers = append(subscribers, DigestSubscriber{UserSettings: *settings, LastDigestDate: lastDates[userID]})
+		}
+	}
+	sort.Slice(subscribers, func(i, j int) bool { return subscribers[i].UserID < subscribers[j].UserID })
+	return subscribers, nil
+}
+
+// GetDailyDigest 获取用户的每日摘要内容：截止时间早于 now 的逾期TODO、截止时间在 [now, dayEnd) 内的TODO、
+// 紧急TODO，以及在 [yesterdayStart, dayStart) 内完成的TODO
+func (s *MemoryStore) GetDailyDigest(userID int, now, dayStart, dayEnd, yesterdayStart time.Time) (*DailyDigest, error) {
+	s.rlock()
+	defer s.runlock()
+
+	pending := func(t *Todo) bool { return t.UserID == userID && !t.Completed && !t.IsDeleted }
+	byDueDate := func(a, b *Todo) bool {
+		if !a.DueDate.Equal(*b.DueDate) {
+			return a.DueDate.Before(*b.DueDate)
+		}
+		return a.ID < b.ID
+	}
+	byID := func(a, b *Todo) bool { return a.ID < b.ID }
+
+	digest := &DailyDigest{
+		Overdue: s.sortedTodos(func(t *Todo) bool {
+			return pending(t) && t.DueDate != nil && t.DueDate.Before(now)
+		}, byDueDate),
+		DueToday: s.sortedTodos(func(t *Todo) bool {
+			return pending(t) && t.DueDate != nil && !t.DueDate.Before(now) && t.DueDate.Before(dayEnd)
+		}, byDueDate),
+		Urgent: s.sortedTodos(func(t *Todo) bool {
+			return pending(t) && t.Priority == PriorityUrgent
+		}, byID),
+		CompletedYesterday: []Todo{},
+	}
+
+	var revisions []*Revision
+	for _, revision := range s.revisions {
+		if revision.UserID == userID && revision.EntityType == SyncTypeTodo &&
+			!revision.CreatedAt.Before(yesterdayStart) && revision.CreatedAt.Before(dayStart) {
+			revisions = append(revisions, revision)
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].ID < revisions[j].ID })
+
+	seen := make(map[int]bool)
+	for _, revision := range revisions {
+		if seen[revision.EntityID] || !isCompletion(revision.Changes) {
+			continue
+		}
+		seen[revision.EntityID] = true
+		if todo, ok := s.todos[revision.EntityID]; ok && todo.Completed && !todo.IsDeleted {
+			digest.CompletedYesterday = append(digest.CompletedYesterday, s.readTodo(todo))
+		}
+	}
+	return digest, nil
+}
+
+// CreateDigestDelivery 生成待发送的每日摘要投递记录，同一用户、日期和渠道的记录已存在时返回 ErrDuplicate
+func (s *MemoryStore) CreateDigestDelivery(delivery *DigestDelivery) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, existing := range s.digests {
+		if existing.UserID == delivery.UserID && existing.DigestDate == delivery.DigestDate && existing.Channel == delivery.Channel {
+			return fmt.Errorf("%w: digest delivery already exists", ErrDuplicate)
+		}
+	}
+	now := time.Now()
+	s.nextDigestID++
+	delivery.ID = s.nextDigestID
+	delivery.Status = DeliveryPending
+	if delivery.NextAttemptAt.IsZero() {
+		delivery.NextAttemptAt = now
+	}
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+	stored := *delivery
+	s.digests[delivery.ID] = &stored
+	return nil
+}
+
+// ClaimDigestDeliveries 以 owner 身份认领最多 limit 条可以发送的每日摘要投递记录，租约到 leaseUntil 为止，每条记录的尝试次数加一
+func (s *MemoryStore) ClaimDigestDeliveries(owner string, now, leaseUntil time.Time, limit int) ([]DigestDelivery, error) {
+	s.lock()
+	defer s.unlock()
+
+	var claimable []*DigestDelivery
+	for _, delivery := range s.digests {
+		if (delivery.Status == DeliveryPending && !delivery.NextAttemptAt.After(now)) ||
+			(delivery.Status == DeliverySending && delivery.ClaimedUntil != nil && delivery.ClaimedUntil.Before(now)) {
+			claimable = append(claimable, delivery)
+		}
+	}
+	sort.Slice(claimable, func(i, j int) bool {
+		if !claimable[i].NextAttemptAt.Equal(claimable[j].NextAttemptAt) {
+			return claimable[i].NextAttemptAt.Before(claimable[j].NextAttemptAt)
+		}
+		return claimable[i].ID < claimable[j].ID
+	})
+	if limit >= 0 && limit < len(claimable) {
+		claimable = claimable[:limit]
+	}
+
+	deliveries := make([]DigestDelivery, 0, len(claimable))
+	for _, delivery := range claimable {
+		until := leaseUntil
+		delivery.Status = DeliverySending
+		delivery.ClaimedBy = owner
+		delivery.ClaimedUntil = &until
+		delivery.Attempts++
+		delivery.UpdatedAt = now
+		deliveries = append(deliveries, *delivery)
+	}
+	return deliveries, nil
+}
+
+// FinishDigestDelivery 保存认领后的发送结果并释放认领，记录已不再由 delivery.ClaimedBy 认领时返回 ErrNotFound
+func (s *MemoryStore) FinishDigestDelivery(delivery *DigestDelivery) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.digests[delivery.ID]
+	if !ok || existing.Status != DeliverySending || existing.ClaimedBy != delivery.ClaimedBy {
+		return fmt.Errorf("delivery not claimed by %s: %w", delivery.ClaimedBy, ErrNotFound)
+	}
+
+	existing.Status = delivery.Status
+	existing.LastError = delivery.LastError
+	existing.NextAttemptAt = delivery.NextAttemptAt
+	existing.SentAt = delivery.SentAt
+	existing.ClaimedBy = ""
+	existing.ClaimedUntil = nil
+	existing.UpdatedAt = time.Now()
+	delivery.ClaimedBy = ""
+	delivery.ClaimedUntil = nil
+	delivery.UpdatedAt = existing.UpdatedAt
+	return nil
+}
+
+// GetDigestDeliveries 获取用户的每日摘要投递记录，按创建时间从新到旧排序
+func (s *MemoryStore) GetDigestDeliveries(userID int) ([]DigestDelivery, error) {
+	s.rlock()
+	defer s.runlock()
+
+	var deliveries []DigestDelivery
+	for _, delivery := range s.digests {
+		if delivery.UserID == userID {
+			deliveries = append(deliveries, *delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	return deliveries, nil
+}
+
+// ===== Webhook =====
+
+// saveTodoRevision 保存TODO的修改记录并发出对应的Webhook事件，规则与SQL实现相同。调用方需持有写锁
+func (s *MemoryStore) saveTodoRevision(previous, current *Todo) {
+	revision := newTodoRevision(previous, current)
+	if revision == nil {
+		return
+	}
+	s.saveRevision(revision)
+	entity := current
+	if entity == nil {
+		entity = previous
+	}
+	s.emitWebhookEvent(revisionEvent(revision), s.readTodo(entity))
+}
+
+// saveCategoryRevision 保存分类的修改记录并发出对应的Webhook事件。调用方需持有写锁
+func (s *MemoryStore) saveCategoryRevision(previous, current *Category) {
+	revision := newCategoryRevision(previous, current)
+	if revision == nil {
+		return
+	}
+	s.saveRevision(revision)
+	entity := current
+	if entity == nil {
+		entity = previous
+	}
+	s.emitWebhookEvent(revisionEvent(revision), *entity)
+}
+
+// emitWebhookEvent 为每个订阅了该事件的已启用Webhook生成投递记录，没有Webhook订阅时不保存事件。调用方需持有写锁
+func (s *MemoryStore) emitWebhookEvent(event *WebhookEvent, data any) {
+	if event.Type == "" {
+		return
+	}
+	var endpointIDs []int
+	for _, endpoint := range s.webhookEndpoints {
+		if endpoint.Enabled && (endpoint.UserID == event.UserID || endpoint.AllUsers) && endpoint.Subscribes(event.Type) {
+			endpointIDs = append(endpointIDs, endpoint.ID)
+		}
+	}
+	if len(endpointIDs) == 0 {
+		return
+	}
+	sort.Ints(endpointIDs)
+
+	event.Data, _ = json.Marshal(data)
+	event.CreatedAt = time.Now()
+	s.nextWebhookEventID++
+	event.ID = s.nextWebhookEventID
+	stored := *event
+	s.webhookEvents[event.ID] = &stored
+	for _, endpointID := range endpointIDs {
+		s.createWebhookDelivery(endpointID, event.ID, event.Type, event.CreatedAt)
+	}
+}
+
+// createWebhookDelivery 生成待发送的投递记录。调用方需持有写锁
+func (s *MemoryStore) createWebhookDelivery(endpointID, eventID int, eventType string, now time.Time) *WebhookDelivery {
+	s.nextWebhookDeliveryID++
+	delivery := &WebhookDelivery{
+		ID:            s.nextWebhookDeliveryID,
+		EndpointID:    endpointID,
+		EventID:       eventID,
+		EventType:     eventType,
+		Status:        DeliveryPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	stored := *delivery
+	s.webhookDeliveries[delivery.ID] = &stored
+	return delivery
+}
+
+// copyWebhookEndpoint 复制Webhook，订阅的事件类型不与原值共享
+func copyWebhookEndpoint(endpoint *WebhookEndpoint) WebhookEndpoint {
+	cp := *endpoint
+	cp.Events = append(StringSlice{}, endpoint.Events...)
+	return cp
+}
+
+// CreateWebhookEndpoint 登记Webhook
+func (s *MemoryStore) CreateWebhookEndpoint(endpoint *WebhookEndpoint) error {
+	s.lock()
+	defer s.unlock()
+
+	now := time.Now()
+	s.nextEndpointID++
+	endpoint.ID = s.nextEndpointID
+	endpoint.CreatedAt = now
+	endpoint.UpdatedAt = now
+	stored := copyWebhookEndpoint(endpoint)
+	s.webhookEndpoints[endpoint.ID] = &stored
+	return nil
+}
+
+// GetWebhookEndpoints 获取用户登记的全部Webhook，按创建顺序排序
+func (s *MemoryStore) GetWebhookEndpoints(userID int) ([]WebhookEndpoint, error) {
+	s.rlock()
+	defer s.runlock()
+
+	var endpoints []WebhookEndpoint
+	for _, endpoint := range s.webhookEndpoints {
+		if endpoint.UserID == userID {
+			endpoints = append(endpoints, copyWebhookEndpoint(endpoint))
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].ID < endpoints[j].ID })
+	return endpoints, nil
+}
+
+// GetWebhookEndpoint 根据ID获取Webhook，不检查所属用户
+func (s *MemoryStore) GetWebhookEndpoint(endpointID int) (*WebhookEndpoint, error) {
+	s.rlock()
+	defer s.runlock()
+
+	endpoint, ok := s.webhookEndpoints[endpointID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := copyWebhookEndpoint(endpoint)
+	return &result, nil
+}
+
+// UpdateWebhookEndpoint 修改Webhook的URL、密钥、订阅的事件和启用状态，重新启用已停用的Webhook时清零连续失败次数和停用原因
+func (s *MemoryStore) UpdateWebhookEndpoint(endpoint *WebhookEndpoint) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.webhookEndpoints[endpoint.ID]
+	if !ok || existing.UserID != endpoint.UserID {
+		return ErrNotFound
+	}
+	if endpoint.Enabled && !existing.Enabled {
+		existing.ConsecutiveFailures = 0
+		existing.DisabledAt = nil
+		existing.DisabledReason = ""
+	}
+	existing.URL = endpoint.URL
+	existing.Secret = endpoint.Secret
+	existing.Events = append(StringSlice{}, endpoint.Events...)
+	existing.AllUsers = endpoint.AllUsers
+	existing.Enabled = endpoint.Enabled
+	existing.UpdatedAt = time.Now()
+	*endpoint = copyWebhookEndpoint(existing)
+	return nil
+}
+
+// DeleteWebhookEndpoint 删除Webhook及其投递记录，已生成的事件保留
+func (s *MemoryStore) DeleteWebhookEndpoint(endpointID, userID int) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.webhookEndpoints[endpointID]
+	if !ok || existing.UserID != userID {
+		return fmt.Errorf("webhook not found or not owned by user: %w", ErrNotFound)
+	}
+	delete(s.webhookEndpoints, endpointID)
+	for id, delivery := range s.webhookDeliveries {
+		if delivery.EndpointID == endpointID {
+			delete(s.webhookDeliveries, id)
+		}
+	}
+	return nil
+}
+
+// RecordWebhookResult 记录一次发送结果，连续失败达到 failureLimit 时停用Webhook，返回本次是否停用了Webhook
+func (s *MemoryStore) RecordWebhookResult(endpointID int, lastError string, failureLimit int) (bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	endpoint, ok := s.webhookEndpoints[endpointID]
+	if !ok {
+		return false, nil
+	}
+	if lastError == "" {
+		endpoint.ConsecutiveFailures = 0
+		return false, nil
+	}
+	if !endpoint.Enabled {
+		return false, nil
+	}
+
+	now := time.Now()
+	endpoint.ConsecutiveFailures++
+	endpoint.UpdatedAt = now
+	if endpoint.ConsecutiveFailures < failureLimit {
+		return false, nil
+	}
+	endpoint.Enabled = false
+	endpoint.DisabledAt = &now
+	endpoint.DisabledReason = lastError
+	return true, nil
+}
+
+// GetWebhookEvent 根据ID获取Webhook事件
+func (s *MemoryStore) GetWebhookEvent(eventID int) (*WebhookEvent, error) {
+	s.rlock()
+	defer s.runlock()
+
+	event, ok := s.webhookEvents[eventID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := *event
+	return &result, nil
+}
+
+// GetWebhookDeliveries 获取Webhook的投递记录，按创建时间从新到旧排序，limit < 0 表示不限制数量
+func (s *MemoryStore) GetWebhookDeliveries(endpointID int, limit int) ([]WebhookDelivery, error) {
+	s.rlock()
+	defer s.runlock()
+
+	var deliveries []WebhookDelivery
+	for _, delivery := range s.webhookDeliveries {
+		if delivery.EndpointID == endpointID {
+			deliveries = append(deliveries, *delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	if limit >= 0 && limit < len(deliveries) {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+// ReplayWebhookDelivery 为投递记录对应的事件生成新的待发送投递记录，投递记录不属于该Webhook时返回 ErrNotFound
+func (s *MemoryStore) ReplayWebhookDelivery(endpointID, deliveryID int) (*WebhookDelivery, error) {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.webhookDeliveries[deliveryID]
+	if !ok || existing.EndpointID != endpointID {
+		return nil, ErrNotFound
+	}
+	return s.createWebhookDelivery(endpointID, existing.EventID, existing.EventType, time.Now()), nil
+}
+
+// ClaimWebhookDeliveries 以 owner 身份认领最多 limit 条可以发送的Webhook投递记录，租约到 leaseUntil 为止，每条记录的尝试次数加一
+func (s *MemoryStore) ClaimWebhookDeliveries(owner string, now, leaseUntil time.Time, limit int) ([]WebhookDelivery, error) {
+	s.lock()
+	defer s.unlock()
+
+	var claimable []*WebhookDelivery
+	for _, delivery := range s.webhookDeliveries {
+		if (delivery.Status == DeliveryPending && !delivery.NextAttemptAt.After(now)) ||
+			(delivery.Status == DeliverySending && delivery.ClaimedUntil != nil && delivery.ClaimedUntil.Before(now)) {
+			claimable = append(claimable, delivery)
+		}
+	}
+	sort.Slice(claimable, func(i, j int) bool {
+		if !claimable[i].NextAttemptAt.Equal(claimable[j].NextAttemptAt) {
+			return claimable[i].NextAttemptAt.Before(claimable[j].NextAttemptAt)
+		}
+		return claimable[i].ID < claimable[j].ID
+	})
+	if limit >= 0 && limit < len(claimable) {
+		claimable = claimable[:limit]
+	}
+
+	deliveries := make([]WebhookDelivery, 0, len(claimable))
+	for _, delivery := range claimable {
+		until := leaseUntil
+		delivery.Status = DeliverySending
+		delivery.ClaimedBy = owner
+		delivery.ClaimedUntil = &until
+		delivery.Attempts++
+		delivery.UpdatedAt = now
+		deliveries = append(deliveries, *delivery)
+	}
+	return deliveries, nil
+}
+
+// FinishWebhookDelivery 保存认领后的发送结果并释放认领，记录已不再由 delivery.ClaimedBy 认领时返回 ErrNotFound
+func (s *MemoryStore) FinishWebhookDelivery(delivery *WebhookDelivery) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.webhookDeliveries[delivery.ID]
+	if !ok || existing.Status != DeliverySending || existing.ClaimedBy != delivery.ClaimedBy {
+		return fmt.Errorf("delivery not claimed by %s: %w", delivery.ClaimedBy, ErrNotFound)
+	}
+
+	existing.Status = delivery.Status
+	existing.LastError = delivery.LastError
+	existing.NextAttemptAt = delivery.NextAttemptAt
+	existing.SentAt = delivery.SentAt
+	existing.ClaimedBy = ""
+	existing.ClaimedUntil = nil
+	existing.UpdatedAt = time.Now()
+	delivery.ClaimedBy = ""
+	delivery.ClaimedUntil = nil
+	delivery.UpdatedAt = existing.UpdatedAt
+	return nil
+}
+
+// ===== 日历订阅 =====
+
+// readCalendarFeed 返回日历订阅的副本，并由 category_id 关联得到分类UUID
+func (s *MemoryStore) readCalendarFeed(feed *CalendarFeed) CalendarFeed {
+	result := *feed
+	result.CategoryUUID = nil
+	if feed.CategoryID != nil {
+		if category, ok := s.categories[*feed.CategoryID]; ok {
+			categoryUUID := category.UUID
+			result.CategoryUUID = &categoryUUID
+		}
+	}
+	return result
+}
+
+// CreateCalendarFeed 创建日历订阅
+func (s *MemoryStore) CreateCalendarFeed(feed *CalendarFeed) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, existing := range s.calendarFeeds {
+		if existing.TokenHash == feed.TokenHash {
+			return ErrDuplicate
+		}
+	}
+	now := time.Now()
+	s.nextFeedID++
+	feed.ID = s.nextFeedID
+	feed.CreatedAt = now
+	feed.UpdatedAt = now
+	stored := *feed
+	s.calendarFeeds[feed.ID] = &stored
+	return nil
+}
+
+// GetCalendarFeeds 获取用户的全部日历订阅，按创建顺序排序
+func (s *MemoryStore) GetCalendarFeeds(userID int) ([]CalendarFeed, error) {
+	s.rlock()
+	defer s.runlock()
+
+	var feeds []CalendarFeed
+	for _, feed := range s.calendarFeeds {
+		if feed.UserID == userID {
+			feeds = append(feeds, s.readCalendarFeed(feed))
+		}
+	}
+	sort.Slice(feeds, func(i, j int) bool { return feeds[i].ID < feeds[j].ID })
+	return feeds, nil
+}
+
+// GetCalendarFeedByID 根据ID获取用户的日历订阅
+func (s *MemoryStore) GetCalendarFeedByID(feedID, userID int) (*CalendarFeed, error) {
+	s.rlock()
+	defer s.runlock()
+
+	feed, ok := s.calendarFeeds[feedID]
+	if !ok || feed.UserID != userID {
+		return nil, ErrNotFound
+	}
+	result := s.readCalendarFeed(feed)
+	return &result, nil
+}
+
+// GetCalendarFeedByTokenHash 根据令牌哈希获取日历订阅
+func (s *MemoryStore) GetCalendarFeedByTokenHash(tokenHash string) (*CalendarFeed, error) {
+	s.rlock()
+	defer s.runlock()
+
+	for _, feed := range s.calendarFeeds {
+		if feed.TokenHash == tokenHash {
+			result := s.readCalendarFeed(feed)
+			return &result, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// UpdateCalendarFeed 修改日历订阅的名称、限定的分类和令牌哈希
+func (s *MemoryStore) UpdateCalendarFeed(feed *CalendarFeed) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.calendarFeeds[feed.ID]
+	if !ok || existing.UserID != feed.UserID {
+		return fmt.Errorf("calendar feed not found or not owned by user: %w", ErrNotFound)
+	}
+	for id, other := range s.calendarFeeds {
+		if id != feed.ID && other.TokenHash == feed.TokenHash {
+			return ErrDuplicate
+		}
+	}
+	feed.UpdatedAt = time.Now()
+	existing.Name = feed.Name
+	existing.CategoryID = feed.CategoryID
+	existing.TokenHash = feed.TokenHash
+	existing.UpdatedAt = feed.UpdatedAt
+	return nil
+}
+
+// DeleteCalendarFeed 删除日历订阅
+func (s *MemoryStore) DeleteCalendarFeed(feedID, userID int) error {
+	s.lock()
+	defer s.unlock()
+
+	feed, ok := s.calendarFeeds[feedID]
+	if !ok || feed.UserID != userID {
+		return fmt.Errorf("calendar feed not found or not owned by user: %w", ErrNotFound)
+	}
+	delete(s.calendarFeeds, feedID)
+	return nil
+}
+
+// TouchCalendarFeed 记录日历客户端读取订阅的时间
+func (s *MemoryStore) TouchCalendarFeed(feedID int, accessedAt time.Time) error {
+	s.lock()
+	defer s.unlock()
+
+	if feed, ok := s.calendarFeeds[feedID]; ok {
+		feed.LastAccessedAt = &accessedAt
+	}
+	return nil
+}
+
+// ===== 应用专用密码 =====
+
+// CreateAppPassword 创建应用专用密码
+func (s *MemoryStore) CreateAppPassword(password *AppPassword) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, existing := range s.appPasswords {
+		if existing.PasswordHash == password.PasswordHash {
+			return ErrDuplicate
+		}
+	}
+	s.nextAppPasswordID++
+	password.ID = s.nextAppPasswordID
+	password.CreatedAt = time.Now()
+	stored := *password
+	s.appPasswords[password.ID] = &stored
+	return nil
+}
+
+// GetAppPasswords 获取用户的全部应用专用密码，按创建顺序排序
+func (s *MemoryStore) GetAppPasswords(userID int) ([]AppPassword, error) {
+	s.rlock()
+	defer s.runlock()
+
+	var passwords []AppPassword
+	for _, password := range s.appPasswords {
+		if password.UserID == userID {
+			passwords = append(passwords, *password)
+		}
+	}
+	sort.Slice(passwords, func(i, j int) bool { return passwords[i].ID < passwords[j].ID })
+	return passwords, nil
+}
+
+// GetAppPasswordByHash 根据密码哈希获取应用专用密码
+func (s *MemoryStore) GetAppPasswordByHash(passwordHash string) (*AppPassword, error) {
+	s.rlock()
+	defer s.runlock()
+
+	for _, password := range s.appPasswords {
+		if password.PasswordHash == passwordHash {
+			result := *password
+			return &result, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// DeleteAppPassword 删除应用专用密码
+func (s *MemoryStore) DeleteAppPassword(passwordID, userID int) error {
+	s.lock()
+	defer s.unlock()
+
+	password, ok := s.appPasswords[passwordID]
+	if !ok || password.UserID != userID {
+		return fmt.Errorf("app password not found or not owned by user: %w", ErrNotFound)
+	}
+	delete(s.appPasswords, passwordID)
+	return nil
+}
+
+// DeleteAppPasswords 删除用户的全部应用专用密码
+func (s *MemoryStore) DeleteAppPasswords(userID int) error {
+	s.lock()
+	defer s.unlock()
+
+	for id, password := range s.appPasswords {
+		if password.UserID == userID {
+			delete(s.appPasswords, id)
+		}
+	}
+	return nil
+}
+
+// TouchAppPassword 记录客户端使用密码的时间
+func (s *MemoryStore) TouchAppPassword(passwordID int, usedAt time.Time) error {
+	s.lock()
+	defer s.unlock()
+
+	if password, ok := s.appPasswords[passwordID]; ok {
+		password.LastUsedAt = &usedAt
+	}
+	return nil
+}
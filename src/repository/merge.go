@@ -0,0 +1,146 @@
+package repository
+
+import "time"
+
+// 同步冲突解决策略
+const (
+	ConflictServerWins = "server_wins" // 保留服务器数据，返回冲突、服务器数据和合并建议（默认）
+	ConflictClientWins = "client_wins" // 客户端数据覆盖服务器数据
+	ConflictMerge      = "merge"       // 字段级三方合并，没有字段冲突时自动应用合并结果
+)
+
+// ConflictPolicy 批量同步的冲突解决策略，可按TODO单独指定
+type ConflictPolicy struct {
+	Default string         // 默认策略，为空时等同 server_wins
+	PerTodo map[int]string // 按TODO ID指定的策略
+}
+
+// strategyFor 获取某个TODO使用的冲突解决策略
+func (p ConflictPolicy) strategyFor(todoID int) string {
+	if strategy, ok := p.PerTodo[todoID]; ok && strategy != "" {
+		return strategy
+	}
+	if p.Default != "" {
+		return p.Default
+	}
+	return ConflictServerWins
+}
+
+// todoMergeField 参与三方合并的TODO字段
+type todoMergeField struct {
+	name  string
+	equal func(a, b *Todo) bool
+	take  func(dst, src *Todo)
+}
+
+var todoMergeFields = []todoMergeField{
+	{"title", func(a, b *Todo) bool { return a.Title == b.Title }, func(dst, src *Todo) { dst.Title = src.Title }},
+	{"description", func(a, b *Todo) bool { return a.Description == b.Description }, func(dst, src *Todo) { dst.Description = src.Description }},
+	{"completed", func(a, b *Todo) bool { return a.Completed == b.Completed }, func(dst, src *Todo) { dst.Completed = src.Completed }},
+	{"priority", func(a, b *Todo) bool { return a.Priority == b.Priority }, func(dst, src *Todo) { dst.Priority = src.Priority }},
+	{"due_date", func(a, b *Todo) bool { return timePtrEqual(a.DueDate, b.DueDate) }, func(dst, src *Todo) { dst.DueDate = src.DueDate }},
+	{"category_id", func(a, b *Todo) bool { return intPtrEqual(a.CategoryID, b.CategoryID) }, func(dst, src *Todo) { dst.CategoryID, dst.CategoryUUID = src.CategoryID, src.CategoryUUID }},
+	{"reminder", func(a, b *Todo) bool { return timePtrEqual(a.Reminder, b.Reminder) }, func(dst, src *Todo) { dst.Reminder = src.Reminder }},
+	{"recurrence", func(a, b *Todo) bool { return stringPtrEqual(a.Recurrence, b.Recurrence) }, func(dst, src *Todo) { dst.Recurrence = src.Recurrence }},
+	{"is_deleted", func(a, b *Todo) bool { return a.IsDeleted == b.IsDeleted }, func(dst, src *Todo) { dst.IsDeleted = src.IsDeleted }},
+}
+
+// MergeTodo 以 base 为共同祖先，对服务器数据和客户端数据做字段级三方合并。
+// 只有一方修改的字段取修改方的值；双方修改为不同值的字段保留服务器的值并作为冲突字段返回。
+// 标签按集合合并：双方各自的增删都会保留，不会产生冲突。
+// base 为 nil（快照已被清理或客户端未提供）时无法判断哪一方修改过，所有取值不同的字段都视为冲突
+func MergeTodo(base, server, client *Todo) (merged Todo, conflicts []string) {
+	merged = copyTodo(server)
+
+	for _, field := range todoMergeFields {
+		if field.equal(server, client) {
+			continue
+		}
+		clientChanged := base == nil || !field.equal(base, client)
+		serverChanged := base == nil || !field.equal(base, server)
+		switch {
+		case !clientChanged:
+			// 仅服务器修改，保留服务器的值
+		case !serverChanged:
+			field.take(&merged, client)
+		default:
+			conflicts = append(conflicts, field.name)
+		}
+	}
+
+	if base == nil {
+		if !tagsEqual(server.Tags, client.Tags) {
+			conflicts = append(conflicts, "tags")
+		}
+	} else {
+		merged.Tags = mergeTags(base.Tags, server.Tags, client.Tags)
+	}
+
+	return merged, conflicts
+}
+
+// mergeTags 标签的三方集合合并：在服务器标签的基础上应用客户端相对 base 的增删
+func mergeTags(base, server, client StringSlice) StringSlice {
+	inBase := make(map[string]bool, len(base))
+	for _, tag := range base {
+		inBase[tag] = true
+	}
+	inClient := make(map[string]bool, len(client))
+	for _, tag := range client {
+		inClient[tag] = true
+	}
+
+	merged := StringSlice{}
+	seen := make(map[string]bool)
+	for _, tag := range server {
+		// 客户端删除的标签不再保留
+		if inBase[tag] && !inClient[tag] {
+			continue
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			merged = append(merged, tag)
+		}
+	}
+	for _, tag := range client {
+		// 客户端新增的标签
+		if !inBase[tag] && !seen[tag] {
+			seen[tag] = true
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+func tagsEqual(a, b StringSlice) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func timePtrEqual(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func stringPtrEqual(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func intPtrEqual(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
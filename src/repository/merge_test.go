@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestMergeTodo(t *testing.T) {
+	base := &Todo{Title: "买牛奶", Description: "超市", Priority: PriorityLow, Tags: StringSlice{"家庭", "购物"}}
+
+	tests := []struct {
+		name          string
+		base          *Todo
+		server        func(*Todo)
+		client        func(*Todo)
+		want          func(*Todo)
+		wantConflicts []string
+	}{
+		{
+			name:   "different fields merge cleanly",
+			base:   base,
+			server: func(t *Todo) { t.Priority = PriorityHigh },
+			client: func(t *Todo) { t.Completed = true },
+			want:   func(t *Todo) { t.Priority = PriorityHigh; t.Completed = true },
+		},
+		{
+			name:          "same field changed differently keeps server value",
+			base:          base,
+			server:        func(t *Todo) { t.Title = "买豆浆" },
+			client:        func(t *Todo) { t.Title = "买酸奶"; t.Description = "便利店" },
+			want:          func(t *Todo) { t.Title = "买豆浆"; t.Description = "便利店" },
+			wantConflicts: []string{"title"},
+		},
+		{
+			name:   "same field changed identically",
+			base:   base,
+			server: func(t *Todo) { t.Title = "买豆浆" },
+			client: func(t *Todo) { t.Title = "买豆浆" },
+			want:   func(t *Todo) { t.Title = "买豆浆" },
+		},
+		{
+			name:   "tags merge as sets",
+			base:   base,
+			server: func(t *Todo) { t.Tags = StringSlice{"家庭", "购物", "紧急"} },
+			client: func(t *Todo) { t.Tags = StringSlice{"家庭", "周末"} },
+			want:   func(t *Todo) { t.Tags = StringSlice{"家庭", "紧急", "周末"} },
+		},
+		{
+			name:          "missing base treats every difference as conflict",
+			base:          nil,
+			server:        func(t *Todo) { t.Priority = PriorityHigh },
+			client:        func(t *Todo) { t.Completed = true; t.Tags = StringSlice{"家庭"} },
+			want:          func(t *Todo) { t.Priority = PriorityHigh },
+			wantConflicts: []string{"completed", "priority", "tags"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client, want := copyTodo(base), copyTodo(base), copyTodo(base)
+			tt.server(&server)
+			tt.client(&client)
+			tt.want(&want)
+
+			merged, conflicts := MergeTodo(tt.base, &server, &client)
+			if !reflect.DeepEqual(merged, want) {
+				t.Errorf("merged = %+v, want %+v", merged, want)
+			}
+			if !reflect.DeepEqual(conflicts, tt.wantConflicts) {
+				t.Errorf("conflicts = %v, want %v", conflicts, tt.wantConflicts)
+			}
+		})
+	}
+}
+
+func TestBatchCreateOrUpdateTodosConflicts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		todo := &Todo{UserID: userID, Title: "写周报", Tags: StringSlice{}}
+		if err := store.CreateTodoExtended(todo); err != nil {
+			t.Fatalf("CreateTodoExtended() error = %v", err)
+		}
+		baseVersion := todo.SyncVersion
+
+		// 另一台设备修改了优先级
+		todo.Priority = PriorityUrgent
+		if err := store.UpdateTodoExtended(todo); err != nil {
+			t.Fatalf("UpdateTodoExtended() error = %v", err)
+		}
+
+		// 本设备基于旧版本标记完成
+		item := NewTodoSyncItem(todo)
+		item.Priority = int(PriorityLow)
+		item.Completed = true
+		item.BaseVersion = baseVersion
+
+		results, err := BatchCreateOrUpdateTodos(store, userID, []TodoSyncItem{item}, ConflictPolicy{})
+		if err != nil {
+			t.Fatalf("BatchCreateOrUpdateTodos() error = %v", err)
+		}
+		if got := results[0]; got.Action != "conflict" || got.Server == nil || got.Merged == nil ||
+			!got.Merged.Completed || got.Merged.Priority != int(PriorityUrgent) {
+			t.Fatalf("server_wins result = %+v", got)
+		}
+
+		results, err = BatchCreateOrUpdateTodos(store, userID, []TodoSyncItem{item}, ConflictPolicy{Default: ConflictMerge})
+		if err != nil {
+			t.Fatalf("BatchCreateOrUpdateTodos(merge) error = %v", err)
+		}
+		if got := results[0]; got.Action != "merged" || got.SyncVersion <= todo.SyncVersion {
+			t.Fatalf("merge result = %+v", got)
+		}
+
+		stored, err := store.GetTodoByID(todo.ID, userID)
+		if err != nil {
+			t.Fatalf("GetTodoByID() error = %v", err)
+		}
+		if !stored.Completed || stored.Priority != PriorityUrgent {
+			t.Errorf("merged todo = %+v, want completed with urgent priority", stored)
+		}
+
+		// 同一字段的冲突修改不会自动合并
+		item.Title = "写月报"
+		item.BaseVersion = todo.SyncVersion
+		stored.Title = "写年报"
+		if err := store.UpdateTodoExtended(stored); err != nil {
+			t.Fatalf("UpdateTodoExtended() error = %v", err)
+		}
+		results, _ = BatchCreateOrUpdateTodos(store, userID, []TodoSyncItem{item}, ConflictPolicy{Default: ConflictMerge})
+		if got := results[0]; got.Action != "conflict" || !reflect.DeepEqual(got.ConflictFields, []string{"title"}) {
+			t.Errorf("conflicting merge result = %+v", got)
+		}
+
+		policy := ConflictPolicy{Default: ConflictMerge, PerTodo: map[int]string{todo.ID: ConflictClientWins}}
+		results, _ = BatchCreateOrUpdateTodos(store, userID, []TodoSyncItem{item}, policy)
+		if got := results[0]; got.Action != "updated" {
+			t.Errorf("client_wins result = %+v", got)
+		}
+	})
+}
+
+func TestBatchCreateOrUpdateTodosConcurrent(t *testing.T) {
+	for name, factory := range concurrentStoreFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			store := factory()
+			defer store.Close()
+
+			user := &User{Username: "tester", Email: "tester@example.com", Password: "hashed"}
+			if err := store.CreateUser(user); err != nil {
+				t.Fatalf("CreateUser() error = %v", err)
+			}
+			todo := &Todo{UserID: user.ID, Title: "写周报", Tags: StringSlice{}}
+			if err := store.CreateTodoExtended(todo); err != nil {
+				t.Fatalf("CreateTodoExtended() error = %v", err)
+			}
+
+			// 两台设备基于同一版本同时修改标题，只能有一台成功，另一台必须得到冲突
+			for round := 0; round < 20; round++ {
+				stored, err := store.GetTodoByID(todo.ID, user.ID)
+				if err != nil {
+					t.Fatalf("GetTodoByID() error = %v", err)
+				}
+
+				titles := []string{fmt.Sprintf("设备A %d", round), fmt.Sprintf("设备B %d", round)}
+				results := make([]SyncResult, len(titles))
+				start := make(chan struct{})
+				var wg sync.WaitGroup
+				for i, title := range titles {
+					item := NewTodoSyncItem(stored)
+					item.Title = title
+					item.BaseVersion = stored.SyncVersion
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						<-start
+						batch, err := BatchCreateOrUpdateTodos(store, user.ID, []TodoSyncItem{item}, ConflictPolicy{})
+						if err != nil {
+							t.Errorf("BatchCreateOrUpdateTodos() error = %v", err)
+							return
+						}
+						results[i] = batch[0]
+					}()
+				}
+				close(start)
+				wg.Wait()
+
+				winner := -1
+				for i, result := range results {
+					switch result.Action {
+					case "updated":
+						if winner >= 0 {
+							t.Fatalf("round %d: both devices updated from the same base version: %+v", round, results)
+						}
+						winner = i
+					case "conflict":
+					default:
+						t.Fatalf("round %d: result = %+v", round, result)
+					}
+				}
+				if winner < 0 {
+					t.Fatalf("round %d: no device updated: %+v", round, results)
+				}
+				stored, err = store.GetTodoByID(todo.ID, user.ID)
+				if err != nil {
+					t.Fatalf("GetTodoByID() error = %v", err)
+				}
+				if stored.Title != titles[winner] {
+					t.Fatalf("round %d: stored title = %q, want %q", round, stored.Title, titles[winner])
+				}
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -93,15 +94,16 @@ type User struct {
 
 // Category 分类模型
 type Category struct {
-	ID          int       `json:"id" example:"1" swaggertype:"integer" description:"分类ID"`                           // 分类ID
-	UserID      int       `json:"user_id" example:"1" swaggertype:"integer" description:"用户ID"`                      // 用户ID
-	Name        string    `json:"name" example:"工作" swaggertype:"string" description:"分类名称"`                         // 分类名称
-	Color       string    `json:"color" example:"#FF5722" swaggertype:"string" description:"分类颜色"`                   // 分类颜色
-	Icon        string    `json:"icon" example:"work" swaggertype:"string" description:"分类图标"`                       // 分类图标
-	CreatedAt   time.Time `json:"created_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"创建时间"` // 创建时间
-	UpdatedAt   time.Time `json:"updated_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"更新时间"` // 更新时间
-	IsDeleted   bool      `json:"is_deleted" example:"false" swaggertype:"boolean" description:"是否删除"`               // 是否删除
-	SyncVersion int64     `json:"sync_version" example:"1640995200000" swaggertype:"integer" description:"同步版本号"`    // 同步版本号
+	ID          int       `json:"id" example:"1" swaggertype:"integer" description:"分类ID"`                                       // 分类ID
+	UUID        string    `json:"uuid" example:"3b241101-e2bb-4255-8caf-4136c566a962" swaggertype:"string" description:"分类UUID"` // 客户端生成的UUID，未提供时由服务器生成
+	UserID      int       `json:"user_id" example:"1" swaggertype:"integer" description:"用户ID"`                                  // 用户ID
+	Name        string    `json:"name" example:"工作" swaggertype:"string" description:"分类名称"`                                     // 分类名称
+	Color       string    `json:"color" example:"#FF5722" swaggertype:"string" description:"分类颜色"`                               // 分类颜色
+	Icon        string    `json:"icon" example:"work" swaggertype:"string" description:"分类图标"`                                   // 分类图标
+	CreatedAt   time.Time `json:"created_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"创建时间"`             // 创建时间
+	UpdatedAt   time.Time `json:"updated_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"更新时间"`             // 更新时间
+	IsDeleted   bool      `json:"is_deleted" example:"false" swaggertype:"boolean" description:"是否删除"`                           // 是否删除
+	SyncVersion int64     `json:"sync_version" example:"42" swaggertype:"integer" description:"同步版本号"`                           // 同步版本号
 }
 
 // UserSettings 用户设置模型
@@ -111,25 +113,277 @@ type UserSettings struct {
 	NotificationTime string    `json:"notification_time" example:"09:00" swaggertype:"string" description:"通知时间"`         // 通知时间
 	Language         string    `json:"language" example:"zh-CN" swaggertype:"string" description:"语言设置"`                  // 语言设置
 	TimeZone         string    `json:"timezone" example:"Asia/Shanghai" swaggertype:"string" description:"时区设置"`          // 时区设置
+	DailyDigest      bool      `json:"daily_digest" example:"true" swaggertype:"boolean" description:"是否接收每日摘要"`          // 是否在通知时间接收每日摘要
 	CreatedAt        time.Time `json:"created_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"创建时间"` // 创建时间
 	UpdatedAt        time.Time `json:"updated_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"更新时间"` // 更新时间
-	SyncVersion      int64     `json:"sync_version" example:"1640995200000" swaggertype:"integer" description:"同步版本号"`    // 同步版本号
+	SyncVersion      int64     `json:"sync_version" example:"42" swaggertype:"integer" description:"同步版本号"`               // 同步版本号
+}
+
+// Location 返回用户设置的时区，无法识别时使用UTC
+func (s *UserSettings) Location() *time.Location {
+	if loc, err := time.LoadLocation(s.TimeZone); err == nil {
+		return loc
+	}
+	return time.UTC
 }
 
 // Todo TODO任务模型（扩展版）
 type Todo struct {
-	ID          int         `json:"id" example:"1" swaggertype:"integer" description:"任务ID"`                                   // 任务ID
-	UserID      int         `json:"user_id" example:"1" swaggertype:"integer" description:"用户ID"`                              // 用户ID
-	Title       string      `json:"title" example:"学习Go语言" swaggertype:"string" description:"任务标题"`                            // 任务标题
-	Description string      `json:"description" example:"学习Go语言基础语法" swaggertype:"string" description:"任务描述"`                  // 任务描述
-	Completed   bool        `json:"completed" example:"false" swaggertype:"boolean" description:"是否完成"`                        // 是否完成
-	Priority    Priority    `json:"priority" example:"1" swaggertype:"integer" description:"优先级"`                              // 优先级
-	DueDate     *time.Time  `json:"due_date,omitempty" example:"2023-12-31T23:59:59Z" swaggertype:"string" description:"截止日期"` // 截止日期
-	Tags        StringSlice `json:"tags" example:"[\"工作\",\"重要\"]" swaggertype:"array,string" description:"标签"`                // 标签
-	CategoryID  *int        `json:"category_id,omitempty" example:"1" swaggertype:"integer" description:"分类ID"`                // 分类ID
-	Reminder    *time.Time  `json:"reminder,omitempty" example:"2023-12-30T09:00:00Z" swaggertype:"string" description:"提醒时间"` // 提醒时间
-	CreatedAt   time.Time   `json:"created_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"创建时间"`         // 创建时间
-	UpdatedAt   time.Time   `json:"updated_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"更新时间"`         // 更新时间
-	IsDeleted   bool        `json:"is_deleted" example:"false" swaggertype:"boolean" description:"是否删除"`                       // 是否删除
-	SyncVersion int64       `json:"sync_version" example:"1640995200000" swaggertype:"integer" description:"同步版本号"`            // 同步版本号
+	ID           int         `json:"id" example:"1" swaggertype:"integer" description:"任务ID"`                                                          // 任务ID
+	UUID         string      `json:"uuid" example:"9f0c2a4e-5d1b-4c3a-8e7f-6a5b4c3d2e1f" swaggertype:"string" description:"任务UUID"`                    // 客户端生成的UUID，未提供时由服务器生成
+	UserID       int         `json:"user_id" example:"1" swaggertype:"integer" description:"用户ID"`                                                     // 用户ID
+	Title        string      `json:"title" example:"学习Go语言" swaggertype:"string" description:"任务标题"`                                                   // 任务标题
+	Description  string      `json:"description" example:"学习Go语言基础语法" swaggertype:"string" description:"任务描述"`                                         // 任务描述
+	Completed    bool        `json:"completed" example:"false" swaggertype:"boolean" description:"是否完成"`                                               // 是否完成
+	Priority     Priority    `json:"priority" example:"1" swaggertype:"integer" description:"优先级"`                                                     // 优先级
+	DueDate      *time.Time  `json:"due_date,omitempty" example:"2023-12-31T23:59:59Z" swaggertype:"string" description:"截止日期"`                        // 截止日期
+	Tags         StringSlice `json:"tags" example:"[\"工作\",\"重要\"]" swaggertype:"array,string" description:"标签"`                                       // 标签
+	CategoryID   *int        `json:"category_id,omitempty" example:"1" swaggertype:"integer" description:"分类ID"`                                       // 分类ID
+	CategoryUUID *string     `json:"category_uuid,omitempty" example:"3b241101-e2bb-4255-8caf-4136c566a962" swaggertype:"string" description:"分类UUID"` // 分类UUID，读取时由 category_id 关联得到
+	Reminder     *time.Time  `json:"reminder,omitempty" example:"2023-12-30T09:00:00Z" swaggertype:"string" description:"提醒时间"`                        // 提醒时间
+	Recurrence   *string     `json:"recurrence,omitempty" example:"FREQ=WEEKLY;BYDAY=MO,WE" swaggertype:"string" description:"重复规则(RRULE)"`            // 重复规则，iCalendar RRULE子集
+	CreatedAt    time.Time   `json:"created_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"创建时间"`                                // 创建时间
+	UpdatedAt    time.Time   `json:"updated_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"更新时间"`                                // 更新时间
+	IsDeleted    bool        `json:"is_deleted" example:"false" swaggertype:"boolean" description:"是否删除"`                                              // 是否删除
+	SyncVersion  int64       `json:"sync_version" example:"42" swaggertype:"integer" description:"同步版本号"`                                              // 同步版本号
+
+	ChecklistTotal     int `json:"checklist_total" example:"3" swaggertype:"integer" description:"检查项总数"`       // 未删除的检查项数量，读取时统计得到
+	ChecklistCompleted int `json:"checklist_completed" example:"1" swaggertype:"integer" description:"已完成检查项数"` // 已完成的检查项数量，读取时统计得到
+
+	SearchRank float64          `json:"search_rank,omitempty" example:"1.4" swaggertype:"number" description:"搜索相关度"` // 搜索相关度，仅搜索结果包含
+	Highlight  *SearchHighlight `json:"highlight,omitempty" description:"搜索匹配高亮"`                                     // 搜索匹配部分的高亮片段，仅搜索结果包含
+}
+
+// ChecklistItem TODO的检查项（子任务），同一TODO下按 Position 升序排列
+type ChecklistItem struct {
+	ID          int       `json:"id" example:"1" swaggertype:"integer" description:"检查项ID"`                                             // 检查项ID
+	UUID        string    `json:"uuid" example:"5c8e2f1a-7b3d-4e6f-9a1c-2d4e6f8a0b1c" swaggertype:"string" description:"检查项UUID"`       // 客户端生成的UUID，未提供时由服务器生成
+	TodoID      int       `json:"todo_id" example:"1" swaggertype:"integer" description:"所属任务ID"`                                       // 所属TODO ID
+	TodoUUID    string    `json:"todo_uuid" example:"9f0c2a4e-5d1b-4c3a-8e7f-6a5b4c3d2e1f" swaggertype:"string" description:"所属任务UUID"` // 所属TODO UUID，读取时由 todo_id 关联得到
+	UserID      int       `json:"user_id" example:"1" swaggertype:"integer" description:"用户ID"`                                         // 用户ID
+	Title       string    `json:"title" example:"准备会议材料" swaggertype:"string" description:"检查项标题"`                                      // 检查项标题
+	Completed   bool      `json:"completed" example:"false" swaggertype:"boolean" description:"是否完成"`                                   // 是否完成
+	Position    int       `json:"position" example:"1" swaggertype:"integer" description:"排序位置"`                                        // 排序位置，从1开始
+	CreatedAt   time.Time `json:"created_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"创建时间"`                    // 创建时间
+	UpdatedAt   time.Time `json:"updated_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"更新时间"`                    // 更新时间
+	IsDeleted   bool      `json:"is_deleted" example:"false" swaggertype:"boolean" description:"是否删除"`                                  // 是否删除
+	SyncVersion int64     `json:"sync_version" example:"42" swaggertype:"integer" description:"同步版本号"`                                  // 同步版本号
+}
+
+// Tag 标签元数据，TODO中仍以名称引用标签；UsageCount 只在列出标签时填充
+type Tag struct {
+	ID          int       `json:"id" example:"1" swaggertype:"integer" description:"标签ID，没有元数据的标签为0"`                                      // 标签ID
+	UUID        string    `json:"uuid,omitempty" example:"6a2c4e8f-1b3d-4f5a-9c7e-0d2f4b6a8c1e" swaggertype:"string" description:"标签UUID"` // 客户端生成的UUID，未提供时由服务器生成
+	UserID      int       `json:"user_id" example:"1" swaggertype:"integer" description:"用户ID"`                                            // 用户ID
+	Name        string    `json:"name" example:"工作" swaggertype:"string" description:"标签名称"`                                               // 标签名称，同一用户下未删除的标签唯一
+	Color       string    `json:"color" example:"#9E9E9E" swaggertype:"string" description:"标签颜色"`                                         // 标签颜色
+	Icon        string    `json:"icon" example:"label" swaggertype:"string" description:"标签图标"`                                            // 标签图标
+	UsageCount  int       `json:"usage_count" example:"12" swaggertype:"integer" description:"使用该标签的TODO数量"`                               // 使用该标签的未删除TODO数量
+	CreatedAt   time.Time `json:"created_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"创建时间"`                       // 创建时间
+	UpdatedAt   time.Time `json:"updated_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"更新时间"`                       // 更新时间
+	IsDeleted   bool      `json:"is_deleted" example:"false" swaggertype:"boolean" description:"是否删除"`                                     // 是否删除
+	SyncVersion int64     `json:"sync_version" example:"42" swaggertype:"integer" description:"同步版本号"`                                     // 同步版本号
+}
+
+// SmartList 智能列表，保存一组筛选和排序条件，执行时返回满足条件的TODO
+type SmartList struct {
+	ID          int                 `json:"id" example:"1" swaggertype:"integer" description:"智能列表ID"`                                       // 智能列表ID
+	UUID        string              `json:"uuid" example:"7d1e3f5a-2b4c-4d6e-8f0a-1b3c5d7e9f2a" swaggertype:"string" description:"智能列表UUID"` // 客户端生成的UUID，未提供时由服务器生成
+	UserID      int                 `json:"user_id" example:"1" swaggertype:"integer" description:"用户ID"`                                    // 用户ID
+	Name        string              `json:"name" example:"本周重要" swaggertype:"string" description:"智能列表名称"`                                   // 智能列表名称
+	Icon        string              `json:"icon" example:"star" swaggertype:"string" description:"智能列表图标"`                                   // 智能列表图标
+	Color       string              `json:"color" example:"#2196F3" swaggertype:"string" description:"智能列表颜色"`                               // 智能列表颜色
+	Definition  SmartListDefinition `json:"definition" description:"筛选和排序条件"`                                                                // 筛选和排序条件
+	CreatedAt   time.Time           `json:"created_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"创建时间"`               // 创建时间
+	UpdatedAt   time.Time           `json:"updated_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"更新时间"`               // 更新时间
+	IsDeleted   bool                `json:"is_deleted" example:"false" swaggertype:"boolean" description:"是否删除"`                             // 是否删除
+	SyncVersion int64               `json:"sync_version" example:"42" swaggertype:"integer" description:"同步版本号"`                             // 同步版本号
+}
+
+// Revision TODO或分类的一次修改记录，按字段保存修改前后的取值
+type Revision struct {
+	ID          int             `json:"id" example:"1" swaggertype:"integer" description:"修改记录ID"`                                                  // 修改记录ID
+	UserID      int             `json:"user_id" example:"1" swaggertype:"integer" description:"执行操作的用户ID"`                                          // 执行操作的用户，即数据所有者
+	EntityType  string          `json:"entity_type" example:"todo" swaggertype:"string" description:"数据类型(todo/category)"`                          // 数据类型
+	EntityID    int             `json:"entity_id" example:"1" swaggertype:"integer" description:"数据ID"`                                             // 数据ID
+	EntityUUID  string          `json:"entity_uuid" example:"9f0c2a4e-5d1b-4c3a-8e7f-6a5b4c3d2e1f" swaggertype:"string" description:"数据UUID"`       // 数据UUID
+	Action      string          `json:"action" example:"update" swaggertype:"string" description:"操作类型(create/update/delete/restore)"`              // 操作类型
+	Changes     RevisionChanges `json:"changes" swaggertype:"object" description:"修改的字段及修改前后的取值"`                                                   // 修改的字段
+	DeviceID    string          `json:"device_id,omitempty" example:"6f1c3a52-6a0e-4f5e-9a53-0f3f4c1b7e21" swaggertype:"string" description:"设备ID"` // 执行操作的设备，会话未注册设备时为空
+	SyncVersion int64           `json:"sync_version" example:"42" swaggertype:"integer" description:"本次写入的同步版本号"`                                   // 本次写入分配的同步版本号，物理删除时为0
+	CreatedAt   time.Time       `json:"created_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"修改时间"`                          // 修改时间
+}
+
+// ReminderDelivery TODO提醒在一个通知渠道上的投递记录，同一TODO的同一提醒时间在每个渠道只有一条记录
+type ReminderDelivery struct {
+	ID            int        `json:"id" example:"1" swaggertype:"integer" description:"投递记录ID"`                                                    // 投递记录ID
+	UserID        int        `json:"user_id" example:"1" swaggertype:"integer" description:"用户ID"`                                                 // 用户ID
+	TodoID        int        `json:"todo_id" example:"1" swaggertype:"integer" description:"TODO ID"`                                              // TODO ID
+	ReminderAt    time.Time  `json:"reminder_at" example:"2023-01-01T09:00:00Z" swaggertype:"string" description:"提醒时间"`                           // 投递的提醒时间
+	Channel       string     `json:"channel" example:"email" swaggertype:"string" description:"通知渠道(webhook/email/push)"`                          // 通知渠道
+	Status        string     `json:"status" example:"sent" swaggertype:"string" description:"投递状态(pending/sending/sent/failed/skipped/cancelled)"` // 投递状态
+	Attempts      int        `json:"attempts" example:"1" swaggertype:"integer" description:"已尝试发送的次数"`                                            // 已尝试发送的次数
+	LastError     string     `json:"last_error,omitempty" example:"webhook returned status 500" swaggertype:"string" description:"最近一次失败或取消的原因"`   // 最近一次失败或取消的原因
+	NextAttemptAt time.Time  `json:"next_attempt_at" example:"2023-01-01T09:01:00Z" swaggertype:"string" description:"下次尝试发送的时间"`                  // 下次尝试发送的时间
+	ClaimedBy     string     `json:"-" swaggerignore:"true"`                                                                                       // 认领该记录的服务实例
+	ClaimedUntil  *time.Time `json:"-" swaggerignore:"true"`                                                                                       // 认领租约到期时间
+	SentAt        *time.Time `json:"sent_at,omitempty" example:"2023-01-01T09:00:05Z" swaggertype:"string" description:"发送成功时间"`                   // 发送成功时间
+	CreatedAt     time.Time  `json:"created_at" example:"2023-01-01T09:00:00Z" swaggertype:"string" description:"创建时间"`                            // 创建时间
+	UpdatedAt     time.Time  `json:"updated_at" example:"2023-01-01T09:00:05Z" swaggertype:"string" description:"更新时间"`                            // 更新时间
+}
+
+// DigestDelivery 每日摘要投递记录，同一用户同一天（按用户时区）在每个通知渠道只投递一次
+type DigestDelivery struct {
+	ID            int        // 投递记录ID
+	UserID        int        // 用户ID
+	DigestDate    string     // 摘要日期（用户时区），格式为 YYYY-MM-DD
+	Channel       string     // 通知渠道
+	Status        string     // 投递状态，取值与提醒投递记录相同
+	Attempts      int        // 已尝试发送的次数
+	LastError     string     // 最近一次失败或取消的原因
+	NextAttemptAt time.Time  // 下次尝试发送的时间
+	ClaimedBy     string     // 认领该记录的服务实例
+	ClaimedUntil  *time.Time // 认领租约到期时间
+	SentAt        *time.Time // 发送成功时间
+	CreatedAt     time.Time  // 创建时间
+	UpdatedAt     time.Time  // 更新时间
+}
+
+// DigestSubscriber 开启每日摘要的用户设置，没有保存过设置的用户使用默认设置
+type DigestSubscriber struct {
+	UserSettings
+	LastDigestDate string // 最近一次生成投递记录的摘要日期，没有时为空
+}
+
+// DailyDigest 每日摘要内容，逾期和紧急的判断条件与 todo_stats 视图一致
+type DailyDigest struct {
+	Overdue            []Todo `json:"overdue"`             // 截止时间已过的未完成TODO，按截止时间排序
+	DueToday           []Todo `json:"due_today"`           // 当天剩余时间内到期的未完成TODO，按截止时间排序
+	Urgent             []Todo `json:"urgent"`              // 紧急优先级的未完成TODO
+	CompletedYesterday []Todo `json:"completed_yesterday"` // 前一天完成且仍为完成状态的TODO，按完成时间排序
+}
+
+// IsEmpty 摘要中没有任何TODO
+func (d *DailyDigest) IsEmpty() bool {
+	return len(d.Overdue) == 0 && len(d.DueToday) == 0 && len(d.Urgent) == 0 && len(d.CompletedYesterday) == 0
+}
+
+// WebhookEndpoint 用户登记的Webhook地址，按事件类型订阅TODO、分类和设置的变更
+type WebhookEndpoint struct {
+	ID                  int         `json:"id" example:"1" swaggertype:"integer" description:"Webhook ID"`                                                        // Webhook ID
+	UserID              int         `json:"user_id" example:"1" swaggertype:"integer" description:"用户ID"`                                                         // 登记该Webhook的用户
+	URL                 string      `json:"url" example:"https://chat.example.com/hooks/todo" swaggertype:"string" description:"接收事件的URL"`                        // 接收事件的URL
+	Secret              string      `json:"secret,omitempty" example:"whsec_3f9a..." swaggertype:"string" description:"签名密钥，只在创建和重置密钥时返回"`                        // HMAC-SHA256签名密钥
+	Events              StringSlice `json:"events" example:"todo.completed,category.*" swaggertype:"array,string" description:"订阅的事件类型，支持 todo.* 形式的通配，为空表示全部事件"` // 订阅的事件类型
+	AllUsers            bool        `json:"all_users" example:"false" swaggertype:"boolean" description:"是否接收全部用户的事件（仅管理员）"`                                      // 是否接收全部用户的事件
+	Enabled             bool        `json:"enabled" example:"true" swaggertype:"boolean" description:"是否启用"`                                                      // 是否启用
+	ConsecutiveFailures int         `json:"consecutive_failures" example:"0" swaggertype:"integer" description:"连续发送失败的次数，发送成功后清零"`                               // 连续发送失败的次数
+	DisabledAt          *time.Time  `json:"disabled_at,omitempty" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"因连续失败被自动停用的时间"`                // 自动停用的时间
+	DisabledReason      string      `json:"disabled_reason,omitempty" example:"webhook returned status 500" swaggertype:"string" description:"自动停用前最后一次失败的原因"`    // 自动停用的原因
+	CreatedAt           time.Time   `json:"created_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"创建时间"`                                    // 创建时间
+	UpdatedAt           time.Time   `json:"updated_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"更新时间"`                                    // 更新时间
+}
+
+// Subscribes Webhook是否订阅了 eventType 类型的事件
+func (e *WebhookEndpoint) Subscribes(eventType string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, pattern := range e.Events {
+		if pattern == "*" || pattern == eventType ||
+			(strings.HasSuffix(pattern, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEvent 写入数据时生成的Webhook事件，也是发送给Webhook的请求体；重试和重放时内容不变
+type WebhookEvent struct {
+	ID          int             `json:"id" example:"1" swaggertype:"integer" description:"事件ID，接收方可以据此去重"`                                              // 事件ID
+	Type        string          `json:"event" example:"todo.completed" swaggertype:"string" description:"事件类型"`                                         // 事件类型
+	UserID      int             `json:"user_id" example:"1" swaggertype:"integer" description:"数据所属的用户ID"`                                              // 数据所属的用户ID
+	EntityType  string          `json:"entity_type" example:"todo" swaggertype:"string" description:"数据类型(todo/category/settings)"`                     // 数据类型
+	EntityID    int             `json:"entity_id,omitempty" example:"1" swaggertype:"integer" description:"数据ID"`                                       // 数据ID，用户设置没有ID
+	EntityUUID  string          `json:"entity_uuid,omitempty" example:"6f1c3a52-6a0e-4f5e-9a53-0f3f4c1b7e21" swaggertype:"string" description:"数据UUID"` // 数据UUID
+	SyncVersion int64           `json:"sync_version" example:"42" swaggertype:"integer" description:"写入分配的同步版本号"`                                       // 写入分配的同步版本号，物理删除时为0
+	Data        json.RawMessage `json:"data" swaggertype:"object" description:"写入后的数据，删除时为删除前的数据"`                                                      // 写入后的数据
+	Changes     RevisionChanges `json:"changes,omitempty" swaggertype:"object" description:"发生变化的字段，与修改历史相同"`                                           // 发生变化的字段，用户设置没有
+	CreatedAt   time.Time       `json:"created_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"事件时间"`                              // 事件时间
+}
+
+// WebhookDelivery 一个事件向一个Webhook的投递记录，重放时生成新的记录
+type WebhookDelivery struct {
+	ID            int        `json:"id" example:"1" swaggertype:"integer" description:"投递记录ID"`                                                  // 投递记录ID
+	EndpointID    int        `json:"endpoint_id" example:"1" swaggertype:"integer" description:"Webhook ID"`                                     // Webhook ID
+	EventID       int        `json:"event_id" example:"1" swaggertype:"integer" description:"事件ID"`                                              // 事件ID
+	EventType     string     `json:"event" example:"todo.completed" swaggertype:"string" description:"事件类型"`                                     // 事件类型
+	Status        string     `json:"status" example:"sent" swaggertype:"string" description:"投递状态(pending/sending/sent/failed/cancelled)"`       // 投递状态
+	Attempts      int        `json:"attempts" example:"1" swaggertype:"integer" description:"已尝试发送的次数"`                                          // 已尝试发送的次数
+	LastError     string     `json:"last_error,omitempty" example:"webhook returned status 500" swaggertype:"string" description:"最近一次失败或取消的原因"` // 最近一次失败或取消的原因
+	NextAttemptAt time.Time  `json:"next_attempt_at" example:"2023-01-01T09:01:00Z" swaggertype:"string" description:"下次尝试发送的时间"`                // 下次尝试发送的时间
+	ClaimedBy     string     `json:"-" swaggerignore:"true"`                                                                                     // 认领该记录的服务实例
+	ClaimedUntil  *time.Time `json:"-" swaggerignore:"true"`                                                                                     // 认领租约到期时间
+	SentAt        *time.Time `json:"sent_at,omitempty" example:"2023-01-01T09:00:05Z" swaggertype:"string" description:"发送成功时间"`                 // 发送成功时间
+	CreatedAt     time.Time  `json:"created_at" example:"2023-01-01T09:00:00Z" swaggertype:"string" description:"创建时间"`                          // 创建时间
+	UpdatedAt     time.Time  `json:"updated_at" example:"2023-01-01T09:00:05Z" swaggertype:"string" description:"更新时间"`                          // 更新时间
+}
+
+// CalendarFeed iCalendar订阅地址，令牌只保存哈希值，限定分类时只包含该分类的TODO
+type CalendarFeed struct {
+	ID             int        `json:"id" example:"1" swaggertype:"integer" description:"订阅ID"`                                                             // 订阅ID
+	UserID         int        `json:"user_id" example:"1" swaggertype:"integer" description:"用户ID"`                                                        // 用户ID
+	Name           string     `json:"name" example:"工作截止日期" swaggertype:"string" description:"订阅名称，作为日历名称显示"`                                              // 订阅名称
+	CategoryID     *int       `json:"category_id,omitempty" example:"1" swaggertype:"integer" description:"限定的分类ID，为空表示全部TODO"`                            // 限定的分类ID
+	CategoryUUID   *string    `json:"category_uuid,omitempty" example:"3b241101-e2bb-4255-8caf-4136c566a962" swaggertype:"string" description:"限定的分类UUID"` // 限定的分类UUID，读取时由 category_id 关联得到
+	TokenHash      string     `json:"-" swaggerignore:"true"`                                                                                              // 订阅令牌的SHA-256哈希
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty" example:"2023-01-01T09:00:00Z" swaggertype:"string" description:"日历客户端最后一次读取的时间"`         // 最后一次读取的时间
+	CreatedAt      time.Time  `json:"created_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"创建时间"`                                   // 创建时间
+	UpdatedAt      time.Time  `json:"updated_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"更新时间，重新生成令牌时更新"`                         // 更新时间
+}
+
+// AppPassword CalDAV客户端使用的应用专用密码，只保存哈希值；每个客户端单独生成，可以单独删除
+type AppPassword struct {
+	ID           int        `json:"id" example:"1" swaggertype:"integer" description:"密码ID"`                                                  // 密码ID
+	UserID       int        `json:"user_id" example:"1" swaggertype:"integer" description:"用户ID"`                                             // 用户ID
+	Name         string     `json:"name" example:"我的Mac" swaggertype:"string" description:"名称，用于区分使用该密码的客户端"`                                 // 名称
+	PasswordHash string     `json:"-" swaggerignore:"true"`                                                                                   // 密码的SHA-256哈希
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty" example:"2023-01-01T09:00:00Z" swaggertype:"string" description:"客户端最后一次使用该密码的时间"` // 最后一次使用的时间
+	CreatedAt    time.Time  `json:"created_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"创建时间"`                        // 创建时间
+}
+
+// RefreshToken 刷新令牌，只保存哈希值；同一登录会话内轮换的令牌共享 SessionID
+type RefreshToken struct {
+	ID        int        `json:"id"`                   // 令牌ID
+	UserID    int        `json:"user_id"`              // 用户ID
+	SessionID string     `json:"session_id"`           // 登录会话ID
+	TokenHash string     `json:"-"`                    // 令牌SHA-256哈希
+	ExpiresAt time.Time  `json:"expires_at"`           // 过期时间
+	CreatedAt time.Time  `json:"created_at"`           // 创建时间
+	UsedAt    *time.Time `json:"used_at,omitempty"`    // 轮换使用时间
+	RevokedAt *time.Time `json:"revoked_at,omitempty"` // 撤销时间
+}
+
+// Device 已注册设备，每个设备绑定一个登录会话
+type Device struct {
+	ID              string     `json:"id" example:"6f1c3a52-6a0e-4f5e-9a53-0f3f4c1b7e21" swaggertype:"string" description:"设备ID"`         // 设备ID
+	UserID          int        `json:"user_id" example:"1" swaggertype:"integer" description:"用户ID"`                                      // 用户ID
+	Name            string     `json:"name" example:"我的iPhone" swaggertype:"string" description:"设备名称"`                                   // 设备名称
+	Platform        string     `json:"platform" example:"ios" swaggertype:"string" description:"设备平台"`                                    // 设备平台 (ios/watchos/macos/android/web)
+	SessionID       string     `json:"-" swaggerignore:"true"`                                                                            // 当前绑定的登录会话
+	PushToken       string     `json:"-" swaggerignore:"true"`                                                                            // 推送令牌（APNs设备令牌），为空时不向该设备推送提醒
+	LastSyncVersion int64      `json:"last_sync_version" example:"42" swaggertype:"integer" description:"已确认的同步版本号"`                      // 已确认的同步版本号
+	LastSyncedAt    *time.Time `json:"last_synced_at,omitempty" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"最后同步时间"` // 最后同步时间
+	CreatedAt       time.Time  `json:"created_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"创建时间"`                 // 创建时间
+	UpdatedAt       time.Time  `json:"updated_at" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"更新时间"`                 // 更新时间
+	RevokedAt       *time.Time `json:"revoked_at,omitempty" example:"2023-01-01T00:00:00Z" swaggertype:"string" description:"撤销时间"`       // 撤销时间
+}
+
+// IdempotencyKey 客户端生成的幂等键，记录首次请求创建的数据，重试时直接返回该数据
+type IdempotencyKey struct {
+	UserID       int       `json:"user_id"`       // 用户ID
+	Key          string    `json:"key"`           // 客户端生成的UUID
+	ResourceType string    `json:"resource_type"` // 数据类型 (todo/category/checklist_item)
+	ResourceID   int       `json:"resource_id"`   // 首次请求创建的数据ID
+	CreatedAt    time.Time `json:"created_at"`    // 创建时间
 }
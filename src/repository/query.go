@@ -0,0 +1,314 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 搜索查询语法：空白分隔的多个条件需同时满足，每个条件前加 - 表示排除。
+//
+//	周报 rep*            搜索词，以 * 结尾按前缀匹配
+//	"weekly report"      短语
+//	tag:work,home        包含任一标签
+//	category:"个人"       分类名称，多个名称以逗号分隔
+//	priority:>=high      优先级：low/medium/high/urgent 或 0-3，可加比较符 = > >= < <=
+//	due:<2026-11-01      截止日期：YYYY-MM-DD 或 today/tomorrow/yesterday，按用户时区的整天计算，可加比较符
+//	created:/updated:    创建、更新日期，格式同 due
+//	is:open/done/overdue 完成状态、逾期
+//	has:due/reminder     设置了截止时间、提醒
+//
+// 字段值含空白时用双引号包裹，包裹后逗号不再分隔多个值。
+
+// SearchSyntaxError 搜索语法错误，Offset 和 Length 以字符计，指出出错的片段
+type SearchSyntaxError struct {
+	Offset  int
+	Length  int
+	Message string
+}
+
+func (e *SearchSyntaxError) Error() string {
+	return fmt.Sprintf("第%d个字符：%s", e.Offset+1, e.Message)
+}
+
+// searchFilter 字段条件，negate 表示排除满足条件的TODO
+type searchFilter struct {
+	filter TodoFilter
+	negate bool
+}
+
+// searchParser 搜索查询解析器，按字符处理以便报告错误位置
+type searchParser struct {
+	text  []rune
+	pos   int
+	now   time.Time // 解析相对日期和逾期的当前时间，日期按其时区计算
+	query SearchQuery
+}
+
+// ParseSearchQuery 解析搜索查询，语法见文件开头说明。now 为当前时间，日期条件按 now 的时区换算为时间范围
+func ParseSearchQuery(text string, now time.Time) (*SearchQuery, error) {
+	p := &searchParser{text: []rune(text), now: now}
+	for {
+		for p.pos < len(p.text) && unicode.IsSpace(p.text[p.pos]) {
+			p.pos++
+		}
+		if p.pos >= len(p.text) {
+			return &p.query, nil
+		}
+		if err := p.term(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// term 解析一个条件
+func (p *searchParser) term() error {
+	negate := false
+	if p.text[p.pos] == '-' && p.pos+1 < len(p.text) && !unicode.IsSpace(p.text[p.pos+1]) {
+		negate = true
+		p.pos++
+	}
+
+	if p.text[p.pos] == '"' {
+		phrase, err := p.quoted()
+		if err != nil {
+			return err
+		}
+		p.addText(phrase, false, negate)
+		return nil
+	}
+
+	nameStart := p.pos
+	if name, ok := p.fieldName(); ok {
+		valueStart := p.pos
+		var values []string
+		if p.pos < len(p.text) && p.text[p.pos] == '"' {
+			value, err := p.quoted()
+			if err != nil {
+				return err
+			}
+			values = []string{value}
+		} else {
+			for _, value := range strings.Split(p.word(), ",") {
+				if value != "" {
+					values = append(values, value)
+				}
+			}
+		}
+		if len(values) == 0 || values[0] == "" {
+			return &SearchSyntaxError{Offset: nameStart, Length: p.pos - nameStart, Message: "缺少 " + name + " 的值"}
+		}
+
+		filter, err := p.field(name, values)
+		if err != nil {
+			return &SearchSyntaxError{Offset: valueStart, Length: p.pos - valueStart, Message: err.Error()}
+		}
+		p.query.filters = append(p.query.filters, searchFilter{filter: filter, negate: negate})
+		return nil
+	}
+	if p.pos > nameStart {
+		return &SearchSyntaxError{Offset: nameStart, Length: p.pos - nameStart,
+			Message: "未知的搜索字段 " + string(p.text[nameStart:p.pos-1])}
+	}
+
+	word, prefix := strings.CutSuffix(p.word(), "*")
+	p.addText(word, prefix, negate)
+	return nil
+}
+
+// quoted 读取双引号包裹的内容
+func (p *searchParser) quoted() (string, error) {
+	start := p.pos
+	for end := start + 1; end < len(p.text); end++ {
+		if p.text[end] == '"' {
+			p.pos = end + 1
+			return string(p.text[start+1 : end]), nil
+		}
+	}
+	return "", &SearchSyntaxError{Offset: start, Length: len(p.text) - start, Message: "引号未闭合"}
+}
+
+// word 读取到空白或双引号为止的内容
+func (p *searchParser) word() string {
+	start := p.pos
+	for p.pos < len(p.text) && !unicode.IsSpace(p.text[p.pos]) && p.text[p.pos] != '"' {
+		p.pos++
+	}
+	return string(p.text[start:p.pos])
+}
+
+// fieldName 读取 字段名: 前缀。不是该形式时不移动位置并返回 false；
+// 字段名不受支持时位置停在冒号之后并返回 false，由调用方报告错误
+func (p *searchParser) fieldName() (string, bool) {
+	end := p.pos
+	for end < len(p.text) && p.text[end] < unicode.MaxASCII && unicode.IsLetter(p.text[end]) {
+		end++
+	}
+	if end == p.pos || end >= len(p.text) || p.text[end] != ':' {
+		return "", false
+	}
+	name := strings.ToLower(string(p.text[p.pos:end]))
+	p.pos = end + 1
+	switch name {
+	case "tag", "category", "priority", "due", "created", "updated", "is", "has":
+		return name, true
+	}
+	return "", false
+}
+
+// addText 添加搜索词或短语，没有可搜索词元的文本被忽略
+func (p *searchParser) addText(text string, prefix, negate bool) {
+	clause, ok := newSearchClause(text, prefix)
+	if !ok {
+		return
+	}
+	if negate {
+		p.query.excluded = append(p.query.excluded, clause)
+	} else {
+		p.query.clauses = append(p.query.clauses, clause)
+	}
+}
+
+// field 将字段条件转换为筛选条件，返回的错误信息不含位置
+func (p *searchParser) field(name string, values []string) (TodoFilter, error) {
+	switch name {
+	case "tag":
+		return TodoFilter{Tags: values, TagMatch: TagMatchAny}, nil
+	case "category":
+		return TodoFilter{CategoryNames: values}, nil
+	}
+	if len(values) > 1 {
+		return TodoFilter{}, errors.New(name + " 只能指定一个值")
+	}
+	value := values[0]
+
+	switch name {
+	case "priority":
+		op, level := cutComparison(value)
+		priority, ok := parsePriority(level)
+		if !ok {
+			return TodoFilter{}, errors.New("无效的优先级 " + level)
+		}
+		var filter TodoFilter
+		for candidate := PriorityLow; candidate <= PriorityUrgent; candidate++ {
+			if compareWith(op, int(candidate)-int(priority)) {
+				filter.Priorities = append(filter.Priorities, candidate)
+			}
+		}
+		if len(filter.Priorities) == 0 {
+			return TodoFilter{}, errors.New("没有满足条件的优先级")
+		}
+		return filter, nil
+
+	case "due", "created", "updated":
+		op, date := cutComparison(value)
+		day, err := p.parseDay(date)
+		if err != nil {
+			return TodoFilter{}, err
+		}
+		next := day.AddDate(0, 0, 1)
+		var after, before *time.Time
+		switch op {
+		case "=":
+			after, before = &day, &next
+		case "<":
+			before = &day
+		case "<=":
+			before = &next
+		case ">":
+			after = &next
+		case ">=":
+			after = &day
+		}
+		switch name {
+		case "due":
+			return TodoFilter{DueAfter: after, DueBefore: before}, nil
+		case "created":
+			return TodoFilter{CreatedAfter: after, CreatedBefore: before}, nil
+		default:
+			return TodoFilter{UpdatedAfter: after, UpdatedBefore: before}, nil
+		}
+
+	case "is":
+		switch strings.ToLower(value) {
+		case "open":
+			completed := false
+			return TodoFilter{Completed: &completed}, nil
+		case "done", "completed":
+			completed := true
+			return TodoFilter{Completed: &completed}, nil
+		case "overdue":
+			return TodoFilter{Overdue: true, Now: p.now}, nil
+		}
+		return TodoFilter{}, errors.New("is 只支持 open、done、overdue")
+
+	default: // has
+		yes := true
+		switch strings.ToLower(value) {
+		case "due":
+			return TodoFilter{HasDueDate: &yes}, nil
+		case "reminder":
+			return TodoFilter{HasReminder: &yes}, nil
+		}
+		return TodoFilter{}, errors.New("has 只支持 due、reminder")
+	}
+}
+
+// cutComparison 拆分值前的比较符，没有比较符时为 =
+func cutComparison(value string) (string, string) {
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if rest, ok := strings.CutPrefix(value, op); ok {
+			return op, rest
+		}
+	}
+	return "=", value
+}
+
+// compareWith 判断比较结果 c（负数表示小于）是否满足比较符
+func compareWith(op string, c int) bool {
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return c == 0
+}
+
+// parsePriority 解析优先级名称或数字
+func parsePriority(value string) (Priority, bool) {
+	if n, err := strconv.Atoi(value); err == nil {
+		return Priority(n), n >= int(PriorityLow) && n <= int(PriorityUrgent)
+	}
+	for p := PriorityLow; p <= PriorityUrgent; p++ {
+		if strings.EqualFold(value, p.String()) {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+// parseDay 解析日期，返回当天在 now 时区的零点
+func (p *searchParser) parseDay(value string) (time.Time, error) {
+	today := time.Date(p.now.Year(), p.now.Month(), p.now.Day(), 0, 0, 0, 0, p.now.Location())
+	switch strings.ToLower(value) {
+	case "today":
+		return today, nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, p.now.Location())
+	if err != nil {
+		return time.Time{}, errors.New("无效的日期 " + value + "，应为 YYYY-MM-DD")
+	}
+	return day, nil
+}
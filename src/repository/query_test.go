@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// searchNow 测试解析搜索查询使用的当前时间（东八区）
+var searchNow = time.Date(2026, 10, 16, 10, 0, 0, 0, time.FixedZone("CST", 8*3600))
+
+func mustParseSearch(t *testing.T, text string) *SearchQuery {
+	t.Helper()
+	q, err := ParseSearchQuery(text, searchNow)
+	if err != nil {
+		t.Fatalf("ParseSearchQuery(%q) error = %v", text, err)
+	}
+	return q
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		tsquery  string
+		fts5     string
+		excluded string
+		filters  int
+	}{
+		{"go", "('go')", `"go"`, "", 0},
+		{"北京天安门", "('北京' <-> '京天' <-> '天安' <-> '安门')", `"北京 京天 天安 安门"`, "", 0},
+		{"学", "('学':*)", `"学" *`, "", 0},
+		{"mee* 会议", "('mee':*) & ('会议')", `"mee" * AND "会议"`, "", 0},
+		{`"weekly report" 周报`, "('weekly' <-> 'report') & ('周报')", `"weekly report" AND "周报"`, "", 0},
+		{"周报 -草稿 -\"old plan\"", "('周报')", `"周报"`, "('草稿') | ('old' <-> 'plan')", 0},
+		{`tag:work priority:>=high due:<2026-11-01 is:open category:"个人" "exact phrase" -excluded`,
+			"('exact' <-> 'phrase')", `"exact phrase"`, "('excluded')", 5},
+		{"10:30 e-mail", "('10' <-> '30') & ('e' <-> 'mail')", `"10 30" AND "e mail"`, "", 0},
+		{"!!! ? -", "", "", "", 0},
+	}
+	for _, tt := range tests {
+		q := mustParseSearch(t, tt.query)
+		if got := tsquery(q.clauses, false); got != tt.tsquery {
+			t.Errorf("ParseSearchQuery(%q) tsquery = %q, want %q", tt.query, got, tt.tsquery)
+		}
+		if got := fts5(q.clauses, false); got != tt.fts5 {
+			t.Errorf("ParseSearchQuery(%q) fts5 = %q, want %q", tt.query, got, tt.fts5)
+		}
+		if got := tsquery(q.excluded, true); got != tt.excluded {
+			t.Errorf("ParseSearchQuery(%q) excluded = %q, want %q", tt.query, got, tt.excluded)
+		}
+		if len(q.filters) != tt.filters {
+			t.Errorf("ParseSearchQuery(%q) filters = %d, want %d", tt.query, len(q.filters), tt.filters)
+		}
+	}
+}
+
+func TestParseSearchQueryFields(t *testing.T) {
+	q := mustParseSearch(t, `priority:>=high -tag:"long tag",x due:2026-11-01 created:<today is:overdue`)
+	if len(q.filters) != 5 {
+		t.Fatalf("filters = %d, want 5", len(q.filters))
+	}
+
+	priority := q.filters[0].filter.Priorities
+	if len(priority) != 2 || priority[0] != PriorityHigh || priority[1] != PriorityUrgent {
+		t.Errorf("priority:>=high = %v", priority)
+	}
+	// 引号包裹的值不按逗号拆分，x 作为搜索词
+	if tag := q.filters[1]; !tag.negate || len(tag.filter.Tags) != 1 || tag.filter.Tags[0] != "long tag" {
+		t.Errorf("-tag = %+v", tag)
+	}
+	if len(q.clauses) != 1 || q.clauses[0].tokens[0] != "x" {
+		t.Errorf("clauses = %+v", q.clauses)
+	}
+
+	due := q.filters[2].filter
+	dayStart := time.Date(2026, 11, 1, 0, 0, 0, 0, searchNow.Location())
+	if !due.DueAfter.Equal(dayStart) || !due.DueBefore.Equal(dayStart.AddDate(0, 0, 1)) {
+		t.Errorf("due = [%v, %v)", due.DueAfter, due.DueBefore)
+	}
+	created := q.filters[3].filter
+	if created.CreatedAfter != nil || !created.CreatedBefore.Equal(time.Date(2026, 10, 16, 0, 0, 0, 0, searchNow.Location())) {
+		t.Errorf("created = [%v, %v)", created.CreatedAfter, created.CreatedBefore)
+	}
+	if overdue := q.filters[4].filter; !overdue.Overdue || !overdue.Now.Equal(searchNow) {
+		t.Errorf("is:overdue = %+v", overdue)
+	}
+}
+
+func TestParseSearchQueryErrors(t *testing.T) {
+	tests := []struct {
+		query  string
+		offset int
+		length int
+	}{
+		{`周报 "未闭合`, 3, 4},
+		{"tag:", 0, 4},
+		{"go priority:hgh", 12, 3},
+		{"priority:<low", 9, 4},
+		{"北京 due:<2026-13-01", 7, 11},
+		{"-is:closed", 4, 6},
+		{"has:tags", 4, 4},
+		{"周报 tga:work", 3, 4},
+		{"due:today,tomorrow", 4, 14},
+	}
+	for _, tt := range tests {
+		_, err := ParseSearchQuery(tt.query, searchNow)
+		var syntaxErr *SearchSyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("ParseSearchQuery(%q) error = %v, want SearchSyntaxError", tt.query, err)
+			continue
+		}
+		if syntaxErr.Offset != tt.offset || syntaxErr.Length != tt.length {
+			t.Errorf("ParseSearchQuery(%q) error at %d+%d, want %d+%d (%v)",
+				tt.query, syntaxErr.Offset, syntaxErr.Length, tt.offset, tt.length, err)
+		}
+	}
+}
+
+func TestStoreSearchQueryFields(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		personal := &Category{UserID: userID, Name: "个人"}
+		work := &Category{UserID: userID, Name: "工作"}
+		for _, category := range []*Category{personal, work} {
+			if err := store.CreateCategory(category); err != nil {
+				t.Fatalf("CreateCategory() error = %v", err)
+			}
+		}
+
+		due := func(day int) *time.Time {
+			d := time.Date(2026, 10, day, 12, 0, 0, 0, time.UTC)
+			return &d
+		}
+		todos := []*Todo{
+			{Title: "周报初稿", Priority: PriorityHigh, DueDate: due(20), Tags: StringSlice{"work"}, CategoryID: &work.ID},
+			{Title: "周报草稿", Priority: PriorityUrgent, DueDate: due(10), Tags: StringSlice{"work", "draft"}},
+			{Title: "买菜", Priority: PriorityLow, CategoryID: &personal.ID, Completed: true},
+			{Title: "体检", Priority: PriorityMedium, DueDate: due(1), CategoryID: &personal.ID},
+		}
+		for _, todo := range todos {
+			todo.UserID = userID
+			if err := store.CreateTodoExtended(todo); err != nil {
+				t.Fatalf("CreateTodoExtended() error = %v", err)
+			}
+		}
+
+		tests := []struct {
+			query string
+			want  []int // todos 下标，按创建时间倒序
+		}{
+			{"tag:work", []int{1, 0}},
+			{"tag:work -tag:draft", []int{0}},
+			{"tag:draft,nothing", []int{1}},
+			{"priority:>=high", []int{1, 0}},
+			{"priority:<medium", []int{2}},
+			{"due:<2026-10-16", []int{3, 1}},
+			{"due:2026-10-20", []int{0}},
+			{"-has:due", []int{2}},
+			{"is:open", []int{3, 1, 0}},
+			{"is:done", []int{2}},
+			{"is:overdue", []int{3, 1}},
+			{`category:"个人"`, []int{3, 2}},
+			{"category:个人,工作 is:open", []int{3, 0}},
+			{"-category:个人", []int{1, 0}},
+			{"category:不存在", nil},
+			{"周报 -草稿", []int{0}},
+			{"周报 -priority:urgent", []int{0}},
+			{"-周报", []int{3, 2}},
+		}
+		for _, tt := range tests {
+			results, err := store.ListTodos(userID, TodoQuery{
+				Filter: TodoFilter{Search: mustParseSearch(t, tt.query)},
+				Limit:  10,
+			})
+			if err != nil {
+				t.Fatalf("ListTodos(%q) error = %v", tt.query, err)
+			}
+			var got []int
+			for _, result := range results {
+				for i, todo := range todos {
+					if todo.ID == result.ID {
+						got = append(got, i)
+					}
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("search %q = %v, want %v", tt.query, got, tt.want)
+				continue
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("search %q = %v, want %v", tt.query, got, tt.want)
+					break
+				}
+			}
+		}
+
+		count, err := store.CountTodos(userID, TodoFilter{Search: mustParseSearch(t, "tag:work -is:done")})
+		if err != nil || count != 2 {
+			t.Errorf("CountTodos() = %d, %v; want 2", count, err)
+		}
+	})
+}
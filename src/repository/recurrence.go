@@ -0,0 +1,475 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // 用户时区的计算不依赖运行环境的时区数据库
+)
+
+// 支持的重复频率
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+	FreqYearly  = "YEARLY"
+)
+
+// ErrInvalidRecurrence 重复规则格式错误或超出支持范围
+var ErrInvalidRecurrence = errors.New("invalid recurrence rule")
+
+// maxRecurrencePeriods 查找下一次重复时最多检查的周期数，避免 BYMONTH=2;BYMONTHDAY=30 这类永不出现的规则死循环
+const maxRecurrencePeriods = 1000
+
+var weekdayCodes = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// WeekdayNum BYDAY中的一项，Ordinal 非零时表示当月第几个该星期几，负数从月末倒数
+type WeekdayNum struct {
+	Ordinal int
+	Weekday time.Weekday
+}
+
+func (w WeekdayNum) String() string {
+	if w.Ordinal == 0 {
+		return weekdayCodes[w.Weekday]
+	}
+	return strconv.Itoa(w.Ordinal) + weekdayCodes[w.Weekday]
+}
+
+// Recurrence 解析后的iCalendar RRULE，支持的子集：
+// FREQ=DAILY/WEEKLY/MONTHLY/YEARLY、INTERVAL、BYDAY（WEEKLY按星期，MONTHLY/YEARLY按第几个星期几）、
+// BYMONTHDAY（MONTHLY/YEARLY，负数从月末倒数）、BYMONTH（YEARLY）、COUNT、UNTIL，一周从周一开始
+type Recurrence struct {
+	Freq       string
+	Interval   int
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []time.Month
+	Count      int    // 剩余的重复次数（包含当前实例），0 表示不限次数
+	Until      string // 原始UNTIL值，不带Z的时间按用户时区解释
+}
+
+func invalidRecurrence(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidRecurrence, fmt.Sprintf(format, args...))
+}
+
+// ParseRecurrence 解析RRULE，可带 "RRULE:" 前缀
+func ParseRecurrence(rule string) (*Recurrence, error) {
+	rule = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:")
+	r := &Recurrence{Interval: 1}
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(rule, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || value == "" {
+			return nil, invalidRecurrence("malformed part %q", part)
+		}
+		if seen[name] {
+			return nil, invalidRecurrence("duplicate %s", name)
+		}
+		seen[name] = true
+
+		switch name {
+		case "FREQ":
+			switch value {
+			case FreqDaily, FreqWeekly, FreqMonthly, FreqYearly:
+				r.Freq = value
+			default:
+				return nil, invalidRecurrence("unsupported FREQ %s", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, invalidRecurrence("invalid INTERVAL %s", value)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, invalidRecurrence("invalid COUNT %s", value)
+			}
+			r.Count = n
+		case "UNTIL":
+			if _, err := parseUntil(value, time.UTC); err != nil {
+				return nil, invalidRecurrence("invalid UNTIL %s", value)
+			}
+			r.Until = value
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				day, err := parseWeekdayNum(v)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(v)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, invalidRecurrence("invalid BYMONTHDAY %s", v)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		case "BYMONTH":
+			for _, v := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 || n > 12 {
+					return nil, invalidRecurrence("invalid BYMONTH %s", v)
+				}
+				r.ByMonth = append(r.ByMonth, time.Month(n))
+			}
+		case "WKST":
+			if value != "MO" {
+				return nil, invalidRecurrence("only WKST=MO is supported")
+			}
+		default:
+			return nil, invalidRecurrence("unsupported part %s", name)
+		}
+	}
+
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// validate 检查各部分的组合是否在支持范围内
+func (r *Recurrence) validate() error {
+	if r.Freq == "" {
+		return invalidRecurrence("FREQ is required")
+	}
+	if r.Count > 0 && r.Until != "" {
+		return invalidRecurrence("COUNT and UNTIL are mutually exclusive")
+	}
+	if len(r.ByDay) > 0 && len(r.ByMonthDay) > 0 {
+		return invalidRecurrence("BYDAY and BYMONTHDAY cannot be combined")
+	}
+
+	hasOrdinal := false
+	for _, day := range r.ByDay {
+		hasOrdinal = hasOrdinal || day.Ordinal != 0
+	}
+	switch r.Freq {
+	case FreqDaily:
+		if len(r.ByDay) > 0 || len(r.ByMonthDay) > 0 || len(r.ByMonth) > 0 {
+			return invalidRecurrence("DAILY does not support BY* parts")
+		}
+	case FreqWeekly:
+		if hasOrdinal || len(r.ByMonthDay) > 0 || len(r.ByMonth) > 0 {
+			return invalidRecurrence("WEEKLY only supports BYDAY without ordinals")
+		}
+	case FreqMonthly:
+		if len(r.ByMonth) > 0 {
+			return invalidRecurrence("MONTHLY does not support BYMONTH")
+		}
+	case FreqYearly:
+		if len(r.ByDay) > 0 && len(r.ByMonth) == 0 {
+			return invalidRecurrence("YEARLY with BYDAY requires BYMONTH")
+		}
+	}
+	return nil
+}
+
+// parseWeekdayNum 解析BYDAY中的一项，如 MO、2TU、-1FR
+func parseWeekdayNum(value string) (WeekdayNum, error) {
+	if len(value) < 2 {
+		return WeekdayNum{}, invalidRecurrence("invalid BYDAY %s", value)
+	}
+	code := value[len(value)-2:]
+	weekday := -1
+	for i, c := range weekdayCodes {
+		if c == code {
+			weekday = i
+		}
+	}
+	if weekday < 0 {
+		return WeekdayNum{}, invalidRecurrence("invalid BYDAY %s", value)
+	}
+
+	day := WeekdayNum{Weekday: time.Weekday(weekday)}
+	if prefix := value[:len(value)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return WeekdayNum{}, invalidRecurrence("invalid BYDAY %s", value)
+		}
+		day.Ordinal = n
+	}
+	return day, nil
+}
+
+// parseUntil 解析UNTIL：UTC时间（带Z）、loc 中的本地时间，或日期（当天结束前都有效）
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102T150405", value, loc); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("20060102", value, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
+
+// String 将规则编码为RRULE（不带 "RRULE:" 前缀）
+func (r *Recurrence) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]string, len(r.ByMonth))
+		for i, month := range r.ByMonth {
+			months[i] = strconv.Itoa(int(month))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			days[i] = day.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != "" {
+		parts = append(parts, "UNTIL="+r.Until)
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next 返回 start 之后的下一次重复时间。按 loc 中的日历计算并保持墙上时间不变，
+// 夏令时切换前后仍在同一钟点；COUNT 已用完或超过 UNTIL 时返回false
+func (r *Recurrence) Next(start time.Time, loc *time.Location) (time.Time, bool) {
+	if r.Count == 1 {
+		return time.Time{}, false
+	}
+
+	next, ok := r.nextAfter(start.In(loc))
+	if !ok {
+		return time.Time{}, false
+	}
+	if r.Until != "" {
+		until, err := parseUntil(r.Until, loc)
+		if err != nil || next.After(until) {
+			return time.Time{}, false
+		}
+	}
+	return next, true
+}
+
+func (r *Recurrence) nextAfter(start time.Time) (time.Time, bool) {
+	year, month, day := start.Date()
+	hour, minute, second := start.Clock()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, hour, minute, second, start.Nanosecond(), start.Location())
+	}
+
+	switch r.Freq {
+	case FreqDaily:
+		return at(year, month, day+r.Interval), true
+
+	case FreqWeekly:
+		if len(r.ByDay) == 0 {
+			return at(year, month, day+7*r.Interval), true
+		}
+		// 只在与起始周相隔 INTERVAL 整数倍的周内取值
+		sinceMonday := (int(start.Weekday()) + 6) % 7
+		for i := 1; i < 7*(r.Interval+1); i++ {
+			if (sinceMonday+i)/7%r.Interval != 0 {
+				continue
+			}
+			weekday := time.Weekday((int(start.Weekday()) + i) % 7)
+			for _, byDay := range r.ByDay {
+				if byDay.Weekday == weekday {
+					return at(year, month, day+i), true
+				}
+			}
+		}
+
+	case FreqMonthly:
+		for k := 0; k < maxRecurrencePeriods; k++ {
+			first := time.Date(year, month+time.Month(k*r.Interval), 1, 0, 0, 0, 0, time.UTC)
+			for _, d := range r.daysInMonth(first.Year(), first.Month(), day) {
+				if k > 0 || d > day {
+					return at(first.Year(), first.Month(), d), true
+				}
+			}
+		}
+
+	case FreqYearly:
+		months := r.ByMonth
+		if len(months) == 0 {
+			months = []time.Month{month}
+		}
+		months = append([]time.Month(nil), months...)
+		sort.Slice(months, func(i, j int) bool { return months[i] < months[j] })
+		for k := 0; k < maxRecurrencePeriods; k++ {
+			y := year + k*r.Interval
+			for _, m := range months {
+				if k == 0 && m < month {
+					continue
+				}
+				for _, d := range r.daysInMonth(y, m, day) {
+					if k > 0 || m > month || d > day {
+						return at(y, m, d), true
+					}
+				}
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// daysInMonth 返回规则在某月命中的日期（升序），没有 BYDAY/BYMONTHDAY 时取 defaultDay，该月没有这一天时跳过
+func (r *Recurrence) daysInMonth(year int, month time.Month, defaultDay int) []int {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	firstWeekday := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC).Weekday()
+
+	var days []int
+	add := func(d int) {
+		if d >= 1 && d <= last {
+			days = append(days, d)
+		}
+	}
+
+	switch {
+	case len(r.ByMonthDay) > 0:
+		for _, d := range r.ByMonthDay {
+			if d < 0 {
+				d = last + d + 1
+			}
+			add(d)
+		}
+	case len(r.ByDay) > 0:
+		for _, byDay := range r.ByDay {
+			first := 1 + (int(byDay.Weekday)-int(firstWeekday)+7)%7
+			switch {
+			case byDay.Ordinal > 0:
+				add(first + 7*(byDay.Ordinal-1))
+			case byDay.Ordinal < 0:
+				lastOccurrence := first + (last-first)/7*7
+				add(lastOccurrence + 7*(byDay.Ordinal+1))
+			default:
+				for d := first; d <= last; d += 7 {
+					add(d)
+				}
+			}
+		}
+	default:
+		add(defaultDay)
+	}
+
+	sort.Ints(days)
+	return days
+}
+
+// NormalizeTodoRecurrence 校验TODO的重复规则并改写为规范形式，空规则视为不重复；
+// 重复TODO必须设置截止时间或提醒时间作为计算基准
+func NormalizeTodoRecurrence(todo *Todo) error {
+	if todo.Recurrence == nil {
+		return nil
+	}
+	if strings.TrimSpace(*todo.Recurrence) == "" {
+		todo.Recurrence = nil
+		return nil
+	}
+	rule, err := ParseRecurrence(*todo.Recurrence)
+	if err != nil {
+		return err
+	}
+	if todo.DueDate == nil && todo.Reminder == nil {
+		return invalidRecurrence("recurring todo requires a due date or reminder")
+	}
+	normalized := rule.String()
+	todo.Recurrence = &normalized
+	return nil
+}
+
+// NextOccurrence 生成重复TODO的下一次实例，规则已结束时返回nil。
+// 以截止时间为基准（未设置时使用提醒时间）按用户时区计算，提醒时间与截止时间保持原有间隔；
+// 新实例继承标题、描述、优先级、标签和分类，COUNT 减一
+func NextOccurrence(todo *Todo, loc *time.Location) (*Todo, error) {
+	if todo.Recurrence == nil {
+		return nil, nil
+	}
+	rule, err := ParseRecurrence(*todo.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+	anchor := todo.DueDate
+	if anchor == nil {
+		anchor = todo.Reminder
+	}
+	if anchor == nil {
+		return nil, invalidRecurrence("recurring todo requires a due date or reminder")
+	}
+
+	nextTime, ok := rule.Next(*anchor, loc)
+	if !ok {
+		return nil, nil
+	}
+	if rule.Count > 0 {
+		rule.Count--
+	}
+	recurrence := rule.String()
+
+	shift := func(t *time.Time) *time.Time {
+		if t == nil {
+			return nil
+		}
+		shifted := nextTime.Add(t.Sub(*anchor))
+		return &shifted
+	}
+	next := copyTodo(todo)
+	next.ID = 0
+	next.UUID = ""
+	next.Completed = false
+	next.IsDeleted = false
+	next.DueDate = shift(todo.DueDate)
+	next.Reminder = shift(todo.Reminder)
+	next.Recurrence = &recurrence
+	return &next, nil
+}
+
+// CompleteRecurringTodo 重复TODO由未完成变为完成时创建下一次实例，并把重复规则移交给新实例，
+// 已完成的实例不再参与重复。需在保存 todo 之前于同一事务中调用；没有生成新实例时返回nil
+func CompleteRecurringTodo(r Store, previous, todo *Todo) (*Todo, error) {
+	if todo.Recurrence == nil || !todo.Completed || previous.Completed {
+		return nil, nil
+	}
+
+	settings, err := r.GetUserSettings(todo.UserID)
+	if err != nil {
+		return nil, err
+	}
+	next, err := NextOccurrence(todo, settings.Location())
+	if err != nil {
+		return nil, err
+	}
+	todo.Recurrence = nil
+	if next == nil {
+		return nil, nil
+	}
+	if err := r.CreateTodoExtended(next); err != nil {
+		return nil, err
+	}
+	// 检查项随之复制到下一次实例，全部重置为未完成
+	if err := copyChecklistItems(r, todo, next); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
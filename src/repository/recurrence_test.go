@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRecurrenceNext(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	newYork, _ := time.LoadLocation("America/New_York")
+
+	tests := []struct {
+		name  string
+		rule  string
+		loc   *time.Location
+		start time.Time
+		want  time.Time // 零值表示没有下一次
+	}{
+		{
+			name:  "daily interval",
+			rule:  "FREQ=DAILY;INTERVAL=2",
+			loc:   shanghai,
+			start: time.Date(2026, 1, 31, 9, 0, 0, 0, shanghai),
+			want:  time.Date(2026, 2, 2, 9, 0, 0, 0, shanghai),
+		},
+		{
+			name:  "weekly by weekday",
+			rule:  "RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR",
+			loc:   shanghai,
+			start: time.Date(2026, 10, 16, 9, 0, 0, 0, shanghai), // 周五
+			want:  time.Date(2026, 10, 19, 9, 0, 0, 0, shanghai),
+		},
+		{
+			name:  "biweekly skips odd weeks",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH",
+			loc:   shanghai,
+			start: time.Date(2026, 10, 15, 9, 0, 0, 0, shanghai), // 周四
+			want:  time.Date(2026, 10, 27, 9, 0, 0, 0, shanghai),
+		},
+		{
+			name:  "monthly last friday",
+			rule:  "FREQ=MONTHLY;BYDAY=-1FR",
+			loc:   shanghai,
+			start: time.Date(2026, 10, 30, 18, 0, 0, 0, shanghai),
+			want:  time.Date(2026, 11, 27, 18, 0, 0, 0, shanghai),
+		},
+		{
+			name:  "monthly second tuesday",
+			rule:  "FREQ=MONTHLY;BYDAY=2TU",
+			loc:   shanghai,
+			start: time.Date(2026, 10, 13, 9, 0, 0, 0, shanghai),
+			want:  time.Date(2026, 11, 10, 9, 0, 0, 0, shanghai),
+		},
+		{
+			name:  "monthly day 31 skips short months",
+			rule:  "FREQ=MONTHLY",
+			loc:   shanghai,
+			start: time.Date(2026, 1, 31, 9, 0, 0, 0, shanghai),
+			want:  time.Date(2026, 3, 31, 9, 0, 0, 0, shanghai),
+		},
+		{
+			name:  "monthly last day",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=-1",
+			loc:   shanghai,
+			start: time.Date(2026, 1, 31, 9, 0, 0, 0, shanghai),
+			want:  time.Date(2026, 2, 28, 9, 0, 0, 0, shanghai),
+		},
+		{
+			name:  "yearly leap day",
+			rule:  "FREQ=YEARLY",
+			loc:   shanghai,
+			start: time.Date(2028, 2, 29, 9, 0, 0, 0, shanghai),
+			want:  time.Date(2032, 2, 29, 9, 0, 0, 0, shanghai),
+		},
+		{
+			name:  "yearly thanksgiving",
+			rule:  "FREQ=YEARLY;BYMONTH=11;BYDAY=4TH",
+			loc:   newYork,
+			start: time.Date(2026, 11, 26, 12, 0, 0, 0, newYork),
+			want:  time.Date(2027, 11, 25, 12, 0, 0, 0, newYork),
+		},
+		{
+			name:  "keeps wall clock across DST",
+			rule:  "FREQ=DAILY",
+			loc:   newYork,
+			start: time.Date(2026, 3, 7, 13, 0, 0, 0, time.UTC), // 08:00 EST
+			want:  time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC), // 08:00 EDT
+		},
+		{
+			name:  "weekday follows user timezone",
+			rule:  "FREQ=WEEKLY;BYDAY=MO",
+			loc:   shanghai,
+			start: time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC), // 上海时间周一 07:00
+			want:  time.Date(2026, 10, 25, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "count exhausted",
+			rule:  "FREQ=DAILY;COUNT=1",
+			loc:   shanghai,
+			start: time.Date(2026, 10, 16, 9, 0, 0, 0, shanghai),
+		},
+		{
+			name:  "until date is inclusive",
+			rule:  "FREQ=DAILY;UNTIL=20261017",
+			loc:   shanghai,
+			start: time.Date(2026, 10, 16, 9, 0, 0, 0, shanghai),
+			want:  time.Date(2026, 10, 17, 9, 0, 0, 0, shanghai),
+		},
+		{
+			name:  "until passed",
+			rule:  "FREQ=WEEKLY;UNTIL=20261020T000000Z",
+			loc:   shanghai,
+			start: time.Date(2026, 10, 16, 9, 0, 0, 0, shanghai),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRecurrence(tt.rule)
+			if err != nil {
+				t.Fatalf("ParseRecurrence(%q) error = %v", tt.rule, err)
+			}
+			got, ok := rule.Next(tt.start, tt.loc)
+			if ok != !tt.want.IsZero() || (ok && !got.Equal(tt.want)) {
+				t.Errorf("Next() = %v, %v; want %v", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRecurrenceErrors(t *testing.T) {
+	rules := []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=MONTHLY;BYDAY=MO;BYMONTHDAY=1",
+		"FREQ=YEARLY;BYDAY=1MO",
+		"FREQ=DAILY;COUNT=3;UNTIL=20261231",
+		"FREQ=DAILY;BYSETPOS=1",
+		"FREQ=DAILY;COUNT=0",
+	}
+	for _, rule := range rules {
+		if _, err := ParseRecurrence(rule); !errors.Is(err, ErrInvalidRecurrence) {
+			t.Errorf("ParseRecurrence(%q) error = %v, want ErrInvalidRecurrence", rule, err)
+		}
+	}
+
+	rule, err := ParseRecurrence("rrule:freq=monthly;byday=-1fr;count=3")
+	if err != nil || rule.String() != "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3" {
+		t.Errorf("ParseRecurrence() = %v, %v", rule, err)
+	}
+}
+
+func TestCompleteRecurringTodo(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		settings, err := store.GetUserSettings(userID)
+		if err != nil {
+			t.Fatalf("GetUserSettings() error = %v", err)
+		}
+		loc := settings.Location()
+
+		due := time.Date(2026, 10, 16, 18, 0, 0, 0, loc)
+		reminder := due.Add(-time.Hour)
+		rule := "FREQ=WEEKLY;BYDAY=FR;COUNT=2"
+		todo := &Todo{UserID: userID, Title: "周报", Tags: StringSlice{"工作"}, DueDate: &due, Reminder: &reminder, Recurrence: &rule}
+		if err := store.CreateTodoExtended(todo); err != nil {
+			t.Fatalf("CreateTodoExtended() error = %v", err)
+		}
+
+		if err := store.CreateChecklistItem(&ChecklistItem{TodoID: todo.ID, UserID: userID, Title: "汇总数据", Completed: true}); err != nil {
+			t.Fatalf("CreateChecklistItem() error = %v", err)
+		}
+
+		complete := func(todo *Todo) *Todo {
+			t.Helper()
+			previous := copyTodo(todo)
+			todo.Completed = true
+			var next *Todo
+			err := store.WithTx(func(tx Store) error {
+				var err error
+				if next, err = CompleteRecurringTodo(tx, &previous, todo); err != nil {
+					return err
+				}
+				return tx.UpdateTodoExtended(todo)
+			})
+			if err != nil {
+				t.Fatalf("complete todo error = %v", err)
+			}
+			return next
+		}
+
+		next := complete(todo)
+		if next == nil || next.ID == 0 || next.Completed || next.Title != "周报" {
+			t.Fatalf("next occurrence = %+v", next)
+		}
+		wantDue := due.AddDate(0, 0, 7)
+		if !next.DueDate.Equal(wantDue) || !next.Reminder.Equal(wantDue.Add(-time.Hour)) {
+			t.Errorf("next due/reminder = %v/%v, want %v", next.DueDate, next.Reminder, wantDue)
+		}
+		if next.Recurrence == nil || *next.Recurrence != "FREQ=WEEKLY;BYDAY=FR;COUNT=1" {
+			t.Errorf("next recurrence = %v", next.Recurrence)
+		}
+
+		items, err := store.GetChecklistItemsByTodoID(next.ID, userID)
+		if err != nil || len(items) != 1 || items[0].Title != "汇总数据" || items[0].Completed {
+			t.Errorf("next occurrence checklist = %+v, %v; want reset copy", items, err)
+		}
+
+		stored, err := store.GetTodoByID(todo.ID, userID)
+		if err != nil || stored.Recurrence != nil || !stored.Completed {
+			t.Errorf("completed todo = %+v, %v; want recurrence moved to next occurrence", stored, err)
+		}
+
+		// COUNT 用完后不再生成
+		if last := complete(next); last != nil {
+			t.Errorf("occurrence after COUNT = %+v, want nil", last)
+		}
+	})
+}
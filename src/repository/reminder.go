@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 到期的TODO提醒按通知渠道生成投递记录，(todo_id, reminder_at, channel) 唯一，同一提醒在每个渠道只投递一次。
+// 多个服务实例通过带租约的条件更新认领投递记录：只有把记录从待发送改为发送中的实例负责发送，
+// 实例中途退出时租约到期后由其他实例重新认领。
+
+// 投递状态，提醒和每日摘要共用
+const (
+	DeliveryPending   = "pending"   // 等待发送或等待重试
+	DeliverySending   = "sending"   // 已被服务实例认领，正在发送
+	DeliverySent      = "sent"      // 发送成功
+	DeliveryFailed    = "failed"    // 重试次数用尽
+	DeliverySkipped   = "skipped"   // 用户在该渠道没有接收方
+	DeliveryCancelled = "cancelled" // 发送前TODO已完成、删除或修改了提醒时间，或用户关闭了每日摘要、摘要为空
+)
+
+// ReminderRepository 提醒投递记录数据访问层
+type ReminderRepository struct {
+	db *sqlDB
+}
+
+// GetDueReminders 获取所有用户中提醒时间在 (from, to] 区间内、尚未生成投递记录的未完成TODO，按提醒时间排序
+func (r *ReminderRepository) GetDueReminders(from, to time.Time, limit int) ([]Todo, error) {
+	query := `
+		SELECT ` + todoColumns + `
+		FROM todos
+		WHERE reminder > $1 AND reminder <= $2 AND completed = FALSE AND is_deleted = FALSE
+			AND NOT EXISTS (
+				SELECT 1 FROM reminder_deliveries d
+				WHERE d.todo_id = todos.id AND d.reminder_at = todos.reminder
+			)
+		ORDER BY reminder ASC, id ASC` + limitClause(limit)
+
+	rows, err := r.db.Query(query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, *todo)
+	}
+
+	return todos, rows.Err()
+}
+
+// reminderDeliveryColumns 查询投递记录时选择的列，与 scanReminderDelivery 的扫描顺序一致
+const reminderDeliveryColumns = `id, user_id, todo_id, reminder_at, channel, status, attempts, last_error,
+			next_attempt_at, claimed_by, claimed_until, sent_at, created_at, updated_at`
+
+// scanReminderDelivery 扫描单行投递记录
+func scanReminderDelivery(scanner interface{ Scan(dest ...any) error }) (*ReminderDelivery, error) {
+	var delivery ReminderDelivery
+	err := scanner.Scan(&delivery.ID, &delivery.UserID, &delivery.TodoID, &delivery.ReminderAt, &delivery.Channel,
+		&delivery.Status, &delivery.Attempts, &delivery.LastError, &delivery.NextAttemptAt, &delivery.ClaimedBy,
+		&delivery.ClaimedUntil, &delivery.SentAt, &delivery.CreatedAt, &delivery.UpdatedAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &delivery, nil
+}
+
+// CreateReminderDelivery 生成待发送的投递记录，同一TODO、提醒时间和渠道的记录已存在时返回 ErrDuplicate
+func (r *ReminderRepository) CreateReminderDelivery(delivery *ReminderDelivery) error {
+	query := `
+		INSERT INTO reminder_deliveries (user_id, todo_id, reminder_at, channel, status, next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (todo_id, reminder_at, channel) DO NOTHING
+		RETURNING id`
+
+	now := time.Now()
+	delivery.Status = DeliveryPending
+	if delivery.NextAttemptAt.IsZero() {
+		delivery.NextAttemptAt = now
+	}
+	err := r.db.QueryRow(query, delivery.UserID, delivery.TodoID, delivery.ReminderAt, delivery.Channel,
+		delivery.Status, delivery.NextAttemptAt, now, now).Scan(&delivery.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: reminder delivery already exists", ErrDuplicate)
+	}
+	if err != nil {
+		return translateError(err)
+	}
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+	return nil
+}
+
+// claimableDeliveries 可以认领的投递记录：到达重试时间的待发送记录，或租约已到期的发送中记录
+const claimableDeliveries = `((status = 'pending' AND next_attempt_at <= $1) OR (status = 'sending' AND claimed_until < $1))`
+
+// ClaimReminderDeliveries 以 owner 身份认领最多 limit 条可以发送的投递记录，租约到 leaseUntil 为止，每条记录的尝试次数加一。
+// 每条记录通过条件更新单独认领，已被其他实例抢先认领的记录不会返回；
+// 选中的记录全部被抢先认领时重新选择，返回空列表表示当前没有可以认领的记录
+func (r *ReminderRepository) ClaimReminderDeliveries(owner string, now, leaseUntil time.Time, limit int) ([]ReminderDelivery, error) {
+	return claimDeliveries(r.db, "reminder_deliveries", reminderDeliveryColumns, scanReminderDelivery, owner, now, leaseUntil, limit)
+}
+
+// claimDeliveries 在投递记录表 table 中认领记录，规则见 ClaimReminderDeliveries；columns 和 scan 决定返回的列
+func claimDeliveries[T any](db *sqlDB, table, columns string, scan func(interface{ Scan(dest ...any) error }) (*T, error),
+	owner string, now, leaseUntil time.Time, limit int) ([]T, error) {
+	for {
+		ids, err := claimableDeliveryIDs(db, table, now, limit)
+		if err != nil || len(ids) == 0 {
+			return nil, err
+		}
+
+		claim := `
+			UPDATE ` + table + `
+			SET status = 'sending', claimed_by = $2, claimed_until = $3, attempts = attempts + 1, updated_at = $1
+			WHERE id = $4 AND ` + claimableDeliveries + `
+			RETURNING ` + columns
+
+		var deliveries []T
+		for _, id := range ids {
+			delivery, err := scan(db.QueryRow(claim, now, owner, leaseUntil, id))
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return deliveries, err
+			}
+			deliveries = append(deliveries, *delivery)
+		}
+		if len(deliveries) > 0 {
+			return deliveries, nil
+		}
+	}
+}
+
+// claimableDeliveryIDs 选择可以认领的投递记录ID，按下次尝试时间排序
+func claimableDeliveryIDs(db *sqlDB, table string, now time.Time, limit int) ([]int, error) {
+	query := `
+		SELECT id FROM ` + table + `
+		WHERE ` + claimableDeliveries + `
+		ORDER BY next_attempt_at ASC, id ASC` + limitClause(limit)
+
+	rows, err := db.Query(query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// FinishReminderDelivery 保存认领后的发送结果（状态、失败原因、下次尝试时间和发送时间）并释放认领。
+// 记录已不再由 delivery.ClaimedBy 认领（租约到期后被其他实例重新认领）时返回 ErrNotFound
+func (r *ReminderRepository) FinishReminderDelivery(delivery *ReminderDelivery) error {
+	now, err := finishDelivery(r.db, "reminder_deliveries", delivery.ID, delivery.ClaimedBy,
+		delivery.Status, delivery.LastError, delivery.NextAttemptAt, delivery.SentAt)
+	if err != nil {
+		return err
+	}
+	delivery.ClaimedBy = ""
+	delivery.ClaimedUntil = nil
+	delivery.UpdatedAt = now
+	return nil
+}
+
+// finishDelivery 在投递记录表 table 中保存发送结果并释放认领，返回更新时间
+func finishDelivery(db *sqlDB, table string, id int, owner, status, lastError string, nextAttemptAt time.Time, sentAt *time.Time) (time.Time, error) {
+	query := `
+		UPDATE ` + table + `
+		SET status = $1, last_error = $2, next_attempt_at = $3, sent_at = $4,
+			claimed_by = '', claimed_until = NULL, updated_at = $5
+		WHERE id = $6 AND status = 'sending' AND claimed_by = $7`
+
+	now := time.Now()
+	result, err := db.Exec(query, status, lastError, nextAttemptAt, sentAt, now, id, owner)
+	if err != nil {
+		return now, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return now, fmt.Errorf("delivery not claimed by %s: %w", owner, ErrNotFound)
+	}
+	return now, nil
+}
+
+// GetReminderDeliveries 获取TODO的提醒投递记录，按创建时间从新到旧排序
+func (r *ReminderRepository) GetReminderDeliveries(userID, todoID int) ([]ReminderDelivery, error) {
+	query := `
+		SELECT ` + reminderDeliveryColumns + `
+		FROM reminder_deliveries
+		WHERE user_id = $1 AND todo_id = $2
+		ORDER BY id DESC`
+
+	rows, err := r.db.Query(query, userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []ReminderDelivery
+	for rows.Next() {
+		delivery, err := scanReminderDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+
+	return deliveries, rows.Err()
+}
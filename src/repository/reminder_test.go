@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStoreReminderDeliveries(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		now := time.Now().Truncate(time.Second)
+		due := now.Add(-time.Minute)
+		later := now.Add(time.Hour)
+
+		report := &Todo{UserID: userID, Title: "周报", Reminder: &due}
+		done := &Todo{UserID: userID, Title: "已完成", Reminder: &due, Completed: true}
+		future := &Todo{UserID: userID, Title: "明天", Reminder: &later}
+		for _, todo := range []*Todo{report, done, future} {
+			if err := store.CreateTodoExtended(todo); err != nil {
+				t.Fatalf("CreateTodoExtended() error = %v", err)
+			}
+		}
+
+		todos, err := store.GetDueReminders(now.Add(-time.Hour), now, 10)
+		if err != nil || len(todos) != 1 || todos[0].ID != report.ID {
+			t.Fatalf("GetDueReminders() = %+v, %v; want only %d", todos, err, report.ID)
+		}
+
+		for _, channel := range []string{"email", "push"} {
+			delivery := &ReminderDelivery{UserID: userID, TodoID: report.ID, ReminderAt: *todos[0].Reminder, Channel: channel, NextAttemptAt: now}
+			if err := store.CreateReminderDelivery(delivery); err != nil {
+				t.Fatalf("CreateReminderDelivery(%s) error = %v", channel, err)
+			}
+		}
+		duplicate := &ReminderDelivery{UserID: userID, TodoID: report.ID, ReminderAt: *todos[0].Reminder, Channel: "email"}
+		if err := store.CreateReminderDelivery(duplicate); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("CreateReminderDelivery(duplicate) error = %v, want ErrDuplicate", err)
+		}
+		if todos, err := store.GetDueReminders(now.Add(-time.Hour), now, 10); err != nil || len(todos) != 0 {
+			t.Errorf("GetDueReminders() after delivery = %+v, %v; want none", todos, err)
+		}
+
+		// 每条记录只能被一个实例认领
+		claimed, err := store.ClaimReminderDeliveries("instance-a", now, now.Add(time.Minute), 1)
+		if err != nil || len(claimed) != 1 || claimed[0].Status != DeliverySending || claimed[0].Attempts != 1 {
+			t.Fatalf("ClaimReminderDeliveries(a) = %+v, %v", claimed, err)
+		}
+		other, err := store.ClaimReminderDeliveries("instance-b", now, now.Add(time.Minute), 10)
+		if err != nil || len(other) != 1 || other[0].ID == claimed[0].ID {
+			t.Fatalf("ClaimReminderDeliveries(b) = %+v, %v", other, err)
+		}
+		if again, err := store.ClaimReminderDeliveries("instance-b", now, now.Add(time.Minute), 10); err != nil || len(again) != 0 {
+			t.Errorf("ClaimReminderDeliveries(all claimed) = %+v, %v", again, err)
+		}
+
+		sent := claimed[0]
+		sent.Status = DeliverySent
+		sent.SentAt = &now
+		if err := store.FinishReminderDelivery(&sent); err != nil {
+			t.Fatalf("FinishReminderDelivery() error = %v", err)
+		}
+
+		// 实例B的租约到期后由实例C重新认领，实例B不能再保存结果
+		reclaimed, err := store.ClaimReminderDeliveries("instance-c", now.Add(2*time.Minute), now.Add(3*time.Minute), 10)
+		if err != nil || len(reclaimed) != 1 || reclaimed[0].ID != other[0].ID || reclaimed[0].Attempts != 2 {
+			t.Fatalf("ClaimReminderDeliveries(expired lease) = %+v, %v", reclaimed, err)
+		}
+		stale := other[0]
+		stale.Status = DeliverySent
+		if err := store.FinishReminderDelivery(&stale); !errors.Is(err, ErrNotFound) {
+			t.Errorf("FinishReminderDelivery(lost lease) error = %v, want ErrNotFound", err)
+		}
+		retry := reclaimed[0]
+		retry.Status = DeliveryPending
+		retry.LastError = "push service unavailable"
+		retry.NextAttemptAt = now.Add(10 * time.Minute)
+		if err := store.FinishReminderDelivery(&retry); err != nil {
+			t.Fatalf("FinishReminderDelivery(retry) error = %v", err)
+		}
+		if early, err := store.ClaimReminderDeliveries("instance-c", now.Add(5*time.Minute), now.Add(6*time.Minute), 10); err != nil || len(early) != 0 {
+			t.Errorf("ClaimReminderDeliveries(before retry) = %+v, %v", early, err)
+		}
+
+		deliveries, err := store.GetReminderDeliveries(userID, report.ID)
+		if err != nil || len(deliveries) != 2 {
+			t.Fatalf("GetReminderDeliveries() = %+v, %v", deliveries, err)
+		}
+		statuses := map[string]ReminderDelivery{}
+		for _, delivery := range deliveries {
+			statuses[delivery.Channel] = delivery
+		}
+		if email := statuses[claimed[0].Channel]; email.Status != DeliverySent || email.SentAt == nil {
+			t.Errorf("sent delivery = %+v", email)
+		}
+		if push := statuses[retry.Channel]; push.Status != DeliveryPending || push.Attempts != 2 ||
+			push.LastError != "push service unavailable" || push.ClaimedBy != "" {
+			t.Errorf("retried delivery = %+v", push)
+		}
+		if deliveries, err := store.GetReminderDeliveries(userID+1, report.ID); err != nil || len(deliveries) != 0 {
+			t.Errorf("GetReminderDeliveries(other user) = %+v, %v", deliveries, err)
+		}
+
+		// 修改提醒时间后按新时间重新投递
+		moved := now.Add(-30 * time.Second)
+		report.Reminder = &moved
+		if err := store.UpdateTodoExtended(report); err != nil {
+			t.Fatalf("UpdateTodoExtended() error = %v", err)
+		}
+		if todos, err := store.GetDueReminders(now.Add(-time.Hour), now, 10); err != nil || len(todos) != 1 {
+			t.Errorf("GetDueReminders() after moving reminder = %+v, %v", todos, err)
+		}
+
+		// 物理删除TODO时一并删除投递记录
+		if err := store.DeleteTodo(report.ID, userID); err != nil {
+			t.Fatalf("DeleteTodo() error = %v", err)
+		}
+		if deliveries, err := store.GetReminderDeliveries(userID, report.ID); err != nil || len(deliveries) != 0 {
+			t.Errorf("GetReminderDeliveries() after DeleteTodo = %+v, %v", deliveries, err)
+		}
+	})
+}
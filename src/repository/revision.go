@@ -0,0 +1,373 @@
+package repository
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TODO和分类的每次创建、修改和删除都在写入的同一事务中记录一条修改历史，
+// 只保存发生变化的字段。回滚到某条记录时，从当前数据开始依次撤销之后的修改。
+
+// 修改历史的操作类型
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+)
+
+// FieldChange 单个字段修改前后的取值（JSON），创建时 Old 为 null，物理删除时 New 为 null
+type FieldChange struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// RevisionChanges 按字段名保存的修改
+type RevisionChanges map[string]FieldChange
+
+// Value 实现 driver.Valuer 接口
+func (c RevisionChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(c)
+	return string(data), err
+}
+
+// Scan 实现 sql.Scanner 接口
+func (c *RevisionChanges) Scan(value interface{}) error {
+	*c = RevisionChanges{}
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into RevisionChanges", value)
+	}
+	if err := json.Unmarshal(bytes, c); err != nil {
+		return err
+	}
+	// json.RawMessage 会把 null 解码为字面量
+	for name, change := range *c {
+		(*c)[name] = FieldChange{Old: revisionValue(change.Old), New: revisionValue(change.New)}
+	}
+	return nil
+}
+
+// todoRevisionState 参与修改历史的TODO字段；时间统一为UTC并截断到微秒，与数据库中保存的精度一致
+type todoRevisionState struct {
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Completed   bool        `json:"completed"`
+	Priority    Priority    `json:"priority"`
+	DueDate     *time.Time  `json:"due_date"`
+	Tags        StringSlice `json:"tags"`
+	CategoryID  *int        `json:"category_id"`
+	Reminder    *time.Time  `json:"reminder"`
+	Recurrence  *string     `json:"recurrence"`
+	IsDeleted   bool        `json:"is_deleted"`
+}
+
+// categoryRevisionState 参与修改历史的分类字段
+type categoryRevisionState struct {
+	Name      string `json:"name"`
+	Color     string `json:"color"`
+	Icon      string `json:"icon"`
+	IsDeleted bool   `json:"is_deleted"`
+}
+
+// revisionTime 统一时间的时区和精度，避免同一时刻因表示不同被记录为修改
+func revisionTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	normalized := t.UTC().Truncate(time.Microsecond)
+	return &normalized
+}
+
+// revisionFields 将字段结构转换为按字段名索引的JSON取值，state 为 nil 时返回 nil
+func revisionFields(state any) map[string]json.RawMessage {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// todoRevisionFields 返回TODO参与修改历史的字段，todo 为 nil 时返回 nil
+func todoRevisionFields(todo *Todo) map[string]json.RawMessage {
+	if todo == nil {
+		return nil
+	}
+	tags := todo.Tags
+	if tags == nil {
+		tags = StringSlice{}
+	}
+	return revisionFields(todoRevisionState{
+		Title:       todo.Title,
+		Description: todo.Description,
+		Completed:   todo.Completed,
+		Priority:    todo.Priority,
+		DueDate:     revisionTime(todo.DueDate),
+		Tags:        tags,
+		CategoryID:  todo.CategoryID,
+		Reminder:    revisionTime(todo.Reminder),
+		Recurrence:  todo.Recurrence,
+		IsDeleted:   todo.IsDeleted,
+	})
+}
+
+// categoryRevisionFields 返回分类参与修改历史的字段，category 为 nil 时返回 nil
+func categoryRevisionFields(category *Category) map[string]json.RawMessage {
+	if category == nil {
+		return nil
+	}
+	return revisionFields(categoryRevisionState{
+		Name:      category.Name,
+		Color:     category.Color,
+		Icon:      category.Icon,
+		IsDeleted: category.IsDeleted,
+	})
+}
+
+// revisionValue 将JSON null 统一为 nil，与从数据库读取的修改记录一致
+func revisionValue(value json.RawMessage) json.RawMessage {
+	if string(value) == "null" {
+		return nil
+	}
+	return value
+}
+
+// newRevision 比较写入前后的字段生成修改记录，没有字段变化时返回 nil。
+// previous 为 nil 表示创建，current 为 nil 表示物理删除
+func newRevision(previous, current map[string]json.RawMessage) *Revision {
+	changes := RevisionChanges{}
+	for name, value := range current {
+		if old, ok := previous[name]; !ok || string(old) != string(value) {
+			changes[name] = FieldChange{Old: revisionValue(previous[name]), New: revisionValue(value)}
+		}
+	}
+	for name, old := range previous {
+		if _, ok := current[name]; !ok {
+			changes[name] = FieldChange{Old: revisionValue(old)}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	revision := &Revision{Action: RevisionUpdate, Changes: changes}
+	switch {
+	case previous == nil:
+		revision.Action = RevisionCreate
+	case current == nil:
+		revision.Action = RevisionDelete
+	case string(previous["is_deleted"]) != string(current["is_deleted"]):
+		revision.Action = RevisionRestore
+		if string(current["is_deleted"]) == "true" {
+			revision.Action = RevisionDelete
+		}
+	}
+	return revision
+}
+
+// newTodoRevision 比较写入前后的TODO生成修改记录，没有字段变化时返回 nil
+func newTodoRevision(previous, current *Todo) *Revision {
+	revision := newRevision(todoRevisionFields(previous), todoRevisionFields(current))
+	if revision == nil {
+		return nil
+	}
+	entity := current
+	if entity == nil {
+		entity = previous
+	}
+	revision.UserID = entity.UserID
+	revision.EntityType = SyncTypeTodo
+	revision.EntityID = entity.ID
+	revision.EntityUUID = entity.UUID
+	if current != nil {
+		revision.SyncVersion = current.SyncVersion
+	}
+	return revision
+}
+
+// newCategoryRevision 比较写入前后的分类生成修改记录，没有字段变化时返回 nil
+func newCategoryRevision(previous, current *Category) *Revision {
+	revision := newRevision(categoryRevisionFields(previous), categoryRevisionFields(current))
+	if revision == nil {
+		return nil
+	}
+	entity := current
+	if entity == nil {
+		entity = previous
+	}
+	revision.UserID = entity.UserID
+	revision.EntityType = SyncTypeCategory
+	revision.EntityID = entity.ID
+	revision.EntityUUID = entity.UUID
+	if current != nil {
+		revision.SyncVersion = current.SyncVersion
+	}
+	return revision
+}
+
+// RevisionRepository 修改历史数据访问层
+type RevisionRepository struct {
+	db *sqlDB
+}
+
+// revisionColumns 查询修改历史时选择的列，与 scanRevision 的扫描顺序一致
+const revisionColumns = `id, user_id, entity_type, entity_id, entity_uuid, action, changes, device_id, sync_version, created_at`
+
+// scanRevision 扫描单行修改历史
+func scanRevision(scanner interface{ Scan(dest ...any) error }) (*Revision, error) {
+	var revision Revision
+	err := scanner.Scan(&revision.ID, &revision.UserID, &revision.EntityType, &revision.EntityID,
+		&revision.EntityUUID, &revision.Action, &revision.Changes, &revision.DeviceID,
+		&revision.SyncVersion, &revision.CreatedAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &revision, nil
+}
+
+// saveRevision 在写入数据的同一事务中保存修改记录，revision 为 nil 时不做任何操作
+func saveRevision(tx *sqlDB, revision *Revision) error {
+	if revision == nil {
+		return nil
+	}
+	revision.DeviceID = tx.deviceID
+	revision.CreatedAt = time.Now()
+	return tx.QueryRow(`
+		INSERT INTO todo_revisions (user_id, entity_type, entity_id, entity_uuid, action, changes, device_id, sync_version, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id`,
+		revision.UserID, revision.EntityType, revision.EntityID, revision.EntityUUID, revision.Action,
+		revision.Changes, revision.DeviceID, revision.SyncVersion, revision.CreatedAt).Scan(&revision.ID)
+}
+
+// GetRevisions 获取数据的修改历史，按时间从新到旧排序
+func (r *RevisionRepository) GetRevisions(userID int, entityType string, entityID int) ([]Revision, error) {
+	query := `
+		SELECT ` + revisionColumns + `
+		FROM todo_revisions
+		WHERE user_id = $1 AND entity_type = $2 AND entity_id = $3
+		ORDER BY id DESC`
+
+	rows, err := r.db.Query(query, userID, entityType, entityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []Revision
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, *revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+// GetRevisionByID 根据ID获取单条修改记录
+func (r *RevisionRepository) GetRevisionByID(revisionID, userID int) (*Revision, error) {
+	query := `
+		SELECT ` + revisionColumns + `
+		FROM todo_revisions
+		WHERE id = $1 AND user_id = $2`
+
+	return scanRevision(r.db.QueryRow(query, revisionID, userID))
+}
+
+// ===== 回滚 =====
+
+// RevertTodo 将TODO恢复到指定修改记录之后的状态：从当前数据开始，按从新到旧的顺序撤销之后的全部修改，
+// 结果作为一次新的修改保存并分配新的同步版本号。已删除的TODO同样可以恢复；
+// 恢复后引用的分类已被删除时，TODO不再属于任何分类。修改记录不属于该TODO或TODO已被物理删除时返回 ErrNotFound
+func RevertTodo(r Store, userID, todoID, revisionID int) (*Todo, error) {
+	var reverted *Todo
+	err := r.WithTx(func(tx Store) error {
+		target, err := tx.GetRevisionByID(revisionID, userID)
+		if err != nil {
+			return err
+		}
+		if target.EntityType != SyncTypeTodo || target.EntityID != todoID {
+			return fmt.Errorf("revision %d of todo %d: %w", revisionID, todoID, ErrNotFound)
+		}
+		todo, err := tx.GetTodoByUUID(userID, target.EntityUUID)
+		if err != nil {
+			return err
+		}
+
+		revisions, err := tx.GetRevisions(userID, SyncTypeTodo, todo.ID)
+		if err != nil {
+			return err
+		}
+		fields := todoRevisionFields(todo)
+		for _, revision := range revisions {
+			if revision.ID <= target.ID {
+				break
+			}
+			for name, change := range revision.Changes {
+				fields[name] = change.Old
+			}
+		}
+
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		var state todoRevisionState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return fmt.Errorf("failed to restore todo revision: %v", err)
+		}
+		todo.CategoryUUID = nil
+		if state.CategoryID != nil {
+			category, err := tx.GetCategoryByID(*state.CategoryID, userID)
+			switch {
+			case errors.Is(err, ErrNotFound):
+				state.CategoryID = nil
+			case err != nil:
+				return err
+			case category.IsDeleted:
+				state.CategoryID = nil
+			default:
+				todo.CategoryUUID = &category.UUID
+			}
+		}
+
+		todo.Title = state.Title
+		todo.Description = state.Description
+		todo.Completed = state.Completed
+		todo.Priority = state.Priority
+		todo.DueDate = state.DueDate
+		todo.Tags = state.Tags
+		if todo.Tags == nil {
+			todo.Tags = StringSlice{}
+		}
+		todo.CategoryID = state.CategoryID
+		todo.Reminder = state.Reminder
+		todo.Recurrence = state.Recurrence
+		todo.IsDeleted = state.IsDeleted
+		if err := tx.UpdateTodoExtended(todo); err != nil {
+			return err
+		}
+		reverted = todo
+		return nil
+	})
+	return reverted, err
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestStoreRevisions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		phone := store.WithDevice("device-phone")
+		history := func(entityType string, id int) []Revision {
+			revisions, err := store.GetRevisions(userID, entityType, id)
+			if err != nil {
+				t.Fatalf("GetRevisions() error = %v", err)
+			}
+			return revisions
+		}
+
+		category := &Category{UserID: userID, Name: "工作", Color: "#2196F3"}
+		if err := store.CreateCategory(category); err != nil {
+			t.Fatalf("CreateCategory() error = %v", err)
+		}
+		todo := &Todo{UserID: userID, Title: "周报", Priority: PriorityLow, Tags: StringSlice{"工作"}}
+		if err := phone.CreateTodoExtended(todo); err != nil {
+			t.Fatalf("CreateTodoExtended() error = %v", err)
+		}
+
+		todo.Title = "周报（终稿）"
+		todo.Priority = PriorityHigh
+		todo.CategoryID = &category.ID
+		if err := store.UpdateTodoExtended(todo); err != nil {
+			t.Fatalf("UpdateTodoExtended() error = %v", err)
+		}
+		// 没有字段变化的写入不记录历史
+		if err := store.UpdateTodoExtended(todo); err != nil {
+			t.Fatalf("UpdateTodoExtended() error = %v", err)
+		}
+		todo.IsDeleted = true
+		if err := phone.UpdateTodoExtended(todo); err != nil {
+			t.Fatalf("UpdateTodoExtended(delete) error = %v", err)
+		}
+
+		revisions := history(SyncTypeTodo, todo.ID)
+		if len(revisions) != 3 {
+			t.Fatalf("GetRevisions() = %+v, want 3 revisions", revisions)
+		}
+		deleted, updated, created := revisions[0], revisions[1], revisions[2]
+		if created.Action != RevisionCreate || created.DeviceID != "device-phone" || created.EntityUUID != todo.UUID ||
+			string(created.Changes["title"].New) != `"周报"` || created.Changes["title"].Old != nil {
+			t.Errorf("create revision = %+v", created)
+		}
+		if updated.Action != RevisionUpdate || updated.DeviceID != "" || len(updated.Changes) != 3 ||
+			string(updated.Changes["priority"].Old) != "0" || string(updated.Changes["priority"].New) != "2" {
+			t.Errorf("update revision = %+v", updated)
+		}
+		if deleted.Action != RevisionDelete || deleted.SyncVersion != todo.SyncVersion || len(deleted.Changes) != 1 {
+			t.Errorf("delete revision = %+v", deleted)
+		}
+		if _, ok := updated.Changes["tags"]; ok {
+			t.Errorf("update revision recorded unchanged tags: %+v", updated.Changes)
+		}
+
+		// 回滚到创建时的状态，同时恢复已删除的TODO
+		previousVersion := todo.SyncVersion
+		reverted, err := RevertTodo(store, userID, todo.ID, created.ID)
+		if err != nil {
+			t.Fatalf("RevertTodo() error = %v", err)
+		}
+		if reverted.Title != "周报" || reverted.Priority != PriorityLow || reverted.CategoryID != nil ||
+			reverted.IsDeleted || reverted.SyncVersion <= previousVersion {
+			t.Errorf("RevertTodo() = %+v", reverted)
+		}
+		stored, err := store.GetTodoByID(todo.ID, userID)
+		if err != nil || stored.Title != "周报" || stored.IsDeleted {
+			t.Errorf("GetTodoByID() after revert = %+v, %v", stored, err)
+		}
+		revisions = history(SyncTypeTodo, todo.ID)
+		if len(revisions) != 4 || revisions[0].Action != RevisionRestore || len(revisions[0].Changes) != 4 {
+			t.Errorf("GetRevisions() after revert = %+v", revisions)
+		}
+
+		// 回滚到修改后的状态，引用的分类已被删除时不再属于任何分类
+		if err := store.DeleteCategory(category.ID, userID); err != nil {
+			t.Fatalf("DeleteCategory() error = %v", err)
+		}
+		reverted, err = RevertTodo(store, userID, todo.ID, updated.ID)
+		if err != nil {
+			t.Fatalf("RevertTodo(updated) error = %v", err)
+		}
+		if reverted.Title != "周报（终稿）" || reverted.Priority != PriorityHigh || reverted.CategoryID != nil {
+			t.Errorf("RevertTodo(updated) = %+v", reverted)
+		}
+
+		other := &Todo{UserID: userID, Title: "买菜"}
+		if err := store.CreateTodoExtended(other); err != nil {
+			t.Fatalf("CreateTodoExtended() error = %v", err)
+		}
+		if _, err := RevertTodo(store, userID, other.ID, created.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("RevertTodo(foreign revision) error = %v, want ErrNotFound", err)
+		}
+		if _, err := RevertTodo(store, userID+1, todo.ID, created.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("RevertTodo(other user) error = %v, want ErrNotFound", err)
+		}
+
+		// 物理删除后保留历史，但不能再回滚
+		if err := store.DeleteTodo(other.ID, userID); err != nil {
+			t.Fatalf("DeleteTodo() error = %v", err)
+		}
+		revisions = history(SyncTypeTodo, other.ID)
+		if len(revisions) != 2 || revisions[0].Action != RevisionDelete ||
+			string(revisions[0].Changes["title"].Old) != `"买菜"` || revisions[0].Changes["title"].New != nil {
+			t.Errorf("GetRevisions() after DeleteTodo = %+v", revisions)
+		}
+		if _, err := RevertTodo(store, userID, other.ID, revisions[1].ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("RevertTodo(hard deleted) error = %v, want ErrNotFound", err)
+		}
+
+		revisions = history(SyncTypeCategory, category.ID)
+		if len(revisions) != 2 || revisions[0].Action != RevisionDelete || revisions[1].Action != RevisionCreate ||
+			string(revisions[1].Changes["name"].New) != `"工作"` {
+			t.Errorf("GetRevisions(category) = %+v", revisions)
+		}
+	})
+}
+
+func TestStoreRevisionsConcurrent(t *testing.T) {
+	for name, factory := range concurrentStoreFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			store := factory()
+			defer store.Close()
+
+			user := &User{Username: "tester", Email: "tester@example.com", Password: "hashed"}
+			if err := store.CreateUser(user); err != nil {
+				t.Fatalf("CreateUser() error = %v", err)
+			}
+			todo := &Todo{UserID: user.ID, Title: "周报", Tags: StringSlice{}}
+			if err := store.CreateTodoExtended(todo); err != nil {
+				t.Fatalf("CreateTodoExtended() error = %v", err)
+			}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				update := copyTodo(todo)
+				update.Title = fmt.Sprintf("周报 %d", i)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := store.UpdateTodoExtended(&update); err != nil {
+						t.Errorf("UpdateTodoExtended() error = %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			// 每条修改历史的旧值都必须是上一条修改历史的新值
+			revisions, err := store.GetRevisions(user.ID, SyncTypeTodo, todo.ID)
+			if err != nil {
+				t.Fatalf("GetRevisions() error = %v", err)
+			}
+			if len(revisions) != 11 {
+				t.Fatalf("GetRevisions() = %d revisions, want 11", len(revisions))
+			}
+			for i := 0; i+1 < len(revisions); i++ {
+				if old, previous := revisions[i].Changes["title"].Old, revisions[i+1].Changes["title"].New; string(old) != string(previous) {
+					t.Errorf("revision %d title old = %s, previous revision new = %s", revisions[i].ID, old, previous)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+package repository
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 全文搜索：TODO的标题、描述和标签在写入时分词并建立索引（PostgreSQL 为 tsvector 列，SQLite 为 FTS5 表），
+// 查询使用相同的分词规则，内存存储直接在分词结果上匹配。
+// 中日韩文本没有空格分隔，按字符二元组（bigram）切分：连续文本中的每个字与下一个字组成一个词元，
+// 最后一个字单独作为词元。这样每个字恰好对应一个位置，任意中文子串都可以表示为相邻二元组组成的短语。
+
+// 各字段的相关度权重，与PostgreSQL ts_rank 对权重 A/B/C 的默认取值一致
+const (
+	searchWeightTitle       = 1.0
+	searchWeightDescription = 0.4
+	searchWeightTags        = 0.2
+)
+
+// searchUnit 分词得到的词元
+type searchUnit struct {
+	token      string
+	start, end int  // 词元在原文中覆盖的字节范围，二元组覆盖两个字
+	cjk        bool // 中日韩文字
+	runEnd     bool // 连续中日韩文本的最后一个字
+}
+
+// isCJK 判断是否为需要按二元组切分的中日韩文字
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// searchTokens 对文本分词：连续的字母数字组成一个小写词元，中日韩文本按二元组切分，其余字符作为分隔符
+func searchTokens(text string) []searchUnit {
+	var units []searchUnit
+	wordStart := -1
+	var run []int // 当前连续中日韩文本中各字的起始字节偏移
+
+	flushWord := func(end int) {
+		if wordStart >= 0 {
+			units = append(units, searchUnit{token: strings.ToLower(text[wordStart:end]), start: wordStart, end: end})
+			wordStart = -1
+		}
+	}
+	flushRun := func(end int) {
+		charEnd := func(i int) int {
+			if i+1 < len(run) {
+				return run[i+1]
+			}
+			return end
+		}
+		for i, start := range run {
+			unit := searchUnit{start: start, cjk: true}
+			if i+1 < len(run) {
+				unit.end = charEnd(i + 1)
+			} else {
+				unit.end = end
+				unit.runEnd = true
+			}
+			unit.token = strings.ToLower(text[unit.start:unit.end])
+			units = append(units, unit)
+		}
+		run = run[:0]
+	}
+
+	for i, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord(i)
+			run = append(run, i)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushRun(i)
+			if wordStart < 0 {
+				wordStart = i
+			}
+		default:
+			flushWord(i)
+			flushRun(i)
+		}
+	}
+	flushWord(len(text))
+	flushRun(len(text))
+	return units
+}
+
+// joinTokens 将词元以空格连接，作为数据库全文索引的输入
+func joinTokens(units []searchUnit) string {
+	tokens := make([]string, len(units))
+	for i, unit := range units {
+		tokens[i] = unit.token
+	}
+	return strings.Join(tokens, " ")
+}
+
+// searchField TODO中参与搜索的字段
+type searchField struct {
+	text   string
+	units  []searchUnit
+	weight float64
+}
+
+// todoSearchFields 返回TODO的标题、描述和标签字段，标签以空格连接后统一分词
+func todoSearchFields(todo *Todo) [3]searchField {
+	tags := strings.Join(todo.Tags, " ")
+	return [3]searchField{
+		{text: todo.Title, units: searchTokens(todo.Title), weight: searchWeightTitle},
+		{text: todo.Description, units: searchTokens(todo.Description), weight: searchWeightDescription},
+		{text: tags, units: searchTokens(tags), weight: searchWeightTags},
+	}
+}
+
+// indexTodoSearch 更新TODO的全文索引，需在写入TODO的同一事务中调用
+func indexTodoSearch(tx *sqlDB, todo *Todo) error {
+	fields := todoSearchFields(todo)
+	_, err := tx.Exec(tx.dialect.searchIndex, todo.ID,
+		joinTokens(fields[0].units), joinTokens(fields[1].units), joinTokens(fields[2].units))
+	return err
+}
+
+// backfillSearchIndex 为升级前创建、尚未建立全文索引的TODO建立索引，missing 为筛选这些TODO的条件
+func backfillSearchIndex(db *sqlDB, missing string) error {
+	rows, err := db.Query("SELECT id, title, COALESCE(description, ''), tags FROM todos WHERE " + missing)
+	if err != nil {
+		return err
+	}
+	var todos []Todo
+	for rows.Next() {
+		var todo Todo
+		if err := rows.Scan(&todo.ID, &todo.Title, &todo.Description, &todo.Tags); err != nil {
+			rows.Close()
+			return err
+		}
+		todos = append(todos, todo)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range todos {
+		if err := indexTodoSearch(db, &todos[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchQuery 解析后的搜索查询，由 ParseSearchQuery 生成，所有子句和字段条件需同时满足
+type SearchQuery struct {
+	clauses  []searchClause // 需要匹配的搜索词
+	excluded []searchClause // 以 - 排除的搜索词，匹配任一即排除
+	filters  []searchFilter // 字段条件
+}
+
+// searchClause 一个搜索词或短语：词元需在同一字段中依次相邻出现，prefix 表示最后一个词元按前缀匹配
+type searchClause struct {
+	tokens []string
+	prefix bool
+}
+
+// newSearchClause 将一段文本转换为子句，文本中没有可搜索的词元时返回 false
+func newSearchClause(text string, prefix bool) (searchClause, bool) {
+	units := searchTokens(text)
+	if len(units) == 0 {
+		return searchClause{}, false
+	}
+	if last := units[len(units)-1]; last.cjk {
+		if len(units) > 1 && units[len(units)-2].cjk && !units[len(units)-2].runEnd {
+			// 末尾的单字已被前一个二元组覆盖，文档中该字之后可能还有其他字，不能要求单字词元
+			units = units[:len(units)-1]
+		} else {
+			// 单个汉字：匹配以该字开头的二元组，或位于连续文本末尾的该字
+			prefix = true
+		}
+	}
+
+	clause := searchClause{tokens: make([]string, len(units)), prefix: prefix}
+	for i, unit := range units {
+		clause.tokens[i] = unit.token
+	}
+	return clause, true
+}
+
+// IsEmpty 查询中没有任何搜索词和字段条件时返回 true，空查询不匹配任何TODO
+func (q *SearchQuery) IsEmpty() bool {
+	return len(q.clauses) == 0 && len(q.excluded) == 0 && len(q.filters) == 0
+}
+
+// HasTerms 查询中包含需要匹配的搜索词时返回 true，此时相关度排序才有意义；q 可以为 nil
+func (q *SearchQuery) HasTerms() bool {
+	return q != nil && len(q.clauses) > 0
+}
+
+// tsquery 将子句转换为PostgreSQL to_tsquery 语法，or 为 true 时子句之间为"或"关系
+func tsquery(clauses []searchClause, or bool) string {
+	parts := make([]string, len(clauses))
+	for i, clause := range clauses {
+		tokens := make([]string, len(clause.tokens))
+		for j, token := range clause.tokens {
+			tokens[j] = "'" + token + "'"
+		}
+		if clause.prefix {
+			tokens[len(tokens)-1] += ":*"
+		}
+		parts[i] = "(" + strings.Join(tokens, " <-> ") + ")"
+	}
+	if or {
+		return strings.Join(parts, " | ")
+	}
+	return strings.Join(parts, " & ")
+}
+
+// fts5 将子句转换为SQLite FTS5 MATCH 语法，or 为 true 时子句之间为"或"关系
+func fts5(clauses []searchClause, or bool) string {
+	parts := make([]string, len(clauses))
+	for i, clause := range clauses {
+		parts[i] = `"` + strings.Join(clause.tokens, " ") + `"`
+		if clause.prefix {
+			parts[i] += " *"
+		}
+	}
+	if or {
+		return strings.Join(parts, " OR ")
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// find 返回子句在词元序列中每次出现覆盖的字节范围
+func (c *searchClause) find(units []searchUnit) [][2]int {
+	var spans [][2]int
+	for i := 0; i+len(c.tokens) <= len(units); i++ {
+		matched := true
+		for j, token := range c.tokens {
+			unit := units[i+j].token
+			if unit != token && !(c.prefix && j == len(c.tokens)-1 && strings.HasPrefix(unit, token)) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			last := units[i+len(c.tokens)-1]
+			end := last.end
+			if c.prefix && last.cjk {
+				// 单个汉字按前缀匹配到二元组时只高亮该字
+				end = last.start + len(c.tokens[len(c.tokens)-1])
+			}
+			spans = append(spans, [2]int{units[i].start, end})
+		}
+	}
+	return spans
+}
+
+// Rank 计算TODO与查询中搜索词的相关度，每个搜索词至少在一个字段中出现才算匹配，不匹配或没有搜索词时返回0
+func (q *SearchQuery) Rank(todo *Todo) float64 {
+	if len(q.clauses) == 0 {
+		return 0
+	}
+	fields := todoSearchFields(todo)
+	var rank float64
+	for i := range q.clauses {
+		var clauseRank float64
+		for _, field := range fields {
+			clauseRank += field.weight * float64(len(q.clauses[i].find(field.units)))
+		}
+		if clauseRank == 0 {
+			return 0
+		}
+		rank += clauseRank
+	}
+	return rank
+}
+
+// match 判断TODO是否满足查询，供内存存储使用；categories 用于按名称匹配分类
+func (q *SearchQuery) match(todo *Todo, categories map[int]*Category) bool {
+	if q.IsEmpty() || (len(q.clauses) > 0 && q.Rank(todo) == 0) {
+		return false
+	}
+	fields := todoSearchFields(todo)
+	for i := range q.excluded {
+		for _, field := range fields {
+			if len(q.excluded[i].find(field.units)) > 0 {
+				return false
+			}
+		}
+	}
+	for i := range q.filters {
+		if q.filters[i].filter.Match(todo, categories) == q.filters[i].negate {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchHighlight 搜索结果的高亮片段，匹配部分以 <mark></mark> 包裹，其余文本已做HTML转义
+type SearchHighlight struct {
+	Title       string   `json:"title,omitempty" example:"学习<mark>Go</mark>语言" swaggertype:"string" description:"高亮后的标题，标题不匹配时为空"`
+	Description string   `json:"description,omitempty" example:"…阅读<mark>Go</mark>官方文档…" swaggertype:"string" description:"描述中匹配位置附近的高亮片段，描述不匹配时为空"`
+	Tags        []string `json:"tags,omitempty" example:"[\"编程\"]" swaggertype:"array,string" description:"匹配的标签"`
+}
+
+// Highlight 返回TODO中与查询匹配部分的高亮片段，没有任何匹配时返回 nil
+func (q *SearchQuery) Highlight(todo *Todo) *SearchHighlight {
+	spansOf := func(text string) [][2]int {
+		units := searchTokens(text)
+		var spans [][2]int
+		for i := range q.clauses {
+			spans = append(spans, q.clauses[i].find(units)...)
+		}
+		return mergeSpans(spans)
+	}
+
+	var highlight SearchHighlight
+	if spans := spansOf(todo.Title); len(spans) > 0 {
+		highlight.Title = markSpans(todo.Title, spans)
+	}
+	if spans := spansOf(todo.Description); len(spans) > 0 {
+		highlight.Description = snippet(todo.Description, spans)
+	}
+	for _, tag := range todo.Tags {
+		if len(spansOf(tag)) > 0 {
+			highlight.Tags = append(highlight.Tags, tag)
+		}
+	}
+	if highlight.Title == "" && highlight.Description == "" && len(highlight.Tags) == 0 {
+		return nil
+	}
+	return &highlight
+}
+
+// mergeSpans 排序并合并重叠或相邻的范围
+func mergeSpans(spans [][2]int) [][2]int {
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	var merged [][2]int
+	for _, span := range spans {
+		if n := len(merged); n > 0 && span[0] <= merged[n-1][1] {
+			merged[n-1][1] = max(merged[n-1][1], span[1])
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+// markSpans 转义文本并用 <mark> 包裹匹配范围，spans 需已排序且互不重叠
+func markSpans(text string, spans [][2]int) string {
+	var b strings.Builder
+	last := 0
+	for _, span := range spans {
+		b.WriteString(html.EscapeString(text[last:span[0]]))
+		fmt.Fprintf(&b, "<mark>%s</mark>", html.EscapeString(text[span[0]:span[1]]))
+		last = span[1]
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
+
+// 描述高亮片段的长度（字数）以及第一个匹配之前保留的字数
+const (
+	snippetWidth  = 80
+	snippetBefore = 20
+)
+
+// snippet 截取第一个匹配附近的文本作为高亮片段，被截断的一侧以省略号表示
+func snippet(text string, spans [][2]int) string {
+	if utf8.RuneCountInString(text) <= snippetWidth {
+		return markSpans(text, spans)
+	}
+
+	start := spans[0][0]
+	for i := 0; i < snippetBefore && start > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	end := start
+	for i := 0; i < snippetWidth && end < len(text); i++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+
+	var clipped [][2]int
+	for _, span := range spans {
+		if span[1] <= start || span[0] >= end {
+			continue
+		}
+		clipped = append(clipped, [2]int{max(span[0], start) - start, min(span[1], end) - start})
+	}
+	result := markSpans(text[start:end], clipped)
+	if start > 0 {
+		result = "…" + result
+	}
+	if end < len(text) {
+		result += "…"
+	}
+	return result
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSearchTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"学习Go语言", "学习 习 go 语言 言"},
+		{"Hello, World-2026!", "hello world 2026"},
+		{"买菜 做饭", "买菜 菜 做饭 饭"},
+		{`["工作","重要"]`, "工作 作 重要 要"},
+		{"カタカナ abc", "カタ タカ カナ ナ abc"},
+	}
+	for _, tt := range tests {
+		if got := joinTokens(searchTokens(tt.text)); got != tt.want {
+			t.Errorf("searchTokens(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSearchRankAndHighlight(t *testing.T) {
+	todo := &Todo{
+		Title:       "学习Go语言",
+		Description: "阅读 <Effective Go> 并完成练习",
+		Tags:        StringSlice{"编程", "学习"},
+	}
+
+	// 学习：标题 + 标签；go：标题 + 描述
+	if rank := mustParseSearch(t, "学习 go").Rank(todo); math.Abs(rank-2.6) > 1e-9 {
+		t.Errorf("Rank() = %v", rank)
+	}
+	for _, query := range []string{"学习 python", "语言学", `"go 学习"`} {
+		if rank := mustParseSearch(t, query).Rank(todo); rank != 0 {
+			t.Errorf("Rank(%q) = %v, want 0", query, rank)
+		}
+	}
+
+	highlight := mustParseSearch(t, "go 编").Highlight(todo)
+	if highlight == nil {
+		t.Fatal("Highlight() = nil")
+	}
+	if highlight.Title != "学习<mark>Go</mark>语言" {
+		t.Errorf("highlight title = %q", highlight.Title)
+	}
+	if highlight.Description != "阅读 &lt;Effective <mark>Go</mark>&gt; 并完成练习" {
+		t.Errorf("highlight description = %q", highlight.Description)
+	}
+	if len(highlight.Tags) != 1 || highlight.Tags[0] != "编程" {
+		t.Errorf("highlight tags = %v", highlight.Tags)
+	}
+
+	long := &Todo{Title: "周报", Description: "第一部分。" +
+		"这是一段很长的描述，用来验证高亮片段只截取匹配位置附近的文本，而不是返回整段描述。" +
+		"中间还有很多与搜索无关的内容，直到这里才出现关键词周报，后面还有更多更多的文字用来填充长度，确保会被截断。"}
+	highlight = mustParseSearch(t, "周报").Highlight(long)
+	if highlight == nil || highlight.Description == "" || highlight.Description[:3] != "…" {
+		t.Errorf("long description highlight = %+v", highlight)
+	}
+}
+
+func TestStoreSearchTodos(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		todos := []*Todo{
+			{Title: "整理周报", Description: "汇总本周进展"},
+			{Title: "买菜", Description: "周末准备周报需要的数据", Tags: StringSlice{"生活"}},
+			{Title: "Weekly report", Description: "prepare slides", Completed: true},
+			{Title: "读书", Tags: StringSlice{"学习"}},
+		}
+		for _, todo := range todos {
+			todo.UserID = userID
+			if err := store.CreateTodoExtended(todo); err != nil {
+				t.Fatalf("CreateTodoExtended() error = %v", err)
+			}
+		}
+
+		search := func(keyword string, filter TodoFilter) []Todo {
+			t.Helper()
+			filter.Search = mustParseSearch(t, keyword)
+			results, err := store.ListTodos(userID, TodoQuery{
+				Filter: filter,
+				Sort:   []TodoSort{{Field: SortRelevance, Desc: true}, {Field: SortCreatedAt, Desc: true}},
+				Limit:  10,
+			})
+			if err != nil {
+				t.Fatalf("ListTodos(%q) error = %v", keyword, err)
+			}
+			return results
+		}
+
+		// 标题匹配排在描述匹配之前
+		results := search("周报", TodoFilter{})
+		if len(results) != 2 || results[0].ID != todos[0].ID || results[1].ID != todos[1].ID {
+			t.Fatalf("search 周报 = %+v", results)
+		}
+		if results[0].SearchRank <= results[1].SearchRank {
+			t.Errorf("rank %v should be greater than %v", results[0].SearchRank, results[1].SearchRank)
+		}
+
+		incomplete := false
+		tests := []struct {
+			keyword string
+			filter  TodoFilter
+			want    int
+		}{
+			{"周", TodoFilter{}, 2},
+			{"本周进展", TodoFilter{}, 1},
+			{"周进展本", TodoFilter{}, 0},
+			{`"weekly report"`, TodoFilter{}, 1},
+			{"rep*", TodoFilter{}, 1},
+			{"rep", TodoFilter{}, 0},
+			{"学习", TodoFilter{}, 1},
+			{"weekly", TodoFilter{Completed: &incomplete}, 0},
+			{"!!!", TodoFilter{}, 0},
+		}
+		for _, tt := range tests {
+			if got := search(tt.keyword, tt.filter); len(got) != tt.want {
+				t.Errorf("search %q = %d results, want %d", tt.keyword, len(got), tt.want)
+			}
+		}
+
+		// 修改后索引随之更新
+		todos[3].Title = "读书笔记周报"
+		if err := store.UpdateTodoExtended(todos[3]); err != nil {
+			t.Fatalf("UpdateTodoExtended() error = %v", err)
+		}
+		if results := search("周报", TodoFilter{}); len(results) != 3 {
+			t.Errorf("search after update = %d results, want 3", len(results))
+		}
+
+		// 按相关度排序时键集分页与一次性查询一致
+		first := search("周报", TodoFilter{})
+		key := KeyOf(&first[0])
+		rest, err := store.ListTodos(userID, TodoQuery{
+			Filter: TodoFilter{Search: mustParseSearch(t, "周报")},
+			Sort:   []TodoSort{{Field: SortRelevance, Desc: true}, {Field: SortCreatedAt, Desc: true}},
+			After:  &key,
+			Limit:  10,
+		})
+		if err != nil || len(rest) != 2 || rest[0].ID != first[1].ID {
+			t.Errorf("search after first = %+v, %v", rest, err)
+		}
+
+		count, err := store.CountTodos(userID, TodoFilter{Search: mustParseSearch(t, "周")})
+		if err != nil || count != 3 {
+			t.Errorf("CountTodos(keyword) = %d, %v; want 3", count, err)
+		}
+	})
+}
@@ -0,0 +1,358 @@
+package repository
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidSmartList 智能列表的筛选或排序定义无效
+var ErrInvalidSmartList = errors.New("invalid smart list definition")
+
+// SmartListMaxSorts 智能列表最多保存的排序键数量，与列表接口一致
+const SmartListMaxSorts = 5
+
+// SmartListDefinition 智能列表保存的筛选和排序条件，执行时按用户时区转换为 TodoQuery。
+// 分类以UUID引用，便于在多台设备间同步
+type SmartListDefinition struct {
+	Query         string              `json:"query,omitempty" example:"tag:work -is:done" swaggertype:"string" description:"搜索查询，语法同 /todos/search 的 keyword"`
+	Completed     *bool               `json:"completed,omitempty" example:"false" swaggertype:"boolean" description:"完成状态"`
+	Priorities    []Priority          `json:"priorities,omitempty" example:"[2,3]" swaggertype:"array,integer" description:"优先级，匹配任一"`
+	CategoryUUIDs []string            `json:"category_uuids,omitempty" swaggertype:"array,string" description:"分类UUID，匹配任一"`
+	Uncategorized bool                `json:"uncategorized,omitempty" example:"false" swaggertype:"boolean" description:"包含未分类的TODO，与category_uuids为或关系"`
+	Tags          []string            `json:"tags,omitempty" example:"[\"工作\"]" swaggertype:"array,string" description:"标签"`
+	TagMatch      string              `json:"tag_match,omitempty" example:"any" swaggertype:"string" description:"标签匹配方式：any/all，默认any"`
+	Due           *SmartListDateRange `json:"due,omitempty" description:"截止日期范围，相对于执行当天"`
+	Overdue       bool                `json:"overdue,omitempty" example:"false" swaggertype:"boolean" description:"只包含逾期未完成的TODO"`
+	HasReminder   *bool               `json:"has_reminder,omitempty" example:"true" swaggertype:"boolean" description:"是否设置了提醒"`
+	Sort          []SmartListSort     `json:"sort,omitempty" description:"排序键，为空时按创建时间倒序"`
+}
+
+// SmartListDateRange 相对于执行当天（用户时区）的日期范围，以天为单位，0 表示今天，两端均包含
+type SmartListDateRange struct {
+	FromDays *int `json:"from_days,omitempty" example:"0" swaggertype:"integer" description:"起始日相对今天的天数，为空表示不限"`
+	ToDays   *int `json:"to_days,omitempty" example:"7" swaggertype:"integer" description:"结束日相对今天的天数，为空表示不限"`
+}
+
+// SmartListSort 智能列表的排序键
+type SmartListSort struct {
+	Field string `json:"field" example:"due_date" swaggertype:"string" description:"排序字段：priority/due_date/created_at/updated_at/title/relevance"`
+	Order string `json:"order,omitempty" example:"asc" swaggertype:"string" description:"排序方向：asc/desc，默认asc"`
+}
+
+// Value 实现 driver.Valuer 接口
+func (d SmartListDefinition) Value() (driver.Value, error) {
+	return json.Marshal(d)
+}
+
+// Scan 实现 sql.Scanner 接口
+func (d *SmartListDefinition) Scan(value interface{}) error {
+	*d = SmartListDefinition{}
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into SmartListDefinition", value)
+	}
+	return json.Unmarshal(bytes, d)
+}
+
+// clone 深拷贝定义，避免调用方修改存储中的切片
+func (d SmartListDefinition) clone() SmartListDefinition {
+	cp := d
+	cp.Priorities = slices.Clone(d.Priorities)
+	cp.CategoryUUIDs = slices.Clone(d.CategoryUUIDs)
+	cp.Tags = slices.Clone(d.Tags)
+	cp.Sort = slices.Clone(d.Sort)
+	if d.Completed != nil {
+		completed := *d.Completed
+		cp.Completed = &completed
+	}
+	if d.HasReminder != nil {
+		hasReminder := *d.HasReminder
+		cp.HasReminder = &hasReminder
+	}
+	if d.Due != nil {
+		due := *d.Due
+		cp.Due = &due
+	}
+	return cp
+}
+
+// Validate 检查定义是否有效，搜索查询有语法错误时返回 *SearchSyntaxError，其余错误包装 ErrInvalidSmartList
+func (d *SmartListDefinition) Validate() error {
+	if d.Query != "" {
+		if _, err := ParseSearchQuery(d.Query, time.Now()); err != nil {
+			return err
+		}
+	}
+	for _, priority := range d.Priorities {
+		if priority < PriorityLow || priority > PriorityUrgent {
+			return fmt.Errorf("%w: priority %d", ErrInvalidSmartList, priority)
+		}
+	}
+	for _, categoryUUID := range d.CategoryUUIDs {
+		if _, err := uuid.Parse(categoryUUID); err != nil {
+			return fmt.Errorf("%w: category uuid %s", ErrInvalidSmartList, categoryUUID)
+		}
+	}
+	if d.TagMatch != "" && d.TagMatch != TagMatchAny && d.TagMatch != TagMatchAll {
+		return fmt.Errorf("%w: tag_match %s", ErrInvalidSmartList, d.TagMatch)
+	}
+	if d.Due != nil && d.Due.FromDays != nil && d.Due.ToDays != nil && *d.Due.FromDays > *d.Due.ToDays {
+		return fmt.Errorf("%w: due range is empty", ErrInvalidSmartList)
+	}
+	if len(d.Sort) > SmartListMaxSorts {
+		return fmt.Errorf("%w: at most %d sort keys", ErrInvalidSmartList, SmartListMaxSorts)
+	}
+	for _, sort := range d.Sort {
+		if sort.Order != "" && sort.Order != "asc" && sort.Order != "desc" {
+			return fmt.Errorf("%w: sort order %s", ErrInvalidSmartList, sort.Order)
+		}
+	}
+	query := TodoQuery{Sort: d.todoSorts()}
+	if _, err := query.sorts(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSmartList, err)
+	}
+	return nil
+}
+
+// todoSorts 转换为 TodoQuery 的排序键
+func (d *SmartListDefinition) todoSorts() []TodoSort {
+	var sorts []TodoSort
+	for _, sort := range d.Sort {
+		sorts = append(sorts, TodoSort{Field: sort.Field, Desc: sort.Order == "desc"})
+	}
+	return sorts
+}
+
+// SmartListQuery 将智能列表的定义转换为TODO查询条件。now 为当前时间，相对日期和搜索查询按其时区计算；
+// 分类UUID通过 r 解析为分类ID（包括已删除的分类），分类不存在时返回 ErrNotFound
+func SmartListQuery(r CategoryStore, list *SmartList, now time.Time) (TodoQuery, error) {
+	d := &list.Definition
+	filter := TodoFilter{
+		Completed:     d.Completed,
+		Priorities:    d.Priorities,
+		Uncategorized: d.Uncategorized,
+		Tags:          d.Tags,
+		TagMatch:      d.TagMatch,
+		Overdue:       d.Overdue,
+		Now:           now,
+		HasReminder:   d.HasReminder,
+	}
+	if d.Query != "" {
+		search, err := ParseSearchQuery(d.Query, now)
+		if err != nil {
+			return TodoQuery{}, err
+		}
+		// 不含任何条件的查询（如只有标点）不参与筛选，而不是匹配不到任何TODO
+		if !search.IsEmpty() {
+			filter.Search = search
+		}
+	}
+	for _, categoryUUID := range d.CategoryUUIDs {
+		category, err := r.GetCategoryByUUID(list.UserID, categoryUUID)
+		if err != nil {
+			return TodoQuery{}, err
+		}
+		filter.CategoryIDs = append(filter.CategoryIDs, category.ID)
+	}
+	if d.Due != nil {
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		if d.Due.FromDays != nil {
+			after := today.AddDate(0, 0, *d.Due.FromDays)
+			filter.DueAfter = &after
+		}
+		if d.Due.ToDays != nil {
+			before := today.AddDate(0, 0, *d.Due.ToDays+1)
+			filter.DueBefore = &before
+		}
+	}
+	return TodoQuery{Filter: filter, Sort: d.todoSorts()}, nil
+}
+
+// SmartListRepository 智能列表数据访问层
+type SmartListRepository struct {
+	db *sqlDB
+}
+
+// smartListColumns 查询智能列表时选择的列，与 scanSmartList 的扫描顺序一致
+const smartListColumns = `id, uuid, user_id, name, icon, color, definition, created_at, updated_at, is_deleted, sync_version`
+
+// scanSmartList 扫描单行智能列表数据
+func scanSmartList(scanner interface{ Scan(dest ...any) error }) (*SmartList, error) {
+	var list SmartList
+	err := scanner.Scan(&list.ID, &list.UUID, &list.UserID, &list.Name, &list.Icon, &list.Color,
+		&list.Definition, &list.CreatedAt, &list.UpdatedAt, &list.IsDeleted, &list.SyncVersion)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &list, nil
+}
+
+// querySmartLists 执行查询并扫描多行智能列表
+func (r *SmartListRepository) querySmartLists(query string, args ...any) ([]SmartList, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lists []SmartList
+	for rows.Next() {
+		list, err := scanSmartList(rows)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, *list)
+	}
+
+	return lists, rows.Err()
+}
+
+// CreateSmartList 创建智能列表
+func (r *SmartListRepository) CreateSmartList(list *SmartList) error {
+	definitionJSON, err := json.Marshal(list.Definition)
+	if err != nil {
+		return fmt.Errorf("failed to marshal definition: %v", err)
+	}
+
+	query := `
+		INSERT INTO smart_lists (uuid, user_id, name, icon, color, definition, created_at, updated_at, is_deleted, sync_version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`
+
+	if list.UUID == "" {
+		list.UUID = uuid.NewString()
+	}
+	now := time.Now()
+	return translateError(r.db.withTx(func(tx *sqlDB) error {
+		syncVersion, err := tx.nextSyncVersion(list.UserID)
+		if err != nil {
+			return err
+		}
+		if err := tx.QueryRow(query, list.UUID, list.UserID, list.Name, list.Icon, list.Color, string(definitionJSON),
+			now, now, list.IsDeleted, syncVersion).Scan(&list.ID); err != nil {
+			return err
+		}
+		list.CreatedAt = now
+		list.UpdatedAt = now
+		list.SyncVersion = syncVersion
+		tx.recordChange(list.UserID, syncVersion, ChangedEntity{Type: SyncTypeSmartList, ID: list.ID, UUID: list.UUID})
+		return nil
+	}))
+}
+
+// GetSmartListsByUserID 获取用户未删除的智能列表，按创建时间排序
+func (r *SmartListRepository) GetSmartListsByUserID(userID int) ([]SmartList, error) {
+	query := `
+		SELECT ` + smartListColumns + `
+		FROM smart_lists
+		WHERE user_id = $1 AND is_deleted = FALSE
+		ORDER BY created_at ASC, id ASC`
+
+	return r.querySmartLists(query, userID)
+}
+
+// GetSmartListByID 根据ID获取单个未删除的智能列表
+func (r *SmartListRepository) GetSmartListByID(listID, userID int) (*SmartList, error) {
+	query := `
+		SELECT ` + smartListColumns + `
+		FROM smart_lists
+		WHERE id = $1 AND user_id = $2 AND is_deleted = FALSE`
+
+	return scanSmartList(r.db.QueryRow(query, listID, userID))
+}
+
+// GetSmartListByUUID 根据客户端UUID获取单个智能列表（包含已删除的智能列表）
+func (r *SmartListRepository) GetSmartListByUUID(userID int, uuid string) (*SmartList, error) {
+	query := `
+		SELECT ` + smartListColumns + `
+		FROM smart_lists
+		WHERE user_id = $1 AND uuid = $2`
+
+	return scanSmartList(r.db.QueryRow(query, userID, uuid))
+}
+
+// UpdateSmartList 更新智能列表的名称、图标、颜色和定义
+func (r *SmartListRepository) UpdateSmartList(list *SmartList) error {
+	definitionJSON, err := json.Marshal(list.Definition)
+	if err != nil {
+		return fmt.Errorf("failed to marshal definition: %v", err)
+	}
+
+	query := `
+		UPDATE smart_lists
+		SET name = $1, icon = $2, color = $3, definition = $4, updated_at = $5, sync_version = $6
+		WHERE id = $7 AND user_id = $8 AND is_deleted = FALSE
+		RETURNING uuid`
+
+	now := time.Now()
+	return translateError(r.db.withTx(func(tx *sqlDB) error {
+		syncVersion, err := tx.nextSyncVersion(list.UserID)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRow(query, list.Name, list.Icon, list.Color, string(definitionJSON),
+			now, syncVersion, list.ID, list.UserID).Scan(&list.UUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("smart list not found or not owned by user: %w", ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		list.UpdatedAt = now
+		list.SyncVersion = syncVersion
+		tx.recordChange(list.UserID, syncVersion, ChangedEntity{Type: SyncTypeSmartList, ID: list.ID, UUID: list.UUID})
+		return nil
+	}))
+}
+
+// DeleteSmartList 删除智能列表（软删除，保留为同步墓碑）
+func (r *SmartListRepository) DeleteSmartList(listID, userID int) error {
+	query := `
+		UPDATE smart_lists
+		SET is_deleted = TRUE, updated_at = $1, sync_version = $2
+		WHERE id = $3 AND user_id = $4 AND is_deleted = FALSE
+		RETURNING uuid`
+
+	now := time.Now()
+	return r.db.withTx(func(tx *sqlDB) error {
+		syncVersion, err := tx.nextSyncVersion(userID)
+		if err != nil {
+			return err
+		}
+		var listUUID string
+		err = tx.QueryRow(query, now, syncVersion, listID, userID).Scan(&listUUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("smart list not found or not owned by user: %w", ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		tx.recordChange(userID, syncVersion, ChangedEntity{Type: SyncTypeSmartList, ID: listID, UUID: listUUID})
+		return nil
+	})
+}
+
+// GetSmartListsSince 按版本号顺序获取同步版本号在 (since, until] 区间内的智能列表（用于增量同步），limit < 0 表示不限制数量
+func (r *SmartListRepository) GetSmartListsSince(userID int, since, until int64, limit int) ([]SmartList, error) {
+	query := `
+		SELECT ` + smartListColumns + `
+		FROM smart_lists
+		WHERE user_id = $1 AND sync_version > $2 AND sync_version <= $3
+		ORDER BY sync_version ASC` + limitClause(limit)
+
+	return r.querySmartLists(query, userID, since, until)
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSmartListDefinitionValidate(t *testing.T) {
+	from, to := 3, 1
+	tests := []struct {
+		name       string
+		definition SmartListDefinition
+		syntax     bool // 期望返回 SearchSyntaxError
+	}{
+		{"query", SmartListDefinition{Query: "tag:"}, true},
+		{"priority", SmartListDefinition{Priorities: []Priority{4}}, false},
+		{"category", SmartListDefinition{CategoryUUIDs: []string{"not-a-uuid"}}, false},
+		{"tag match", SmartListDefinition{Tags: []string{"a"}, TagMatch: "some"}, false},
+		{"due range", SmartListDefinition{Due: &SmartListDateRange{FromDays: &from, ToDays: &to}}, false},
+		{"sort field", SmartListDefinition{Sort: []SmartListSort{{Field: "color"}}}, false},
+		{"sort order", SmartListDefinition{Sort: []SmartListSort{{Field: SortTitle, Order: "up"}}}, false},
+	}
+	for _, tt := range tests {
+		err := tt.definition.Validate()
+		var syntaxErr *SearchSyntaxError
+		if tt.syntax && !errors.As(err, &syntaxErr) {
+			t.Errorf("%s: Validate() error = %v, want SearchSyntaxError", tt.name, err)
+		}
+		if !tt.syntax && !errors.Is(err, ErrInvalidSmartList) {
+			t.Errorf("%s: Validate() error = %v, want ErrInvalidSmartList", tt.name, err)
+		}
+	}
+
+	valid := SmartListDefinition{
+		Query:      "周报 -is:done",
+		Priorities: []Priority{PriorityHigh, PriorityUrgent},
+		Sort:       []SmartListSort{{Field: SortDueDate}, {Field: SortPriority, Order: "desc"}},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestStoreSmartLists(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		work := &Category{UserID: userID, Name: "工作"}
+		if err := store.CreateCategory(work); err != nil {
+			t.Fatalf("CreateCategory() error = %v", err)
+		}
+
+		// 执行时间为东八区 10 月 16 日上午，截止日期按该时区的整天计算
+		due := func(day, hour int) *time.Time {
+			d := time.Date(2026, 10, day, hour, 0, 0, 0, searchNow.Location())
+			return &d
+		}
+		todos := []*Todo{
+			{Title: "周报", Priority: PriorityHigh, DueDate: due(16, 18), CategoryID: &work.ID},
+			{Title: "季度总结", Priority: PriorityUrgent, DueDate: due(18, 9), CategoryID: &work.ID},
+			{Title: "下月计划", Priority: PriorityHigh, DueDate: due(30, 9), CategoryID: &work.ID},
+			{Title: "买菜", Priority: PriorityHigh, DueDate: due(17, 9)},
+			{Title: "已完成", Priority: PriorityUrgent, DueDate: due(17, 9), CategoryID: &work.ID, Completed: true},
+		}
+		for _, todo := range todos {
+			todo.UserID = userID
+			todo.Tags = StringSlice{}
+			if err := store.CreateTodoExtended(todo); err != nil {
+				t.Fatalf("CreateTodoExtended() error = %v", err)
+			}
+		}
+
+		completed := false
+		from, to := 0, 7
+		list := &SmartList{
+			UserID: userID,
+			Name:   "本周工作",
+			Icon:   "star",
+			Color:  "#FF5722",
+			Definition: SmartListDefinition{
+				Completed:     &completed,
+				Priorities:    []Priority{PriorityHigh, PriorityUrgent},
+				CategoryUUIDs: []string{work.UUID},
+				Due:           &SmartListDateRange{FromDays: &from, ToDays: &to},
+				Sort:          []SmartListSort{{Field: SortPriority, Order: "desc"}},
+			},
+		}
+		if err := store.CreateSmartList(list); err != nil {
+			t.Fatalf("CreateSmartList() error = %v", err)
+		}
+		if list.ID == 0 || list.UUID == "" || list.SyncVersion == 0 {
+			t.Errorf("CreateSmartList() = %+v", list)
+		}
+		if err := store.CreateSmartList(&SmartList{UserID: userID, UUID: list.UUID, Name: "重复"}); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("CreateSmartList(duplicate uuid) error = %v, want ErrDuplicate", err)
+		}
+
+		stored, err := store.GetSmartListByID(list.ID, userID)
+		if err != nil {
+			t.Fatalf("GetSmartListByID() error = %v", err)
+		}
+		if d := stored.Definition; d.Completed == nil || *d.Completed || len(d.CategoryUUIDs) != 1 || d.Due == nil || *d.Due.ToDays != 7 {
+			t.Errorf("GetSmartListByID() definition = %+v", d)
+		}
+
+		query, err := SmartListQuery(store, stored, searchNow)
+		if err != nil {
+			t.Fatalf("SmartListQuery() error = %v", err)
+		}
+		query.Limit = 10
+		results, err := store.ListTodos(userID, query)
+		if err != nil {
+			t.Fatalf("ListTodos() error = %v", err)
+		}
+		if len(results) != 2 || results[0].ID != todos[1].ID || results[1].ID != todos[0].ID {
+			t.Errorf("smart list todos = %+v, want 季度总结, 周报", results)
+		}
+
+		stored.Name = "下周之后"
+		stored.Definition = SmartListDefinition{Query: "计划", Due: &SmartListDateRange{FromDays: &to}}
+		if err := store.UpdateSmartList(stored); err != nil {
+			t.Fatalf("UpdateSmartList() error = %v", err)
+		}
+		if stored.SyncVersion <= list.SyncVersion {
+			t.Errorf("UpdateSmartList() sync version = %d, want > %d", stored.SyncVersion, list.SyncVersion)
+		}
+		query, err = SmartListQuery(store, stored, searchNow)
+		if err != nil {
+			t.Fatalf("SmartListQuery() error = %v", err)
+		}
+		query.Limit = 10
+		results, err = store.ListTodos(userID, query)
+		if err != nil || len(results) != 1 || results[0].ID != todos[2].ID {
+			t.Errorf("updated smart list todos = %+v, %v; want 下月计划", results, err)
+		}
+
+		// 引用不存在的分类时无法执行
+		missing := &SmartList{UserID: userID, Definition: SmartListDefinition{CategoryUUIDs: []string{"3b241101-e2bb-4255-8caf-4136c566a962"}}}
+		if _, err := SmartListQuery(store, missing, searchNow); !errors.Is(err, ErrNotFound) {
+			t.Errorf("SmartListQuery(missing category) error = %v, want ErrNotFound", err)
+		}
+
+		if err := store.DeleteSmartList(list.ID, userID); err != nil {
+			t.Fatalf("DeleteSmartList() error = %v", err)
+		}
+		if _, err := store.GetSmartListByID(list.ID, userID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetSmartListByID() after delete error = %v, want ErrNotFound", err)
+		}
+		if err := store.DeleteSmartList(list.ID, userID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("DeleteSmartList() twice error = %v, want ErrNotFound", err)
+		}
+		lists, err := store.GetSmartListsByUserID(userID)
+		if err != nil || len(lists) != 0 {
+			t.Errorf("GetSmartListsByUserID() = %+v, %v; want empty", lists, err)
+		}
+
+		changed, err := store.GetSmartListsSince(userID, 0, math.MaxInt64, -1)
+		if err != nil || len(changed) != 1 || !changed[0].IsDeleted || changed[0].Name != "下周之后" {
+			t.Errorf("GetSmartListsSince() = %+v, %v; want tombstone", changed, err)
+		}
+		changes, err := GetChangesSince(store, userID, stored.SyncVersion, math.MaxInt64, -1)
+		if err != nil || len(changes.SmartLists) != 1 {
+			t.Errorf("GetChangesSince() smart lists = %+v, %v", changes, err)
+		}
+	})
+}
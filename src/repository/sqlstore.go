@@ -0,0 +1,390 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// dialect SQL方言差异
+type dialect struct {
+	name      string
+	ilike     string              // 大小写不敏感匹配运算符
+	greatest  string              // 多参数取最大值函数
+	rebind    func(string) string // 将 $n 占位符改写为方言支持的形式
+	utcTimes  bool                // 时间以文本存储，需统一转换为UTC才能正确比较
+	hasTag    string              // 判断 todos.tags 是否包含某个标签，%s 为参数占位符
+	tagValues string              // 将 todos.tags 展开为每个标签一行的表达式，别名为 tag，列 tag.value 为标签名称
+
+	searchIndex string                            // 更新TODO全文索引，参数依次为ID及标题、描述、标签的分词结果
+	searchMatch string                            // 判断TODO是否匹配全文查询，%s 为查询参数占位符
+	searchRank  string                            // TODO与全文查询的相关度，越大越相关，%s 为查询参数占位符
+	searchQuery func([]searchClause, bool) string // 将搜索词转换为方言的全文查询语法，第二个参数为 true 时为"或"关系
+}
+
+var postgresDialect = dialect{
+	name:      DriverPostgres,
+	ilike:     "ILIKE",
+	greatest:  "GREATEST",
+	hasTag:    "todos.tags @> jsonb_build_array(CAST(%s AS TEXT))",
+	tagValues: "jsonb_array_elements_text(todos.tags) AS tag(value)",
+	rebind:    func(query string) string { return query },
+
+	// 分词在应用中完成，simple 配置只按空白切分并转为小写
+	searchIndex: `UPDATE todos SET search_vector =
+		setweight(to_tsvector('simple', $2), 'A') || setweight(to_tsvector('simple', $3), 'B') ||
+		setweight(to_tsvector('simple', $4), 'C')
+		WHERE id = $1`,
+	searchMatch: "todos.search_vector @@ to_tsquery('simple', %s)",
+	// ts_rank 返回 real，转换为双精度后游标中的相关度才能与查询结果精确比较
+	searchRank:  "CAST(ts_rank(todos.search_vector, to_tsquery('simple', %s)) AS DOUBLE PRECISION)",
+	searchQuery: tsquery,
+}
+
+var placeholderPattern = regexp.MustCompile(`\$(\d+)`)
+
+var sqliteDialect = dialect{
+	name:      DriverSQLite,
+	ilike:     "LIKE", // SQLite的LIKE对ASCII字符默认不区分大小写
+	greatest:  "MAX",
+	utcTimes:  true,
+	hasTag:    "EXISTS (SELECT 1 FROM json_each(todos.tags) WHERE json_each.value = %s)",
+	tagValues: "json_each(todos.tags) AS tag",
+
+	searchIndex: "INSERT OR REPLACE INTO todos_fts (rowid, title, description, tags) VALUES ($1, $2, $3, $4)",
+	searchMatch: "todos.id IN (SELECT rowid FROM todos_fts WHERE todos_fts MATCH %s)",
+	// bm25 越小越相关，取相反数使其与PostgreSQL一致；各列权重与 ts_rank 的 A/B/C 一致
+	searchRank:  "COALESCE((SELECT -bm25(todos_fts, 1.0, 0.4, 0.2) FROM todos_fts WHERE todos_fts MATCH %s AND rowid = todos.id), 0.0)",
+	searchQuery: fts5,
+	rebind: func(query string) string {
+		// SQLite 支持 ?NNN 形式的编号参数，语义与 $n 一致
+		return placeholderPattern.ReplaceAllString(query, "?$1")
+	},
+}
+
+// sqlDB 对*sql.DB的轻量包装，执行前按方言改写SQL；tx 非空时所有语句在该事务中执行
+type sqlDB struct {
+	conn    *sql.DB
+	tx      *sql.Tx
+	dialect dialect
+
+	hub           *ChangeHub
+	notifyChannel string     // 非空时变更通知经PostgreSQL NOTIFY广播，否则直接在进程内发布
+	changes       *changeLog // 当前事务中的写入，提交后发布
+	deviceID      string     // 写入修改历史的设备ID，见 WithDevice
+}
+
+func (db *sqlDB) Exec(query string, args ...any) (sql.Result, error) {
+	if db.tx != nil {
+		return db.tx.Exec(db.dialect.rebind(query), db.bindArgs(args)...)
+	}
+	return db.conn.Exec(db.dialect.rebind(query), db.bindArgs(args)...)
+}
+
+func (db *sqlDB) Query(query string, args ...any) (*sql.Rows, error) {
+	if db.tx != nil {
+		return db.tx.Query(db.dialect.rebind(query), db.bindArgs(args)...)
+	}
+	return db.conn.Query(db.dialect.rebind(query), db.bindArgs(args)...)
+}
+
+func (db *sqlDB) QueryRow(query string, args ...any) *sql.Row {
+	if db.tx != nil {
+		return db.tx.QueryRow(db.dialect.rebind(query), db.bindArgs(args)...)
+	}
+	return db.conn.QueryRow(db.dialect.rebind(query), db.bindArgs(args)...)
+}
+
+// withTx 在事务中执行fn，fn返回错误时回滚；已处于事务中时直接复用当前事务
+func (db *sqlDB) withTx(fn func(tx *sqlDB) error) error {
+	if db.tx != nil {
+		return fn(db)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	txDB := &sqlDB{conn: db.conn, tx: tx, dialect: db.dialect,
+		hub: db.hub, notifyChannel: db.notifyChannel, changes: &changeLog{}, deviceID: db.deviceID}
+	if err := fn(txDB); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// NOTIFY 随事务提交才会送达，回滚时自动丢弃
+	events := txDB.changes.events()
+	if db.notifyChannel != "" {
+		for _, event := range events {
+			payload, err := notifyPayload(event)
+			if err == nil {
+				_, err = txDB.Exec("SELECT pg_notify($1, $2)", db.notifyChannel, payload)
+			}
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if db.notifyChannel == "" {
+		for _, event := range events {
+			db.hub.Publish(event)
+		}
+	}
+	return nil
+}
+
+// recordChange 记录事务中的一次写入，事务提交后发布变更通知
+func (db *sqlDB) recordChange(userID int, syncVersion int64, entity ChangedEntity) {
+	if db.changes != nil {
+		*db.changes = append(*db.changes, changeRecord{userID: userID, syncVersion: syncVersion, entity: entity})
+	}
+}
+
+// withSavepoint 在当前事务的保存点中执行fn，fn返回错误时只回滚保存点之后的写入。
+// PostgreSQL中语句出错会使整个事务失效，必须回滚到保存点后才能继续执行
+func (db *sqlDB) withSavepoint(fn func() error) error {
+	if _, err := db.Exec("SAVEPOINT sp"); err != nil {
+		return err
+	}
+	recorded := len(*db.changes)
+	if err := fn(); err != nil {
+		*db.changes = (*db.changes)[:recorded]
+		if _, rollbackErr := db.Exec("ROLLBACK TO SAVEPOINT sp"); rollbackErr != nil {
+			return rollbackErr
+		}
+		db.Exec("RELEASE SAVEPOINT sp")
+		return err
+	}
+	_, err := db.Exec("RELEASE SAVEPOINT sp")
+	return err
+}
+
+// maxRowVersionExpr 用户现有数据中的最大同步版本号
+const maxRowVersionExpr = `
+	COALESCE((SELECT MAX(sync_version) FROM todos WHERE user_id = $1), 0),
+	COALESCE((SELECT MAX(sync_version) FROM categories WHERE user_id = $1), 0),
+	COALESCE((SELECT MAX(sync_version) FROM todo_checklist_items WHERE user_id = $1), 0),
+	COALESCE((SELECT MAX(sync_version) FROM tags WHERE user_id = $1), 0),
+	COALESCE((SELECT MAX(sync_version) FROM smart_lists WHERE user_id = $1), 0),
+	COALESCE((SELECT sync_version FROM user_settings WHERE user_id = $1), 0)`
+
+// nextSyncVersion 为用户分配下一个同步版本号，必须在写入数据的同一事务中调用。
+// 计数行在事务提交前保持行锁，同一用户的写入按版本号顺序提交，
+// 因此客户端以 since = server_version 拉取时不会漏掉任何写入
+func (db *sqlDB) nextSyncVersion(userID int) (int64, error) {
+	var version int64
+	err := db.QueryRow(`
+		UPDATE sync_sequences SET version = version + 1
+		WHERE user_id = $1
+		RETURNING version`, userID).Scan(&version)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return version, err
+	}
+
+	// 首次写入时以现有数据的最大版本号为起点，兼容升级前基于毫秒时间戳的版本号
+	query := fmt.Sprintf(`
+		INSERT INTO sync_sequences (user_id, version)
+		VALUES ($1, %s(%s) + 1)
+		ON CONFLICT (user_id) DO UPDATE SET version = sync_sequences.version + 1
+		RETURNING version`, db.dialect.greatest, maxRowVersionExpr)
+	err = db.QueryRow(query, userID).Scan(&version)
+	return version, err
+}
+
+// lockUserWrites 锁定用户的同步版本计数行直到事务结束，与 nextSyncVersion 使用同一把锁，
+// 同一用户的写入在此之后串行执行；计数行不存在时以现有数据的最大版本号创建
+func (db *sqlDB) lockUserWrites(userID int) error {
+	result, err := db.Exec("UPDATE sync_sequences SET version = version WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO sync_sequences (user_id, version)
+		VALUES ($1, %s(%s))
+		ON CONFLICT (user_id) DO UPDATE SET version = sync_sequences.version`, db.dialect.greatest, maxRowVersionExpr)
+	_, err = db.Exec(query, userID)
+	return err
+}
+
+// bindArgs 按方言调整参数
+func (db *sqlDB) bindArgs(args []any) []any {
+	if !db.dialect.utcTimes {
+		return args
+	}
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			args[i] = v.UTC()
+		case *time.Time:
+			if v != nil {
+				args[i] = v.UTC()
+			}
+		}
+	}
+	return args
+}
+
+// SQLStore 基于database/sql的存储实现，PostgreSQL和SQLite共用
+type SQLStore struct {
+	*UserRepository
+	*ExtendedTodoRepository
+	*CategoryRepository
+	*ChecklistRepository
+	*TagRepository
+	*SmartListRepository
+	*RevisionRepository
+	*TrashRepository
+	*ReminderRepository
+	*DigestRepository
+	*WebhookRepository
+	*CalendarFeedRepository
+	*AppPasswordRepository
+	*UserSettingsRepository
+	*RefreshTokenRepository
+	*DeviceRepository
+	*IdempotencyKeyRepository
+
+	db       *sqlDB
+	listener *pq.Listener // 非空时通过PostgreSQL LISTEN接收所有实例的变更通知
+}
+
+// NewPostgresStore 基于已连接的PostgreSQL数据库创建存储
+func NewPostgresStore(db *sql.DB) *SQLStore {
+	return newSQLStore(&sqlDB{conn: db, dialect: postgresDialect, hub: NewChangeHub()})
+}
+
+// OpenSQLiteStore 打开（必要时创建）SQLite数据库文件并初始化表结构
+func OpenSQLiteStore(path string) (*SQLStore, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	// SQLite同一时刻只允许一个写连接
+	db.SetMaxOpenConns(1)
+
+	if err := createSQLiteTables(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return newSQLStore(&sqlDB{conn: db, dialect: sqliteDialect, hub: NewChangeHub()}), nil
+}
+
+func newSQLStore(db *sqlDB) *SQLStore {
+	return &SQLStore{
+		UserRepository:           &UserRepository{db: db},
+		ExtendedTodoRepository:   &ExtendedTodoRepository{db: db},
+		CategoryRepository:       &CategoryRepository{db: db},
+		ChecklistRepository:      &ChecklistRepository{db: db},
+		TagRepository:            &TagRepository{db: db},
+		SmartListRepository:      &SmartListRepository{db: db},
+		RevisionRepository:       &RevisionRepository{db: db},
+		TrashRepository:          &TrashRepository{db: db},
+		ReminderRepository:       &ReminderRepository{db: db},
+		DigestRepository:         &DigestRepository{db: db},
+		WebhookRepository:        &WebhookRepository{db: db},
+		CalendarFeedRepository:   &CalendarFeedRepository{db: db},
+		AppPasswordRepository:    &AppPasswordRepository{db: db},
+		UserSettingsRepository:   &UserSettingsRepository{db: db},
+		RefreshTokenRepository:   &RefreshTokenRepository{db: db},
+		DeviceRepository:         &DeviceRepository{db: db},
+		IdempotencyKeyRepository: &IdempotencyKeyRepository{db: db},
+		db:                       db,
+	}
+}
+
+// DB 返回底层数据库连接
+func (s *SQLStore) DB() *sql.DB {
+	return s.db.conn
+}
+
+// Close 关闭数据库连接
+func (s *SQLStore) Close() error {
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	return s.db.conn.Close()
+}
+
+// SubscribeChanges 订阅用户的数据变更通知
+func (s *SQLStore) SubscribeChanges(userID int) (<-chan ChangeEvent, func()) {
+	return s.db.hub.Subscribe(userID)
+}
+
+// WithTx 在事务中执行fn，fn返回错误时回滚；已处于事务中时使用保存点，只回滚fn内的写入
+func (s *SQLStore) WithTx(fn func(tx Store) error) error {
+	if s.db.tx != nil {
+		return s.db.withSavepoint(func() error { return fn(s) })
+	}
+	return s.db.withTx(func(tx *sqlDB) error {
+		return fn(newSQLStore(tx))
+	})
+}
+
+// WithDevice 返回以指定设备身份写入的存储视图，与原存储共享连接和事务，写入的修改历史记录该设备
+func (s *SQLStore) WithDevice(deviceID string) Store {
+	db := *s.db
+	db.deviceID = deviceID
+	return newSQLStore(&db)
+}
+
+// GetCurrentSyncVersion 获取用户当前同步版本号，即最后一次已提交写入的版本号
+func (s *SQLStore) GetCurrentSyncVersion(userID int) (int64, error) {
+	query := fmt.Sprintf(`
+		SELECT %s(
+			COALESCE((SELECT version FROM sync_sequences WHERE user_id = $1), 0),
+			%s
+		) as max_version`, s.db.dialect.greatest, maxRowVersionExpr)
+
+	var maxVersion int64
+	err := s.db.QueryRow(query, userID).Scan(&maxVersion)
+	return maxVersion, err
+}
+
+// LockUserWrites 锁定用户的写入直到事务结束，见 lockUserWrites
+func (s *SQLStore) LockUserWrites(userID int) error {
+	return s.db.lockUserWrites(userID)
+}
+
+// limitClause 生成LIMIT子句，limit < 0 表示不限制数量
+func limitClause(limit int) string {
+	if limit < 0 {
+		return ""
+	}
+	return fmt.Sprintf(" LIMIT %d", limit)
+}
+
+// translateError 将驱动相关的错误转换为存储层通用错误
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return fmt.Errorf("%w: %v", ErrDuplicate, err)
+	}
+	if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return fmt.Errorf("%w: %v", ErrDuplicate, err)
+	}
+
+	return err
+}
@@ -0,0 +1,281 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 存储层通用错误，各存储实现都应返回（或包装）这些错误，便于上层统一判断
+var (
+	ErrNotFound  = errors.New("record not found")         // 记录不存在或不属于该用户
+	ErrDuplicate = errors.New("duplicate record")         // 违反唯一约束
+	ErrNoStore   = errors.New("unsupported store driver") // 不支持的存储驱动
+)
+
+// 支持的存储驱动
+const (
+	DriverPostgres = "postgres" // PostgreSQL（默认）
+	DriverSQLite   = "sqlite"   // 嵌入式SQLite，适合小团队自托管
+	DriverMemory   = "memory"   // 纯内存存储，适合单元测试
+)
+
+// UserStore 用户存储接口
+type UserStore interface {
+	CreateUser(user *User) error
+	GetUserByUsername(username string) (*User, error)
+	GetUserByID(userID int) (*User, error)
+}
+
+// TodoStore TODO存储接口
+type TodoStore interface {
+	CreateTodoExtended(todo *Todo) error
+	GetTodosByUserIDExtended(userID int, limit, offset int) ([]Todo, error)
+	ListTodos(userID int, query TodoQuery) ([]Todo, error)
+	CountTodos(userID int, filter TodoFilter) (int, error)
+	UpdateTodoExtended(todo *Todo) error
+	DeleteTodo(todoID, userID int) error
+	GetTodosSince(userID int, since, until int64, limit int) ([]Todo, error)
+	GetTodoByID(todoID, userID int) (*Todo, error)
+	GetDeletedTodo(todoID, userID int) (*Todo, error)
+	GetTodoByUUID(userID int, uuid string) (*Todo, error)
+	GetTodoSnapshot(todoID, userID int, syncVersion int64) (*Todo, error)
+}
+
+// TodoSnapshotRetention 每个TODO保留的历史快照数量，客户端基于更早版本的修改按两方对比处理冲突
+const TodoSnapshotRetention = 20
+
+// CategoryStore 分类存储接口
+type CategoryStore interface {
+	CreateCategory(category *Category) error
+	GetCategoriesByUserID(userID int) ([]Category, error)
+	UpdateCategory(category *Category) error
+	DeleteCategory(id, userID int) error
+	GetCategoriesSince(userID int, since, until int64, limit int) ([]Category, error)
+	GetCategoryByID(categoryID, userID int) (*Category, error)
+	GetCategoryByUUID(userID int, uuid string) (*Category, error)
+	GetDeletedCategories(userID int) ([]Category, error)
+	RestoreCategory(id, userID int) error
+	PurgeCategory(id, userID int) error
+}
+
+// ChecklistStore 检查项存储接口
+type ChecklistStore interface {
+	CreateChecklistItem(item *ChecklistItem) error
+	GetChecklistItemsByTodoID(todoID, userID int) ([]ChecklistItem, error)
+	GetChecklistItemByID(itemID, userID int) (*ChecklistItem, error)
+	GetChecklistItemByUUID(userID int, uuid string) (*ChecklistItem, error)
+	UpdateChecklistItem(item *ChecklistItem) error
+	DeleteChecklistItem(itemID, userID int) error
+	GetChecklistItemsSince(userID int, since, until int64, limit int) ([]ChecklistItem, error)
+}
+
+// TagStore 标签元数据存储接口
+type TagStore interface {
+	CreateTag(tag *Tag) error
+	GetTagsByUserID(userID int) ([]Tag, error)
+	GetTagByID(tagID, userID int) (*Tag, error)
+	GetTagByUUID(userID int, uuid string) (*Tag, error)
+	GetTagByName(userID int, name string) (*Tag, error)
+	UpdateTag(tag *Tag) error
+	DeleteTag(tagID, userID int) error
+	GetTagsSince(userID int, since, until int64, limit int) ([]Tag, error)
+	CountTagUsage(userID int) (map[string]int, error)
+}
+
+// SmartListStore 智能列表存储接口
+type SmartListStore interface {
+	CreateSmartList(list *SmartList) error
+	GetSmartListsByUserID(userID int) ([]SmartList, error)
+	GetSmartListByID(listID, userID int) (*SmartList, error)
+	GetSmartListByUUID(userID int, uuid string) (*SmartList, error)
+	UpdateSmartList(list *SmartList) error
+	DeleteSmartList(listID, userID int) error
+	GetSmartListsSince(userID int, since, until int64, limit int) ([]SmartList, error)
+}
+
+// RevisionStore TODO和分类的修改历史存储接口，修改历史由各写入方法在同一事务中记录
+type RevisionStore interface {
+	GetRevisions(userID int, entityType string, entityID int) ([]Revision, error)
+	GetRevisionByID(revisionID, userID int) (*Revision, error)
+}
+
+// TrashStore 回收站清理接口，已删除的TODO通过 TodoFilter.Deleted 查询
+type TrashStore interface {
+	// GetPurgeableTombstones 获取所有用户中删除时间早于 before、且用户全部未撤销设备都已同步过的已删除TODO和分类
+	GetPurgeableTombstones(before time.Time, limit int) ([]Tombstone, error)
+}
+
+// ReminderStore 提醒投递记录存储接口，用于后台提醒调度
+type ReminderStore interface {
+	// GetDueReminders 获取所有用户中提醒时间在 (from, to] 区间内、尚未生成投递记录的未完成TODO
+	GetDueReminders(from, to time.Time, limit int) ([]Todo, error)
+	// CreateReminderDelivery 生成待发送的投递记录，同一TODO、提醒时间和渠道的记录已存在时返回 ErrDuplicate
+	CreateReminderDelivery(delivery *ReminderDelivery) error
+	// ClaimReminderDeliveries 以 owner 身份认领可以发送的投递记录，租约到 leaseUntil 为止；返回空列表表示当前没有可以认领的记录
+	ClaimReminderDeliveries(owner string, now, leaseUntil time.Time, limit int) ([]ReminderDelivery, error)
+	// FinishReminderDelivery 保存发送结果并释放认领，记录已不再由 delivery.ClaimedBy 认领时返回 ErrNotFound
+	FinishReminderDelivery(delivery *ReminderDelivery) error
+	GetReminderDeliveries(userID, todoID int) ([]ReminderDelivery, error)
+}
+
+// DigestStore 每日摘要存储接口，用于后台每日摘要调度
+type DigestStore interface {
+	// GetDigestSubscribers 获取所有开启每日摘要的用户设置及其最近一次生成投递记录的摘要日期
+	GetDigestSubscribers() ([]DigestSubscriber, error)
+	// GetDailyDigest 获取用户的每日摘要内容，dayStart 和 dayEnd 为用户时区的当天范围，yesterdayStart 为前一天的开始时间
+	GetDailyDigest(userID int, now, dayStart, dayEnd, yesterdayStart time.Time) (*DailyDigest, error)
+	// CreateDigestDelivery 生成待发送的投递记录，同一用户、日期和渠道的记录已存在时返回 ErrDuplicate
+	CreateDigestDelivery(delivery *DigestDelivery) error
+	// ClaimDigestDeliveries 以 owner 身份认领可以发送的投递记录，租约到 leaseUntil 为止；返回空列表表示当前没有可以认领的记录
+	ClaimDigestDeliveries(owner string, now, leaseUntil time.Time, limit int) ([]DigestDelivery, error)
+	// FinishDigestDelivery 保存发送结果并释放认领，记录已不再由 delivery.ClaimedBy 认领时返回 ErrNotFound
+	FinishDigestDelivery(delivery *DigestDelivery) error
+	GetDigestDeliveries(userID int) ([]DigestDelivery, error)
+}
+
+// WebhookStore Webhook存储接口，事件和投递记录在写入TODO、分类和用户设置时生成
+type WebhookStore interface {
+	CreateWebhookEndpoint(endpoint *WebhookEndpoint) error
+	GetWebhookEndpoints(userID int) ([]WebhookEndpoint, error)
+	// GetWebhookEndpoint 根据ID获取Webhook，不检查所属用户
+	GetWebhookEndpoint(endpointID int) (*WebhookEndpoint, error)
+	// UpdateWebhookEndpoint 修改Webhook，重新启用已停用的Webhook时清零连续失败次数
+	UpdateWebhookEndpoint(endpoint *WebhookEndpoint) error
+	DeleteWebhookEndpoint(endpointID, userID int) error
+	// RecordWebhookResult 记录一次发送结果，lastError 为空表示成功；连续失败达到 failureLimit 时停用Webhook并返回 true
+	RecordWebhookResult(endpointID int, lastError string, failureLimit int) (bool, error)
+	GetWebhookEvent(eventID int) (*WebhookEvent, error)
+	GetWebhookDeliveries(endpointID int, limit int) ([]WebhookDelivery, error)
+	// ReplayWebhookDelivery 为投递记录对应的事件生成新的待发送投递记录，投递记录不属于该Webhook时返回 ErrNotFound
+	ReplayWebhookDelivery(endpointID, deliveryID int) (*WebhookDelivery, error)
+	// ClaimWebhookDeliveries 以 owner 身份认领可以发送的投递记录，租约到 leaseUntil 为止；返回空列表表示当前没有可以认领的记录
+	ClaimWebhookDeliveries(owner string, now, leaseUntil time.Time, limit int) ([]WebhookDelivery, error)
+	// FinishWebhookDelivery 保存发送结果并释放认领，记录已不再由 delivery.ClaimedBy 认领时返回 ErrNotFound
+	FinishWebhookDelivery(delivery *WebhookDelivery) error
+}
+
+// CalendarFeedStore 日历订阅存储接口
+type CalendarFeedStore interface {
+	CreateCalendarFeed(feed *CalendarFeed) error
+	GetCalendarFeeds(userID int) ([]CalendarFeed, error)
+	GetCalendarFeedByID(feedID, userID int) (*CalendarFeed, error)
+	// GetCalendarFeedByTokenHash 根据令牌哈希获取订阅，用于未登录的日历客户端读取
+	GetCalendarFeedByTokenHash(tokenHash string) (*CalendarFeed, error)
+	// UpdateCalendarFeed 修改订阅名称、限定的分类和令牌哈希
+	UpdateCalendarFeed(feed *CalendarFeed) error
+	DeleteCalendarFeed(feedID, userID int) error
+	// TouchCalendarFeed 记录日历客户端读取订阅的时间
+	TouchCalendarFeed(feedID int, accessedAt time.Time) error
+}
+
+// UserSettingsStore 用户设置存储接口
+type UserSettingsStore interface {
+	GetUserSettings(userID int) (*UserSettings, error)
+	CreateDefaultUserSettings(userID int) (*UserSettings, error)
+	UpdateUserSettings(settings *UserSettings) error
+	GetUserSettingsSince(userID int, since, until int64) (*UserSettings, error)
+}
+
+// AppPasswordStore 应用专用密码存储接口
+type AppPasswordStore interface {
+	CreateAppPassword(password *AppPassword) error
+	GetAppPasswords(userID int) ([]AppPassword, error)
+	// GetAppPasswordByHash 根据密码哈希获取应用专用密码，用于CalDAV客户端认证
+	GetAppPasswordByHash(passwordHash string) (*AppPassword, error)
+	DeleteAppPassword(passwordID, userID int) error
+	// DeleteAppPasswords 删除用户的全部应用专用密码（退出所有设备）
+	DeleteAppPasswords(userID int) error
+	// TouchAppPassword 记录客户端使用密码的时间
+	TouchAppPassword(passwordID int, usedAt time.Time) error
+}
+
+// RefreshTokenStore 刷新令牌存储接口
+type RefreshTokenStore interface {
+	CreateRefreshToken(token *RefreshToken) error
+	GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error)
+	MarkRefreshTokenUsed(id int, usedAt time.Time) (bool, error)
+	RevokeSession(userID int, sessionID string, revokedAt time.Time) error
+	RevokeAllSessions(userID int, revokedAt time.Time) error
+	IsSessionActive(userID int, sessionID string, now time.Time) (bool, error)
+}
+
+// DeviceStore 设备存储接口
+type DeviceStore interface {
+	CreateDevice(device *Device) error
+	GetDeviceByID(deviceID string, userID int) (*Device, error)
+	GetDeviceBySessionID(userID int, sessionID string) (*Device, error)
+	GetDevicesByUserID(userID int) ([]Device, error)
+	UpdateDevice(device *Device) error
+	AckDeviceSyncVersion(deviceID string, userID int, version int64, syncedAt time.Time) error
+}
+
+// IdempotencyStore 幂等键存储接口
+type IdempotencyStore interface {
+	CreateIdempotencyKey(key *IdempotencyKey) error
+	GetIdempotencyKey(userID int, key string) (*IdempotencyKey, error)
+}
+
+// Store 完整的数据存储接口，由PostgreSQL、SQLite和内存三种实现
+type Store interface {
+	UserStore
+	TodoStore
+	CategoryStore
+	ChecklistStore
+	TagStore
+	SmartListStore
+	RevisionStore
+	TrashStore
+	ReminderStore
+	DigestStore
+	WebhookStore
+	CalendarFeedStore
+	AppPasswordStore
+	UserSettingsStore
+	RefreshTokenStore
+	DeviceStore
+	IdempotencyStore
+	ChangeFeed
+
+	// WithTx 在事务中执行fn，fn返回错误时撤销其中的全部写入；在 tx 上嵌套调用相当于保存点。
+	// fn 内只能通过 tx 访问存储
+	WithTx(fn func(tx Store) error) error
+	// WithDevice 返回以指定设备身份写入的存储视图，写入的修改历史记录该设备，deviceID 为空表示未知设备
+	WithDevice(deviceID string) Store
+	// GetCurrentSyncVersion 获取用户当前最大同步版本号
+	GetCurrentSyncVersion(userID int) (int64, error)
+	// LockUserWrites 在事务中锁定用户的写入直到事务结束，其他事务对该用户的写入需等待；
+	// 先加锁再读取，才能基于最新数据判断和修改。必须在 WithTx 的 tx 上调用
+	LockUserWrites(userID int) error
+	// Close 释放存储占用的资源
+	Close() error
+}
+
+// OpenStore 根据配置打开对应的存储实现
+func OpenStore(config *DatabaseConfig) (Store, error) {
+	switch config.Driver {
+	case DriverPostgres, "":
+		db, err := ConnectDatabase(config)
+		if err != nil {
+			return nil, err
+		}
+		store := NewPostgresStore(db)
+		// 通过 LISTEN/NOTIFY 在多个服务实例间广播数据变更
+		if err := store.ListenChanges(config.DSN()); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return store, nil
+	case DriverSQLite:
+		return OpenSQLiteStore(config.Path)
+	case DriverMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrNoStore, config.Driver)
+	}
+}
+
+var (
+	_ Store = (*SQLStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
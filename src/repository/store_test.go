@@ -0,0 +1,852 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// storeFactories 需要通过一致性测试的存储实现（PostgreSQL需要外部数据库，不在此测试）
+func storeFactories(t *testing.T) map[string]func() Store {
+	return map[string]func() Store{
+		DriverMemory: func() Store { return NewMemoryStore() },
+		DriverSQLite: func() Store {
+			store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "todo.db"))
+			if err != nil {
+				t.Fatalf("OpenSQLiteStore() error = %v", err)
+			}
+			return store
+		},
+	}
+}
+
+// concurrentStoreFactories 并发测试使用的存储实现。SQLite只有一个连接，无法暴露并发写入的问题，
+// 设置 TEST_POSTGRES_DSN 时额外在PostgreSQL的独立schema中测试
+func concurrentStoreFactories(t *testing.T) map[string]func() Store {
+	factories := storeFactories(t)
+	if dsn := os.Getenv("TEST_POSTGRES_DSN"); dsn != "" {
+		factories[DriverPostgres] = func() Store { return openPostgresTestStore(t, dsn) }
+	}
+	return factories
+}
+
+// openPostgresTestStore 在新建的schema中创建表并打开存储，测试结束后删除该schema
+func openPostgresTestStore(t *testing.T, dsn string) Store {
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("CREATE SCHEMA error = %v", err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	separator := " "
+	if strings.Contains(dsn, "://") {
+		separator = "&"
+		if !strings.Contains(dsn, "?") {
+			separator = "?"
+		}
+	}
+	db, err := sql.Open("postgres", dsn+separator+"search_path="+schema)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	CreateTables(db)
+	return NewPostgresStore(db)
+}
+
+func forEachStore(t *testing.T, fn func(t *testing.T, store Store, userID int)) {
+	for name, factory := range storeFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			store := factory()
+			defer store.Close()
+
+			user := &User{Username: "tester", Email: "tester@example.com", Password: "hashed"}
+			if err := store.CreateUser(user); err != nil {
+				t.Fatalf("CreateUser() error = %v", err)
+			}
+			fn(t, store, user.ID)
+		})
+	}
+}
+
+func TestStoreUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		user, err := store.GetUserByUsername("tester")
+		if err != nil {
+			t.Fatalf("GetUserByUsername() error = %v", err)
+		}
+		if user.ID != userID || user.Password != "hashed" {
+			t.Errorf("GetUserByUsername() = %+v", user)
+		}
+
+		duplicate := &User{Username: "tester", Email: "other@example.com", Password: "x"}
+		if err := store.CreateUser(duplicate); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("CreateUser(duplicate) error = %v, want ErrDuplicate", err)
+		}
+
+		if _, err := store.GetUserByID(userID + 100); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetUserByID(missing) error = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreTodos(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		dueDate := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+		todo := &Todo{
+			UserID:   userID,
+			Title:    "学习Go语言",
+			Priority: PriorityHigh,
+			DueDate:  &dueDate,
+			Tags:     StringSlice{"工作", "重要"},
+		}
+		if err := store.CreateTodoExtended(todo); err != nil {
+			t.Fatalf("CreateTodoExtended() error = %v", err)
+		}
+		if todo.ID == 0 || todo.SyncVersion == 0 {
+			t.Fatalf("CreateTodoExtended() did not assign id/sync_version: %+v", todo)
+		}
+
+		got, err := store.GetTodoByID(todo.ID, userID)
+		if err != nil {
+			t.Fatalf("GetTodoByID() error = %v", err)
+		}
+		if got.Title != todo.Title || got.Priority != PriorityHigh || len(got.Tags) != 2 {
+			t.Errorf("GetTodoByID() = %+v", got)
+		}
+		if got.DueDate == nil || !got.DueDate.Equal(dueDate) {
+			t.Errorf("GetTodoByID().DueDate = %v, want %v", got.DueDate, dueDate)
+		}
+
+		if _, err := store.GetTodoByID(todo.ID, userID+1); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetTodoByID(other user) error = %v, want ErrNotFound", err)
+		}
+
+		got.Completed = true
+		if err := store.UpdateTodoExtended(got); err != nil {
+			t.Fatalf("UpdateTodoExtended() error = %v", err)
+		}
+
+		results, err := store.ListTodos(userID, TodoQuery{Filter: TodoFilter{Search: mustParseSearch(t, "go")}, Limit: 20})
+		if err != nil {
+			t.Fatalf("ListTodos(keyword) error = %v", err)
+		}
+		if len(results) != 1 || !results[0].Completed {
+			t.Errorf("ListTodos(keyword) = %+v", results)
+		}
+
+		todos, err := store.GetTodosSince(userID, 0, math.MaxInt64, -1)
+		if err != nil {
+			t.Fatalf("GetTodosSince() error = %v", err)
+		}
+		if len(todos) != 1 {
+			t.Errorf("GetTodosSince() returned %d todos, want 1", len(todos))
+		}
+
+		if err := store.DeleteTodo(todo.ID, userID); err != nil {
+			t.Fatalf("DeleteTodo() error = %v", err)
+		}
+		if err := store.DeleteTodo(todo.ID, userID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("DeleteTodo(twice) error = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreCategories(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		category := &Category{UserID: userID, Name: "工作", Color: "#FF5722", Icon: "work"}
+		if err := store.CreateCategory(category); err != nil {
+			t.Fatalf("CreateCategory() error = %v", err)
+		}
+
+		duplicate := &Category{UserID: userID, Name: "工作", Color: "#000000", Icon: "work"}
+		if err := store.CreateCategory(duplicate); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("CreateCategory(duplicate) error = %v, want ErrDuplicate", err)
+		}
+
+		if err := store.DeleteCategory(category.ID, userID); err != nil {
+			t.Fatalf("DeleteCategory() error = %v", err)
+		}
+		categories, err := store.GetCategoriesByUserID(userID)
+		if err != nil {
+			t.Fatalf("GetCategoriesByUserID() error = %v", err)
+		}
+		if len(categories) != 0 {
+			t.Errorf("GetCategoriesByUserID() returned deleted category: %+v", categories)
+		}
+
+		tombstones, err := store.GetCategoriesSince(userID, 0, math.MaxInt64, -1)
+		if err != nil {
+			t.Fatalf("GetCategoriesSince() error = %v", err)
+		}
+		if len(tombstones) != 1 || !tombstones[0].IsDeleted {
+			t.Errorf("GetCategoriesSince() = %+v, want one tombstone", tombstones)
+		}
+	})
+}
+
+func TestStoreChecklistItems(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		todo := &Todo{UserID: userID, Title: "发布新版本", Tags: StringSlice{}}
+		if err := store.CreateTodoExtended(todo); err != nil {
+			t.Fatalf("CreateTodoExtended() error = %v", err)
+		}
+
+		var items []*ChecklistItem
+		for _, title := range []string{"更新文档", "打标签", "发布公告"} {
+			item := &ChecklistItem{TodoID: todo.ID, UserID: userID, Title: title}
+			if err := store.CreateChecklistItem(item); err != nil {
+				t.Fatalf("CreateChecklistItem() error = %v", err)
+			}
+			if item.UUID == "" || item.TodoUUID != todo.UUID || item.Position != len(items)+1 {
+				t.Errorf("CreateChecklistItem() = %+v", item)
+			}
+			items = append(items, item)
+		}
+
+		other := &User{Username: "other", Email: "other@example.com", Password: "hashed"}
+		if err := store.CreateUser(other); err != nil {
+			t.Fatalf("CreateUser() error = %v", err)
+		}
+		if err := store.CreateChecklistItem(&ChecklistItem{TodoID: todo.ID, UserID: other.ID, Title: "越权"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("CreateChecklistItem(other user) error = %v, want ErrNotFound", err)
+		}
+
+		items[0].Completed = true
+		if err := store.UpdateChecklistItem(items[0]); err != nil {
+			t.Fatalf("UpdateChecklistItem() error = %v", err)
+		}
+		if err := store.DeleteChecklistItem(items[1].ID, userID); err != nil {
+			t.Fatalf("DeleteChecklistItem() error = %v", err)
+		}
+
+		todos, err := store.GetTodosByUserIDExtended(userID, 10, 0)
+		if err != nil || len(todos) != 1 {
+			t.Fatalf("GetTodosByUserIDExtended() = %+v, %v", todos, err)
+		}
+		if todos[0].ChecklistTotal != 2 || todos[0].ChecklistCompleted != 1 {
+			t.Errorf("checklist progress = %d/%d, want 1/2", todos[0].ChecklistCompleted, todos[0].ChecklistTotal)
+		}
+
+		if _, err := ReorderChecklistItems(store, todo.ID, userID, []int{items[2].ID}); !errors.Is(err, ErrInvalidChecklistOrder) {
+			t.Errorf("ReorderChecklistItems(partial) error = %v, want ErrInvalidChecklistOrder", err)
+		}
+		if _, err := ReorderChecklistItems(store, todo.ID, userID, []int{items[2].ID, items[0].ID}); err != nil {
+			t.Fatalf("ReorderChecklistItems() error = %v", err)
+		}
+		ordered, err := store.GetChecklistItemsByTodoID(todo.ID, userID)
+		if err != nil || len(ordered) != 2 || ordered[0].ID != items[2].ID || ordered[1].ID != items[0].ID || !ordered[1].Completed {
+			t.Errorf("GetChecklistItemsByTodoID() = %+v, %v", ordered, err)
+		}
+
+		changed, err := store.GetChecklistItemsSince(userID, todo.SyncVersion, math.MaxInt64, -1)
+		if err != nil || len(changed) != 3 || !changed[0].IsDeleted {
+			t.Errorf("GetChecklistItemsSince() = %+v, %v; want tombstone first", changed, err)
+		}
+
+		// 物理删除TODO时检查项一并删除
+		if err := store.DeleteTodo(todo.ID, userID); err != nil {
+			t.Fatalf("DeleteTodo() error = %v", err)
+		}
+		if _, err := store.GetChecklistItemByUUID(userID, items[0].UUID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetChecklistItemByUUID() after todo deleted error = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreListTodos(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		work := &Category{UserID: userID, Name: "工作", Color: "#FF5722", Icon: "work"}
+		home := &Category{UserID: userID, Name: "家庭", Color: "#4CAF50", Icon: "home"}
+		for _, category := range []*Category{work, home} {
+			if err := store.CreateCategory(category); err != nil {
+				t.Fatalf("CreateCategory() error = %v", err)
+			}
+		}
+
+		now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+		yesterday, tomorrow := now.AddDate(0, 0, -1), now.AddDate(0, 0, 1)
+		start := time.Now().Add(-time.Second)
+		todos := []*Todo{
+			{Title: "a", Priority: PriorityHigh, CategoryID: &work.ID, Tags: StringSlice{"x", "y"}, DueDate: &yesterday},
+			{Title: "b", Priority: PriorityLow, CategoryID: &home.ID, Tags: StringSlice{"x"}, DueDate: &tomorrow, Reminder: &now},
+			{Title: "c", Priority: PriorityUrgent, Tags: StringSlice{"y"}, DueDate: &yesterday, Completed: true},
+			{Title: "d", Priority: PriorityHigh},
+		}
+		for _, todo := range todos {
+			todo.UserID = userID
+			if err := store.CreateTodoExtended(todo); err != nil {
+				t.Fatalf("CreateTodoExtended() error = %v", err)
+			}
+		}
+		end := time.Now().Add(time.Second)
+
+		yes, no := true, false
+		tests := []struct {
+			name  string
+			query TodoQuery
+			want  string
+		}{
+			{"default sort", TodoQuery{}, "dcba"},
+			{"completed", TodoQuery{Filter: TodoFilter{Completed: &no}}, "dba"},
+			{"priorities", TodoQuery{Filter: TodoFilter{Priorities: []Priority{PriorityHigh, PriorityUrgent}}}, "dca"},
+			{"categories", TodoQuery{Filter: TodoFilter{CategoryIDs: []int{work.ID, home.ID}}}, "ba"},
+			{"uncategorized", TodoQuery{Filter: TodoFilter{CategoryIDs: []int{home.ID}, Uncategorized: true}}, "dcb"},
+			{"any tag", TodoQuery{Filter: TodoFilter{Tags: []string{"x", "y"}}}, "cba"},
+			{"all tags", TodoQuery{Filter: TodoFilter{Tags: []string{"x", "y"}, TagMatch: TagMatchAll}}, "a"},
+			{"due range", TodoQuery{Filter: TodoFilter{DueAfter: &now}}, "b"},
+			{"overdue", TodoQuery{Filter: TodoFilter{Overdue: true, Now: now}}, "a"},
+			{"has reminder", TodoQuery{Filter: TodoFilter{HasReminder: &yes}}, "b"},
+			{"no reminder", TodoQuery{Filter: TodoFilter{HasReminder: &no}}, "dca"},
+			{"created range", TodoQuery{Filter: TodoFilter{CreatedAfter: &start, CreatedBefore: &end}}, "dcba"},
+			{"updated after", TodoQuery{Filter: TodoFilter{UpdatedAfter: &end}}, ""},
+			{"priority then title", TodoQuery{Sort: []TodoSort{{Field: SortPriority, Desc: true}, {Field: SortTitle}}}, "cadb"},
+			{"due date nulls last", TodoQuery{Sort: []TodoSort{{Field: SortDueDate, Desc: true}, {Field: SortTitle}}}, "bacd"},
+			{"pagination", TodoQuery{Sort: []TodoSort{{Field: SortTitle}}, Limit: 2, Offset: 1}, "bc"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if tt.query.Limit == 0 {
+					tt.query.Limit = 10
+				}
+				got, err := store.ListTodos(userID, tt.query)
+				if err != nil {
+					t.Fatalf("ListTodos() error = %v", err)
+				}
+				var titles string
+				for _, todo := range got {
+					titles += todo.Title
+				}
+				if titles != tt.want {
+					t.Errorf("ListTodos() = %q, want %q", titles, tt.want)
+				}
+			})
+		}
+
+		if _, err := store.ListTodos(userID, TodoQuery{Sort: []TodoSort{{Field: "id; DROP TABLE todos"}}}); !errors.Is(err, ErrInvalidSort) {
+			t.Errorf("ListTodos(invalid sort) error = %v, want ErrInvalidSort", err)
+		}
+	})
+}
+
+func TestStoreListTodosKeyset(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		due := time.Date(2026, 10, 16, 18, 0, 0, 0, time.UTC)
+		for i := 0; i < 7; i++ {
+			todo := &Todo{UserID: userID, Title: string(rune('a' + i%3)), Priority: Priority(i % 2)}
+			if i%3 != 0 {
+				dueDate := due.AddDate(0, 0, i%2)
+				todo.DueDate = &dueDate
+			}
+			if err := store.CreateTodoExtended(todo); err != nil {
+				t.Fatalf("CreateTodoExtended() error = %v", err)
+			}
+		}
+
+		sorts := [][]TodoSort{
+			nil,
+			{{Field: SortPriority, Desc: true}, {Field: SortTitle}},
+			{{Field: SortDueDate}, {Field: SortCreatedAt, Desc: true}},
+			{{Field: SortDueDate, Desc: true}},
+			{{Field: SortTitle, Desc: true}, {Field: SortUpdatedAt}},
+		}
+		for _, sort := range sorts {
+			all, err := store.ListTodos(userID, TodoQuery{Sort: sort, Limit: 100})
+			if err != nil || len(all) != 7 {
+				t.Fatalf("ListTodos(%v) = %d, %v", sort, len(all), err)
+			}
+
+			// 每页两条，逐页以上一页最后一条作为位置，结果应与一次性查询一致
+			var paged []Todo
+			query := TodoQuery{Sort: sort, Limit: 2}
+			for {
+				page, err := store.ListTodos(userID, query)
+				if err != nil {
+					t.Fatalf("ListTodos(after) error = %v", err)
+				}
+				if len(page) == 0 {
+					break
+				}
+				paged = append(paged, page...)
+				key := KeyOf(&page[len(page)-1])
+				query.After = &key
+			}
+			if len(paged) != len(all) {
+				t.Fatalf("sort %v: paged %d todos, want %d", sort, len(paged), len(all))
+			}
+			for i := range all {
+				if paged[i].ID != all[i].ID {
+					t.Errorf("sort %v: page order differs at %d: %d != %d", sort, i, paged[i].ID, all[i].ID)
+				}
+			}
+		}
+
+		count, err := store.CountTodos(userID, TodoFilter{Priorities: []Priority{PriorityMedium}})
+		if err != nil || count != 3 {
+			t.Errorf("CountTodos() = %d, %v; want 3", count, err)
+		}
+	})
+}
+
+func TestStoreUserSettings(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		settings, err := store.GetUserSettings(userID)
+		if err != nil {
+			t.Fatalf("GetUserSettings() error = %v", err)
+		}
+		if settings.Theme != "light" || settings.TimeZone != "Asia/Shanghai" {
+			t.Errorf("GetUserSettings() defaults = %+v", settings)
+		}
+
+		settings.Theme = "dark"
+		if err := store.UpdateUserSettings(settings); err != nil {
+			t.Fatalf("UpdateUserSettings() error = %v", err)
+		}
+
+		version, err := store.GetCurrentSyncVersion(userID)
+		if err != nil {
+			t.Fatalf("GetCurrentSyncVersion() error = %v", err)
+		}
+		if version != settings.SyncVersion {
+			t.Errorf("GetCurrentSyncVersion() = %d, want %d", version, settings.SyncVersion)
+		}
+
+		changed, err := store.GetUserSettingsSince(userID, version-1, version)
+		if err != nil {
+			t.Fatalf("GetUserSettingsSince() error = %v", err)
+		}
+		if changed == nil || changed.Theme != "dark" {
+			t.Errorf("GetUserSettingsSince() = %+v", changed)
+		}
+	})
+}
+
+func TestStoreRefreshTokens(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		now := time.Now()
+		token := &RefreshToken{
+			UserID:    userID,
+			SessionID: "session-1",
+			TokenHash: "hash-1",
+			ExpiresAt: now.Add(time.Hour),
+			CreatedAt: now,
+		}
+		if err := store.CreateRefreshToken(token); err != nil {
+			t.Fatalf("CreateRefreshToken() error = %v", err)
+		}
+
+		active, err := store.IsSessionActive(userID, "session-1", now)
+		if err != nil || !active {
+			t.Fatalf("IsSessionActive() = %v, %v, want true", active, err)
+		}
+		if active, _ := store.IsSessionActive(userID, "session-1", now.Add(2*time.Hour)); active {
+			t.Errorf("IsSessionActive(after expiry) = true, want false")
+		}
+
+		got, err := store.GetRefreshTokenByHash("hash-1")
+		if err != nil || got.ID != token.ID {
+			t.Fatalf("GetRefreshTokenByHash() = %+v, %v", got, err)
+		}
+
+		claimed, err := store.MarkRefreshTokenUsed(token.ID, now)
+		if err != nil || !claimed {
+			t.Fatalf("MarkRefreshTokenUsed() = %v, %v, want true", claimed, err)
+		}
+		if claimed, _ := store.MarkRefreshTokenUsed(token.ID, now); claimed {
+			t.Errorf("MarkRefreshTokenUsed(twice) = true, want false")
+		}
+
+		rotated := &RefreshToken{UserID: userID, SessionID: "session-1", TokenHash: "hash-2",
+			ExpiresAt: now.Add(time.Hour), CreatedAt: now}
+		if err := store.CreateRefreshToken(rotated); err != nil {
+			t.Fatalf("CreateRefreshToken(rotated) error = %v", err)
+		}
+		if err := store.RevokeAllSessions(userID, now); err != nil {
+			t.Fatalf("RevokeAllSessions() error = %v", err)
+		}
+		if active, _ := store.IsSessionActive(userID, "session-1", now); active {
+			t.Errorf("IsSessionActive(after revoke) = true, want false")
+		}
+	})
+}
+
+func TestStoreDevices(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		now := time.Now()
+		device := &Device{ID: "device-1", UserID: userID, Name: "iPhone", Platform: "ios",
+			SessionID: "session-1", CreatedAt: now, UpdatedAt: now}
+		if err := store.CreateDevice(device); err != nil {
+			t.Fatalf("CreateDevice() error = %v", err)
+		}
+		if err := store.CreateDevice(device); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("CreateDevice(duplicate) error = %v, want ErrDuplicate", err)
+		}
+
+		got, err := store.GetDeviceBySessionID(userID, "session-1")
+		if err != nil || got.ID != "device-1" {
+			t.Fatalf("GetDeviceBySessionID() = %+v, %v", got, err)
+		}
+		if _, err := store.GetDeviceByID("device-1", userID+1); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetDeviceByID(other user) error = %v, want ErrNotFound", err)
+		}
+
+		if err := store.AckDeviceSyncVersion("device-1", userID, 200, now); err != nil {
+			t.Fatalf("AckDeviceSyncVersion() error = %v", err)
+		}
+		// 确认的版本号只会前进
+		if err := store.AckDeviceSyncVersion("device-1", userID, 100, now); err != nil {
+			t.Fatalf("AckDeviceSyncVersion(older) error = %v", err)
+		}
+		got, _ = store.GetDeviceByID("device-1", userID)
+		if got.LastSyncVersion != 200 || got.LastSyncedAt == nil {
+			t.Errorf("after ack device = %+v, want last_sync_version 200", got)
+		}
+
+		got.Name = "Apple Watch"
+		got.RevokedAt = &now
+		if err := store.UpdateDevice(got); err != nil {
+			t.Fatalf("UpdateDevice() error = %v", err)
+		}
+		devices, err := store.GetDevicesByUserID(userID)
+		if err != nil || len(devices) != 1 || devices[0].Name != "Apple Watch" || devices[0].RevokedAt == nil {
+			t.Errorf("GetDevicesByUserID() = %+v, %v", devices, err)
+		}
+		if err := store.AckDeviceSyncVersion("device-1", userID, 300, now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("AckDeviceSyncVersion(revoked) error = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreSyncVersions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		// 同一毫秒内的多次写入也必须得到严格递增的版本号
+		var last int64
+		for i := 0; i < 5; i++ {
+			todo := &Todo{UserID: userID, Title: "任务", Tags: StringSlice{}}
+			if err := store.CreateTodoExtended(todo); err != nil {
+				t.Fatalf("CreateTodoExtended() error = %v", err)
+			}
+			if todo.SyncVersion <= last {
+				t.Fatalf("sync_version %d not greater than previous %d", todo.SyncVersion, last)
+			}
+			last = todo.SyncVersion
+		}
+
+		category := &Category{UserID: userID, Name: "工作"}
+		if err := store.CreateCategory(category); err != nil {
+			t.Fatalf("CreateCategory() error = %v", err)
+		}
+		if category.SyncVersion != last+1 {
+			t.Errorf("category sync_version = %d, want %d", category.SyncVersion, last+1)
+		}
+
+		// 失败的写入不消耗版本号
+		if err := store.UpdateTodoExtended(&Todo{ID: 999, UserID: userID}); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("UpdateTodoExtended(missing) error = %v, want ErrNotFound", err)
+		}
+		version, err := store.GetCurrentSyncVersion(userID)
+		if err != nil || version != category.SyncVersion {
+			t.Errorf("GetCurrentSyncVersion() = %d, %v, want %d", version, err, category.SyncVersion)
+		}
+
+		todos, err := store.GetTodosSince(userID, last-1, last, -1)
+		if err != nil || len(todos) != 1 || todos[0].SyncVersion != last {
+			t.Errorf("GetTodosSince(%d) = %+v, %v", last-1, todos, err)
+		}
+	})
+}
+
+func TestSQLiteSyncVersionContinuesFromExistingData(t *testing.T) {
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "todo.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	user := &User{Username: "legacy", Email: "legacy@example.com", Password: "hashed"}
+	if err := store.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	// 升级前写入的数据使用毫秒时间戳作为版本号
+	const legacyVersion = 1640995200000
+	if _, err := store.DB().Exec(`INSERT INTO todos (user_id, title, tags, sync_version) VALUES (?, '旧任务', '[]', ?)`,
+		user.ID, legacyVersion); err != nil {
+		t.Fatalf("insert legacy todo: %v", err)
+	}
+
+	todo := &Todo{UserID: user.ID, Title: "新任务", Tags: StringSlice{}}
+	if err := store.CreateTodoExtended(todo); err != nil {
+		t.Fatalf("CreateTodoExtended() error = %v", err)
+	}
+	if todo.SyncVersion != legacyVersion+1 {
+		t.Errorf("sync_version = %d, want %d", todo.SyncVersion, legacyVersion+1)
+	}
+}
+
+func TestSQLiteUpgradeBackfillsUUIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todo.db")
+	store, err := OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	user := &User{Username: "legacy", Email: "legacy@example.com", Password: "hashed"}
+	if err := store.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	// 模拟升级前的表结构：删除 uuid 列后写入数据
+	for _, statement := range []string{
+		"DROP INDEX idx_todos_user_id_uuid",
+		"ALTER TABLE todos DROP COLUMN uuid",
+	} {
+		if _, err := store.DB().Exec(statement); err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+	if _, err := store.DB().Exec(`INSERT INTO todos (user_id, title, description, tags) VALUES (?, '旧任务', '', '[]')`, user.ID); err != nil {
+		t.Fatalf("insert legacy todo: %v", err)
+	}
+	store.Close()
+
+	store, err = OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore(upgrade) error = %v", err)
+	}
+	defer store.Close()
+
+	todos, err := store.GetTodosByUserIDExtended(user.ID, 20, 0)
+	if err != nil {
+		t.Fatalf("GetTodosByUserIDExtended() error = %v", err)
+	}
+	if len(todos) != 1 || todos[0].UUID == "" {
+		t.Errorf("legacy todos after upgrade = %+v", todos)
+	}
+
+	// 升级前写入的TODO补建全文索引
+	results, err := store.ListTodos(user.ID, TodoQuery{Filter: TodoFilter{Search: mustParseSearch(t, "任务")}, Limit: 20})
+	if err != nil || len(results) != 1 {
+		t.Errorf("search legacy todos = %+v, %v", results, err)
+	}
+}
+
+func TestGetChangesSince(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		// 交错写入三类数据：todo(1) category(2) todo(3) settings(4) category(5) todo(6)
+		newTodo := func() {
+			if err := store.CreateTodoExtended(&Todo{UserID: userID, Title: "任务", Tags: StringSlice{}}); err != nil {
+				t.Fatalf("CreateTodoExtended() error = %v", err)
+			}
+		}
+		newTodo()
+		if err := store.CreateCategory(&Category{UserID: userID, Name: "工作"}); err != nil {
+			t.Fatalf("CreateCategory() error = %v", err)
+		}
+		newTodo()
+		if _, err := store.GetUserSettings(userID); err != nil {
+			t.Fatalf("GetUserSettings() error = %v", err)
+		}
+		if err := store.CreateCategory(&Category{UserID: userID, Name: "个人"}); err != nil {
+			t.Fatalf("CreateCategory() error = %v", err)
+		}
+		newTodo()
+
+		until, _ := store.GetCurrentSyncVersion(userID)
+		// 分页期间的新写入不属于本轮同步
+		newTodo()
+
+		var pages [][3]int
+		var since int64
+		for {
+			changes, err := GetChangesSince(store, userID, since, until, 4)
+			if err != nil {
+				t.Fatalf("GetChangesSince() error = %v", err)
+			}
+			settings := 0
+			if changes.Settings != nil {
+				settings = 1
+			}
+			pages = append(pages, [3]int{len(changes.Todos), len(changes.Categories), settings})
+			since = changes.LastVersion
+			if !changes.HasMore {
+				break
+			}
+		}
+
+		want := [][3]int{{2, 1, 1}, {1, 1, 0}}
+		if len(pages) != len(want) || pages[0] != want[0] || pages[1] != want[1] {
+			t.Errorf("pages = %v, want %v", pages, want)
+		}
+		if since != until {
+			t.Errorf("last version = %d, want %d", since, until)
+		}
+	})
+}
+
+func TestStoreWithTx(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		errAbort := errors.New("abort")
+
+		err := store.WithTx(func(tx Store) error {
+			if err := tx.CreateTodoExtended(&Todo{UserID: userID, Title: "回滚"}); err != nil {
+				t.Fatalf("CreateTodoExtended() error = %v", err)
+			}
+			return errAbort
+		})
+		if !errors.Is(err, errAbort) {
+			t.Fatalf("WithTx() error = %v, want errAbort", err)
+		}
+		if version, _ := store.GetCurrentSyncVersion(userID); version != 0 {
+			t.Errorf("GetCurrentSyncVersion() after rollback = %d, want 0", version)
+		}
+
+		// 嵌套调用只回滚保存点内的写入
+		err = store.WithTx(func(tx Store) error {
+			if err := tx.CreateTodoExtended(&Todo{UserID: userID, Title: "保留"}); err != nil {
+				return err
+			}
+			inner := tx.WithTx(func(tx Store) error {
+				if err := tx.CreateTodoExtended(&Todo{UserID: userID, Title: "撤销"}); err != nil {
+					return err
+				}
+				return errAbort
+			})
+			if !errors.Is(inner, errAbort) {
+				t.Errorf("nested WithTx() error = %v, want errAbort", inner)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("WithTx() error = %v", err)
+		}
+
+		todos, err := store.GetTodosByUserIDExtended(userID, 20, 0)
+		if err != nil {
+			t.Fatalf("GetTodosByUserIDExtended() error = %v", err)
+		}
+		if len(todos) != 1 || todos[0].Title != "保留" {
+			t.Errorf("todos after savepoint rollback = %+v", todos)
+		}
+	})
+}
+
+func TestStoreIdempotencyKeys(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		key := &IdempotencyKey{
+			UserID:       userID,
+			Key:          "0b8f5c1e-3f0a-4c1d-9a5e-6d2b7c8e9f10",
+			ResourceType: SyncTypeTodo,
+			ResourceID:   7,
+			CreatedAt:    time.Now(),
+		}
+		if err := store.CreateIdempotencyKey(key); err != nil {
+			t.Fatalf("CreateIdempotencyKey() error = %v", err)
+		}
+		if err := store.CreateIdempotencyKey(key); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("CreateIdempotencyKey(duplicate) error = %v, want ErrDuplicate", err)
+		}
+
+		got, err := store.GetIdempotencyKey(userID, key.Key)
+		if err != nil {
+			t.Fatalf("GetIdempotencyKey() error = %v", err)
+		}
+		if got.ResourceType != SyncTypeTodo || got.ResourceID != 7 {
+			t.Errorf("GetIdempotencyKey() = %+v", got)
+		}
+		if _, err := store.GetIdempotencyKey(userID+1, key.Key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetIdempotencyKey(other user) error = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreUUIDs(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		category := &Category{UserID: userID, Name: "工作", UUID: "3b241101-e2bb-4255-8caf-4136c566a962"}
+		if err := store.CreateCategory(category); err != nil {
+			t.Fatalf("CreateCategory() error = %v", err)
+		}
+		todo := &Todo{UserID: userID, Title: "写周报", CategoryID: &category.ID}
+		if err := store.CreateTodoExtended(todo); err != nil {
+			t.Fatalf("CreateTodoExtended() error = %v", err)
+		}
+		if todo.UUID == "" {
+			t.Fatalf("CreateTodoExtended() did not assign uuid")
+		}
+
+		got, err := store.GetTodoByUUID(userID, todo.UUID)
+		if err != nil {
+			t.Fatalf("GetTodoByUUID() error = %v", err)
+		}
+		if got.ID != todo.ID || got.CategoryUUID == nil || *got.CategoryUUID != category.UUID {
+			t.Errorf("GetTodoByUUID() = %+v", got)
+		}
+		if _, err := store.GetCategoryByUUID(userID+1, category.UUID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetCategoryByUUID(other user) error = %v, want ErrNotFound", err)
+		}
+
+		duplicate := &Todo{UserID: userID, Title: "重复", UUID: todo.UUID}
+		if err := store.CreateTodoExtended(duplicate); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("CreateTodoExtended(duplicate uuid) error = %v, want ErrDuplicate", err)
+		}
+	})
+}
+
+func TestStoreChangeFeed(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		events, cancel := store.SubscribeChanges(userID)
+		defer cancel()
+
+		todo := &Todo{UserID: userID, Title: "推送"}
+		if err := store.CreateTodoExtended(todo); err != nil {
+			t.Fatalf("CreateTodoExtended() error = %v", err)
+		}
+		event := <-events
+		want := ChangedEntity{Type: SyncTypeTodo, ID: todo.ID, UUID: todo.UUID}
+		if event.SyncVersion != todo.SyncVersion || len(event.Entities) != 1 || event.Entities[0] != want {
+			t.Errorf("change event = %+v, want version %d and %+v", event, todo.SyncVersion, want)
+		}
+
+		// 回滚的写入不发布，同一事务内的写入合并为一条通知
+		store.WithTx(func(tx Store) error {
+			tx.CreateTodoExtended(&Todo{UserID: userID, Title: "回滚"})
+			return errors.New("abort")
+		})
+		category := &Category{UserID: userID, Name: "工作"}
+		err := store.WithTx(func(tx Store) error {
+			if err := tx.CreateCategory(category); err != nil {
+				return err
+			}
+			tx.WithTx(func(tx Store) error {
+				tx.CreateTodoExtended(&Todo{UserID: userID, Title: "撤销"})
+				return errors.New("abort")
+			})
+			todo.Title = "推送（已修改）"
+			return tx.UpdateTodoExtended(todo)
+		})
+		if err != nil {
+			t.Fatalf("WithTx() error = %v", err)
+		}
+		event = <-events
+		if event.SyncVersion != todo.SyncVersion || len(event.Entities) != 2 ||
+			event.Entities[0].ID != category.ID || event.Entities[1].ID != todo.ID {
+			t.Errorf("transaction change event = %+v", event)
+		}
+
+		select {
+		case event := <-events:
+			t.Errorf("unexpected change event = %+v", event)
+		default:
+		}
+	})
+}
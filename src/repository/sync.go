@@ -1,32 +1,182 @@
 package repository
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
 // ===== 数据同步相关类型 =====
 
 // TodoSyncItem TODO同步项
 type TodoSyncItem struct {
-	ID          int      `json:"id,omitempty"`
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	Completed   bool     `json:"completed"`
-	Priority    int      `json:"priority"`
-	DueDate     *string  `json:"due_date,omitempty"`
-	Tags        []string `json:"tags"`
-	CategoryID  *int     `json:"category_id,omitempty"`
-	Reminder    *string  `json:"reminder,omitempty"`
-	IsDeleted   bool     `json:"is_deleted"`
-	SyncVersion int64    `json:"sync_version"`
-	UpdatedAt   string   `json:"updated_at"`
+	ID           int      `json:"id,omitempty"`
+	UUID         string   `json:"uuid,omitempty"` // 客户端生成的UUID，服务器上不存在时按该UUID创建
+	Title        string   `json:"title"`
+	Description  string   `json:"description"`
+	Completed    bool     `json:"completed"`
+	Priority     int      `json:"priority"`
+	DueDate      *string  `json:"due_date,omitempty"`
+	Tags         []string `json:"tags"`
+	CategoryID   *int     `json:"category_id,omitempty"`
+	CategoryUUID *string  `json:"category_uuid,omitempty"` // 分类UUID，提供时优先于 category_id，可引用同一批次中新建的分类
+	Reminder     *string  `json:"reminder,omitempty"`
+	Recurrence   *string  `json:"recurrence,omitempty"` // 重复规则(RRULE)，未提供时保持不变，空字符串表示取消重复
+	IsDeleted    bool     `json:"is_deleted"`
+	SyncVersion  int64    `json:"sync_version"`
+	BaseVersion  int64    `json:"base_version,omitempty"` // 客户端开始编辑时的服务器版本号，为空时使用 sync_version
+	UpdatedAt    string   `json:"updated_at"`
+
+	IdempotencyKey string `json:"idempotency_key,omitempty"` // 创建时客户端生成的UUID，重试同一请求不会重复创建
+}
+
+// NewTodoSyncItem 将TODO转换为同步格式
+func NewTodoSyncItem(todo *Todo) TodoSyncItem {
+	item := TodoSyncItem{
+		ID:           todo.ID,
+		UUID:         todo.UUID,
+		Title:        todo.Title,
+		Description:  todo.Description,
+		Completed:    todo.Completed,
+		Priority:     int(todo.Priority),
+		Tags:         []string(todo.Tags),
+		CategoryID:   todo.CategoryID,
+		CategoryUUID: todo.CategoryUUID,
+		Recurrence:   todo.Recurrence,
+		IsDeleted:    todo.IsDeleted,
+		SyncVersion:  todo.SyncVersion,
+		UpdatedAt:    todo.UpdatedAt.Format(time.RFC3339),
+	}
+	if todo.DueDate != nil {
+		dueDateStr := todo.DueDate.Format(time.RFC3339)
+		item.DueDate = &dueDateStr
+	}
+	if todo.Reminder != nil {
+		reminderStr := todo.Reminder.Format(time.RFC3339)
+		item.Reminder = &reminderStr
+	}
+	return item
 }
 
 // CategorySyncItem 分类同步项
 type CategorySyncItem struct {
 	ID          int    `json:"id,omitempty"`
+	UUID        string `json:"uuid,omitempty"` // 客户端生成的UUID，服务器上不存在时按该UUID创建
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Icon        string `json:"icon"`
+	IsDeleted   bool   `json:"is_deleted"`
+	SyncVersion int64  `json:"sync_version"`
+	UpdatedAt   string `json:"updated_at"`
+
+	IdempotencyKey string `json:"idempotency_key,omitempty"` // 创建时客户端生成的UUID，重试同一请求不会重复创建
+}
+
+// NewCategorySyncItem 将分类转换为同步格式
+func NewCategorySyncItem(category *Category) CategorySyncItem {
+	return CategorySyncItem{
+		ID:          category.ID,
+		UUID:        category.UUID,
+		Name:        category.Name,
+		Color:       category.Color,
+		Icon:        category.Icon,
+		IsDeleted:   category.IsDeleted,
+		SyncVersion: category.SyncVersion,
+		UpdatedAt:   category.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// ChecklistItemSyncItem 检查项同步项
+type ChecklistItemSyncItem struct {
+	ID          int    `json:"id,omitempty"`
+	UUID        string `json:"uuid,omitempty"` // 客户端生成的UUID，服务器上不存在时按该UUID创建
+	TodoID      int    `json:"todo_id,omitempty"`
+	TodoUUID    string `json:"todo_uuid,omitempty"` // 所属TODO的UUID，提供时优先于 todo_id，可引用同一批次中新建的TODO
+	Title       string `json:"title"`
+	Completed   bool   `json:"completed"`
+	Position    int    `json:"position"` // 创建时为0表示排在最后
+	IsDeleted   bool   `json:"is_deleted"`
+	SyncVersion int64  `json:"sync_version"`
+	UpdatedAt   string `json:"updated_at"`
+
+	IdempotencyKey string `json:"idempotency_key,omitempty"` // 创建时客户端生成的UUID，重试同一请求不会重复创建
+}
+
+// NewChecklistItemSyncItem 将检查项转换为同步格式
+func NewChecklistItemSyncItem(item *ChecklistItem) ChecklistItemSyncItem {
+	return ChecklistItemSyncItem{
+		ID:          item.ID,
+		UUID:        item.UUID,
+		TodoID:      item.TodoID,
+		TodoUUID:    item.TodoUUID,
+		Title:       item.Title,
+		Completed:   item.Completed,
+		Position:    item.Position,
+		IsDeleted:   item.IsDeleted,
+		SyncVersion: item.SyncVersion,
+		UpdatedAt:   item.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// TagSyncItem 标签同步项，只同步标签元数据，TODO中的标签随TODO同步
+type TagSyncItem struct {
+	ID          int    `json:"id,omitempty"`
+	UUID        string `json:"uuid,omitempty"` // 客户端生成的UUID，服务器上不存在时按该UUID创建
 	Name        string `json:"name"`
 	Color       string `json:"color"`
 	Icon        string `json:"icon"`
 	IsDeleted   bool   `json:"is_deleted"`
 	SyncVersion int64  `json:"sync_version"`
 	UpdatedAt   string `json:"updated_at"`
+
+	IdempotencyKey string `json:"idempotency_key,omitempty"` // 创建时客户端生成的UUID，重试同一请求不会重复创建
+}
+
+// NewTagSyncItem 将标签转换为同步格式
+func NewTagSyncItem(tag *Tag) TagSyncItem {
+	return TagSyncItem{
+		ID:          tag.ID,
+		UUID:        tag.UUID,
+		Name:        tag.Name,
+		Color:       tag.Color,
+		Icon:        tag.Icon,
+		IsDeleted:   tag.IsDeleted,
+		SyncVersion: tag.SyncVersion,
+		UpdatedAt:   tag.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// SmartListSyncItem 智能列表同步项
+type SmartListSyncItem struct {
+	ID          int                 `json:"id,omitempty"`
+	UUID        string              `json:"uuid,omitempty"` // 客户端生成的UUID，服务器上不存在时按该UUID创建
+	Name        string              `json:"name"`
+	Icon        string              `json:"icon"`
+	Color       string              `json:"color"`
+	Definition  SmartListDefinition `json:"definition"`
+	IsDeleted   bool                `json:"is_deleted"`
+	SyncVersion int64               `json:"sync_version"`
+	UpdatedAt   string              `json:"updated_at"`
+
+	IdempotencyKey string `json:"idempotency_key,omitempty"` // 创建时客户端生成的UUID，重试同一请求不会重复创建
+}
+
+// NewSmartListSyncItem 将智能列表转换为同步格式
+func NewSmartListSyncItem(list *SmartList) SmartListSyncItem {
+	return SmartListSyncItem{
+		ID:          list.ID,
+		UUID:        list.UUID,
+		Name:        list.Name,
+		Icon:        list.Icon,
+		Color:       list.Color,
+		Definition:  list.Definition,
+		IsDeleted:   list.IsDeleted,
+		SyncVersion: list.SyncVersion,
+		UpdatedAt:   list.UpdatedAt.Format(time.RFC3339),
+	}
 }
 
 // UserSettingsSyncItem 用户设置同步项
@@ -35,6 +185,7 @@ type UserSettingsSyncItem struct {
 	NotificationTime string `json:"notification_time"`
 	Language         string `json:"language"`
 	TimeZone         string `json:"timezone"`
+	DailyDigest      *bool  `json:"daily_digest,omitempty"` // 是否接收每日摘要，旧版本客户端不提交时保持不变
 	SyncVersion      int64  `json:"sync_version"`
 	UpdatedAt        string `json:"updated_at"`
 }
@@ -44,7 +195,1146 @@ type SyncResult struct {
 	Type        string `json:"type"`
 	LocalID     int    `json:"local_id,omitempty"`
 	ServerID    int    `json:"server_id,omitempty"`
+	UUID        string `json:"uuid,omitempty"`
 	Action      string `json:"action"`
 	Message     string `json:"message,omitempty"`
 	SyncVersion int64  `json:"sync_version,omitempty"`
+
+	// 以下字段仅在TODO发生冲突时返回
+	Server         *TodoSyncItem `json:"server,omitempty"`          // 服务器当前数据
+	Merged         *TodoSyncItem `json:"merged,omitempty"`          // 三方合并结果，冲突字段取服务器的值
+	ConflictFields []string      `json:"conflict_fields,omitempty"` // 双方都修改且取值不同的字段
+
+	Next *TodoSyncItem `json:"next,omitempty"` // 完成重复TODO时服务器生成的下一次实例
+}
+
+// ChangeSource 增量同步读取的数据来源
+type ChangeSource interface {
+	TodoStore
+	CategoryStore
+	ChecklistStore
+	TagStore
+	SmartListStore
+	UserSettingsStore
+}
+
+// ChangeSet 一页增量变更，TODO、分类、检查项、标签、智能列表和用户设置共用同一个版本号序列
+type ChangeSet struct {
+	Todos          []Todo
+	Categories     []Category
+	ChecklistItems []ChecklistItem
+	Tags           []Tag
+	SmartLists     []SmartList
+	Settings       *UserSettings
+	LastVersion    int64 // 本页最后一条变更的版本号，本页为空时等于 since
+	HasMore        bool  // (LastVersion, until] 区间内是否还有变更
+}
+
+// GetChangesSince 按版本号顺序获取 (since, until] 区间内最多 limit 条变更（limit < 0 表示不限制）。
+// 同一用户的版本号在各类数据间唯一，因此跨类型的顺序稳定，可以用 LastVersion 作为下一页的 since
+func GetChangesSince(r ChangeSource, userID int, since, until int64, limit int) (*ChangeSet, error) {
+	// 每类多取一条，用于判断合并后是否还有下一页
+	fetch := limit
+	if limit >= 0 {
+		fetch = limit + 1
+	}
+
+	todos, err := r.GetTodosSince(userID, since, until, fetch)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := r.GetCategoriesSince(userID, since, until, fetch)
+	if err != nil {
+		return nil, err
+	}
+	items, err := r.GetChecklistItemsSince(userID, since, until, fetch)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := r.GetTagsSince(userID, since, until, fetch)
+	if err != nil {
+		return nil, err
+	}
+	lists, err := r.GetSmartListsSince(userID, since, until, fetch)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := r.GetUserSettingsSince(userID, since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]int64, 0, len(todos)+len(categories)+len(items)+len(tags)+len(lists)+1)
+	for _, todo := range todos {
+		versions = append(versions, todo.SyncVersion)
+	}
+	for _, category := range categories {
+		versions = append(versions, category.SyncVersion)
+	}
+	for _, item := range items {
+		versions = append(versions, item.SyncVersion)
+	}
+	for _, tag := range tags {
+		versions = append(versions, tag.SyncVersion)
+	}
+	for _, list := range lists {
+		versions = append(versions, list.SyncVersion)
+	}
+	if settings != nil {
+		versions = append(versions, settings.SyncVersion)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	changes := &ChangeSet{LastVersion: since}
+	if limit >= 0 && len(versions) > limit {
+		changes.HasMore = true
+		versions = versions[:limit]
+	}
+	if len(versions) == 0 {
+		return changes, nil
+	}
+	changes.LastVersion = versions[len(versions)-1]
+
+	// 只保留版本号不超过本页最后一条的变更
+	for _, todo := range todos {
+		if todo.SyncVersion <= changes.LastVersion {
+			changes.Todos = append(changes.Todos, todo)
+		}
+	}
+	for _, category := range categories {
+		if category.SyncVersion <= changes.LastVersion {
+			changes.Categories = append(changes.Categories, category)
+		}
+	}
+	for _, item := range items {
+		if item.SyncVersion <= changes.LastVersion {
+			changes.ChecklistItems = append(changes.ChecklistItems, item)
+		}
+	}
+	for _, tag := range tags {
+		if tag.SyncVersion <= changes.LastVersion {
+			changes.Tags = append(changes.Tags, tag)
+		}
+	}
+	for _, list := range lists {
+		if list.SyncVersion <= changes.LastVersion {
+			changes.SmartLists = append(changes.SmartLists, list)
+		}
+	}
+	if settings != nil && settings.SyncVersion <= changes.LastVersion {
+		changes.Settings = settings
+	}
+	return changes, nil
+}
+
+// 批量同步中的数据类型，同时用作幂等键记录的数据类型
+const (
+	SyncTypeTodo          = "todo"
+	SyncTypeCategory      = "category"
+	SyncTypeChecklistItem = "checklist_item"
+	SyncTypeTag           = "tag"
+	SyncTypeSmartList     = "smart_list"
+	SyncTypeSettings      = "settings"
+)
+
+// errSyncItemFailed 同步项处理失败，用于回滚该项的保存点
+var errSyncItemFailed = errors.New("sync item failed")
+
+// syncItem 在保存点中处理单个同步项，处理失败时撤销该项的全部写入，不影响同批次的其他项
+func syncItem(r Store, fn func(tx Store) SyncResult) SyncResult {
+	var result SyncResult
+	err := r.WithTx(func(tx Store) error {
+		result = fn(tx)
+		if result.Action == "error" {
+			return errSyncItemFailed
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errSyncItemFailed) {
+		result.Action = "error"
+		result.Message = err.Error()
+	}
+	return result
+}
+
+// lookupIdempotencyKey 查找创建请求携带的幂等键，返回首次请求创建的数据ID，未使用过时返回0
+func lookupIdempotencyKey(r IdempotencyStore, userID int, key, resourceType string) (int, error) {
+	if _, err := uuid.Parse(key); err != nil {
+		return 0, fmt.Errorf("invalid idempotency key: %s", key)
+	}
+	existing, err := r.GetIdempotencyKey(userID, key)
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if existing.ResourceType != resourceType {
+		return 0, fmt.Errorf("%w: idempotency key already used by %s", ErrDuplicate, existing.ResourceType)
+	}
+	return existing.ResourceID, nil
+}
+
+// BatchCreateOrUpdateTodos 批量创建或更新TODO，服务器数据在客户端编辑后被修改过时按 policy 解决冲突。
+// 每项在独立的保存点中处理；携带幂等键的创建请求重试时返回首次创建的TODO
+func BatchCreateOrUpdateTodos(r Store, userID int, todos []TodoSyncItem, policy ConflictPolicy) ([]SyncResult, error) {
+	var results []SyncResult
+
+	for _, todoItem := range todos {
+		result := syncItem(r, func(tx Store) SyncResult {
+			return syncTodo(tx, userID, todoItem, policy)
+		})
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// syncTodo 创建或更新单个TODO
+func syncTodo(r Store, userID int, todoItem TodoSyncItem, policy ConflictPolicy) SyncResult {
+	result := SyncResult{
+		Type:    SyncTypeTodo,
+		LocalID: todoItem.ID,
+		UUID:    todoItem.UUID,
+	}
+
+	// 携带UUID的数据在服务器上已存在时按更新处理
+	if todoItem.ID == 0 && todoItem.UUID != "" {
+		if _, err := uuid.Parse(todoItem.UUID); err != nil {
+			result.Action = "error"
+			result.Message = fmt.Sprintf("invalid uuid: %s", todoItem.UUID)
+			return result
+		}
+		existing, err := r.GetTodoByUUID(userID, todoItem.UUID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			result.Action = "error"
+			result.Message = err.Error()
+			return result
+		}
+		if err == nil {
+			if todoItem.SyncVersion == 0 && todoItem.BaseVersion == 0 {
+				// 客户端从未收到创建结果，重试的创建请求返回已创建的TODO
+				result.Action = "created"
+				result.ServerID = existing.ID
+				result.SyncVersion = existing.SyncVersion
+				result.Message = "重复请求，已创建"
+				return result
+			}
+			todoItem.ID = existing.ID
+		}
+	}
+
+	// 分类UUID优先于分类ID，分类在同一批次中先于TODO处理，因此可以引用本批次新建的分类
+	categoryID := todoItem.CategoryID
+	var categoryUUID *string
+	if todoItem.CategoryUUID != nil {
+		categoryID = nil
+		if *todoItem.CategoryUUID != "" {
+			category, err := r.GetCategoryByUUID(userID, *todoItem.CategoryUUID)
+			if err != nil || category.IsDeleted {
+				result.Action = "error"
+				result.Message = "分类不存在"
+				return result
+			}
+			categoryID = &category.ID
+			categoryUUID = &category.UUID
+		}
+	}
+
+	// 解析时间字段
+	var dueDate, reminder *time.Time
+	if todoItem.DueDate != nil {
+		if parsed, err := time.Parse(time.RFC3339, *todoItem.DueDate); err == nil {
+			dueDate = &parsed
+		}
+	}
+	if todoItem.Reminder != nil {
+		if parsed, err := time.Parse(time.RFC3339, *todoItem.Reminder); err == nil {
+			reminder = &parsed
+		}
+	}
+
+	if todoItem.ID == 0 {
+		if todoItem.IdempotencyKey != "" {
+			todoID, err := lookupIdempotencyKey(r, userID, todoItem.IdempotencyKey, SyncTypeTodo)
+			if err != nil {
+				result.Action = "error"
+				result.Message = err.Error()
+				return result
+			}
+			if todoID != 0 {
+				// 重试的创建请求，返回首次创建的TODO
+				result.Action = "created"
+				result.ServerID = todoID
+				result.Message = "重复请求，已创建"
+				if existing, err := r.GetTodoByID(todoID, userID); err == nil {
+					result.SyncVersion = existing.SyncVersion
+				}
+				return result
+			}
+		}
+
+		// 创建新TODO
+		todo := &Todo{
+			UUID:         todoItem.UUID,
+			UserID:       userID,
+			Title:        todoItem.Title,
+			Description:  todoItem.Description,
+			Completed:    todoItem.Completed,
+			Priority:     Priority(todoItem.Priority),
+			DueDate:      dueDate,
+			Tags:         StringSlice(todoItem.Tags),
+			CategoryID:   categoryID,
+			CategoryUUID: categoryUUID,
+			Reminder:     reminder,
+			Recurrence:   todoItem.Recurrence,
+			IsDeleted:    todoItem.IsDeleted,
+		}
+		if err := NormalizeTodoRecurrence(todo); err != nil {
+			result.Action = "error"
+			result.Message = err.Error()
+			return result
+		}
+
+		if err := r.CreateTodoExtended(todo); err != nil {
+			result.Action = "error"
+			result.Message = err.Error()
+			return result
+		}
+		if todoItem.IdempotencyKey != "" {
+			key := &IdempotencyKey{
+				UserID:       userID,
+				Key:          todoItem.IdempotencyKey,
+				ResourceType: SyncTypeTodo,
+				ResourceID:   todo.ID,
+				CreatedAt:    todo.CreatedAt,
+			}
+			if err := r.CreateIdempotencyKey(key); err != nil {
+				result.Action = "error"
+				result.Message = err.Error()
+				return result
+			}
+		}
+		result.Action = "created"
+		result.ServerID = todo.ID
+		result.UUID = todo.UUID
+		result.SyncVersion = todo.SyncVersion
+		result.Message = "创建成功"
+		return result
+	}
+
+	// 更新现有TODO。先锁定用户的写入再读取，否则并发提交的两台设备可能读到同一版本并都通过版本检查，
+	// 后提交的修改会覆盖先提交的修改
+	if err := r.LockUserWrites(userID); err != nil {
+		result.Action = "error"
+		result.Message = err.Error()
+		return result
+	}
+	existingTodo, err := r.GetTodoByID(todoItem.ID, userID)
+	if err != nil {
+		result.Action = "error"
+		result.Message = "TODO不存在"
+		return result
+	}
+	result.UUID = existingTodo.UUID
+
+	// 客户端提交的数据
+	clientTodo := copyTodo(existingTodo)
+	clientTodo.Title = todoItem.Title
+	clientTodo.Description = todoItem.Description
+	clientTodo.Completed = todoItem.Completed
+	clientTodo.Priority = Priority(todoItem.Priority)
+	clientTodo.DueDate = dueDate
+	clientTodo.Tags = StringSlice(todoItem.Tags)
+	if !intPtrEqual(categoryID, existingTodo.CategoryID) {
+		clientTodo.CategoryID = categoryID
+		clientTodo.CategoryUUID = categoryUUID
+	}
+	clientTodo.Reminder = reminder
+	if todoItem.Recurrence != nil {
+		clientTodo.Recurrence = todoItem.Recurrence
+	}
+	clientTodo.IsDeleted = todoItem.IsDeleted
+	if err := NormalizeTodoRecurrence(&clientTodo); err != nil {
+		result.Action = "error"
+		result.Message = err.Error()
+		return result
+	}
+
+	baseVersion := todoItem.BaseVersion
+	if baseVersion == 0 {
+		baseVersion = todoItem.SyncVersion
+	}
+
+	strategy := policy.strategyFor(existingTodo.ID)
+	if existingTodo.SyncVersion <= baseVersion || strategy == ConflictClientWins {
+		// 客户端基于服务器最新版本修改，或选择以客户端数据为准
+		if err := updateSyncedTodo(r, &result, existingTodo, &clientTodo); err != nil {
+			result.Action = "error"
+			result.Message = err.Error()
+		} else {
+			result.Action = "updated"
+			result.ServerID = clientTodo.ID
+			result.SyncVersion = clientTodo.SyncVersion
+			result.Message = "更新成功"
+		}
+	} else {
+		resolveTodoConflict(r, userID, &result, existingTodo, &clientTodo, baseVersion, strategy)
+	}
+	return result
+}
+
+// updateSyncedTodo 保存同步的TODO修改；重复TODO被标记为完成时同时生成下一次实例并写入 result.Next
+func updateSyncedTodo(r Store, result *SyncResult, previous, todo *Todo) error {
+	next, err := CompleteRecurringTodo(r, previous, todo)
+	if err != nil {
+		return err
+	}
+	if err := r.UpdateTodoExtended(todo); err != nil {
+		return err
+	}
+	if next != nil {
+		nextItem := NewTodoSyncItem(next)
+		result.Next = &nextItem
+	}
+	return nil
+}
+
+// resolveTodoConflict 服务器数据在客户端编辑之后被修改过：基于 base 版本快照做三方合并，
+// merge 策略下没有字段冲突时直接应用合并结果，否则返回冲突、服务器数据和合并建议
+func resolveTodoConflict(r Store, userID int, result *SyncResult, server, client *Todo, baseVersion int64, strategy string) {
+	base, err := r.GetTodoSnapshot(server.ID, userID, baseVersion)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		result.Action = "error"
+		result.Message = err.Error()
+		return
+	}
+
+	merged, conflicts := MergeTodo(base, server, client)
+	serverItem := NewTodoSyncItem(server)
+	result.Server = &serverItem
+	result.ServerID = server.ID
+
+	if strategy == ConflictMerge && len(conflicts) == 0 {
+		if err := updateSyncedTodo(r, result, server, &merged); err != nil {
+			result.Action = "error"
+			result.Message = err.Error()
+			return
+		}
+		mergedItem := NewTodoSyncItem(&merged)
+		result.Action = "merged"
+		result.Merged = &mergedItem
+		result.SyncVersion = merged.SyncVersion
+		result.Message = "已自动合并"
+		return
+	}
+
+	// 合并建议基于服务器当前版本，客户端确认后以该版本作为 base_version 重新提交即可
+	mergedItem := NewTodoSyncItem(&merged)
+	result.Action = "conflict"
+	result.Merged = &mergedItem
+	result.ConflictFields = conflicts
+	result.SyncVersion = server.SyncVersion
+	if base == nil {
+		result.Message = "存在冲突，服务器版本更新，编辑基线已不可用"
+	} else {
+		result.Message = "存在冲突，服务器版本更新"
+	}
+}
+
+// BatchCreateOrUpdateCategories 批量创建或更新分类，每项在独立的保存点中处理；
+// 携带幂等键的创建请求重试时返回首次创建的分类
+func BatchCreateOrUpdateCategories(r Store, userID int, categories []CategorySyncItem) ([]SyncResult, error) {
+	var results []SyncResult
+
+	for _, categoryItem := range categories {
+		result := syncItem(r, func(tx Store) SyncResult {
+			return syncCategory(tx, userID, categoryItem)
+		})
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// syncCategory 创建或更新单个分类
+func syncCategory(r Store, userID int, categoryItem CategorySyncItem) SyncResult {
+	result := SyncResult{
+		Type:    SyncTypeCategory,
+		LocalID: categoryItem.ID,
+		UUID:    categoryItem.UUID,
+	}
+
+	// 携带UUID的数据在服务器上已存在时按更新处理
+	if categoryItem.ID == 0 && categoryItem.UUID != "" {
+		if _, err := uuid.Parse(categoryItem.UUID); err != nil {
+			result.Action = "error"
+			result.Message = fmt.Sprintf("invalid uuid: %s", categoryItem.UUID)
+			return result
+		}
+		existing, err := r.GetCategoryByUUID(userID, categoryItem.UUID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			result.Action = "error"
+			result.Message = err.Error()
+			return result
+		}
+		if err == nil {
+			if categoryItem.SyncVersion == 0 {
+				// 客户端从未收到创建结果，重试的创建请求返回已创建的分类
+				result.Action = "created"
+				result.ServerID = existing.ID
+				result.SyncVersion = existing.SyncVersion
+				result.Message = "重复请求，已创建"
+				return result
+			}
+			categoryItem.ID = existing.ID
+		}
+	}
+
+	if categoryItem.ID == 0 {
+		if categoryItem.IdempotencyKey != "" {
+			categoryID, err := lookupIdempotencyKey(r, userID, categoryItem.IdempotencyKey, SyncTypeCategory)
+			if err != nil {
+				result.Action = "error"
+				result.Message = err.Error()
+				return result
+			}
+			if categoryID != 0 {
+				// 重试的创建请求，返回首次创建的分类
+				result.Action = "created"
+				result.ServerID = categoryID
+				result.Message = "重复请求，已创建"
+				if existing, err := r.GetCategoryByID(categoryID, userID); err == nil {
+					result.SyncVersion = existing.SyncVersion
+				}
+				return result
+			}
+		}
+
+		// 创建新分类
+		category := &Category{
+			UUID:      categoryItem.UUID,
+			UserID:    userID,
+			Name:      categoryItem.Name,
+			Color:     categoryItem.Color,
+			Icon:      categoryItem.Icon,
+			IsDeleted: categoryItem.IsDeleted,
+		}
+
+		if err := r.CreateCategory(category); err != nil {
+			result.Action = "error"
+			result.Message = err.Error()
+			return result
+		}
+		if categoryItem.IdempotencyKey != "" {
+			key := &IdempotencyKey{
+				UserID:       userID,
+				Key:          categoryItem.IdempotencyKey,
+				ResourceType: SyncTypeCategory,
+				ResourceID:   category.ID,
+				CreatedAt:    category.CreatedAt,
+			}
+			if err := r.CreateIdempotencyKey(key); err != nil {
+				result.Action = "error"
+				result.Message = err.Error()
+				return result
+			}
+		}
+		result.Action = "created"
+		result.ServerID = category.ID
+		result.UUID = category.UUID
+		result.SyncVersion = category.SyncVersion
+		result.Message = "创建成功"
+		return result
+	}
+
+	// 更新现有分类
+	existingCategory, err := r.GetCategoryByID(categoryItem.ID, userID)
+	if err != nil {
+		result.Action = "error"
+		result.Message = "分类不存在"
+		return result
+	}
+	result.UUID = existingCategory.UUID
+
+	// 检查冲突
+	clientUpdatedAt, _ := time.Parse(time.RFC3339, categoryItem.UpdatedAt)
+	if existingCategory.UpdatedAt.After(clientUpdatedAt) && existingCategory.SyncVersion > categoryItem.SyncVersion {
+		result.Action = "conflict"
+		result.Message = "存在冲突，服务器版本更新"
+		return result
+	}
+
+	// 更新分类
+	existingCategory.Name = categoryItem.Name
+	existingCategory.Color = categoryItem.Color
+	existingCategory.Icon = categoryItem.Icon
+	existingCategory.IsDeleted = categoryItem.IsDeleted
+
+	if categoryItem.IsDeleted {
+		if err := r.DeleteCategory(categoryItem.ID, userID); err != nil {
+			result.Action = "error"
+			result.Message = err.Error()
+		} else {
+			result.Action = "deleted"
+			result.ServerID = existingCategory.ID
+			result.Message = "删除成功"
+		}
+	} else {
+		if err := r.UpdateCategory(existingCategory); err != nil {
+			result.Action = "error"
+			result.Message = err.Error()
+		} else {
+			result.Action = "updated"
+			result.ServerID = existingCategory.ID
+			result.SyncVersion = existingCategory.SyncVersion
+			result.Message = "更新成功"
+		}
+	}
+	return result
+}
+
+// BatchCreateOrUpdateChecklistItems 批量创建或更新检查项，每项在独立的保存点中处理；
+// 携带幂等键的创建请求重试时返回首次创建的检查项
+func BatchCreateOrUpdateChecklistItems(r Store, userID int, items []ChecklistItemSyncItem) ([]SyncResult, error) {
+	var results []SyncResult
+
+	for _, checklistItem := range items {
+		result := syncItem(r, func(tx Store) SyncResult {
+			return syncChecklistItem(tx, userID, checklistItem)
+		})
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// syncChecklistItem 创建或更新单个检查项
+func syncChecklistItem(r Store, userID int, checklistItem ChecklistItemSyncItem) SyncResult {
+	result := SyncResult{
+		Type:    SyncTypeChecklistItem,
+		LocalID: checklistItem.ID,
+		UUID:    checklistItem.UUID,
+	}
+
+	// 携带UUID的数据在服务器上已存在时按更新处理
+	if checklistItem.ID == 0 && checklistItem.UUID != "" {
+		if _, err := uuid.Parse(checklistItem.UUID); err != nil {
+			result.Action = "error"
+			result.Message = fmt.Sprintf("invalid uuid: %s", checklistItem.UUID)
+			return result
+		}
+		existing, err := r.GetChecklistItemByUUID(userID, checklistItem.UUID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			result.Action = "error"
+			result.Message = err.Error()
+			return result
+		}
+		if err == nil {
+			if checklistItem.SyncVersion == 0 {
+				// 客户端从未收到创建结果，重试的创建请求返回已创建的检查项
+				result.Action = "created"
+				result.ServerID = existing.ID
+				result.SyncVersion = existing.SyncVersion
+				result.Message = "重复请求，已创建"
+				return result
+			}
+			if existing.IsDeleted {
+				result.Action = "deleted"
+				result.ServerID = existing.ID
+				result.Message = "检查项已删除"
+				return result
+			}
+			checklistItem.ID = existing.ID
+		}
+	}
+
+	if checklistItem.ID == 0 {
+		if checklistItem.IdempotencyKey != "" {
+			itemID, err := lookupIdempotencyKey(r, userID, checklistItem.IdempotencyKey, SyncTypeChecklistItem)
+			if err != nil {
+				result.Action = "error"
+				result.Message = err.Error()
+				return result
+			}
+			if itemID != 0 {
+				// 重试的创建请求，返回首次创建的检查项
+				result.Action = "created"
+				result.ServerID = itemID
+				result.Message = "重复请求，已创建"
+				if existing, err := r.GetChecklistItemByID(itemID, userID); err == nil {
+					result.SyncVersion = existing.SyncVersion
+				}
+				return result
+			}
+		}
+
+		// TODO UUID优先于TODO ID，TODO在同一批次中先于检查项处理，因此可以引用本批次新建的TODO
+		var todo *Todo
+		var err error
+		if checklistItem.TodoUUID != "" {
+			todo, err = r.GetTodoByUUID(userID, checklistItem.TodoUUID)
+		} else {
+			todo, err = r.GetTodoByID(checklistItem.TodoID, userID)
+		}
+		if err != nil || todo.IsDeleted {
+			result.Action = "error"
+			result.Message = "TODO不存在"
+			return result
+		}
+
+		// 创建新检查项
+		item := &ChecklistItem{
+			UUID:      checklistItem.UUID,
+			TodoID:    todo.ID,
+			UserID:    userID,
+			Title:     checklistItem.Title,
+			Completed: checklistItem.Completed,
+			Position:  checklistItem.Position,
+			IsDeleted: checklistItem.IsDeleted,
+		}
+
+		if err := r.CreateChecklistItem(item); err != nil {
+			result.Action = "error"
+			result.Message = err.Error()
+			return result
+		}
+		if checklistItem.IdempotencyKey != "" {
+			key := &IdempotencyKey{
+				UserID:       userID,
+				Key:          checklistItem.IdempotencyKey,
+				ResourceType: SyncTypeChecklistItem,
+				ResourceID:   item.ID,
+				CreatedAt:    item.CreatedAt,
+			}
+			if err := r.CreateIdempotencyKey(key); err != nil {
+				result.Action = "error"
+				result.Message = err.Error()
+				return result
+			}
+		}
+		result.Action = "created"
+		result.ServerID = item.ID
+		result.UUID = item.UUID
+		result.SyncVersion = item.SyncVersion
+		result.Message = "创建成功"
+		return result
+	}
+
+	// 更新现有检查项
+	existingItem, err := r.GetChecklistItemByID(checklistItem.ID, userID)
+	if err != nil {
+		result.Action = "error"
+		result.Message = "检查项不存在"
+		return result
+	}
+	result.UUID = existingItem.UUID
+
+	// 检查冲突
+	clientUpdatedAt, _ := time.Parse(time.RFC3339, checklistItem.UpdatedAt)
+	if existingItem.UpdatedAt.After(clientUpdatedAt) && existingItem.SyncVersion > checklistItem.SyncVersion {
+		result.Action = "conflict"
+		result.Message = "存在冲突，服务器版本更新"
+		return result
+	}
+
+	if checklistItem.IsDeleted {
+		if err := r.DeleteChecklistItem(existingItem.ID, userID); err != nil {
+			result.Action = "error"
+			result.Message = err.Error()
+		} else {
+			result.Action = "deleted"
+			result.ServerID = existingItem.ID
+			result.Message = "删除成功"
+		}
+		return result
+	}
+
+	// 更新检查项，所属TODO保持不变
+	existingItem.Title = checklistItem.Title
+	existingItem.Completed = checklistItem.Completed
+	if checklistItem.Position > 0 {
+		existingItem.Position = checklistItem.Position
+	}
+	if err := r.UpdateChecklistItem(existingItem); err != nil {
+		result.Action = "error"
+		result.Message = err.Error()
+	} else {
+		result.Action = "updated"
+		result.ServerID = existingItem.ID
+		result.SyncVersion = existingItem.SyncVersion
+		result.Message = "更新成功"
+	}
+	return result
+}
+
+// BatchCreateOrUpdateTags 批量创建或更新标签元数据，每项在独立的保存点中处理；
+// 携带幂等键的创建请求重试时返回首次创建的标签。修改名称不会改写TODO中的标签，重命名和合并应使用 RenameTag、MergeTags
+func BatchCreateOrUpdateTags(r Store, userID int, tags []TagSyncItem) ([]SyncResult, error) {
+	var results []SyncResult
+
+	for _, tagItem := range tags {
+		result := syncItem(r, func(tx Store) SyncResult {
+			return syncTag(tx, userID, tagItem)
+		})
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// syncTag 创建或更新单个标签
+func syncTag(r Store, userID int, tagItem TagSyncItem) SyncResult {
+	result := SyncResult{
+		Type:    SyncTypeTag,
+		LocalID: tagItem.ID,
+		UUID:    tagItem.UUID,
+	}
+
+	// 携带UUID的数据在服务器上已存在时按更新处理
+	if tagItem.ID == 0 && tagItem.UUID != "" {
+		if _, err := uuid.Parse(tagItem.UUID); err != nil {
+			result.Action = "error"
+			result.Message = fmt.Sprintf("invalid uuid: %s", tagItem.UUID)
+			return result
+		}
+		existing, err := r.GetTagByUUID(userID, tagItem.UUID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			result.Action = "error"
+			result.Message = err.Error()
+			return result
+		}
+		if err == nil {
+			if tagItem.SyncVersion == 0 {
+				// 客户端从未收到创建结果，重试的创建请求返回已创建的标签
+				result.Action = "created"
+				result.ServerID = existing.ID
+				result.SyncVersion = existing.SyncVersion
+				result.Message = "重复请求，已创建"
+				return result
+			}
+			if existing.IsDeleted {
+				result.Action = "deleted"
+				result.ServerID = existing.ID
+				result.Message = "标签已删除"
+				return result
+			}
+			tagItem.ID = existing.ID
+		}
+	}
+
+	if tagItem.ID == 0 {
+		if tagItem.IdempotencyKey != "" {
+			tagID, err := lookupIdempotencyKey(r, userID, tagItem.IdempotencyKey, SyncTypeTag)
+			if err != nil {
+				result.Action = "error"
+				result.Message = err.Error()
+				return result
+			}
+			if tagID != 0 {
+				// 重试的创建请求，返回首次创建的标签
+				result.Action = "created"
+				result.ServerID = tagID
+				result.Message = "重复请求，已创建"
+				if existing, err := r.GetTagByID(tagID, userID); err == nil {
+					result.SyncVersion = existing.SyncVersion
+				}
+				return result
+			}
+		}
+
+		// 创建新标签
+		tag := &Tag{
+			UUID:      tagItem.UUID,
+			UserID:    userID,
+			Name:      tagItem.Name,
+			Color:     tagItem.Color,
+			Icon:      tagItem.Icon,
+			IsDeleted: tagItem.IsDeleted,
+		}
+
+		if err := r.CreateTag(tag); err != nil {
+			result.Action = "error"
+			result.Message = err.Error()
+			return result
+		}
+		if tagItem.IdempotencyKey != "" {
+			key := &IdempotencyKey{
+				UserID:       userID,
+				Key:          tagItem.IdempotencyKey,
+				ResourceType: SyncTypeTag,
+				ResourceID:   tag.ID,
+				CreatedAt:    tag.CreatedAt,
+			}
+			if err := r.CreateIdempotencyKey(key); err != nil {
+				result.Action = "error"
+				result.Message = err.Error()
+				return result
+			}
+		}
+		result.Action = "created"
+		result.ServerID = tag.ID
+		result.UUID = tag.UUID
+		result.SyncVersion = tag.SyncVersion
+		result.Message = "创建成功"
+		return result
+	}
+
+	// 更新现有标签
+	existingTag, err := r.GetTagByID(tagItem.ID, userID)
+	if err != nil {
+		result.Action = "error"
+		result.Message = "标签不存在"
+		return result
+	}
+	result.UUID = existingTag.UUID
+
+	// 检查冲突
+	clientUpdatedAt, _ := time.Parse(time.RFC3339, tagItem.UpdatedAt)
+	if existingTag.UpdatedAt.After(clientUpdatedAt) && existingTag.SyncVersion > tagItem.SyncVersion {
+		result.Action = "conflict"
+		result.Message = "存在冲突，服务器版本更新"
+		return result
+	}
+
+	if tagItem.IsDeleted {
+		if err := r.DeleteTag(existingTag.ID, userID); err != nil {
+			result.Action = "error"
+			result.Message = err.Error()
+		} else {
+			result.Action = "deleted"
+			result.ServerID = existingTag.ID
+			result.Message = "删除成功"
+		}
+		return result
+	}
+
+	existingTag.Name = tagItem.Name
+	existingTag.Color = tagItem.Color
+	existingTag.Icon = tagItem.Icon
+	if err := r.UpdateTag(existingTag); err != nil {
+		result.Action = "error"
+		result.Message = err.Error()
+	} else {
+		result.Action = "updated"
+		result.ServerID = existingTag.ID
+		result.SyncVersion = existingTag.SyncVersion
+		result.Message = "更新成功"
+	}
+	return result
+}
+
+// BatchCreateOrUpdateSmartLists 批量创建或更新智能列表，每项在独立的保存点中处理；
+// 携带幂等键的创建请求重试时返回首次创建的智能列表
+func BatchCreateOrUpdateSmartLists(r Store, userID int, lists []SmartListSyncItem) ([]SyncResult, error) {
+	var results []SyncResult
+
+	for _, listItem := range lists {
+		result := syncItem(r, func(tx Store) SyncResult {
+			return syncSmartList(tx, userID, listItem)
+		})
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// syncSmartList 创建或更新单个智能列表
+func syncSmartList(r Store, userID int, listItem SmartListSyncItem) SyncResult {
+	result := SyncResult{
+		Type:    SyncTypeSmartList,
+		LocalID: listItem.ID,
+		UUID:    listItem.UUID,
+	}
+
+	// 携带UUID的数据在服务器上已存在时按更新处理
+	if listItem.ID == 0 && listItem.UUID != "" {
+		if _, err := uuid.Parse(listItem.UUID); err != nil {
+			result.Action = "error"
+			result.Message = fmt.Sprintf("invalid uuid: %s", listItem.UUID)
+			return result
+		}
+		existing, err := r.GetSmartListByUUID(userID, listItem.UUID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			result.Action = "error"
+			result.Message = err.Error()
+			return result
+		}
+		if err == nil {
+			if listItem.SyncVersion == 0 {
+				// 客户端从未收到创建结果，重试的创建请求返回已创建的智能列表
+				result.Action = "created"
+				result.ServerID = existing.ID
+				result.SyncVersion = existing.SyncVersion
+				result.Message = "重复请求，已创建"
+				return result
+			}
+			if existing.IsDeleted {
+				result.Action = "deleted"
+				result.ServerID = existing.ID
+				result.Message = "智能列表已删除"
+				return result
+			}
+			listItem.ID = existing.ID
+		}
+	}
+
+	// 删除时不检查定义，客户端可能基于旧版本保存了现在无效的条件
+	if !listItem.IsDeleted {
+		if err := listItem.Definition.Validate(); err != nil {
+			result.Action = "error"
+			result.Message = err.Error()
+			return result
+		}
+	}
+
+	if listItem.ID == 0 {
+		if listItem.IdempotencyKey != "" {
+			listID, err := lookupIdempotencyKey(r, userID, listItem.IdempotencyKey, SyncTypeSmartList)
+			if err != nil {
+				result.Action = "error"
+				result.Message = err.Error()
+				return result
+			}
+			if listID != 0 {
+				// 重试的创建请求，返回首次创建的智能列表
+				result.Action = "created"
+				result.ServerID = listID
+				result.Message = "重复请求，已创建"
+				if existing, err := r.GetSmartListByID(listID, userID); err == nil {
+					result.SyncVersion = existing.SyncVersion
+				}
+				return result
+			}
+		}
+
+		// 创建新智能列表
+		list := &SmartList{
+			UUID:       listItem.UUID,
+			UserID:     userID,
+			Name:       listItem.Name,
+			Icon:       listItem.Icon,
+			Color:      listItem.Color,
+			Definition: listItem.Definition,
+			IsDeleted:  listItem.IsDeleted,
+		}
+
+		if err := r.CreateSmartList(list); err != nil {
+			result.Action = "error"
+			result.Message = err.Error()
+			return result
+		}
+		if listItem.IdempotencyKey != "" {
+			key := &IdempotencyKey{
+				UserID:       userID,
+				Key:          listItem.IdempotencyKey,
+				ResourceType: SyncTypeSmartList,
+				ResourceID:   list.ID,
+				CreatedAt:    list.CreatedAt,
+			}
+			if err := r.CreateIdempotencyKey(key); err != nil {
+				result.Action = "error"
+				result.Message = err.Error()
+				return result
+			}
+		}
+		result.Action = "created"
+		result.ServerID = list.ID
+		result.UUID = list.UUID
+		result.SyncVersion = list.SyncVersion
+		result.Message = "创建成功"
+		return result
+	}
+
+	// 更新现有智能列表
+	existingList, err := r.GetSmartListByID(listItem.ID, userID)
+	if err != nil {
+		result.Action = "error"
+		result.Message = "智能列表不存在"
+		return result
+	}
+	result.UUID = existingList.UUID
+
+	// 检查冲突
+	clientUpdatedAt, _ := time.Parse(time.RFC3339, listItem.UpdatedAt)
+	if existingList.UpdatedAt.After(clientUpdatedAt) && existingList.SyncVersion > listItem.SyncVersion {
+		result.Action = "conflict"
+		result.Message = "存在冲突，服务器版本更新"
+		return result
+	}
+
+	if listItem.IsDeleted {
+		if err := r.DeleteSmartList(existingList.ID, userID); err != nil {
+			result.Action = "error"
+			result.Message = err.Error()
+		} else {
+			result.Action = "deleted"
+			result.ServerID = existingList.ID
+			result.Message = "删除成功"
+		}
+		return result
+	}
+
+	existingList.Name = listItem.Name
+	existingList.Icon = listItem.Icon
+	existingList.Color = listItem.Color
+	existingList.Definition = listItem.Definition
+	if err := r.UpdateSmartList(existingList); err != nil {
+		result.Action = "error"
+		result.Message = err.Error()
+	} else {
+		result.Action = "updated"
+		result.ServerID = existingList.ID
+		result.SyncVersion = existingList.SyncVersion
+		result.Message = "更新成功"
+	}
+	return result
+}
+
+// BatchUpdateUserSettings 批量更新用户设置
+func BatchUpdateUserSettings(r UserSettingsStore, userID int, settingsItem *UserSettingsSyncItem) (*SyncResult, error) {
+	result := &SyncResult{
+		Type: SyncTypeSettings,
+	}
+
+	if settingsItem == nil {
+		result.Action = "error"
+		result.Message = "设置数据为空"
+		return result, nil
+	}
+
+	existingSettings, err := r.GetUserSettings(userID)
+	if err != nil {
+		result.Action = "error"
+		result.Message = "获取用户设置失败"
+		return result, err
+	}
+
+	// 检查冲突
+	clientUpdatedAt, _ := time.Parse(time.RFC3339, settingsItem.UpdatedAt)
+	if existingSettings.UpdatedAt.After(clientUpdatedAt) && existingSettings.SyncVersion > settingsItem.SyncVersion {
+		result.Action = "conflict"
+		result.Message = "存在冲突，服务器版本更新"
+		return result, nil
+	}
+
+	// 更新设置
+	existingSettings.Theme = settingsItem.Theme
+	existingSettings.NotificationTime = settingsItem.NotificationTime
+	existingSettings.Language = settingsItem.Language
+	existingSettings.TimeZone = settingsItem.TimeZone
+	if settingsItem.DailyDigest != nil {
+		existingSettings.DailyDigest = *settingsItem.DailyDigest
+	}
+
+	if err := r.UpdateUserSettings(existingSettings); err != nil {
+		result.Action = "error"
+		result.Message = err.Error()
+		return result, err
+	}
+
+	result.Action = "updated"
+	result.SyncVersion = existingSettings.SyncVersion
+	result.Message = "更新成功"
+	return result, nil
 }
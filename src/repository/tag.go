@@ -0,0 +1,425 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TODO的标签仍以名称保存在 todos.tags 中，tags 表只保存标签的颜色、图标等元数据。
+// 没有元数据的标签同样有效，列出标签时以 ID 为 0 的记录返回。
+
+// tagRewriteBatch 改写TODO标签时每次读取的TODO数量
+const tagRewriteBatch = 200
+
+// TagRepository 标签数据访问层
+type TagRepository struct {
+	db *sqlDB
+}
+
+// tagColumns 查询标签时选择的列，与 scanTag 的扫描顺序一致
+const tagColumns = `id, uuid, user_id, name, color, icon, created_at, updated_at, is_deleted, sync_version`
+
+// scanTag 扫描单行标签数据
+func scanTag(scanner interface{ Scan(dest ...any) error }) (*Tag, error) {
+	var tag Tag
+	err := scanner.Scan(&tag.ID, &tag.UUID, &tag.UserID, &tag.Name, &tag.Color, &tag.Icon,
+		&tag.CreatedAt, &tag.UpdatedAt, &tag.IsDeleted, &tag.SyncVersion)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &tag, nil
+}
+
+// queryTags 执行查询并扫描多行标签
+func (r *TagRepository) queryTags(query string, args ...any) ([]Tag, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		tag, err := scanTag(rows)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, *tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// CreateTag 创建标签元数据，同一用户下未删除的标签名称唯一
+func (r *TagRepository) CreateTag(tag *Tag) error {
+	query := `
+		INSERT INTO tags (uuid, user_id, name, color, icon, created_at, updated_at, is_deleted, sync_version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id`
+
+	if tag.UUID == "" {
+		tag.UUID = uuid.NewString()
+	}
+	now := time.Now()
+	return translateError(r.db.withTx(func(tx *sqlDB) error {
+		syncVersion, err := tx.nextSyncVersion(tag.UserID)
+		if err != nil {
+			return err
+		}
+		if err := tx.QueryRow(query, tag.UUID, tag.UserID, tag.Name, tag.Color, tag.Icon,
+			now, now, tag.IsDeleted, syncVersion).Scan(&tag.ID); err != nil {
+			return err
+		}
+		tag.CreatedAt = now
+		tag.UpdatedAt = now
+		tag.SyncVersion = syncVersion
+		tx.recordChange(tag.UserID, syncVersion, ChangedEntity{Type: SyncTypeTag, ID: tag.ID, UUID: tag.UUID})
+		return nil
+	}))
+}
+
+// GetTagsByUserID 获取用户未删除的标签元数据，按名称排序
+func (r *TagRepository) GetTagsByUserID(userID int) ([]Tag, error) {
+	query := `
+		SELECT ` + tagColumns + `
+		FROM tags
+		WHERE user_id = $1 AND is_deleted = FALSE
+		ORDER BY name ASC`
+
+	return r.queryTags(query, userID)
+}
+
+// GetTagByID 根据ID获取单个未删除的标签
+func (r *TagRepository) GetTagByID(tagID, userID int) (*Tag, error) {
+	query := `
+		SELECT ` + tagColumns + `
+		FROM tags
+		WHERE id = $1 AND user_id = $2 AND is_deleted = FALSE`
+
+	return scanTag(r.db.QueryRow(query, tagID, userID))
+}
+
+// GetTagByUUID 根据客户端UUID获取单个标签（包含已删除的标签）
+func (r *TagRepository) GetTagByUUID(userID int, uuid string) (*Tag, error) {
+	query := `
+		SELECT ` + tagColumns + `
+		FROM tags
+		WHERE user_id = $1 AND uuid = $2`
+
+	return scanTag(r.db.QueryRow(query, userID, uuid))
+}
+
+// GetTagByName 根据名称获取单个未删除的标签
+func (r *TagRepository) GetTagByName(userID int, name string) (*Tag, error) {
+	query := `
+		SELECT ` + tagColumns + `
+		FROM tags
+		WHERE user_id = $1 AND name = $2 AND is_deleted = FALSE`
+
+	return scanTag(r.db.QueryRow(query, userID, name))
+}
+
+// UpdateTag 更新标签的名称、颜色和图标，只修改元数据，不改写TODO中的标签
+func (r *TagRepository) UpdateTag(tag *Tag) error {
+	query := `
+		UPDATE tags
+		SET name = $1, color = $2, icon = $3, updated_at = $4, sync_version = $5
+		WHERE id = $6 AND user_id = $7 AND is_deleted = FALSE
+		RETURNING uuid`
+
+	now := time.Now()
+	return translateError(r.db.withTx(func(tx *sqlDB) error {
+		syncVersion, err := tx.nextSyncVersion(tag.UserID)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRow(query, tag.Name, tag.Color, tag.Icon, now, syncVersion, tag.ID, tag.UserID).Scan(&tag.UUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("tag not found or not owned by user: %w", ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		tag.UpdatedAt = now
+		tag.SyncVersion = syncVersion
+		tx.recordChange(tag.UserID, syncVersion, ChangedEntity{Type: SyncTypeTag, ID: tag.ID, UUID: tag.UUID})
+		return nil
+	}))
+}
+
+// DeleteTag 删除标签元数据（软删除，保留为同步墓碑），不改写TODO中的标签
+func (r *TagRepository) DeleteTag(tagID, userID int) error {
+	query := `
+		UPDATE tags
+		SET is_deleted = TRUE, updated_at = $1, sync_version = $2
+		WHERE id = $3 AND user_id = $4 AND is_deleted = FALSE
+		RETURNING uuid`
+
+	now := time.Now()
+	return r.db.withTx(func(tx *sqlDB) error {
+		syncVersion, err := tx.nextSyncVersion(userID)
+		if err != nil {
+			return err
+		}
+		var tagUUID string
+		err = tx.QueryRow(query, now, syncVersion, tagID, userID).Scan(&tagUUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("tag not found or not owned by user: %w", ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		tx.recordChange(userID, syncVersion, ChangedEntity{Type: SyncTypeTag, ID: tagID, UUID: tagUUID})
+		return nil
+	})
+}
+
+// GetTagsSince 按版本号顺序获取同步版本号在 (since, until] 区间内的标签（用于增量同步），limit < 0 表示不限制数量
+func (r *TagRepository) GetTagsSince(userID int, since, until int64, limit int) ([]Tag, error) {
+	query := `
+		SELECT ` + tagColumns + `
+		FROM tags
+		WHERE user_id = $1 AND sync_version > $2 AND sync_version <= $3
+		ORDER BY sync_version ASC` + limitClause(limit)
+
+	return r.queryTags(query, userID, since, until)
+}
+
+// CountTagUsage 统计用户未删除的TODO中每个标签的使用次数
+func (r *TagRepository) CountTagUsage(userID int) (map[string]int, error) {
+	query := fmt.Sprintf(`
+		SELECT tag.value, COUNT(*)
+		FROM todos, %s
+		WHERE todos.user_id = $1 AND todos.is_deleted = FALSE
+		GROUP BY tag.value`, r.db.dialect.tagValues)
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := make(map[string]int)
+	for rows.Next() {
+		var name string
+		var count int
+		if err := rows.Scan(&name, &count); err != nil {
+			return nil, err
+		}
+		usage[name] = count
+	}
+	return usage, rows.Err()
+}
+
+// ListTags 列出用户的全部标签及使用次数：有元数据的标签和TODO中使用但没有元数据的标签（ID 为 0）。
+// 按使用次数从多到少排序，次数相同时按名称排序
+func ListTags(r TagStore, userID int) ([]Tag, error) {
+	tags, err := r.GetTagsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := r.CountTagUsage(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range tags {
+		tags[i].UsageCount = usage[tags[i].Name]
+		delete(usage, tags[i].Name)
+	}
+	for name, count := range usage {
+		tags = append(tags, Tag{UserID: userID, Name: name, UsageCount: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].UsageCount != tags[j].UsageCount {
+			return tags[i].UsageCount > tags[j].UsageCount
+		}
+		return tags[i].Name < tags[j].Name
+	})
+	return tags, nil
+}
+
+// tagExists 判断标签是否有元数据或被未删除的TODO使用，返回元数据（没有时为 nil）
+func tagExists(r Store, userID int, name string) (*Tag, bool, error) {
+	tag, err := r.GetTagByName(userID, name)
+	if err == nil {
+		return tag, true, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, false, err
+	}
+	count, err := r.CountTodos(userID, TodoFilter{Tags: []string{name}})
+	if err != nil {
+		return nil, false, err
+	}
+	return nil, count > 0, nil
+}
+
+// rewriteTodoTags 改写包含 names 中任一标签的全部TODO（包括回收站中的TODO，恢复后标签保持一致），
+// rewrite 返回新的标签列表；返回改写的TODO数量。
+// 改写后的TODO不再包含 names 中的标签，因此每次都从头读取，直到没有匹配的TODO
+func rewriteTodoTags(r Store, userID int, names []string, rewrite func(tags StringSlice) StringSlice) (int, error) {
+	rewritten := 0
+	for _, deleted := range []bool{false, true} {
+		for {
+			todos, err := r.ListTodos(userID, TodoQuery{
+				Filter: TodoFilter{Tags: names, TagMatch: TagMatchAny, Deleted: deleted},
+				Sort:   []TodoSort{{Field: SortCreatedAt}},
+				Limit:  tagRewriteBatch,
+			})
+			if err != nil {
+				return rewritten, err
+			}
+			if len(todos) == 0 {
+				break
+			}
+			for i := range todos {
+				todos[i].Tags = rewrite(todos[i].Tags)
+				if err := r.UpdateTodoExtended(&todos[i]); err != nil {
+					return rewritten, err
+				}
+				rewritten++
+			}
+		}
+	}
+	return rewritten, nil
+}
+
+// RenameTag 将标签 from 重命名为 to，在同一事务中改写全部使用该标签的TODO并更新元数据，返回改写的TODO数量。
+// from 不存在时返回 ErrNotFound；to 已存在时返回 ErrDuplicate，应改用 MergeTags
+func RenameTag(r Store, userID int, from, to string) (int, error) {
+	rewritten := 0
+	err := r.WithTx(func(tx Store) error {
+		tag, ok, err := tagExists(tx, userID, from)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("tag %s: %w", from, ErrNotFound)
+		}
+		if from == to {
+			return nil
+		}
+		if _, taken, err := tagExists(tx, userID, to); err != nil {
+			return err
+		} else if taken {
+			return fmt.Errorf("%w: tag %s already exists", ErrDuplicate, to)
+		}
+
+		rewritten, err = rewriteTodoTags(tx, userID, []string{from}, func(tags StringSlice) StringSlice {
+			renamed := slices.Clone(tags)
+			for i, name := range renamed {
+				if name == from {
+					renamed[i] = to
+				}
+			}
+			return renamed
+		})
+		if err != nil {
+			return err
+		}
+		if tag != nil {
+			tag.Name = to
+			return tx.UpdateTag(tag)
+		}
+		return nil
+	})
+	return rewritten, err
+}
+
+// MergeTags 将 sources 中的标签合并到 target：在同一事务中把TODO上的来源标签替换为 target（不重复），
+// 并删除来源标签的元数据，返回改写的TODO数量。target 没有元数据时沿用第一个有元数据的来源标签的颜色和图标。
+// 来源标签不存在时返回 ErrNotFound
+func MergeTags(r Store, userID int, sources []string, target string) (int, error) {
+	var names []string
+	for _, name := range sources {
+		if name != target && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	rewritten := 0
+	err := r.WithTx(func(tx Store) error {
+		var merged []*Tag
+		for _, name := range names {
+			tag, ok, err := tagExists(tx, userID, name)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("tag %s: %w", name, ErrNotFound)
+			}
+			if tag != nil {
+				merged = append(merged, tag)
+			}
+		}
+		if len(names) == 0 {
+			return nil
+		}
+
+		var err error
+		rewritten, err = rewriteTodoTags(tx, userID, names, func(tags StringSlice) StringSlice {
+			result := StringSlice{}
+			for _, name := range tags {
+				if slices.Contains(names, name) {
+					name = target
+				}
+				if !slices.Contains(result, name) {
+					result = append(result, name)
+				}
+			}
+			return result
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, tag := range merged {
+			if err := tx.DeleteTag(tag.ID, userID); err != nil {
+				return err
+			}
+		}
+		if len(merged) == 0 {
+			return nil
+		}
+		_, err = tx.GetTagByName(userID, target)
+		if errors.Is(err, ErrNotFound) {
+			return tx.CreateTag(&Tag{UserID: userID, Name: target, Color: merged[0].Color, Icon: merged[0].Icon})
+		}
+		return err
+	})
+	return rewritten, err
+}
+
+// RemoveTag 从全部TODO中移除标签并删除其元数据，在同一事务中完成，返回改写的TODO数量。
+// 标签不存在时返回 ErrNotFound
+func RemoveTag(r Store, userID int, name string) (int, error) {
+	rewritten := 0
+	err := r.WithTx(func(tx Store) error {
+		tag, ok, err := tagExists(tx, userID, name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("tag %s: %w", name, ErrNotFound)
+		}
+
+		rewritten, err = rewriteTodoTags(tx, userID, []string{name}, func(tags StringSlice) StringSlice {
+			return slices.DeleteFunc(slices.Clone(tags), func(t string) bool { return t == name })
+		})
+		if err != nil {
+			return err
+		}
+		if tag != nil {
+			return tx.DeleteTag(tag.ID, userID)
+		}
+		return nil
+	})
+	return rewritten, err
+}
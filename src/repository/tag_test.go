@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestStoreTags(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		create := func(title string, tags ...string) *Todo {
+			todo := &Todo{UserID: userID, Title: title, Tags: StringSlice(tags)}
+			if err := store.CreateTodoExtended(todo); err != nil {
+				t.Fatalf("CreateTodoExtended() error = %v", err)
+			}
+			return todo
+		}
+		tagsOf := func(todo *Todo) StringSlice {
+			stored, err := store.GetTodoByID(todo.ID, userID)
+			if err != nil {
+				t.Fatalf("GetTodoByID() error = %v", err)
+			}
+			return stored.Tags
+		}
+
+		report := create("周报", "工做", "重要")
+		plan := create("计划", "work", "工作")
+		create("买菜", "生活")
+		// 回收站中的TODO也随标签改写，恢复后不会带回旧标签
+		trashed := create("旧周报", "工做")
+		trashed.IsDeleted = true
+		if err := store.UpdateTodoExtended(trashed); err != nil {
+			t.Fatalf("UpdateTodoExtended() error = %v", err)
+		}
+		trashedTags := func() StringSlice {
+			stored, err := store.GetDeletedTodo(trashed.ID, userID)
+			if err != nil {
+				t.Fatalf("GetDeletedTodo() error = %v", err)
+			}
+			return stored.Tags
+		}
+
+		urgent := &Tag{UserID: userID, Name: "工做", Color: "#F44336", Icon: "flag"}
+		if err := store.CreateTag(urgent); err != nil {
+			t.Fatalf("CreateTag() error = %v", err)
+		}
+		if err := store.CreateTag(&Tag{UserID: userID, Name: "工做"}); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("CreateTag(duplicate name) error = %v, want ErrDuplicate", err)
+		}
+
+		tags, err := ListTags(store, userID)
+		if err != nil {
+			t.Fatalf("ListTags() error = %v", err)
+		}
+		if len(tags) != 5 || tags[0].Name != "work" || tags[0].UsageCount != 1 {
+			t.Errorf("ListTags() = %+v", tags)
+		}
+		for _, tag := range tags {
+			if (tag.Name == "工做") != (tag.ID != 0) {
+				t.Errorf("ListTags() tag %s id = %d", tag.Name, tag.ID)
+			}
+		}
+
+		// 目标已存在时不能重命名
+		if _, err := RenameTag(store, userID, "工做", "工作"); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("RenameTag(existing target) error = %v, want ErrDuplicate", err)
+		}
+		if _, err := RenameTag(store, userID, "不存在", "新标签"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("RenameTag(missing) error = %v, want ErrNotFound", err)
+		}
+
+		rewritten, err := RenameTag(store, userID, "工做", "工作日")
+		if err != nil || rewritten != 2 {
+			t.Fatalf("RenameTag() = %d, %v; want 2", rewritten, err)
+		}
+		if got := tagsOf(report); !slices.Equal(got, StringSlice{"工作日", "重要"}) {
+			t.Errorf("renamed todo tags = %v", got)
+		}
+		if got := trashedTags(); !slices.Equal(got, StringSlice{"工作日"}) {
+			t.Errorf("renamed trashed todo tags = %v, want [工作日]", got)
+		}
+		renamed, err := store.GetTagByName(userID, "工作日")
+		if err != nil || renamed.ID != urgent.ID || renamed.Color != "#F44336" {
+			t.Errorf("GetTagByName() after rename = %+v, %v", renamed, err)
+		}
+
+		// 合并到已有标签，同一TODO上的重复标签只保留一个
+		rewritten, err = MergeTags(store, userID, []string{"work", "工作日", "work"}, "工作")
+		if err != nil || rewritten != 3 {
+			t.Fatalf("MergeTags() = %d, %v; want 3", rewritten, err)
+		}
+		if got := tagsOf(plan); !slices.Equal(got, StringSlice{"工作"}) {
+			t.Errorf("merged todo tags = %v, want [工作]", got)
+		}
+		if got := tagsOf(report); !slices.Equal(got, StringSlice{"工作", "重要"}) {
+			t.Errorf("merged todo tags = %v, want [工作 重要]", got)
+		}
+		// 目标没有元数据时沿用来源标签的颜色
+		merged, err := store.GetTagByName(userID, "工作")
+		if err != nil || merged.Color != "#F44336" {
+			t.Errorf("GetTagByName() after merge = %+v, %v", merged, err)
+		}
+		if _, err := store.GetTagByID(urgent.ID, userID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetTagByID(merged source) error = %v, want ErrNotFound", err)
+		}
+
+		rewritten, err = RemoveTag(store, userID, "工作")
+		if err != nil || rewritten != 3 {
+			t.Fatalf("RemoveTag() = %d, %v; want 3", rewritten, err)
+		}
+		if got := tagsOf(plan); len(got) != 0 {
+			t.Errorf("todo tags after remove = %v, want empty", got)
+		}
+		if got := trashedTags(); len(got) != 0 {
+			t.Errorf("trashed todo tags after remove = %v, want empty", got)
+		}
+		usage, err := store.CountTagUsage(userID)
+		if err != nil || len(usage) != 2 || usage["重要"] != 1 || usage["生活"] != 1 {
+			t.Errorf("CountTagUsage() = %v, %v", usage, err)
+		}
+
+		// 删除后名称可以重新使用，墓碑仍参与增量同步
+		if err := store.CreateTag(&Tag{UserID: userID, Name: "工作"}); err != nil {
+			t.Errorf("CreateTag(reused name) error = %v", err)
+		}
+		changed, err := store.GetTagsSince(userID, 0, math.MaxInt64, -1)
+		if err != nil {
+			t.Fatalf("GetTagsSince() error = %v", err)
+		}
+		deleted := 0
+		for _, tag := range changed {
+			if tag.IsDeleted {
+				deleted++
+			}
+		}
+		if len(changed) != 3 || deleted != 2 {
+			t.Errorf("GetTagsSince() = %+v, want 2 tombstones and 1 tag", changed)
+		}
+		changes, err := GetChangesSince(store, userID, 0, math.MaxInt64, -1)
+		if err != nil || len(changes.Tags) != 3 {
+			t.Errorf("GetChangesSince() tags = %+v, %v", changes, err)
+		}
+	})
+}
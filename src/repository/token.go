@@ -0,0 +1,87 @@
+package repository
+
+import "time"
+
+// RefreshTokenRepository 刷新令牌数据访问层
+type RefreshTokenRepository struct {
+	db *sqlDB
+}
+
+// CreateRefreshToken 保存刷新令牌
+func (r *RefreshTokenRepository) CreateRefreshToken(token *RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (user_id, session_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`
+
+	return translateError(r.db.QueryRow(query, token.UserID, token.SessionID, token.TokenHash,
+		token.ExpiresAt, token.CreatedAt).Scan(&token.ID))
+}
+
+// GetRefreshTokenByHash 根据令牌哈希获取刷新令牌
+func (r *RefreshTokenRepository) GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error) {
+	query := `
+		SELECT id, user_id, session_id, token_hash, expires_at, created_at, used_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = $1`
+
+	var token RefreshToken
+	err := r.db.QueryRow(query, tokenHash).Scan(&token.ID, &token.UserID, &token.SessionID,
+		&token.TokenHash, &token.ExpiresAt, &token.CreatedAt, &token.UsedAt, &token.RevokedAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed 将令牌标记为已轮换，仅当令牌仍可用时成功，用于防止并发重复刷新
+func (r *RefreshTokenRepository) MarkRefreshTokenUsed(id int, usedAt time.Time) (bool, error) {
+	query := `
+		UPDATE refresh_tokens
+		SET used_at = $1
+		WHERE id = $2 AND used_at IS NULL AND revoked_at IS NULL`
+
+	result, err := r.db.Exec(query, usedAt, id)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+// RevokeSession 撤销某个登录会话的全部刷新令牌
+func (r *RefreshTokenRepository) RevokeSession(userID int, sessionID string, revokedAt time.Time) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = $1
+		WHERE user_id = $2 AND session_id = $3 AND revoked_at IS NULL`
+
+	_, err := r.db.Exec(query, revokedAt, userID, sessionID)
+	return err
+}
+
+// RevokeAllSessions 撤销用户全部登录会话（退出所有设备）
+func (r *RefreshTokenRepository) RevokeAllSessions(userID int, revokedAt time.Time) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = $1
+		WHERE user_id = $2 AND revoked_at IS NULL`
+
+	_, err := r.db.Exec(query, revokedAt, userID)
+	return err
+}
+
+// IsSessionActive 判断登录会话是否仍有效：存在未使用、未撤销且未过期的刷新令牌
+func (r *RefreshTokenRepository) IsSessionActive(userID int, sessionID string, now time.Time) (bool, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM refresh_tokens
+		WHERE user_id = $1 AND session_id = $2
+			AND used_at IS NULL AND revoked_at IS NULL AND expires_at > $3`
+
+	var count int
+	err := r.db.QueryRow(query, userID, sessionID, now).Scan(&count)
+	return count > 0, err
+}
@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// 删除的TODO和分类先进入回收站（软删除），同时作为同步墓碑通知其他设备。
+// 墓碑超过保留期、且用户全部未撤销的设备都已同步过删除后，由 TrashPurger 物理删除；
+// 用户也可以在回收站中恢复或立即彻底删除。
+
+// Tombstone 等待物理删除的已删除数据
+type Tombstone struct {
+	Type        string // todo/category
+	ID          int
+	UserID      int
+	SyncVersion int64
+}
+
+// trashBatch 清空回收站和清理墓碑时每批处理的数量
+const trashBatch = 100
+
+// TrashRepository 回收站数据访问层
+type TrashRepository struct {
+	db *sqlDB
+}
+
+// GetPurgeableTombstones 获取所有用户中删除时间早于 before、且用户全部未撤销设备都已同步过的已删除TODO和分类。
+// 没有注册设备的用户只按保留期判断
+func (r *TrashRepository) GetPurgeableTombstones(before time.Time, limit int) ([]Tombstone, error) {
+	query := `
+		SELECT type, id, user_id, sync_version
+		FROM (
+			SELECT 'todo' AS type, id, user_id, sync_version FROM todos
+			WHERE is_deleted = TRUE AND updated_at < $1
+			UNION ALL
+			SELECT 'category' AS type, id, user_id, sync_version FROM categories
+			WHERE is_deleted = TRUE AND updated_at < $1
+		) tombstones
+		WHERE NOT EXISTS (
+			SELECT 1 FROM devices
+			WHERE devices.user_id = tombstones.user_id AND devices.revoked_at IS NULL
+				AND devices.last_sync_version < tombstones.sync_version
+		)
+		ORDER BY user_id, sync_version
+		` + limitClause(limit)
+
+	rows, err := r.db.Query(query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tombstones []Tombstone
+	for rows.Next() {
+		var tombstone Tombstone
+		if err := rows.Scan(&tombstone.Type, &tombstone.ID, &tombstone.UserID, &tombstone.SyncVersion); err != nil {
+			return nil, err
+		}
+		tombstones = append(tombstones, tombstone)
+	}
+
+	return tombstones, rows.Err()
+}
+
+// RestoreTodo 恢复回收站中的TODO，分配新的同步版本号。原分类已被删除时TODO不再属于任何分类；
+// TODO不在回收站中时返回 ErrNotFound
+func RestoreTodo(r Store, userID, todoID int) (*Todo, error) {
+	var restored *Todo
+	err := r.WithTx(func(tx Store) error {
+		todo, err := tx.GetDeletedTodo(todoID, userID)
+		if err != nil {
+			return err
+		}
+		if todo.CategoryID != nil {
+			category, err := tx.GetCategoryByID(*todo.CategoryID, userID)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+			if err != nil || category.IsDeleted {
+				todo.CategoryID = nil
+				todo.CategoryUUID = nil
+			}
+		}
+		todo.IsDeleted = false
+		if err := tx.UpdateTodoExtended(todo); err != nil {
+			return err
+		}
+		restored = todo
+		return nil
+	})
+	return restored, err
+}
+
+// DeleteTodoPermanently 彻底删除回收站中的TODO，检查项一并删除，修改历史保留。
+// TODO不在回收站中时返回 ErrNotFound
+func DeleteTodoPermanently(r Store, userID, todoID int) error {
+	return r.WithTx(func(tx Store) error {
+		if _, err := tx.GetDeletedTodo(todoID, userID); err != nil {
+			return err
+		}
+		return tx.DeleteTodo(todoID, userID)
+	})
+}
+
+// DeleteCategoryPermanently 彻底删除回收站中的分类。仍属于该分类的未删除TODO先移出分类并分配新的同步版本号，
+// 已删除的TODO直接置空分类。分类不在回收站中时返回 ErrNotFound
+func DeleteCategoryPermanently(r Store, userID, categoryID int) error {
+	return r.WithTx(func(tx Store) error {
+		category, err := tx.GetCategoryByID(categoryID, userID)
+		if err != nil {
+			return err
+		}
+		if !category.IsDeleted {
+			return fmt.Errorf("category is not deleted: %w", ErrNotFound)
+		}
+		for {
+			todos, err := tx.ListTodos(userID, TodoQuery{
+				Filter: TodoFilter{CategoryIDs: []int{categoryID}},
+				Sort:   []TodoSort{{Field: SortCreatedAt}},
+				Limit:  trashBatch,
+			})
+			if err != nil {
+				return err
+			}
+			if len(todos) == 0 {
+				break
+			}
+			for i := range todos {
+				todos[i].CategoryID = nil
+				todos[i].CategoryUUID = nil
+				if err := tx.UpdateTodoExtended(&todos[i]); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.PurgeCategory(categoryID, userID)
+	})
+}
+
+// EmptyTrash 彻底删除用户回收站中的全部TODO和分类，返回删除的TODO和分类数量
+func EmptyTrash(r Store, userID int) (todos, categories int, err error) {
+	err = r.WithTx(func(tx Store) error {
+		for {
+			deleted, err := tx.ListTodos(userID, TodoQuery{
+				Filter: TodoFilter{Deleted: true},
+				Sort:   []TodoSort{{Field: SortCreatedAt}},
+				Limit:  trashBatch,
+			})
+			if err != nil {
+				return err
+			}
+			if len(deleted) == 0 {
+				break
+			}
+			for _, todo := range deleted {
+				if err := tx.DeleteTodo(todo.ID, userID); err != nil {
+					return err
+				}
+				todos++
+			}
+		}
+
+		deleted, err := tx.GetDeletedCategories(userID)
+		if err != nil {
+			return err
+		}
+		for _, category := range deleted {
+			if err := DeleteCategoryPermanently(tx, userID, category.ID); err != nil {
+				return err
+			}
+			categories++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return todos, categories, nil
+}
+
+// PurgeTombstones 物理删除所有用户中删除时间早于 before、且全部设备都已同步过的TODO和分类，返回删除的数量。
+// 每条墓碑在单独的事务中删除；已被恢复或已被其他实例删除的墓碑会被跳过
+func PurgeTombstones(r Store, before time.Time) (int, error) {
+	purged := 0
+	for {
+		tombstones, err := r.GetPurgeableTombstones(before, trashBatch)
+		if err != nil {
+			return purged, err
+		}
+		batch := 0
+		for _, tombstone := range tombstones {
+			switch tombstone.Type {
+			case SyncTypeTodo:
+				err = DeleteTodoPermanently(r, tombstone.UserID, tombstone.ID)
+			case SyncTypeCategory:
+				err = DeleteCategoryPermanently(r, tombstone.UserID, tombstone.ID)
+			}
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return purged, err
+			}
+			batch++
+		}
+		purged += batch
+		// 本批没有删除任何墓碑时停止，避免反复查询到无法删除的数据
+		if len(tombstones) < trashBatch || batch == 0 {
+			return purged, nil
+		}
+	}
+}
+
+// DefaultTrashPurgeInterval 未配置时清理墓碑的间隔
+const DefaultTrashPurgeInterval = time.Hour
+
+// TrashPurger 定期清理超过保留期的墓碑，多个服务实例可以同时运行
+type TrashPurger struct {
+	store     Store
+	retention time.Duration
+	interval  time.Duration
+	now       func() time.Time
+}
+
+// NewTrashPurger 创建墓碑清理任务
+func NewTrashPurger(store Store, config *TrashConfig) *TrashPurger {
+	interval := config.PurgeInterval
+	if interval <= 0 {
+		interval = DefaultTrashPurgeInterval
+	}
+	return &TrashPurger{store: store, retention: config.Retention, interval: interval, now: time.Now}
+}
+
+// Purge 执行一次清理，返回删除的数量
+func (p *TrashPurger) Purge() (int, error) {
+	return PurgeTombstones(p.store, p.now().Add(-p.retention))
+}
+
+// Run 立即清理一次，之后按间隔定期清理，直到 ctx 取消
+func (p *TrashPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if purged, err := p.Purge(); err != nil {
+			log.Printf("trash purger: %v", err)
+		} else if purged > 0 {
+			log.Printf("trash purger: purged %d tombstones", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
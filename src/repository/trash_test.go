@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStoreTrash(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		deleted := func() []Todo {
+			todos, err := store.ListTodos(userID, TodoQuery{Filter: TodoFilter{Deleted: true}, Limit: 10})
+			if err != nil {
+				t.Fatalf("ListTodos(deleted) error = %v", err)
+			}
+			return todos
+		}
+		remove := func(todo *Todo) {
+			todo.IsDeleted = true
+			if err := store.UpdateTodoExtended(todo); err != nil {
+				t.Fatalf("UpdateTodoExtended(delete) error = %v", err)
+			}
+		}
+
+		work := &Category{UserID: userID, Name: "工作"}
+		if err := store.CreateCategory(work); err != nil {
+			t.Fatalf("CreateCategory() error = %v", err)
+		}
+		report := &Todo{UserID: userID, Title: "周报", CategoryID: &work.ID}
+		plan := &Todo{UserID: userID, Title: "计划", CategoryID: &work.ID}
+		milk := &Todo{UserID: userID, Title: "买牛奶"}
+		for _, todo := range []*Todo{report, plan, milk} {
+			if err := store.CreateTodoExtended(todo); err != nil {
+				t.Fatalf("CreateTodoExtended() error = %v", err)
+			}
+		}
+		remove(report)
+		remove(milk)
+		if err := store.DeleteCategory(work.ID, userID); err != nil {
+			t.Fatalf("DeleteCategory() error = %v", err)
+		}
+
+		if got := deleted(); len(got) != 2 {
+			t.Errorf("ListTodos(deleted) = %+v, want 2 todos", got)
+		}
+		if count, err := store.CountTodos(userID, TodoFilter{Deleted: true}); err != nil || count != 2 {
+			t.Errorf("CountTodos(deleted) = %d, %v; want 2", count, err)
+		}
+		categories, err := store.GetDeletedCategories(userID)
+		if err != nil || len(categories) != 1 || categories[0].ID != work.ID {
+			t.Errorf("GetDeletedCategories() = %+v, %v", categories, err)
+		}
+
+		// 原分类仍在回收站中，恢复的TODO不再属于任何分类
+		restored, err := RestoreTodo(store, userID, report.ID)
+		if err != nil {
+			t.Fatalf("RestoreTodo() error = %v", err)
+		}
+		if restored.IsDeleted || restored.CategoryID != nil || restored.SyncVersion <= report.SyncVersion {
+			t.Errorf("RestoreTodo() = %+v", restored)
+		}
+		if _, err := RestoreTodo(store, userID, report.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("RestoreTodo(not deleted) error = %v, want ErrNotFound", err)
+		}
+
+		if err := store.RestoreCategory(work.ID, userID); err != nil {
+			t.Fatalf("RestoreCategory() error = %v", err)
+		}
+		if err := store.RestoreCategory(work.ID, userID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("RestoreCategory(not deleted) error = %v, want ErrNotFound", err)
+		}
+		if err := DeleteCategoryPermanently(store, userID, work.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("DeleteCategoryPermanently(not deleted) error = %v, want ErrNotFound", err)
+		}
+
+		// 彻底删除分类时，仍属于该分类的TODO移出分类并分配新的同步版本号
+		if err := store.DeleteCategory(work.ID, userID); err != nil {
+			t.Fatalf("DeleteCategory() error = %v", err)
+		}
+		if err := DeleteCategoryPermanently(store, userID, work.ID); err != nil {
+			t.Fatalf("DeleteCategoryPermanently() error = %v", err)
+		}
+		moved, err := store.GetTodoByID(plan.ID, userID)
+		if err != nil || moved.CategoryID != nil || moved.SyncVersion <= plan.SyncVersion {
+			t.Errorf("todo of purged category = %+v, %v", moved, err)
+		}
+		if _, err := store.GetCategoryByID(work.ID, userID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetCategoryByID(purged) error = %v, want ErrNotFound", err)
+		}
+
+		if err := DeleteTodoPermanently(store, userID, plan.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("DeleteTodoPermanently(not deleted) error = %v, want ErrNotFound", err)
+		}
+		if err := DeleteTodoPermanently(store, userID, milk.ID); err != nil {
+			t.Fatalf("DeleteTodoPermanently() error = %v", err)
+		}
+		if got := deleted(); len(got) != 0 {
+			t.Errorf("ListTodos(deleted) after permanent delete = %+v", got)
+		}
+
+		remove(moved)
+		home := &Category{UserID: userID, Name: "家庭"}
+		if err := store.CreateCategory(home); err != nil {
+			t.Fatalf("CreateCategory() error = %v", err)
+		}
+		if err := store.DeleteCategory(home.ID, userID); err != nil {
+			t.Fatalf("DeleteCategory() error = %v", err)
+		}
+		todos, categoryCount, err := EmptyTrash(store, userID)
+		if err != nil || todos != 1 || categoryCount != 1 {
+			t.Errorf("EmptyTrash() = %d, %d, %v; want 1, 1", todos, categoryCount, err)
+		}
+		if _, err := store.GetTodoByUUID(userID, plan.UUID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetTodoByUUID(emptied) error = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestPurgeTombstones(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		now := time.Now()
+		device := &Device{ID: "device-1", UserID: userID, Name: "iPhone", Platform: "ios", CreatedAt: now, UpdatedAt: now}
+		if err := store.CreateDevice(device); err != nil {
+			t.Fatalf("CreateDevice() error = %v", err)
+		}
+
+		first := &Todo{UserID: userID, Title: "旧任务"}
+		second := &Todo{UserID: userID, Title: "新任务"}
+		for _, todo := range []*Todo{first, second} {
+			if err := store.CreateTodoExtended(todo); err != nil {
+				t.Fatalf("CreateTodoExtended() error = %v", err)
+			}
+			todo.IsDeleted = true
+			if err := store.UpdateTodoExtended(todo); err != nil {
+				t.Fatalf("UpdateTodoExtended(delete) error = %v", err)
+			}
+		}
+		category := &Category{UserID: userID, Name: "归档"}
+		if err := store.CreateCategory(category); err != nil {
+			t.Fatalf("CreateCategory() error = %v", err)
+		}
+		if err := store.DeleteCategory(category.ID, userID); err != nil {
+			t.Fatalf("DeleteCategory() error = %v", err)
+		}
+
+		// 未超过保留期的墓碑不清理
+		if purged, err := PurgeTombstones(store, now.Add(-time.Hour)); err != nil || purged != 0 {
+			t.Errorf("PurgeTombstones(retained) = %d, %v; want 0", purged, err)
+		}
+		// 设备尚未同步过删除
+		if purged, err := PurgeTombstones(store, now.Add(time.Hour)); err != nil || purged != 0 {
+			t.Errorf("PurgeTombstones(unsynced) = %d, %v; want 0", purged, err)
+		}
+
+		if err := store.AckDeviceSyncVersion(device.ID, userID, first.SyncVersion, now); err != nil {
+			t.Fatalf("AckDeviceSyncVersion() error = %v", err)
+		}
+		if purged, err := PurgeTombstones(store, now.Add(time.Hour)); err != nil || purged != 1 {
+			t.Errorf("PurgeTombstones(partially synced) = %d, %v; want 1", purged, err)
+		}
+		if _, err := store.GetTodoByUUID(userID, first.UUID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetTodoByUUID(purged) error = %v, want ErrNotFound", err)
+		}
+		if _, err := store.GetTodoByUUID(userID, second.UUID); err != nil {
+			t.Errorf("GetTodoByUUID(unsynced tombstone) error = %v", err)
+		}
+
+		// 已撤销的设备不再阻止清理
+		revoked, err := store.GetDeviceByID(device.ID, userID)
+		if err != nil {
+			t.Fatalf("GetDeviceByID() error = %v", err)
+		}
+		revoked.RevokedAt = &now
+		if err := store.UpdateDevice(revoked); err != nil {
+			t.Fatalf("UpdateDevice() error = %v", err)
+		}
+		purger := NewTrashPurger(store, &TrashConfig{Retention: time.Hour})
+		purger.now = func() time.Time { return now.Add(2 * time.Hour) }
+		if purged, err := purger.Purge(); err != nil || purged != 2 {
+			t.Errorf("Purge() = %d, %v; want 2", purged, err)
+		}
+		if _, err := store.GetCategoryByUUID(userID, category.UUID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetCategoryByUUID(purged) error = %v, want ErrNotFound", err)
+		}
+	})
+}
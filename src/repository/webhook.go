@@ -0,0 +1,461 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TODO、分类和用户设置的写入在同一事务中为订阅了对应事件的Webhook生成事件和投递记录，
+// 事务回滚时事件一并撤销，提交后由后台任务发送。没有Webhook订阅时不保存事件。
+// 投递记录的认领和重试规则与提醒投递记录相同；Webhook连续失败达到上限后自动停用。
+
+// Webhook事件类型
+const (
+	WebhookTodoCreated     = "todo.created"
+	WebhookTodoUpdated     = "todo.updated"
+	WebhookTodoCompleted   = "todo.completed"
+	WebhookTodoDeleted     = "todo.deleted"
+	WebhookCategoryCreated = "category.created"
+	WebhookCategoryUpdated = "category.updated"
+	WebhookCategoryDeleted = "category.deleted"
+	WebhookSettingsUpdated = "settings.updated"
+)
+
+// WebhookEventTypes 全部Webhook事件类型
+var WebhookEventTypes = []string{
+	WebhookTodoCreated, WebhookTodoUpdated, WebhookTodoCompleted, WebhookTodoDeleted,
+	WebhookCategoryCreated, WebhookCategoryUpdated, WebhookCategoryDeleted,
+	WebhookSettingsUpdated,
+}
+
+// revisionEvent 根据修改记录生成Webhook事件，不需要发出事件时 Type 为空：
+// 创建为 created，移入回收站或物理删除为 deleted，TODO标记为完成为 completed，其余修改（包括恢复）为 updated。
+// 回收站中的数据被物理删除时不再发出事件，删除事件在移入回收站时已经发出
+func revisionEvent(revision *Revision) *WebhookEvent {
+	action := "updated"
+	switch revision.Action {
+	case RevisionCreate:
+		action = "created"
+	case RevisionDelete:
+		if change, ok := revision.Changes["is_deleted"]; ok && string(change.Old) == "true" {
+			action = ""
+		} else {
+			action = "deleted"
+		}
+	case RevisionUpdate:
+		if revision.EntityType == SyncTypeTodo && isCompletion(revision.Changes) {
+			action = "completed"
+		}
+	}
+
+	event := &WebhookEvent{
+		UserID:      revision.UserID,
+		EntityType:  revision.EntityType,
+		EntityID:    revision.EntityID,
+		EntityUUID:  revision.EntityUUID,
+		SyncVersion: revision.SyncVersion,
+		Changes:     revision.Changes,
+	}
+	if action != "" {
+		event.Type = revision.EntityType + "." + action
+	}
+	return event
+}
+
+// settingsEvent 用户设置修改后发出的Webhook事件
+func settingsEvent(settings *UserSettings) *WebhookEvent {
+	return &WebhookEvent{
+		Type:        WebhookSettingsUpdated,
+		UserID:      settings.UserID,
+		EntityType:  SyncTypeSettings,
+		SyncVersion: settings.SyncVersion,
+	}
+}
+
+// saveTodoRevision 保存TODO的修改记录并发出对应的Webhook事件，事件数据为写入后的TODO，物理删除时为删除前的TODO
+func saveTodoRevision(tx *sqlDB, previous, current *Todo) error {
+	revision := newTodoRevision(previous, current)
+	if err := saveRevision(tx, revision); err != nil || revision == nil {
+		return err
+	}
+	return emitWebhookEvent(tx, revisionEvent(revision), func() (any, error) {
+		if current == nil {
+			return previous, nil
+		}
+		return scanTodo(tx.QueryRow(`SELECT `+todoColumns+` FROM todos WHERE id = $1`, current.ID))
+	})
+}
+
+// saveCategoryRevision 保存分类的修改记录并发出对应的Webhook事件，事件数据为写入后的分类，物理删除时为删除前的分类
+func saveCategoryRevision(tx *sqlDB, previous, current *Category) error {
+	revision := newCategoryRevision(previous, current)
+	if err := saveRevision(tx, revision); err != nil || revision == nil {
+		return err
+	}
+	return emitWebhookEvent(tx, revisionEvent(revision), func() (any, error) {
+		if current == nil {
+			return previous, nil
+		}
+		return scanCategory(tx.QueryRow(`SELECT `+categoryColumns+` FROM categories WHERE id = $1`, current.ID))
+	})
+}
+
+// emitWebhookEvent 在写入数据的同一事务中保存事件，并为每个订阅了该事件的已启用Webhook生成投递记录。
+// event.Type 为空或没有Webhook订阅时不做任何操作，也不会调用 load 读取事件数据
+func emitWebhookEvent(tx *sqlDB, event *WebhookEvent, load func() (any, error)) error {
+	if event.Type == "" {
+		return nil
+	}
+	endpointIDs, err := subscribedEndpointIDs(tx, event.UserID, event.Type)
+	if err != nil || len(endpointIDs) == 0 {
+		return err
+	}
+
+	data, err := load()
+	if err != nil {
+		return err
+	}
+	if event.Data, err = json.Marshal(data); err != nil {
+		return fmt.Errorf("failed to marshal webhook event: %v", err)
+	}
+	event.CreatedAt = time.Now()
+	if err := tx.QueryRow(`
+		INSERT INTO webhook_events (user_id, event_type, entity_type, entity_id, entity_uuid, sync_version, data, changes, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id`,
+		event.UserID, event.Type, event.EntityType, event.EntityID, event.EntityUUID, event.SyncVersion,
+		string(event.Data), event.Changes, event.CreatedAt).Scan(&event.ID); err != nil {
+		return err
+	}
+
+	for _, endpointID := range endpointIDs {
+		if _, err := createWebhookDelivery(tx, endpointID, event.ID, event.Type, event.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribedEndpointIDs 获取订阅了用户 eventType 事件的已启用Webhook：用户自己的Webhook和接收全部用户事件的Webhook
+func subscribedEndpointIDs(db *sqlDB, userID int, eventType string) ([]int, error) {
+	rows, err := db.Query(`
+		SELECT id, events FROM webhook_endpoints
+		WHERE enabled = TRUE AND (user_id = $1 OR all_users = TRUE)
+		ORDER BY id ASC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var endpoint WebhookEndpoint
+		if err := rows.Scan(&endpoint.ID, &endpoint.Events); err != nil {
+			return nil, err
+		}
+		if endpoint.Subscribes(eventType) {
+			ids = append(ids, endpoint.ID)
+		}
+	}
+	return ids, rows.Err()
+}
+
+// createWebhookDelivery 生成待发送的投递记录
+func createWebhookDelivery(db *sqlDB, endpointID, eventID int, eventType string, now time.Time) (*WebhookDelivery, error) {
+	delivery := &WebhookDelivery{
+		EndpointID:    endpointID,
+		EventID:       eventID,
+		EventType:     eventType,
+		Status:        DeliveryPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	err := db.QueryRow(`
+		INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, status, next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		endpointID, eventID, eventType, delivery.Status, now, now, now).Scan(&delivery.ID)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return delivery, nil
+}
+
+// WebhookRepository Webhook数据访问层
+type WebhookRepository struct {
+	db *sqlDB
+}
+
+// webhookEndpointColumns 查询Webhook时选择的列，与 scanWebhookEndpoint 的扫描顺序一致
+const webhookEndpointColumns = `id, user_id, url, secret, events, all_users, enabled, consecutive_failures,
+			disabled_at, disabled_reason, created_at, updated_at`
+
+// scanWebhookEndpoint 扫描单行Webhook
+func scanWebhookEndpoint(scanner interface{ Scan(dest ...any) error }) (*WebhookEndpoint, error) {
+	var endpoint WebhookEndpoint
+	err := scanner.Scan(&endpoint.ID, &endpoint.UserID, &endpoint.URL, &endpoint.Secret, &endpoint.Events,
+		&endpoint.AllUsers, &endpoint.Enabled, &endpoint.ConsecutiveFailures, &endpoint.DisabledAt,
+		&endpoint.DisabledReason, &endpoint.CreatedAt, &endpoint.UpdatedAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &endpoint, nil
+}
+
+// eventsJSON 序列化订阅的事件类型
+func eventsJSON(events StringSlice) (string, error) {
+	if events == nil {
+		events = StringSlice{}
+	}
+	data, err := json.Marshal(events)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal webhook events: %v", err)
+	}
+	return string(data), nil
+}
+
+// CreateWebhookEndpoint 登记Webhook
+func (r *WebhookRepository) CreateWebhookEndpoint(endpoint *WebhookEndpoint) error {
+	events, err := eventsJSON(endpoint.Events)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO webhook_endpoints (user_id, url, secret, events, all_users, enabled, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`
+
+	now := time.Now()
+	if err := r.db.QueryRow(query, endpoint.UserID, endpoint.URL, endpoint.Secret, events,
+		endpoint.AllUsers, endpoint.Enabled, now, now).Scan(&endpoint.ID); err != nil {
+		return translateError(err)
+	}
+	endpoint.CreatedAt = now
+	endpoint.UpdatedAt = now
+	return nil
+}
+
+// GetWebhookEndpoints 获取用户登记的全部Webhook，按创建顺序排序
+func (r *WebhookRepository) GetWebhookEndpoints(userID int) ([]WebhookEndpoint, error) {
+	query := `
+		SELECT ` + webhookEndpointColumns + `
+		FROM webhook_endpoints
+		WHERE user_id = $1
+		ORDER BY id ASC`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var endpoints []WebhookEndpoint
+	for rows.Next() {
+		endpoint, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, *endpoint)
+	}
+
+	return endpoints, rows.Err()
+}
+
+// GetWebhookEndpoint 根据ID获取Webhook，不检查所属用户
+func (r *WebhookRepository) GetWebhookEndpoint(endpointID int) (*WebhookEndpoint, error) {
+	query := `
+		SELECT ` + webhookEndpointColumns + `
+		FROM webhook_endpoints
+		WHERE id = $1`
+
+	return scanWebhookEndpoint(r.db.QueryRow(query, endpointID))
+}
+
+// UpdateWebhookEndpoint 修改Webhook的URL、密钥、订阅的事件和启用状态。
+// 重新启用已停用的Webhook时清零连续失败次数和停用原因
+func (r *WebhookRepository) UpdateWebhookEndpoint(endpoint *WebhookEndpoint) error {
+	events, err := eventsJSON(endpoint.Events)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE webhook_endpoints
+		SET url = $1, secret = $2, events = $3, all_users = $4, enabled = $5, consecutive_failures = $6,
+			disabled_at = $7, disabled_reason = $8, updated_at = $9
+		WHERE id = $10 AND user_id = $11`
+
+	now := time.Now()
+	return r.db.withTx(func(tx *sqlDB) error {
+		previous, err := scanWebhookEndpoint(tx.QueryRow(`
+			SELECT `+webhookEndpointColumns+`
+			FROM webhook_endpoints
+			WHERE id = $1 AND user_id = $2`, endpoint.ID, endpoint.UserID))
+		if err != nil {
+			return err
+		}
+		endpoint.ConsecutiveFailures = previous.ConsecutiveFailures
+		endpoint.DisabledAt = previous.DisabledAt
+		endpoint.DisabledReason = previous.DisabledReason
+		if endpoint.Enabled && !previous.Enabled {
+			endpoint.ConsecutiveFailures = 0
+			endpoint.DisabledAt = nil
+			endpoint.DisabledReason = ""
+		}
+
+		if _, err := tx.Exec(query, endpoint.URL, endpoint.Secret, events, endpoint.AllUsers, endpoint.Enabled,
+			endpoint.ConsecutiveFailures, endpoint.DisabledAt, endpoint.DisabledReason, now,
+			endpoint.ID, endpoint.UserID); err != nil {
+			return err
+		}
+		endpoint.CreatedAt = previous.CreatedAt
+		endpoint.UpdatedAt = now
+		return nil
+	})
+}
+
+// DeleteWebhookEndpoint 删除Webhook及其投递记录，已生成的事件保留
+func (r *WebhookRepository) DeleteWebhookEndpoint(endpointID, userID int) error {
+	result, err := r.db.Exec("DELETE FROM webhook_endpoints WHERE id = $1 AND user_id = $2", endpointID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("webhook not found or not owned by user: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// RecordWebhookResult 记录一次发送结果：lastError 为空表示成功，连续失败次数清零；
+// 否则连续失败次数加一，达到 failureLimit 时停用Webhook。返回本次是否停用了Webhook
+func (r *WebhookRepository) RecordWebhookResult(endpointID int, lastError string, failureLimit int) (bool, error) {
+	now := time.Now()
+	if lastError == "" {
+		_, err := r.db.Exec(`
+			UPDATE webhook_endpoints SET consecutive_failures = 0
+			WHERE id = $1 AND consecutive_failures > 0`, endpointID)
+		return false, err
+	}
+
+	disabled := false
+	err := r.db.withTx(func(tx *sqlDB) error {
+		var failures int
+		err := tx.QueryRow(`
+			UPDATE webhook_endpoints SET consecutive_failures = consecutive_failures + 1, updated_at = $1
+			WHERE id = $2 AND enabled = TRUE
+			RETURNING consecutive_failures`, now, endpointID).Scan(&failures)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && failures < failureLimit) {
+			// Webhook已被删除或停用，或尚未达到上限
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			UPDATE webhook_endpoints SET enabled = FALSE, disabled_at = $1, disabled_reason = $2
+			WHERE id = $3`, now, lastError, endpointID)
+		disabled = err == nil
+		return err
+	})
+	return disabled, err
+}
+
+// GetWebhookEvent 根据ID获取Webhook事件
+func (r *WebhookRepository) GetWebhookEvent(eventID int) (*WebhookEvent, error) {
+	query := `
+		SELECT id, event_type, user_id, entity_type, entity_id, entity_uuid, sync_version, data, changes, created_at
+		FROM webhook_events
+		WHERE id = $1`
+
+	var event WebhookEvent
+	var data []byte
+	err := r.db.QueryRow(query, eventID).Scan(&event.ID, &event.Type, &event.UserID, &event.EntityType,
+		&event.EntityID, &event.EntityUUID, &event.SyncVersion, &data, &event.Changes, &event.CreatedAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	event.Data = json.RawMessage(data)
+	return &event, nil
+}
+
+// webhookDeliveryColumns 查询Webhook投递记录时选择的列，与 scanWebhookDelivery 的扫描顺序一致
+const webhookDeliveryColumns = `id, endpoint_id, event_id, event_type, status, attempts, last_error,
+			next_attempt_at, claimed_by, claimed_until, sent_at, created_at, updated_at`
+
+// scanWebhookDelivery 扫描单行Webhook投递记录
+func scanWebhookDelivery(scanner interface{ Scan(dest ...any) error }) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	err := scanner.Scan(&delivery.ID, &delivery.EndpointID, &delivery.EventID, &delivery.EventType,
+		&delivery.Status, &delivery.Attempts, &delivery.LastError, &delivery.NextAttemptAt, &delivery.ClaimedBy,
+		&delivery.ClaimedUntil, &delivery.SentAt, &delivery.CreatedAt, &delivery.UpdatedAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &delivery, nil
+}
+
+// GetWebhookDeliveries 获取Webhook的投递记录，按创建时间从新到旧排序，limit < 0 表示不限制数量
+func (r *WebhookRepository) GetWebhookDeliveries(endpointID int, limit int) ([]WebhookDelivery, error) {
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries
+		WHERE endpoint_id = $1
+		ORDER BY id DESC` + limitClause(limit)
+
+	rows, err := r.db.Query(query, endpointID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// ReplayWebhookDelivery 为Webhook的一条投递记录对应的事件生成新的待发送投递记录，原记录保持不变。
+// 投递记录不属于该Webhook时返回 ErrNotFound
+func (r *WebhookRepository) ReplayWebhookDelivery(endpointID, deliveryID int) (*WebhookDelivery, error) {
+	var eventID int
+	var eventType string
+	err := r.db.QueryRow(`
+		SELECT event_id, event_type FROM webhook_deliveries
+		WHERE id = $1 AND endpoint_id = $2`, deliveryID, endpointID).Scan(&eventID, &eventType)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return createWebhookDelivery(r.db, endpointID, eventID, eventType, time.Now())
+}
+
+// ClaimWebhookDeliveries 以 owner 身份认领最多 limit 条可以发送的Webhook投递记录，规则与 ClaimReminderDeliveries 相同
+func (r *WebhookRepository) ClaimWebhookDeliveries(owner string, now, leaseUntil time.Time, limit int) ([]WebhookDelivery, error) {
+	return claimDeliveries(r.db, "webhook_deliveries", webhookDeliveryColumns, scanWebhookDelivery, owner, now, leaseUntil, limit)
+}
+
+// FinishWebhookDelivery 保存认领后的发送结果并释放认领，记录已不再由 delivery.ClaimedBy 认领时返回 ErrNotFound
+func (r *WebhookRepository) FinishWebhookDelivery(delivery *WebhookDelivery) error {
+	now, err := finishDelivery(r.db, "webhook_deliveries", delivery.ID, delivery.ClaimedBy,
+		delivery.Status, delivery.LastError, delivery.NextAttemptAt, delivery.SentAt)
+	if err != nil {
+		return err
+	}
+	delivery.ClaimedBy = ""
+	delivery.ClaimedUntil = nil
+	delivery.UpdatedAt = now
+	return nil
+}
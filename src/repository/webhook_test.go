@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWebhookEndpointSubscribes(t *testing.T) {
+	tests := []struct {
+		events StringSlice
+		event  string
+		want   bool
+	}{
+		{nil, WebhookTodoCreated, true},
+		{StringSlice{"*"}, WebhookSettingsUpdated, true},
+		{StringSlice{WebhookTodoCompleted}, WebhookTodoCompleted, true},
+		{StringSlice{WebhookTodoCompleted}, WebhookTodoUpdated, false},
+		{StringSlice{"category.*"}, WebhookCategoryDeleted, true},
+		{StringSlice{"category.*"}, WebhookTodoDeleted, false},
+		{StringSlice{"todo.*"}, "todos.created", false},
+	}
+	for _, tt := range tests {
+		endpoint := &WebhookEndpoint{Events: tt.events}
+		if got := endpoint.Subscribes(tt.event); got != tt.want {
+			t.Errorf("Subscribes(%v, %q) = %v, want %v", tt.events, tt.event, got, tt.want)
+		}
+	}
+}
+
+// webhookEvents 按投递顺序返回Webhook收到的事件
+func webhookEvents(t *testing.T, store Store, endpointID int) []WebhookEvent {
+	t.Helper()
+	deliveries, err := store.GetWebhookDeliveries(endpointID, -1)
+	if err != nil {
+		t.Fatalf("GetWebhookDeliveries() error = %v", err)
+	}
+	events := make([]WebhookEvent, len(deliveries))
+	for i, delivery := range deliveries {
+		event, err := store.GetWebhookEvent(delivery.EventID)
+		if err != nil {
+			t.Fatalf("GetWebhookEvent(%d) error = %v", delivery.EventID, err)
+		}
+		if event.Type != delivery.EventType {
+			t.Errorf("delivery %d event = %q, want %q", delivery.ID, delivery.EventType, event.Type)
+		}
+		events[len(deliveries)-1-i] = *event
+	}
+	return events
+}
+
+func webhookEventTypes(events []WebhookEvent) []string {
+	types := make([]string, len(events))
+	for i, event := range events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+func TestStoreWebhookEvents(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		other := &User{Username: "other", Email: "other@example.com", Password: "hashed"}
+		if err := store.CreateUser(other); err != nil {
+			t.Fatalf("CreateUser() error = %v", err)
+		}
+
+		// 没有Webhook时写入不生成事件
+		early := &Todo{UserID: userID, Title: "早于Webhook"}
+		if err := store.CreateTodoExtended(early); err != nil {
+			t.Fatalf("CreateTodoExtended() error = %v", err)
+		}
+
+		all := &WebhookEndpoint{UserID: userID, URL: "https://example.com/all", Secret: "s1", Enabled: true}
+		todos := &WebhookEndpoint{UserID: userID, URL: "https://example.com/todos", Secret: "s2", Events: StringSlice{"todo.*"}, Enabled: true}
+		admin := &WebhookEndpoint{UserID: other.ID, URL: "https://example.com/admin", Secret: "s3", Events: StringSlice{WebhookTodoCompleted}, AllUsers: true, Enabled: true}
+		mine := &WebhookEndpoint{UserID: other.ID, URL: "https://example.com/other", Secret: "s4", Enabled: true}
+		for _, endpoint := range []*WebhookEndpoint{all, todos, admin, mine} {
+			if err := store.CreateWebhookEndpoint(endpoint); err != nil {
+				t.Fatalf("CreateWebhookEndpoint() error = %v", err)
+			}
+		}
+
+		todo := &Todo{UserID: userID, Title: "写周报"}
+		if err := store.CreateTodoExtended(todo); err != nil {
+			t.Fatalf("CreateTodoExtended() error = %v", err)
+		}
+		todo.Title = "写月报"
+		if err := store.UpdateTodoExtended(todo); err != nil {
+			t.Fatalf("UpdateTodoExtended() error = %v", err)
+		}
+		// 没有变化的写入不生成事件
+		if err := store.UpdateTodoExtended(todo); err != nil {
+			t.Fatalf("UpdateTodoExtended(unchanged) error = %v", err)
+		}
+		todo.Completed = true
+		if err := store.UpdateTodoExtended(todo); err != nil {
+			t.Fatalf("UpdateTodoExtended(completed) error = %v", err)
+		}
+		todo.IsDeleted = true
+		if err := store.UpdateTodoExtended(todo); err != nil {
+			t.Fatalf("UpdateTodoExtended(deleted) error = %v", err)
+		}
+		// 回收站中的TODO被彻底删除时不再发出事件
+		if err := DeleteTodoPermanently(store, userID, todo.ID); err != nil {
+			t.Fatalf("DeleteTodoPermanently() error = %v", err)
+		}
+
+		category := &Category{UserID: userID, Name: "工作"}
+		if err := store.CreateCategory(category); err != nil {
+			t.Fatalf("CreateCategory() error = %v", err)
+		}
+		settings, err := store.CreateDefaultUserSettings(userID)
+		if err != nil {
+			t.Fatalf("CreateDefaultUserSettings() error = %v", err)
+		}
+		settings.Theme = "dark"
+		if err := store.UpdateUserSettings(settings); err != nil {
+			t.Fatalf("UpdateUserSettings() error = %v", err)
+		}
+
+		want := []string{WebhookTodoCreated, WebhookTodoUpdated, WebhookTodoCompleted, WebhookTodoDeleted, WebhookCategoryCreated, WebhookSettingsUpdated}
+		events := webhookEvents(t, store, all.ID)
+		if got := webhookEventTypes(events); !slices.Equal(got, want) {
+			t.Fatalf("all events = %v, want %v", got, want)
+		}
+		if got := webhookEventTypes(webhookEvents(t, store, todos.ID)); !slices.Equal(got, want[:4]) {
+			t.Errorf("todo.* events = %v, want %v", got, want[:4])
+		}
+		if got := webhookEventTypes(webhookEvents(t, store, admin.ID)); !slices.Equal(got, []string{WebhookTodoCompleted}) {
+			t.Errorf("all_users events = %v, want [%s]", got, WebhookTodoCompleted)
+		}
+		if got := webhookEvents(t, store, mine.ID); len(got) != 0 {
+			t.Errorf("other user's events = %v, want none", webhookEventTypes(got))
+		}
+
+		completed := events[2]
+		if completed.UserID != userID || completed.EntityType != SyncTypeTodo || completed.EntityID != todo.ID || completed.EntityUUID != todo.UUID || completed.SyncVersion == 0 {
+			t.Errorf("completed event = %+v", completed)
+		}
+		if change, ok := completed.Changes["completed"]; !ok || string(change.New) != "true" {
+			t.Errorf("completed event changes = %+v", completed.Changes)
+		}
+		var data Todo
+		if err := json.Unmarshal(events[1].Data, &data); err != nil || data.Title != "写月报" || data.UUID != todo.UUID {
+			t.Errorf("updated event data = %s, %v", events[1].Data, err)
+		}
+		var saved UserSettings
+		if err := json.Unmarshal(events[5].Data, &saved); err != nil || saved.Theme != "dark" {
+			t.Errorf("settings event data = %s, %v", events[5].Data, err)
+		}
+	})
+}
+
+func TestStoreWebhookEndpoints(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store, userID int) {
+		endpoint := &WebhookEndpoint{UserID: userID, URL: "https://example.com/hook", Secret: "secret", Events: StringSlice{WebhookTodoCreated}, Enabled: true}
+		if err := store.CreateWebhookEndpoint(endpoint); err != nil {
+			t.Fatalf("CreateWebhookEndpoint() error = %v", err)
+		}
+		endpoints, err := store.GetWebhookEndpoints(userID)
+		if err != nil || len(endpoints) != 1 || endpoints[0].Secret != "secret" || !slices.Equal(endpoints[0].Events, []string{WebhookTodoCreated}) {
+			t.Fatalf("GetWebhookEndpoints() = %+v, %v", endpoints, err)
+		}
+
+		todo := &Todo{UserID: userID, Title: "周报"}
+		if err := store.CreateTodoExtended(todo); err != nil {
+			t.Fatalf("CreateTodoExtended() error = %v", err)
+		}
+		now := time.Now().Add(time.Minute).Truncate(time.Second)
+		claimed, err := store.ClaimWebhookDeliveries("instance-a", now, now.Add(time.Minute), 10)
+		if err != nil || len(claimed) != 1 || claimed[0].Status != DeliverySending || claimed[0].Attempts != 1 || claimed[0].EndpointID != endpoint.ID {
+			t.Fatalf("ClaimWebhookDeliveries() = %+v, %v", claimed, err)
+		}
+		if again, err := store.ClaimWebhookDeliveries("instance-b", now, now.Add(time.Minute), 10); err != nil || len(again) != 0 {
+			t.Errorf("ClaimWebhookDeliveries(claimed) = %+v, %v", again, err)
+		}
+		delivery := claimed[0]
+		delivery.Status = DeliverySent
+		delivery.SentAt = &now
+		if err := store.FinishWebhookDelivery(&delivery); err != nil {
+			t.Fatalf("FinishWebhookDelivery() error = %v", err)
+		}
+
+		// 重放生成新的待发送记录，原记录不变
+		replay, err := store.ReplayWebhookDelivery(endpoint.ID, delivery.ID)
+		if err != nil || replay.ID == delivery.ID || replay.EventID != delivery.EventID || replay.Status != DeliveryPending {
+			t.Fatalf("ReplayWebhookDelivery() = %+v, %v", replay, err)
+		}
+		deliveries, err := store.GetWebhookDeliveries(endpoint.ID, 10)
+		if err != nil || len(deliveries) != 2 || deliveries[0].ID != replay.ID || deliveries[1].Status != DeliverySent {
+			t.Errorf("GetWebhookDeliveries() = %+v, %v", deliveries, err)
+		}
+		if _, err := store.ReplayWebhookDelivery(endpoint.ID+100, delivery.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ReplayWebhookDelivery(other endpoint) error = %v, want ErrNotFound", err)
+		}
+
+		// 连续失败达到上限时停用，成功后清零
+		if disabled, err := store.RecordWebhookResult(endpoint.ID, "timeout", 3); err != nil || disabled {
+			t.Fatalf("RecordWebhookResult(1) = %v, %v", disabled, err)
+		}
+		if disabled, err := store.RecordWebhookResult(endpoint.ID, "", 3); err != nil || disabled {
+			t.Fatalf("RecordWebhookResult(success) = %v, %v", disabled, err)
+		}
+		for i := 1; i <= 3; i++ {
+			disabled, err := store.RecordWebhookResult(endpoint.ID, "webhook returned status 500", 3)
+			if err != nil || disabled != (i == 3) {
+				t.Fatalf("RecordWebhookResult(%d) = %v, %v", i, disabled, err)
+			}
+		}
+		stopped, err := store.GetWebhookEndpoint(endpoint.ID)
+		if err != nil || stopped.Enabled || stopped.ConsecutiveFailures != 3 || stopped.DisabledAt == nil || stopped.DisabledReason != "webhook returned status 500" {
+			t.Fatalf("GetWebhookEndpoint(disabled) = %+v, %v", stopped, err)
+		}
+		if disabled, err := store.RecordWebhookResult(endpoint.ID, "timeout", 3); err != nil || disabled {
+			t.Errorf("RecordWebhookResult(already disabled) = %v, %v", disabled, err)
+		}
+
+		// 停用的Webhook不再生成投递记录
+		before := len(deliveries)
+		todo.Title = "月报"
+		if err := store.UpdateTodoExtended(todo); err != nil {
+			t.Fatalf("UpdateTodoExtended() error = %v", err)
+		}
+		if deliveries, err := store.GetWebhookDeliveries(endpoint.ID, -1); err != nil || len(deliveries) != before {
+			t.Errorf("GetWebhookDeliveries(disabled) = %d, %v; want %d", len(deliveries), err, before)
+		}
+
+		stopped.Enabled = true
+		if err := store.UpdateWebhookEndpoint(stopped); err != nil {
+			t.Fatalf("UpdateWebhookEndpoint(enable) error = %v", err)
+		}
+		enabled, err := store.GetWebhookEndpoint(endpoint.ID)
+		if err != nil || !enabled.Enabled || enabled.ConsecutiveFailures != 0 || enabled.DisabledAt != nil || enabled.DisabledReason != "" {
+			t.Errorf("GetWebhookEndpoint(enabled) = %+v, %v", enabled, err)
+		}
+
+		if err := store.DeleteWebhookEndpoint(endpoint.ID, userID+100); !errors.Is(err, ErrNotFound) {
+			t.Errorf("DeleteWebhookEndpoint(other user) error = %v, want ErrNotFound", err)
+		}
+		if err := store.DeleteWebhookEndpoint(endpoint.ID, userID); err != nil {
+			t.Fatalf("DeleteWebhookEndpoint() error = %v", err)
+		}
+		if _, err := store.GetWebhookEndpoint(endpoint.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetWebhookEndpoint(deleted) error = %v, want ErrNotFound", err)
+		}
+	})
+}